@@ -0,0 +1,30 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package agentops defines the IPC agent operations which ziti executables register in addition to those provided
+// by the fabric and edge
+package agentops
+
+const (
+	// RouterShutdown asks the router to shut down as if it had received SIGTERM. Ids from 192 up are used to stay
+	// clear of the fabric and edge router operations
+	RouterShutdown byte = 192
+
+	// ReloadConfig asks a controller or router to re-read its config file and apply the sections which can be changed
+	// without a restart. It's an agent level operation, handled outside of the app specific operations, so it can be
+	// sent without knowing whether the process is a controller or a router
+	ReloadConfig byte = 0x80
+)
@@ -0,0 +1,199 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package configreload re-reads the config file of a running controller or router and applies the sections of it
+// which can be changed without a restart
+package configreload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/michaelquigley/pfxlog"
+	"gopkg.in/yaml.v2"
+)
+
+// The lines of the agent response to a reload start with these prefixes, followed by the section, or the error
+const (
+	ReloadedPrefix      = "reloaded: "
+	NotReloadablePrefix = "not reloadable, restart to apply: "
+	FailedPrefix        = "failed: "
+	ErrorPrefix         = "error: "
+)
+
+// ApplyFunc applies the value of a config section, which is nil if the section isn't in the config
+type ApplyFunc func(val interface{}) error
+
+// Reloader tracks the config a controller or router is running with, and applies changes to the reloadable sections
+// when the config file is reloaded
+type Reloader struct {
+	path     string
+	current  map[interface{}]interface{}
+	sections map[string]ApplyFunc
+	lock     sync.Mutex
+}
+
+// Result reports which changed sections of the config were reloaded, and which need a restart to take effect
+type Result struct {
+	Reloaded      []string
+	NotReloadable []string
+	Failed        map[string]error
+}
+
+// New reads the config file the process was started with
+func New(path string) (*Reloader, error) {
+	current, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reloader{
+		path:     path,
+		current:  current,
+		sections: map[string]ApplyFunc{},
+	}, nil
+}
+
+// Register makes a top level config section reloadable and applies its current value
+func (self *Reloader) Register(section string, apply ApplyFunc) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.sections[section] = apply
+	return apply(self.current[section])
+}
+
+// Reload re-reads the config file and applies the reloadable sections which changed. Changes to other sections, which
+// currently include the metrics and listener sections, are reported as not reloadable, and are picked up on the next
+// restart. If applying a section fails, the section keeps
+// its previous value, so it's retried on the next reload
+func (self *Reloader) Reload() (*Result, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	updated, err := readConfig(self.path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Failed: map[string]error{}}
+	for _, section := range changedSections(self.current, updated) {
+		apply, found := self.sections[section]
+		if !found {
+			// keep the running value, so the section is reported until the process restarts
+			result.NotReloadable = append(result.NotReloadable, section)
+			restoreSection(updated, self.current, section)
+			continue
+		}
+		if err := apply(updated[section]); err != nil {
+			result.Failed[section] = err
+			restoreSection(updated, self.current, section)
+			continue
+		}
+		result.Reloaded = append(result.Reloaded, section)
+	}
+
+	self.current = updated
+	if result.Complete() {
+		pfxlog.Logger().Infof("reloaded config %v, reloaded sections: %v", self.path, result.Reloaded)
+	} else {
+		pfxlog.Logger().Warnf("reloaded config %v, reloaded sections: %v, sections needing a restart: %v, failed sections: %v",
+			self.path, result.Reloaded, result.NotReloadable, len(result.Failed))
+	}
+	return result, nil
+}
+
+// Complete returns true if all changed sections were applied
+func (self *Result) Complete() bool {
+	return len(self.NotReloadable) == 0 && len(self.Failed) == 0
+}
+
+// String formats the result for the agent response
+func (self *Result) String() string {
+	if len(self.Reloaded) == 0 && len(self.NotReloadable) == 0 && len(self.Failed) == 0 {
+		return "config unchanged\n"
+	}
+	sb := &strings.Builder{}
+	for _, section := range self.Reloaded {
+		_, _ = fmt.Fprintf(sb, "%v%v\n", ReloadedPrefix, section)
+	}
+	for _, section := range self.NotReloadable {
+		_, _ = fmt.Fprintf(sb, "%v%v\n", NotReloadablePrefix, section)
+	}
+	var failed []string
+	for section := range self.Failed {
+		failed = append(failed, section)
+	}
+	sort.Strings(failed)
+	for _, section := range failed {
+		_, _ = fmt.Fprintf(sb, "%v%v: %v\n", FailedPrefix, section, self.Failed[section])
+	}
+	return sb.String()
+}
+
+// restoreSection sets a section of the updated config back to its current value
+func restoreSection(updated, current map[interface{}]interface{}, section string) {
+	if val, found := current[section]; found {
+		updated[section] = val
+	} else {
+		delete(updated, section)
+	}
+}
+
+func readConfig(path string) (map[interface{}]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %v: %w", path, err)
+	}
+	config := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %v: %w", path, err)
+	}
+	return config, nil
+}
+
+// changedSections returns the sorted names of the top level sections which were added, removed or changed
+func changedSections(current, updated map[interface{}]interface{}) []string {
+	var result []string
+	for k, v := range updated {
+		if !reflect.DeepEqual(current[k], v) {
+			result = append(result, fmt.Sprintf("%v", k))
+		}
+	}
+	for k := range current {
+		if _, found := updated[k]; !found {
+			result = append(result, fmt.Sprintf("%v", k))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// HandleAgentOp reloads the config for the ReloadConfig agent operation, and reports the result to the agent client
+func (self *Reloader) HandleAgentOp(conn net.Conn) error {
+	result, err := self.Reload()
+	if err != nil {
+		pfxlog.Logger().WithError(err).Error("unable to reload config")
+		_, err = fmt.Fprintf(conn, "%v%v\n", ErrorPrefix, err)
+		return err
+	}
+	_, err = conn.Write([]byte(result.String()))
+	return err
+}
@@ -0,0 +1,64 @@
+package configreload
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	req := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(config string) {
+		req.NoError(ioutil.WriteFile(path, []byte(config), 0600))
+	}
+	write("v: 3\nlogging:\n  level: info\nmetrics:\n  reportInterval: 15s\n")
+
+	reloader, err := New(path)
+	req.NoError(err)
+
+	var applied []interface{}
+	var failWith error
+	req.NoError(reloader.Register(LoggingSection, func(val interface{}) error {
+		if failWith != nil {
+			return failWith
+		}
+		applied = append(applied, val)
+		return nil
+	}))
+	req.Len(applied, 1, "the current value is applied when registering")
+
+	result, err := reloader.Reload()
+	req.NoError(err)
+	req.True(result.Complete())
+	req.Equal("config unchanged\n", result.String())
+
+	write("v: 3\nlogging:\n  level: debug\nmetrics:\n  reportInterval: 30s\nctrl:\n  listener: tls:0.0.0.0:6262\n")
+	result, err = reloader.Reload()
+	req.NoError(err)
+	req.False(result.Complete())
+	req.Equal([]string{"logging"}, result.Reloaded)
+	req.Equal([]string{"ctrl", "metrics"}, result.NotReloadable)
+	req.Equal(map[interface{}]interface{}{"level": "debug"}, applied[1])
+	req.Equal("reloaded: logging\nnot reloadable, restart to apply: ctrl\nnot reloadable, restart to apply: metrics\n", result.String())
+
+	// sections which can't be reloaded keep being reported until the process restarts
+	result, err = reloader.Reload()
+	req.NoError(err)
+	req.Empty(result.Reloaded)
+	req.Equal([]string{"ctrl", "metrics"}, result.NotReloadable)
+
+	failWith = errors.New("bad level")
+	write("v: 3\nlogging:\n  level: loud\nmetrics:\n  reportInterval: 15s\n")
+	result, err = reloader.Reload()
+	req.NoError(err)
+	req.Equal("failed: logging: bad level\n", result.String())
+
+	write("v: [")
+	_, err = reloader.Reload()
+	req.Error(err)
+}
@@ -0,0 +1,96 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package configreload
+
+import (
+	"fmt"
+
+	"github.com/michaelquigley/pfxlog"
+	"github.com/sirupsen/logrus"
+)
+
+// LoggingSection is the name of the reloadable config section setting log levels:
+//
+//	logging:
+//	  level: info
+//	  channels:
+//	    xgress: debug
+//
+// The level is the global log level and channels sets the levels of individual log channels, as 'ziti agent
+// set-log-level' and 'ziti agent set-channel-log-level' do. Channels which are removed from the section are reset to
+// the global level
+const LoggingSection = "logging"
+
+// NewLoggingApplyFunc returns the ApplyFunc for the logging section
+func NewLoggingApplyFunc() ApplyFunc {
+	var channels []string
+	return func(val interface{}) error {
+		if val == nil {
+			// keep the level set on the command line
+			val = map[interface{}]interface{}{}
+		}
+		section, ok := val.(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("%v must be a map", LoggingSection)
+		}
+
+		var level *logrus.Level
+		if levelVal, found := section["level"]; found {
+			parsed, err := logrus.ParseLevel(fmt.Sprintf("%v", levelVal))
+			if err != nil {
+				return err
+			}
+			level = &parsed
+		}
+
+		channelLevels := map[string]logrus.Level{}
+		if channelsVal, found := section["channels"]; found && channelsVal != nil {
+			channelsMap, ok := channelsVal.(map[interface{}]interface{})
+			if !ok {
+				return fmt.Errorf("%v.channels must be a map", LoggingSection)
+			}
+			for k, v := range channelsMap {
+				parsed, err := logrus.ParseLevel(fmt.Sprintf("%v", v))
+				if err != nil {
+					return fmt.Errorf("channel %v: %w", k, err)
+				}
+				channelLevels[fmt.Sprintf("%v", k)] = parsed
+			}
+		}
+
+		if level != nil {
+			logrus.SetLevel(*level)
+		}
+		pfxlog.GlobalConfig(func(options *pfxlog.Options) *pfxlog.Options {
+			for _, channel := range channels {
+				if _, found := channelLevels[channel]; !found {
+					options.ClearChannelLogLevel(channel)
+				}
+			}
+			for channel, channelLevel := range channelLevels {
+				options.SetChannelLogLevel(channel, channelLevel)
+			}
+			return options
+		})
+
+		channels = channels[:0]
+		for channel := range channelLevels {
+			channels = append(channels, channel)
+		}
+		return nil
+	}
+}
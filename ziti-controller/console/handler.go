@@ -0,0 +1,128 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package console serves the static assets of the Ziti admin console (ZAC) from a controller web listener
+package console
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/openziti/xweb/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	Binding = "zac"
+
+	DefaultContextRoot = "/zac"
+	DefaultIndexFile   = "index.html"
+)
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (factory *Factory) Validate(*xweb.InstanceConfig) error {
+	return nil
+}
+
+func (factory *Factory) Binding() string {
+	return Binding
+}
+
+func (factory *Factory) New(_ *xweb.ServerConfig, options map[interface{}]interface{}) (xweb.ApiHandler, error) {
+	handler := &Handler{
+		options:     options,
+		contextRoot: DefaultContextRoot,
+		indexFile:   DefaultIndexFile,
+	}
+
+	location, _ := options["location"].(string)
+	if location == "" {
+		return nil, errors.Errorf("the %v binding requires a location option pointing at the console assets", Binding)
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %v location %v", Binding, location)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("invalid %v location %v, must be a directory", Binding, location)
+	}
+	handler.location = location
+
+	if indexFile, ok := options["indexFile"].(string); ok && indexFile != "" {
+		handler.indexFile = indexFile
+	}
+
+	if contextRoot, ok := options["contextRoot"].(string); ok && contextRoot != "" {
+		handler.contextRoot = "/" + strings.Trim(contextRoot, "/")
+	}
+
+	if _, err = os.Stat(filepath.Join(location, handler.indexFile)); err != nil {
+		return nil, errors.Wrapf(err, "invalid %v location %v, index file not found", Binding, location)
+	}
+
+	return handler, nil
+}
+
+// Handler serves files from the console location. Paths which don't match a file are served the index file, so
+// the console's client side routes work when loaded directly
+type Handler struct {
+	options     map[interface{}]interface{}
+	location    string
+	indexFile   string
+	contextRoot string
+}
+
+func (self *Handler) Binding() string {
+	return Binding
+}
+
+func (self *Handler) Options() map[interface{}]interface{} {
+	return self.options
+}
+
+func (self *Handler) RootPath() string {
+	return self.contextRoot
+}
+
+func (self *Handler) IsHandler(r *http.Request) bool {
+	return r.URL.Path == self.contextRoot || strings.HasPrefix(r.URL.Path, self.contextRoot+"/")
+}
+
+func (self *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == self.contextRoot {
+		http.Redirect(w, r, self.contextRoot+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	// path.Clean on a rooted path removes any .. elements, so the result can't escape the location
+	relativePath := path.Clean("/" + strings.TrimPrefix(r.URL.Path, self.contextRoot))
+	file := filepath.Join(self.location, filepath.FromSlash(relativePath))
+
+	if info, err := os.Stat(file); err != nil || info.IsDir() {
+		file = filepath.Join(self.location, self.indexFile)
+	}
+
+	http.ServeFile(w, r, file)
+}
@@ -24,10 +24,13 @@ import (
 	"syscall"
 
 	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/agent"
 	"github.com/openziti/edge/controller/server"
 	"github.com/openziti/fabric/controller"
-	"github.com/openziti/agent"
+	"github.com/openziti/ziti/common/agentops"
+	"github.com/openziti/ziti/common/configreload"
 	"github.com/openziti/ziti/common/version"
+	"github.com/openziti/ziti/ziti-controller/console"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -58,6 +61,16 @@ func run(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
+	reloader, err := configreload.New(args[0])
+	if err != nil {
+		startLogger.WithError(err).Error("error reading config for reloading")
+		panic(err)
+	}
+	if err = reloader.Register(configreload.LoggingSection, configreload.NewLoggingApplyFunc()); err != nil {
+		startLogger.WithError(err).Errorf("invalid %v config", configreload.LoggingSection)
+		panic(err)
+	}
+
 	startLogger = startLogger.WithField("nodeId", config.Id.Token)
 	startLogger.Info("starting ziti-controller")
 
@@ -67,6 +80,10 @@ func run(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
+	if err = fabricController.GetXWebInstance().GetRegistry().Add(console.NewFactory()); err != nil {
+		panic(err)
+	}
+
 	edgeController, err := server.NewController(config, fabricController)
 
 	if err != nil {
@@ -78,8 +95,9 @@ func run(cmd *cobra.Command, args []string) {
 	if cliAgentEnabled {
 		options := agent.Options{Addr: cliAgentAddr}
 		options.CustomOps = map[byte]func(conn net.Conn) error{
-			agent.CustomOp:      fabricController.HandleCustomAgentOp,
-			agent.CustomOpAsync: fabricController.HandleCustomAgentAsyncOp,
+			agent.CustomOp:        fabricController.HandleCustomAgentOp,
+			agent.CustomOpAsync:   fabricController.HandleCustomAgentAsyncOp,
+			agentops.ReloadConfig: reloader.HandleAgentOp,
 		}
 		if err := agent.Listen(options); err != nil {
 			pfxlog.Logger().WithError(err).Error("unable to start CLI agent")
@@ -17,8 +17,10 @@
 package subcmd
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/agent"
 	"github.com/openziti/edge/edge_common"
 	"github.com/openziti/edge/router/debugops"
 	"github.com/openziti/edge/router/fabric"
@@ -27,8 +29,9 @@ import (
 	"github.com/openziti/edge/router/xgress_edge_tunnel"
 	"github.com/openziti/fabric/router"
 	"github.com/openziti/fabric/router/xgress"
-	"github.com/openziti/agent"
 	"github.com/openziti/foundation/v2/debugz"
+	"github.com/openziti/ziti/common/agentops"
+	"github.com/openziti/ziti/common/configreload"
 	"github.com/openziti/ziti/common/version"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -94,6 +97,16 @@ func run(cmd *cobra.Command, args []string) {
 		logrus.WithError(err).Panic("error registering edge tunnel in framework")
 	}
 
+	reloader, err := configreload.New(args[0])
+	if err != nil {
+		logrus.WithError(err).Panic("error reading config for reloading")
+	}
+	if err := reloader.Register(configreload.LoggingSection, configreload.NewLoggingApplyFunc()); err != nil {
+		logrus.WithError(err).Panicf("invalid %v config", configreload.LoggingSection)
+	}
+
+	shutdownCh := make(chan os.Signal, 1)
+
 	if cliAgentEnabled {
 		options := agent.Options{Addr: cliAgentAddr}
 		if config.EnableDebugOps {
@@ -101,10 +114,20 @@ func run(cmd *cobra.Command, args []string) {
 		}
 		r.RegisterDefaultAgentOps(enableDebugOps)
 		debugops.RegisterEdgeRouterAgentOps(r, stateManager, enableDebugOps)
+		r.RegisterAgentOp(agentops.RouterShutdown, func(c *bufio.ReadWriter) error {
+			pfxlog.Logger().Info("shutdown requested by CLI agent")
+			select {
+			case shutdownCh <- syscall.SIGTERM:
+			default:
+			}
+			_, err := c.WriteString("shutting down\n")
+			return err
+		})
 
 		options.CustomOps = map[byte]func(conn net.Conn) error{
-			agent.CustomOp:      r.HandleAgentOp,
-			agent.CustomOpAsync: r.HandleAgentAsyncOp,
+			agent.CustomOp:        r.HandleAgentOp,
+			agent.CustomOpAsync:   r.HandleAgentAsyncOp,
+			agentops.ReloadConfig: reloader.HandleAgentOp,
 		}
 
 		if err := agent.Listen(options); err != nil {
@@ -112,7 +135,7 @@ func run(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	go waitForShutdown(r, config)
+	go waitForShutdown(r, config, shutdownCh)
 
 	if err := r.Run(); err != nil {
 		logrus.WithError(err).Fatal("error starting")
@@ -127,8 +150,7 @@ func getFlags(cmd *cobra.Command) map[string]*pflag.Flag {
 	return ret
 }
 
-func waitForShutdown(r *router.Router, config *router.Config) {
-	ch := make(chan os.Signal, 1)
+func waitForShutdown(r *router.Router, config *router.Config, ch chan os.Signal) {
 	signal.Notify(ch, os.Interrupt, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
 
 	s := <-ch
@@ -17,20 +17,37 @@
 package subcmd
 
 import (
+	"time"
+
 	"github.com/openziti/edge/tunnel/intercept/host"
 	"github.com/spf13/cobra"
 )
 
 var runHostCmd = &cobra.Command{
-	Use:     "host",
-	Short:   "Run in 'host' mode",
-	Long:    "The 'host' mode will only host services",
+	Use:   "host",
+	Short: "Run in 'host' mode",
+	Long: "The 'host' mode will only host services.\n\n" +
+		"Hosted services are health checked with the checks in their host config. Services without checks may be given " +
+		"a TCP or HTTP check of their local target with --health-check. When a target fails --unhealthy-after checks in " +
+		"a row its terminators are marked failed, or their cost raised with --unhealthy-cost, so circuits go to healthy " +
+		"hosts. The state of the hosted terminators is logged every --status-interval and, with --status-file, written " +
+		"as JSON whenever it changes.",
+	Example: "  ziti-tunnel host -i host.json --health-check 'web=http://127.0.0.1:8080/health' --health-check 'db=tcp://127.0.0.1:5432'",
 	Args:    cobra.ExactArgs(0),
 	RunE:    runHost,
 	PostRun: rootPostRun,
 }
 
+var hostOptions = &hostMonitorOptions{}
+
 func init() {
+	runHostCmd.Flags().StringArrayVar(&hostOptions.healthChecks, "health-check", nil, "Health check of a service's local target, as <service>=tcp://<host>:<port> or <service>=http(s)://<url>. Used when the service's host config has no checks")
+	runHostCmd.Flags().DurationVar(&hostOptions.interval, "health-interval", 10*time.Second, "How often --health-check checks run")
+	runHostCmd.Flags().DurationVar(&hostOptions.timeout, "health-timeout", 5*time.Second, "Timeout of --health-check checks")
+	runHostCmd.Flags().Uint16Var(&hostOptions.unhealthyAfter, "unhealthy-after", 3, "Number of consecutive failed --health-check checks after which a target is unhealthy")
+	runHostCmd.Flags().Uint16Var(&hostOptions.unhealthyCost, "unhealthy-cost", 0, "Instead of marking the terminator failed, raise its cost by this much for each failed --health-check check once the target is unhealthy, and lower it by as much for each passing check")
+	runHostCmd.Flags().DurationVar(&hostOptions.statusInterval, "status-interval", time.Minute, "How often to log the state of hosted terminators. 0 disables")
+	runHostCmd.Flags().StringVar(&hostOptions.statusFile, "status-file", "", "File to write the state of hosted terminators to, as JSON, whenever it changes")
 	root.AddCommand(runHostCmd)
 }
 
@@ -38,6 +55,14 @@ func runHost(_ *cobra.Command, args []string) error {
 	if !root.Flag(resolverCfgFlag).Changed {
 		_ = root.PersistentFlags().Set(resolverCfgFlag, "")
 	}
+
+	monitor, err := newHostMonitor(hostOptions)
+	if err != nil {
+		return err
+	}
+	hostingMonitor = monitor
+	hostingMonitor.start()
+
 	interceptor = host.New()
 	return nil
 }
@@ -0,0 +1,330 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package subcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/edge/health"
+	"github.com/openziti/edge/tunnel"
+	"github.com/openziti/sdk-golang/ziti"
+	"github.com/openziti/sdk-golang/ziti/edge"
+	"github.com/pkg/errors"
+)
+
+type hostMonitorOptions struct {
+	healthChecks   []string
+	interval       time.Duration
+	timeout        time.Duration
+	unhealthyAfter uint16
+	unhealthyCost  uint16
+	statusInterval time.Duration
+	statusFile     string
+}
+
+// hostMonitor adds the --health-check checks to hosted services and tracks the state of their terminators
+type hostMonitor struct {
+	options     *hostMonitorOptions
+	checks      map[string][]health.CheckDefinition
+	terminators map[*monitoredHostControl]struct{}
+	lock        sync.Mutex
+}
+
+// terminatorStatus is the reported state of a hosted terminator
+type terminatorStatus struct {
+	Service    string    `json:"service"`
+	Precedence string    `json:"precedence"`
+	Cost       uint16    `json:"cost"`
+	Healthy    *bool     `json:"healthy,omitempty"`
+	Checks     []string  `json:"checks"`
+	Since      time.Time `json:"since"`
+}
+
+func newHostMonitor(options *hostMonitorOptions) (*hostMonitor, error) {
+	if options.unhealthyAfter == 0 {
+		return nil, errors.New("--unhealthy-after must be at least 1")
+	}
+
+	result := &hostMonitor{
+		options:     options,
+		checks:      map[string][]health.CheckDefinition{},
+		terminators: map[*monitoredHostControl]struct{}{},
+	}
+
+	for _, val := range options.healthChecks {
+		service, check, err := result.parseHealthCheck(val)
+		if err != nil {
+			return nil, err
+		}
+		result.checks[service] = append(result.checks[service], check)
+	}
+
+	return result, nil
+}
+
+// parseHealthCheck parses a --health-check value of the form <service>=<target url>
+func (self *hostMonitor) parseHealthCheck(val string) (string, health.CheckDefinition, error) {
+	idx := strings.Index(val, "=")
+	if idx < 1 {
+		return "", nil, errors.Errorf("invalid health check '%v', expected <service>=<target url>", val)
+	}
+	service, target := strings.TrimSpace(val[:idx]), strings.TrimSpace(val[idx+1:])
+
+	targetUrl, err := url.Parse(target)
+	if err != nil || targetUrl.Host == "" {
+		return "", nil, errors.Errorf("invalid health check target '%v' for service %v, expected tcp://<host>:<port> or an http(s) URL", target, service)
+	}
+
+	failAction, passAction := "mark unhealthy", "mark healthy"
+	if self.options.unhealthyCost > 0 {
+		failAction = fmt.Sprintf("increase cost %v", self.options.unhealthyCost)
+		passAction = fmt.Sprintf("decrease cost %v", self.options.unhealthyCost)
+	}
+	one := uint16(1)
+	base := health.BaseCheckDefinition{
+		Interval: self.options.interval,
+		Timeout:  self.options.timeout,
+		Actions: []*health.ActionDefinition{
+			{Trigger: "fail", ConsecutiveEvents: &self.options.unhealthyAfter, Action: failAction},
+			{Trigger: "pass", ConsecutiveEvents: &one, Action: passAction},
+			{Trigger: "change", Action: "send event"},
+		},
+	}
+
+	switch targetUrl.Scheme {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(targetUrl.Host); err != nil {
+			return "", nil, errors.Errorf("invalid health check target '%v' for service %v, a port is required", target, service)
+		}
+		return service, &health.PortCheckDefinition{BaseCheckDefinition: base, Address: targetUrl.Host}, nil
+	case "http", "https":
+		return service, &health.HttpCheckDefinition{BaseCheckDefinition: base, Url: target}, nil
+	}
+
+	return "", nil, errors.Errorf("unsupported health check target '%v' for service %v, the scheme must be tcp, http or https", target, service)
+}
+
+// wrap returns a provider which hosts services with the monitor's health checks and reports their state to it
+func (self *hostMonitor) wrap(provider tunnel.FabricProvider) tunnel.FabricProvider {
+	return &monitoredProvider{FabricProvider: provider, monitor: self}
+}
+
+func (self *hostMonitor) start() {
+	if self.options.statusInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(self.options.statusInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			self.logStatus()
+		}
+	}()
+}
+
+func (self *hostMonitor) status() []*terminatorStatus {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var result []*terminatorStatus
+	for terminator := range self.terminators {
+		status := terminator.status
+		result = append(result, &status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Service != result[j].Service {
+			return result[i].Service < result[j].Service
+		}
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result
+}
+
+func (self *hostMonitor) logStatus() {
+	log := pfxlog.Logger()
+	statuses := self.status()
+	if len(statuses) == 0 {
+		log.Info("hosting status: no services hosted")
+		return
+	}
+	for _, status := range statuses {
+		health := "unchecked"
+		if status.Healthy != nil && *status.Healthy {
+			health = "healthy"
+		} else if status.Healthy != nil {
+			health = "unhealthy"
+		}
+		log.WithField("service", status.Service).
+			WithField("precedence", status.Precedence).
+			WithField("cost", status.Cost).
+			WithField("health", health).
+			WithField("since", status.Since.Format(time.RFC3339)).
+			Info("hosting status")
+	}
+}
+
+// changed is called whenever a terminator is added, removed or updated
+func (self *hostMonitor) changed() {
+	if self.options.statusFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(self.status(), "", "    ")
+	if err == nil {
+		err = ioutil.WriteFile(self.options.statusFile, data, 0644)
+	}
+	if err != nil {
+		pfxlog.Logger().WithError(err).Errorf("unable to write hosting status to %v", self.options.statusFile)
+	}
+}
+
+type monitoredProvider struct {
+	tunnel.FabricProvider
+	monitor *hostMonitor
+}
+
+func (self *monitoredProvider) HostService(hostCtx tunnel.HostingContext) (tunnel.HostControl, error) {
+	checks := hostCtx.GetHealthChecks()
+	if len(checks) == 0 {
+		if checks = self.monitor.checks[hostCtx.ServiceName()]; len(checks) > 0 {
+			hostCtx = &checkedHostingContext{HostingContext: hostCtx, checks: checks}
+		}
+	}
+
+	hostControl, err := self.FabricProvider.HostService(hostCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	precedence, cost := hostCtx.GetInitialHealthState()
+	result := &monitoredHostControl{
+		HostControl: hostControl,
+		monitor:     self.monitor,
+		status: terminatorStatus{
+			Service:    hostCtx.ServiceName(),
+			Precedence: precedence.String(),
+			Cost:       cost,
+			Since:      time.Now(),
+		},
+	}
+	for _, check := range checks {
+		result.status.Checks = append(result.status.Checks, check.String())
+	}
+
+	self.monitor.lock.Lock()
+	self.monitor.terminators[result] = struct{}{}
+	self.monitor.lock.Unlock()
+	self.monitor.changed()
+
+	pfxlog.Logger().WithField("service", result.status.Service).
+		WithField("checks", len(checks)).
+		Info("hosting service")
+
+	return result, nil
+}
+
+// checkedHostingContext supplies the --health-check checks of a service without checks in its host config
+type checkedHostingContext struct {
+	tunnel.HostingContext
+	checks []health.CheckDefinition
+}
+
+func (self *checkedHostingContext) GetHealthChecks() []health.CheckDefinition {
+	return self.checks
+}
+
+// monitoredHostControl records the updates the health checks make to a terminator
+type monitoredHostControl struct {
+	tunnel.HostControl
+	monitor *hostMonitor
+	status  terminatorStatus
+}
+
+func (self *monitoredHostControl) update(f func(status *terminatorStatus)) {
+	self.monitor.lock.Lock()
+	before := self.status
+	f(&self.status)
+	changed := before.Precedence != self.status.Precedence || before.Cost != self.status.Cost ||
+		(before.Healthy == nil) != (self.status.Healthy == nil) || (before.Healthy != nil && *before.Healthy != *self.status.Healthy)
+	if changed {
+		self.status.Since = time.Now()
+	}
+	after := self.status
+	self.monitor.lock.Unlock()
+
+	if changed {
+		pfxlog.Logger().WithField("service", after.Service).
+			WithField("precedence", after.Precedence).
+			WithField("cost", after.Cost).
+			Info("hosted terminator state changed")
+		self.monitor.changed()
+	}
+}
+
+func (self *monitoredHostControl) UpdateCost(cost uint16) error {
+	if err := self.HostControl.UpdateCost(cost); err != nil {
+		return err
+	}
+	self.update(func(status *terminatorStatus) {
+		status.Cost = cost
+	})
+	return nil
+}
+
+func (self *monitoredHostControl) UpdatePrecedence(precedence edge.Precedence) error {
+	if err := self.HostControl.UpdatePrecedence(precedence); err != nil {
+		return err
+	}
+	self.update(func(status *terminatorStatus) {
+		status.Precedence = ziti.Precedence(precedence).String()
+	})
+	return nil
+}
+
+func (self *monitoredHostControl) UpdateCostAndPrecedence(cost uint16, precedence edge.Precedence) error {
+	if err := self.HostControl.UpdateCostAndPrecedence(cost, precedence); err != nil {
+		return err
+	}
+	self.update(func(status *terminatorStatus) {
+		status.Cost = cost
+		status.Precedence = ziti.Precedence(precedence).String()
+	})
+	return nil
+}
+
+func (self *monitoredHostControl) SendHealthEvent(pass bool) error {
+	self.update(func(status *terminatorStatus) {
+		status.Healthy = &pass
+	})
+	return self.HostControl.SendHealthEvent(pass)
+}
+
+func (self *monitoredHostControl) Close() error {
+	self.monitor.lock.Lock()
+	delete(self.monitor.terminators, self)
+	self.monitor.lock.Unlock()
+	self.monitor.changed()
+	return self.HostControl.Close()
+}
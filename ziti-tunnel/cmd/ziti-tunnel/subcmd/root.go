@@ -67,6 +67,7 @@ var root = &cobra.Command{
 }
 
 var interceptor intercept.Interceptor
+var hostingMonitor *hostMonitor
 var logFormatter string
 var cliAgentEnabled bool
 var cliAgentAddr string
@@ -173,7 +174,11 @@ func startIdentity(cmd *cobra.Command, serviceListenerGroup *intercept.ServiceLi
 	options := &ziti.Options{
 		RefreshInterval: time.Duration(svcPollRate) * time.Second,
 		OnContextReady: func(ctx ziti.Context) {
-			serviceListener.HandleProviderReady(tunnel.NewContextProvider(ctx))
+			provider := tunnel.NewContextProvider(ctx)
+			if hostingMonitor != nil {
+				provider = hostingMonitor.wrap(provider)
+			}
+			serviceListener.HandleProviderReady(provider)
 		},
 		OnServiceUpdate: serviceListener.HandleServicesChange,
 	}
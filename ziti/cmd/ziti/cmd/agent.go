@@ -21,6 +21,7 @@ import (
 	"github.com/openziti/fabric/controller"
 	"github.com/openziti/fabric/pb/mgmt_pb"
 	"github.com/openziti/fabric/router"
+	"github.com/openziti/ziti/common/agentops"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/agentcli"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
@@ -37,6 +38,8 @@ const (
 func NewAgentCmd(p common.OptionsProvider) *cobra.Command {
 	agentCmd := agentcli.NewAgentCmd(p)
 
+	agentCmd.AddCommand(NewAgentReloadConfigCmd(p))
+
 	ctrlCmd := &cobra.Command{
 		Use:     "controller",
 		Aliases: []string{"c"},
@@ -69,6 +72,7 @@ func NewAgentCmd(p common.OptionsProvider) *cobra.Command {
 	routerCmd.AddCommand(NewSimpleAgentCustomCmd("dump-api-sessions", AgentAppRouter, debugops.DumpApiSessions, p))
 	routerCmd.AddCommand(NewSimpleAgentCustomCmd("dump-links", AgentAppRouter, router.DumpLinks, p))
 	routerCmd.AddCommand(NewForgetLinkAgentCmd(p))
+	routerCmd.AddCommand(NewSimpleAgentCustomCmd("shutdown", AgentAppRouter, agentops.RouterShutdown, p))
 
 	return agentCmd
 }
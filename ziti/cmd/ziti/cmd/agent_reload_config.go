@@ -0,0 +1,110 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/openziti/agent"
+	"github.com/openziti/ziti/common/agentops"
+	"github.com/openziti/ziti/common/configreload"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/agentcli"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+type AgentReloadConfigAction struct {
+	agentcli.AgentOptions
+	pid string
+}
+
+func NewAgentReloadConfigCmd(p common.OptionsProvider) *cobra.Command {
+	action := &AgentReloadConfigAction{
+		AgentOptions: agentcli.AgentOptions{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "reload-config <optional-target>",
+		Short: "Has a controller or router re-read its config file and apply the changes which don't need a restart",
+		Long: "Has a controller or router re-read its config file and apply the changes which don't need a restart. " +
+			"Currently only the logging section, which sets the global and per channel log levels, is reloadable. " +
+			"Other sections, including metrics and the listeners, aren't reloadable yet. The sections which changed " +
+			"are reported as reloaded, or as needing a restart to take effect, in which case the command exits with " +
+			"a partial failure",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			action.Cmd = cmd
+			action.Args = args
+			err := action.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVar(&action.pid, "pid", "", "pid of the controller or router (target of sub-cmd)")
+
+	return cmd
+}
+
+// Run implements the command
+func (self *AgentReloadConfigAction) Run() error {
+	target := self.Args
+	if self.pid != "" {
+		if len(target) > 0 {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "specify the target either with --pid or as an argument, not both")
+		}
+		target = []string{self.pid}
+	}
+
+	addr, err := agent.ParseGopsAddress(target)
+	if err != nil {
+		return err
+	}
+
+	out := &bytes.Buffer{}
+	if err = agent.MakeRequest(addr, agentops.ReloadConfig, nil, out); err != nil {
+		return err
+	}
+	if _, err = os.Stdout.Write(out.Bytes()); err != nil {
+		return err
+	}
+	return checkReloadResponse(out.String())
+}
+
+// checkReloadResponse returns an error if the reload failed, or changes to the config weren't all applied
+func checkReloadResponse(response string) error {
+	notApplied := 0
+	scanner := bufio.NewScanner(strings.NewReader(response))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, configreload.ErrorPrefix):
+			return cmdhelper.Errorf(cmdhelper.ExitCodeGeneral, "unable to reload config: %v", strings.TrimPrefix(line, configreload.ErrorPrefix))
+		case strings.HasPrefix(line, configreload.NotReloadablePrefix), strings.HasPrefix(line, configreload.FailedPrefix):
+			notApplied++
+		}
+	}
+	if notApplied > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodePartialFailure, "%v changed config sections weren't applied, restart to apply them", notApplied)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"testing"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReloadResponse(t *testing.T) {
+	req := require.New(t)
+
+	req.NoError(checkReloadResponse("config unchanged\n"))
+	req.NoError(checkReloadResponse("reloaded: logging\n"))
+
+	err := checkReloadResponse("reloaded: logging\nnot reloadable, restart to apply: metrics\nfailed: web: bad address\n")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "2 changed config sections weren't applied")
+
+	err = checkReloadResponse("error: unable to read config file ctrl.yml\n")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeGeneral, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "unable to read config file ctrl.yml")
+}
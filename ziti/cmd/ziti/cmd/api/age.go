@@ -0,0 +1,46 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseAge parses a duration which, in addition to the units supported by time.ParseDuration, may be given in days
+// (d) or weeks (w)
+func ParseAge(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(val, suffix) {
+			count, err := strconv.ParseFloat(strings.TrimSuffix(val, suffix), 64)
+			if err != nil || count < 0 {
+				return 0, errors.Errorf("invalid age %v", val)
+			}
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+
+	age, err := time.ParseDuration(val)
+	if err != nil || age < 0 {
+		return 0, errors.Errorf("invalid age %v", val)
+	}
+	return age, nil
+}
@@ -0,0 +1,224 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// BulkOptions are the flags controlling how a bulk operation handles items which fail. Each operation has its own
+// default, either stopping at the first failure or carrying on, which the flags override
+type BulkOptions struct {
+	FailFast        bool
+	ContinueOnError bool
+	FailureReport   string
+	RetryFailed     string
+
+	continueByDefault bool
+}
+
+// BulkFailure is an item of a bulk operation which failed, or which wasn't attempted because an earlier item failed
+type BulkFailure struct {
+	Entity    string `json:"entity"`
+	Name      string `json:"name,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Retriable bool   `json:"retriable"`
+	Skipped   bool   `json:"skipped,omitempty"`
+}
+
+// BulkReport is written at the end of a bulk operation with --failure-report, and read back with --retry-failed
+type BulkReport struct {
+	Operation string         `json:"operation"`
+	Finished  time.Time      `json:"finished"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Skipped   int            `json:"skipped"`
+	Failures  []*BulkFailure `json:"failures"`
+}
+
+// AddBulkFlags adds the flags selecting how failures are handled. continueByDefault gives the behavior when neither
+// --fail-fast nor --continue-on-error is set
+func (self *BulkOptions) AddBulkFlags(cmd *cobra.Command, continueByDefault bool) {
+	self.continueByDefault = continueByDefault
+	failFastUsage := "Stop at the first item which fails"
+	continueUsage := "Carry on with the remaining items when one fails"
+	if continueByDefault {
+		continueUsage += " (the default)"
+	} else {
+		failFastUsage += " (the default)"
+	}
+	cmd.Flags().BoolVar(&self.FailFast, "fail-fast", false, failFastUsage)
+	cmd.Flags().BoolVar(&self.ContinueOnError, "continue-on-error", false, continueUsage)
+	cmd.Flags().StringVar(&self.FailureReport, "failure-report", "", "Write the items which failed, or weren't attempted, to this file as JSON")
+	cmd.Flags().StringVar(&self.RetryFailed, "retry-failed", "", "Only process the items listed in this failure report, written by an earlier run")
+}
+
+// StartBulk begins a bulk operation. With --retry-failed, the report given must be for the same operation
+func (self *BulkOptions) StartBulk(operation string) (*BulkRun, error) {
+	if self.FailFast && self.ContinueOnError {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--fail-fast and --continue-on-error can't be combined")
+	}
+
+	run := &BulkRun{
+		options:  self,
+		failFast: self.FailFast || (!self.ContinueOnError && !self.continueByDefault),
+		report:   &BulkReport{Operation: operation, Failures: []*BulkFailure{}},
+	}
+
+	if self.RetryFailed != "" {
+		report, err := ReadBulkReport(self.RetryFailed)
+		if err != nil {
+			return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		if report.Operation != operation {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "failure report %v is for '%v', not '%v'", self.RetryFailed, report.Operation, operation)
+		}
+		run.retry = map[string]bool{}
+		for _, failure := range report.Failures {
+			run.retry[failure.Entity] = true
+		}
+	}
+
+	return run, nil
+}
+
+// ReadBulkReport reads a failure report written by a bulk operation
+func ReadBulkReport(path string) (*BulkReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &BulkReport{}
+	if err = json.Unmarshal(data, report); err != nil {
+		return nil, errors.Wrapf(err, "invalid failure report %v", path)
+	}
+	return report, nil
+}
+
+// BulkRun tracks the items of a bulk operation as they're processed
+type BulkRun struct {
+	options  *BulkOptions
+	failFast bool
+	retry    map[string]bool
+	report   *BulkReport
+	firstErr error
+}
+
+// Include returns whether the item should be processed. With --retry-failed only the items in the report are
+func (self *BulkRun) Include(entity string) bool {
+	return self.retry == nil || self.retry[entity]
+}
+
+// Stopped returns true once an item has failed with --fail-fast. Remaining items should then be passed to Skipped
+func (self *BulkRun) Stopped() bool {
+	return self.failFast && self.firstErr != nil
+}
+
+// Succeeded records an item which was processed
+func (self *BulkRun) Succeeded() {
+	self.report.Succeeded++
+}
+
+// Failed records an item which failed
+func (self *BulkRun) Failed(entity, name string, err error) {
+	if self.firstErr == nil {
+		self.firstErr = err
+	}
+	self.report.Failed++
+	self.report.Failures = append(self.report.Failures, &BulkFailure{
+		Entity:    entity,
+		Name:      name,
+		Error:     err.Error(),
+		Retriable: IsRetriable(err),
+	})
+}
+
+// Skipped records an item which wasn't attempted as the operation stopped at an earlier failure
+func (self *BulkRun) Skipped(entity, name string) {
+	self.report.Skipped++
+	self.report.Failures = append(self.report.Failures, &BulkFailure{
+		Entity:    entity,
+		Name:      name,
+		Retriable: true,
+		Skipped:   true,
+	})
+}
+
+// Finish writes the failure report, if one was asked for, and returns an error if any item failed. If some items
+// succeeded, the error has ExitCodePartialFailure. If the only item failed, its own error is returned
+func (self *BulkRun) Finish() error {
+	if err := self.WriteReport(); err != nil {
+		return err
+	}
+
+	report := self.report
+	if report.Failed == 0 {
+		return nil
+	}
+
+	if report.Succeeded == 0 && report.Failed == 1 && report.Skipped == 0 {
+		return self.firstErr
+	}
+
+	msg := fmt.Sprintf("unable to %v: %v of %v failed", report.Operation, report.Failed, report.Succeeded+report.Failed)
+	if report.Skipped > 0 {
+		msg += fmt.Sprintf(", stopped with %v not attempted", report.Skipped)
+	}
+	if self.options.FailureReport != "" {
+		msg += fmt.Sprintf(". Run again with --retry-failed %v to retry them", self.options.FailureReport)
+	}
+
+	if report.Succeeded > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodePartialFailure, "%v", msg)
+	}
+	return cmdhelper.Errorf(cmdhelper.ExitCodeForError(self.firstErr), "%v", msg)
+}
+
+// WriteReport writes the failure report, if one was asked for. It's called by Finish, and may be used instead by
+// operations which report failures with their own error
+func (self *BulkRun) WriteReport() error {
+	self.report.Finished = time.Now()
+	if self.options.FailureReport == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(self.report, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(self.options.FailureReport, append(data, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "unable to write failure report %v", self.options.FailureReport)
+	}
+	return nil
+}
+
+// IsRetriable returns whether an operation which failed with err may succeed if tried again unchanged. Connectivity
+// and unclassified errors, such as server errors, are retriable, while invalid input, missing entities and auth
+// failures aren't
+func IsRetriable(err error) bool {
+	switch cmdhelper.ExitCodeForError(err) {
+	case cmdhelper.ExitCodeConnectivity, cmdhelper.ExitCodeGeneral:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+// runBulk processes the items, failing those with an error given, as bulk commands do
+func runBulk(req *require.Assertions, options *BulkOptions, items []string, failures map[string]error) error {
+	run, err := options.StartBulk("delete widgets")
+	req.NoError(err)
+	for _, item := range items {
+		if !run.Include(item) {
+			continue
+		}
+		if run.Stopped() {
+			run.Skipped(item, "")
+			continue
+		}
+		if err := failures[item]; err != nil {
+			run.Failed(item, "", err)
+			continue
+		}
+		run.Succeeded()
+	}
+	return run.Finish()
+}
+
+func TestBulkContinueOnError(t *testing.T) {
+	req := require.New(t)
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	options := &BulkOptions{FailureReport: reportFile, continueByDefault: true}
+	failures := map[string]error{
+		"b": cmdhelper.Errorf(cmdhelper.ExitCodeConnectivity, "connection refused"),
+		"c": cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid widget"),
+	}
+
+	err := runBulk(req, options, []string{"a", "b", "c", "d"}, failures)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "2 of 4 failed")
+	req.Contains(err.Error(), "--retry-failed "+reportFile)
+
+	report, err := ReadBulkReport(reportFile)
+	req.NoError(err)
+	req.Equal("delete widgets", report.Operation)
+	req.Equal(2, report.Succeeded)
+	req.Equal(2, report.Failed)
+	req.Equal([]*BulkFailure{
+		{Entity: "b", Error: "connection refused", Retriable: true},
+		{Entity: "c", Error: "invalid widget", Retriable: false},
+	}, report.Failures)
+
+	// retrying only processes the failed items
+	var retried []string
+	retry := &BulkOptions{RetryFailed: reportFile, continueByDefault: true}
+	run, err := retry.StartBulk("delete widgets")
+	req.NoError(err)
+	for _, item := range []string{"a", "b", "c", "d"} {
+		if run.Include(item) {
+			retried = append(retried, item)
+			run.Succeeded()
+		}
+	}
+	req.NoError(run.Finish())
+	req.Equal([]string{"b", "c"}, retried)
+
+	_, err = retry.StartBulk("create widgets")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
+
+func TestBulkFailFast(t *testing.T) {
+	req := require.New(t)
+
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	options := &BulkOptions{FailureReport: reportFile}
+	failures := map[string]error{"b": cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no such widget")}
+
+	err := runBulk(req, options, []string{"a", "b", "c", "d"}, failures)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "stopped with 2 not attempted")
+
+	report, err := ReadBulkReport(reportFile)
+	req.NoError(err)
+	req.Equal(1, report.Succeeded)
+	req.Equal(1, report.Failed)
+	req.Equal(2, report.Skipped)
+	req.Len(report.Failures, 3)
+	req.True(report.Failures[1].Skipped)
+
+	// a single item which fails returns its own error
+	notFound := cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no such widget")
+	err = runBulk(req, &BulkOptions{}, []string{"a"}, map[string]error{"a": notFound})
+	req.Equal(notFound, err)
+
+	// nothing succeeding keeps the exit code of the first failure
+	err = runBulk(req, &BulkOptions{ContinueOnError: true}, []string{"a", "b"}, map[string]error{"a": notFound, "b": errors.New("boom")})
+	req.Equal(cmdhelper.ExitCodeNotFound, cmdhelper.ExitCodeForError(err))
+
+	_, err = (&BulkOptions{FailFast: true, ContinueOnError: true}).StartBulk("delete widgets")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
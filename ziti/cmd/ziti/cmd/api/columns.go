@@ -0,0 +1,175 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+const ColumnsDescription = "Columns to show, in order, given by header name or number. When listing entities, any field " +
+	"of the entities may be given as well, such as createdAt or tags.env"
+
+// RenderEntityTable renders a table with a row per entity, in the order given. Besides the columns of the table,
+// --columns may then select any field of the entities. Entities may be given as gabs containers or as any slice which
+// marshals to a JSON list, such as the models returned by the fabric API
+func RenderEntityTable(o *Options, t table.Writer, entities interface{}, pagingInfo *Paging) {
+	containers, err := entityContainers(entities)
+	cmdhelper.CheckErr(err)
+	if containers == nil {
+		containers = []*gabs.Container{}
+	}
+	renderTable(o, t, containers, pagingInfo)
+}
+
+func entityContainers(entities interface{}) ([]*gabs.Container, error) {
+	if containers, ok := entities.([]*gabs.Container); ok {
+		return containers, nil
+	}
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := gabs.ParseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Data() == nil {
+		return nil, nil
+	}
+	return parsed.Children()
+}
+
+// selectColumns returns a table holding the given columns, in order, followed by the columns of the table and the
+// given entity fields hidden, so rows may still be sorted by them. All columns of the table are shown if none are
+// given. It also returns the names of all columns of the returned table, as hidden columns aren't included when a table
+// is read back. Columns not in the table are looked up as fields of the entities, which must be given in the order of
+// the rows
+func selectColumns(t table.Writer, columns []string, hiddenFields []string, entities []*gabs.Container) (table.Writer, []string, error) {
+	records := tableRecords(t)
+	if len(records) == 0 {
+		return t, nil, nil
+	}
+	header, rows := records[0], records[1:]
+
+	var names []string
+	var values []func(rowIdx int) string
+	addColumn := func(col string) error {
+		if number := columnNumber(header, col); number > 0 {
+			names = append(names, header[number-1])
+			values = append(values, func(rowIdx int) string {
+				return recordValue(rows[rowIdx], number-1)
+			})
+			return nil
+		}
+		if entities == nil || len(entities) != len(rows) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid column '%v', must be one of %v", col, strings.Join(header, ", "))
+		}
+		names = append(names, col)
+		values = append(values, func(rowIdx int) string {
+			return entityFieldValue(entities[rowIdx].Path(col).Data())
+		})
+		return nil
+	}
+
+	if len(columns) == 0 {
+		for idx := range header {
+			columns = append(columns, strconv.Itoa(idx+1))
+		}
+	}
+	for _, col := range columns {
+		if col = strings.TrimSpace(col); col != "" {
+			if err := addColumn(col); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	visible := len(names)
+	for idx := range header {
+		_ = addColumn(strconv.Itoa(idx + 1))
+	}
+	for _, field := range hiddenFields {
+		if err := addColumn(field); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	result := table.NewWriter()
+	result.SetStyle(*t.Style())
+
+	headerRow := table.Row{}
+	for _, name := range names {
+		headerRow = append(headerRow, name)
+	}
+	result.AppendHeader(headerRow)
+
+	for rowIdx := range rows {
+		row := table.Row{}
+		for _, value := range values {
+			row = append(row, value(rowIdx))
+		}
+		result.AppendRow(row)
+	}
+
+	var configs []table.ColumnConfig
+	for number := visible + 1; number <= len(names); number++ {
+		configs = append(configs, table.ColumnConfig{Number: number, Hidden: true})
+	}
+	result.SetColumnConfigs(configs)
+
+	return result, names, nil
+}
+
+func recordValue(record []string, idx int) string {
+	if idx < len(record) {
+		return record[idx]
+	}
+	return ""
+}
+
+// entityFieldValue formats a field of an entity for a table cell. Lists are shown a value per line, like role
+// attributes are, and maps as JSON
+func entityFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var result []string
+		for _, elem := range v {
+			result = append(result, entityFieldValue(elem))
+		}
+		return strings.Join(result, "\n")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
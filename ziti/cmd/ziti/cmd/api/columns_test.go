@@ -0,0 +1,78 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectColumns(t *testing.T) {
+	req := require.New(t)
+
+	tbl, header, err := selectColumns(newSortTestTable(), []string{"cost", "1"}, nil, nil)
+	req.NoError(err)
+	req.Equal([]string{"Cost", "ID", "ID", "Name", "Cost"}, header)
+	req.Equal("Cost,ID\n10,c\n9,a\n10,b", tbl.RenderCSV())
+
+	sortBy, err := columnsSortBy(header, []string{"name", "-cost"})
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.Equal("Cost,ID\n10,b\n9,a\n10,c", tbl.RenderCSV())
+
+	_, _, err = selectColumns(newSortTestTable(), []string{"createdAt"}, nil, nil)
+	req.Error(err)
+}
+
+func TestSelectEntityColumns(t *testing.T) {
+	req := require.New(t)
+
+	var entities []*gabs.Container
+	for _, entity := range []string{
+		`{"id":"c","createdAt":"2022-03-01T00:00:00Z","tags":{"env":"prod"},"roleAttributes":["x","y"]}`,
+		`{"id":"a","createdAt":"2022-01-01T00:00:00Z","tags":{}}`,
+		`{"id":"b","createdAt":"2022-02-01T00:00:00Z","tags":{"env":"dev"},"cost":1.5}`,
+	} {
+		container, err := gabs.ParseJSON([]byte(entity))
+		req.NoError(err)
+		entities = append(entities, container)
+	}
+
+	tbl, header, err := selectColumns(newSortTestTable(), []string{"id", "createdAt", "tags.env", "roleAttributes", "cost"}, nil, entities)
+	req.NoError(err)
+	sortBy, err := columnsSortBy(header, []string{"-createdAt"})
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.Equal([][]string{
+		{"ID", "createdAt", "tags.env", "roleAttributes", "Cost"},
+		{"c", "2022-03-01T00:00:00Z", "prod", "x\ny", "10"},
+		{"b", "2022-02-01T00:00:00Z", "dev", "", "10"},
+		{"a", "2022-01-01T00:00:00Z", "", "", "9"},
+	}, tableRecords(tbl))
+
+	containers, err := entityContainers([]struct {
+		Cost float64 `json:"cost"`
+	}{{Cost: 1.5}})
+	req.NoError(err)
+	req.Len(containers, 1)
+	req.Equal("1.5", entityFieldValue(containers[0].Path("cost").Data()))
+}
+
+func TestSelectHiddenEntityFields(t *testing.T) {
+	req := require.New(t)
+
+	var entities []*gabs.Container
+	for _, createdAt := range []string{"2022-03-01", "2022-01-01", "2022-02-01"} {
+		entity := gabs.New()
+		_, err := entity.Set(createdAt, "createdAt")
+		req.NoError(err)
+		entities = append(entities, entity)
+	}
+
+	tbl, header, err := selectColumns(newSortTestTable(), nil, []string{"createdAt"}, entities)
+	req.NoError(err)
+	sortBy, err := columnsSortBy(header, []string{"-createdAt"})
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.Equal("ID,Name,Cost\nc,beta,10\nb,alpha,10\na,alpha,9", tbl.RenderCSV())
+}
@@ -0,0 +1,112 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// RelativeTimesDescription describes the relative times filters may use, see util.ExpandFilterTimes
+const RelativeTimesDescription = "Filters may compare dates to relative times, which are turned into timestamps " +
+	"before the filter is sent to the controller: now(), now(-15m), today() for the start of the local day, today(-7d), " +
+	"or a bare offset such as -24h. For example: 'createdAt > now(-15m)'"
+
+// filterClauses are the clauses ending a filter, which select how matching entities are sorted and paged
+var filterClauses = []string{"sort by", "skip", "limit"}
+
+// CombineFilters combines a default filter with the filter given for a command, so that only entities matching both
+// are selected. The sort by, skip and limit clauses of the filter, which can't be nested, are kept at its end
+func CombineFilters(defaultFilter, filter string) string {
+	defaultPredicate, _ := SplitFilter(defaultFilter)
+	if defaultPredicate == "" {
+		return filter
+	}
+
+	predicate, clauses := SplitFilter(filter)
+	result := "(" + defaultPredicate + ")"
+	if predicate != "" {
+		result += " and (" + predicate + ")"
+	}
+	if clauses != "" {
+		result += " " + clauses
+	}
+	return result
+}
+
+// SplitFilter splits a filter into its predicate and its trailing sort by, skip and limit clauses
+func SplitFilter(filter string) (string, string) {
+	var quote rune
+	escaped := false
+	depth := 0
+	runes := []rune(filter)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case depth == 0 && (i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == ')'):
+			rest := strings.ToLower(string(runes[i:]))
+			for _, clause := range filterClauses {
+				if strings.HasPrefix(rest, clause) && (len(rest) == len(clause) || unicode.IsSpace(rune(rest[len(clause)]))) {
+					return strings.TrimSpace(string(runes[:i])), strings.TrimSpace(string(runes[i:]))
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(filter), ""
+}
+
+// QuoteFilterString returns the value as a filter string literal, escaping quotes, backslashes and whitespace control
+// characters, so values such as names and tokens can be compared against without changing the meaning of the filter.
+// Filters have no escape for other control characters, so those are dropped
+func QuoteFilterString(val string) string {
+	result := &strings.Builder{}
+	result.WriteByte('"')
+	for _, r := range val {
+		switch r {
+		case '"', '\\':
+			result.WriteByte('\\')
+			result.WriteRune(r)
+		case '\n':
+			result.WriteString(`\n`)
+		case '\r':
+			result.WriteString(`\r`)
+		case '\t':
+			result.WriteString(`\t`)
+		case '\f':
+			result.WriteString(`\f`)
+		default:
+			if !unicode.IsControl(r) {
+				result.WriteRune(r)
+			}
+		}
+	}
+	result.WriteByte('"')
+	return result.String()
+}
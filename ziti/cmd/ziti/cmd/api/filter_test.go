@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFilter(t *testing.T) {
+	req := require.New(t)
+
+	predicate, clauses := SplitFilter(`name contains "a" sort by name limit 10`)
+	req.Equal(`name contains "a"`, predicate)
+	req.Equal("sort by name limit 10", clauses)
+
+	predicate, clauses = SplitFilter(`name = "limit 5" and (tags.skip = "x")`)
+	req.Equal(`name = "limit 5" and (tags.skip = "x")`, predicate)
+	req.Equal("", clauses)
+
+	predicate, clauses = SplitFilter("LIMIT none")
+	req.Equal("", predicate)
+	req.Equal("LIMIT none", clauses)
+
+	predicate, clauses = SplitFilter("limited = true")
+	req.Equal("limited = true", predicate)
+	req.Equal("", clauses)
+}
+
+func TestCombineFilters(t *testing.T) {
+	req := require.New(t)
+	req.Equal(`name = "a"`, CombineFilters("", `name = "a"`))
+	req.Equal(`(tags.env != "test")`, CombineFilters(`tags.env != "test"`, ""))
+	req.Equal(`(tags.env != "test") limit none`, CombineFilters(`tags.env != "test"`, "limit none"))
+	req.Equal(`(tags.env != "test") and (name = "a" or name = "b") sort by name skip 5`,
+		CombineFilters(`tags.env != "test"`, `name = "a" or name = "b" sort by name skip 5`))
+}
+
+func TestQuoteFilterString(t *testing.T) {
+	req := require.New(t)
+	req.Equal(`"plain"`, QuoteFilterString("plain"))
+	req.Equal(`"say \"hi\" \\ bye"`, QuoteFilterString(`say "hi" \ bye`))
+	req.Equal(`"a\nb\tc"`, QuoteFilterString("a\nb\tc\x00"))
+
+	filter := `name = ` + QuoteFilterString(`x" or true limit 1`)
+	predicate, clauses := SplitFilter(filter)
+	req.Equal(filter, predicate)
+	req.Equal("", clauses)
+}
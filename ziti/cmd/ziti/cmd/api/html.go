@@ -0,0 +1,82 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+const htmlTableClass = "ziti-table"
+
+// htmlTableStyle is scoped to the table class, so the fragment can be embedded in a page without affecting its styles
+const htmlTableStyle = `<style>
+table.ziti-table { border-collapse: collapse; font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 13px; }
+table.ziti-table th, table.ziti-table td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+table.ziti-table thead th { background: #f0f3f6; cursor: pointer; user-select: none; white-space: nowrap; }
+table.ziti-table thead th[data-sort="asc"]::after { content: " \25B2"; }
+table.ziti-table thead th[data-sort="desc"]::after { content: " \25BC"; }
+table.ziti-table tbody tr:nth-child(even) { background: #f8f9fa; }
+</style>`
+
+// htmlTableScript makes the columns sortable by clicking their headers. Values are compared numerically if both are
+// numbers. Mail clients strip scripts, in which case the table is shown in its original order
+const htmlTableScript = `<script>
+(function () {
+  document.querySelectorAll("table.ziti-table:not([data-sortable])").forEach(function (table) {
+    table.setAttribute("data-sortable", "true");
+    var headers = table.querySelectorAll("thead th");
+    headers.forEach(function (th, col) {
+      th.addEventListener("click", function () {
+        var dir = th.getAttribute("data-sort") === "asc" ? "desc" : "asc";
+        headers.forEach(function (h) { h.removeAttribute("data-sort"); });
+        th.setAttribute("data-sort", dir);
+        var body = table.tBodies[0];
+        var rows = Array.prototype.slice.call(body.rows);
+        rows.sort(function (a, b) {
+          var x = a.cells[col] ? a.cells[col].textContent.trim() : "";
+          var y = b.cells[col] ? b.cells[col].textContent.trim() : "";
+          var nx = parseFloat(x), ny = parseFloat(y);
+          var result = (!isNaN(nx) && !isNaN(ny) && String(nx) === x && String(ny) === y) ? nx - ny : x.localeCompare(y);
+          return dir === "asc" ? result : -result;
+        });
+        rows.forEach(function (row) { body.appendChild(row); });
+      });
+    });
+  });
+})();
+</script>`
+
+// renderHTML renders the table as an HTML fragment with embedded styles and a script to sort it by column, which can
+// be pasted into wiki pages and email reports
+func renderHTML(t table.Writer) string {
+	t.Style().HTML = table.HTMLOptions{
+		CSSClass:    htmlTableClass,
+		EmptyColumn: "&nbsp;",
+		EscapeText:  true,
+		Newline:     "<br/>",
+	}
+
+	var result strings.Builder
+	result.WriteString(htmlTableStyle)
+	result.WriteString("\n")
+	result.WriteString(t.RenderHTML())
+	result.WriteString("\n")
+	result.WriteString(htmlTableScript)
+	return result.String()
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderHTML(t *testing.T) {
+	req := require.New(t)
+
+	tbl := newSortTestTable()
+	tbl.AppendRow([]interface{}{"d", "<script>", "1"})
+	html := renderHTML(tbl)
+
+	req.Contains(html, `<table class="ziti-table">`)
+	req.Contains(html, "<th>Name</th>")
+	req.Contains(html, "&lt;script&gt;")
+	req.Contains(html, "<style>")
+	req.Contains(html, "<script>")
+}
+
+func TestTableOutputFormat(t *testing.T) {
+	req := require.New(t)
+
+	format, err := (&Options{}).TableOutputFormat()
+	req.NoError(err)
+	req.Equal(OutputFormatTable, format)
+
+	format, err = (&Options{OutputCSV: true}).TableOutputFormat()
+	req.NoError(err)
+	req.Equal(OutputFormatCSV, format)
+
+	format, err = (&Options{OutputFormat: "html"}).TableOutputFormat()
+	req.NoError(err)
+	req.Equal(OutputFormatHTML, format)
+
+	_, err = (&Options{OutputCSV: true, OutputFormat: "html"}).TableOutputFormat()
+	req.Error(err)
+
+	_, err = (&Options{OutputFormat: "xml"}).TableOutputFormat()
+	req.Error(err)
+}
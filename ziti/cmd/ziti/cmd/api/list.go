@@ -21,6 +21,7 @@ import (
 	"github.com/Jeffail/gabs"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/openziti/foundation/v2/errorz"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/openziti/ziti/ziti/cmd/ziti/util"
 	"github.com/pkg/errors"
 	"io"
@@ -33,8 +34,16 @@ import (
 // ListEntitiesOfType queries the Ziti Controller for entities of the given type
 func ListEntitiesWithOptions(api util.API, entityType string, options *Options) ([]*gabs.Container, *Paging, error) {
 	params := url.Values{}
+	filter := ""
 	if len(options.Args) > 0 {
-		params.Add("filter", options.Args[0])
+		filter = options.Args[0]
+	}
+	filter, err := options.SortFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter != "" {
+		params.Add("filter", filter)
 	}
 
 	return ListEntitiesOfType(api, entityType, params, options.OutputJSONResponse, options.Out, options.Timeout, options.Verbose)
@@ -112,8 +121,11 @@ func MapNameToID(api util.API, entityType string, o *Options, idOrName string) (
 	if err != nil {
 		return "", err
 	}
+	if len(result) == 0 {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "found %v results for input %v when mapping %v to id", len(result), idOrName, entityType)
+	}
 	if len(result) != 1 {
-		return "", errors.Errorf("found %v results for input %v when mapping %v to id", len(result), idOrName, entityType)
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "found %v results for input %v when mapping %v to id", len(result), idOrName, entityType)
 	}
 	return result[0], nil
 }
@@ -137,7 +149,7 @@ func MapNamesToIDs(api util.API, entityType string, o *Options, list ...string)
 
 			if len(list) > 1 {
 				fmt.Printf("Found multiple %v matching %v. Please specify which you want by prefixing with id: or name:\n", entityType, val)
-				return nil, errors.Errorf("ambigous if %v is id or name", val)
+				return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "ambigous if %v is id or name", val)
 			}
 
 			for _, entity := range list {
@@ -153,10 +165,50 @@ func MapNamesToIDs(api util.API, entityType string, o *Options, list ...string)
 }
 
 func RenderTable(o *Options, t table.Writer, pagingInfo *Paging) {
-	if o.OutputCSV {
+	renderTable(o, t, nil, pagingInfo)
+}
+
+// renderTable renders the table as RenderTable does, first selecting the columns given by --columns. Columns to show
+// or sort by may be fields of the entities, if they're given in the order of the rows
+func renderTable(o *Options, t table.Writer, entities []*gabs.Container, pagingInfo *Paging) {
+	sortColumns, err := o.sortColumns()
+	cmdhelper.CheckErr(err)
+
+	header := tableHeader(t)
+	var hiddenFields []string
+	if entities != nil {
+		for _, col := range sortColumns {
+			if col = strings.TrimPrefix(strings.TrimSpace(col), "-"); columnNumber(header, col) == 0 {
+				hiddenFields = append(hiddenFields, col)
+			}
+		}
+	}
+
+	if len(o.Columns) > 0 || len(hiddenFields) > 0 {
+		t, header, err = selectColumns(t, o.Columns, hiddenFields, entities)
+		cmdhelper.CheckErr(err)
+	}
+	sortBy, err := columnsSortBy(header, sortColumns)
+	cmdhelper.CheckErr(err)
+	t.SortBy(sortBy)
+
+	format, err := o.TableOutputFormat()
+	cmdhelper.CheckErr(err)
+
+	if format == OutputFormatCSV {
 		if _, err := fmt.Fprintln(o.Cmd.OutOrStdout(), t.RenderCSV()); err != nil {
 			panic(err)
 		}
+	} else if format == OutputFormatHTML {
+		if _, err := fmt.Fprintln(o.Cmd.OutOrStdout(), renderHTML(t)); err != nil {
+			panic(err)
+		}
+	} else if format == OutputFormatYAML {
+		result, err := renderYAML(t)
+		cmdhelper.CheckErr(err)
+		if _, err := fmt.Fprintln(o.Cmd.OutOrStdout(), result); err != nil {
+			panic(err)
+		}
 	} else {
 		if _, err := fmt.Fprintln(o.Cmd.OutOrStdout(), t.Render()); err != nil {
 			panic(err)
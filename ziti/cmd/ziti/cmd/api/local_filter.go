@@ -0,0 +1,274 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/storage/ast"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+// FilterEntities applies a filter to entities on the client, for entity types whose list API ignores filters, such as
+// fabric links. The predicate, sort, skip and limit clauses of the filter are all applied, and the paging information
+// returned describes the matching entities. The fields which may be used are those found in the entities, with their
+// types taken from the values found
+func FilterEntities(filter string, entities []*gabs.Container) ([]*gabs.Container, *Paging, error) {
+	if strings.TrimSpace(filter) == "" || len(entities) == 0 {
+		return entities, &Paging{Limit: int64(len(entities)), Count: int64(len(entities))}, nil
+	}
+
+	symbols := newEntitySymbols(entities)
+	query, err := ast.Parse(symbols, filter)
+	if err != nil {
+		return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid filter '%v': %v", filter, err)
+	}
+
+	var result []*gabs.Container
+	for _, entity := range entities {
+		symbols.entity = entity
+		if query.EvalBool(symbols) {
+			result = append(result, entity)
+		}
+	}
+
+	if sortFields := query.GetSortFields(); len(sortFields) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, field := range sortFields {
+				cmp := compareEntityValues(symbols.types[field.Symbol()], result[i].Path(field.Symbol()).Data(), result[j].Path(field.Symbol()).Data())
+				if cmp != 0 {
+					return (cmp < 0) == field.IsAscending()
+				}
+			}
+			return false
+		})
+	}
+
+	paging := &Paging{Count: int64(len(result)), Limit: math.MaxInt64}
+	if skip := query.GetSkip(); skip != nil && *skip > 0 {
+		paging.Offset = *skip
+		if *skip >= int64(len(result)) {
+			result = nil
+		} else {
+			result = result[*skip:]
+		}
+	}
+	if limit := query.GetLimit(); limit != nil && *limit >= 0 {
+		paging.Limit = *limit
+		if *limit < int64(len(result)) {
+			result = result[:*limit]
+		}
+	}
+
+	return result, paging, nil
+}
+
+// OutputFilteredEntities writes entities filtered on the client as JSON, in the form the list APIs respond with. The
+// list response itself isn't output with -j, as it holds every entity and not just those matching the filter
+func OutputFilteredEntities(o *Options, entities []*gabs.Container, paging *Paging) error {
+	data := make([]interface{}, 0, len(entities))
+	for _, entity := range entities {
+		data = append(data, entity.Data())
+	}
+	limit := paging.Limit
+	if limit == math.MaxInt64 {
+		limit = paging.Count
+	}
+	body, err := json.MarshalIndent(map[string]interface{}{
+		"data": data,
+		"meta": map[string]interface{}{
+			"pagination": map[string]interface{}{"limit": limit, "offset": paging.Offset, "totalCount": paging.Count},
+		},
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	o.Println(string(body))
+	return nil
+}
+
+// entitySymbols evaluates filter symbols against the fields of an entity. Nested fields are given by path, such as
+// sourceRouter.name
+type entitySymbols struct {
+	types  map[string]ast.NodeType
+	entity *gabs.Container
+}
+
+func newEntitySymbols(entities []*gabs.Container) *entitySymbols {
+	types := map[string]ast.NodeType{}
+	integral := map[string]bool{}
+	for _, entity := range entities {
+		collectSymbolTypes("", entity.Data(), types, integral)
+	}
+	for name, isIntegral := range integral {
+		if !isIntegral {
+			types[name] = ast.NodeTypeFloat64
+		}
+	}
+	return &entitySymbols{types: types}
+}
+
+// collectSymbolTypes records the type of each field in the given value. Numbers are taken to be integers unless a
+// value with a fraction is found, and strings to be datetimes if they're in RFC3339 format
+func collectSymbolTypes(prefix string, value interface{}, types map[string]ast.NodeType, integral map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			collectSymbolTypes(name, child, types, integral)
+		}
+	case string:
+		if _, found := types[prefix]; !found {
+			if _, err := time.Parse(time.RFC3339, v); err == nil {
+				types[prefix] = ast.NodeTypeDatetime
+			} else {
+				types[prefix] = ast.NodeTypeString
+			}
+		}
+	case float64:
+		types[prefix] = ast.NodeTypeInt64
+		if isIntegral, found := integral[prefix]; !found || isIntegral {
+			integral[prefix] = v == math.Trunc(v)
+		}
+	case bool:
+		types[prefix] = ast.NodeTypeBool
+	case nil:
+		if _, found := types[prefix]; !found && prefix != "" {
+			types[prefix] = ast.NodeTypeString
+		}
+	}
+}
+
+func (self *entitySymbols) GetSymbolType(name string) (ast.NodeType, bool) {
+	nodeType, found := self.types[name]
+	return nodeType, found
+}
+
+func (self *entitySymbols) GetSetSymbolTypes(string) ast.SymbolTypes {
+	return nil
+}
+
+func (self *entitySymbols) IsSet(name string) (bool, bool) {
+	_, found := self.types[name]
+	return false, found
+}
+
+func (self *entitySymbols) EvalBool(name string) *bool {
+	if v, ok := self.entity.Path(name).Data().(bool); ok {
+		return &v
+	}
+	return nil
+}
+
+func (self *entitySymbols) EvalString(name string) *string {
+	if v, ok := self.entity.Path(name).Data().(string); ok {
+		return &v
+	}
+	return nil
+}
+
+func (self *entitySymbols) EvalInt64(name string) *int64 {
+	if v, ok := self.entity.Path(name).Data().(float64); ok {
+		result := int64(v)
+		return &result
+	}
+	return nil
+}
+
+func (self *entitySymbols) EvalFloat64(name string) *float64 {
+	if v, ok := self.entity.Path(name).Data().(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+func (self *entitySymbols) EvalDatetime(name string) *time.Time {
+	if v, ok := self.entity.Path(name).Data().(string); ok {
+		if result, err := time.Parse(time.RFC3339, v); err == nil {
+			return &result
+		}
+	}
+	return nil
+}
+
+func (self *entitySymbols) IsNil(name string) bool {
+	return self.entity.Path(name).Data() == nil
+}
+
+func (self *entitySymbols) OpenSetCursor(string) ast.SetCursor {
+	return nil
+}
+
+func (self *entitySymbols) OpenSetCursorForQuery(string, ast.Query) ast.SetCursor {
+	return nil
+}
+
+// compareEntityValues orders two values of a field, with missing values first
+func compareEntityValues(nodeType ast.NodeType, a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch nodeType {
+	case ast.NodeTypeInt64, ast.NodeTypeFloat64:
+		x, _ := a.(float64)
+		y, _ := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case ast.NodeTypeBool:
+		x, _ := a.(bool)
+		y, _ := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case ast.NodeTypeDatetime:
+		x, _ := time.Parse(time.RFC3339, entityFieldValue(a))
+		y, _ := time.Parse(time.RFC3339, entityFieldValue(b))
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(entityFieldValue(a), entityFieldValue(b))
+}
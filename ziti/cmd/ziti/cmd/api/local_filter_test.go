@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func testLinks(t *testing.T) []*gabs.Container {
+	parsed, err := gabs.ParseJSON([]byte(`[
+		{"id": "l1", "state": "Connected", "down": false, "cost": 12, "sourceLatency": 1500000.5, "sourceRouter": {"id": "r1", "name": "router-one"}, "destRouter": {"id": "r2", "name": "router-two"}},
+		{"id": "l2", "state": "Connected", "down": false, "cost": 3, "sourceLatency": 200, "sourceRouter": {"id": "r2", "name": "router-two"}, "destRouter": {"id": "r3", "name": "router-three"}},
+		{"id": "l3", "state": "Failed", "down": true, "cost": 7, "sourceLatency": null, "sourceRouter": {"id": "r1", "name": "router-one"}, "destRouter": {"id": "r3", "name": "router-three"}}
+	]`))
+	require.NoError(t, err)
+	children, err := parsed.Children()
+	require.NoError(t, err)
+	return children
+}
+
+func filteredIds(entities []*gabs.Container) []string {
+	var result []string
+	for _, entity := range entities {
+		result = append(result, GetJsonString(entity, "id"))
+	}
+	return result
+}
+
+func TestFilterEntities(t *testing.T) {
+	req := require.New(t)
+	links := testLinks(t)
+
+	result, paging, err := FilterEntities(`state = "Connected" and sourceRouter.name = "router-one"`, links)
+	req.NoError(err)
+	req.Equal([]string{"l1"}, filteredIds(result))
+	req.Equal(int64(1), paging.Count)
+
+	result, _, err = FilterEntities(`down = true or cost < 5`, links)
+	req.NoError(err)
+	req.Equal([]string{"l2", "l3"}, filteredIds(result))
+
+	result, _, err = FilterEntities(`sourceLatency > 1000`, links)
+	req.NoError(err)
+	req.Equal([]string{"l1"}, filteredIds(result))
+
+	result, _, err = FilterEntities(`sourceLatency = null`, links)
+	req.NoError(err)
+	req.Equal([]string{"l3"}, filteredIds(result))
+
+	result, paging, err = FilterEntities(`true sort by cost desc skip 1 limit 1`, links)
+	req.NoError(err)
+	req.Equal([]string{"l3"}, filteredIds(result))
+	req.Equal(int64(3), paging.Count)
+	req.Equal(int64(1), paging.Offset)
+	req.Equal(int64(1), paging.Limit)
+
+	result, _, err = FilterEntities("", links)
+	req.NoError(err)
+	req.Len(result, 3)
+}
+
+func TestFilterEntitiesInvalid(t *testing.T) {
+	req := require.New(t)
+
+	_, _, err := FilterEntities(`nosuchfield = "x"`, testLinks(t))
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
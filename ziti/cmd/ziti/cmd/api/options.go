@@ -19,23 +19,69 @@ package api
 import (
 	"fmt"
 	"github.com/Jeffail/gabs"
+	"github.com/openziti/foundation/v2/stringz"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/spf13/cobra"
 	"io"
+	"strings"
 )
 
+// Output formats for commands which render tables
+const (
+	OutputFormatTable = "table"
+	OutputFormatCSV   = "csv"
+	OutputFormatHTML  = "html"
+	OutputFormatYAML  = "yaml"
+)
+
+var OutputFormats = []string{OutputFormatTable, OutputFormatCSV, OutputFormatHTML, OutputFormatYAML}
+
 // Options are common options for edge controller commands
 type Options struct {
 	common.CommonOptions
 	OutputJSONRequest  bool
 	OutputJSONResponse bool
 	OutputCSV          bool
+	OutputFormat       string
+	SortBy             []string
+	Sort               string
+	Columns            []string
+	ShowNotes          bool
+	NoDefaultFilter    bool
+}
+
+// TableOutputFormat returns the format in which tables should be rendered. --csv is kept as a shorthand for --output csv
+func (options *Options) TableOutputFormat() (string, error) {
+	if options.OutputCSV {
+		if options.OutputFormat != "" && options.OutputFormat != OutputFormatCSV {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--csv can't be combined with --output %v", options.OutputFormat)
+		}
+		return OutputFormatCSV, nil
+	}
+	if options.OutputFormat == "" {
+		return OutputFormatTable, nil
+	}
+	if !stringz.Contains(OutputFormats, options.OutputFormat) {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid output format '%v', must be one of %v", options.OutputFormat, strings.Join(OutputFormats, ", "))
+	}
+	return options.OutputFormat, nil
 }
 
 func (options *Options) OutputResponseJson() bool {
 	return options.OutputJSONResponse
 }
 
+// QuietClientOpts are client options for commands which output their own JSON with -j, so the raw responses of the
+// requests they make aren't output as well
+type QuietClientOpts struct {
+	*Options
+}
+
+func (self QuietClientOpts) OutputResponseJson() bool {
+	return false
+}
+
 func (options *Options) OutputRequestJson() bool {
 	return options.OutputJSONRequest
 }
@@ -54,16 +100,43 @@ func (options *Options) AddCommonFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&options.OutputJSONRequest, "output-request-json", false, "Output the full JSON request to the Ziti Edge Controller")
 	cmd.Flags().IntVarP(&options.Timeout, "timeout", "", 5, "Timeout for REST operations (specified in seconds)")
 	cmd.Flags().BoolVarP(&options.Verbose, "verbose", "", false, "Enable verbose logging")
+	cmd.Flags().DurationVar(&common.CacheTTL, "cache", 0, "Serve read results from a local cache if fetched within the given duration (ex: 30s)")
+	cmd.Flags().BoolVar(&common.NoCache, "no-cache", false, "Bypass the local response cache")
+	cmd.Flags().IntVar(&common.MaxIdleConns, "max-idle-conns", common.MaxIdleConns, "Maximum number of idle connections to keep open to the controller, for reuse by later requests")
+	cmd.Flags().DurationVar(&common.IdleConnTimeout, "idle-conn-timeout", common.IdleConnTimeout, "How long to keep idle connections to the controller open for")
+	cmd.Flags().IntVar(&common.TLSSessionCacheSize, "tls-session-cache", common.TLSSessionCacheSize, "Number of TLS sessions to cache for resuming connections to the controller, 0 disables the cache")
+	cmd.Flags().BoolVar(&common.ClientStats, "client-stats", false, "Output a summary of the requests made and connections used to stderr on exit, to diagnose throughput")
+}
+
+// AddTableOutputFlags adds the flags which control how commands rendering a table format, sort and select the columns
+// of their output
+func (options *Options) AddTableOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	cmd.Flags().StringVar(&options.OutputFormat, "output", "", "Output format, one of "+strings.Join(OutputFormats, ", ")+". html outputs a styled, sortable table to embed in wiki pages and reports. yaml outputs a list with a map of column values per row")
+	cmd.Flags().StringSliceVar(&options.SortBy, "sort-by", nil, SortByDescription)
+	cmd.Flags().StringVar(&options.Sort, "sort", "", SortDescription)
+	cmd.Flags().StringSliceVar(&options.Columns, "columns", nil, ColumnsDescription)
+}
+
+// AddDefaultFilterFlag adds the flag skipping the default filter of the selected login, for commands selecting entities
+// with a filter
+func (options *Options) AddDefaultFilterFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&options.NoDefaultFilter, "no-default-filter", false, "Don't apply the default filter configured for the entity type with 'ziti edge default-filter'")
 }
 
 func (options *Options) LogCreateResult(entityType string, result *gabs.Container, err error) error {
+	return options.LogCreateResultForName(entityType, options.Args[0], result, err)
+}
+
+// LogCreateResultForName works like LogCreateResult, for commands which create more than one entity
+func (options *Options) LogCreateResultForName(entityType string, name string, result *gabs.Container, err error) error {
 	if err != nil {
 		return err
 	}
 
 	if !options.OutputJSONResponse {
 		id := result.S("data", "id").Data()
-		_, err = fmt.Fprintf(options.Out, "New %v %v created with id: %v\n", entityType, options.Args[0], id)
+		_, err = fmt.Fprintf(options.Out, "New %v %v created with id: %v\n", entityType, name, id)
 		return err
 	}
 	return nil
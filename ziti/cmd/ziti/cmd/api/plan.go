@@ -0,0 +1,122 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+)
+
+// Plan is a composite operation made up of steps which are run in order. If a step fails, the steps which completed
+// before it are undone in reverse order, so a failed operation doesn't leave half created state behind. Plans suit
+// operations which create or change entities. A deleted entity can't be restored under its id, so deletes should be
+// the last steps of a plan, after everything which may fail
+type Plan struct {
+	options *Options
+	steps   []*planStep
+}
+
+type planStep struct {
+	description string
+	do          func() error
+	undo        func() error
+	done        bool
+}
+
+// PlanEntity is an entity created by a plan step. Its Id is set once the step has run, so later steps can refer to it
+type PlanEntity struct {
+	Id string
+}
+
+// NewPlan returns an empty plan, which reports rollbacks through the given options
+func NewPlan(options *Options) *Plan {
+	return &Plan{options: options}
+}
+
+// Add adds a step to the plan. undo reverts the step once it has completed, and may be nil if there's nothing to undo
+func (self *Plan) Add(description string, do func() error, undo func() error) {
+	self.steps = append(self.steps, &planStep{
+		description: description,
+		do:          do,
+		undo:        undo,
+	})
+}
+
+// CreateEntity adds a step creating an entity from the body returned by the body function, which is called when the
+// step runs. The entity is deleted again if a later step fails
+func (self *Plan) CreateEntity(api util.API, entityType, description string, body func() *gabs.Container) *PlanEntity {
+	entity := &PlanEntity{}
+	self.Add(description, func() error {
+		o := self.options
+		result, err := util.ControllerCreate(api, entityType, body().String(), o.Out, o.OutputJSONRequest, o.OutputJSONResponse, o.Timeout, o.Verbose)
+		if err != nil {
+			return err
+		}
+		entity.Id, _ = result.S("data", "id").Data().(string)
+		return nil
+	}, func() error {
+		o := self.options
+		return util.ControllerDelete(api, entityType, entity.Id, "", o.Out, false, false, o.Timeout, o.Verbose)
+	})
+	return entity
+}
+
+// Execute runs the steps of the plan. If one fails, the completed steps are rolled back and the step's error is
+// returned. If the rollback fails as well, an error with ExitCodePartialFailure listing what was left behind is returned
+func (self *Plan) Execute() error {
+	for idx, step := range self.steps {
+		if err := step.do(); err != nil {
+			stepErr := errors.Wrapf(err, "unable to %v", step.description)
+			return self.rollback(idx, stepErr)
+		}
+		step.done = true
+	}
+	return nil
+}
+
+func (self *Plan) rollback(failedIdx int, stepErr error) error {
+	var leftOver []string
+	rolledBack := 0
+	for idx := failedIdx - 1; idx >= 0; idx-- {
+		step := self.steps[idx]
+		if !step.done || step.undo == nil {
+			continue
+		}
+		if err := step.undo(); err != nil {
+			self.options.Printf("rollback: unable to undo '%v': %v\n", step.description, err)
+			leftOver = append(leftOver, step.description)
+			continue
+		}
+		step.done = false
+		rolledBack++
+		self.options.Printf("rollback: undid '%v'\n", step.description)
+	}
+
+	if len(leftOver) > 0 {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodePartialFailure,
+			fmt.Errorf("%v, and rolling back failed, so these steps remain applied: %v", stepErr, strings.Join(leftOver, ", ")))
+	}
+	if rolledBack > 0 {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeForError(stepErr), fmt.Errorf("%v, %v completed steps were rolled back", stepErr, rolledBack))
+	}
+	return stepErr
+}
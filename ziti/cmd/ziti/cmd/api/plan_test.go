@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRollsBackCompletedSteps(t *testing.T) {
+	req := require.New(t)
+
+	out := &bytes.Buffer{}
+	plan := NewPlan(&Options{CommonOptions: common.CommonOptions{Out: out}})
+
+	var log []string
+	step := func(name string, fail bool) {
+		plan.Add("create "+name, func() error {
+			if fail {
+				return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v is invalid", name)
+			}
+			log = append(log, "do "+name)
+			return nil
+		}, func() error {
+			log = append(log, "undo "+name)
+			return nil
+		})
+	}
+	step("service", false)
+	step("terminator 1", false)
+	step("terminator 2", true)
+	step("terminator 3", false)
+
+	err := plan.Execute()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "unable to create terminator 2")
+	req.Contains(err.Error(), "2 completed steps were rolled back")
+	req.Equal([]string{"do service", "do terminator 1", "undo terminator 1", "undo service"}, log)
+	req.Contains(out.String(), "rollback: undid 'create service'")
+}
+
+func TestPlanReportsFailedRollback(t *testing.T) {
+	req := require.New(t)
+
+	plan := NewPlan(&Options{CommonOptions: common.CommonOptions{Out: &bytes.Buffer{}}})
+	plan.Add("create service", func() error { return nil }, func() error { return errors.New("controller unavailable") })
+	plan.Add("update router", func() error { return nil }, nil)
+	plan.Add("create terminator", func() error { return errors.New("router not found") }, nil)
+
+	err := plan.Execute()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "these steps remain applied: create service")
+}
+
+func TestPlanSucceeds(t *testing.T) {
+	req := require.New(t)
+
+	plan := NewPlan(&Options{})
+	count := 0
+	for i := 0; i < 3; i++ {
+		plan.Add("step", func() error { count++; return nil }, func() error { count--; return nil })
+	}
+	req.NoError(plan.Execute())
+	req.Equal(3, count)
+}
@@ -0,0 +1,186 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+const SortByDescription = "Sort rows by the given columns, given by header name or number and prefixed with - to sort descending. " +
+	"Remaining ties are broken by the other columns from left to right, and rows are sorted by the first column when no " +
+	"columns are given. Only the listed rows are sorted, use --sort to sort across pages"
+
+const SortDescription = "Sort by the given fields, each followed by asc or desc, such as 'name asc' or 'createdAt desc, name'. " +
+	"The controller sorts the entities where it supports sorting, so pages are sorted across all entities, " +
+	"and the listed rows are sorted once fetched otherwise"
+
+var sortFieldRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// sortKey is a field to sort by, given with --sort
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+// parseSort parses the fields given with --sort, such as "createdAt desc, name"
+func parseSort(sort string) ([]sortKey, error) {
+	var result []sortKey
+	for _, val := range strings.Split(sort, ",") {
+		words := strings.Fields(val)
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) > 2 || !sortFieldRegex.MatchString(words[0]) {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid sort '%v', must be a field followed by asc or desc", strings.TrimSpace(val))
+		}
+		key := sortKey{field: words[0]}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				key.descending = true
+			default:
+				return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid sort direction '%v' for %v, must be asc or desc", words[1], words[0])
+			}
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// SortFilter adds a sort by clause for the fields given with --sort to the filter, so the controller sorts the entities
+// before paging them. A filter which already has a sort by clause is returned as is
+func (options *Options) SortFilter(filter string) (string, error) {
+	keys, err := parseSort(options.Sort)
+	if err != nil || len(keys) == 0 {
+		return filter, err
+	}
+
+	predicate, clauses := SplitFilter(filter)
+	if strings.HasPrefix(strings.ToLower(clauses), "sort by") {
+		return filter, nil
+	}
+
+	var sortBy []string
+	for _, key := range keys {
+		if key.descending {
+			sortBy = append(sortBy, key.field+" desc")
+		} else {
+			sortBy = append(sortBy, key.field+" asc")
+		}
+	}
+
+	result := "sort by " + strings.Join(sortBy, ", ")
+	if predicate != "" {
+		result = predicate + " " + result
+	}
+	if clauses != "" {
+		result += " " + clauses
+	}
+	return result, nil
+}
+
+// sortColumns returns the columns to sort the rendered rows by: the fields given with --sort, followed by the columns
+// given with --sort-by
+func (options *Options) sortColumns() ([]string, error) {
+	keys, err := parseSort(options.Sort)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, key := range keys {
+		if key.descending {
+			result = append(result, "-"+key.field)
+		} else {
+			result = append(result, key.field)
+		}
+	}
+	return append(result, options.SortBy...), nil
+}
+
+// tableSortBy returns the sort order for the table: the columns given by sortBy, followed by every column from left to
+// right, so the output doesn't depend on the order the controller returned results in. Without columns given, rows are
+// sorted by the first column. Each column is compared numerically if both values are numbers and alphabetically
+// otherwise
+func tableSortBy(t table.Writer, sortBy []string) ([]table.SortBy, error) {
+	return columnsSortBy(tableHeader(t), sortBy)
+}
+
+// columnsSortBy works like tableSortBy, for a table with the given columns
+func columnsSortBy(header []string, sortBy []string) ([]table.SortBy, error) {
+	var result []table.SortBy
+	addColumn := func(number int, descending bool) {
+		if descending {
+			result = append(result, table.SortBy{Number: number, Mode: table.DscNumeric}, table.SortBy{Number: number, Mode: table.Dsc})
+		} else {
+			result = append(result, table.SortBy{Number: number, Mode: table.AscNumeric}, table.SortBy{Number: number, Mode: table.Asc})
+		}
+	}
+
+	for _, col := range sortBy {
+		col = strings.TrimSpace(col)
+		descending := strings.HasPrefix(col, "-")
+		col = strings.TrimPrefix(col, "-")
+
+		number := columnNumber(header, col)
+		if number == 0 {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid sort column '%v', must be one of %v", col, strings.Join(header, ", "))
+		}
+		addColumn(number, descending)
+	}
+
+	for number := 1; number <= len(header); number++ {
+		addColumn(number, false)
+	}
+
+	return result, nil
+}
+
+// columnNumber returns the 1 based number of the column with the given name or number, or 0 if there's no such column
+func columnNumber(header []string, col string) int {
+	if number, err := strconv.Atoi(col); err == nil {
+		if number > 0 && number <= len(header) {
+			return number
+		}
+		return 0
+	}
+
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(s))
+	}
+	for idx, name := range header {
+		if normalize(name) == normalize(col) {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// tableHeader returns the column names of the table. table.Writer doesn't expose its header, so it's read back from
+// the CSV rendering, which holds the header on the first line
+func tableHeader(t table.Writer) []string {
+	records := tableRecords(t)
+	if len(records) == 0 {
+		return nil
+	}
+	return records[0]
+}
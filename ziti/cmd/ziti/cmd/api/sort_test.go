@@ -0,0 +1,87 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/stretchr/testify/require"
+)
+
+func newSortTestTable() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"ID", "Name", "Cost"})
+	t.AppendRow(table.Row{"c", "beta", 10})
+	t.AppendRow(table.Row{"a", "alpha", 9})
+	t.AppendRow(table.Row{"b", "alpha", 10})
+	return t
+}
+
+func TestTableSortByDefault(t *testing.T) {
+	req := require.New(t)
+
+	tbl := newSortTestTable()
+	sortBy, err := tableSortBy(tbl, nil)
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+
+	req.Equal("ID,Name,Cost\na,alpha,9\nb,alpha,10\nc,beta,10", tbl.RenderCSV())
+
+	tbl = table.NewWriter()
+	tbl.AppendHeader(table.Row{"Name", "Cost"})
+	tbl.AppendRow(table.Row{"beta", 10})
+	tbl.AppendRow(table.Row{"alpha", 10})
+	tbl.AppendRow(table.Row{"alpha", 9})
+	sortBy, err = tableSortBy(tbl, nil)
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.Equal("Name,Cost\nalpha,9\nalpha,10\nbeta,10", tbl.RenderCSV(), "ties are broken by the other columns")
+}
+
+func TestTableSortByColumns(t *testing.T) {
+	req := require.New(t)
+
+	tbl := newSortTestTable()
+	sortBy, err := tableSortBy(tbl, []string{"-cost", "name"})
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.Equal("ID,Name,Cost\nb,alpha,10\nc,beta,10\na,alpha,9", tbl.RenderCSV())
+
+	tbl = newSortTestTable()
+	sortBy, err = tableSortBy(tbl, []string{"2"})
+	req.NoError(err)
+	tbl.SortBy(sortBy)
+	req.True(strings.HasPrefix(tbl.RenderCSV(), "ID,Name,Cost\na,alpha,9\nb,alpha,10"))
+
+	_, err = tableSortBy(newSortTestTable(), []string{"missing"})
+	req.Error(err)
+	_, err = tableSortBy(newSortTestTable(), []string{"4"})
+	req.Error(err)
+}
+
+func TestSortFilter(t *testing.T) {
+	req := require.New(t)
+
+	o := &Options{Sort: "createdAt desc, name"}
+	filter, err := o.SortFilter(`name contains "a" limit 5`)
+	req.NoError(err)
+	req.Equal(`name contains "a" sort by createdAt desc, name asc limit 5`, filter)
+
+	filter, err = o.SortFilter("")
+	req.NoError(err)
+	req.Equal("sort by createdAt desc, name asc", filter)
+
+	filter, err = o.SortFilter("true sort by id")
+	req.NoError(err)
+	req.Equal("true sort by id", filter)
+
+	columns, err := o.sortColumns()
+	req.NoError(err)
+	req.Equal([]string{"-createdAt", "name"}, columns)
+
+	for _, sort := range []string{"name up", "name asc desc", "1name"} {
+		o.Sort = sort
+		_, err = o.SortFilter("")
+		req.Error(err)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"gopkg.in/yaml.v2"
+)
+
+// renderYAML renders the rows of the table as a YAML list, with a map per row keyed by the column names in camel case.
+// Cells holding several lines, such as role attributes, become lists
+func renderYAML(t table.Writer) (string, error) {
+	records := tableRecords(t)
+	if len(records) == 0 {
+		return "", nil
+	}
+
+	var keys []string
+	for _, name := range records[0] {
+		keys = append(keys, yamlKey(name))
+	}
+
+	rows := []yaml.MapSlice{}
+	for _, record := range records[1:] {
+		row := yaml.MapSlice{}
+		for idx, key := range keys {
+			var value interface{} = ""
+			if idx < len(record) {
+				value = record[idx]
+				if strings.Contains(record[idx], "\n") {
+					value = strings.Split(record[idx], "\n")
+				}
+			}
+			row = append(row, yaml.MapItem{Key: key, Value: value})
+		}
+		rows = append(rows, row)
+	}
+
+	data, err := yaml.Marshal(rows)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// yamlKey turns a column name, such as "Role Attributes", into a camel case key, such as roleAttributes
+func yamlKey(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var result strings.Builder
+	for idx, word := range words {
+		word = strings.ToLower(word)
+		if idx > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		result.WriteString(word)
+	}
+	if result.Len() == 0 {
+		return name
+	}
+	return result.String()
+}
+
+// tableRecords returns the header and rows of the table. table.Writer doesn't expose its rows, so they're read back
+// from the CSV rendering. go-pretty escapes quotes and commas within quoted values with a backslash, rather than
+// doubling quotes, so encoding/csv can't read it reliably
+func tableRecords(t table.Writer) [][]string {
+	csv := t.RenderCSV()
+	if csv == "" {
+		return nil
+	}
+
+	var records [][]string
+	var record []string
+	for i := 0; ; i++ {
+		var value strings.Builder
+		if i < len(csv) && csv[i] == '"' {
+			for i++; i < len(csv); i++ {
+				if csv[i] == '\\' && i+1 < len(csv) && (csv[i+1] == '"' || csv[i+1] == ',') {
+					i++
+				} else if csv[i] == '"' {
+					i++
+					break
+				}
+				value.WriteByte(csv[i])
+			}
+		} else {
+			for ; i < len(csv) && csv[i] != ',' && csv[i] != '\n'; i++ {
+				value.WriteByte(csv[i])
+			}
+		}
+		record = append(record, value.String())
+
+		if i >= len(csv) {
+			return append(records, record)
+		}
+		if csv[i] == '\n' {
+			records = append(records, record)
+			record = nil
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRenderYAML(t *testing.T) {
+	req := require.New(t)
+
+	tbl := table.NewWriter()
+	tbl.AppendHeader(table.Row{"ID", "Name", "Role Attributes", "Is Online"})
+	tbl.AppendRow(table.Row{"a1", `say "hi", there`, "admins\nusers", true})
+	tbl.AppendRow(table.Row{"b2", `back\slash`, "", false})
+
+	result, err := renderYAML(tbl)
+	req.NoError(err)
+
+	var rows []map[string]interface{}
+	req.NoError(yaml.Unmarshal([]byte(result), &rows))
+	req.Equal([]map[string]interface{}{
+		{"id": "a1", "name": `say "hi", there`, "roleAttributes": []interface{}{"admins", "users"}, "isOnline": "true"},
+		{"id": "b2", "name": `back\slash`, "roleAttributes": "", "isOnline": "false"},
+	}, rows)
+	req.Regexp(`^- id: a1\n  name:`, result)
+}
+
+func TestRenderYAMLWithoutRows(t *testing.T) {
+	req := require.New(t)
+
+	tbl := table.NewWriter()
+	tbl.AppendHeader(table.Row{"ID", "Name"})
+
+	result, err := renderYAML(tbl)
+	req.NoError(err)
+	req.Equal("[]", result)
+}
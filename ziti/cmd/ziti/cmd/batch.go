@@ -0,0 +1,404 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// BatchOptions are the flags for the batch command
+type BatchOptions struct {
+	CommonOptions
+	In          io.Reader
+	StopOnError bool
+	Bulk        api.BulkOptions
+}
+
+// batchOperation is a single command to run, given either as a command line or as an argument list
+type batchOperation struct {
+	Id      string   `json:"id,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// batchResult is emitted as a JSON line for every operation run
+type batchResult struct {
+	Index      int             `json:"index"`
+	Id         string          `json:"id,omitempty"`
+	Args       []string        `json:"args"`
+	Success    bool            `json:"success"`
+	ExitCode   int             `json:"exitCode"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	Stderr     string          `json:"stderr,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"durationMs"`
+}
+
+// batchFatal carries a fatal error raised through cmdhelper.CheckErr, so it ends the operation instead of the process
+type batchFatal struct {
+	msg  string
+	code int
+}
+
+// NewCmdBatch creates the batch command
+func NewCmdBatch(in io.Reader, out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &BatchOptions{
+		CommonOptions: CommonOptions{
+			Out: out,
+			Err: errOut,
+		},
+		In: in,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "batch <file|->",
+		Short: "Runs a stream of ziti commands in one process",
+		Long: `Runs ziti commands read from a file, or from stdin if the file is -, within one process using the current
+CLI login. Input is either one command per line, with blank lines and lines starting with # skipped, or a JSON
+array of operations. An operation is a command line string, an array of arguments, or an object with an
+optional id and either a "command" string or an "args" array. The leading 'ziti' of a command is optional.
+
+For every operation a JSON line is written with its arguments, exit code and output. Operations are identified in
+failure reports by their id or, if they have none, by their index in the input. Output which is valid JSON,
+e.g. from commands run with --output-json, is included as "result", other output as "output". Commands which
+change the login, and nested batches, aren't allowed.`,
+		Example: `  ziti batch - <<EOF
+  edge create identity device laptop -o laptop.jwt
+  edge update identity laptop --role-attributes sales
+  edge list identities 'name="laptop"' -j
+  EOF`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options.Cmd = cmd
+			options.Args = args
+			return options.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.StopOnError, "stop-on-error", false, "Stop at the first operation which fails. Same as --fail-fast")
+	options.Bulk.AddBulkFlags(cmd, true)
+
+	return cmd
+}
+
+// Run implements the batch command
+func (o *BatchOptions) Run() error {
+	in := o.In
+	if o.Args[0] != "-" {
+		f, err := os.Open(o.Args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	// load the login once up front, so every operation shares it. Operations which don't need a login, e.g. pki
+	// commands, still work without one, so a missing login is left for the operations which need it to report
+	_, _ = util.LoadSelectedIdentity()
+
+	o.Bulk.FailFast = o.Bulk.FailFast || o.StopOnError
+	run, err := o.Bulk.StartBulk("run batch operations")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(o.Out)
+	index := 0
+
+	err = readBatchOperations(in, func(op *batchOperation) error {
+		idx := index
+		index++
+		key := op.Id
+		if key == "" {
+			key = strconv.Itoa(idx)
+		}
+		if !run.Include(key) {
+			return nil
+		}
+		name := op.Command
+		if name == "" {
+			name = strings.Join(op.Args, " ")
+		}
+		if run.Stopped() {
+			run.Skipped(key, name)
+			return nil
+		}
+
+		result := o.runOperation(idx, op)
+		if result.Success {
+			run.Succeeded()
+		} else {
+			run.Failed(key, name, cmdhelper.Errorf(result.ExitCode, "%v", result.Error))
+		}
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		return err
+	}
+
+	return run.Finish()
+}
+
+// readBatchOperations calls f for each operation in the input. Line based input is processed as it's read, so
+// commands can be streamed in
+func readBatchOperations(in io.Reader, f func(op *batchOperation) error) error {
+	reader := bufio.NewReader(in)
+
+	for {
+		r, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(r) {
+			if err = reader.UnreadRune(); err != nil {
+				return err
+			}
+			if r == '[' {
+				return readBatchJson(reader, f)
+			}
+			break
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := f(&batchOperation{Command: line}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readBatchJson(in io.Reader, f func(op *batchOperation) error) error {
+	var values []json.RawMessage
+	if err := json.NewDecoder(in).Decode(&values); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, errors.Wrap(err, "invalid JSON batch"))
+	}
+
+	for idx, value := range values {
+		op := &batchOperation{}
+		var err error
+		switch strings.TrimSpace(string(value))[0] {
+		case '"':
+			err = json.Unmarshal(value, &op.Command)
+		case '[':
+			err = json.Unmarshal(value, &op.Args)
+		default:
+			err = json.Unmarshal(value, op)
+		}
+		if err == nil && op.Command == "" && len(op.Args) == 0 {
+			err = errors.New("no command or args given")
+		}
+		if err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid operation %v in JSON batch: %v", idx, err)
+		}
+		if err = f(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOperation runs a single operation with a fresh command tree, capturing its output
+func (o *BatchOptions) runOperation(index int, op *batchOperation) *batchResult {
+	start := time.Now()
+	result := &batchResult{Index: index, Id: op.Id, Args: op.Args}
+
+	var stdout, direct, stderr bytes.Buffer
+	err := func() (err error) {
+		if op.Command != "" {
+			if result.Args, err = splitCommandLine(op.Command); err != nil {
+				return err
+			}
+		}
+		if len(result.Args) > 0 && result.Args[0] == "ziti" {
+			result.Args = result.Args[1:]
+		}
+		if err = validateBatchArgs(result.Args); err != nil {
+			return err
+		}
+
+		cmdhelper.BehaviorOnFatal(func(msg string, code int) {
+			panic(&batchFatal{msg: msg, code: code})
+		})
+		defer cmdhelper.DefaultBehaviorOnFatal()
+		defer func() {
+			if r := recover(); r != nil {
+				fatal, ok := r.(*batchFatal)
+				if !ok {
+					panic(r)
+				}
+				err = cmdhelper.WithExitCode(fatal.code, errors.New(strings.TrimSpace(fatal.msg)))
+			}
+		}()
+
+		// some commands print straight to stdout, which would corrupt the JSON lines, so it's captured as well
+		restoreStdout, err := captureStdout(&direct)
+		if err != nil {
+			return err
+		}
+		defer restoreStdout()
+
+		root := NewRootCommand(o.In, &stdout, &stderr)
+		root.SetArgs(result.Args)
+		root.SetOut(&stdout)
+		root.SetErr(&stderr)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+		_, err = root.ExecuteC()
+		return err
+	}()
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.Success = err == nil
+	result.ExitCode = cmdhelper.ExitCodeForError(err)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	output := bytes.TrimSpace(append(direct.Bytes(), stdout.Bytes()...))
+	if len(output) > 0 && json.Valid(output) {
+		result.Result = output
+	} else {
+		result.Output = string(output)
+	}
+	result.Stderr = strings.TrimSpace(stderr.String())
+
+	return result
+}
+
+// captureStdout redirects os.Stdout into buf until the returned function is called
+func captureStdout(buf *bytes.Buffer) (func(), error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	original := os.Stdout
+	os.Stdout = w
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(buf, r)
+		close(done)
+	}()
+
+	return func() {
+		os.Stdout = original
+		_ = w.Close()
+		<-done
+		_ = r.Close()
+	}, nil
+}
+
+// validateBatchArgs rejects commands which can't run inside a batch
+func validateBatchArgs(args []string) error {
+	if len(args) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "empty command")
+	}
+
+	var path []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		path = append(path, arg)
+	}
+	command := strings.Join(path, " ")
+
+	for _, disallowed := range []string{"batch", "edge login", "edge logout"} {
+		if command == disallowed || strings.HasPrefix(command, disallowed+" ") {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "'ziti %v' can't be run in a batch", disallowed)
+		}
+	}
+	return nil
+}
+
+// splitCommandLine splits a command line into arguments the way a shell would for simple cases: on whitespace, with
+// single quotes, double quotes and backslash escapes
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "trailing backslash in command: %v", line)
+	}
+	if quote != 0 {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "unterminated %c quote in command: %v", quote, line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	req := require.New(t)
+
+	args, err := splitCommandLine(`edge list identities 'name contains "lap"' --role-attributes a\ b "c d"`)
+	req.NoError(err)
+	req.Equal([]string{"edge", "list", "identities", `name contains "lap"`, "--role-attributes", "a b", "c d"}, args)
+
+	args, err = splitCommandLine(`edge create identity device '' -o x.jwt`)
+	req.NoError(err)
+	req.Equal([]string{"edge", "create", "identity", "device", "", "-o", "x.jwt"}, args)
+
+	_, err = splitCommandLine(`edge list identities 'name = "x"`)
+	req.Error(err)
+
+	_, err = splitCommandLine(`edge list \`)
+	req.Error(err)
+}
+
+func TestReadBatchOperations(t *testing.T) {
+	req := require.New(t)
+
+	read := func(input string) ([]*batchOperation, error) {
+		var result []*batchOperation
+		err := readBatchOperations(strings.NewReader(input), func(op *batchOperation) error {
+			result = append(result, op)
+			return nil
+		})
+		return result, err
+	}
+
+	ops, err := read("\n# comment\nedge list services\n\n  fabric list routers  \n")
+	req.NoError(err)
+	req.Equal([]*batchOperation{{Command: "edge list services"}, {Command: "fabric list routers"}}, ops)
+
+	ops, err = read(`  ["edge list services", ["fabric", "list", "routers"], {"id": "a", "args": ["edge", "list", "configs"]}]`)
+	req.NoError(err)
+	req.Equal([]*batchOperation{
+		{Command: "edge list services"},
+		{Args: []string{"fabric", "list", "routers"}},
+		{Id: "a", Args: []string{"edge", "list", "configs"}},
+	}, ops)
+
+	_, err = read(`[{"id": "a"}]`)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+
+	ops, err = read("")
+	req.NoError(err)
+	req.Empty(ops)
+}
+
+func TestValidateBatchArgs(t *testing.T) {
+	req := require.New(t)
+
+	req.NoError(validateBatchArgs([]string{"edge", "list", "services"}))
+	req.NoError(validateBatchArgs([]string{"edge", "login-info"}))
+	req.Error(validateBatchArgs(nil))
+	req.Error(validateBatchArgs([]string{"batch", "-"}))
+	req.Error(validateBatchArgs([]string{"edge", "login", "localhost:1280", "-u", "admin"}))
+}
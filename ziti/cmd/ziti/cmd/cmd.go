@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -28,6 +29,8 @@ import (
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/database"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/demo"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/fabric"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/ops"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/tutorial"
 
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/edge"
@@ -63,22 +66,44 @@ var rootCommand = RootCmd{
 		Short: "ziti is a CLI for working with Ziti",
 		Long: `
 'ziti' is a CLI for working with a Ziti deployment.
+
+Exit codes:
+  0  success
+  1  general failure
+  2  invalid command line usage
+  3  authentication or authorization failure
+  4  entity not found
+  5  validation failure
+  6  unable to connect to the controller or other endpoint
+  7  partial failure of a bulk operation
+  8  cancelled when asked for confirmation
 `},
 }
 
 // exitWithError will terminate execution with an error result
-// It prints the error to stderr and exits with a non-zero exit code
+// It prints the error to stderr and exits with the exit code matching the class of error
 func exitWithError(err error) {
 	fmt.Fprintf(os.Stderr, "\n%v\n", err)
-	os.Exit(1)
+	cmdhelper.RunExitHooks()
+	os.Exit(cmdhelper.ExitCodeForError(err))
 }
 
 // Execute is ...
 func Execute() {
 	goflag.CommandLine.Parse([]string{})
+	if found, err := dispatchPlugin(rootCommand.cobraCommand, os.Args[1:], os.Stdout, os.Stderr); found {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
 	if err := rootCommand.cobraCommand.Execute(); err != nil {
 		exitWithError(err)
 	}
+	cmdhelper.RunExitHooks()
 }
 
 func init() {
@@ -87,6 +112,10 @@ func init() {
 }
 
 func NewCmdRoot(in io.Reader, out, err io.Writer, cmd *cobra.Command) *cobra.Command {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	})
+
 	goflag.CommandLine.VisitAll(func(goflag *goflag.Flag) {
 		switch goflag.Name {
 		// Skip things that are dragged in by our dependencies
@@ -130,11 +159,15 @@ func NewCmdRoot(in io.Reader, out, err io.Writer, cmd *cobra.Command) *cobra.Com
 	pkiCommands := NewCmdPKI(out, err)
 	fabricCommand := fabric.NewFabricCmd(p)
 	edgeCommand := edge.NewCmdEdge(out, err)
+	edgeCommand.AddCommand(NewCmdEdgeQuickstart(out, err))
+	opsCommand := ops.NewOpsCmd(p)
+	noteCommand := edge.NewCmdNote(out, err)
 	tutorialCmd := tutorial.NewTutorialCmd(p)
 	demoCmd := demo.NewDemoCmd(p)
 	logFilter := NewCmdLogFormat(out, err)
 	unwrapIdentityFileCommand := NewUnwrapIdentityFileCommand(out, err)
 	dbCommand := database.NewCmdDb(out, err)
+	pluginCommand := NewCmdPlugin(out, err)
 
 	installCommands := []*cobra.Command{
 		NewCmdInstall(out, err),
@@ -170,6 +203,8 @@ func NewCmdRoot(in io.Reader, out, err io.Writer, cmd *cobra.Command) *cobra.Com
 			Commands: []*cobra.Command{
 				fabricCommand,
 				edgeCommand,
+				opsCommand,
+				noteCommand,
 			},
 		},
 		{
@@ -177,6 +212,7 @@ func NewCmdRoot(in io.Reader, out, err io.Writer, cmd *cobra.Command) *cobra.Com
 			Commands: []*cobra.Command{
 				logFilter,
 				dbCommand,
+				pluginCommand,
 			},
 		},
 		{
@@ -198,6 +234,7 @@ func NewCmdRoot(in io.Reader, out, err io.Writer, cmd *cobra.Command) *cobra.Com
 	cmd.AddCommand(NewCmdPing(out, err))
 	cmd.AddCommand(NewCmdAdhoc(out, err))
 	cmd.AddCommand(NewCmdUse(out, err))
+	cmd.AddCommand(NewCmdBatch(in, out, err))
 
 	return cmd
 }
@@ -85,3 +85,22 @@ func (options *CommonOptions) Println(s interface{}) {
 }
 
 var CliIdentity string
+
+// CacheTTL is how long responses to read operations may be served from the local response cache. Zero disables caching
+var CacheTTL time.Duration
+
+// NoCache bypasses the local response cache, even if CacheTTL is set
+var NoCache bool
+
+// MaxIdleConns is how many idle connections REST clients keep open to the controller, for reuse by later requests
+var MaxIdleConns = 10
+
+// IdleConnTimeout is how long REST clients keep idle connections open for
+var IdleConnTimeout = 10 * time.Second
+
+// TLSSessionCacheSize is how many TLS sessions REST clients cache, for resuming instead of repeating full handshakes
+// on new connections. Zero disables the cache
+var TLSSessionCacheSize int
+
+// ClientStats outputs a summary of the requests made and connections used by REST clients when the command exits
+var ClientStats bool
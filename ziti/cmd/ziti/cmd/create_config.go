@@ -47,6 +47,7 @@ type CreateConfigOptions struct {
 
 	Output       string
 	DatabaseFile string
+	SecretFrom   []string
 }
 
 type ConfigTemplateValues struct {
@@ -80,6 +81,7 @@ type ControllerTemplateValues struct {
 	Edge                       EdgeControllerValues
 	WebListener                ControllerWebListenerValues
 	HealthCheck                ControllerHealthCheckValues
+	Console                    ControllerConsoleValues
 }
 
 type EdgeControllerValues struct {
@@ -106,6 +108,11 @@ type ControllerWebListenerValues struct {
 	MaxTLSVersion string
 }
 
+type ControllerConsoleValues struct {
+	Enabled  bool
+	Location string
+}
+
 type ControllerHealthCheckValues struct {
 	Interval     time.Duration
 	Timeout      time.Duration
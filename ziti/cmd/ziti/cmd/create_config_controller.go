@@ -31,8 +31,12 @@ import (
 )
 
 const (
-	optionCtrlPort     = "ctrlPort"
-	optionDatabaseFile = "databaseFile"
+	optionCtrlPort       = "ctrlPort"
+	optionDatabaseFile   = "databaseFile"
+	optionWithConsole    = "with-console"
+	optionConsoleDir     = "console-dir"
+	optionConsoleSha256  = "console-sha256"
+	optionConsoleVersion = "console-version"
 )
 
 var (
@@ -52,6 +56,15 @@ var (
 
 		# Print the controller config to a file
 		ziti create config controller --output <path to file>/<filename>.yaml
+
+		# Create the controller config, hosting the admin console from a local directory
+		ziti create config controller --with-console /opt/ziti/console
+
+		# Create the controller config, downloading the latest admin console release
+		ziti create config controller --with-console download
+
+		# Create the controller config, reading the identity and signing keys from systemd credentials
+		ziti create config controller --secret-from 'file:${CREDENTIALS_DIRECTORY}/ctrl.key' --secret-from 'edge.signing.key=file:${CREDENTIALS_DIRECTORY}/signing.key'
 	`)
 )
 
@@ -62,8 +75,12 @@ var controllerConfigTemplate string
 type CreateConfigControllerOptions struct {
 	CreateConfigOptions
 
-	CtrlPort     string
-	MgmtListener string
+	CtrlPort       string
+	MgmtListener   string
+	WithConsole    string
+	ConsoleDir     string
+	ConsoleSha256  string
+	ConsoleVersion string
 }
 
 // NewCmdCreateConfigController creates a command object for the "create" command
@@ -116,6 +133,7 @@ func NewCmdCreateConfigController() *cobra.Command {
 		},
 	}
 	controllerOptions.addCreateFlags(cmd)
+	controllerOptions.addSecretFlags(cmd)
 	controllerOptions.addFlags(cmd)
 
 	return cmd
@@ -124,10 +142,21 @@ func NewCmdCreateConfigController() *cobra.Command {
 func (options *CreateConfigControllerOptions) addFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&options.CtrlPort, optionCtrlPort, constants.DefaultZitiControllerPort, "port to use for the config controller")
 	cmd.Flags().StringVar(&options.DatabaseFile, optionDatabaseFile, "ctrl.db", "location of the database file")
+	cmd.Flags().StringVar(&options.WithConsole, optionWithConsole, "", "host the admin console from the given directory, or from the latest console release, or the one given by --"+optionConsoleVersion+", if set to 'download'")
+	cmd.Flags().StringVar(&options.ConsoleDir, optionConsoleDir, "", "directory to download the admin console to. Defaults to console in ZITI_HOME")
+	cmd.Flags().StringVar(&options.ConsoleSha256, optionConsoleSha256, "", "expected SHA-256 of the downloaded admin console archive. Defaults to the checksum published with the release")
+	cmd.Flags().StringVar(&options.ConsoleVersion, optionConsoleVersion, "", "release tag of the admin console to download, such as v2.3.1. Defaults to the latest release")
 }
 
 // run implements the command
 func (options *CreateConfigControllerOptions) run(data *ConfigTemplateValues) error {
+	if err := options.configureConsole(&data.Controller.Console); err != nil {
+		return err
+	}
+
+	if err := applySecretSources(options.SecretFrom, controllerSecretFields(&data.Controller)); err != nil {
+		return err
+	}
 
 	tmpl, err := template.New("controller-config").Parse(controllerConfigTemplate)
 	if err != nil {
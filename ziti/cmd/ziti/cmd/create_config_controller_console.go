@@ -0,0 +1,242 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	consoleDownload    = "download"
+	consoleReleaseRepo = "ziti-console"
+	consoleIndexFile   = "index.html"
+)
+
+// configureConsole sets up the console template values from the --with-console flag, downloading the console if requested
+func (options *CreateConfigControllerOptions) configureConsole(console *ControllerConsoleValues) error {
+	console.Enabled = false
+	console.Location = ""
+
+	if options.WithConsole == "" {
+		return nil
+	}
+
+	location := options.WithConsole
+	if strings.EqualFold(location, consoleDownload) {
+		var err error
+		if location, err = options.downloadConsole(); err != nil {
+			return err
+		}
+	}
+
+	location, err := findConsoleRoot(location)
+	if err != nil {
+		return err
+	}
+
+	console.Enabled = true
+	console.Location = cmdhelper.NormalizePath(location)
+	return nil
+}
+
+func (options *CreateConfigControllerOptions) downloadConsole() (string, error) {
+	dir := options.ConsoleDir
+	if dir == "" {
+		zitiHome, err := cmdhelper.GetZitiHome()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(zitiHome, "console")
+	}
+
+	var release *util.GitHubReleasesData
+	var err error
+	if options.ConsoleVersion != "" {
+		release, err = util.GetGitHubReleaseByTag(options.Verbose, consoleReleaseRepo, options.ConsoleVersion)
+	} else {
+		release, err = util.GetLatestGitHubReleaseAsset(options.Verbose, consoleReleaseRepo)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var downloadUrl, assetName string
+	for _, asset := range release.Assets {
+		if strings.HasSuffix(strings.ToLower(asset.BrowserDownloadURL), ".zip") {
+			downloadUrl, assetName = asset.BrowserDownloadURL, asset.Name
+			break
+		}
+	}
+	if downloadUrl == "" {
+		return "", errors.Errorf("no zip archive found in %v release %v", consoleReleaseRepo, release.Version)
+	}
+
+	expectedSha256 := options.ConsoleSha256
+	if expectedSha256 == "" {
+		if expectedSha256, err = publishedSha256(release, assetName); err != nil {
+			return "", err
+		}
+	}
+
+	archive, err := ioutil.TempFile("", "ziti-console-*.zip")
+	if err != nil {
+		return "", err
+	}
+	_ = archive.Close()
+	defer func() { _ = os.Remove(archive.Name()) }()
+
+	logrus.Debugf("downloading admin console %v from %v", release.Version, downloadUrl)
+	if err = util.DownloadGitHubReleaseAsset(downloadUrl, archive.Name()); err != nil {
+		return "", err
+	}
+
+	if err = verifySha256(archive.Name(), expectedSha256); err != nil {
+		return "", err
+	}
+
+	if err = util.Unzip(archive.Name(), dir); err != nil {
+		return "", errors.Wrapf(err, "unable to extract admin console to %v", dir)
+	}
+
+	logrus.Debugf("extracted admin console %v to %v", release.Version, dir)
+	return dir, nil
+}
+
+// publishedSha256 returns the SHA-256 the release publishes for the asset: the digest GitHub records for it or,
+// for releases from before GitHub recorded digests, the one listed in a checksum file of the release, such as
+// <asset>.sha256 or checksums.txt
+func publishedSha256(release *util.GitHubReleasesData, assetName string) (string, error) {
+	for _, asset := range release.Assets {
+		if asset.Name == assetName && strings.HasPrefix(asset.Digest, "sha256:") {
+			return strings.TrimPrefix(asset.Digest, "sha256:"), nil
+		}
+	}
+
+	for _, asset := range release.Assets {
+		name := strings.ToLower(asset.Name)
+		if name == strings.ToLower(assetName) || !(strings.Contains(name, "sha256") || strings.Contains(name, "checksum")) {
+			continue
+		}
+		checksums, err := downloadChecksumFile(asset.BrowserDownloadURL)
+		if err != nil {
+			return "", err
+		}
+		if sum := findSha256(checksums, assetName, name == strings.ToLower(assetName)+".sha256"); sum != "" {
+			return sum, nil
+		}
+	}
+
+	return "", errors.Errorf("%v release %v publishes no checksum for %v, give the expected SHA-256 with --%v",
+		consoleReleaseRepo, release.Version, assetName, optionConsoleSha256)
+}
+
+func downloadChecksumFile(downloadUrl string) ([]byte, error) {
+	file, err := ioutil.TempFile("", "ziti-console-checksums-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if err = util.DownloadGitHubReleaseAsset(downloadUrl, file.Name()); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(file.Name())
+}
+
+// findSha256 returns the SHA-256 listed for the file in checksums in the format written by sha256sum, one
+// '<hex>  <name>' line per file. A checksum file for just that file may hold the hash alone
+func findSha256(checksums []byte, fileName string, ownFile bool) string {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			continue
+		}
+		if len(fields) == 1 && ownFile {
+			return fields[0]
+		}
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == fileName {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+func verifySha256(file string, expected string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return errors.Errorf("checksum mismatch for %v, expected %v, got %v", file, expected, actual)
+	}
+	return nil
+}
+
+// findConsoleRoot returns the directory containing the console index file, which may be the given directory or, as
+// release archives often wrap their contents in a top level directory, a single subdirectory of it
+func findConsoleRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, consoleIndexFile)); err == nil {
+		return dir, nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid admin console location %v", dir)
+	}
+
+	var subDirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subDirs = append(subDirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if len(subDirs) == 1 {
+		if _, err = os.Stat(filepath.Join(subDirs[0], consoleIndexFile)); err == nil {
+			return subDirs[0], nil
+		}
+	}
+
+	return "", errors.Errorf("invalid admin console location %v, %v not found", dir, consoleIndexFile)
+}
@@ -1,10 +1,18 @@
 package cmd
 
 import (
-	"github.com/stretchr/testify/assert"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestControllerOutputPathDoesNotExist(t *testing.T) {
@@ -130,3 +138,110 @@ func TestEdgeCtrlAdvertisedPortValueWhenSet(t *testing.T) {
 
 	assert.Equal(t, expectedPort, data.Controller.Edge.AdvertisedPort)
 }
+
+func TestControllerConfigWithConsole(t *testing.T) {
+	consoleDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(consoleDir, "index.html"), []byte("<html></html>"), 0644))
+
+	cmd := NewCmdCreateConfigController()
+	cmd.SetArgs([]string{"--with-console", consoleDir})
+	output := captureOutput(func() {
+		_ = cmd.Execute()
+	})
+
+	assert.True(t, data.Controller.Console.Enabled)
+	assert.Contains(t, output, "binding: zac")
+	assert.Contains(t, output, "location: \""+cmdhelper.NormalizePath(consoleDir)+"\"")
+}
+
+func TestControllerConfigWithoutConsole(t *testing.T) {
+	cmd := NewCmdCreateConfigController()
+	cmd.SetArgs([]string{})
+	output := captureOutput(func() {
+		_ = cmd.Execute()
+	})
+
+	assert.False(t, data.Controller.Console.Enabled)
+	assert.NotContains(t, output, "binding: zac")
+}
+
+func TestFindConsoleRootInSubdirectory(t *testing.T) {
+	consoleDir := t.TempDir()
+	nested := filepath.Join(consoleDir, "ziti-console")
+	assert.NoError(t, os.Mkdir(nested, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(nested, "index.html"), []byte("<html></html>"), 0644))
+
+	root, err := findConsoleRoot(consoleDir)
+	assert.NoError(t, err)
+	assert.Equal(t, nested, root)
+
+	_, err = findConsoleRoot(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestFindSha256(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+
+	tests := []struct {
+		name      string
+		checksums string
+		ownFile   bool
+		expected  string
+	}{
+		{name: "sha256sum listing", checksums: other + "  ziti-console.tar.gz\n" + sum + "  ziti-console.zip\n", expected: sum},
+		{name: "binary mode listing", checksums: sum + " *ziti-console.zip\n", expected: sum},
+		{name: "not listed", checksums: other + "  ziti-console.tar.gz\n"},
+		{name: "hash alone in its own file", checksums: sum + "\n", ownFile: true, expected: sum},
+		{name: "hash alone in a shared file", checksums: sum + "\n"},
+		{name: "not a SHA-256", checksums: "abc123  ziti-console.zip\n"},
+		{name: "not hex", checksums: strings.Repeat("zz", 32) + "  ziti-console.zip\n"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, findSha256([]byte(test.checksums), "ziti-console.zip", test.ownFile), test.name)
+	}
+}
+
+func TestPublishedSha256(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/checksums.txt":
+			_, _ = w.Write([]byte(sum + "  ziti-console.zip\n"))
+		case "/ziti-console.zip.sha256":
+			_, _ = w.Write([]byte(sum))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	release := func(assets ...map[string]string) *util.GitHubReleasesData {
+		data, err := json.Marshal(map[string]interface{}{"tag_name": "v1.0.0", "assets": assets})
+		assert.NoError(t, err)
+		result := &util.GitHubReleasesData{}
+		assert.NoError(t, json.Unmarshal(data, result))
+		return result
+	}
+	zip := map[string]string{"name": "ziti-console.zip", "browser_download_url": server.URL + "/ziti-console.zip"}
+
+	withDigest := map[string]string{"name": "ziti-console.zip", "digest": "sha256:" + sum}
+	result, err := publishedSha256(release(withDigest), "ziti-console.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, result)
+
+	result, err = publishedSha256(release(zip, map[string]string{"name": "checksums.txt", "browser_download_url": server.URL + "/checksums.txt"}), "ziti-console.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, result)
+
+	result, err = publishedSha256(release(zip, map[string]string{"name": "ziti-console.zip.sha256", "browser_download_url": server.URL + "/ziti-console.zip.sha256"}), "ziti-console.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, sum, result)
+
+	_, err = publishedSha256(release(zip, map[string]string{"name": "sha256sums.txt", "browser_download_url": server.URL + "/missing"}), "ziti-console.zip")
+	assert.Error(t, err)
+
+	_, err = publishedSha256(release(zip), "ziti-console.zip")
+	assert.EqualError(t, err, "ziti-console release v1.0.0 publishes no checksum for ziti-console.zip, give the expected SHA-256 with --console-sha256")
+}
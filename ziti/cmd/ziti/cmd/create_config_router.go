@@ -77,6 +77,7 @@ func NewCmdCreateConfigRouter() *cobra.Command {
 	cmd.AddCommand(NewCmdCreateConfigRouterFabric())
 
 	routerOptions.addCreateFlags(cmd)
+	routerOptions.addSecretFlags(cmd)
 	routerOptions.addFlags(cmd)
 	return cmd
 }
@@ -74,6 +74,7 @@ func NewCmdCreateConfigRouterEdge() *cobra.Command {
 	}
 
 	routerOptions.addCreateFlags(cmd)
+	routerOptions.addSecretFlags(cmd)
 	routerOptions.addEdgeFlags(cmd)
 
 	return cmd
@@ -96,6 +97,10 @@ func (options *CreateConfigRouterOptions) runEdgeRouter(data *ConfigTemplateValu
 		return errors.New("Flags for private and wss configs are mutually exclusive. You must choose private or wss, not both")
 	}
 
+	if err := applySecretSources(options.SecretFrom, routerSecretFields(&data.Router)); err != nil {
+		return err
+	}
+
 	tmpl, err := template.New("edge-router-config").Parse(routerConfigEdgeTemplate)
 	if err != nil {
 		return err
@@ -64,6 +64,7 @@ func NewCmdCreateConfigRouterFabric() *cobra.Command {
 	}
 
 	routerOptions.addCreateFlags(cmd)
+	routerOptions.addSecretFlags(cmd)
 	routerOptions.addFabricFlags(cmd)
 
 	return cmd
@@ -79,6 +80,9 @@ func (options *CreateConfigRouterOptions) addFabricFlags(cmd *cobra.Command) {
 
 // run implements the command
 func (options *CreateConfigRouterOptions) runFabricRouter(data *ConfigTemplateValues) error {
+	if err := applySecretSources(options.SecretFrom, routerSecretFields(&data.Router)); err != nil {
+		return err
+	}
 
 	tmpl, err := template.New("fabric-router-config").Parse(routerConfigFabricTemplate)
 	if err != nil {
@@ -0,0 +1,136 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optionSecretFrom      = "secret-from"
+	secretFromDescription = "reference a secret from the environment or a file instead of embedding its location, as " +
+		"[<field>=]env:<NAME> or [<field>=]file:<path>. The field defaults to " + secretFieldIdentityKey + ". May be repeated"
+
+	secretFieldIdentityKey    = "identity.key"
+	secretFieldWebIdentityKey = "web.identity.key"
+	secretFieldSigningKey     = "edge.signing.key"
+)
+
+var envVarNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// addSecretFlags adds the --secret-from flag to config commands whose output contains secrets
+func (options *CreateConfigOptions) addSecretFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringArrayVar(&options.SecretFrom, optionSecretFrom, nil, secretFromDescription)
+}
+
+// controllerSecretFields returns the controller config values which may be given with --secret-from
+func controllerSecretFields(c *ControllerTemplateValues) map[string]*string {
+	return map[string]*string{
+		secretFieldIdentityKey:    &c.IdentityKey,
+		secretFieldWebIdentityKey: &c.Edge.IdentityKey,
+		secretFieldSigningKey:     &c.Edge.ZitiSigningKey,
+	}
+}
+
+// routerSecretFields returns the router config values which may be given with --secret-from
+func routerSecretFields(r *RouterTemplateValues) map[string]*string {
+	return map[string]*string{
+		secretFieldIdentityKey: &r.IdentityKey,
+	}
+}
+
+// applySecretSources replaces the given fields with references to their secret sources. An env:NAME source becomes
+// ${NAME}, which the controller and router expand when loading their config, so the variable may hold either a path or
+// a pem: encoded key. A file:path source becomes a file: URL, which lets the path itself reference the environment,
+// e.g. file:${CREDENTIALS_DIRECTORY}/ctrl.key for systemd credentials. The web identity key follows the identity key
+// unless it's set separately
+func applySecretSources(secretFrom []string, fields map[string]*string) error {
+	values := map[string]string{}
+	for _, val := range secretFrom {
+		field, source := secretFieldIdentityKey, val
+		if idx := strings.Index(val, "="); idx >= 0 {
+			field, source = val[:idx], val[idx+1:]
+		}
+
+		if _, found := fields[field]; !found {
+			var valid []string
+			for k := range fields {
+				valid = append(valid, k)
+			}
+			sort.Strings(valid)
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --%v field '%v', must be one of %v", optionSecretFrom, field, strings.Join(valid, ", "))
+		}
+
+		if _, found := values[field]; found {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--%v given more than once for %v", optionSecretFrom, field)
+		}
+
+		ref, err := secretReference(source)
+		if err != nil {
+			return err
+		}
+		values[field] = ref
+	}
+
+	if webKey, found := fields[secretFieldWebIdentityKey]; found {
+		if _, set := values[secretFieldWebIdentityKey]; !set && *webKey == *fields[secretFieldIdentityKey] {
+			if ref, set := values[secretFieldIdentityKey]; set {
+				values[secretFieldWebIdentityKey] = ref
+			}
+		}
+	}
+
+	for field, ref := range values {
+		*fields[field] = ref
+	}
+
+	return nil
+}
+
+func secretReference(source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		if !envVarNameRegex.MatchString(name) {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid environment variable name '%v' in --%v", name, optionSecretFrom)
+		}
+		return fmt.Sprintf("${%v}", name), nil
+	case strings.HasPrefix(source, "file:"):
+		path := strings.TrimPrefix(source, "file:")
+		if path == "" {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "missing path in --%v %v", optionSecretFrom, source)
+		}
+		// paths starting with a variable are left for the controller or router to resolve
+		if !strings.HasPrefix(path, "$") {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return "", err
+			}
+			path = cmdhelper.NormalizePath(abs)
+		}
+		return "file:" + path, nil
+	default:
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --%v source '%v', must start with env: or file:", optionSecretFrom, source)
+	}
+}
@@ -229,3 +229,25 @@ func captureOutput(function func()) string {
 	_, _ = io.Copy(&buffer, r)
 	return buffer.String()
 }
+
+func TestApplySecretSources(t *testing.T) {
+	c := &ControllerTemplateValues{
+		IdentityKey: "/ziti/ctrl.key",
+		Edge: EdgeControllerValues{
+			IdentityKey:    "/ziti/ctrl.key",
+			ZitiSigningKey: "/ziti/signing.key",
+		},
+	}
+
+	err := applySecretSources([]string{"env:CTRL_KEY", "edge.signing.key=file:${CREDENTIALS_DIRECTORY}/signing.key"}, controllerSecretFields(c))
+	assert.NoError(t, err)
+	assert.Equal(t, "${CTRL_KEY}", c.IdentityKey)
+	assert.Equal(t, "${CTRL_KEY}", c.Edge.IdentityKey)
+	assert.Equal(t, "file:${CREDENTIALS_DIRECTORY}/signing.key", c.Edge.ZitiSigningKey)
+
+	r := &RouterTemplateValues{IdentityKey: "/ziti/router.key"}
+	assert.Error(t, applySecretSources([]string{"edge.signing.key=env:KEY"}, routerSecretFields(r)))
+	assert.Error(t, applySecretSources([]string{"vault:key"}, routerSecretFields(r)))
+	assert.Error(t, applySecretSources([]string{"env:NOT-VALID"}, routerSecretFields(r)))
+	assert.Equal(t, "/ziti/router.key", r.IdentityKey)
+}
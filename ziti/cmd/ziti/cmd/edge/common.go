@@ -19,7 +19,7 @@ package edge
 import (
 	"fmt"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
-	"github.com/pkg/errors"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"os"
 	"strings"
 )
@@ -40,11 +40,11 @@ func mapNameToID(entityType string, val string, o api.Options) (string, error) {
 	}
 
 	if len(list) < 1 {
-		return "", errors.Errorf("no %v found with id or name %v", entityType, val)
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no %v found with id or name %v", entityType, val)
 	}
 
 	if len(list) > 1 {
-		return "", errors.Errorf("multiple %v found for name %v, please use id instead", entityType, val)
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "multiple %v found for name %v, please use id instead", entityType, val)
 	}
 
 	entity := list[0]
@@ -62,7 +62,7 @@ func mapIdToName(entityType string, val string, o api.Options) (string, error) {
 	}
 
 	if len(list) < 1 {
-		return "", errors.Errorf("no %v found for id %v", entityType, val)
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no %v found for id %v", entityType, val)
 	}
 
 	entity := list[0]
@@ -89,7 +89,7 @@ func mapNamesToIDs(entityType string, o api.Options, list ...string) ([]string,
 
 			if len(list) > 1 {
 				fmt.Printf("Found multiple %v matching %v. Please specify which you want by prefixing with id: or name:\n", entityType, val)
-				return nil, errors.Errorf("ambigous if %v is id or name", val)
+				return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "ambigous if %v is id or name", val)
 			}
 
 			for _, entity := range list {
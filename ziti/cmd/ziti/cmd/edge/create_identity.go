@@ -37,6 +37,7 @@ type createIdentityOptions struct {
 	isAdmin                  bool
 	roleAttributes           []string
 	jwtOutputFile            string
+	jwtOutputArchive         string
 	username                 string
 	defaultHostingPrecedence string
 	defaultHostingCost       uint16
@@ -72,10 +73,10 @@ func newCreateIdentityCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 
 func newCreateIdentityOfTypeCmd(idType string, options *createIdentityOptions) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   idType + " <name>",
+		Use:   idType + " <name> [<name> ...]",
 		Short: "creates a new " + idType + " identity managed by the Ziti Edge Controller",
-		Long:  "creates a new " + idType + " identity managed by the Ziti Edge Controller",
-		Args:  cobra.ExactArgs(1),
+		Long:  "creates a new " + idType + " identity managed by the Ziti Edge Controller. Multiple names may be given to create several identities with the same settings",
+		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
@@ -92,6 +93,7 @@ func newCreateIdentityOfTypeCmd(idType string, options *createIdentityOptions) *
 	cmd.Flags().StringVar(&options.externalId, "external-id", "", "an external id to give to the identity")
 	cmd.Flags().StringSliceVarP(&options.roleAttributes, "role-attributes", "a", nil, "Role attributes of the new identity")
 	cmd.Flags().StringVarP(&options.jwtOutputFile, "jwt-output-file", "o", "", "File to which to output the JWT used for enrolling the identity")
+	cmd.Flags().StringVar(&options.jwtOutputArchive, "jwt-output-archive", "", "Zip file to which to output the enrollment JWTs of all created identities, along with a CSV manifest")
 	cmd.Flags().StringVarP(&options.defaultHostingPrecedence, "default-hosting-precedence", "p", "", "Default precedence to use when hosting services using this identity [default,required,failed]")
 	cmd.Flags().Uint16VarP(&options.defaultHostingCost, "default-hosting-cost", "c", 0, "Default cost to use when hosting services using this identity")
 	cmd.Flags().StringToIntVar(&options.serviceCosts, "service-costs", map[string]int{}, "Per-service hosting costs")
@@ -105,36 +107,24 @@ func newCreateIdentityOfTypeCmd(idType string, options *createIdentityOptions) *
 }
 
 func runCreateIdentity(idType string, o *createIdentityOptions) error {
-	entityData := gabs.New()
-	api.SetJSONValue(entityData, o.Args[0], "name")
-	api.SetJSONValue(entityData, strings.Title(idType), "type")
-
-	o.username = strings.TrimSpace(o.username)
-	if o.username != "" {
-		api.SetJSONValue(entityData, o.username, "enrollment", "updb")
-	} else {
-		api.SetJSONValue(entityData, true, "enrollment", "ott")
+	if len(o.Args) > 1 && o.jwtOutputFile != "" {
+		return errors.New("--jwt-output-file can only be used when creating a single identity, use --jwt-output-archive instead")
 	}
-	api.SetJSONValue(entityData, o.isAdmin, "isAdmin")
-	api.SetJSONValue(entityData, o.roleAttributes, "roleAttributes")
-	api.SetJSONValue(entityData, o.tags, "tags")
-	api.SetJSONValue(entityData, o.appData, "appData")
 
-	if o.externalId != "" {
-		api.SetJSONValue(entityData, o.externalId, "externalId")
+	o.username = strings.TrimSpace(o.username)
+	if o.username != "" && len(o.Args) > 1 {
+		return errors.New("--updb can only be used when creating a single identity")
 	}
 
+	var defaultHostingPrecedence string
 	if o.defaultHostingPrecedence != "" {
 		prec, err := normalizeAndValidatePrecedence(o.defaultHostingPrecedence)
 		if err != nil {
 			return err
 		}
-
-		api.SetJSONValue(entityData, prec, "defaultHostingPrecedence")
+		defaultHostingPrecedence = prec
 	}
 
-	api.SetJSONValue(entityData, o.defaultHostingCost, "defaultHostingCost")
-
 	for k, v := range o.serviceCosts {
 		if v < 0 || v > math.MaxUint16 {
 			return errors.Errorf("hosting costs must be in the range %v-%v", 0, math.MaxUint16)
@@ -146,7 +136,6 @@ func runCreateIdentity(idType string, o *createIdentityOptions) error {
 		delete(o.serviceCosts, k)
 		o.serviceCosts[id] = v
 	}
-	api.SetJSONValue(entityData, o.serviceCosts, "serviceHostingCosts")
 
 	for k, v := range o.servicePrecedences {
 		id, err := mapNameToID("services", k, o.Options)
@@ -162,31 +151,107 @@ func runCreateIdentity(idType string, o *createIdentityOptions) error {
 		delete(o.servicePrecedences, k)
 		o.servicePrecedences[id] = prec
 	}
-	api.SetJSONValue(entityData, o.servicePrecedences, "serviceHostingPrecedences")
 
-	result, err := CreateEntityOfType("identities", entityData.String(), &o.Options)
-	if err := o.LogCreateResult("identity", result, err); err != nil {
-		return err
+	var archive *jwtArchive
+	if o.jwtOutputArchive != "" {
+		var err error
+		if archive, err = newJwtArchive(o.jwtOutputArchive); err != nil {
+			return err
+		}
+		defer func() {
+			if archive != nil {
+				if closeErr := archive.Close(); closeErr != nil {
+					o.Printf("warning: %v\n", closeErr)
+				} else {
+					o.Printf("Wrote %v enrollment JWTs, of the identities created before the failure, to %v\n", archive.Len(), o.jwtOutputArchive)
+				}
+			}
+		}()
 	}
 
-	if o.jwtOutputFile != "" {
+	for _, name := range o.Args {
+		entityData := gabs.New()
+		api.SetJSONValue(entityData, name, "name")
+		api.SetJSONValue(entityData, strings.Title(idType), "type")
+
+		if o.username != "" {
+			api.SetJSONValue(entityData, o.username, "enrollment", "updb")
+		} else {
+			api.SetJSONValue(entityData, true, "enrollment", "ott")
+		}
+		api.SetJSONValue(entityData, o.isAdmin, "isAdmin")
+		api.SetJSONValue(entityData, o.roleAttributes, "roleAttributes")
+		api.SetJSONValue(entityData, o.tags, "tags")
+		api.SetJSONValue(entityData, o.appData, "appData")
+
+		if o.externalId != "" {
+			api.SetJSONValue(entityData, o.externalId, "externalId")
+		}
+
+		if defaultHostingPrecedence != "" {
+			api.SetJSONValue(entityData, defaultHostingPrecedence, "defaultHostingPrecedence")
+		}
+
+		api.SetJSONValue(entityData, o.defaultHostingCost, "defaultHostingCost")
+		api.SetJSONValue(entityData, o.serviceCosts, "serviceHostingCosts")
+		api.SetJSONValue(entityData, o.servicePrecedences, "serviceHostingPrecedences")
+
+		result, err := CreateEntityOfType("identities", entityData.String(), &o.Options)
+		if err := o.LogCreateResultForName("identity", name, result, err); err != nil {
+			return err
+		}
+
+		if o.jwtOutputFile == "" && o.jwtOutputArchive == "" {
+			continue
+		}
+
 		id := result.S("data", "id").Data().(string)
-		if err := getIdentityJwt(o, id, o.Options.Timeout, o.Options.Verbose); err != nil {
+		jwt, expiresAt, err := getIdentityJwt(o, id, o.Options.Timeout, o.Options.Verbose)
+		if err != nil {
 			return err
 		}
+
+		if o.jwtOutputFile != "" {
+			if err := ioutil.WriteFile(o.jwtOutputFile, []byte(jwt), 0600); err != nil {
+				fmt.Printf("Failed to write JWT to file(%v)\n", o.jwtOutputFile)
+				return err
+			}
+			if expiresAt != "" {
+				fmt.Printf("Enrollment expires at %v\n", expiresAt)
+			}
+		}
+
+		if archive != nil {
+			if err := archive.Add(&jwtArchiveEntry{Name: name, Id: id, ExpiresAt: expiresAt, Jwt: jwt}); err != nil {
+				return err
+			}
+		}
 	}
-	return err
-}
 
-func getIdentityJwt(o *createIdentityOptions, id string, timeout int, verbose bool) error {
+	if archive != nil {
+		written := archive.Len()
+		err := archive.Close()
+		archive = nil
+		if err != nil {
+			return err
+		}
+		if !o.OutputJSONResponse {
+			o.Printf("Wrote %v enrollment JWTs to %v\n", written, o.jwtOutputArchive)
+		}
+	}
 
+	return nil
+}
+
+// getIdentityJwt returns the enrollment JWT of the identity with the given id, and when it expires
+func getIdentityJwt(o *createIdentityOptions, id string, timeout int, verbose bool) (string, string, error) {
 	newIdentity, err := DetailEntityOfType("identities", id, o.OutputJSONResponse, o.Out, timeout, verbose)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	if newIdentity == nil {
-		return fmt.Errorf("no error during identity creation, but identity with id %v not found... unable to extract JWT", id)
+		return "", "", fmt.Errorf("no error during identity creation, but identity with id %v not found... unable to extract JWT", id)
 	}
 
 	var dataContainer *gabs.Container
@@ -200,24 +265,17 @@ func getIdentityJwt(o *createIdentityOptions, id string, timeout int, verbose bo
 	jwt, ok := dataContainer.Data().(string)
 
 	if !ok {
-		return fmt.Errorf("could not read enrollment.ott.jwt as a string encountered %v", reflect.TypeOf(data))
+		return "", "", fmt.Errorf("could not read enrollment.ott.jwt as a string encountered %v", reflect.TypeOf(data))
 	}
 
 	if jwt == "" {
-		return fmt.Errorf("enrollment JWT not present for new identity")
-	}
-
-	if err := ioutil.WriteFile(o.jwtOutputFile, []byte(jwt), 0600); err != nil {
-		fmt.Printf("Failed to write JWT to file(%v)\n", o.jwtOutputFile)
-		return err
+		return "", "", fmt.Errorf("enrollment JWT not present for new identity")
 	}
 
+	var expiresAt string
 	if container := newIdentity.Path("enrollment.ott.expiresAt"); container != nil && container.Data() != nil {
-		jwtExpiration := fmt.Sprintf("%v", container.Data())
-		if jwtExpiration != "" {
-			fmt.Printf("Enrollment expires at %v\n", jwtExpiration)
-		}
+		expiresAt = fmt.Sprintf("%v", container.Data())
 	}
 
-	return err
+	return jwt, expiresAt, nil
 }
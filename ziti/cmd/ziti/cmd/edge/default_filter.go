@@ -0,0 +1,207 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+)
+
+var defaultFilterLong = templates.LongDesc(`
+Manages the default filters of the selected login. A default filter is combined with the filter given to the list,
+delete where and disable/enable commands for the entity type, so that, for example, entities tagged as test entities
+are never listed or deleted when logged in to a production controller. Pass --no-default-filter to those commands to
+skip the default filter.
+`)
+
+var defaultFilterExample = templates.Examples(`
+	# never show or delete test identities when using the prod login
+	ziti edge use prod
+	ziti edge default-filter set identities 'tags.env != "test"'
+
+	# show the default filters of the selected login
+	ziti edge default-filter list
+`)
+
+// defaultFilterOptions are the flags for default-filter commands
+type defaultFilterOptions struct {
+	api.Options
+}
+
+// newDefaultFilterCmd creates the command managing the default filters of the selected login
+func newDefaultFilterCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &defaultFilterOptions{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{Out: out, Err: errOut},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "default-filter",
+		Short:   "manages the filters applied by default to entities of a type, for the selected login",
+		Long:    defaultFilterLong,
+		Example: defaultFilterExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	newSubCmd := func(use, short string, args cobra.PositionalArgs, run func() error) *cobra.Command {
+		subCmd := &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  args,
+			Run: func(cmd *cobra.Command, args []string) {
+				options.Cmd = cmd
+				options.Args = args
+				cmdhelper.CheckErr(run())
+			},
+		}
+		options.AddCommonFlags(subCmd)
+		return subCmd
+	}
+
+	cmd.AddCommand(newSubCmd("set <entity type> <filter>", "sets the default filter for an entity type", cobra.ExactArgs(2), options.set))
+	cmd.AddCommand(newSubCmd("unset <entity type>", "removes the default filter for an entity type", cobra.ExactArgs(1), options.unset))
+	cmd.AddCommand(newSubCmd("list", "lists the default filters of the selected login", cobra.NoArgs, options.list))
+
+	return cmd
+}
+
+// normalizeDefaultFilterType returns the plural form of the entity type, as used by the list commands
+func normalizeDefaultFilterType(entityType string) string {
+	entityType = strings.ToLower(strings.TrimSpace(entityType))
+	if strings.HasSuffix(entityType, "s") {
+		return entityType
+	}
+	return getPlural(entityType)
+}
+
+func (o *defaultFilterOptions) loadIdentity() (*util.RestClientConfig, *util.RestClientEdgeIdentity, string, error) {
+	config, configFile, err := util.LoadRestClientConfig()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	name := config.GetIdentity()
+	clientIdentity, found := config.EdgeIdentities[name]
+	if !found {
+		return nil, nil, "", cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "no identity '%v' found in cli config %v", name, configFile)
+	}
+	return config, clientIdentity, name, nil
+}
+
+func (o *defaultFilterOptions) set() error {
+	config, clientIdentity, name, err := o.loadIdentity()
+	if err != nil {
+		return err
+	}
+	entityType := normalizeDefaultFilterType(o.Args[0])
+	filter := strings.TrimSpace(o.Args[1])
+	if filter == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "filter must not be empty, use 'ziti edge default-filter unset %v' to remove it", entityType)
+	}
+	if clientIdentity.DefaultFilters == nil {
+		clientIdentity.DefaultFilters = map[string]string{}
+	}
+	clientIdentity.DefaultFilters[entityType] = filter
+	if err = util.PersistRestClientConfig(config); err != nil {
+		return err
+	}
+	o.Printf("default filter for %v of login %v set to: %v\n", entityType, name, filter)
+	return nil
+}
+
+func (o *defaultFilterOptions) unset() error {
+	config, clientIdentity, name, err := o.loadIdentity()
+	if err != nil {
+		return err
+	}
+	entityType := normalizeDefaultFilterType(o.Args[0])
+	if _, found := clientIdentity.DefaultFilters[entityType]; !found {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "login %v has no default filter for %v", name, entityType)
+	}
+	delete(clientIdentity.DefaultFilters, entityType)
+	if err = util.PersistRestClientConfig(config); err != nil {
+		return err
+	}
+	o.Printf("default filter for %v of login %v removed\n", entityType, name)
+	return nil
+}
+
+func (o *defaultFilterOptions) list() error {
+	_, clientIdentity, name, err := o.loadIdentity()
+	if err != nil {
+		return err
+	}
+	if len(clientIdentity.DefaultFilters) == 0 {
+		o.Printf("login %v has no default filters\n", name)
+		return nil
+	}
+	var entityTypes []string
+	for entityType := range clientIdentity.DefaultFilters {
+		entityTypes = append(entityTypes, entityType)
+	}
+	sort.Strings(entityTypes)
+	for _, entityType := range entityTypes {
+		o.Printf("%v: %v\n", entityType, clientIdentity.DefaultFilters[entityType])
+	}
+	return nil
+}
+
+// withDefaultFilter combines the filter with the default filter of the selected login for the entity type, unless
+// --no-default-filter was given. A notice is printed to stderr when a default filter is applied, so that the reason
+// entities are missing from the results is never a surprise
+func withDefaultFilter(entityType string, filter string, o *api.Options) string {
+	if o.NoDefaultFilter {
+		return filter
+	}
+	defaultFilter, name := util.LoadDefaultFilter(entityType)
+	if defaultFilter == "" {
+		return filter
+	}
+	if o.Err != nil {
+		_, _ = fmt.Fprintf(o.Err, "applying default filter '%v' for %v of login %v, skip it with --no-default-filter\n", defaultFilter, entityType, name)
+	}
+	return api.CombineFilters(defaultFilter, filter)
+}
+
+// addFilterParam adds the filter given as the first argument, combined with the default filter for the entity type
+// and sorted as given with --sort, to the query params
+func addFilterParam(params url.Values, entityType string, o *api.Options) error {
+	filter := ""
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+	filter, err := o.SortFilter(withDefaultFilter(entityType, filter, o))
+	if err != nil {
+		return err
+	}
+	if filter != "" {
+		params.Add("filter", filter)
+	}
+	return nil
+}
@@ -72,6 +72,8 @@ func newDeleteCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 
 // newDeleteCmdForEntityType creates the delete command for the given entity type
 func newDeleteCmdForEntityType(entityType string, options *api.Options, aliases ...string) *cobra.Command {
+	bulk := &api.BulkOptions{}
+
 	cmd := &cobra.Command{
 		Use:     entityType + " <id>",
 		Short:   "deletes " + getPlural(entityType) + " managed by the Ziti Edge Controller",
@@ -80,7 +82,7 @@ func newDeleteCmdForEntityType(entityType string, options *api.Options, aliases
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
-			err := runDeleteEntityOfType(options, getPlural(entityType))
+			err := runDeleteEntityOfType(options, bulk, getPlural(entityType))
 			cmdhelper.CheckErr(err)
 		},
 		SuggestFor: []string{},
@@ -89,13 +91,14 @@ func newDeleteCmdForEntityType(entityType string, options *api.Options, aliases
 	// allow interspersing positional args and flags
 	cmd.Flags().SetInterspersed(true)
 	options.AddCommonFlags(cmd)
+	bulk.AddBulkFlags(cmd, false)
 
-	cmd.AddCommand(newDeleteWhereCmdForEntityType(entityType, options))
+	cmd.AddCommand(newDeleteWhereCmdForEntityType(entityType, options, bulk))
 
 	return cmd
 }
 
-func newDeleteWhereCmdForEntityType(entityType string, options *api.Options) *cobra.Command {
+func newDeleteWhereCmdForEntityType(entityType string, options *api.Options, bulk *api.BulkOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "where <filter>",
 		Short: "deletes " + getPlural(entityType) + " matching the filter managed by the Ziti Edge Controller",
@@ -103,7 +106,7 @@ func newDeleteWhereCmdForEntityType(entityType string, options *api.Options) *co
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
-			err := runDeleteEntityOfTypeWhere(options, getPlural(entityType))
+			err := runDeleteEntityOfTypeWhere(options, bulk, getPlural(entityType))
 			cmdhelper.CheckErr(err)
 		},
 		SuggestFor: []string{},
@@ -112,12 +115,14 @@ func newDeleteWhereCmdForEntityType(entityType string, options *api.Options) *co
 	// allow interspersing positional args and flags
 	cmd.Flags().SetInterspersed(true)
 	options.AddCommonFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
+	bulk.AddBulkFlags(cmd, false)
 
 	return cmd
 }
 
 // runDeleteEntityOfType implements the commands to delete various entity types
-func runDeleteEntityOfType(o *api.Options, entityType string) error {
+func runDeleteEntityOfType(o *api.Options, bulk *api.BulkOptions, entityType string) error {
 	var err error
 	ids := o.Args
 	if entityType != "terminators" && entityType != "api-sessions" && entityType != "sessions" && entityType != "authenticators" && entityType != "enrollments" {
@@ -126,24 +131,39 @@ func runDeleteEntityOfType(o *api.Options, entityType string) error {
 	if err != nil {
 		return err
 	}
-	return deleteEntitiesOfType(o, entityType, ids)
+	return deleteEntitiesOfType(o, bulk, entityType, ids)
 }
 
-func deleteEntitiesOfType(o *api.Options, entityType string, ids []string) error {
+// deleteEntitiesOfType deletes the entities with the given ids. By default it stops at the first which can't be deleted
+func deleteEntitiesOfType(o *api.Options, bulk *api.BulkOptions, entityType string, ids []string) error {
+	run, err := bulk.StartBulk("delete " + entityType)
+	if err != nil {
+		return err
+	}
+
 	for _, id := range ids {
+		if !run.Include(id) {
+			continue
+		}
+		if run.Stopped() {
+			run.Skipped(id, "")
+			continue
+		}
 		err := util.ControllerDelete("edge", entityType, id, "", o.Out, o.OutputJSONRequest, o.OutputJSONResponse, o.Timeout, o.Verbose)
 		if err != nil {
 			o.Printf("delete of %v with id %v: %v\n", boltz.GetSingularEntityType(entityType), id, color.New(color.FgRed, color.Bold).Sprint("FAIL"))
-			return err
+			run.Failed(id, "", err)
+			continue
 		}
 		o.Printf("delete of %v with id %v: %v\n", boltz.GetSingularEntityType(entityType), id, color.New(color.FgGreen, color.Bold).Sprint("OK"))
+		run.Succeeded()
 	}
-	return nil
+	return run.Finish()
 }
 
 // runDeleteEntityOfType implements the commands to delete various entity types
-func runDeleteEntityOfTypeWhere(options *api.Options, entityType string) error {
-	filter := strings.Join(options.Args, " ")
+func runDeleteEntityOfTypeWhere(options *api.Options, bulk *api.BulkOptions, entityType string) error {
+	filter := withDefaultFilter(entityType, strings.Join(options.Args, " "), options)
 
 	params := url.Values{}
 	params.Add("filter", filter)
@@ -162,7 +182,7 @@ func runDeleteEntityOfTypeWhere(options *api.Options, entityType string) error {
 		ids = append(ids, id)
 	}
 
-	return deleteEntitiesOfType(options, entityType, ids)
+	return deleteEntitiesOfType(options, bulk, entityType, ids)
 }
 
 func getPlural(entityType string) string {
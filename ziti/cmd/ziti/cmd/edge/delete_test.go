@@ -0,0 +1,81 @@
+package edge
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDeleteOptions(args ...string) *api.Options {
+	return &api.Options{CommonOptions: common.CommonOptions{Out: &bytes.Buffer{}, Args: args}}
+}
+
+func seedTestIdentities(t *testing.T) {
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"identities": {{"id": "id1", "name": "one"}, {"id": "id2", "name": "two"}, {"id": "id3", "name": "three"}},
+	})
+}
+
+func testIdentityIds() []string {
+	var result []string
+	for _, identity := range testController.List("identities") {
+		result = append(result, identity["id"].(string))
+	}
+	return result
+}
+
+func TestDeleteStopsAtFirstFailure(t *testing.T) {
+	req := require.New(t)
+	seedTestIdentities(t)
+	testController.Fail["DELETE identities/id1"] = 500
+
+	report := filepath.Join(t.TempDir(), "failed.json")
+	err := runDeleteEntityOfType(newTestDeleteOptions("id:id1", "id:id2", "id:id3"), &api.BulkOptions{FailureReport: report}, "identities")
+	req.Error(err)
+	req.Contains(err.Error(), "unable to delete identities: 1 of 1 failed, stopped with 2 not attempted")
+	req.Equal([]string{"id1", "id2", "id3"}, testIdentityIds())
+
+	failures, err := api.ReadBulkReport(report)
+	req.NoError(err)
+	req.Len(failures.Failures, 3)
+	req.False(failures.Failures[0].Skipped)
+	req.True(failures.Failures[1].Skipped)
+}
+
+func TestDeleteRetriesFailed(t *testing.T) {
+	req := require.New(t)
+	seedTestIdentities(t)
+	testController.Fail["DELETE identities/id2"] = 500
+
+	report := filepath.Join(t.TempDir(), "failed.json")
+	bulk := &api.BulkOptions{ContinueOnError: true, FailureReport: report}
+	err := runDeleteEntityOfType(newTestDeleteOptions("id:id1", "id:id2", "id:id3"), bulk, "identities")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "Run again with --retry-failed "+report)
+	req.Equal([]string{"id2"}, testIdentityIds())
+
+	failures, err := api.ReadBulkReport(report)
+	req.NoError(err)
+	req.Equal("delete identities", failures.Operation)
+	req.Len(failures.Failures, 1)
+	req.Equal("id2", failures.Failures[0].Entity)
+	req.True(failures.Failures[0].Retriable)
+
+	// retrying with the same arguments only deletes the identity which failed
+	delete(testController.Fail, "DELETE identities/id2")
+	before := len(testController.Requested())
+	req.NoError(runDeleteEntityOfType(newTestDeleteOptions("id:id1", "id:id2", "id:id3"), &api.BulkOptions{RetryFailed: report}, "identities"))
+	req.Empty(testIdentityIds())
+	req.Equal([]string{"DELETE identities/id2"}, testController.Requested()[before:])
+
+	// a report of another operation is rejected
+	err = runDeleteEntityOfType(newTestDeleteOptions("id:id1"), &api.BulkOptions{RetryFailed: report}, "services")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
@@ -0,0 +1,256 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// identityDisabledReasonTag is the tag recording why an identity was disabled
+	identityDisabledReasonTag = "disabledReason"
+	// identityDisabledAtTag is the tag recording when an identity was disabled
+	identityDisabledAtTag = "disabledAt"
+)
+
+// newDisableCmd creates a command object for the "edge disable" command
+func newDisableCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disable",
+		Short: "disables various entities managed by the Ziti Edge Controller",
+		Long:  "disables various entities managed by the Ziti Edge Controller",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := cmd.Help()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.AddCommand(newSetIdentitiesDisabledCmd(true, &api.Options{CommonOptions: common.CommonOptions{Out: out, Err: errOut}}))
+	return cmd
+}
+
+// newEnableCmd creates a command object for the "edge enable" command
+func newEnableCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "enable",
+		Short: "enables various entities managed by the Ziti Edge Controller",
+		Long:  "enables various entities managed by the Ziti Edge Controller",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := cmd.Help()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.AddCommand(newSetIdentitiesDisabledCmd(false, &api.Options{CommonOptions: common.CommonOptions{Out: out, Err: errOut}}))
+	return cmd
+}
+
+type setIdentitiesDisabledOptions struct {
+	*api.Options
+	disable bool
+	filter  string
+	reason  string
+	minutes int64
+	dryRun  bool
+	bulk    api.BulkOptions
+}
+
+// newSetIdentitiesDisabledCmd creates the command to disable, or enable, all identities matching a filter
+func newSetIdentitiesDisabledCmd(disable bool, options *api.Options) *cobra.Command {
+	action := &setIdentitiesDisabledOptions{Options: options, disable: disable}
+
+	short := "enables the identities matching a filter, clearing the reason they were disabled for"
+	long := "enables the identities matching a filter which were disabled, removing the " + identityDisabledReasonTag +
+		" and " + identityDisabledAtTag + " tags recorded when they were disabled"
+	if disable {
+		short = "disables the identities matching a filter, recording the reason in their tags"
+		long = "disables the identities matching a filter, removing their API sessions, so they can no longer " +
+			"authenticate or dial and bind services. The reason and time are recorded in the " + identityDisabledReasonTag +
+			" and " + identityDisabledAtTag + " tags of each identity. The default admin is never disabled"
+	}
+
+	cmd := &cobra.Command{
+		Use:   "identities",
+		Short: short,
+		Long:  long,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			cmdhelper.CheckErr(action.run())
+		},
+		SuggestFor: []string{},
+	}
+
+	if disable {
+		cmd.Example = `  ziti edge disable identities --filter 'anyOf(roleAttributes) = "contractors"' --reason "security incident"`
+		cmd.Flags().StringVar(&action.reason, "reason", "", "Why the identities are being disabled, recorded in their tags")
+		cmd.Flags().Int64Var(&action.minutes, "minutes", 0, "How long to disable the identities for, 0 disables them until re-enabled")
+		_ = cmd.MarkFlagRequired("reason")
+	}
+	cmd.Flags().StringVar(&action.filter, "filter", "", "Filter selecting the identities, e.g. 'name contains \"laptop\"'")
+	cmd.Flags().BoolVar(&action.dryRun, "dry-run", false, "Only list the identities which would be changed")
+	_ = cmd.MarkFlagRequired("filter")
+	action.bulk.AddBulkFlags(cmd, true)
+	options.AddCommonFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
+
+	return cmd
+}
+
+func (self *setIdentitiesDisabledOptions) verb() string {
+	if self.disable {
+		return "disable"
+	}
+	return "enable"
+}
+
+func (self *setIdentitiesDisabledOptions) run() error {
+	if self.minutes < 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --minutes %v, must not be negative", self.minutes)
+	}
+	if self.disable && self.reason == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--reason must not be empty")
+	}
+
+	// all matching identities are changed, unless the filter limits them itself
+	predicate, clauses := api.SplitFilter(withDefaultFilter("identities", self.filter, self.Options))
+	if !strings.Contains(strings.ToLower(clauses), "limit") {
+		clauses = strings.TrimSpace(clauses + " limit none")
+	}
+	filter := api.CombineFilters(predicate, clauses)
+	identities, _, err := filterEntitiesOfType("identities", filter, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return err
+	}
+
+	run, err := self.bulk.StartBulk(self.verb() + " identities")
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, identity := range identities {
+		wrapper := api.Wrap(identity)
+		id := wrapper.String("id")
+		name := wrapper.String("name")
+
+		if !run.Include(id) {
+			continue
+		}
+
+		if self.disable && wrapper.Bool("isDefaultAdmin") {
+			self.Printf("skipping default admin identity %v\n", name)
+			continue
+		}
+		// identities already disabled keep the reason they were originally disabled for
+		if wrapper.Bool("disabled") == self.disable {
+			continue
+		}
+
+		if self.dryRun {
+			self.Printf("would %v identity %v\n", self.verb(), name)
+			changed++
+			continue
+		}
+
+		if run.Stopped() {
+			run.Skipped(id, name)
+			continue
+		}
+		if err := self.setDisabled(identity); err != nil {
+			self.Printf("unable to %v identity %v: %v\n", self.verb(), name, err)
+			run.Failed(id, name, err)
+			continue
+		}
+		run.Succeeded()
+		changed++
+	}
+
+	if self.dryRun {
+		self.Printf("%v identities would be %vd\n", changed, self.verb())
+		return nil
+	}
+	self.Printf("%vd %v identities\n", self.verb(), changed)
+
+	return run.Finish()
+}
+
+// setDisabled disables or enables the identity and updates the tags recording why it was disabled. When disabling,
+// the identity's remaining API sessions are removed, so it's cut off straight away
+func (self *setIdentitiesDisabledOptions) setDisabled(identity *gabs.Container) error {
+	wrapper := api.Wrap(identity)
+	id := wrapper.String("id")
+
+	tags := map[string]interface{}{}
+	if current, ok := identity.S("tags").Data().(map[string]interface{}); ok {
+		for k, v := range current {
+			tags[k] = v
+		}
+	}
+
+	if self.disable {
+		body := fmt.Sprintf(`{"durationMinutes": %d}`, self.minutes)
+		if _, err := postEntityOfType("identities/"+id+"/disable", body, self.Options); err != nil {
+			return err
+		}
+		tags[identityDisabledReasonTag] = self.reason
+		tags[identityDisabledAtTag] = time.Now().UTC().Format(time.RFC3339)
+	} else {
+		if _, err := postEntityOfType("identities/"+id+"/enable", "{}", self.Options); err != nil {
+			return err
+		}
+		delete(tags, identityDisabledReasonTag)
+		delete(tags, identityDisabledAtTag)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"tags": tags})
+	if err != nil {
+		return err
+	}
+	if _, err = patchEntityOfType("identities/"+id, string(body), self.Options); err != nil {
+		return errors.Wrap(err, "unable to update tags")
+	}
+
+	if !self.disable {
+		self.Printf("enabled identity %v\n", wrapper.String("name"))
+		return nil
+	}
+
+	apiSessions, _, err := filterEntitiesOfType("api-sessions", "identity = "+api.QuoteFilterString(id)+" limit none", false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return errors.Wrap(err, "unable to list API sessions")
+	}
+	for _, apiSession := range apiSessions {
+		if err = deleteEntityOfType("api-sessions", api.Wrap(apiSession).String("id"), self.Options); err != nil {
+			return errors.Wrap(err, "unable to remove API session")
+		}
+	}
+	self.Printf("disabled identity %v, removed %v API sessions\n", wrapper.String("name"), len(apiSessions))
+	return nil
+}
@@ -0,0 +1,47 @@
+package edge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisableIdentitiesFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{filter: `name = "laptop"`, expected: `GET identities?(name = "laptop") limit none`},
+		{filter: `name = "laptop" sort by name`, expected: `GET identities?(name = "laptop") sort by name limit none`},
+		{filter: `name = "laptop" skip 1`, expected: `GET identities?(name = "laptop") skip 1 limit none`},
+		{filter: `name = "laptop" limit 5`, expected: `GET identities?(name = "laptop") limit 5`},
+		{filter: `name = "laptop limit" sort by name`, expected: `GET identities?(name = "laptop limit") sort by name limit none`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			req := require.New(t)
+
+			testController.Reset(t, map[string][]map[string]interface{}{
+				"identities":   {{"id": "id0", "name": "old-laptop", "disabled": true}, {"id": "id1", "name": "laptop"}},
+				"api-sessions": {{"id": "as1", "identity": map[string]interface{}{"id": "id1"}}},
+			})
+			testController.Match = func(entityType, predicate string, entity map[string]interface{}) bool {
+				return true
+			}
+
+			out := &bytes.Buffer{}
+			o := newTestListOptions(out)
+			o.NoDefaultFilter = true
+			cmd := &setIdentitiesDisabledOptions{Options: o, disable: true, filter: test.filter, reason: "lost"}
+			req.NoError(cmd.run())
+
+			requested := testController.Requested()
+			req.Equal(test.expected, requested[0])
+			req.Contains(requested, `GET api-sessions?identity = "id1" limit none`)
+			req.Contains(requested, "DELETE api-sessions/as1")
+			req.Contains(out.String(), "disabled identity laptop, removed 1 API sessions")
+		})
+	}
+}
@@ -0,0 +1,569 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	nfpem "github.com/openziti/foundation/v2/pem"
+	"github.com/openziti/sdk-golang/ziti/constants"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/resty.v1"
+)
+
+type importCaOptions struct {
+	api.Options
+	tags                 map[string]string
+	autoOtt              bool
+	autoCaEnrollment     bool
+	caKeyPath            string
+	caKeyPassword        string
+	verificationCertPath string
+	authPolicyName       string
+	testIdentity         string
+	keepTestIdentity     bool
+	identityRoles        []string
+	identityNameFormat   string
+
+	steps int
+}
+
+func newImportCaCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &importCaOptions{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{
+				Out: out,
+				Err: errOut,
+			},
+		},
+		tags: make(map[string]string),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "ca <name> <pemCertFile>",
+		Short: "imports and onboards a third party ca, checking each step",
+		Long: "Imports a third party CA into the Ziti Edge Controller, checking each step of the onboarding. The CA " +
+			"certificate is checked before it's imported, then the CA is created with authentication enabled and " +
+			"verified, using the CA's private key given with --ca-key or a verification certificate given with " +
+			"--verification-cert. Without either, the verification token is shown, to verify the CA later with " +
+			"'ziti edge verify ca'.\n\n" +
+			"With --auto-ott one-time-token CA enrollment is enabled for the CA and an auth policy allowing only " +
+			"certificate authentication is created for the identities enrolling with it. --test-identity then also " +
+			"creates an identity with OTT CA enrollment and, given the CA's private key, enrolls and authenticates it " +
+			"with a certificate issued by the CA, to validate the whole chain end to end. The test identity is " +
+			"deleted afterwards, unless --keep-test-identity is given.\n\n" +
+			"If a step fails, the CA and the auth policy created by the import are deleted again, so the import can " +
+			"be retried once the problem is fixed.",
+		Example: "  ziti edge import ca partner-ca ./partner-ca.pem --ca-key ./partner-ca.key --auto-ott --test-identity partner-test",
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := runImportCa(options)
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	cmd.Flags().SetInterspersed(true)
+	cmd.Flags().BoolVar(&options.autoOtt, "auto-ott", false, "Enable one-time-token CA enrollment for the CA and create an auth policy for the identities enrolling with it")
+	cmd.Flags().BoolVarP(&options.autoCaEnrollment, "autoca", "u", false, "Whether the CA can be used for auto CA enrollment")
+	cmd.Flags().StringVarP(&options.caKeyPath, "ca-key", "k", "", "The path to the CA's private key, used to verify the CA and to issue the certificate of the test identity")
+	cmd.Flags().StringVarP(&options.caKeyPassword, "password", "p", "", "The password for the CA key if necessary")
+	cmd.Flags().StringVarP(&options.verificationCertPath, "verification-cert", "c", "", "The path to a cert with the CN set as the verification token and signed by the CA, when the CA's private key isn't at hand")
+	cmd.Flags().StringVar(&options.authPolicyName, "auth-policy", "", "The name of the auth policy created with --auto-ott, reused if it exists. Defaults to the CA name suffixed with -cert-auth")
+	cmd.Flags().StringVar(&options.testIdentity, "test-identity", "", "The name of an identity to create with OTT CA enrollment, to validate the onboarding end to end. Requires --auto-ott")
+	cmd.Flags().BoolVar(&options.keepTestIdentity, "keep-test-identity", false, "Keep the test identity instead of deleting it after validating the onboarding")
+	cmd.Flags().StringSliceVarP(&options.identityRoles, "role-attributes", "a", []string{}, "A csv string of role attributes enrolling identities receive")
+	cmd.Flags().StringVarP(&options.identityNameFormat, "identity-name-format", "f", "", "The naming format to use for identities enrolling via the CA")
+	cmd.Flags().StringToStringVarP(&options.tags, "tags", "t", nil, "Add tags to the CA and auth policy definitions")
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// step reports the start of the next onboarding step
+func (o *importCaOptions) step(format string, args ...interface{}) {
+	o.steps++
+	o.Printf("%v. %v\n", o.steps, fmt.Sprintf(format, args...))
+}
+
+// detail reports the outcome of an onboarding step
+func (o *importCaOptions) detail(format string, args ...interface{}) {
+	o.Printf("   %v\n", fmt.Sprintf(format, args...))
+}
+
+func runImportCa(o *importCaOptions) error {
+	name, certPath := o.Args[0], o.Args[1]
+
+	if o.testIdentity != "" && !o.autoOtt {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--test-identity enrolls with OTT CA enrollment, which requires --auto-ott")
+	}
+	if o.caKeyPath != "" && o.verificationCertPath != "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--ca-key and --verification-cert can't be combined")
+	}
+
+	o.step("checking CA certificate %v", certPath)
+	cert, verifyOptions, err := o.checkCaCert(name, certPath)
+	if err != nil {
+		return err
+	}
+
+	// the CA and auth policy are deleted again if a later step fails, so that the import can be retried as is
+	var caId, authPolicyId string
+	var verified, authPolicyCreated bool
+	plan := api.NewPlan(&o.Options)
+
+	plan.Add("create CA "+name, func() error {
+		o.step("creating CA %v", name)
+		var err error
+		if caId, err = o.createCa(name, cert); err != nil {
+			return err
+		}
+		o.detail("created CA %v with id %v, authentication enabled, OTT CA enrollment %v, auto CA enrollment %v", name, caId, enabledString(o.autoOtt), enabledString(o.autoCaEnrollment))
+		return nil
+	}, func() error {
+		return deleteEntityOfType("cas", caId, &o.Options)
+	})
+
+	plan.Add("verify CA "+name, func() error {
+		o.step("verifying CA %v", name)
+		var err error
+		verified, err = o.verifyCa(name, caId, verifyOptions)
+		return err
+	}, nil)
+
+	if o.autoOtt {
+		plan.Add("create auth policy", func() error {
+			o.step("creating auth policy")
+			var err error
+			authPolicyId, authPolicyCreated, err = o.ensureAuthPolicy(name)
+			return err
+		}, func() error {
+			if !authPolicyCreated {
+				return nil
+			}
+			return deleteEntityOfType("auth-policies", authPolicyId, &o.Options)
+		})
+	}
+
+	if o.testIdentity != "" {
+		plan.Add("validate enrollment with test identity "+o.testIdentity, func() error {
+			o.step("validating enrollment with test identity %v", o.testIdentity)
+			return o.validateWithTestIdentity(caId, authPolicyId, verified, verifyOptions)
+		}, nil)
+	}
+
+	if err := plan.Execute(); err != nil {
+		return err
+	}
+
+	if verified {
+		o.Printf("CA %v imported\n", name)
+	} else {
+		o.Printf("CA %v imported, but must still be verified before identities can enroll or authenticate with it\n", name)
+	}
+	return nil
+}
+
+// checkCaCert checks, before anything is created, the problems which otherwise make onboarding fail in non-obvious
+// ways. It returns the CA certificate, and options for signing with the CA's private key if it was given
+func (o *importCaOptions) checkCaCert(name, certPath string) (*x509.Certificate, *verifyCaOptions, error) {
+	pemBytes, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not read CA certificate file %v", certPath)
+	}
+	certs := nfpem.PemToX509(string(pemBytes))
+	if len(certs) == 0 {
+		return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no PEM encoded certificates found in %v", certPath)
+	}
+	cert := certs[0]
+	if len(certs) > 1 {
+		o.detail("warning: %v holds %v certificates, only the first, %v, is imported. Import each CA of a chain which issues client certificates separately", certPath, len(certs), cert.Subject.CommonName)
+	}
+
+	fingerprint := sha1.Sum(cert.Raw)
+	o.detail("subject %v, issued by %v", cert.Subject.String(), cert.Issuer.String())
+	o.detail("valid from %v until %v, fingerprint %v", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339), hex.EncodeToString(fingerprint[:]))
+
+	if problems := caCertProblems(cert, time.Now()); len(problems) > 0 {
+		return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v %v", certPath, strings.Join(problems, ", and "))
+	}
+	if until := time.Until(cert.NotAfter); until < 30*24*time.Hour {
+		o.detail("warning: the CA certificate expires in %v, identities enrolled with it will stop authenticating then", until.Round(time.Hour))
+	}
+
+	var verifyOptions *verifyCaOptions
+	if o.caKeyPath != "" {
+		keyPemBytes, err := ioutil.ReadFile(o.caKeyPath)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "could not read CA key file %v", o.caKeyPath)
+		}
+		verifyOptions = &verifyCaOptions{
+			Options:        o.Options,
+			caCertPemBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+			caKeyPemBytes:  keyPemBytes,
+			caKeyPassword:  o.caKeyPassword,
+		}
+		_, key, err := verifyOptions.loadCaCertAndKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !publicKeysEqual(key.Public(), cert.PublicKey) {
+			return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "the private key in %v isn't the key of the CA certificate %v", o.caKeyPath, certPath)
+		}
+		o.detail("the private key in %v matches the CA certificate", o.caKeyPath)
+	}
+
+	cas, _, err := filterEntitiesOfType("cas", "true limit none", false, nil, o.Timeout, o.Verbose)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ca := range cas {
+		existingName := api.Wrap(ca).String("name")
+		if existingName == name {
+			return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "a CA named %v already exists", name)
+		}
+		for _, existing := range nfpem.PemToX509(api.Wrap(ca).String("certPem")) {
+			if existing.Equal(cert) {
+				return nil, nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "the CA certificate is already imported as CA %v", existingName)
+			}
+		}
+	}
+	o.detail("ok")
+
+	return cert, verifyOptions, nil
+}
+
+// caCertProblems returns the reasons a certificate can't be used as a CA to authenticate and enroll identities
+func caCertProblems(cert *x509.Certificate, now time.Time) []string {
+	var problems []string
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		problems = append(problems, "isn't a CA certificate, as it lacks the CA:TRUE basic constraint, so the controller can't validate client certificates with it")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		problems = append(problems, "lacks the certificate signing key usage, so client certificates issued by it aren't valid")
+	}
+	if now.Before(cert.NotBefore) {
+		problems = append(problems, fmt.Sprintf("isn't valid until %v", cert.NotBefore.Format(time.RFC3339)))
+	}
+	if now.After(cert.NotAfter) {
+		problems = append(problems, fmt.Sprintf("expired on %v", cert.NotAfter.Format(time.RFC3339)))
+	}
+	return problems
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	type equaler interface {
+		Equal(x crypto.PublicKey) bool
+	}
+	key, ok := a.(equaler)
+	return ok && key.Equal(b)
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func (o *importCaOptions) createCa(name string, cert *x509.Certificate) (string, error) {
+	data := gabs.New()
+	api.SetJSONValue(data, name, "name")
+	api.SetJSONValue(data, o.autoCaEnrollment, "isAutoCaEnrollmentEnabled")
+	api.SetJSONValue(data, o.autoOtt, "isOttCaEnrollmentEnabled")
+	api.SetJSONValue(data, true, "isAuthEnabled")
+	api.SetJSONValue(data, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})), "certPem")
+	api.SetJSONValue(data, o.identityRoles, "identityRoles")
+	api.SetJSONValue(data, o.tags, "tags")
+	if o.identityNameFormat != "" {
+		api.SetJSONValue(data, o.identityNameFormat, "identityNameFormat")
+	}
+
+	result, err := CreateEntityOfType("cas", data.String(), &o.Options)
+	if err != nil {
+		return "", err
+	}
+	caId, _ := result.S("data", "id").Data().(string)
+	return caId, nil
+}
+
+// verifyCa verifies the CA, returning false if neither the CA's private key nor a verification certificate was given
+func (o *importCaOptions) verifyCa(name, caId string, verifyOptions *verifyCaOptions) (bool, error) {
+	ca, err := util.ControllerDetailEntity(util.EdgeAPI, "cas", caId, false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return false, err
+	}
+	token, _ := ca.S("data", "verificationToken").Data().(string)
+	if token == "" {
+		return false, errors.Errorf("could not obtain verification token for ca [%s]", caId)
+	}
+
+	var certPem []byte
+	if o.verificationCertPath != "" {
+		if certPem, err = ioutil.ReadFile(o.verificationCertPath); err != nil {
+			return false, errors.Wrapf(err, "could not read verification certificate %v", o.verificationCertPath)
+		}
+		certs := nfpem.PemToX509(string(certPem))
+		if len(certs) == 0 {
+			return false, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no PEM encoded certificates found in %v", o.verificationCertPath)
+		}
+		if certs[0].Subject.CommonName != token {
+			return false, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "the common name of the verification certificate must be the verification token %v, not %v. "+
+				"Issue a new verification certificate, then verify the CA with: ziti edge verify ca %v --cert <file>", token, certs[0].Subject.CommonName, name)
+		}
+	} else if verifyOptions != nil {
+		if certPem, _, err = generateCert(verifyOptions, token); err != nil {
+			return false, errors.Wrap(err, "could not generate verification certificate")
+		}
+	} else {
+		o.detail("neither --ca-key or --verification-cert were given. To verify the CA, issue a certificate from it with the common name %v, then run:", token)
+		o.detail("  ziti edge verify ca %v --cert <file>", name)
+		return false, nil
+	}
+
+	if err := util.EdgeControllerVerify("cas", caId, string(certPem), o.Out, o.OutputJSONResponse, o.Timeout, o.Verbose); err != nil {
+		return false, errors.Wrap(err, "the controller rejected the verification certificate, which must be issued by the CA itself")
+	}
+	o.detail("verified")
+	return true, nil
+}
+
+// ensureAuthPolicy creates the auth policy for identities enrolling with the CA, allowing only certificate
+// authentication, or reuses an existing one of the same name. It returns the id of the policy and whether it was
+// created
+func (o *importCaOptions) ensureAuthPolicy(caName string) (string, bool, error) {
+	name := o.authPolicyName
+	if name == "" {
+		name = caName + "-cert-auth"
+	}
+
+	policies, _, err := filterEntitiesOfType("auth-policies", "name = "+api.QuoteFilterString(name), false, nil, o.Timeout, o.Verbose)
+	if err != nil {
+		return "", false, err
+	}
+	if len(policies) > 0 {
+		policy := api.Wrap(policies[0])
+		if !policy.Bool("primary.cert.allowed") {
+			return "", false, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "auth policy %v exists, but doesn't allow certificate authentication, so identities enrolled with the CA couldn't authenticate", name)
+		}
+		o.detail("reusing auth policy %v with id %v, which allows certificate authentication", name, policy.String("id"))
+		return policy.String("id"), false, nil
+	}
+
+	data := gabs.New()
+	api.SetJSONValue(data, name, "name")
+	api.SetJSONValue(data, true, "primary", "cert", "allowed")
+	api.SetJSONValue(data, false, "primary", "cert", "allowExpiredCerts")
+	api.SetJSONValue(data, false, "primary", "extJwt", "allowed")
+	api.SetJSONValue(data, []string{}, "primary", "extJwt", "allowedSigners")
+	api.SetJSONValue(data, false, "primary", "updb", "allowed")
+	api.SetJSONValue(data, 0, "primary", "updb", "lockoutDurationMinutes")
+	api.SetJSONValue(data, 5, "primary", "updb", "maxAttempts")
+	api.SetJSONValue(data, 5, "primary", "updb", "minPasswordLength")
+	api.SetJSONValue(data, false, "primary", "updb", "requireMixedCase")
+	api.SetJSONValue(data, false, "primary", "updb", "requireNumberChar")
+	api.SetJSONValue(data, false, "primary", "updb", "requireSpecialChar")
+	api.SetJSONValue(data, false, "secondary", "requireTotp")
+	api.SetJSONValue(data, o.tags, "tags")
+
+	result, err := CreateEntityOfType("auth-policies", data.String(), &o.Options)
+	if err != nil {
+		return "", false, err
+	}
+	id, _ := result.S("data", "id").Data().(string)
+	o.detail("created auth policy %v with id %v, allowing only certificate authentication. Set it as the auth policy of identities enrolling with the CA", name, id)
+	return id, true, nil
+}
+
+// validateWithTestIdentity creates an identity with OTT CA enrollment and, if the CA's private key is at hand, enrolls
+// and authenticates it with a certificate issued by the CA
+func (o *importCaOptions) validateWithTestIdentity(caId, authPolicyId string, verified bool, verifyOptions *verifyCaOptions) error {
+	data := gabs.New()
+	api.SetJSONValue(data, o.testIdentity, "name")
+	api.SetJSONValue(data, "Device", "type")
+	api.SetJSONValue(data, false, "isAdmin")
+	api.SetJSONValue(data, caId, "enrollment", "ottca")
+	api.SetJSONValue(data, authPolicyId, "authPolicyId")
+
+	result, err := CreateEntityOfType("identities", data.String(), &o.Options)
+	if err != nil {
+		return err
+	}
+	identityId, _ := result.S("data", "id").Data().(string)
+	o.detail("created identity %v with id %v", o.testIdentity, identityId)
+
+	if verifyOptions == nil || !verified {
+		o.detail("the enrollment can't be tested without --ca-key and a verified CA. Enroll the identity with a certificate issued by the CA, using the enrollment JWT from:")
+		o.detail("  ziti edge list identities 'id = \"%v\"' -j", identityId)
+		return nil
+	}
+
+	validationErr := o.enrollAndAuthenticate(identityId, verifyOptions)
+
+	if !o.keepTestIdentity {
+		if err := deleteEntityOfType("identities", identityId, &o.Options); err != nil {
+			o.detail("warning: unable to delete test identity %v: %v", o.testIdentity, err)
+		} else {
+			o.detail("deleted test identity %v", o.testIdentity)
+		}
+	}
+	return validationErr
+}
+
+// enrollAndAuthenticate enrolls the identity through the client API with a certificate issued by the CA, then
+// authenticates with that certificate, as a device of the CA would
+func (o *importCaOptions) enrollAndAuthenticate(identityId string, verifyOptions *verifyCaOptions) error {
+	identity, err := util.ControllerDetailEntity(util.EdgeAPI, "identities", identityId, false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+	token, _ := identity.S("data", "enrollment", "ottca", "token").Data().(string)
+	if token == "" {
+		return errors.Errorf("no OTT CA enrollment token found for identity %v", o.testIdentity)
+	}
+
+	clientCert, clientKey, err := issueTestClientCert(verifyOptions, o.testIdentity)
+	if err != nil {
+		return err
+	}
+
+	restClientIdentity, err := util.LoadSelectedRWIdentity()
+	if err != nil {
+		return err
+	}
+	managementUrl, err := restClientIdentity.GetBaseUrlForApi(util.EdgeAPI)
+	if err != nil {
+		return err
+	}
+	parsedUrl, err := url.Parse(managementUrl)
+	if err != nil {
+		return err
+	}
+	clientApiUrl := parsedUrl.Scheme + "://" + parsedUrl.Host + "/edge/client/v1"
+
+	tlsConfig, err := restClientIdentity.NewTlsClientConfig()
+	if err != nil {
+		return err
+	}
+	tlsConfig.GetClientCertificate = nil
+	tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey, Leaf: clientCert}}
+
+	client := resty.New().
+		SetTLSClientConfig(tlsConfig).
+		SetTimeout(time.Duration(o.Timeout) * time.Second).
+		SetDebug(o.Verbose)
+
+	resp, err := client.R().
+		SetQueryParam("token", token).
+		SetHeader("Content-Type", "application/json").
+		SetBody("{}").
+		Post(clientApiUrl + "/enroll/ottca")
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, errors.Wrapf(err, "unable to enroll at %v", clientApiUrl))
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "enrolling %v with a certificate issued by the CA failed, status %v: %v. "+
+			"Client certificates must be issued by the CA itself, and the CA must be verified with OTT CA enrollment enabled", o.testIdentity, resp.Status(), resp.String())
+	}
+	o.detail("enrolled %v with a certificate issued by the CA", o.testIdentity)
+
+	resp, err = client.R().
+		SetQueryParam("method", "cert").
+		SetHeader("Content-Type", "application/json").
+		SetBody("{}").
+		Post(clientApiUrl + "/authenticate")
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, errors.Wrapf(err, "unable to authenticate at %v", clientApiUrl))
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v enrolled, but authenticating with its certificate failed, status %v: %v. "+
+			"Check that the CA has authentication enabled and that the auth policy of the identity allows certificate authentication", o.testIdentity, resp.Status(), resp.String())
+	}
+	o.detail("authenticated %v with its certificate", o.testIdentity)
+
+	if session, err := gabs.ParseJSON(resp.Body()); err == nil {
+		if sessionToken, ok := session.S("data", "token").Data().(string); ok {
+			_, _ = client.R().SetHeader(constants.ZitiSession, sessionToken).Delete(clientApiUrl + "/current-api-session")
+		}
+	}
+	return nil
+}
+
+// issueTestClientCert issues a short-lived client certificate from the CA, as a device of the CA would have
+func issueTestClientCert(verifyOptions *verifyCaOptions, commonName string) (*x509.Certificate, crypto.Signer, error) {
+	caCert, caKey, err := verifyOptions.loadCaCertAndKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not generate private key for test client certificate")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"Ziti CLI Generated Test Client Cert"},
+		},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not sign test client certificate with CA")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
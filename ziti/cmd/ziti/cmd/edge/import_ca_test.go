@@ -0,0 +1,169 @@
+package edge
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCaCert(t *testing.T, change func(template *x509.Certificate)) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "partner-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if change != nil {
+		change(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestCaCertProblems(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		change   func(template *x509.Certificate)
+		problems []string
+	}{
+		{"valid", nil, nil},
+		{"not a CA", func(template *x509.Certificate) { template.IsCA = false }, []string{"isn't a CA certificate"}},
+		{"no basic constraints", func(template *x509.Certificate) {
+			template.BasicConstraintsValid = false
+			template.IsCA = false
+		}, []string{"isn't a CA certificate"}},
+		{"no cert sign usage", func(template *x509.Certificate) { template.KeyUsage = x509.KeyUsageDigitalSignature },
+			[]string{"lacks the certificate signing key usage"}},
+		{"no key usage", func(template *x509.Certificate) { template.KeyUsage = 0 }, nil},
+		{"not yet valid", func(template *x509.Certificate) { template.NotBefore = now.Add(time.Hour) }, []string{"isn't valid until"}},
+		{"expired", func(template *x509.Certificate) {
+			template.NotBefore = now.Add(-2 * time.Hour)
+			template.NotAfter = now.Add(-time.Hour)
+		}, []string{"expired on"}},
+		{"expired leaf", func(template *x509.Certificate) {
+			template.IsCA = false
+			template.KeyUsage = x509.KeyUsageDigitalSignature
+			template.NotAfter = now.Add(-time.Minute)
+		}, []string{"isn't a CA certificate", "lacks the certificate signing key usage", "expired on"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert, _ := newTestCaCert(t, test.change)
+			problems := caCertProblems(cert, now)
+			require.Len(t, problems, len(test.problems), "%v", problems)
+			for idx, problem := range test.problems {
+				require.Contains(t, problems[idx], problem)
+			}
+		})
+	}
+}
+
+// writeTestCa writes a CA certificate and its key to PEM files, returning their paths
+func writeTestCa(t *testing.T) (string, string) {
+	cert, key := newTestCaCert(t, nil)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "ca.key")
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certPath, keyPath
+}
+
+func newTestImportCaOptions(out *bytes.Buffer, args ...string) *importCaOptions {
+	return &importCaOptions{
+		Options: api.Options{CommonOptions: common.CommonOptions{Out: out, Args: args}},
+	}
+}
+
+func TestImportCaRollsBackWhenVerificationFails(t *testing.T) {
+	req := require.New(t)
+	testController.Reset(t, nil)
+	testController.Created = func(entityType string, entity map[string]interface{}) {
+		entity["verificationToken"] = "token-" + entity["id"].(string)
+	}
+	testController.Fail["POST cas/verify"] = 400
+
+	certPath, keyPath := writeTestCa(t)
+	out := &bytes.Buffer{}
+	o := newTestImportCaOptions(out, "partner", certPath)
+	o.caKeyPath = keyPath
+
+	err := runImportCa(o)
+	req.Error(err)
+	req.Contains(err.Error(), "unable to verify CA partner")
+	req.Contains(err.Error(), "1 completed steps were rolled back")
+	req.Empty(testController.List("cas"))
+	req.Contains(out.String(), "rollback: undid 'create CA partner'")
+}
+
+func TestImportCaRollsBackWhenTestIdentityFails(t *testing.T) {
+	req := require.New(t)
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"auth-policies": {{"name": "unrelated"}},
+	})
+	testController.Created = func(entityType string, entity map[string]interface{}) {
+		entity["verificationToken"] = "token-" + entity["id"].(string)
+	}
+	testController.Fail["POST identities"] = 400
+
+	certPath, keyPath := writeTestCa(t)
+	o := newTestImportCaOptions(&bytes.Buffer{}, `partner "eu"`, certPath)
+	o.caKeyPath = keyPath
+	o.autoOtt = true
+	o.testIdentity = "partner-test"
+
+	err := runImportCa(o)
+	req.Error(err)
+	req.Contains(err.Error(), "unable to validate enrollment with test identity partner-test")
+	req.Contains(err.Error(), "2 completed steps were rolled back")
+	req.Empty(testController.List("cas"))
+	req.Len(testController.List("auth-policies"), 1, "only the auth policy created by the import is deleted")
+	req.Contains(testController.Requested(), `GET auth-policies?name = "partner \"eu\"-cert-auth"`)
+}
+
+func TestImportCaReusesAuthPolicy(t *testing.T) {
+	req := require.New(t)
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"auth-policies": {{"name": "partner-cert-auth", "primary": map[string]interface{}{"cert": map[string]interface{}{"allowed": true}}}},
+	})
+	testController.Created = func(entityType string, entity map[string]interface{}) {
+		entity["verificationToken"] = "token-" + entity["id"].(string)
+	}
+
+	certPath, keyPath := writeTestCa(t)
+	out := &bytes.Buffer{}
+	o := newTestImportCaOptions(out, "partner", certPath)
+	o.caKeyPath = keyPath
+	o.autoOtt = true
+
+	req.NoError(runImportCa(o))
+	req.Len(testController.List("cas"), 1)
+	req.Len(testController.List("auth-policies"), 1)
+	req.Contains(out.String(), "reusing auth policy partner-cert-auth")
+	req.Contains(out.String(), "CA partner imported")
+}
@@ -0,0 +1,223 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+)
+
+// newInspectCmd creates a command object for the "inspect" command
+func newInspectCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "shows details useful for debugging entities managed by the Ziti Edge Controller",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	inspectCmd.AddCommand(newInspectSessionAction(out, errOut))
+	return inspectCmd
+}
+
+func newInspectSessionAction(out io.Writer, errOut io.Writer) *cobra.Command {
+	action := &inspectSessionAction{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{
+				Out: out,
+				Err: errOut,
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "session <id or token>",
+		Short: "shows a session's service, identity, edge routers and related circuits",
+		Long: "Shows the service, identity and type (dial or bind) of a session, the edge routers returned to the client " +
+			"for it, the service policies which granted it and the circuits the identity has open to the service. " +
+			"Accepts either the session id or the session token a client reports. With -j, outputs a single array of the " +
+			"session, the identity and the circuits.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run(args[0])
+		},
+	}
+
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+type inspectSessionAction struct {
+	api.Options
+}
+
+func (self *inspectSessionAction) run(idOrToken string) error {
+	session, err := self.findSession(idOrToken)
+	if err != nil {
+		return err
+	}
+
+	sessionId := api.GetJsonString(session, "id")
+	identityId := api.GetJsonString(session, "identityId")
+	serviceId := api.GetJsonString(session, "serviceId")
+
+	identityName := identityId
+	identity, err := DetailEntityOfType("identities", identityId, false, self.Out, self.Timeout, self.Verbose)
+	if err == nil {
+		identityName = api.GetJsonString(identity, "name")
+	} else if self.Verbose {
+		self.Printf("unable to look up identity %v: %v\n", identityId, err)
+	}
+
+	allCircuits, _, err := api.ListEntitiesOfType(util.FabricAPI, "circuits", url.Values{"filter": []string{"limit none"}}, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		self.Printf("unable to list circuits: %v\n", err)
+	}
+	circuits := sessionCircuits(allCircuits, sessionId)
+
+	if self.OutputJSONResponse {
+		return self.outputJson(session, identity, circuits)
+	}
+
+	self.Printf("Session:          %v\n", api.GetJsonString(session, "id"))
+	self.Printf("Type:             %v\n", api.GetJsonString(session, "type"))
+	self.Printf("Created:          %v\n", api.GetJsonString(session, "createdAt"))
+	self.Printf("Service:          %v (%v)\n", api.GetJsonString(session, "service.name"), serviceId)
+	self.Printf("Identity:         %v (%v)\n", identityName, identityId)
+	self.Printf("API Session:      %v\n", api.GetJsonString(session, "apiSessionId"))
+	self.Printf("Service Policies: %v\n", strings.Join(entityRefNames(session.Path("servicePolicies")), ", "))
+
+	edgeRouters, _ := session.Path("edgeRouters").Children()
+	self.Printf("\nEdge routers returned to the client: %v\n", len(edgeRouters))
+	if len(edgeRouters) > 0 {
+		t := table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.AppendHeader(table.Row{"ID", "Name", "URLs"})
+		for _, edgeRouter := range edgeRouters {
+			t.AppendRow(table.Row{api.GetJsonString(edgeRouter, "id"), api.GetJsonString(edgeRouter, "name"), strings.Join(edgeRouterUrls(edgeRouter), "\n")})
+		}
+		api.RenderTable(&self.Options, t, nil)
+	} else {
+		self.Printf("The client has no edge routers to connect through. Check the edge router and service edge router policies for the identity and service\n")
+	}
+
+	self.Printf("\nCircuits for this session: %v\n", len(circuits))
+	if len(circuits) > 0 {
+		t := table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.AppendHeader(table.Row{"ID", "Created", "Terminator", "Routers"})
+		for _, circuit := range circuits {
+			nodes, _ := circuit.Path("path.nodes").Children()
+			var routers []string
+			for _, node := range nodes {
+				routers = append(routers, api.GetJsonString(node, "name"))
+			}
+			t.AppendRow(table.Row{api.GetJsonString(circuit, "id"), api.GetJsonString(circuit, "createdAt"),
+				api.GetJsonString(circuit, "terminator.id"), strings.Join(routers, " -> ")})
+		}
+		api.RenderTable(&self.Options, t, nil)
+	}
+
+	return nil
+}
+
+// sessionCircuits returns the circuits created with the session. Edge circuits are created with the id of the session
+// which authorized them as their client id
+func sessionCircuits(circuits []*gabs.Container, sessionId string) []*gabs.Container {
+	var result []*gabs.Container
+	for _, circuit := range circuits {
+		if api.GetJsonString(circuit, "clientId") == sessionId {
+			result = append(result, circuit)
+		}
+	}
+	return result
+}
+
+// outputJson outputs the session, its identity and its circuits as a single json array
+func (self *inspectSessionAction) outputJson(session, identity *gabs.Container, circuits []*gabs.Container) error {
+	var result []interface{}
+	for _, entity := range append([]*gabs.Container{session, identity}, circuits...) {
+		if entity != nil {
+			result = append(result, entity.Data())
+		}
+	}
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+	self.Println(string(data))
+	return nil
+}
+
+// findSession looks the session up by id, falling back to treating the value as a session token
+func (self *inspectSessionAction) findSession(idOrToken string) (*gabs.Container, error) {
+	session, err := DetailEntityOfType("sessions", idOrToken, false, self.Out, self.Timeout, self.Verbose)
+	if err == nil && session != nil && session.Data() != nil {
+		return session, nil
+	}
+
+	children, _, listErr := filterEntitiesOfType("sessions", sessionTokenFilter(idOrToken), false, self.Out, self.Timeout, self.Verbose)
+	if listErr != nil || len(children) == 0 {
+		if err != nil && cmdhelper.ExitCodeForError(err) != cmdhelper.ExitCodeNotFound {
+			return nil, err
+		}
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no session found with id or token %v", idOrToken)
+	}
+
+	// the list doesn't include everything the detail does, such as the service policies
+	return DetailEntityOfType("sessions", api.GetJsonString(children[0], "id"), false, self.Out, self.Timeout, self.Verbose)
+}
+
+func sessionTokenFilter(token string) string {
+	return "token = " + api.QuoteFilterString(token)
+}
+
+func entityRefNames(c *gabs.Container) []string {
+	children, _ := c.Children()
+	var result []string
+	for _, child := range children {
+		result = append(result, api.GetJsonString(child, "name"))
+	}
+	return result
+}
+
+func edgeRouterUrls(edgeRouter *gabs.Container) []string {
+	urls, _ := edgeRouter.Path("urls").ChildrenMap()
+	var result []string
+	for protocol, addr := range urls {
+		result = append(result, fmt.Sprintf("%v: %v", protocol, addr.Data()))
+	}
+	sort.Strings(result)
+	return result
+}
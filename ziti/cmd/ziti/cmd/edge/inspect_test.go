@@ -0,0 +1,60 @@
+package edge
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCircuits(t *testing.T) {
+	req := require.New(t)
+
+	parse := func(val string) *gabs.Container {
+		c, err := gabs.ParseJSON([]byte(val))
+		req.NoError(err)
+		return c
+	}
+	circuits := []*gabs.Container{
+		parse(`{"id":"c1","clientId":"s1","service":{"id":"svc"}}`),
+		parse(`{"id":"c2","clientId":"identity1","service":{"id":"svc"}}`),
+		parse(`{"id":"c3","clientId":"s1","service":{"id":"svc"}}`),
+		parse(`{"id":"c4","clientId":"s2","service":{"id":"svc"}}`),
+	}
+
+	var ids []string
+	for _, circuit := range sessionCircuits(circuits, "s1") {
+		ids = append(ids, api.GetJsonString(circuit, "id"))
+	}
+	req.Equal([]string{"c1", "c3"}, ids)
+	req.Empty(sessionCircuits(circuits, "identity2"))
+}
+
+func TestSessionTokenFilter(t *testing.T) {
+	req := require.New(t)
+	req.Equal(`token = "abc"`, sessionTokenFilter("abc"))
+	req.Equal(`token = "a\" or true or id = \"b"`, sessionTokenFilter(`a" or true or id = "b`))
+}
+
+func TestInspectSessionOutputJson(t *testing.T) {
+	req := require.New(t)
+
+	out := &bytes.Buffer{}
+	action := &inspectSessionAction{Options: api.Options{CommonOptions: common.CommonOptions{Out: out}}}
+
+	session, err := gabs.ParseJSON([]byte(`{"id":"s1"}`))
+	req.NoError(err)
+	circuit, err := gabs.ParseJSON([]byte(`{"id":"c1"}`))
+	req.NoError(err)
+	req.NoError(action.outputJson(session, nil, []*gabs.Container{circuit}))
+
+	var result []map[string]interface{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	req.Len(result, 2)
+	req.Equal("s1", result[0]["id"])
+	req.Equal("c1", result[1]["id"])
+}
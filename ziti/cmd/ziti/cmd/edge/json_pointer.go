@@ -0,0 +1,114 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jsonPointerEdit is a single '<pointer>=<value>' edit, as given to --set-json
+type jsonPointerEdit struct {
+	pointer string
+	path    []string
+	value   interface{}
+}
+
+// parseJSONPointerEdit parses an edit of the form '/portRanges/0/high=8443'. The pointer follows RFC 6901, so '~1'
+// and '~0' stand for '/' and '~' in keys. The value is parsed as JSON if possible, and used as a string otherwise, so
+// '/address=example.com' and '/address="example.com"' are equivalent
+func parseJSONPointerEdit(edit string) (*jsonPointerEdit, error) {
+	idx := strings.Index(edit, "=")
+	if idx < 0 {
+		return nil, errors.Errorf("invalid edit '%v', must be of the form <json pointer>=<value>", edit)
+	}
+
+	pointer := edit[:idx]
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Errorf("invalid json pointer '%v' in edit '%v', must start with '/'", pointer, edit)
+	}
+
+	var path []string
+	for _, token := range strings.Split(pointer[1:], "/") {
+		path = append(path, strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~"))
+	}
+
+	rawValue := edit[idx+1:]
+	var value interface{}
+	if err := json.Unmarshal([]byte(rawValue), &value); err != nil {
+		value = rawValue
+	}
+
+	return &jsonPointerEdit{pointer: pointer, path: path, value: value}, nil
+}
+
+// apply sets the value at the pointer, creating missing objects along the way. An array index equal to the length
+// of the array, or '-', appends to the array. The possibly replaced document is returned
+func (self *jsonPointerEdit) apply(doc interface{}) (interface{}, error) {
+	return self.set(doc, 0)
+}
+
+func (self *jsonPointerEdit) set(current interface{}, depth int) (interface{}, error) {
+	if depth == len(self.path) {
+		return self.value, nil
+	}
+
+	token := self.path[depth]
+	location := "/" + strings.Join(self.path[:depth], "/")
+
+	switch node := current.(type) {
+	case nil:
+		child, err := self.set(nil, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{token: child}, nil
+	case map[string]interface{}:
+		child, err := self.set(node[token], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			var err error
+			if index, err = strconv.Atoi(token); err != nil || index < 0 || index > len(node) {
+				return nil, errors.Errorf("invalid index '%v' for array at %v of length %v in %v", token, location, len(node), self.pointer)
+			}
+		}
+		if index == len(node) {
+			child, err := self.set(nil, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node, child), nil
+		}
+		child, err := self.set(node[index], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	default:
+		return nil, errors.Errorf("can't set %v, value at %v is not an object or array", self.pointer, location)
+	}
+}
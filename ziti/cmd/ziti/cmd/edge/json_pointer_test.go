@@ -0,0 +1,104 @@
+package edge
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPointerEdit(t *testing.T) {
+	tests := []struct {
+		edit  string
+		path  []string
+		value interface{}
+	}{
+		{edit: "/address=example.com", path: []string{"address"}, value: "example.com"},
+		{edit: `/address="example.com"`, path: []string{"address"}, value: "example.com"},
+		{edit: "/portRanges/0/high=8443", path: []string{"portRanges", "0", "high"}, value: float64(8443)},
+		{edit: `/tags={"a":true}`, path: []string{"tags"}, value: map[string]interface{}{"a": true}},
+		{edit: "/url=http://host/?a=b", path: []string{"url"}, value: "http://host/?a=b"},
+		{edit: "/a~1b/c~0d=x", path: []string{"a/b", "c~d"}, value: "x"},
+		{edit: "/~01=x", path: []string{"~1"}, value: "x"},
+		{edit: "/=x", path: []string{""}, value: "x"},
+		{edit: "/a=", path: []string{"a"}, value: ""},
+	}
+
+	for _, test := range tests {
+		edit, err := parseJSONPointerEdit(test.edit)
+		require.NoError(t, err, test.edit)
+		require.Equal(t, test.path, edit.path, test.edit)
+		require.Equal(t, test.value, edit.value, test.edit)
+	}
+
+	for _, val := range []string{"address", "address=x", "a/b=x"} {
+		_, err := parseJSONPointerEdit(val)
+		require.Error(t, err, val)
+	}
+}
+
+func TestApplyJSONPointerEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		edit     string
+		expected string
+		err      string
+	}{
+		{name: "replace", doc: `{"address": "a", "port": 80}`, edit: "/address=b", expected: `{"address": "b", "port": 80}`},
+		{name: "escaped keys", doc: `{"a/b": {"c~d": 1}}`, edit: "/a~1b/c~0d=2", expected: `{"a/b": {"c~d": 2}}`},
+		{name: "missing parents", doc: `{}`, edit: "/a/b/c=1", expected: `{"a": {"b": {"c": 1}}}`},
+		{name: "no document", doc: `null`, edit: "/a=1", expected: `{"a": 1}`},
+		{name: "array index", doc: `{"ports": [1, 2]}`, edit: "/ports/1=3", expected: `{"ports": [1, 3]}`},
+		{name: "array append with -", doc: `{"ports": [1]}`, edit: "/ports/-=2", expected: `{"ports": [1, 2]}`},
+		{name: "array append with length", doc: `{"ports": [1]}`, edit: "/ports/1=2", expected: `{"ports": [1, 2]}`},
+		{name: "append object", doc: `{"ranges": []}`, edit: "/ranges/-/low=80", expected: `{"ranges": [{"low": 80}]}`},
+		{
+			name: "index out of range",
+			doc:  `{"ports": [1]}`,
+			edit: "/ports/2=3",
+			err:  "invalid index '2' for array at /ports of length 1 in /ports/2",
+		},
+		{
+			name: "negative index",
+			doc:  `{"ports": [1]}`,
+			edit: "/ports/-1=3",
+			err:  "invalid index '-1' for array at /ports of length 1 in /ports/-1",
+		},
+		{
+			name: "non-numeric index",
+			doc:  `{"ports": [1]}`,
+			edit: "/ports/first=3",
+			err:  "invalid index 'first' for array at /ports of length 1 in /ports/first",
+		},
+		{
+			name: "parent is a value",
+			doc:  `{"address": "a"}`,
+			edit: "/address/host=b",
+			err:  "can't set /address/host, value at /address is not an object or array",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			var doc interface{}
+			req.NoError(json.Unmarshal([]byte(test.doc), &doc))
+
+			edit, err := parseJSONPointerEdit(test.edit)
+			req.NoError(err)
+
+			result, err := edit.apply(doc)
+			if test.err != "" {
+				req.EqualError(err, test.err)
+				return
+			}
+			req.NoError(err)
+
+			var expected interface{}
+			req.NoError(json.Unmarshal([]byte(test.expected), &expected))
+			req.Equal(expected, result)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jwtArchiveEntry is an enrollment JWT to be packaged in a jwtArchive
+type jwtArchiveEntry struct {
+	Name      string
+	Id        string
+	ExpiresAt string
+	Jwt       string
+}
+
+// jwtArchive is a zip file containing a <name>.jwt file per entry, plus a manifest.csv listing the file, name, id,
+// expiry and SHA-256 fingerprint of each JWT, so the contents can be checked after handoff. Entries are written as
+// they're added, so if creating identities fails part way through, closing the archive still hands off the JWTs of
+// the identities which were created
+type jwtArchive struct {
+	path         string
+	file         *os.File
+	writer       *zip.Writer
+	manifestRows [][]string
+	fileNames    map[string]bool
+}
+
+func newJwtArchive(path string) (*jwtArchive, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create JWT archive %v", path)
+	}
+	return &jwtArchive{
+		path:         path,
+		file:         f,
+		writer:       zip.NewWriter(f),
+		manifestRows: [][]string{{"file", "name", "id", "expiresAt", "fingerprint"}},
+		fileNames:    map[string]bool{},
+	}, nil
+}
+
+// Len returns the number of JWTs added to the archive
+func (self *jwtArchive) Len() int {
+	return len(self.manifestRows) - 1
+}
+
+func (self *jwtArchive) Add(entry *jwtArchiveEntry) error {
+	fileName := jwtArchiveFileName(entry.Name, entry.Id)
+	if self.fileNames[fileName] {
+		fileName = jwtArchiveFileName(entry.Name+"-"+entry.Id, entry.Id)
+	}
+	self.fileNames[fileName] = true
+
+	w, err := self.writer.Create(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to add JWT for %v to archive", entry.Name)
+	}
+	if _, err = w.Write([]byte(entry.Jwt)); err != nil {
+		return errors.Wrapf(err, "unable to add JWT for %v to archive", entry.Name)
+	}
+
+	fingerprint := sha256.Sum256([]byte(entry.Jwt))
+	self.manifestRows = append(self.manifestRows, []string{fileName, entry.Name, entry.Id, entry.ExpiresAt, hex.EncodeToString(fingerprint[:])})
+	return nil
+}
+
+// Close writes the manifest and finishes the archive
+func (self *jwtArchive) Close() error {
+	defer func() { _ = self.file.Close() }()
+
+	w, err := self.writer.Create("manifest.csv")
+	if err != nil {
+		return errors.Wrap(err, "unable to add manifest to archive")
+	}
+	if err = csv.NewWriter(w).WriteAll(self.manifestRows); err != nil {
+		return errors.Wrap(err, "unable to write manifest")
+	}
+
+	if err = self.writer.Close(); err != nil {
+		return errors.Wrapf(err, "unable to write JWT archive %v", self.path)
+	}
+	return self.file.Close()
+}
+
+// jwtArchiveFileName returns the name of the archive file holding the JWT of an identity. Identity names may contain
+// path separators and dot segments, which would let an entry escape the directory the archive is extracted to, so
+// separators are replaced and names which are only dots fall back to the identity's id
+func jwtArchiveFileName(name, id string) string {
+	fileName := strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	fileName = filepath.Base(fileName)
+	if strings.Trim(fileName, ".") == "" {
+		fileName = id
+	}
+	return fileName + ".jwt"
+}
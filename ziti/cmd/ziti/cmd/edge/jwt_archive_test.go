@@ -0,0 +1,59 @@
+package edge
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJwtArchiveRoundTrip(t *testing.T) {
+	req := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "jwts.zip")
+	archive, err := newJwtArchive(path)
+	req.NoError(err)
+
+	entries := []*jwtArchiveEntry{
+		{Name: "laptop", Id: "id1", Jwt: "jwt1"},
+		{Name: "../../etc/cron.d/evil", Id: "id2", Jwt: "jwt2"},
+		{Name: `..\windows\evil`, Id: "id3", Jwt: "jwt3"},
+		{Name: "..", Id: "id4", Jwt: "jwt4"},
+		{Name: "laptop", Id: "id5", Jwt: "jwt5"},
+	}
+	for _, entry := range entries {
+		req.NoError(archive.Add(entry))
+	}
+	req.Equal(5, archive.Len())
+	req.NoError(archive.Close())
+
+	reader, err := zip.OpenReader(path)
+	req.NoError(err)
+	defer func() { _ = reader.Close() }()
+
+	contents := map[string]string{}
+	for _, f := range reader.File {
+		req.Equal(filepath.Base(f.Name), f.Name, "archive entries must not contain directories")
+		rc, err := f.Open()
+		req.NoError(err)
+		data, err := ioutil.ReadAll(rc)
+		req.NoError(err)
+		_ = rc.Close()
+		contents[f.Name] = string(data)
+	}
+
+	req.Equal("jwt1", contents["laptop.jwt"])
+	req.Equal("jwt2", contents[".._.._etc_cron.d_evil.jwt"])
+	req.Equal("jwt3", contents[".._windows_evil.jwt"])
+	req.Equal("jwt4", contents["id4.jwt"])
+	req.Equal("jwt5", contents["laptop-id5.jwt"])
+
+	rows, err := csv.NewReader(strings.NewReader(contents["manifest.csv"])).ReadAll()
+	req.NoError(err)
+	req.Len(rows, 6)
+	req.Equal([]string{".._.._etc_cron.d_evil.jwt", "../../etc/cron.d/evil", "id2"}, rows[2][:3])
+}
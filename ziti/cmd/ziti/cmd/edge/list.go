@@ -28,6 +28,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jeffail/gabs"
 	"github.com/openziti/edge/rest_management_api_client/certificate_authority"
@@ -45,6 +46,7 @@ func newListCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "list",
 		Short:   "Lists various entities managed by the Ziti Edge Controller",
+		Long:    "Lists various entities managed by the Ziti Edge Controller. " + api.RelativeTimesDescription,
 		Aliases: []string{"ls"},
 		Run: func(cmd *cobra.Command, args []string) {
 			err := cmd.Help()
@@ -65,13 +67,14 @@ func newListCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd.AddCommand(newListCmdForEntityType("config-types", runListConfigTypes, newOptions()))
 	cmd.AddCommand(newListCmdForEntityType("configs", runListConfigs, newOptions()))
 	cmd.AddCommand(newListEdgeRoutersCmd(newOptions()))
-	cmd.AddCommand(newListCmdForEntityType("edge-router-policies", runListEdgeRouterPolicies, newOptions(), "erps"))
+	cmd.AddCommand(newListPoliciesCmd("edge-router-policies", true, true, runListEdgeRouterPolicies, outputEdgeRouterPolicies, newOptions(), "erps"))
 	cmd.AddCommand(newListCmdForEntityType("enrollments", runListEnrollments, newOptions()))
-	cmd.AddCommand(newListCmdForEntityType("terminators", runListTerminators, newOptions()))
+	cmd.AddCommand(newListExtJwtSignersCmd(newOptions()))
+	cmd.AddCommand(newListTerminatorsCmd(newOptions()))
 	cmd.AddCommand(newListIdentitiesCmd(newOptions()))
 	cmd.AddCommand(newListServicesCmd(newOptions()))
-	cmd.AddCommand(newListCmdForEntityType("service-edge-router-policies", runListServiceEdgeRouterPolices, newOptions(), "serps"))
-	cmd.AddCommand(newListCmdForEntityType("service-policies", runListServicePolices, newOptions(), "sps"))
+	cmd.AddCommand(newListServiceEdgeRouterPoliciesCmd(newOptions()))
+	cmd.AddCommand(newListPoliciesCmd("service-policies", true, false, runListServicePolices, outputServicePolicies, newOptions(), "sps"))
 	cmd.AddCommand(newListCmdForEntityType("sessions", runListSessions, newOptions()))
 	cmd.AddCommand(newListCmdForEntityType("transit-routers", runListTransitRouters, newOptions()))
 
@@ -183,7 +186,8 @@ func newListCmdForEntityType(entityType string, command listCommandRunner, optio
 
 	// allow interspersing positional args and flags
 	cmd.Flags().SetInterspersed(true)
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -216,7 +220,9 @@ func newListServicesCmd(options *api.Options) *cobra.Command {
 	cmd.Flags().StringSliceVar(&configTypes, "config-types", nil, "Override which config types to view on services")
 	cmd.Flags().StringSliceVar(&roleFilters, "role-filters", nil, "Allow filtering by roles")
 	cmd.Flags().StringVar(&roleSemantic, "role-semantic", "", "Specify which roles semantic to use ")
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	addShowNotesFlag(cmd, options)
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -246,7 +252,9 @@ func newListEdgeRoutersCmd(options *api.Options) *cobra.Command {
 	cmd.Flags().SetInterspersed(true)
 	cmd.Flags().StringSliceVar(&roleFilters, "role-filters", nil, "Allow filtering by roles")
 	cmd.Flags().StringVar(&roleSemantic, "role-semantic", "", "Specify which roles semantic to use ")
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	addShowNotesFlag(cmd, options)
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -256,16 +264,21 @@ func newListEdgeRoutersCmd(options *api.Options) *cobra.Command {
 func newListIdentitiesCmd(options *api.Options) *cobra.Command {
 	var roleFilters []string
 	var roleSemantic string
+	staleOptions := &staleIdentityOptions{}
+	expiryOptions := &certExpiryOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "identities <filter>?",
 		Short: "lists identities managed by the Ziti Edge Controller",
-		Long:  "lists identities managed by the Ziti Edge Controller",
-		Args:  cobra.MaximumNArgs(1),
+		Long: "lists identities managed by the Ziti Edge Controller. Use --stale or --last-seen-before to only list " +
+			"identities which haven't been active recently, based on their API sessions and posture data, and " +
+			"--disable to disable the identities listed. Use --cert-expiry to show when the client certificate of " +
+			"each identity expires, and --expiring-within to only list those due for re-enrollment",
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
-			err := runListIdentities(roleFilters, roleSemantic, options)
+			err := runListIdentities(roleFilters, roleSemantic, staleOptions, expiryOptions, options)
 			cmdhelper.CheckErr(err)
 		},
 		SuggestFor: []string{},
@@ -275,7 +288,11 @@ func newListIdentitiesCmd(options *api.Options) *cobra.Command {
 	cmd.Flags().SetInterspersed(true)
 	cmd.Flags().StringSliceVar(&roleFilters, "role-filters", nil, "Allow filtering by roles")
 	cmd.Flags().StringVar(&roleSemantic, "role-semantic", "", "Specify which roles semantic to use ")
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	staleOptions.addFlags(cmd)
+	expiryOptions.addFlags(cmd)
+	addShowNotesFlag(cmd, options)
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -300,8 +317,9 @@ func newSubListCmdForEntityType(entityType string, subType string, outputF outpu
 
 	// allow interspersing positional args and flags
 	cmd.Flags().SetInterspersed(true)
+	addShowNotesFlag(cmd, options)
 	options.AddCommonFlags(cmd)
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	options.AddTableOutputFlags(cmd)
 
 	return cmd
 }
@@ -309,8 +327,8 @@ func newSubListCmdForEntityType(entityType string, subType string, outputF outpu
 // ListEntitiesOfType queries the Ziti Controller for entities of the given type
 func listEntitiesWithOptions(entityType string, options *api.Options) ([]*gabs.Container, *api.Paging, error) {
 	params := url.Values{}
-	if len(options.Args) > 0 {
-		params.Add("filter", options.Args[0])
+	if err := addFilterParam(params, entityType, options); err != nil {
+		return nil, nil, err
 	}
 
 	return ListEntitiesOfType(entityType, params, options.OutputJSONResponse, options.Out, options.Timeout, options.Verbose)
@@ -357,8 +375,8 @@ func filterSubEntitiesOfType(entityType, subType, entityId, filter string, o *ap
 
 func runListEdgeRouters(roleFilters []string, roleSemantic string, options *api.Options) error {
 	params := url.Values{}
-	if len(options.Args) > 0 {
-		params.Add("filter", options.Args[0])
+	if err := addFilterParam(params, "edge-routers", options); err != nil {
+		return err
 	}
 	for _, roleFilter := range roleFilters {
 		params.Add("roleFilter", roleFilter)
@@ -381,19 +399,19 @@ func outputEdgeRouters(o *api.Options, children []*gabs.Container, pagingInfo *a
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Online", "Allow Transit", "Cost", "Attributes"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Online", "Allow Transit", "Cost", "Attributes"}))
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			wrapper.Bool("isOnline"),
 			!wrapper.Bool("noTraversal"),
 			wrapper.Float64("cost"),
-			strings.Join(wrapper.StringSlice("roleAttributes"), "\n")})
+			strings.Join(wrapper.StringSlice("roleAttributes"), "\n")}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -412,7 +430,7 @@ func outputEdgeRouterPolicies(o *api.Options, children []*gabs.Container, paging
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Edge Router Roles", "Identity Roles"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Edge Router Roles", "Identity Roles"}))
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
@@ -426,14 +444,14 @@ func outputEdgeRouterPolicies(o *api.Options, children []*gabs.Container, paging
 			return err
 		}
 
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			strings.Join(edgeRouterRoles, " "),
 			strings.Join(identityRoles, " "),
-		})
+		}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -474,7 +492,7 @@ func outputAuthenticators(o *api.Options, children []*gabs.Container, pagingInfo
 
 		t.AppendRow(table.Row{id, method, identityId, identityName, printOrName, caId})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -506,7 +524,7 @@ func outputEnrollments(o *api.Options, children []*gabs.Container, pagingInfo *a
 
 		t.AppendRow(table.Row{id, method, identityId, identityName, expiresAt, token, jwt})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -540,14 +558,14 @@ func outputTerminators(o *api.Options, children []*gabs.Container, pagingInfo *a
 
 		t.AppendRow(table.Row{id, service, router, binding, address, identity, staticCost, precedence, dynamicCost})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
 func runListServices(asIdentity string, configTypes []string, roleFilters []string, roleSemantic string, options *api.Options) error {
 	params := url.Values{}
-	if len(options.Args) > 0 {
-		params.Add("filter", options.Args[0])
+	if err := addFilterParam(params, "services", options); err != nil {
+		return err
 	}
 	if asIdentity != "" {
 		params.Add("asIdentity", asIdentity)
@@ -584,21 +602,21 @@ func outputServices(o *api.Options, children []*gabs.Container, pagingInfo *api.
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Encryption Required", "Terminator Strategy", "Attributes"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Encryption Required", "Terminator Strategy", "Attributes"}))
 	t.SetColumnConfigs([]table.ColumnConfig{
 		{Number: 3, WidthMax: 10},
 	})
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			wrapper.Bool("encryptionRequired"),
 			wrapper.String("terminatorStrategy"),
-			strings.Join(wrapper.StringSlice("roleAttributes"), "\n")})
+			strings.Join(wrapper.StringSlice("roleAttributes"), "\n")}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -619,7 +637,7 @@ func outputServiceConfigs(o *api.Options, children []*gabs.Container, pagingInfo
 			wrapper.String("config.name"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -638,7 +656,7 @@ func outputServiceEdgeRouterPolicies(o *api.Options, children []*gabs.Container,
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Service Roles", "Edge Router Roles"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Service Roles", "Edge Router Roles"}))
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
@@ -652,14 +670,14 @@ func outputServiceEdgeRouterPolicies(o *api.Options, children []*gabs.Container,
 			return err
 		}
 
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			strings.Join(serviceRoles, " "),
 			strings.Join(edgeRouterRoles, " "),
-		})
+		}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -678,7 +696,7 @@ func outputServicePolicies(o *api.Options, children []*gabs.Container, pagingInf
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Semantic", "Service Roles", "Identity Roles", "Posture Check Roles"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Semantic", "Service Roles", "Identity Roles", "Posture Check Roles"}))
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
@@ -698,16 +716,16 @@ func outputServicePolicies(o *api.Options, children []*gabs.Container, pagingInf
 			return err
 		}
 
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			wrapper.String("semantic"),
 			strings.Join(serviceRoles, " "),
 			strings.Join(identityRoles, " "),
 			strings.Join(postureCheckRoles, " "),
-		})
+		}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 	return nil
 }
 
@@ -748,10 +766,10 @@ func mapRoleIdsToNames(c *gabs.Container, path string) ([]string, error) {
 }
 
 // runListIdentities implements the command to list identities
-func runListIdentities(roleFilters []string, roleSemantic string, options *api.Options) error {
+func runListIdentities(roleFilters []string, roleSemantic string, staleOptions *staleIdentityOptions, expiryOptions *certExpiryOptions, options *api.Options) error {
 	params := url.Values{}
-	if len(options.Args) > 0 {
-		params.Add("filter", options.Args[0])
+	if err := addFilterParam(params, "identities", options); err != nil {
+		return err
 	}
 	for _, roleFilter := range roleFilters {
 		params.Add("roleFilter", roleFilter)
@@ -759,6 +777,15 @@ func runListIdentities(roleFilters []string, roleSemantic string, options *api.O
 	if roleSemantic != "" {
 		params.Add("roleSemantic", roleSemantic)
 	}
+	if staleOptions.enabled() && expiryOptions.enabled() {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--stale, --last-seen-before and --disable may not be combined with --cert-expiry or --expiring-within")
+	}
+	if staleOptions.enabled() {
+		return runListStaleIdentities(params, staleOptions, options)
+	}
+	if expiryOptions.enabled() {
+		return runListIdentitiesCertExpiry(params, expiryOptions, options)
+	}
 	children, pagingInfo, err := ListEntitiesOfType("identities", params, options.OutputJSONResponse, options.Out, options.Timeout, options.Verbose)
 	if err != nil {
 		return err
@@ -774,17 +801,17 @@ func outputIdentities(o *api.Options, children []*gabs.Container, pagingInfo *ap
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Type", "Attributes"})
+	t.AppendHeader(withNotesHeader(o, table.Row{"ID", "Name", "Type", "Attributes"}))
 
 	for _, entity := range children {
 		wrapper := api.Wrap(entity)
-		t.AppendRow(table.Row{
+		t.AppendRow(withNotes(o, table.Row{
 			wrapper.String("id"),
 			wrapper.String("name"),
 			wrapper.String("type.name"),
-			strings.Join(wrapper.StringSlice("roleAttributes"), ",")})
+			strings.Join(wrapper.StringSlice("roleAttributes"), ",")}, entity))
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1059,8 +1086,16 @@ func runListCAs(o *api.Options) error {
 
 	var filter *string = nil
 
-	if len(o.Args) > 0 {
-		filter = &o.Args[0]
+	sorted, err := o.SortFilter(stringz.OrEmpty(o.GetFilter()))
+	if err != nil {
+		return err
+	}
+	if sorted != "" {
+		expanded, err := util.ExpandFilterTimes(sorted, time.Now())
+		if err != nil {
+			return err
+		}
+		filter = &expanded
 	}
 
 	context, cancelContext := o.TimeoutContext()
@@ -1161,7 +1196,7 @@ func runListConfigTypes(o *api.Options) error {
 			wrapper.String("name"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1191,7 +1226,7 @@ func outputConfigs(o *api.Options, children []*gabs.Container, pagingInfo *api.P
 			wrapper.String("configType.name"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1218,7 +1253,7 @@ func runListApiSessions(o *api.Options) error {
 			wrapper.String("identity.name"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1247,7 +1282,7 @@ func runListSessions(o *api.Options) error {
 			wrapper.String("type"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1274,7 +1309,7 @@ func runListTransitRouters(o *api.Options) error {
 			wrapper.String("name"),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
@@ -1415,7 +1450,7 @@ func runListPostureCheckTypes(o *api.Options) error {
 			strings.Join(osInfo, ","),
 		})
 	}
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return err
 }
@@ -0,0 +1,409 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// newListExtJwtSignersCmd creates the list command for external JWT signers
+func newListExtJwtSignersCmd(options *api.Options) *cobra.Command {
+	var verify bool
+
+	cmd := &cobra.Command{
+		Use:     "external-jwt-signers <filter>?",
+		Short:   "lists external JWT signers managed by the Ziti Edge Controller",
+		Long:    "lists external JWT signers managed by the Ziti Edge Controller. With --verify, each signer's keys, issuer metadata and auth policy usage is checked and any problems are reported",
+		Args:    cobra.MaximumNArgs(1),
+		Aliases: []string{"ext-jwt-signers"},
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := runListExtJwtSigners(verify, options)
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	cmd.Flags().BoolVar(&verify, "verify", false, "Check signer keys, JWKS endpoints, issuer metadata and auth policy consistency")
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func runListExtJwtSigners(verify bool, options *api.Options) error {
+	if !verify {
+		children, pagingInfo, err := listEntitiesWithOptions("external-jwt-signers", options)
+		if err != nil {
+			return err
+		}
+		return outputExtJwtSigners(options, children, pagingInfo)
+	}
+
+	// the raw response isn't output, as the verification results are output along with the signers
+	params := url.Values{}
+	if err := addFilterParam(params, "external-jwt-signers", options); err != nil {
+		return err
+	}
+	children, pagingInfo, err := ListEntitiesOfType("external-jwt-signers", params, false, options.Out, options.Timeout, options.Verbose)
+	if err != nil {
+		return err
+	}
+
+	policies, _, err := filterEntitiesOfType("auth-policies", "true limit none", false, nil, options.Timeout, options.Verbose)
+	if err != nil {
+		return err
+	}
+
+	verifier := &extJwtSignerVerifier{
+		client:   &http.Client{Timeout: time.Duration(options.Timeout) * time.Second},
+		policies: policies,
+	}
+
+	problemCount := 0
+	problems := map[string][]string{}
+	for _, entity := range children {
+		id, _ := entity.Path("id").Data().(string)
+		problems[id] = verifier.verify(entity)
+		if len(problems[id]) > 0 {
+			problemCount++
+		}
+	}
+
+	if options.OutputJSONResponse {
+		outputVerifiedExtJwtSignersJson(options, children, problems)
+	} else {
+		outputVerifiedExtJwtSigners(options, children, problems, pagingInfo)
+	}
+
+	if problemCount > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v external JWT signer(s) failed verification", problemCount)
+	}
+	return nil
+}
+
+// outputVerifiedExtJwtSignersJson outputs the signers with the problems found for each, an empty list if there are none
+func outputVerifiedExtJwtSignersJson(options *api.Options, children []*gabs.Container, problems map[string][]string) {
+	data := []interface{}{}
+	for _, entity := range children {
+		id, _ := entity.Path("id").Data().(string)
+		signerProblems := append([]string{}, problems[id]...)
+		api.SetJSONValue(entity, signerProblems, "problems")
+		data = append(data, entity.Data())
+	}
+	result := gabs.New()
+	api.SetJSONValue(result, data, "data")
+	options.Printf("%v\n", result.StringIndent("", "  "))
+}
+
+func outputVerifiedExtJwtSigners(options *api.Options, children []*gabs.Container, problems map[string][]string, pagingInfo *api.Paging) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Enabled", "Issuer", "Audience", "Problems"})
+
+	for _, entity := range children {
+		id, _ := entity.Path("id").Data().(string)
+		status := "OK"
+		if len(problems[id]) > 0 {
+			status = strings.Join(problems[id], "\n")
+		}
+		t.AppendRow(table.Row{
+			id,
+			entity.Path("name").Data(),
+			entity.Path("enabled").Data(),
+			extJwtSignerString(entity, "issuer"),
+			extJwtSignerString(entity, "audience"),
+			status,
+		})
+	}
+
+	api.RenderTable(options, t, pagingInfo)
+}
+
+func outputExtJwtSigners(options *api.Options, children []*gabs.Container, pagingInfo *api.Paging) error {
+	if options.OutputJSONResponse {
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Enabled", "Issuer", "Audience", "Key Source", "Kid"})
+
+	for _, entity := range children {
+		keySource := "certificate"
+		if jwksEndpoint := extJwtSignerString(entity, "jwksEndpoint"); jwksEndpoint != "" {
+			keySource = jwksEndpoint
+		}
+
+		t.AppendRow(table.Row{
+			entity.Path("id").Data(),
+			entity.Path("name").Data(),
+			entity.Path("enabled").Data(),
+			extJwtSignerString(entity, "issuer"),
+			extJwtSignerString(entity, "audience"),
+			keySource,
+			extJwtSignerString(entity, "kid"),
+		})
+	}
+
+	api.RenderTable(options, t, pagingInfo)
+	return nil
+}
+
+func extJwtSignerString(entity *gabs.Container, path string) string {
+	if val, ok := entity.Path(path).Data().(string); ok {
+		return val
+	}
+	return ""
+}
+
+type extJwtSignerVerifier struct {
+	client   *http.Client
+	policies []*gabs.Container
+}
+
+// verify checks a single signer and returns a description of each problem found
+func (self *extJwtSignerVerifier) verify(signer *gabs.Container) []string {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	id := extJwtSignerString(signer, "id")
+	enabled, _ := signer.Path("enabled").Data().(bool)
+	issuer := extJwtSignerString(signer, "issuer")
+	audience := extJwtSignerString(signer, "audience")
+	kid := extJwtSignerString(signer, "kid")
+	certPem := extJwtSignerString(signer, "certPem")
+	jwksEndpoint := extJwtSignerString(signer, "jwksEndpoint")
+
+	if issuer == "" {
+		addProblem("no issuer set, tokens can't be matched to this signer")
+	}
+
+	if audience == "" {
+		addProblem("no audience set")
+	}
+
+	if certPem == "" && jwksEndpoint == "" {
+		addProblem("neither a certificate nor a JWKS endpoint is set")
+	}
+
+	if certPem != "" {
+		if err := verifyExtJwtSignerCert(certPem); err != nil {
+			addProblem("certificate: %v", err)
+		}
+	}
+
+	if jwksEndpoint != "" {
+		if err := self.verifyJwks(jwksEndpoint, kid); err != nil {
+			addProblem("jwks endpoint %v: %v", jwksEndpoint, err)
+		}
+	}
+
+	if strings.HasPrefix(issuer, "https://") || strings.HasPrefix(issuer, "http://") {
+		if err := self.verifyIssuerMetadata(issuer, jwksEndpoint); err != nil {
+			addProblem("issuer metadata: %v", err)
+		}
+	}
+
+	if externalAuthUrl := extJwtSignerString(signer, "externalAuthUrl"); externalAuthUrl != "" {
+		if err := self.checkReachable(externalAuthUrl); err != nil {
+			addProblem("external auth url %v: %v", externalAuthUrl, err)
+		}
+	}
+
+	primaryPolicies, secondaryPolicies := self.getReferencingPolicies(id)
+	if !enabled && len(primaryPolicies)+len(secondaryPolicies) > 0 {
+		addProblem("signer is disabled but is used by auth policies: %v", strings.Join(append(primaryPolicies, secondaryPolicies...), ", "))
+	}
+	if enabled && len(primaryPolicies)+len(secondaryPolicies) == 0 {
+		addProblem("signer is enabled but not allowed by any auth policy")
+	}
+
+	return problems
+}
+
+// getReferencingPolicies returns the names of auth policies allowing the signer for primary auth and requiring it for secondary auth
+func (self *extJwtSignerVerifier) getReferencingPolicies(signerId string) ([]string, []string) {
+	var primary, secondary []string
+	for _, policy := range self.policies {
+		name := extJwtSignerString(policy, "name")
+		allowed, _ := policy.Path("primary.extJwt.allowed").Data().(bool)
+		if allowed {
+			signers, _ := policy.Path("primary.extJwt.allowedSigners").Children()
+			// an empty signer list means all signers are allowed
+			if len(signers) == 0 {
+				primary = append(primary, name)
+			}
+			for _, signer := range signers {
+				if signer.Data() == signerId {
+					primary = append(primary, name)
+				}
+			}
+		}
+		if policy.Path("secondary.requireExtJwtSigner").Data() == signerId {
+			secondary = append(secondary, name)
+		}
+	}
+	return primary, secondary
+}
+
+func verifyExtJwtSignerCert(certPem string) error {
+	block, _ := pem.Decode([]byte(certPem))
+	if block == nil {
+		return errors.New("unable to decode PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse")
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) {
+		return errors.Errorf("not valid until %v", cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return errors.Errorf("expired at %v", cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (self *extJwtSignerVerifier) getJson(url string) (*gabs.Container, error) {
+	resp, err := self.client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "unreachable")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gabs.ParseJSON(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid JSON")
+	}
+	return result, nil
+}
+
+func (self *extJwtSignerVerifier) verifyJwks(url string, kid string) error {
+	jwks, err := self.getJson(url)
+	if err != nil {
+		return err
+	}
+
+	keys, err := jwks.Path("keys").Children()
+	if err != nil || len(keys) == 0 {
+		return errors.New("no keys found")
+	}
+
+	kidFound := false
+	for _, key := range keys {
+		keyId := extJwtSignerString(key, "kid")
+		if err = verifyJwk(key); err != nil {
+			return errors.Wrapf(err, "invalid key '%v'", keyId)
+		}
+		if keyId == kid {
+			kidFound = true
+		}
+	}
+
+	if kid != "" && !kidFound {
+		return errors.Errorf("no key with kid '%v' found", kid)
+	}
+	return nil
+}
+
+func verifyJwk(key *gabs.Container) error {
+	var required []string
+	switch kty := extJwtSignerString(key, "kty"); kty {
+	case "RSA":
+		required = []string{"n", "e"}
+	case "EC":
+		required = []string{"crv", "x", "y"}
+	case "OKP":
+		required = []string{"crv", "x"}
+	default:
+		return errors.Errorf("unsupported key type '%v'", kty)
+	}
+
+	for _, field := range required {
+		val := extJwtSignerString(key, field)
+		if val == "" {
+			return errors.Errorf("missing '%v'", field)
+		}
+		if field == "crv" {
+			continue
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(val); err != nil {
+			return errors.Errorf("'%v' is not valid base64url", field)
+		}
+	}
+	return nil
+}
+
+func (self *extJwtSignerVerifier) verifyIssuerMetadata(issuer, jwksEndpoint string) error {
+	metadata, err := self.getJson(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		// not all issuers publish discovery metadata, only report if it's present and inconsistent
+		return nil
+	}
+
+	if metadataIssuer := extJwtSignerString(metadata, "issuer"); metadataIssuer != issuer {
+		return errors.Errorf("issuer publishes '%v', signer expects '%v'", metadataIssuer, issuer)
+	}
+
+	if jwksUri := extJwtSignerString(metadata, "jwks_uri"); jwksEndpoint != "" && jwksUri != "" && jwksUri != jwksEndpoint {
+		return errors.Errorf("issuer publishes jwks_uri '%v', signer uses '%v'", jwksUri, jwksEndpoint)
+	}
+	return nil
+}
+
+func (self *extJwtSignerVerifier) checkReachable(url string) error {
+	resp, err := self.client.Get(url)
+	if err != nil {
+		return errors.Wrap(err, "unreachable")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package edge
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyExtJwtSignersChecksEveryAuthPolicy(t *testing.T) {
+	req := require.New(t)
+
+	cert, _ := newTestCaCert(t, nil)
+	certPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	// more policies than fit in a page, with the only one allowing the signer last
+	var policies []map[string]interface{}
+	for i := 1; i <= 12; i++ {
+		policy := map[string]interface{}{"id": fmt.Sprintf("policy-%02d", i), "name": fmt.Sprintf("policy %v", i)}
+		if i == 12 {
+			policy["primary"] = map[string]interface{}{"extJwt": map[string]interface{}{"allowed": true, "allowedSigners": []string{"signer"}}}
+		}
+		policies = append(policies, policy)
+	}
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"auth-policies": policies,
+		"external-jwt-signers": {{
+			"id": "signer", "name": "partner", "enabled": true, "issuer": "partner", "audience": "ziti", "certPem": certPem,
+		}},
+	})
+
+	out := &bytes.Buffer{}
+	req.NoError(runListExtJwtSigners(true, newTestListOptions(out)))
+	req.Contains(out.String(), "OK")
+	req.Contains(testController.Requested(), "GET auth-policies?true limit none")
+}
+
+func TestVerifyExtJwtSignersJsonReportsProblems(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"external-jwt-signers": {{"id": "signer", "name": "partner", "enabled": true}},
+	})
+
+	out := &bytes.Buffer{}
+	options := newTestListOptions(out)
+	options.OutputJSONResponse = true
+	err := runListExtJwtSigners(true, options)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+
+	result := map[string][]map[string]interface{}{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result), out.String())
+	req.Len(result["data"], 1)
+	req.Equal("signer", result["data"][0]["id"])
+	req.Contains(result["data"][0]["problems"], "no issuer set, tokens can't be matched to this signer")
+}
@@ -0,0 +1,179 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+type certExpiryOptions struct {
+	certExpiry     bool
+	expiringWithin string
+}
+
+func (self *certExpiryOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&self.certExpiry, "cert-expiry", false, "Show when the client certificate of each identity expires, where the controller exposes it")
+	cmd.Flags().StringVar(&self.expiringWithin, "expiring-within", "", "Only list identities whose client certificate expires within this age, e.g. 30d, 2w or 12h, including those already expired. Implies --cert-expiry")
+}
+
+func (self *certExpiryOptions) enabled() bool {
+	return self.certExpiry || self.expiringWithin != ""
+}
+
+type identityCertExpiry struct {
+	entity    *gabs.Container
+	expiresAt *time.Time
+}
+
+// runListIdentitiesCertExpiry lists the identities matching the given params along with when their client
+// certificates expire, read from their cert authenticators. Identities without a cert authenticator, or whose
+// authenticator doesn't expose the certificate, are reported as unknown, and left out when filtering by expiry
+func runListIdentitiesCertExpiry(params url.Values, expiryOptions *certExpiryOptions, options *api.Options) error {
+	var cutoff *time.Time
+	if expiryOptions.expiringWithin != "" {
+		age, err := api.ParseAge(expiryOptions.expiringWithin)
+		if err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, err)
+		}
+		t := time.Now().Add(age)
+		cutoff = &t
+	}
+
+	children, pagingInfo, err := ListEntitiesOfType("identities", params, false, options.Out, options.Timeout, options.Verbose)
+	if err != nil {
+		return err
+	}
+
+	expiries, err := getIdentityCertExpiries(children, options)
+	if err != nil {
+		return err
+	}
+
+	var result []*identityCertExpiry
+	for _, entity := range children {
+		expiresAt := expiries[api.Wrap(entity).String("id")]
+		if cutoff != nil && (expiresAt == nil || expiresAt.After(*cutoff)) {
+			continue
+		}
+		result = append(result, &identityCertExpiry{entity: entity, expiresAt: expiresAt})
+	}
+
+	return outputIdentitiesCertExpiry(options, result, pagingInfo)
+}
+
+// getIdentityCertExpiries returns when the client certificate of each of the given identities expires, by identity
+// id. Where an identity has several cert authenticators, the latest expiry is used
+func getIdentityCertExpiries(identities []*gabs.Container, options *api.Options) (map[string]*time.Time, error) {
+	result := map[string]*time.Time{}
+	if len(identities) == 0 {
+		return result, nil
+	}
+
+	var ids []string
+	for _, entity := range identities {
+		ids = append(ids, api.QuoteFilterString(api.Wrap(entity).String("id")))
+	}
+
+	filter := fmt.Sprintf(`method = "cert" and identity in [%v] limit none`, strings.Join(ids, ","))
+	authenticators, _, err := filterEntitiesOfType("authenticators", filter, false, options.Out, options.Timeout, options.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authenticator := range authenticators {
+		wrapper := api.Wrap(authenticator)
+		expiresAt := certPemExpiry(wrapper.String("certPem"))
+		if expiresAt == nil {
+			continue
+		}
+		identityId := wrapper.String("identityId")
+		if current := result[identityId]; current == nil || expiresAt.After(*current) {
+			result[identityId] = expiresAt
+		}
+	}
+
+	return result, nil
+}
+
+// certPemExpiry returns the expiry of the first certificate in the PEM, or nil if there is none
+func certPemExpiry(certPem string) *time.Time {
+	block, _ := pem.Decode([]byte(certPem))
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return &cert.NotAfter
+}
+
+func outputIdentitiesCertExpiry(o *api.Options, identities []*identityCertExpiry, pagingInfo *api.Paging) error {
+	if o.OutputJSONResponse {
+		var data []interface{}
+		for _, identity := range identities {
+			if identity.expiresAt != nil {
+				api.SetJSONValue(identity.entity, identity.expiresAt.UTC().Format(time.RFC3339), "certExpiresAt")
+			}
+			data = append(data, identity.entity.Data())
+		}
+		result := gabs.New()
+		api.SetJSONValue(result, data, "data")
+		o.Printf("%v\n", result.StringIndent("", "  "))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Type", "Attributes", "Cert Expires", "Expires In"})
+
+	now := time.Now()
+	for _, identity := range identities {
+		wrapper := api.Wrap(identity.entity)
+		expires, expiresIn := "unknown", ""
+		if identity.expiresAt != nil {
+			expires = identity.expiresAt.Local().Format(time.RFC3339)
+			if remaining := identity.expiresAt.Sub(now); remaining > 0 {
+				expiresIn = fmt.Sprintf("%vd", int(remaining.Hours()/24))
+			} else {
+				expiresIn = "expired"
+			}
+		}
+		t.AppendRow(table.Row{
+			wrapper.String("id"),
+			wrapper.String("name"),
+			wrapper.String("type.name"),
+			strings.Join(wrapper.StringSlice("roleAttributes"), ","),
+			expires,
+			expiresIn,
+		})
+	}
+	api.RenderTable(o, t, pagingInfo)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package edge
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertPem(t *testing.T, notAfter time.Time) string {
+	cert, _ := newTestCaCert(t, func(template *x509.Certificate) {
+		template.NotAfter = notAfter
+	})
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func TestCertPemExpiry(t *testing.T) {
+	req := require.New(t)
+
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+	expiresAt := certPemExpiry(newTestCertPem(t, notAfter))
+	req.NotNil(expiresAt)
+	req.True(notAfter.Equal(*expiresAt))
+
+	req.Nil(certPemExpiry(""))
+	req.Nil(certPemExpiry(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a cert")}))))
+}
+
+func TestListIdentitiesCertExpiry(t *testing.T) {
+	req := require.New(t)
+
+	now := time.Now().Truncate(time.Second).UTC()
+	days := func(n int) time.Time {
+		return now.Add(time.Duration(n) * 24 * time.Hour)
+	}
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"identities": {
+			{"id": "id1", "name": "expired"},
+			{"id": "id2", "name": "soon"},
+			{"id": "id3", "name": "later"},
+			{"id": "id4", "name": "renewed"},
+			{"id": `id"5`, "name": "no-cert"},
+		},
+		"authenticators": {
+			{"id": "a1", "method": "cert", "identityId": "id1", "certPem": newTestCertPem(t, days(-2))},
+			{"id": "a2", "method": "cert", "identityId": "id2", "certPem": newTestCertPem(t, days(10))},
+			{"id": "a3", "method": "cert", "identityId": "id3", "certPem": newTestCertPem(t, days(90))},
+			{"id": "a4", "method": "cert", "identityId": "id4", "certPem": newTestCertPem(t, days(5))},
+			{"id": "a5", "method": "cert", "identityId": "id4", "certPem": newTestCertPem(t, days(300))},
+			{"id": "a6", "method": "updb", "identityId": `id"5`},
+			{"id": "a7", "method": "cert", "identityId": `id"5`},
+		},
+	})
+	testController.Match = func(entityType, predicate string, entity map[string]interface{}) bool {
+		return entity["method"] == "cert" && strings.Contains(predicate, api.QuoteFilterString(fmt.Sprint(entity["identityId"])))
+	}
+
+	out := &bytes.Buffer{}
+	o := newTestListOptions(out)
+	o.OutputJSONResponse = true
+	req.NoError(runListIdentitiesCertExpiry(url.Values{}, &certExpiryOptions{certExpiry: true}, o))
+	req.Contains(testController.Requested(), `GET authenticators?method = "cert" and identity in ["id\"5","id1","id2","id3","id4"] limit none`)
+
+	result := struct {
+		Data []struct {
+			Id            string `json:"id"`
+			CertExpiresAt string `json:"certExpiresAt"`
+		} `json:"data"`
+	}{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	expiries := map[string]string{}
+	for _, identity := range result.Data {
+		expiries[identity.Id] = identity.CertExpiresAt
+	}
+	req.Equal(map[string]string{
+		`id"5`: "",
+		"id1":  days(-2).Format(time.RFC3339),
+		"id2":  days(10).Format(time.RFC3339),
+		"id3":  days(90).Format(time.RFC3339),
+		"id4":  days(300).Format(time.RFC3339),
+	}, expiries, "the latest expiry of several certs is used, and identities without a readable cert have none")
+
+	out.Reset()
+	o.OutputJSONResponse = false
+	req.NoError(runListIdentitiesCertExpiry(url.Values{}, &certExpiryOptions{expiringWithin: "30d"}, o))
+	table := out.String()
+	req.Regexp(`id1 .*expired`, table)
+	req.Regexp(`id2 .* 9d`, table)
+	req.NotContains(table, "id3", "certs expiring after the cutoff are left out")
+	req.NotContains(table, "id4", "renewed certs are left out")
+	req.NotContains(table, `id"5`, "unknown expiries are left out when filtering")
+
+	err := runListIdentitiesCertExpiry(url.Values{}, &certExpiryOptions{expiringWithin: "soon"}, o)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+}
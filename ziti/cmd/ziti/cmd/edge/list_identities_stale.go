@@ -0,0 +1,295 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+	"gopkg.in/resty.v1"
+)
+
+const defaultStaleAge = "30d"
+
+// postureDataTimestamps are the posture data fields which record when an identity last reported in
+var postureDataTimestamps = map[string]bool{
+	"lastUpdatedAt": true,
+	"passedAt":      true,
+	"wokenAt":       true,
+	"unlockedAt":    true,
+}
+
+type staleIdentityOptions struct {
+	stale          bool
+	lastSeenBefore string
+	disable        bool
+	disableMinutes int64
+	bulk           api.BulkOptions
+}
+
+func (self *staleIdentityOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&self.stale, "stale", false, "Only list identities not seen for "+defaultStaleAge+", or the age given by --last-seen-before")
+	cmd.Flags().StringVar(&self.lastSeenBefore, "last-seen-before", "", "Only list identities not seen within this age, e.g. 30d, 2w or 12h. Implies --stale")
+	cmd.Flags().BoolVar(&self.disable, "disable", false, "Disable the stale identities listed. Requires --stale or --last-seen-before")
+	cmd.Flags().Int64Var(&self.disableMinutes, "disable-minutes", 0, "How long to disable identities for when using --disable, 0 disables them until re-enabled")
+	self.bulk.AddBulkFlags(cmd, true)
+}
+
+func (self *staleIdentityOptions) enabled() bool {
+	return self.stale || self.lastSeenBefore != "" || self.disable
+}
+
+type identityActivity struct {
+	entity     *gabs.Container
+	lastSeenAt *time.Time
+}
+
+// runListStaleIdentities lists the identities matching the given params which have no API session or posture data
+// activity since the cutoff. Identities which have never been seen are only reported once they're older than the
+// cutoff, so freshly created identities aren't treated as abandoned
+func runListStaleIdentities(params url.Values, staleOptions *staleIdentityOptions, options *api.Options) error {
+	if staleOptions.disable && !staleOptions.stale && staleOptions.lastSeenBefore == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "--disable may only be used with --stale or --last-seen-before")
+	}
+
+	if staleOptions.disableMinutes < 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid --disable-minutes %v, must not be negative", staleOptions.disableMinutes)
+	}
+
+	ageVal := staleOptions.lastSeenBefore
+	if ageVal == "" {
+		ageVal = defaultStaleAge
+	}
+	age, err := api.ParseAge(ageVal)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, err)
+	}
+	cutoff := time.Now().Add(-age)
+
+	children, pagingInfo, err := ListEntitiesOfType("identities", params, false, options.Out, options.Timeout, options.Verbose)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, entity := range children {
+		ids = append(ids, api.Wrap(entity).String("id"))
+	}
+
+	lastSeen, err := getIdentitiesLastSeen(ids, cutoff, options)
+	if err != nil {
+		return err
+	}
+
+	stale := staleIdentities(children, lastSeen, cutoff)
+	if err = outputStaleIdentities(options, stale, pagingInfo); err != nil {
+		return err
+	}
+
+	if !staleOptions.disable {
+		return nil
+	}
+
+	return disableStaleIdentities(stale, staleOptions.disableMinutes, &staleOptions.bulk, options)
+}
+
+// staleIdentities returns the identities not seen since the cutoff. Identities which have never been seen are only
+// stale once they were created before the cutoff
+func staleIdentities(identities []*gabs.Container, lastSeen map[string]*time.Time, cutoff time.Time) []*identityActivity {
+	var result []*identityActivity
+	for _, entity := range identities {
+		wrapper := api.Wrap(entity)
+		lastSeenAt := lastSeen[wrapper.String("id")]
+
+		if lastSeenAt != nil {
+			if lastSeenAt.After(cutoff) {
+				continue
+			}
+		} else if createdAt, err := time.Parse(time.RFC3339Nano, wrapper.String("createdAt")); err == nil && createdAt.After(cutoff) {
+			continue
+		}
+
+		result = append(result, &identityActivity{entity: entity, lastSeenAt: lastSeenAt})
+	}
+	return result
+}
+
+// getIdentitiesLastSeen returns the most recent activity recorded for the API sessions and posture data of each of the
+// identities, leaving out identities with none. The API sessions of all identities are listed at once. Posture data
+// can only be read per identity, so it's only read for identities whose API sessions don't show them seen since the
+// cutoff
+func getIdentitiesLastSeen(ids []string, cutoff time.Time, options *api.Options) (map[string]*time.Time, error) {
+	result := map[string]*time.Time{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	update := func(id, val string) {
+		lastSeenAt := result[id]
+		if t, err := time.Parse(time.RFC3339Nano, val); err == nil && !t.IsZero() && (lastSeenAt == nil || t.After(*lastSeenAt)) {
+			result[id] = &t
+		}
+	}
+
+	var quoted []string
+	for _, id := range ids {
+		quoted = append(quoted, api.QuoteFilterString(id))
+	}
+	filter := fmt.Sprintf("identity in [%v] limit none", strings.Join(quoted, ","))
+	apiSessions, _, err := filterEntitiesOfType("api-sessions", filter, false, options.Out, options.Timeout, options.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	for _, apiSession := range apiSessions {
+		wrapper := api.Wrap(apiSession)
+		id := wrapper.String("identityId")
+		update(id, wrapper.String("lastActivityAt"))
+		update(id, wrapper.String("cachedLastActivityAt"))
+	}
+
+	for _, id := range ids {
+		if lastSeenAt := result[id]; lastSeenAt != nil && lastSeenAt.After(cutoff) {
+			continue
+		}
+
+		postureData, err := util.EdgeControllerRequest("identities/"+url.PathEscape(id)+"/posture-data", options.Out, false, options.Timeout, options.Verbose,
+			func(request *resty.Request, url string) (*resty.Response, error) {
+				return request.Get(url)
+			})
+		if err != nil {
+			return nil, err
+		}
+		if postureData != nil {
+			collectPostureDataTimestamps(postureData.S("data").Data(), func(val string) {
+				update(id, val)
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// collectPostureDataTimestamps walks the posture data, passing each timestamp which records identity activity to f
+func collectPostureDataTimestamps(val interface{}, f func(string)) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if s, ok := child.(string); ok && postureDataTimestamps[key] {
+				f(s)
+			} else {
+				collectPostureDataTimestamps(child, f)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			collectPostureDataTimestamps(child, f)
+		}
+	}
+}
+
+func outputStaleIdentities(o *api.Options, stale []*identityActivity, pagingInfo *api.Paging) error {
+	if o.OutputJSONResponse {
+		var data []interface{}
+		for _, identity := range stale {
+			if identity.lastSeenAt != nil {
+				api.SetJSONValue(identity.entity, identity.lastSeenAt.UTC().Format(time.RFC3339), "lastSeenAt")
+			}
+			data = append(data, identity.entity.Data())
+		}
+		result := gabs.New()
+		api.SetJSONValue(result, data, "data")
+		o.Printf("%v\n", result.StringIndent("", "  "))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Type", "Attributes", "Last Seen", "Disabled"})
+
+	for _, identity := range stale {
+		wrapper := api.Wrap(identity.entity)
+		lastSeen := "never"
+		if identity.lastSeenAt != nil {
+			lastSeen = identity.lastSeenAt.Local().Format(time.RFC3339)
+		}
+		t.AppendRow(table.Row{
+			wrapper.String("id"),
+			wrapper.String("name"),
+			wrapper.String("type.name"),
+			strings.Join(wrapper.StringSlice("roleAttributes"), ","),
+			lastSeen,
+			wrapper.Bool("disabled"),
+		})
+	}
+	api.RenderTable(o, t, pagingInfo)
+
+	return nil
+}
+
+// disableStaleIdentities disables the given identities, skipping the default admin and those already disabled
+func disableStaleIdentities(stale []*identityActivity, minutes int64, bulk *api.BulkOptions, options *api.Options) error {
+	body := fmt.Sprintf(`{"durationMinutes": %d}`, minutes)
+
+	run, err := bulk.StartBulk("disable stale identities")
+	if err != nil {
+		return err
+	}
+
+	disabled := 0
+	for _, identity := range stale {
+		wrapper := api.Wrap(identity.entity)
+		id := wrapper.String("id")
+		name := wrapper.String("name")
+
+		if !run.Include(id) {
+			continue
+		}
+		if run.Stopped() {
+			run.Skipped(id, name)
+			continue
+		}
+
+		if wrapper.Bool("isDefaultAdmin") {
+			options.Printf("skipping default admin identity %v\n", name)
+			continue
+		}
+
+		if wrapper.Bool("disabled") {
+			continue
+		}
+
+		if _, err := postEntityOfType("identities/"+id+"/disable", body, options); err != nil {
+			options.Printf("unable to disable identity %v: %v\n", name, err)
+			run.Failed(id, name, err)
+			continue
+		}
+		run.Succeeded()
+		disabled++
+	}
+
+	options.Printf("disabled %v identities\n", disabled)
+
+	return run.Finish()
+}
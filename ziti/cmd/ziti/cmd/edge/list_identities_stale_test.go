@@ -0,0 +1,124 @@
+package edge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleIdentities(t *testing.T) {
+	req := require.New(t)
+
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	ago := func(days int) *time.Time {
+		result := now.Add(-time.Duration(days) * 24 * time.Hour)
+		return &result
+	}
+
+	identity := func(id string, createdDaysAgo int) *gabs.Container {
+		entity := gabs.New()
+		_, _ = entity.Set(id, "id")
+		_, _ = entity.Set(ago(createdDaysAgo).UTC().Format(time.RFC3339Nano), "createdAt")
+		return entity
+	}
+
+	identities := []*gabs.Container{
+		identity("seen-recently", 90),
+		identity("seen-long-ago", 90),
+		identity("never-seen-old", 90),
+		identity("never-seen-new", 1),
+		identity("seen-at-cutoff", 90),
+	}
+	lastSeen := map[string]*time.Time{
+		"seen-recently":  ago(1),
+		"seen-long-ago":  ago(40),
+		"seen-at-cutoff": &cutoff,
+	}
+
+	var stale []string
+	for _, identity := range staleIdentities(identities, lastSeen, cutoff) {
+		stale = append(stale, identity.entity.S("id").Data().(string))
+		req.Equal(lastSeen[stale[len(stale)-1]], identity.lastSeenAt)
+	}
+	req.Equal([]string{"seen-long-ago", "never-seen-old", "seen-at-cutoff"}, stale)
+}
+
+func TestListStaleIdentities(t *testing.T) {
+	req := require.New(t)
+
+	now := time.Now().UTC()
+	ago := func(days int) string {
+		return now.Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339)
+	}
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"identities": {
+			{"id": "id1", "name": "active", "createdAt": ago(90)},
+			{"id": "id2", "name": "posture", "createdAt": ago(90)},
+			{"id": "id3", "name": "idle", "createdAt": ago(90)},
+			{"id": "id4", "name": "never", "createdAt": ago(90)},
+			{"id": "id5", "name": "new", "createdAt": ago(1)},
+			{"id": `id"6`, "name": "quoted", "createdAt": ago(90), "disabled": true},
+		},
+		"api-sessions": {
+			{"id": "as1", "identityId": "id1", "identity": map[string]interface{}{"id": "id1"}, "lastActivityAt": ago(1)},
+			{"id": "as2", "identityId": "id2", "identity": map[string]interface{}{"id": "id2"}, "lastActivityAt": ago(60)},
+			{"id": "as3", "identityId": "id3", "identity": map[string]interface{}{"id": "id3"}, "lastActivityAt": ago(60), "cachedLastActivityAt": ago(40)},
+			{"id": "as4", "identityId": "other", "identity": map[string]interface{}{"id": "other"}, "lastActivityAt": ago(1)},
+		},
+	})
+	testController.Details["identities/id2/posture-data"] = map[string]interface{}{
+		"mac":                   map[string]interface{}{"lastUpdatedAt": ago(2)},
+		"apiSessionPostureData": map[string]interface{}{"as2": map[string]interface{}{"endpointState": map[string]interface{}{"unlockedAt": ago(50)}}},
+	}
+
+	out := &bytes.Buffer{}
+	o := newTestListOptions(out)
+	o.OutputJSONResponse = true
+	req.NoError(runListStaleIdentities(url.Values{}, &staleIdentityOptions{stale: true}, o))
+
+	requested := testController.Requested()
+	req.Contains(requested, `GET api-sessions?identity in ["id\"6","id1","id2","id3","id4","id5"] limit none`)
+	for _, path := range []string{"identities/id2/posture-data", "identities/id3/posture-data", `identities/id"6/posture-data`} {
+		req.Contains(requested, "GET "+path)
+	}
+	req.NotContains(requested, "GET identities/id1/posture-data", "posture data isn't needed for identities seen recently")
+
+	result := struct {
+		Data []struct {
+			Id         string `json:"id"`
+			LastSeenAt string `json:"lastSeenAt"`
+		} `json:"data"`
+	}{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	req.Len(result.Data, 3)
+	req.Equal(`id"6`, result.Data[0].Id)
+	req.Equal("id3", result.Data[1].Id)
+	req.Equal(ago(40), result.Data[1].LastSeenAt)
+	req.Equal("id4", result.Data[2].Id)
+	req.Empty(result.Data[2].LastSeenAt)
+
+	out.Reset()
+	o.OutputJSONResponse = false
+	req.NoError(runListStaleIdentities(url.Values{}, &staleIdentityOptions{lastSeenBefore: "30d", disable: true}, o))
+	requested = testController.Requested()
+	req.Contains(requested, "POST identities/id3/disable")
+	req.Contains(requested, "POST identities/id4/disable")
+	req.NotContains(requested, `POST identities/id"6/disable`, "disabled identities are skipped")
+	req.Contains(out.String(), "disabled 2 identities")
+
+	err := runListStaleIdentities(url.Values{}, &staleIdentityOptions{disable: true}, o)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+
+	err = runListStaleIdentities(url.Values{}, &staleIdentityOptions{lastSeenBefore: "soon"}, o)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+}
@@ -0,0 +1,205 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+// policyTargetOptions restricts a policy listing to the policies affecting a given identity or edge router. Policies
+// are matched on the client side against the roles of the identity or edge router, as the policy list endpoints can't
+// filter on them
+type policyTargetOptions struct {
+	identity string
+	router   string
+}
+
+// policyTarget is an identity or edge router, and the policy role field which may select it
+type policyTarget struct {
+	roleField      string
+	id             string
+	roleAttributes map[string]bool
+}
+
+func (self *policyTargetOptions) addIdentityFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&self.identity, "identity", "", "Only list policies whose identity roles select this identity, given by name or id")
+}
+
+func (self *policyTargetOptions) addRouterFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&self.router, "router", "", "Only list policies whose edge router roles select this edge router, given by name or id")
+}
+
+func (self *policyTargetOptions) enabled() bool {
+	return self.identity != "" || self.router != ""
+}
+
+// targets looks up the identity and edge router being filtered on
+func (self *policyTargetOptions) targets(o *api.Options) ([]*policyTarget, error) {
+	var result []*policyTarget
+	if self.identity != "" {
+		target, err := lookupPolicyTarget("identities", "identityRoles", self.identity, o)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, target)
+	}
+	if self.router != "" {
+		target, err := lookupPolicyTarget("edge-routers", "edgeRouterRoles", self.router, o)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, target)
+	}
+	return result, nil
+}
+
+func lookupPolicyTarget(entityType, roleField, nameOrId string, o *api.Options) (*policyTarget, error) {
+	quoted := api.QuoteFilterString(nameOrId)
+	filter := fmt.Sprintf(`id = %v or name = %v`, quoted, quoted)
+	list, _, err := filterEntitiesOfType(entityType, filter, false, nil, o.Timeout, o.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) < 1 {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no %v found with id or name %v", entityType, nameOrId)
+	}
+	if len(list) > 1 {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "multiple %v found for name %v, please use id instead", entityType, nameOrId)
+	}
+
+	wrapper := api.Wrap(list[0])
+	target := &policyTarget{
+		roleField:      roleField,
+		id:             wrapper.String("id"),
+		roleAttributes: map[string]bool{},
+	}
+	for _, attr := range wrapper.StringSlice("roleAttributes") {
+		target.roleAttributes[attr] = true
+	}
+	return target, nil
+}
+
+// selectedBy returns true if the policy's roles for the target select it, following the policy's semantic
+func (self *policyTarget) selectedBy(policy *gabs.Container) bool {
+	wrapper := api.Wrap(policy)
+	roles := wrapper.StringSlice(self.roleField)
+	if len(roles) == 0 {
+		return false
+	}
+
+	allOf := strings.EqualFold(wrapper.String("semantic"), "AllOf")
+	for _, role := range roles {
+		matched := role == "#all" || role == "@"+self.id ||
+			(strings.HasPrefix(role, "#") && self.roleAttributes[strings.TrimPrefix(role, "#")])
+		if matched && !allOf {
+			return true
+		}
+		if !matched && allOf {
+			return false
+		}
+	}
+	return allOf
+}
+
+// runListPoliciesForTargets lists the policies of the given type matching the filter which select all the targets
+func runListPoliciesForTargets(entityType string, targetOptions *policyTargetOptions, o *api.Options, outputF outputFunction) error {
+	targets, err := targetOptions.targets(o)
+	if err != nil {
+		return err
+	}
+
+	filter := "true"
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+
+	filter = withDefaultFilter(entityType, filter, o)
+	policies, _, err := filterEntitiesOfType(entityType, filter+" limit none", false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+
+	var result []*gabs.Container
+	for _, policy := range policies {
+		selected := true
+		for _, target := range targets {
+			selected = selected && target.selectedBy(policy)
+		}
+		if selected {
+			result = append(result, policy)
+		}
+	}
+
+	if o.OutputJSONResponse {
+		data := make([]interface{}, 0, len(result))
+		for _, policy := range result {
+			data = append(data, policy.Data())
+		}
+		container := gabs.New()
+		api.SetJSONValue(container, data, "data")
+		o.Printf("%v\n", container.StringIndent("", "  "))
+		return nil
+	}
+
+	return outputF(o, result, nil)
+}
+
+// newListPoliciesCmd creates the list command for a policy type, which may be restricted to the policies affecting an
+// identity with --identity and/or an edge router with --router
+func newListPoliciesCmd(entityType string, identityFlag, routerFlag bool, command listCommandRunner, outputF outputFunction, options *api.Options, aliases ...string) *cobra.Command {
+	targetOptions := &policyTargetOptions{}
+
+	cmd := &cobra.Command{
+		Use:     entityType + " <filter>?",
+		Short:   "lists " + entityType + " managed by the Ziti Edge Controller",
+		Args:    cobra.MaximumNArgs(1),
+		Aliases: aliases,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			var err error
+			if targetOptions.enabled() {
+				err = runListPoliciesForTargets(entityType, targetOptions, options, outputF)
+			} else {
+				err = command(options)
+			}
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	if identityFlag {
+		targetOptions.addIdentityFlag(cmd)
+	}
+	if routerFlag {
+		targetOptions.addRouterFlag(cmd)
+	}
+	addShowNotesFlag(cmd, options)
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,70 @@
+package edge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyTargetSelectedBy(t *testing.T) {
+	target := &policyTarget{
+		roleField:      "identityRoles",
+		id:             "id1",
+		roleAttributes: map[string]bool{"sales": true, "emea": true},
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		selected bool
+	}{
+		{name: "attribute", policy: `{"identityRoles": ["#sales"]}`, selected: true},
+		{name: "other attribute", policy: `{"identityRoles": ["#support"]}`},
+		{name: "id", policy: `{"identityRoles": ["@id1"]}`, selected: true},
+		{name: "other id", policy: `{"identityRoles": ["@id2"]}`},
+		{name: "attribute named like the id", policy: `{"identityRoles": ["#id1"]}`},
+		{name: "all", policy: `{"identityRoles": ["#all"]}`, selected: true},
+		{name: "no roles", policy: `{"identityRoles": []}`},
+		{name: "other role field", policy: `{"edgeRouterRoles": ["#all"]}`},
+		{name: "any of", policy: `{"semantic": "AnyOf", "identityRoles": ["#support", "#sales"]}`, selected: true},
+		{name: "all of", policy: `{"semantic": "AllOf", "identityRoles": ["#sales", "#emea"]}`, selected: true},
+		{name: "all of with a missing attribute", policy: `{"semantic": "AllOf", "identityRoles": ["#sales", "#support"]}`},
+		{name: "all of with all", policy: `{"semantic": "allof", "identityRoles": ["#all", "@id1"]}`, selected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := gabs.ParseJSON([]byte(test.policy))
+			require.NoError(t, err)
+			require.Equal(t, test.selected, target.selectedBy(policy))
+		})
+	}
+}
+
+func TestLookupPolicyTarget(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"identities": {
+			{"id": "id1", "name": `sales "eu"`, "roleAttributes": []interface{}{"sales"}},
+			{"id": "id2", "name": "support"},
+		},
+	})
+	o := newTestListOptions(&bytes.Buffer{})
+
+	target, err := lookupPolicyTarget("identities", "identityRoles", `sales "eu"`, o)
+	req.NoError(err)
+	req.Equal(&policyTarget{roleField: "identityRoles", id: "id1", roleAttributes: map[string]bool{"sales": true}}, target)
+	req.Contains(testController.Requested(), `GET identities?id = "sales \"eu\"" or name = "sales \"eu\""`)
+
+	target, err = lookupPolicyTarget("identities", "identityRoles", "id2", o)
+	req.NoError(err)
+	req.Equal("id2", target.id)
+
+	_, err = lookupPolicyTarget("identities", "identityRoles", `x" and name != "`, o)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeNotFound, cmdhelper.ExitCodeForError(err))
+}
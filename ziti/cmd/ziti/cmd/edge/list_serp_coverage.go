@@ -0,0 +1,212 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"sort"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+const (
+	serpCoverageNone   = "none"
+	serpCoverageSingle = "single"
+	serpCoverageOk     = "ok"
+)
+
+type serpCoverageOptions struct {
+	coverage bool
+	atRisk   bool
+}
+
+func (self *serpCoverageOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&self.coverage, "coverage", false, "Show, per service, how many online edge routers are available to it through service edge router policies. The filter selects the services to report on")
+	cmd.Flags().BoolVar(&self.atRisk, "at-risk", false, "Only report services with no or a single online edge router. Implies --coverage")
+}
+
+func (self *serpCoverageOptions) enabled() bool {
+	return self.coverage || self.atRisk
+}
+
+// serviceCoverage is how many edge routers a service may be dialed through
+type serviceCoverage struct {
+	Id                string   `json:"id"`
+	Name              string   `json:"name"`
+	Policies          int      `json:"policies"`
+	EdgeRouters       int      `json:"edgeRouters"`
+	OnlineRouters     int      `json:"onlineEdgeRouters"`
+	Coverage          string   `json:"coverage"`
+	OnlineRouterNames []string `json:"onlineEdgeRouterNames,omitempty"`
+}
+
+// newListServiceEdgeRouterPoliciesCmd creates the command to list service edge router policies
+func newListServiceEdgeRouterPoliciesCmd(options *api.Options) *cobra.Command {
+	coverageOptions := &serpCoverageOptions{}
+	targetOptions := &policyTargetOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "service-edge-router-policies <filter>?",
+		Short: "lists service-edge-router-policies managed by the Ziti Edge Controller",
+		Long: "lists service-edge-router-policies managed by the Ziti Edge Controller. Use --coverage to instead show, " +
+			"per service, how many online edge routers it may be dialed through, flagging services with no or a " +
+			"single online edge router, and --at-risk to only show those",
+		Args:    cobra.MaximumNArgs(1),
+		Aliases: []string{"serps"},
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			var err error
+			if coverageOptions.enabled() {
+				err = runListServiceEdgeRouterCoverage(coverageOptions, options)
+			} else if targetOptions.enabled() {
+				err = runListPoliciesForTargets("service-edge-router-policies", targetOptions, options, outputServiceEdgeRouterPolicies)
+			} else {
+				err = runListServiceEdgeRouterPolices(options)
+			}
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	coverageOptions.addFlags(cmd)
+	targetOptions.addRouterFlag(cmd)
+	addShowNotesFlag(cmd, options)
+	options.AddTableOutputFlags(cmd)
+	options.AddDefaultFilterFlag(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// runListServiceEdgeRouterCoverage reports, for each service matching the filter, the service edge router policies
+// granting it edge routers and how many of those edge routers are online
+func runListServiceEdgeRouterCoverage(coverageOptions *serpCoverageOptions, o *api.Options) error {
+	filter := "true"
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+	filter = withDefaultFilter("services", filter, o)
+
+	// the individual responses aren't of interest, only the report
+	quiet := *o
+	quiet.OutputJSONResponse = false
+
+	services, _, err := filterEntitiesOfType("services", filter+" limit none", false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+
+	var result []*serviceCoverage
+	for _, service := range services {
+		wrapper := api.Wrap(service)
+		coverage := &serviceCoverage{
+			Id:   wrapper.String("id"),
+			Name: wrapper.String("name"),
+		}
+
+		policies, _, err := filterSubEntitiesOfType("services", "service-edge-router-policies", coverage.Id, "true limit none", &quiet)
+		if err != nil {
+			return err
+		}
+		coverage.Policies = len(policies)
+
+		edgeRouters, _, err := filterSubEntitiesOfType("services", "edge-routers", coverage.Id, "true limit none", &quiet)
+		if err != nil {
+			return err
+		}
+		coverage.EdgeRouters = len(edgeRouters)
+		for _, edgeRouter := range edgeRouters {
+			routerWrapper := api.Wrap(edgeRouter)
+			if routerWrapper.Bool("isOnline") {
+				coverage.OnlineRouters++
+				coverage.OnlineRouterNames = append(coverage.OnlineRouterNames, routerWrapper.String("name"))
+			}
+		}
+		sort.Strings(coverage.OnlineRouterNames)
+
+		switch coverage.OnlineRouters {
+		case 0:
+			coverage.Coverage = serpCoverageNone
+		case 1:
+			coverage.Coverage = serpCoverageSingle
+		default:
+			coverage.Coverage = serpCoverageOk
+		}
+
+		if coverageOptions.atRisk && coverage.Coverage == serpCoverageOk {
+			continue
+		}
+		result = append(result, coverage)
+	}
+
+	// least covered services first, as they're the ones needing attention
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].OnlineRouters != result[j].OnlineRouters {
+			return result[i].OnlineRouters < result[j].OnlineRouters
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return outputServiceEdgeRouterCoverage(o, result)
+}
+
+func outputServiceEdgeRouterCoverage(o *api.Options, services []*serviceCoverage) error {
+	if o.OutputJSONResponse {
+		result := gabs.New()
+		api.SetJSONValue(result, services, "data")
+		o.Printf("%v\n", result.StringIndent("", "  "))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Policies", "Edge Routers", "Online", "Coverage"})
+
+	var none, single int
+	for _, service := range services {
+		coverage := service.Coverage
+		switch coverage {
+		case serpCoverageNone:
+			none++
+			coverage = "NONE"
+			if service.Policies == 0 {
+				coverage = "NONE (no policies)"
+			}
+		case serpCoverageSingle:
+			single++
+			coverage = "SINGLE (" + service.OnlineRouterNames[0] + ")"
+		}
+		t.AppendRow(table.Row{
+			service.Id,
+			service.Name,
+			service.Policies,
+			service.EdgeRouters,
+			service.OnlineRouters,
+			coverage,
+		})
+	}
+	api.RenderTable(o, t, nil)
+
+	o.Printf("%v services with no online edge routers, %v with a single online edge router\n", none, single)
+	return nil
+}
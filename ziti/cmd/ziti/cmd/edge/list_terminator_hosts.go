@@ -0,0 +1,299 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// terminatorHostSdk is a terminator created by an SDK application binding the service through an edge router
+	terminatorHostSdk = "sdk"
+	// terminatorHostTunneler is a terminator created by the tunneler embedded in an edge router
+	terminatorHostTunneler = "tunneler"
+	// terminatorHostRouter is a terminator created for the router itself, e.g. by ziti edge create terminator
+	terminatorHostRouter = "router"
+
+	edgeHostedAddressPrefix = "hosted:"
+)
+
+type terminatorHostOptions struct {
+	hosts    bool
+	hostedBy string
+}
+
+func (self *terminatorHostOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&self.hosts, "hosts", false, "Show the identity and API session hosting each terminator, to tell which device provides a service binding")
+	cmd.Flags().StringVar(&self.hostedBy, "hosted-by", "", "Only show the terminators hosted by the identity with this id or name. Implies --hosts")
+}
+
+func (self *terminatorHostOptions) enabled() bool {
+	return self.hosts || self.hostedBy != ""
+}
+
+// terminatorHost attributes a terminator to the identity, and for SDK hosted terminators the API session, hosting it
+type terminatorHost struct {
+	Id             string `json:"id"`
+	Service        string `json:"service"`
+	Router         string `json:"router"`
+	Binding        string `json:"binding"`
+	Address        string `json:"address"`
+	HostType       string `json:"hostType"`
+	IdentityId     string `json:"identityId,omitempty"`
+	IdentityName   string `json:"identityName,omitempty"`
+	SessionId      string `json:"sessionId,omitempty"`
+	ApiSessionId   string `json:"apiSessionId,omitempty"`
+	IpAddress      string `json:"ipAddress,omitempty"`
+	LastActivityAt string `json:"lastActivityAt,omitempty"`
+}
+
+// newListTerminatorsCmd creates the command to list terminators
+func newListTerminatorsCmd(options *api.Options) *cobra.Command {
+	hostOptions := &terminatorHostOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "terminators <filter>?",
+		Short: "lists terminators managed by the Ziti Edge Controller",
+		Long: "lists terminators managed by the Ziti Edge Controller. Use --hosts to also show who hosts each terminator: " +
+			"the identity and API session of the SDK application which bound the service, or the identity of the edge " +
+			"router whose tunneler hosts it. Terminators of the router itself have no identity",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			var err error
+			if hostOptions.enabled() {
+				err = runListTerminatorHosts(hostOptions, options)
+			} else {
+				err = runListTerminators(options)
+			}
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	hostOptions.addFlags(cmd)
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// runListTerminatorHosts lists the terminators matching the filter along with who hosts them. SDK hosted terminators
+// are addressed by the token of the bind session they were created with, which leads to the API session and identity
+func runListTerminatorHosts(hostOptions *terminatorHostOptions, o *api.Options) error {
+	var hostedById string
+	if hostOptions.hostedBy != "" {
+		var err error
+		if hostedById, err = mapNameToID("identities", hostOptions.hostedBy, *o); err != nil {
+			return err
+		}
+	}
+
+	// the individual responses aren't of interest, only the report
+	quiet := *o
+	quiet.OutputJSONResponse = false
+
+	terminators, pagingInfo, err := listEntitiesWithOptions("terminators", &quiet)
+	if err != nil {
+		return err
+	}
+
+	var hosts []*terminatorHost
+	var tokens []string
+	for _, terminator := range terminators {
+		wrapper := api.Wrap(terminator)
+		host := &terminatorHost{
+			Id:       wrapper.String("id"),
+			Service:  wrapper.String("service.name"),
+			Router:   wrapper.String("router.name"),
+			Binding:  wrapper.String("binding"),
+			Address:  wrapper.String("address"),
+			HostType: terminatorHostRouter,
+		}
+		switch {
+		case host.Binding == "edge" && strings.HasPrefix(host.Address, edgeHostedAddressPrefix):
+			host.HostType = terminatorHostSdk
+			tokens = append(tokens, api.QuoteFilterString(strings.TrimPrefix(host.Address, edgeHostedAddressPrefix)))
+		case host.Binding == "tunnel":
+			// the tunneler embedded in an edge router uses the identity sharing the router's id
+			host.HostType = terminatorHostTunneler
+			host.IdentityId = wrapper.String("router.id")
+		}
+		hosts = append(hosts, host)
+	}
+
+	if err := attributeSdkTerminators(hosts, tokens, o); err != nil {
+		return err
+	}
+	if err := nameTerminatorHosts(hosts, o); err != nil {
+		return err
+	}
+
+	if hostedById != "" {
+		var filtered []*terminatorHost
+		for _, host := range hosts {
+			if host.IdentityId == hostedById {
+				filtered = append(filtered, host)
+			}
+		}
+		hosts = filtered
+		// paging no longer matches what's shown
+		pagingInfo = nil
+	}
+
+	return outputTerminatorHosts(o, hosts, pagingInfo)
+}
+
+// attributeSdkTerminators looks up the bind sessions whose tokens SDK hosted terminators are addressed by, and the
+// API sessions those were created in. The tokens are given quoted as filter strings. Terminators whose session has
+// since ended are left unattributed
+func attributeSdkTerminators(hosts []*terminatorHost, tokens []string, o *api.Options) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	filter := fmt.Sprintf("token in [%v] limit none", strings.Join(tokens, ","))
+	sessions, _, err := filterEntitiesOfType("sessions", filter, false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+
+	sessionsByToken := map[string]*api.GabsWrapper{}
+	var apiSessionIds []string
+	for _, session := range sessions {
+		wrapper := api.Wrap(session)
+		sessionsByToken[wrapper.String("token")] = wrapper
+		apiSessionIds = append(apiSessionIds, api.QuoteFilterString(wrapper.String("apiSessionId")))
+	}
+
+	apiSessionsById := map[string]*api.GabsWrapper{}
+	if len(apiSessionIds) > 0 {
+		filter = fmt.Sprintf("id in [%v] limit none", strings.Join(apiSessionIds, ","))
+		apiSessions, _, err := filterEntitiesOfType("api-sessions", filter, false, o.Out, o.Timeout, o.Verbose)
+		if err != nil {
+			return err
+		}
+		for _, apiSession := range apiSessions {
+			wrapper := api.Wrap(apiSession)
+			apiSessionsById[wrapper.String("id")] = wrapper
+		}
+	}
+
+	for _, host := range hosts {
+		if host.HostType != terminatorHostSdk {
+			continue
+		}
+		session, found := sessionsByToken[strings.TrimPrefix(host.Address, edgeHostedAddressPrefix)]
+		if !found {
+			continue
+		}
+		host.SessionId = session.String("id")
+		host.ApiSessionId = session.String("apiSessionId")
+		host.IdentityId = session.String("identityId")
+		if apiSession, found := apiSessionsById[host.ApiSessionId]; found {
+			host.IdentityId = apiSession.String("identityId")
+			host.IdentityName = apiSession.String("identity.name")
+			host.IpAddress = apiSession.String("ipAddress")
+			host.LastActivityAt = apiSession.String("lastActivityAt")
+		}
+	}
+	return nil
+}
+
+// nameTerminatorHosts fills in the names of hosting identities which aren't known yet
+func nameTerminatorHosts(hosts []*terminatorHost, o *api.Options) error {
+	idSet := map[string]bool{}
+	for _, host := range hosts {
+		if host.IdentityId != "" && host.IdentityName == "" {
+			idSet[host.IdentityId] = true
+		}
+	}
+	if len(idSet) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for id := range idSet {
+		ids = append(ids, api.QuoteFilterString(id))
+	}
+	sort.Strings(ids)
+
+	filter := fmt.Sprintf("id in [%v] limit none", strings.Join(ids, ","))
+	identities, _, err := filterEntitiesOfType("identities", filter, false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+	names := map[string]string{}
+	for _, identity := range identities {
+		wrapper := api.Wrap(identity)
+		names[wrapper.String("id")] = wrapper.String("name")
+	}
+
+	for _, host := range hosts {
+		if host.IdentityName == "" {
+			host.IdentityName = names[host.IdentityId]
+		}
+	}
+	return nil
+}
+
+func outputTerminatorHosts(o *api.Options, hosts []*terminatorHost, pagingInfo *api.Paging) error {
+	if o.OutputJSONResponse {
+		result := gabs.New()
+		api.SetJSONValue(result, hosts, "data")
+		o.Printf("%v\n", result.StringIndent("", "  "))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Service", "Router", "Binding", "Host", "Identity", "API Session", "IP Address", "Last Activity"})
+
+	for _, host := range hosts {
+		identity := host.IdentityName
+		if identity == "" {
+			identity = host.IdentityId
+		}
+		if identity == "" && host.HostType == terminatorHostSdk {
+			identity = "unknown (session ended)"
+		}
+		t.AppendRow(table.Row{
+			host.Id,
+			host.Service,
+			host.Router,
+			host.Binding,
+			host.HostType,
+			identity,
+			host.ApiSessionId,
+			host.IpAddress,
+			host.LastActivityAt,
+		})
+	}
+	api.RenderTable(o, t, pagingInfo)
+	return nil
+}
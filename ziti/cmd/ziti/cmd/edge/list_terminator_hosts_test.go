@@ -0,0 +1,62 @@
+package edge
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTerminatorHosts(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"terminators": {
+			{"id": "t1", "service": map[string]interface{}{"name": "web"}, "router": map[string]interface{}{"id": "er1", "name": "edge-1"}, "binding": "edge", "address": `hosted:tok"1`},
+			{"id": "t2", "service": map[string]interface{}{"name": "web"}, "router": map[string]interface{}{"id": "er1", "name": "edge-1"}, "binding": "tunnel", "address": "tunnel:abc"},
+			{"id": "t3", "service": map[string]interface{}{"name": "db"}, "router": map[string]interface{}{"id": "er1", "name": "edge-1"}, "binding": "transport", "address": "tcp:db:5432"},
+			{"id": "t4", "service": map[string]interface{}{"name": "db"}, "router": map[string]interface{}{"id": "er1", "name": "edge-1"}, "binding": "edge", "address": "hosted:ended"},
+		},
+		"sessions": {
+			{"id": "s1", "token": `tok"1`, "apiSessionId": `as"1`, "identityId": "id1"},
+		},
+		"api-sessions": {
+			{"id": `as"1`, "identityId": "id1", "identity": map[string]interface{}{"name": "app"}, "ipAddress": "10.0.0.5", "lastActivityAt": "2022-06-01T03:00:00Z"},
+		},
+		"identities": {
+			{"id": "id1", "name": "app"},
+			{"id": "er1", "name": "edge-1"},
+		},
+	})
+
+	out := &bytes.Buffer{}
+	o := newTestListOptions(out)
+	o.OutputJSONResponse = true
+	req.NoError(runListTerminatorHosts(&terminatorHostOptions{hosts: true}, o))
+
+	req.Contains(testController.Requested(), `GET sessions?token in ["tok\"1","ended"] limit none`)
+	req.Contains(testController.Requested(), `GET api-sessions?id in ["as\"1"] limit none`)
+	req.Contains(testController.Requested(), `GET identities?id in ["er1"] limit none`)
+
+	result := struct {
+		Data []*terminatorHost `json:"data"`
+	}{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	req.Equal([]*terminatorHost{
+		{Id: "t1", Service: "web", Router: "edge-1", Binding: "edge", Address: `hosted:tok"1`, HostType: terminatorHostSdk,
+			IdentityId: "id1", IdentityName: "app", SessionId: "s1", ApiSessionId: `as"1`, IpAddress: "10.0.0.5",
+			LastActivityAt: "2022-06-01T03:00:00Z"},
+		{Id: "t2", Service: "web", Router: "edge-1", Binding: "tunnel", Address: "tunnel:abc", HostType: terminatorHostTunneler,
+			IdentityId: "er1", IdentityName: "edge-1"},
+		{Id: "t3", Service: "db", Router: "edge-1", Binding: "transport", Address: "tcp:db:5432", HostType: terminatorHostRouter},
+		{Id: "t4", Service: "db", Router: "edge-1", Binding: "edge", Address: "hosted:ended", HostType: terminatorHostSdk},
+	}, result.Data)
+
+	out.Reset()
+	req.NoError(runListTerminatorHosts(&terminatorHostOptions{hostedBy: "app"}, o))
+	result.Data = nil
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	req.Len(result.Data, 1)
+	req.Equal("t1", result.Data[0].Id)
+}
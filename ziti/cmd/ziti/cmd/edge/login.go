@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/Jeffail/gabs"
 	"github.com/openziti/foundation/v2/term"
+	sdkconfig "github.com/openziti/sdk-golang/ziti/config"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
@@ -43,6 +44,7 @@ type loginOptions struct {
 	ReadOnly     bool
 	Yes          bool
 	IgnoreConfig bool
+	IdentityFile string
 }
 
 // newLoginCmd creates the command
@@ -56,8 +58,10 @@ func newLoginCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "login my.controller.hostname[:port]/path",
 		Short: "logs into a Ziti Edge Controller instance",
-		Long:  `login allows the ziti command to establish a session with a Ziti Edge Controller, allowing more commands to be run against the controller.`,
-		Args:  cobra.RangeArgs(0, 1),
+		Long: `login allows the ziti command to establish a session with a Ziti Edge Controller, allowing more commands to be run against the controller.
+
+Use --identity with the json file of an enrolled admin identity to authenticate with its certificate instead of a username and password. The session is saved for the selected --cli-identity profile.`,
+		Args: cobra.RangeArgs(0, 1),
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
@@ -77,6 +81,7 @@ func newLoginCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd.Flags().BoolVar(&options.ReadOnly, "read-only", false, "marks this login as read-only. Note: this is not a guarantee that nothing can be changed on the server. Care should still be taken!")
 	cmd.Flags().BoolVarP(&options.Yes, "yes", "y", false, "If set, responds to prompts with yes. This will result in untrusted certs being accepted or updated.")
 	cmd.Flags().BoolVar(&options.IgnoreConfig, "ignore-config", false, "If set, does not use value from the config file for hostname or username. Values must be entered or will be prompted for.")
+	cmd.Flags().StringVar(&options.IdentityFile, "identity", "", "identity json file of an enrolled admin identity. If set, authenticates with the identity's certificate instead of a username and password. The controller url defaults to the one in the identity file")
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -91,9 +96,29 @@ func (o *loginOptions) Run() error {
 
 	id := config.GetIdentity()
 
+	var identityConfig *sdkconfig.Config
+	if o.IdentityFile != "" {
+		if o.Token != "" || o.Username != "" {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--identity can't be combined with --token or --username")
+		}
+		if identityConfig, err = sdkconfig.NewFromFile(o.IdentityFile); err != nil {
+			return errors.Wrapf(err, "unable to read identity file %v", o.IdentityFile)
+		}
+		if identityFile, err := filepath.Abs(o.IdentityFile); err == nil {
+			o.IdentityFile = identityFile
+		}
+	}
+
 	var host string
 	if len(o.Args) == 0 {
-		if defaultId := config.EdgeIdentities[id]; defaultId != nil && !o.IgnoreConfig {
+		if identityConfig != nil && identityConfig.ZtAPI != "" && !o.IgnoreConfig {
+			ztApiUrl, err := url.Parse(identityConfig.ZtAPI)
+			if err != nil {
+				return errors.Wrapf(err, "invalid controller url in identity file %v", o.IdentityFile)
+			}
+			host = ztApiUrl.Scheme + "://" + ztApiUrl.Host
+			o.Printf("Using controller url: %v from identity file: %v\n", host, o.IdentityFile)
+		} else if defaultId := config.EdgeIdentities[id]; defaultId != nil && !o.IgnoreConfig {
 			host = defaultId.Url
 			o.Printf("Using controller url: %v from identity '%v' in config file: %v\n", host, id, configFile)
 		} else {
@@ -119,7 +144,12 @@ func (o *loginOptions) Run() error {
 
 	host = ctrlUrl.Scheme + "://" + ctrlUrl.Host
 
-	if err = o.ConfigureCerts(host, ctrlUrl); err != nil {
+	if identityConfig != nil && o.CaCert == "" {
+		// the identity file carries the CA bundle the controller was enrolled against
+		if o.CaCert, err = o.caCertFromIdentity(identityConfig, ctrlUrl); err != nil {
+			return err
+		}
+	} else if err = o.ConfigureCerts(host, ctrlUrl); err != nil {
 		return err
 	}
 
@@ -138,7 +168,21 @@ func (o *loginOptions) Run() error {
 		o.Println("NOTE: When using --token the saved identity will be marked as read-only unless --read-only=false is provided")
 	}
 
-	if o.Token == "" {
+	if o.IdentityFile != "" {
+		jsonParsed, err := util.EdgeControllerCertLogin(host, o.CaCert, o.IdentityFile, o.Out, o.OutputJSONResponse, o.Options.Timeout, o.Options.Verbose)
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if o.Token, ok = jsonParsed.Path("data.token").Data().(string); !ok {
+			return fmt.Errorf("no session token returned from login request to %v. Received: %v", host, jsonParsed.String())
+		}
+
+		if !o.OutputJSONResponse {
+			o.Printf("Token: %v\n", o.Token)
+		}
+	} else if o.Token == "" {
 		for o.Username == "" {
 			if defaultId := config.EdgeIdentities[id]; defaultId != nil && defaultId.Username != "" && !o.IgnoreConfig {
 				o.Username = defaultId.Username
@@ -188,12 +232,13 @@ func (o *loginOptions) Run() error {
 	}
 
 	loginIdentity := &util.RestClientEdgeIdentity{
-		Url:       host,
-		Username:  o.Username,
-		Token:     o.Token,
-		LoginTime: time.Now().Format(time.RFC3339),
-		CaCert:    o.CaCert,
-		ReadOnly:  o.ReadOnly,
+		Url:          host,
+		Username:     o.Username,
+		Token:        o.Token,
+		LoginTime:    time.Now().Format(time.RFC3339),
+		CaCert:       o.CaCert,
+		ReadOnly:     o.ReadOnly,
+		IdentityFile: o.IdentityFile,
 	}
 
 	o.Printf("Saving identity '%v' to %v\n", id, configFile)
@@ -278,6 +323,25 @@ func (o *loginOptions) ConfigureCerts(host string, ctrlUrl *url.URL) error {
 	return nil
 }
 
+// caCertFromIdentity returns the path of a file containing the CA bundle from the identity file, writing it to the
+// CLI certs directory if the bundle is embedded in the identity file
+func (o *loginOptions) caCertFromIdentity(identityConfig *sdkconfig.Config, ctrlUrl *url.URL) (string, error) {
+	ca := identityConfig.ID.CA
+	if ca == "" {
+		return "", errors.Errorf("identity file %v doesn't contain a CA bundle, specify one with --cert", o.IdentityFile)
+	}
+
+	if strings.HasPrefix(ca, "pem:") {
+		return util.WriteCert(o, ctrlUrl.Hostname(), []byte(strings.TrimPrefix(ca, "pem:")))
+	}
+
+	caFile := strings.TrimPrefix(ca, "file://")
+	if !filepath.IsAbs(caFile) {
+		caFile = filepath.Join(filepath.Dir(o.IdentityFile), caFile)
+	}
+	return caFile, nil
+}
+
 func (o *loginOptions) askYesNo(prompt string) (bool, error) {
 	filter := &yesNoFilter{}
 	if _, err := o.ask(prompt, filter.Accept); err != nil {
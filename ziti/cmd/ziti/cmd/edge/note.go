@@ -0,0 +1,378 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// notesTag is the reserved tag under which operational notes are kept, as a JSON encoded list of entityNote. The
+// controller only accepts flat tags, so the list is kept as a string
+const notesTag = "ziti.notes"
+
+// noteEntityTypes maps the entity types accepted by ziti note, and their aliases, to the entity types of the edge
+// management API. Routers are looked up as edge routers, so routers which are only fabric routers can't have notes
+var noteEntityTypes = map[string]string{
+	"identity":                     "identities",
+	"identities":                   "identities",
+	"router":                       "edge-routers",
+	"routers":                      "edge-routers",
+	"edge-router":                  "edge-routers",
+	"edge-routers":                 "edge-routers",
+	"er":                           "edge-routers",
+	"service":                      "services",
+	"services":                     "services",
+	"config":                       "configs",
+	"configs":                      "configs",
+	"service-policy":               "service-policies",
+	"service-policies":             "service-policies",
+	"sp":                           "service-policies",
+	"edge-router-policy":           "edge-router-policies",
+	"edge-router-policies":         "edge-router-policies",
+	"erp":                          "edge-router-policies",
+	"service-edge-router-policy":   "service-edge-router-policies",
+	"service-edge-router-policies": "service-edge-router-policies",
+	"serp":                         "service-edge-router-policies",
+}
+
+// entityNote is a free-text operational note attached to an entity
+type entityNote struct {
+	Text      string    `json:"text"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NewCmdNote creates a command object for the "note" command
+func NewCmdNote(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "note",
+		Short: "Attach, list and clear operational notes on entities",
+		Long: "Attach, list and clear free-text operational notes on entities, such as why a router was drained or who " +
+			"to contact about a service. Notes are kept in the " + notesTag + " tag of the entity, so they're visible to " +
+			"every operator of the network. The router entity type means edge routers, routers which aren't edge routers " +
+			"can't have notes. Pass --show-notes to the edge list commands to show them in a Notes column",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	newOptions := func() *api.Options {
+		return &api.Options{CommonOptions: common.CommonOptions{Out: out, Err: errOut}}
+	}
+
+	cmd.AddCommand(newNoteAddCmd(newOptions()))
+	cmd.AddCommand(newNoteListCmd(newOptions()))
+	cmd.AddCommand(newNoteClearCmd(newOptions()))
+	return cmd
+}
+
+func newNoteAddCmd(options *api.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "add <entity type> <id or name> <note>",
+		Short:   "Attaches a note to an entity",
+		Example: `  ziti note add router router1 "drained for maintenance, see CHG-1234"`,
+		Args:    cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			cmdhelper.CheckErr(runNoteAdd(options))
+		},
+	}
+	options.AddCommonFlags(cmd)
+	return cmd
+}
+
+func newNoteListCmd(options *api.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list <entity type> [id or name]",
+		Short: "Lists the notes of an entity, or of every entity of a type which has notes",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			cmdhelper.CheckErr(runNoteList(options))
+		},
+	}
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+	return cmd
+}
+
+func newNoteClearCmd(options *api.Options) *cobra.Command {
+	var index int
+	cmd := &cobra.Command{
+		Use:   "clear <entity type> <id or name>",
+		Short: "Clears the notes of an entity",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			cmdhelper.CheckErr(runNoteClear(options, index))
+		},
+	}
+	cmd.Flags().IntVar(&index, "index", 0, "Only clear the note with this index, as shown by ziti note list")
+	options.AddCommonFlags(cmd)
+	return cmd
+}
+
+// noteEntityType returns the API entity type for an entity type given to ziti note
+func noteEntityType(val string) (string, error) {
+	entityType, found := noteEntityTypes[strings.ToLower(val)]
+	if !found {
+		var types []string
+		for k, v := range noteEntityTypes {
+			if k == v {
+				types = append(types, k)
+			}
+		}
+		sort.Strings(types)
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "notes can't be attached to %v, only to %v", val, strings.Join(types, ", "))
+	}
+	return entityType, nil
+}
+
+// getNoteEntity returns the entity of the given type with the given id or name
+func getNoteEntity(entityType, idOrName string, o *api.Options) (*gabs.Container, error) {
+	id, err := mapNameToID(entityType, idOrName, *o)
+	if err != nil {
+		return nil, err
+	}
+	list, _, err := filterEntitiesOfType(entityType, "id = "+api.QuoteFilterString(id), false, nil, o.Timeout, o.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) != 1 {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no %v found with id %v", entityType, id)
+	}
+	return list[0], nil
+}
+
+// entityNotes returns the notes kept in the tags of the entity
+func entityNotes(entity *gabs.Container) []*entityNote {
+	text, ok := entity.S("tags", notesTag).Data().(string)
+	if !ok || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var notes []*entityNote
+	if err := json.Unmarshal([]byte(text), &notes); err != nil {
+		// a single note set by hand is kept as is
+		return []*entityNote{{Text: text}}
+	}
+	return notes
+}
+
+// encodeNotes returns the value of the notes tag holding the notes
+func encodeNotes(notes []*entityNote) (string, error) {
+	data, err := json.Marshal(notes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// setEntityNotes replaces the notes of the entity, keeping its other tags
+func setEntityNotes(entityType string, entity *gabs.Container, notes []*entityNote, o *api.Options) error {
+	tags := map[string]interface{}{}
+	if current, ok := entity.S("tags").Data().(map[string]interface{}); ok {
+		for k, v := range current {
+			tags[k] = v
+		}
+	}
+	if len(notes) == 0 {
+		delete(tags, notesTag)
+	} else {
+		encoded, err := encodeNotes(notes)
+		if err != nil {
+			return err
+		}
+		tags[notesTag] = encoded
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"tags": tags})
+	if err != nil {
+		return err
+	}
+	if _, err = patchEntityOfType(entityType+"/"+api.Wrap(entity).String("id"), string(body), o); err != nil {
+		return errors.Wrap(err, "unable to update tags")
+	}
+	return nil
+}
+
+// noteAuthor returns who is adding a note, the local user
+func noteAuthor() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func runNoteAdd(o *api.Options) error {
+	entityType, err := noteEntityType(o.Args[0])
+	if err != nil {
+		return err
+	}
+	text := strings.TrimSpace(strings.Join(o.Args[2:], " "))
+	if text == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "the note must not be empty")
+	}
+
+	entity, err := getNoteEntity(entityType, o.Args[1], o)
+	if err != nil {
+		return err
+	}
+
+	notes := append(entityNotes(entity), &entityNote{
+		Text:      text,
+		Author:    noteAuthor(),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+	if err := setEntityNotes(entityType, entity, notes, o); err != nil {
+		return err
+	}
+
+	if !o.OutputJSONResponse {
+		o.Printf("added note %v to %v %v\n", len(notes), entityType, api.Wrap(entity).String("name"))
+	}
+	return nil
+}
+
+func runNoteList(o *api.Options) error {
+	entityType, err := noteEntityType(o.Args[0])
+	if err != nil {
+		return err
+	}
+
+	var entities []*gabs.Container
+	if len(o.Args) > 1 {
+		entity, err := getNoteEntity(entityType, o.Args[1], o)
+		if err != nil {
+			return err
+		}
+		entities = append(entities, entity)
+	} else {
+		if entities, _, err = filterEntitiesOfType(entityType, "true limit none", false, nil, o.Timeout, o.Verbose); err != nil {
+			return err
+		}
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "Index", "Note", "Author", "Created At"})
+	count := 0
+	for _, entity := range entities {
+		wrapper := api.Wrap(entity)
+		for idx, note := range entityNotes(entity) {
+			createdAt := ""
+			if !note.CreatedAt.IsZero() {
+				createdAt = note.CreatedAt.Format(time.RFC3339)
+			}
+			t.AppendRow(table.Row{wrapper.String("id"), wrapper.String("name"), idx + 1, note.Text, note.Author, createdAt})
+			count++
+		}
+	}
+
+	if count == 0 {
+		o.Println("no notes found")
+		return nil
+	}
+	api.RenderTable(o, t, nil)
+	return nil
+}
+
+func runNoteClear(o *api.Options, index int) error {
+	entityType, err := noteEntityType(o.Args[0])
+	if err != nil {
+		return err
+	}
+	entity, err := getNoteEntity(entityType, o.Args[1], o)
+	if err != nil {
+		return err
+	}
+
+	notes := entityNotes(entity)
+	cleared := len(notes)
+	if index != 0 {
+		if index < 0 || index > len(notes) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "%v %v has no note with index %v", entityType, o.Args[1], index)
+		}
+		notes = append(notes[:index-1], notes[index:]...)
+		cleared = 1
+	} else {
+		notes = nil
+	}
+
+	if cleared > 0 {
+		if err := setEntityNotes(entityType, entity, notes, o); err != nil {
+			return err
+		}
+	}
+
+	if !o.OutputJSONResponse {
+		o.Printf("cleared %v notes from %v %v\n", cleared, entityType, api.Wrap(entity).String("name"))
+	}
+	return nil
+}
+
+// addShowNotesFlag adds the flag showing the notes of the listed entities in a Notes column
+func addShowNotesFlag(cmd *cobra.Command, options *api.Options) {
+	cmd.Flags().BoolVar(&options.ShowNotes, "show-notes", false, "Show the operational notes attached with ziti note in a Notes column")
+}
+
+// withNotesHeader adds the Notes column to the header, if notes are shown
+func withNotesHeader(o *api.Options, header table.Row) table.Row {
+	if o.ShowNotes {
+		return append(header, "Notes")
+	}
+	return header
+}
+
+// withNotes adds the notes of the entity to its row, if notes are shown
+func withNotes(o *api.Options, row table.Row, entity *gabs.Container) table.Row {
+	if !o.ShowNotes {
+		return row
+	}
+	var lines []string
+	for _, note := range entityNotes(entity) {
+		line := note.Text
+		if note.Author != "" || !note.CreatedAt.IsZero() {
+			var attribution []string
+			if note.Author != "" {
+				attribution = append(attribution, note.Author)
+			}
+			if !note.CreatedAt.IsZero() {
+				attribution = append(attribution, note.CreatedAt.Format("2006-01-02"))
+			}
+			line += " (" + strings.Join(attribution, ", ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	return append(row, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,76 @@
+package edge
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/stretchr/testify/require"
+)
+
+func noteTestEntity(t *testing.T, tags map[string]interface{}) *gabs.Container {
+	entity := gabs.New()
+	_, err := entity.Set(tags, "tags")
+	require.NoError(t, err)
+	return entity
+}
+
+func TestEntityNotesRoundTrip(t *testing.T) {
+	req := require.New(t)
+
+	notes := []*entityNote{
+		{Text: "drained for maintenance", Author: "alice", CreatedAt: time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC)},
+		{Text: "contact bob"},
+	}
+	encoded, err := encodeNotes(notes)
+	req.NoError(err)
+
+	// tags must stay flat, as the controller rejects nested values
+	entity := noteTestEntity(t, map[string]interface{}{notesTag: encoded, "env": "prod"})
+	req.Equal(notes, entityNotes(entity))
+
+	req.Nil(entityNotes(noteTestEntity(t, map[string]interface{}{"env": "prod"})))
+	req.Equal([]*entityNote{{Text: "set by hand"}}, entityNotes(noteTestEntity(t, map[string]interface{}{notesTag: "set by hand"})))
+}
+
+func TestWithNotes(t *testing.T) {
+	req := require.New(t)
+
+	encoded, err := encodeNotes([]*entityNote{
+		{Text: "drained", Author: "alice", CreatedAt: time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC)},
+		{Text: "contact bob"},
+	})
+	req.NoError(err)
+	entity := noteTestEntity(t, map[string]interface{}{notesTag: encoded})
+
+	o := &api.Options{}
+	req.Equal(table.Row{"r1"}, withNotes(o, table.Row{"r1"}, entity))
+	req.Equal(table.Row{"ID"}, withNotesHeader(o, table.Row{"ID"}))
+
+	o.ShowNotes = true
+	req.Equal(table.Row{"r1", "drained (alice, 2022-06-01)\ncontact bob"}, withNotes(o, table.Row{"r1"}, entity))
+	req.Equal(table.Row{"ID", "Notes"}, withNotesHeader(o, table.Row{"ID"}))
+}
+
+func TestNoteAddRouter(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"edge-routers": {{"id": `r"1`, "name": "edge-1", "tags": map[string]interface{}{"env": "prod"}}},
+	})
+
+	out := &bytes.Buffer{}
+	req.NoError(runNoteAdd(newTestListOptions(out, "router", "edge-1", "drained", "for", "maintenance")))
+	req.Equal("added note 1 to edge-routers edge-1\n", out.String())
+	req.Contains(testController.Requested(), `GET edge-routers?id = "r\"1"`)
+
+	entity, err := gabs.Consume(testController.List("edge-routers")[0])
+	req.NoError(err)
+	req.Equal("prod", entity.S("tags", "env").Data())
+	notes := entityNotes(entity)
+	req.Len(notes, 1)
+	req.Equal("drained for maintenance", notes[0].Text)
+}
@@ -0,0 +1,436 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	sdkconfig "github.com/openziti/sdk-golang/ziti/config"
+	"github.com/openziti/sdk-golang/ziti/constants"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/resty.v1"
+)
+
+const clientApiPath = "/edge/client/v1"
+
+func newPostureResponseCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "posture-response",
+		Short: "Tools for working with posture responses",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newPostureResponseSimulateCmd(out, errOut))
+
+	return cmd
+}
+
+type postureResponseSimulateOptions struct {
+	api.Options
+	osType         string
+	osVersion      string
+	osBuild        string
+	domain         string
+	macAddresses   []string
+	processes      []string
+	processHashes  map[string]string
+	processSigners map[string]string
+	woken          bool
+	unlocked       bool
+	expectPassing  []string
+	expectFailing  []string
+}
+
+func newPostureResponseSimulateCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &postureResponseSimulateOptions{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{Out: out, Err: errOut},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "simulate <identity file>",
+		Short: "submits synthetic posture responses for a test identity and reports which services it passes posture checks for",
+		Long: "Authenticates with the given identity file and submits the posture responses described by the flags, as an " +
+			"SDK would, then lists the posture query results of the services the identity can access. Process responses " +
+			"are only sent for paths matching a process posture query of one of those services. " +
+			"Use --expect-passing and --expect-failing to fail when a service's posture checks don't have the expected result",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	cmd.Flags().SetInterspersed(true)
+	cmd.Flags().StringVar(&options.osType, "os-type", "", "Operating system to report, e.g. Windows, Linux, macOS, iOS or Android")
+	cmd.Flags().StringVar(&options.osVersion, "os-version", "", "Operating system version to report")
+	cmd.Flags().StringVar(&options.osBuild, "os-build", "", "Operating system build to report")
+	cmd.Flags().StringVar(&options.domain, "domain", "", "Windows domain to report the endpoint as joined to")
+	cmd.Flags().StringSliceVar(&options.macAddresses, "mac", nil, "MAC addresses to report")
+	cmd.Flags().StringArrayVar(&options.processes, "process", nil, "Path of a process to report as running. May be repeated")
+	cmd.Flags().StringToStringVar(&options.processHashes, "process-hash", nil, "SHA-512 hash to report for a process, as <path>=<hash>")
+	cmd.Flags().StringToStringVar(&options.processSigners, "process-signer", nil, "Signer fingerprint to report for a process, as <path>=<fingerprint>")
+	cmd.Flags().BoolVar(&options.woken, "woken", false, "Report that the endpoint has woken from sleep")
+	cmd.Flags().BoolVar(&options.unlocked, "unlocked", false, "Report that the endpoint has been unlocked")
+	cmd.Flags().StringSliceVar(&options.expectPassing, "expect-passing", nil, "Fail unless the posture checks of these services pass")
+	cmd.Flags().StringSliceVar(&options.expectFailing, "expect-failing", nil, "Fail unless the posture checks of these services fail")
+	cmd.Flags().BoolVarP(&options.OutputJSONResponse, "output-json", "j", false, "Output the posture queries of the identity's services as JSON")
+	cmd.Flags().IntVarP(&options.Timeout, "timeout", "", 5, "Timeout for REST operations (specified in seconds)")
+	cmd.Flags().BoolVarP(&options.Verbose, "verbose", "", false, "Enable verbose logging")
+
+	return cmd
+}
+
+// clientApiSession makes requests to the client API as the test identity
+type clientApiSession struct {
+	client  *resty.Client
+	baseUrl string
+	token   string
+}
+
+func (self *clientApiSession) request() *resty.Request {
+	return self.client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(constants.ZitiSession, self.token)
+}
+
+func (o *postureResponseSimulateOptions) Run() error {
+	session, err := o.login(o.Args[0])
+	if err != nil {
+		return err
+	}
+
+	services, err := o.listServices(session)
+	if err != nil {
+		return err
+	}
+
+	responses, err := o.buildResponses(services)
+	if err != nil {
+		return err
+	}
+
+	if len(responses) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "no posture responses given, use at least one of --os-type, --domain, --mac, --process, --woken or --unlocked")
+	}
+
+	body, err := json.Marshal(responses)
+	if err != nil {
+		return err
+	}
+
+	resp, err := session.request().SetBody(body).Post(session.baseUrl + "/posture-response-bulk")
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, errors.Wrapf(err, "unable to submit posture responses to %v", session.baseUrl))
+	}
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusCreated {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeForHttpStatus(resp.StatusCode()),
+			errors.Errorf("unable to submit posture responses. Status code: %v, Server returned: %v", resp.Status(), resp.String()))
+	}
+
+	if !o.OutputJSONResponse {
+		o.Printf("submitted %v posture responses\n", len(responses))
+	}
+
+	if services, err = o.listServices(session); err != nil {
+		return err
+	}
+
+	return o.outputResults(services)
+}
+
+func (o *postureResponseSimulateOptions) login(identityFile string) (*clientApiSession, error) {
+	cfg, err := sdkconfig.NewFromFile(identityFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read identity file %v", identityFile)
+	}
+
+	ztApiUrl, err := url.Parse(cfg.ZtAPI)
+	if err != nil || ztApiUrl.Host == "" {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid controller url '%v' in identity file %v", cfg.ZtAPI, identityFile)
+	}
+	baseUrl := ztApiUrl.Scheme + "://" + ztApiUrl.Host + clientApiPath
+	if ztApiUrl.Path != "" && ztApiUrl.Path != "/" {
+		baseUrl = strings.TrimSuffix(cfg.ZtAPI, "/")
+	}
+
+	result, err := util.EdgeControllerCertLogin(baseUrl, "", identityFile, o.Out, false, o.Timeout, o.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _ := result.Path("data.token").Data().(string)
+	if token == "" {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "no session token returned when authenticating with %v", identityFile)
+	}
+
+	id, err := util.LoadIdentityFile(identityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client := resty.New().
+		SetTLSClientConfig(id.ClientTLSConfig()).
+		SetTimeout(time.Duration(o.Timeout) * time.Second).
+		SetDebug(o.Verbose)
+
+	return &clientApiSession{client: client, baseUrl: baseUrl, token: token}, nil
+}
+
+// servicesPageSize is how many services are listed per request, paging through all of them
+const servicesPageSize = 500
+
+func (o *postureResponseSimulateOptions) listServices(session *clientApiSession) ([]*gabs.Container, error) {
+	var result []*gabs.Container
+	for {
+		resp, err := session.request().
+			SetQueryParam("limit", strconv.Itoa(servicesPageSize)).
+			SetQueryParam("offset", strconv.Itoa(len(result))).
+			Get(session.baseUrl + "/services")
+		if err != nil {
+			return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, errors.Wrapf(err, "unable to list services from %v", session.baseUrl))
+		}
+		if resp.StatusCode() != http.StatusOK {
+			return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeForHttpStatus(resp.StatusCode()),
+				errors.Errorf("unable to list services. Status code: %v, Server returned: %v", resp.Status(), resp.String()))
+		}
+
+		parsed, err := gabs.ParseJSON(resp.Body())
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse services")
+		}
+
+		services, err := parsed.S("data").Children()
+		if err != nil && err != gabs.ErrNotObjOrArray {
+			return nil, err
+		}
+		result = append(result, services...)
+
+		paging := api.GetPaging(parsed)
+		if len(services) == 0 || paging.HasError() || int64(len(result)) >= paging.Count {
+			return result, nil
+		}
+	}
+}
+
+// buildResponses creates the posture responses requested by the flags. Responses are sent with the id of a matching
+// posture query where there is one. Only process responses require it, as the controller stores them per check
+func (o *postureResponseSimulateOptions) buildResponses(services []*gabs.Container) ([]map[string]interface{}, error) {
+	queryIds := map[string]string{}
+	processQueryIds := map[string][]string{}
+
+	for _, service := range services {
+		policies, _ := service.S("postureQueries").Children()
+		for _, policy := range policies {
+			queries, _ := policy.S("postureQueries").Children()
+			for _, query := range queries {
+				wrapper := api.Wrap(query)
+				queryType := wrapper.String("queryType")
+				queryId := wrapper.String("id")
+				queryIds[queryType] = queryId
+
+				var paths []string
+				if path := wrapper.String("process.path"); path != "" {
+					paths = append(paths, path)
+				}
+				processes, _ := query.S("processes").Children()
+				for _, process := range processes {
+					paths = append(paths, api.Wrap(process).String("path"))
+				}
+				for _, path := range paths {
+					key := strings.ToLower(path)
+					if !stringz.Contains(processQueryIds[key], queryId) {
+						processQueryIds[key] = append(processQueryIds[key], queryId)
+					}
+				}
+			}
+		}
+	}
+
+	queryId := func(queryType string) string {
+		if id, found := queryIds[queryType]; found {
+			return id
+		}
+		return strings.ToLower(queryType)
+	}
+
+	var responses []map[string]interface{}
+
+	if o.osType != "" {
+		responses = append(responses, map[string]interface{}{
+			"id":      queryId("OS"),
+			"typeId":  "OS",
+			"type":    o.osType,
+			"version": o.osVersion,
+			"build":   o.osBuild,
+		})
+	}
+
+	if o.domain != "" {
+		responses = append(responses, map[string]interface{}{
+			"id":     queryId("DOMAIN"),
+			"typeId": "DOMAIN",
+			"domain": o.domain,
+		})
+	}
+
+	if len(o.macAddresses) > 0 {
+		responses = append(responses, map[string]interface{}{
+			"id":           queryId("MAC"),
+			"typeId":       "MAC",
+			"macAddresses": o.macAddresses,
+		})
+	}
+
+	if o.woken || o.unlocked {
+		responses = append(responses, map[string]interface{}{
+			"id":       "endpoint-state",
+			"typeId":   "ENDPOINT_STATE",
+			"woken":    o.woken,
+			"unlocked": o.unlocked,
+		})
+	}
+
+	for path := range o.processHashes {
+		if !stringz.Contains(o.processes, path) {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--process-hash given for %v, which isn't given with --process", path)
+		}
+	}
+	for path := range o.processSigners {
+		if !stringz.Contains(o.processes, path) {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--process-signer given for %v, which isn't given with --process", path)
+		}
+	}
+
+	for _, path := range o.processes {
+		ids := processQueryIds[strings.ToLower(path)]
+		if len(ids) == 0 {
+			o.Printf("warning: no process posture query found for %v, not reporting it\n", path)
+			continue
+		}
+
+		var signers []string
+		if signer, found := o.processSigners[path]; found {
+			signers = append(signers, signer)
+		}
+
+		for _, id := range ids {
+			responses = append(responses, map[string]interface{}{
+				"id":                 id,
+				"typeId":             "PROCESS",
+				"path":               path,
+				"isRunning":          true,
+				"hash":               o.processHashes[path],
+				"signerFingerprints": signers,
+			})
+		}
+	}
+
+	return responses, nil
+}
+
+func (o *postureResponseSimulateOptions) outputResults(services []*gabs.Container) error {
+	passing := map[string]bool{}
+	for _, service := range services {
+		name := api.Wrap(service).String("name")
+		policies, _ := service.S("postureQueries").Children()
+		// services without posture checks are always accessible, otherwise any passing policy grants access
+		passing[name] = len(policies) == 0
+		for _, policy := range policies {
+			if api.Wrap(policy).Bool("isPassing") {
+				passing[name] = true
+			}
+		}
+	}
+
+	if o.OutputJSONResponse {
+		result := gabs.New()
+		var data []interface{}
+		for _, service := range services {
+			entry := gabs.New()
+			name := api.Wrap(service).String("name")
+			api.SetJSONValue(entry, name, "name")
+			api.SetJSONValue(entry, passing[name], "isPassing")
+			api.SetJSONValue(entry, service.S("postureQueries").Data(), "postureQueries")
+			data = append(data, entry.Data())
+		}
+		api.SetJSONValue(result, data, "data")
+		o.Printf("%v\n", result.StringIndent("", "  "))
+	} else {
+		t := table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.AppendHeader(table.Row{"Service", "Policy", "Policy Type", "Passing", "Failing Queries"})
+		for _, service := range services {
+			name := api.Wrap(service).String("name")
+			policies, _ := service.S("postureQueries").Children()
+			if len(policies) == 0 {
+				t.AppendRow(table.Row{name, "", "", true, ""})
+			}
+			for _, policy := range policies {
+				wrapper := api.Wrap(policy)
+				var failing []string
+				queries, _ := policy.S("postureQueries").Children()
+				for _, query := range queries {
+					if !api.Wrap(query).Bool("isPassing") {
+						failing = append(failing, api.Wrap(query).String("queryType"))
+					}
+				}
+				sort.Strings(failing)
+				t.AppendRow(table.Row{name, wrapper.String("policyId"), wrapper.String("policyType"), wrapper.Bool("isPassing"), strings.Join(failing, ", ")})
+			}
+		}
+		api.RenderTable(&o.Options, t, nil)
+	}
+
+	var mismatched []string
+	check := func(names []string, expected bool) {
+		for _, name := range names {
+			if isPassing, found := passing[name]; !found || isPassing != expected {
+				mismatched = append(mismatched, name)
+			}
+		}
+	}
+	check(o.expectPassing, true)
+	check(o.expectFailing, false)
+
+	if len(mismatched) > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unexpected posture check results for services: %v", strings.Join(mismatched, ", "))
+	}
+
+	return nil
+}
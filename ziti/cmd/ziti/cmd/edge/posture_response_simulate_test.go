@@ -0,0 +1,170 @@
+package edge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/sdk-golang/ziti/constants"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/resty.v1"
+)
+
+// postureTestServices are services of a test identity as listed by the client API: one without posture checks, one
+// passing its checks and one failing a process check
+const postureTestServices = `[
+	{"name": "open", "postureQueries": []},
+	{"name": "passing", "postureQueries": [
+		{"policyId": "p1", "policyType": "Dial", "isPassing": true, "postureQueries": [
+			{"id": "q-os", "queryType": "OS", "isPassing": true}
+		]}
+	]},
+	{"name": "failing", "postureQueries": [
+		{"policyId": "p2", "policyType": "Dial", "isPassing": false, "postureQueries": [
+			{"id": "q-mac", "queryType": "MAC", "isPassing": true},
+			{"id": "q-proc", "queryType": "PROCESS", "isPassing": false, "process": {"path": "C:\\av.exe"}},
+			{"id": "q-multi", "queryType": "PROCESS_MULTI", "isPassing": false, "processes": [{"path": "c:\\AV.exe"}, {"path": "/usr/bin/av"}]}
+		]},
+		{"policyId": "p3", "policyType": "Dial", "isPassing": false, "postureQueries": [
+			{"id": "q-domain", "queryType": "DOMAIN", "isPassing": false}
+		]}
+	]}
+]`
+
+func postureTestServiceList(t *testing.T) []*gabs.Container {
+	parsed, err := gabs.ParseJSON([]byte(postureTestServices))
+	require.NoError(t, err)
+	services, err := parsed.Children()
+	require.NoError(t, err)
+	return services
+}
+
+func TestPostureSimulateBuildResponses(t *testing.T) {
+	req := require.New(t)
+
+	out := &bytes.Buffer{}
+	o := &postureResponseSimulateOptions{
+		Options:        *newTestListOptions(out),
+		osType:         "Windows",
+		osVersion:      "10.0.19041",
+		macAddresses:   []string{"00:11:22:33:44:55"},
+		processes:      []string{`C:\av.exe`, `C:\other.exe`},
+		processHashes:  map[string]string{`C:\av.exe`: "abc"},
+		processSigners: map[string]string{`C:\av.exe`: "fp"},
+		unlocked:       true,
+	}
+
+	responses, err := o.buildResponses(postureTestServiceList(t))
+	req.NoError(err)
+	req.Equal([]map[string]interface{}{
+		{"id": "q-os", "typeId": "OS", "type": "Windows", "version": "10.0.19041", "build": ""},
+		{"id": "q-mac", "typeId": "MAC", "macAddresses": []string{"00:11:22:33:44:55"}},
+		{"id": "endpoint-state", "typeId": "ENDPOINT_STATE", "woken": false, "unlocked": true},
+		{"id": "q-proc", "typeId": "PROCESS", "path": `C:\av.exe`, "isRunning": true, "hash": "abc", "signerFingerprints": []string{"fp"}},
+		{"id": "q-multi", "typeId": "PROCESS", "path": `C:\av.exe`, "isRunning": true, "hash": "abc", "signerFingerprints": []string{"fp"}},
+	}, responses)
+	req.Contains(out.String(), `no process posture query found for C:\other.exe`)
+
+	// responses for query types no service checks are sent with a placeholder id
+	o = &postureResponseSimulateOptions{Options: *newTestListOptions(out), domain: "corp"}
+	responses, err = o.buildResponses(nil)
+	req.NoError(err)
+	req.Equal([]map[string]interface{}{{"id": "domain", "typeId": "DOMAIN", "domain": "corp"}}, responses)
+
+	o = &postureResponseSimulateOptions{Options: *newTestListOptions(out), processHashes: map[string]string{"/bin/av": "abc"}}
+	_, err = o.buildResponses(nil)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
+
+func TestPostureSimulateOutputResults(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectPassing []string
+		expectFailing []string
+		mismatched    string
+	}{
+		{name: "as expected", expectPassing: []string{"open", "passing"}, expectFailing: []string{"failing"}},
+		{name: "failing expected to pass", expectPassing: []string{"failing"}, mismatched: "failing"},
+		{name: "passing expected to fail", expectFailing: []string{"open", "passing"}, mismatched: "open, passing"},
+		{name: "unknown service", expectPassing: []string{"missing"}, mismatched: "missing"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			out := &bytes.Buffer{}
+			o := &postureResponseSimulateOptions{
+				Options:       *newTestListOptions(out),
+				expectPassing: test.expectPassing,
+				expectFailing: test.expectFailing,
+			}
+			o.OutputJSONResponse = true
+
+			err := o.outputResults(postureTestServiceList(t))
+			if test.mismatched == "" {
+				req.NoError(err)
+			} else {
+				req.Error(err)
+				req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+				req.Contains(err.Error(), "services: "+test.mismatched)
+			}
+
+			result := struct {
+				Data []struct {
+					Name      string `json:"name"`
+					IsPassing bool   `json:"isPassing"`
+				} `json:"data"`
+			}{}
+			req.NoError(json.Unmarshal(out.Bytes(), &result))
+			req.Len(result.Data, 3)
+			passing := map[string]bool{}
+			for _, service := range result.Data {
+				passing[service.Name] = service.IsPassing
+			}
+			req.Equal(map[string]bool{"open": true, "passing": true, "failing": false}, passing)
+		})
+	}
+}
+
+func TestPostureSimulateListServicesPages(t *testing.T) {
+	req := require.New(t)
+
+	const total = servicesPageSize + 20
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(constants.ZitiSession) != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.URL.RawQuery)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		data := []interface{}{}
+		for idx := offset; idx < total && idx < offset+limit; idx++ {
+			data = append(data, map[string]interface{}{"name": fmt.Sprintf("svc-%v", idx)})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": data,
+			"meta": map[string]interface{}{"pagination": map[string]interface{}{"limit": limit, "offset": offset, "totalCount": total}},
+		})
+	}))
+	defer server.Close()
+
+	o := &postureResponseSimulateOptions{Options: *newTestListOptions(&bytes.Buffer{})}
+	services, err := o.listServices(&clientApiSession{client: resty.New(), baseUrl: server.URL, token: "token"})
+	req.NoError(err)
+	req.Len(services, total)
+	req.Equal(fmt.Sprintf("svc-%v", total-1), services[total-1].S("name").Data())
+	req.Equal([]string{"limit=500&offset=0", "limit=500&offset=500"}, requests)
+
+	_, err = o.listServices(&clientApiSession{client: resty.New(), baseUrl: server.URL, token: "expired"})
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeAuth, cmdhelper.ExitCodeForError(err))
+}
@@ -37,10 +37,14 @@ func NewCmdEdge(out io.Writer, errOut io.Writer) *cobra.Command {
 
 func populateEdgeCommands(out io.Writer, errOut io.Writer, cmd *cobra.Command) *cobra.Command {
 	cmd.AddCommand(newCreateCmd(out, errOut))
+	cmd.AddCommand(newImportCmd(out, errOut))
 	cmd.AddCommand(newDeleteCmd(out, errOut))
+	cmd.AddCommand(newDisableCmd(out, errOut))
+	cmd.AddCommand(newEnableCmd(out, errOut))
 	cmd.AddCommand(newLoginCmd(out, errOut))
 	cmd.AddCommand(newLogoutCmd(out, errOut))
 	cmd.AddCommand(newUseCmd(out, errOut))
+	cmd.AddCommand(newDefaultFilterCmd(out, errOut))
 	cmd.AddCommand(newListCmd(out, errOut))
 	cmd.AddCommand(newUpdateCmd(out, errOut))
 	cmd.AddCommand(newVersionCmd(out, errOut))
@@ -50,6 +54,9 @@ func populateEdgeCommands(out io.Writer, errOut io.Writer, cmd *cobra.Command) *
 	cmd.AddCommand(newTraceCmd(out, errOut))
 	cmd.AddCommand(newTraceRouteCmd(out, errOut))
 	cmd.AddCommand(newShowCmd(out, errOut))
+	cmd.AddCommand(newInspectCmd(out, errOut))
+	cmd.AddCommand(newWatchCmd(out, errOut))
+	cmd.AddCommand(newPostureResponseCmd(out, errOut))
 
 	p := common.NewOptionsProvider(out, errOut)
 	cmd.AddCommand(enrollment.NewEnrollCommand(p))
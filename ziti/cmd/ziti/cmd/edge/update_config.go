@@ -36,6 +36,7 @@ type updateConfigOptions struct {
 	name     string
 	data     string
 	jsonFile string
+	setJSON  []string
 }
 
 // newUpdateConfigCmd updates the 'edge controller update service-policy' command
@@ -50,7 +51,9 @@ func newUpdateConfigCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 		Use:   "config <idOrName>",
 		Short: "updates a config managed by the Ziti Edge Controller",
 		Long:  "updates a config managed by the Ziti Edge Controller",
-		Args:  cobra.ExactArgs(1),
+		Example: `  # change a single field of the config data, leaving the rest as it is
+  ziti edge update config my-intercept --set-json '/portRanges/0/high=8443' --set-json '/addresses/-=app.example.com'`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
@@ -65,6 +68,8 @@ func newUpdateConfigCmd(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd.Flags().StringVarP(&options.name, "name", "n", "", "Set the name of the config")
 	cmd.Flags().StringVarP(&options.data, "data", "d", "", "Set the data of the config")
 	cmd.Flags().StringVarP(&options.jsonFile, "json-file", "f", "", "Read config JSON from a file instead of the command line")
+	cmd.Flags().StringArrayVar(&options.setJSON, "set-json", nil, "Set a field of the config data, given as <json pointer>=<value>, e.g. '/portRanges/0/high=8443'. "+
+		"Applied to the current config data, or to --data/--json-file if given. May be repeated")
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -100,6 +105,25 @@ func runUpdateConfig(o *updateConfigOptions) error {
 		}
 	}
 
+	var edits []*jsonPointerEdit
+	for _, edit := range o.setJSON {
+		jsonEdit, err := parseJSONPointerEdit(edit)
+		if err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		edits = append(edits, jsonEdit)
+	}
+
+	if len(edits) > 0 && len(jsonBytes) == 0 {
+		config, err := DetailEntityOfType("configs", id, o.OutputJSONResponse, o.Out, o.Timeout, o.Verbose)
+		if err != nil {
+			return err
+		}
+		if jsonBytes, err = json.Marshal(config.S("data").Data()); err != nil {
+			return err
+		}
+	}
+
 	if len(jsonBytes) > 0 {
 		dataMap := map[string]interface{}{}
 		if err := json.Unmarshal(jsonBytes, &dataMap); err != nil {
@@ -107,7 +131,18 @@ func runUpdateConfig(o *updateConfigOptions) error {
 			fmt.Printf("Failing parsing JSON: %+v\n", err)
 			return errors.Errorf("unable to parse data as json: %v", err)
 		}
-		api.SetJSONValue(entityData, dataMap, "data")
+		if dataMap == nil {
+			dataMap = map[string]interface{}{}
+		}
+
+		var data interface{} = dataMap
+		for _, edit := range edits {
+			if data, err = edit.apply(data); err != nil {
+				return cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, err)
+			}
+		}
+
+		api.SetJSONValue(entityData, data, "data")
 		change = true
 	}
 
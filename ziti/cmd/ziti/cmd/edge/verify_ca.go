@@ -163,8 +163,8 @@ func runValidateCa(options *verifyCaOptions) error {
 	return util.EdgeControllerVerify("cas", options.caId, string(options.certPemBytes), options.Out, options.OutputJSONResponse, options.Options.Timeout, options.Options.Verbose)
 }
 
-func generateCert(options *verifyCaOptions, token string) ([]byte, crypto.Signer, error) {
-
+// loadCaCertAndKey parses the CA certificate and private key, prompting for the key's password if it's encrypted
+func (options *verifyCaOptions) loadCaCertAndKey() (*x509.Certificate, crypto.Signer, error) {
 	certBlocks := nfpem.PemToX509(string(options.caCertPemBytes))
 
 	if len(certBlocks) == 0 {
@@ -216,6 +216,15 @@ func generateCert(options *verifyCaOptions, token string) ([]byte, crypto.Signer
 		return nil, nil, fmt.Errorf("key was not of correct type, could not be used as signer")
 	}
 
+	return caCert, caKey, nil
+}
+
+func generateCert(options *verifyCaOptions, token string) ([]byte, crypto.Signer, error) {
+	caCert, caKey, err := options.loadCaCertAndKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	id, _ := rand.Int(rand.Reader, big.NewInt(100000000000000000))
 	verificationCert := &x509.Certificate{
 		SerialNumber: id,
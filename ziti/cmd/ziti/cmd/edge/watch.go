@@ -0,0 +1,211 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+)
+
+// newWatchCmd creates a command object for the "edge watch" command
+func newWatchCmd(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "watches an entity managed by the Ziti Edge Controller and prints changes as they happen",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	entityTypes := []struct {
+		name       string
+		entityType string
+	}{
+		{"auth-policy", "auth-policies"},
+		{"config", "configs"},
+		{"edge-router", "edge-routers"},
+		{"edge-router-policy", "edge-router-policies"},
+		{"identity", "identities"},
+		{"posture-check", "posture-checks"},
+		{"service", "services"},
+		{"service-edge-router-policy", "service-edge-router-policies"},
+		{"service-policy", "service-policies"},
+	}
+
+	for _, t := range entityTypes {
+		cmd.AddCommand(newWatchCmdForEntityType(t.name, t.entityType, out, errOut))
+	}
+
+	return cmd
+}
+
+type watchAction struct {
+	api.Options
+	entityType string
+	interval   time.Duration
+}
+
+func newWatchCmdForEntityType(name, entityType string, out io.Writer, errOut io.Writer) *cobra.Command {
+	action := &watchAction{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{
+				Out: out,
+				Err: errOut,
+			},
+		},
+		entityType: entityType,
+	}
+
+	cmd := &cobra.Command{
+		Use:   name + " <id or name>",
+		Short: "polls the given " + name + " and prints field level changes whenever it changes",
+		Long: "Polls the given " + name + " and prints field level changes whenever it changes, stopping once it's " +
+			"deleted. Changes are stamped with the updatedAt time of the " + name + ". The controller keeps no audit " +
+			"record of who made a change, so changes can't be attributed to the identity which made them",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().DurationVar(&action.interval, "interval", 5*time.Second, "How often to poll the controller for changes")
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func (self *watchAction) run() error {
+	id, err := mapNameToID(self.entityType, self.Args[0], self.Options)
+	if err != nil {
+		return err
+	}
+
+	entity, err := self.detail(id)
+	if err != nil {
+		return err
+	}
+
+	current := flattenJson(entity.Data())
+	self.Printf("watching %v %v (%v), polling every %v. Press Ctrl-C to stop\n", self.entityType, self.Args[0], id, self.interval)
+
+	for {
+		time.Sleep(self.interval)
+
+		entity, err = self.detail(id)
+		if err != nil {
+			if cmdhelper.ExitCodeForError(err) == cmdhelper.ExitCodeNotFound {
+				self.Printf("[%v] %v %v was deleted\n", time.Now().Format(time.RFC3339), self.entityType, id)
+				return nil
+			}
+			_, _ = fmt.Fprintf(self.Err, "[%v] unable to fetch %v %v: %v\n", time.Now().Format(time.RFC3339), self.entityType, id, err)
+			continue
+		}
+
+		next := flattenJson(entity.Data())
+		changes := diffFlattenedJson(current, next)
+		if len(changes) > 0 {
+			changedAt := time.Now().Format(time.RFC3339)
+			if updatedAt, ok := next["updatedAt"]; ok {
+				changedAt = strings.Trim(updatedAt, `"`)
+			}
+			self.Printf("[%v] %v %v changed\n", changedAt, self.entityType, id)
+			for _, change := range changes {
+				self.Printf("  %v\n", change)
+			}
+		}
+		current = next
+	}
+}
+
+// detail fetches the current state of the entity, bypassing the response cache, which would hide changes
+func (self *watchAction) detail(id string) (*gabs.Container, error) {
+	result, err := util.ControllerDetailEntityUncached(util.EdgeAPI, self.entityType, id, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	return result.S("data"), nil
+}
+
+// flattenJson turns a JSON document into a map of paths to JSON encoded leaf values
+func flattenJson(val interface{}) map[string]string {
+	result := map[string]string{}
+	flattenJsonInto(result, "", val)
+	return result
+}
+
+func flattenJsonInto(result map[string]string, path string, val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if k == "_links" {
+				continue
+			}
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			flattenJsonInto(result, childPath, child)
+		}
+	case []interface{}:
+		for idx, child := range v {
+			flattenJsonInto(result, fmt.Sprintf("%v[%v]", path, idx), child)
+		}
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%v", v))
+		}
+		result[path] = string(encoded)
+	}
+}
+
+// diffFlattenedJson describes the differences between two flattened JSON documents, ignoring the updatedAt timestamp
+func diffFlattenedJson(prev, next map[string]string) []string {
+	var result []string
+	for path, prevVal := range prev {
+		if path == "updatedAt" {
+			continue
+		}
+		if nextVal, found := next[path]; !found {
+			result = append(result, fmt.Sprintf("- %v: %v", path, prevVal))
+		} else if nextVal != prevVal {
+			result = append(result, fmt.Sprintf("~ %v: %v -> %v", path, prevVal, nextVal))
+		}
+	}
+	for path, nextVal := range next {
+		if _, found := prev[path]; !found {
+			result = append(result, fmt.Sprintf("+ %v: %v", path, nextVal))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i][2:] < result[j][2:]
+	})
+	return result
+}
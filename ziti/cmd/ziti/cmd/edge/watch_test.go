@@ -0,0 +1,97 @@
+package edge
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenJson(t *testing.T) {
+	req := require.New(t)
+
+	flattened := flattenJson(map[string]interface{}{
+		"name":           "web",
+		"roleAttributes": []interface{}{"a", "b"},
+		"tags":           map[string]interface{}{"owner": "ops", "nested": map[string]interface{}{"level": 2.0}},
+		"config":         nil,
+		"_links":         map[string]interface{}{"self": map[string]interface{}{"href": "./services/1"}},
+	})
+	req.Equal(map[string]string{
+		"name":              `"web"`,
+		"roleAttributes[0]": `"a"`,
+		"roleAttributes[1]": `"b"`,
+		"tags.owner":        `"ops"`,
+		"tags.nested.level": "2",
+		"config":            "null",
+	}, flattened)
+
+	req.Equal(map[string]string{"": `"scalar"`}, flattenJson("scalar"))
+	req.Empty(flattenJson(map[string]interface{}{"roleAttributes": []interface{}{}}))
+}
+
+func TestDiffFlattenedJson(t *testing.T) {
+	tests := []struct {
+		name     string
+		prev     map[string]string
+		next     map[string]string
+		expected []string
+	}{
+		{
+			name: "unchanged",
+			prev: map[string]string{"name": `"web"`},
+			next: map[string]string{"name": `"web"`},
+		},
+		{
+			name: "only updatedAt changed",
+			prev: map[string]string{"name": `"web"`, "updatedAt": `"2022-01-01T00:00:00Z"`},
+			next: map[string]string{"name": `"web"`, "updatedAt": `"2022-01-02T00:00:00Z"`},
+		},
+		{
+			name: "changed, added and removed, sorted by path",
+			prev: map[string]string{"name": `"web"`, "roleAttributes[0]": `"a"`, "roleAttributes[1]": `"b"`},
+			next: map[string]string{"name": `"api"`, "roleAttributes[0]": `"a"`, "encryptionRequired": "true"},
+			expected: []string{
+				"+ encryptionRequired: true",
+				`~ name: "web" -> "api"`,
+				`- roleAttributes[1]: "b"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, diffFlattenedJson(test.prev, test.next))
+		})
+	}
+}
+
+func TestWatchDetail(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"services": {{"id": "svc1", "name": "web"}},
+	})
+	common.CacheTTL = time.Minute
+	defer func() { common.CacheTTL = 0 }()
+
+	action := &watchAction{Options: *newTestListOptions(&bytes.Buffer{}), entityType: "services"}
+	entity, err := action.detail("svc1")
+	req.NoError(err)
+	req.Equal("web", entity.S("name").Data())
+
+	testController.List("services")[0]["name"] = "api"
+	entity, err = action.detail("svc1")
+	req.NoError(err)
+	req.Equal("api", entity.S("name").Data(), "the response cache is bypassed")
+	req.False(common.NoCache, "the cache is still used by other requests")
+
+	testController.Fail["GET services/svc1"] = http.StatusNotFound
+	_, err = action.detail("svc1")
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeNotFound, cmdhelper.ExitCodeForError(err))
+}
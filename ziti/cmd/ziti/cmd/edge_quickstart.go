@@ -0,0 +1,403 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/edge"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/constants"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	edgeQuickstartJoinLong = templates.LongDesc(`
+Joins an additional edge router to a network created with the quickstart express install, to prototype multi-node
+topologies locally. The network's environment file is read to reuse its PKI, controller addresses and binaries. The
+router config is written next to the existing ones in ZITI_HOME, using edge and link listener ports which aren't used
+by the routers already configured there, and the router is created on the controller and enrolled.
+
+Creating the router requires being logged in to the quickstart controller, with zitiLogin or ziti edge login.
+
+Joining additional controllers isn't supported, as controller clustering isn't available in this controller version.
+	`)
+
+	edgeQuickstartJoinExample = templates.Examples(`
+		# join a second public edge router to the quickstart network of this host
+		ziti edge quickstart join edge-router-2
+
+		# join a private router, without a tunneler, to a given quickstart network
+		ziti edge quickstart join private-router --env-file ~/.ziti/quickstart/mynet/mynet.env --private --tunneler=false
+	`)
+)
+
+// EdgeQuickstartJoinOptions the options for the edge quickstart join command
+type EdgeQuickstartJoinOptions struct {
+	CommonOptions
+
+	envFile    string
+	hostname   string
+	edgePort   int
+	linkPort   int
+	private    bool
+	tunneler   bool
+	attributes []string
+	noCreate   bool
+	noEnroll   bool
+	force      bool
+}
+
+// NewCmdEdgeQuickstart creates a command object for the "edge quickstart" command
+func NewCmdEdgeQuickstart(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "quickstart",
+		Short: "Extends networks created with the quickstart",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(NewCmdEdgeQuickstartJoin(out, errOut))
+	return cmd
+}
+
+// NewCmdEdgeQuickstartJoin creates a command object for the "edge quickstart join" command
+func NewCmdEdgeQuickstartJoin(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &EdgeQuickstartJoinOptions{
+		CommonOptions: CommonOptions{
+			Out: out,
+			Err: errOut,
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "join <router name>",
+		Short:   "Joins an additional edge router to a quickstart network",
+		Long:    edgeQuickstartJoinLong,
+		Example: edgeQuickstartJoinExample,
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVar(&options.envFile, "env-file", "", "Environment file of the quickstart network. Defaults to the file of ZITI_NETWORK in ZITI_HOME, or of this host's network")
+	cmd.Flags().StringVar(&options.hostname, "hostname", "", "Hostname the router advertises its listeners on. Defaults to the hostname of this host")
+	cmd.Flags().IntVar(&options.edgePort, "edge-port", 0, "Port of the edge listener. Defaults to the first port from ZITI_EDGE_ROUTER_PORT on which isn't used by another router")
+	cmd.Flags().IntVar(&options.linkPort, "link-port", 0, fmt.Sprintf("Port of the link listener. Defaults to the first port from %v on which isn't used by another router", constants.DefaultListenerBindPort))
+	cmd.Flags().BoolVar(&options.private, "private", false, "Create a private router, which doesn't listen for links")
+	cmd.Flags().BoolVar(&options.tunneler, "tunneler", true, "Enable the tunneler of the router")
+	cmd.Flags().StringSliceVar(&options.attributes, "role-attributes", []string{"public"}, "Role attributes of the router. The quickstart's policies grant access to #public routers")
+	cmd.Flags().BoolVar(&options.noCreate, "no-create", false, "Only write the router config, without creating or enrolling the router")
+	cmd.Flags().BoolVar(&options.noEnroll, "no-enroll", false, "Create the router, but don't enroll it")
+	cmd.Flags().BoolVar(&options.force, "force", false, "Overwrite the config of an existing router with the same name")
+
+	return cmd
+}
+
+// Run implements the command
+func (o *EdgeQuickstartJoinOptions) Run() error {
+	name := o.Args[0]
+
+	envFile, err := o.quickstartEnvFile()
+	if err != nil {
+		return err
+	}
+	env, err := loadQuickstartEnv(envFile)
+	if err != nil {
+		return err
+	}
+	for key, value := range env {
+		if err = os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	home := env[constants.ZitiHomeVarName]
+	pki := env["ZITI_PKI"]
+	if home == "" || pki == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v isn't a quickstart environment file, it doesn't set ZITI_HOME and ZITI_PKI", envFile)
+	}
+
+	configFile := filepath.Join(home, name+".yaml")
+	if _, err = os.Stat(configFile); err == nil && !o.force {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "a router config already exists at %v, use --force to overwrite it", configFile)
+	}
+
+	usedPorts, err := quickstartUsedPorts(home, configFile)
+	if err != nil {
+		return err
+	}
+	edgePort := o.edgePort
+	if edgePort == 0 {
+		start, err := strconv.Atoi(stringOrDefault(env[constants.ZitiEdgeRouterPortVarName], constants.DefaultZitiEdgeRouterPort))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %v", constants.ZitiEdgeRouterPortVarName)
+		}
+		edgePort = nextQuickstartPort(start, usedPorts)
+	}
+	usedPorts[edgePort] = true
+	linkPort := o.linkPort
+	if linkPort == 0 {
+		linkPort = nextQuickstartPort(constants.DefaultListenerBindPort, usedPorts)
+	}
+
+	hostname := o.hostname
+	if hostname == "" {
+		if hostname, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+
+	identityDir := filepath.Join(pki, "routers", name)
+	if err = os.MkdirAll(identityDir, 0700); err != nil {
+		return err
+	}
+
+	values := &ConfigTemplateValues{}
+	values.populateEnvVars()
+	values.populateDefaults()
+	values.Router.Name = name
+	values.Router.IsPrivate = o.private
+	values.Router.IdentityCert = cmdhelper.NormalizePath(filepath.Join(identityDir, "client.cert"))
+	values.Router.IdentityServerCert = cmdhelper.NormalizePath(filepath.Join(identityDir, "server.cert"))
+	values.Router.IdentityKey = cmdhelper.NormalizePath(filepath.Join(identityDir, "server.key"))
+	values.Router.IdentityCA = cmdhelper.NormalizePath(filepath.Join(identityDir, "cas.cert"))
+	values.Router.Edge.Hostname = hostname
+	values.Router.Edge.Port = strconv.Itoa(edgePort)
+	values.Router.Listener.BindPort = linkPort
+
+	if err = writeQuickstartRouterConfig(configFile, values); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(o.Out, "wrote the config of router %v to %v, with edge port %v and link port %v\n", name, configFile, edgePort, linkPort)
+
+	if o.noCreate {
+		return nil
+	}
+
+	jwtFile := filepath.Join(home, name+".jwt")
+	args := []string{"create", "edge-router", name, "--jwt-output-file", jwtFile}
+	if len(o.attributes) > 0 {
+		args = append(args, "--role-attributes", strings.Join(o.attributes, ","))
+	}
+	if o.tunneler {
+		args = append(args, "--tunneler-enabled")
+	}
+	edgeCmd := edge.NewCmdEdge(o.Out, o.Err)
+	edgeCmd.SetArgs(args)
+	if err = edgeCmd.Execute(); err != nil {
+		return err
+	}
+
+	routerBinary := filepath.Join(env["ZITI_BIN_DIR"], "ziti-router")
+	if _, err = os.Stat(routerBinary); err != nil {
+		if routerBinary, err = exec.LookPath("ziti-router"); err != nil {
+			routerBinary = ""
+		}
+	}
+
+	if o.noEnroll || routerBinary == "" {
+		_, _ = fmt.Fprintf(o.Out, "enroll the router with: ziti-router enroll %v --jwt %v\n", configFile, jwtFile)
+	} else {
+		enroll := exec.Command(routerBinary, "enroll", configFile, "--jwt", jwtFile)
+		enroll.Stdout = o.Out
+		enroll.Stderr = o.Err
+		if err = enroll.Run(); err != nil {
+			return errors.Wrapf(err, "unable to enroll router %v", name)
+		}
+		_, _ = fmt.Fprintf(o.Out, "enrolled router %v\n", name)
+	}
+	_, _ = fmt.Fprintf(o.Out, "start the router with: ziti-router run %v\n", configFile)
+
+	return nil
+}
+
+// quickstartEnvFile returns the environment file of the quickstart network to join. The express install writes it to
+// ZITI_HOME, named after the network, which defaults to the hostname
+func (o *EdgeQuickstartJoinOptions) quickstartEnvFile() (string, error) {
+	if o.envFile != "" {
+		return o.envFile, nil
+	}
+
+	network := os.Getenv("ZITI_NETWORK")
+	home := os.Getenv(constants.ZitiHomeVarName)
+	if home != "" && network == "" {
+		matches, err := filepath.Glob(filepath.Join(home, "*.env"))
+		if err != nil {
+			return "", err
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+	}
+
+	if network == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+		network = hostname
+	}
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		home = filepath.Join(userHome, ".ziti", "quickstart", network)
+	}
+
+	envFile := filepath.Join(home, network+".env")
+	if _, err := os.Stat(envFile); err != nil {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no quickstart environment file found at %v, use --env-file to select one", envFile)
+	}
+	return envFile, nil
+}
+
+// loadQuickstartEnv reads the variables exported by a quickstart environment file
+func loadQuickstartEnv(envFile string) (map[string]string, error) {
+	f, err := os.Open(envFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "export ") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !found || !strings.HasPrefix(key, "ZITI_") {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		result[key] = value
+	}
+	return result, scanner.Err()
+}
+
+// quickstartConfigPorts holds the listener addresses of a router config
+type quickstartConfigPorts struct {
+	Listeners []struct {
+		Address string `yaml:"address"`
+	} `yaml:"listeners"`
+	Link struct {
+		Listeners []struct {
+			Bind string `yaml:"bind"`
+		} `yaml:"listeners"`
+	} `yaml:"link"`
+}
+
+// quickstartUsedPorts returns the ports the router configs in the quickstart home listen on, other than the given one
+func quickstartUsedPorts(home string, exclude string) (map[int]bool, error) {
+	matches, err := filepath.Glob(filepath.Join(home, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int]bool{}
+	for _, configFile := range matches {
+		if configFile == exclude {
+			continue
+		}
+		contents, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		config := &quickstartConfigPorts{}
+		if err = yaml.Unmarshal(contents, config); err != nil {
+			continue
+		}
+
+		var addresses []string
+		for _, listener := range config.Listeners {
+			addresses = append(addresses, listener.Address)
+		}
+		for _, listener := range config.Link.Listeners {
+			addresses = append(addresses, listener.Bind)
+		}
+		for _, address := range addresses {
+			if idx := strings.LastIndex(address, ":"); idx >= 0 {
+				if port, err := strconv.Atoi(address[idx+1:]); err == nil {
+					result[port] = true
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// nextQuickstartPort returns the first port from start on which isn't used by a router config and which is free
+func nextQuickstartPort(start int, used map[int]bool) int {
+	for port := start; port < 65536; port++ {
+		if used[port] {
+			continue
+		}
+		if listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port)); err == nil {
+			_ = listener.Close()
+			return port
+		}
+	}
+	return start
+}
+
+func writeQuickstartRouterConfig(configFile string, values *ConfigTemplateValues) error {
+	tmpl, err := template.New("edge-router-config").Parse(routerConfigEdgeTemplate)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(configFile)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create config file: %s", configFile)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err = tmpl.Execute(f, values); err != nil {
+		return errors.Wrap(err, "unable to execute template")
+	}
+	return nil
+}
+
+func stringOrDefault(val, defaultVal string) string {
+	if val == "" {
+		return defaultVal
+	}
+	return val
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestEdgeQuickstartJoin(t *testing.T) {
+	req := require.New(t)
+
+	home := t.TempDir()
+	for _, key := range []string{"ZITI_HOME", "ZITI_PKI", "ZITI_NETWORK", "ZITI_EDGE_ROUTER_PORT", "ZITI_CTRL_ADVERTISED_ADDRESS", "ZITI_CTRL_PORT"} {
+		t.Setenv(key, "")
+	}
+
+	envFile := filepath.Join(home, "qs.env")
+	req.NoError(ioutil.WriteFile(envFile, []byte(fmt.Sprintf(`
+export ZITI_HOME="%v"
+export ZITI_PKI="%v/pki"
+export ZITI_NETWORK="qs"
+export ZITI_EDGE_ROUTER_PORT="43022"
+export ZITI_CTRL_ADVERTISED_ADDRESS="ctrl.qs"
+export ZITI_CTRL_PORT="6262"
+alias zec='ziti edge'
+`, home, home)), 0600))
+
+	existing := "v: 3\nlisteners:\n  - binding: edge\n    address: tls:0.0.0.0:43022\nlink:\n  listeners:\n    - binding: transport\n      bind: tls:0.0.0.0:10080\n"
+	req.NoError(ioutil.WriteFile(filepath.Join(home, "qs-edge-router.yaml"), []byte(existing), 0600))
+
+	cmd := NewCmdEdgeQuickstart(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"join", "router-2", "--env-file", envFile, "--hostname", "router-2.qs", "--no-create"})
+	req.NoError(cmd.Execute())
+
+	contents, err := ioutil.ReadFile(filepath.Join(home, "router-2.yaml"))
+	req.NoError(err)
+
+	config := &quickstartConfigPorts{}
+	req.NoError(yaml.Unmarshal(contents, config))
+	req.Len(config.Listeners, 2)
+	req.NotEqual("tls:0.0.0.0:43022", config.Listeners[0].Address)
+	req.Len(config.Link.Listeners, 1)
+	req.NotEqual("tls:0.0.0.0:10080", config.Link.Listeners[0].Bind)
+	req.Contains(string(contents), "endpoint:             tls:ctrl.qs:6262")
+	req.Contains(string(contents), filepath.Join(home, "pki", "routers", "router-2", "server.key"))
+	req.DirExists(filepath.Join(home, "pki", "routers", "router-2"))
+
+	used, err := quickstartUsedPorts(home, "")
+	req.NoError(err)
+	req.True(used[43022])
+	req.True(used[10080])
+	req.Len(used, 4)
+
+	options := &EdgeQuickstartJoinOptions{envFile: envFile, noCreate: true}
+	options.Out = ioutil.Discard
+	options.Args = []string{"router-2"}
+	req.Error(options.Run())
+}
@@ -0,0 +1,259 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/openziti/fabric/rest_client/circuit"
+	"github.com/openziti/fabric/rest_client/link"
+	"github.com/openziti/fabric/rest_client/router"
+	"github.com/openziti/fabric/rest_client/terminator"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+)
+
+// The functions in this file implement fabric management operations independently of cobra, so they can be
+// used by other Go programs as well as by the CLI commands. They use the currently selected CLI login.
+
+// ListRouters returns the routers matching the given filter. An empty filter returns the first page of routers
+func ListRouters(ctx context.Context, o *api.Options, filter string) ([]*rest_model.RouterDetail, *api.Paging, error) {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := &router.ListRoutersParams{Context: ctx}
+	if filter != "" {
+		if filter, err = util.ExpandFilterTimes(filter, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		params.Filter = &filter
+	}
+
+	resp, err := client.Router.ListRouters(params)
+	if err != nil {
+		return nil, nil, util.WrapIfApiError(err)
+	}
+
+	return resp.Payload.Data, newPaging(resp.Payload.Meta), nil
+}
+
+// DetailRouter returns the router with the given id
+func DetailRouter(ctx context.Context, o *api.Options, id string) (*rest_model.RouterDetail, error) {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Router.DetailRouter(&router.DetailRouterParams{ID: id, Context: ctx})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+
+	return resp.Payload.Data, nil
+}
+
+// SetRouterNoTraversal sets whether the router with the given id may be used for transit by circuits
+func SetRouterNoTraversal(ctx context.Context, o *api.Options, id string, noTraversal bool) error {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Router.PatchRouter(&router.PatchRouterParams{
+		ID:      id,
+		Router:  &rest_model.RouterPatch{NoTraversal: &noTraversal},
+		Context: ctx,
+	})
+	return util.WrapIfApiError(err)
+}
+
+// ListCircuits returns all circuits known to the controller. The circuits API doesn't support filtering
+func ListCircuits(ctx context.Context, o *api.Options) ([]*rest_model.CircuitDetail, error) {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Circuit.ListCircuits(&circuit.ListCircuitsParams{Context: ctx})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+
+	return resp.Payload.Data, nil
+}
+
+// ListTerminators returns the terminators matching the given filter. An empty filter returns the first page of terminators
+func ListTerminators(ctx context.Context, o *api.Options, filter string) ([]*rest_model.TerminatorDetail, *api.Paging, error) {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := &terminator.ListTerminatorsParams{Context: ctx}
+	if filter != "" {
+		if filter, err = util.ExpandFilterTimes(filter, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		params.Filter = &filter
+	}
+
+	resp, err := client.Terminator.ListTerminators(params)
+	if err != nil {
+		return nil, nil, util.WrapIfApiError(err)
+	}
+
+	return resp.Payload.Data, newPaging(resp.Payload.Meta), nil
+}
+
+// ListLinks returns all links known to the controller. The links API doesn't support filtering
+func ListLinks(ctx context.Context, o *api.Options) ([]*rest_model.LinkDetail, error) {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Link.ListLinks(&link.ListLinksParams{Context: ctx})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+
+	return resp.Payload.Data, nil
+}
+
+// SetLinkStaticCost sets the static cost of the link with the given id
+func SetLinkStaticCost(ctx context.Context, o *api.Options, id string, staticCost int64) error {
+	if staticCost < 1 || staticCost > math.MaxUint16 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "Invalid static cost %v. Must be between 1 and %v", staticCost, math.MaxUint16)
+	}
+
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Link.PatchLink(&link.PatchLinkParams{
+		ID:      id,
+		Link:    &rest_model.LinkPatch{StaticCost: staticCost},
+		Context: ctx,
+	})
+	return util.WrapIfApiError(err)
+}
+
+// TerminatorUpdate describes changes to make to a terminator. Only non-nil fields are changed
+type TerminatorUpdate struct {
+	Router     *string
+	Address    *string
+	Binding    *string
+	Cost       *int32
+	Precedence *string
+}
+
+// UpdateTerminator applies the given changes to the terminator with the given id. The router may be given by id or name
+func UpdateTerminator(ctx context.Context, o *api.Options, id string, update *TerminatorUpdate) error {
+	patch := &rest_model.TerminatorPatch{}
+	change := false
+
+	if update.Router != nil {
+		routerId, err := api.MapNameToID(util.FabricAPI, "routers", o, *update.Router)
+		if err != nil {
+			return err
+		}
+		patch.Router = routerId
+		change = true
+	}
+
+	if update.Binding != nil {
+		patch.Binding = *update.Binding
+		change = true
+	}
+
+	if update.Address != nil {
+		patch.Address = *update.Address
+		change = true
+	}
+
+	if update.Cost != nil {
+		if *update.Cost < 0 || *update.Cost > math.MaxUint16 {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "Invalid cost %v. Must be positive number less than or equal to %v", *update.Cost, math.MaxUint16)
+		}
+		cost := rest_model.TerminatorCost(*update.Cost)
+		patch.Cost = &cost
+		change = true
+	}
+
+	if update.Precedence != nil {
+		validValues := []string{"default", "required", "failed"}
+		if !stringz.Contains(validValues, *update.Precedence) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "Invalid precedence %v. Must be one of %+v", *update.Precedence, validValues)
+		}
+		patch.Precedence = rest_model.TerminatorPrecedence(*update.Precedence)
+		change = true
+	}
+
+	if !change {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no change specified. must specify at least one attribute to change")
+	}
+
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Terminator.PatchTerminator(&terminator.PatchTerminatorParams{
+		ID:         id,
+		Terminator: patch,
+		Context:    ctx,
+	})
+	return util.WrapIfApiError(err)
+}
+
+// DeleteTerminator deletes the terminator with the given id
+func DeleteTerminator(ctx context.Context, o *api.Options, id string) error {
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Terminator.DeleteTerminator(&terminator.DeleteTerminatorParams{ID: id, Context: ctx})
+	return util.WrapIfApiError(err)
+}
+
+func newPaging(meta *rest_model.Meta) *api.Paging {
+	paging := &api.Paging{}
+	if meta == nil || meta.Pagination == nil {
+		paging.SetError(errors.New("meta.pagination section not found in result"))
+		return paging
+	}
+	if meta.Pagination.Limit != nil {
+		paging.Limit = *meta.Pagination.Limit
+	}
+	if meta.Pagination.Offset != nil {
+		paging.Offset = *meta.Pagination.Offset
+	}
+	if meta.Pagination.TotalCount != nil {
+		paging.Count = *meta.Pagination.TotalCount
+	}
+	return paging
+}
@@ -0,0 +1,26 @@
+package fabric
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/fakecontroller"
+	"github.com/spf13/cobra"
+)
+
+// testController is the fake controller the commands under test log in to, shared by all tests of the package
+var testController = &fakecontroller.Controller{}
+
+func TestMain(m *testing.M) {
+	os.Exit(fakecontroller.Run(m, testController))
+}
+
+// newTestOptions returns options for running a command with the given arguments, writing its output to out
+func newTestOptions(out *bytes.Buffer, args ...string) api.Options {
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+	return api.Options{CommonOptions: common.CommonOptions{Out: out, Cmd: cmd, Args: args}}
+}
@@ -17,9 +17,12 @@
 package fabric
 
 import (
+	"fmt"
+
 	"github.com/Jeffail/gabs"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +30,7 @@ type createServiceOptions struct {
 	api.Options
 	terminatorStrategy string
 	tags               map[string]string
+	terminators        []string
 }
 
 // newCreateServiceCmd creates the 'fabric create service' command for the given entity type
@@ -50,6 +54,9 @@ func newCreateServiceCmd(p common.OptionsProvider) *cobra.Command {
 	cmd.Flags().SetInterspersed(true)
 	cmd.Flags().StringToStringVarP(&options.tags, "tags", "t", nil, "Add tags to service definition")
 	cmd.Flags().StringVar(&options.terminatorStrategy, "terminator-strategy", "", "Specifies the terminator strategy for the service")
+	cmd.Flags().StringArrayVar(&options.terminators, "terminator", nil, "Create a terminator for the service, given as "+
+		"router=<router>,address=<address>[,binding=<binding>][,instance=<instance id>][,precedence=<precedence>][,cost=<cost>]. May be repeated. "+
+		"If any terminator can't be created, the service and the terminators created before it are removed again")
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -58,14 +65,73 @@ func newCreateServiceCmd(p common.OptionsProvider) *cobra.Command {
 // createService implements the command to create a service
 func (o *createServiceOptions) createService(_ *cobra.Command, args []string) (err error) {
 	o.Args = args
-	entityData := gabs.New()
-	api.SetJSONValue(entityData, args[0], "name")
-	if o.terminatorStrategy != "" {
-		api.SetJSONValue(entityData, o.terminatorStrategy, "terminatorStrategy")
+
+	var specs []*terminatorSpec
+	for _, val := range o.terminators {
+		spec, err := parseTerminatorSpec(val)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, spec)
+	}
+
+	if err = validateTerminatorSpecs(specs); err != nil {
+		return err
+	}
+
+	// routers are looked up first, so a typo doesn't get as far as creating the service
+	routerIds := map[string]string{}
+	for _, spec := range specs {
+		if _, found := routerIds[spec.router]; !found {
+			if routerIds[spec.router], err = api.MapNameToID(util.FabricAPI, "routers", &o.Options, spec.router); err != nil {
+				return err
+			}
+		}
 	}
 
-	api.SetJSONValue(entityData, o.tags, "tags")
+	// the service and its terminators are created as a plan, so the service is removed again if a terminator can't be
+	// created
+	plan := api.NewPlan(&o.Options)
+	service := plan.CreateEntity(util.FabricAPI, "services", "create service "+args[0], func() *gabs.Container {
+		entityData := gabs.New()
+		api.SetJSONValue(entityData, args[0], "name")
+		if o.terminatorStrategy != "" {
+			api.SetJSONValue(entityData, o.terminatorStrategy, "terminatorStrategy")
+		}
+		api.SetJSONValue(entityData, o.tags, "tags")
+		return entityData
+	})
 
-	result, err := createEntityOfType("services", entityData.String(), &o.Options)
-	return o.LogCreateResult("service", result, err)
+	var terminators []*api.PlanEntity
+	for _, spec := range specs {
+		spec := spec
+		description := fmt.Sprintf("create terminator for router %v and address %v", spec.router, spec.address)
+		terminators = append(terminators, plan.CreateEntity(util.FabricAPI, "terminators", description, func() *gabs.Container {
+			entityData := gabs.New()
+			api.SetJSONValue(entityData, service.Id, "service")
+			api.SetJSONValue(entityData, routerIds[spec.router], "router")
+			api.SetJSONValue(entityData, spec.binding, "binding")
+			api.SetJSONValue(entityData, spec.address, "address")
+			api.SetJSONValue(entityData, spec.instanceId, "instanceId")
+			if spec.cost > 0 {
+				api.SetJSONValue(entityData, spec.cost, "cost")
+			}
+			if spec.precedence != "" {
+				api.SetJSONValue(entityData, spec.precedence, "precedence")
+			}
+			return entityData
+		}))
+	}
+
+	if err = plan.Execute(); err != nil {
+		return err
+	}
+
+	if !o.OutputJSONResponse {
+		o.Printf("New service %v created with id: %v\n", args[0], service.Id)
+		for idx, spec := range specs {
+			o.Printf("New terminator for router %v and address %v created with id: %v\n", spec.router, spec.address, terminators[idx].Id)
+		}
+	}
+	return nil
 }
@@ -17,24 +17,23 @@
 package fabric
 
 import (
-	"fmt"
+	"encoding/base64"
 	"github.com/Jeffail/gabs"
 	"github.com/openziti/edge/router/xgress_edge_transport"
-	"github.com/openziti/foundation/v2/stringz"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/openziti/ziti/ziti/cmd/ziti/util"
 	"github.com/spf13/cobra"
-	"math"
 )
 
 type createTerminatorOptions struct {
 	api.Options
-	binding    string
-	cost       int32
-	precedence string
-	instanceId string
+	binding        string
+	cost           int32
+	precedence     string
+	instanceId     string
+	instanceSecret string
 }
 
 // newCreateTerminatorCmd creates the 'fabric create terminator' command
@@ -61,7 +60,8 @@ func newCreateTerminatorCmd(p common.OptionsProvider) *cobra.Command {
 	cmd.Flags().StringVar(&options.binding, "binding", xgress_edge_transport.BindingName, "Set the terminator binding")
 	cmd.Flags().Int32VarP(&options.cost, "cost", "c", 0, "Set the terminator cost")
 	cmd.Flags().StringVarP(&options.precedence, "precedence", "p", "", "Set the terminator precedence ('default', 'required' or 'failed')")
-	cmd.Flags().StringVar(&options.instanceId, "instance-id", "", "Set the terminator instance-id")
+	cmd.Flags().StringVar(&options.instanceId, "instance-id", "", "Set the terminator instance-id, which lets dialers address this terminator specifically")
+	cmd.Flags().StringVar(&options.instanceSecret, "instance-secret", "", "Set the secret another terminator must present to share the instance-id")
 	options.AddCommonFlags(cmd)
 
 	return cmd
@@ -69,6 +69,14 @@ func newCreateTerminatorCmd(p common.OptionsProvider) *cobra.Command {
 
 // runCreateTerminator implements the command to create a Terminator
 func runCreateTerminator(o *createTerminatorOptions) (err error) {
+	if err = validateTerminatorSettings(o.instanceId, o.precedence, int(o.cost)); err != nil {
+		return err
+	}
+
+	if o.instanceSecret != "" && o.instanceId == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--instance-secret requires --instance-id")
+	}
+
 	entityData := gabs.New()
 	service, err := api.MapNameToID(util.FabricAPI, "services", &o.Options, o.Args[0])
 	if err != nil {
@@ -85,23 +93,13 @@ func runCreateTerminator(o *createTerminatorOptions) (err error) {
 	api.SetJSONValue(entityData, o.binding, "binding")
 	api.SetJSONValue(entityData, o.Args[2], "address")
 	api.SetJSONValue(entityData, o.instanceId, "instanceId")
+	if o.instanceSecret != "" {
+		api.SetJSONValue(entityData, base64.StdEncoding.EncodeToString([]byte(o.instanceSecret)), "instanceSecret")
+	}
 	if o.cost > 0 {
-		if o.cost > math.MaxUint16 {
-			if _, err = fmt.Fprintf(o.Out, "Invalid cost %v. Must be positive number less than or equal to %v\n", o.cost, math.MaxUint16); err != nil {
-				panic(err)
-			}
-			return
-		}
 		api.SetJSONValue(entityData, o.cost, "cost")
 	}
 	if o.precedence != "" {
-		validValues := []string{"default", "required", "failed"}
-		if !stringz.Contains(validValues, o.precedence) {
-			if _, err = fmt.Fprintf(o.Out, "Invalid precedence %v. Must be one of %+v\n", o.precedence, validValues); err != nil {
-				panic(err)
-			}
-			return
-		}
 		api.SetJSONValue(entityData, o.precedence, "precedence")
 	}
 
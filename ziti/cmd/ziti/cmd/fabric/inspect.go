@@ -17,7 +17,11 @@ import (
 // newListCmd creates a command object for the "controller list" command
 func newInspectCmd(p common.OptionsProvider) *cobra.Command {
 	listCmd := &InspectCmd{Options: api.Options{CommonOptions: p()}}
-	return listCmd.newCobraCmd()
+	cmd := listCmd.newCobraCmd()
+	cmd.AddCommand(newInspectRouterCmd(p))
+	cmd.AddCommand(newInspectLinkCmd(p))
+	cmd.AddCommand(newInspectControllerCmd(p))
+	return cmd
 }
 
 type InspectCmd struct {
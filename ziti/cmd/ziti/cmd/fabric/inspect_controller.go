@@ -0,0 +1,533 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/agent"
+	"github.com/openziti/channel"
+	"github.com/openziti/fabric/controller"
+	"github.com/openziti/fabric/pb/mgmt_pb"
+	"github.com/openziti/fabric/rest_client/inspect"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/identity"
+	"github.com/openziti/metrics/metrics_pb"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ctrlLatencyHistogramPrefix   = "ctrl.latency:"
+	ctrlQueueTimeHistogramPrefix = "ctrl.queue_time:"
+)
+
+func newInspectControllerCmd(p common.OptionsProvider) *cobra.Command {
+	action := &inspectControllerCmd{Options: api.Options{CommonOptions: p()}}
+	return action.newCobraCmd()
+}
+
+type inspectControllerCmd struct {
+	api.Options
+	useAgent    bool
+	agentTarget string
+}
+
+func (self *inspectControllerCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "controller [controller id]",
+		Short: "Show the controller's runtime internals in one view",
+		Long: "Show the controller's runtime internals in one view: the latency and send queue time of the control " +
+			"channel of each router, the number of connected routers, API sessions and sessions, gauges and timers, and " +
+			"the controller's goroutines, grouped by state. Use --agent, when running on the controller's host, to also " +
+			"show its raft cluster members and go memory stats through the controller's IPC agent, which aren't " +
+			"available through the management API",
+		Args: cobra.MaximumNArgs(1),
+		RunE: self.run,
+	}
+	cmd.Flags().BoolVar(&self.useAgent, "agent", false, "Also show raft members and memory stats from the IPC agent of a controller running on this host")
+	cmd.Flags().StringVar(&self.agentTarget, "agent-target", "", "The pid or address of the controller's IPC agent, if there's more than one agent on this host")
+	self.AddCommonFlags(cmd)
+	return cmd
+}
+
+// controllerInspection is a snapshot of the controller's runtime internals
+type controllerInspection struct {
+	ControllerId     string                      `json:"controllerId"`
+	TakenAt          time.Time                   `json:"takenAt"`
+	Routers          int                         `json:"routers"`
+	ConnectedRouters int                         `json:"connectedRouters"`
+	ApiSessions      *int64                      `json:"apiSessions,omitempty"`
+	Sessions         *int64                      `json:"sessions,omitempty"`
+	ControlChannels  []*controlChannelInspection `json:"controlChannels"`
+	Gauges           map[string]int64            `json:"gauges,omitempty"`
+	Timers           map[string]*controllerTimer `json:"timers,omitempty"`
+	Goroutines       int                         `json:"goroutines"`
+	GoroutineStates  map[string]int              `json:"goroutineStates"`
+	Raft             []*controllerRaftMember     `json:"raft,omitempty"`
+	Runtime          map[string]string           `json:"runtime,omitempty"`
+	Errors           []string                    `json:"errors,omitempty"`
+}
+
+// controlChannelInspection is the control channel between the controller and a router, as seen by the controller
+type controlChannelInspection struct {
+	RouterId       string        `json:"routerId"`
+	RouterName     string        `json:"routerName"`
+	LatencyP50     time.Duration `json:"latencyP50"`
+	LatencyP99     time.Duration `json:"latencyP99"`
+	QueueTimeP50   time.Duration `json:"queueTimeP50"`
+	QueueTimeP99   time.Duration `json:"queueTimeP99"`
+	QueueTimeMax   time.Duration `json:"queueTimeMax"`
+	LatencySamples int64         `json:"latencySamples"`
+}
+
+type controllerTimer struct {
+	Count    int64         `json:"count"`
+	Mean     time.Duration `json:"mean"`
+	P99      time.Duration `json:"p99"`
+	RateM1   float64       `json:"rateM1"`
+	MaxValue time.Duration `json:"max"`
+}
+
+type controllerRaftMember struct {
+	Id       string `json:"id"`
+	Addr     string `json:"addr"`
+	IsVoter  bool   `json:"isVoter"`
+	IsLeader bool   `json:"isLeader"`
+}
+
+func (self *inspectControllerCmd) run(cmd *cobra.Command, args []string) error {
+	self.Cmd = cmd
+	self.Args = args
+
+	controllerId := ""
+	if len(args) > 0 {
+		controllerId = args[0]
+	} else {
+		var err error
+		if controllerId, err = discoverControllerId(&self.Options); err != nil {
+			return err
+		}
+	}
+
+	inspection := &controllerInspection{
+		ControllerId:    controllerId,
+		TakenAt:         time.Now(),
+		GoroutineStates: map[string]int{},
+	}
+
+	if err := self.inspectValues(inspection); err != nil {
+		return err
+	}
+	if err := self.inspectRouters(inspection); err != nil {
+		return err
+	}
+	self.countSessions(inspection)
+	if self.useAgent {
+		self.inspectAgent(inspection)
+	}
+
+	if self.OutputJSONResponse {
+		data, err := json.MarshalIndent(inspection, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Println(string(data))
+		return nil
+	}
+
+	self.outputInspection(inspection)
+	return nil
+}
+
+// discoverControllerId returns the id of the controller. The management API doesn't expose it, but inspections are
+// answered by the controller and every connected router under their ids, so the controller is the one answering which
+// isn't a router
+func discoverControllerId(options *api.Options) (string, error) {
+	// the responses of these lookups aren't part of the inspection, so aren't output with -j
+	quiet := *options
+	quiet.OutputJSONResponse = false
+	o := &quiet
+
+	client, err := util.NewFabricManagementClient(o)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := o.TimeoutContext()
+	defer cancel()
+
+	routers, _, err := ListRouters(ctx, o, "true limit none")
+	if err != nil {
+		return "", err
+	}
+	var routerIds []string
+	for _, detail := range routers {
+		routerIds = append(routerIds, stringz.OrEmpty(detail.ID))
+	}
+
+	appRegex := ".*"
+	inspectOk, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: []string{"metrics"},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return "", util.WrapIfApiError(err)
+	}
+
+	return controllerAppId(inspectOk.Payload.Values, routerIds)
+}
+
+// controllerAppId returns the id of the only app answering an inspection which isn't one of the routers
+func controllerAppId(values []*rest_model.InspectResponseValue, routerIds []string) (string, error) {
+	var candidates []string
+	for _, value := range values {
+		appId := stringz.OrEmpty(value.AppID)
+		if appId != "" && !stringz.Contains(routerIds, appId) && !stringz.Contains(candidates, appId) {
+			candidates = append(candidates, appId)
+		}
+	}
+	if len(candidates) != 1 {
+		return "", errors.Errorf("unable to determine the controller's id from %v candidates, pass it as an argument", len(candidates))
+	}
+	return candidates[0], nil
+}
+
+// inspectValues fills in the inspection from the controller's metrics and stack dump
+func (self *inspectControllerCmd) inspectValues(inspection *controllerInspection) error {
+	// with -j the inspection is output as a whole, rather than each response
+	client, err := util.NewFabricManagementClient(api.QuietClientOpts{Options: &self.Options})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	appRegex := "^" + regexp.QuoteMeta(inspection.ControllerId) + "$"
+	inspectOk, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: []string{"metrics", "stackdump"},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return util.WrapIfApiError(err)
+	}
+
+	inspection.Errors = append(inspection.Errors, inspectOk.Payload.Errors...)
+	if len(inspectOk.Payload.Values) == 0 {
+		return errors.Errorf("controller %v returned no inspection values, check the controller id", inspection.ControllerId)
+	}
+
+	for _, value := range inspectOk.Payload.Values {
+		data, err := inspectValueBytes(value.Value)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(stringz.OrEmpty(value.Name)) {
+		case "metrics":
+			msg := &metrics_pb.MetricsMessage{}
+			if err := json.Unmarshal(data, msg); err != nil {
+				return errors.Wrap(err, "unable to parse metrics inspection result")
+			}
+			applyControllerMetrics(inspection, msg)
+		case "stackdump":
+			var stack string
+			if err := json.Unmarshal(data, &stack); err != nil {
+				stack = string(data)
+			}
+			inspection.Goroutines, inspection.GoroutineStates = countGoroutines(stack)
+		}
+	}
+	return nil
+}
+
+// applyControllerMetrics fills in the control channels, gauges and timers of the inspection from the metrics message
+func applyControllerMetrics(inspection *controllerInspection, msg *metrics_pb.MetricsMessage) {
+	channels := map[string]*controlChannelInspection{}
+	getChannel := func(routerId string) *controlChannelInspection {
+		result, found := channels[routerId]
+		if !found {
+			result = &controlChannelInspection{RouterId: routerId}
+			channels[routerId] = result
+		}
+		return result
+	}
+
+	for name, histogram := range msg.Histograms {
+		if strings.HasPrefix(name, ctrlLatencyHistogramPrefix) {
+			ch := getChannel(strings.TrimPrefix(name, ctrlLatencyHistogramPrefix))
+			ch.LatencyP50 = time.Duration(histogram.P50)
+			ch.LatencyP99 = time.Duration(histogram.P99)
+			ch.LatencySamples = histogram.Count
+		} else if strings.HasPrefix(name, ctrlQueueTimeHistogramPrefix) {
+			ch := getChannel(strings.TrimPrefix(name, ctrlQueueTimeHistogramPrefix))
+			ch.QueueTimeP50 = time.Duration(histogram.P50)
+			ch.QueueTimeP99 = time.Duration(histogram.P99)
+			ch.QueueTimeMax = time.Duration(histogram.Max)
+		}
+	}
+
+	inspection.ControlChannels = nil
+	for _, ch := range channels {
+		inspection.ControlChannels = append(inspection.ControlChannels, ch)
+	}
+	// the slowest control channels first, as they're the ones needing attention
+	sort.Slice(inspection.ControlChannels, func(i, j int) bool {
+		a, b := inspection.ControlChannels[i], inspection.ControlChannels[j]
+		if a.QueueTimeP99 != b.QueueTimeP99 {
+			return a.QueueTimeP99 > b.QueueTimeP99
+		}
+		return a.RouterId < b.RouterId
+	})
+
+	inspection.Gauges = msg.IntValues
+
+	inspection.Timers = map[string]*controllerTimer{}
+	for name, timer := range msg.Timers {
+		inspection.Timers[name] = &controllerTimer{
+			Count:    timer.Count,
+			Mean:     time.Duration(timer.Mean),
+			P99:      time.Duration(timer.P99),
+			RateM1:   timer.M1Rate,
+			MaxValue: time.Duration(timer.Max),
+		}
+	}
+}
+
+var goroutineHeader = regexp.MustCompile(`^goroutine \d+ \[([^,\]]+)`)
+
+// countGoroutines returns the number of goroutines in a stack dump, and how many are in each state
+func countGoroutines(stack string) (int, map[string]int) {
+	states := map[string]int{}
+	count := 0
+	scanner := bufio.NewScanner(strings.NewReader(stack))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if match := goroutineHeader.FindStringSubmatch(scanner.Text()); match != nil {
+			count++
+			states[match[1]]++
+		}
+	}
+	return count, states
+}
+
+// inspectRouters counts the routers and the open control channels, and names the routers of the control channels
+func (self *inspectControllerCmd) inspectRouters(inspection *controllerInspection) error {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	routers, _, err := ListRouters(ctx, &self.Options, "true limit none")
+	if err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+	inspection.Routers = len(routers)
+	for _, router := range routers {
+		names[stringz.OrEmpty(router.ID)] = stringz.OrEmpty(router.Name)
+		if router.Connected != nil && *router.Connected {
+			inspection.ConnectedRouters++
+		}
+	}
+	for _, ch := range inspection.ControlChannels {
+		ch.RouterName = names[ch.RouterId]
+	}
+	return nil
+}
+
+// countSessions counts the API sessions and sessions, if logged in to the edge management API
+func (self *inspectControllerCmd) countSessions(inspection *controllerInspection) {
+	count := func(entityType string) *int64 {
+		_, paging, err := api.FilterEntitiesOfType(util.EdgeAPI, entityType, "true limit 1", false, self.Out, self.Timeout, self.Verbose)
+		if err != nil {
+			inspection.Errors = append(inspection.Errors, fmt.Sprintf("unable to count %v: %v", entityType, err))
+			return nil
+		}
+		if paging.HasError() {
+			inspection.Errors = append(inspection.Errors, fmt.Sprintf("unable to count %v: %v", entityType, paging.Err))
+			return nil
+		}
+		return &paging.Count
+	}
+	inspection.ApiSessions = count("api-sessions")
+	inspection.Sessions = count("sessions")
+}
+
+// inspectAgent fills in the raft members and go runtime stats from the controller's IPC agent
+func (self *inspectControllerCmd) inspectAgent(inspection *controllerInspection) {
+	addr := ""
+	if self.agentTarget != "" {
+		var err error
+		if addr, err = agent.ParseGopsAddress([]string{self.agentTarget}); err != nil {
+			inspection.Errors = append(inspection.Errors, fmt.Sprintf("invalid agent target %v: %v", self.agentTarget, err))
+			return
+		}
+	}
+
+	inspection.Runtime = map[string]string{}
+	for _, op := range []byte{agent.Stats, agent.MemStats} {
+		out := &bytes.Buffer{}
+		if err := agent.MakeRequest(addr, op, nil, out); err != nil {
+			inspection.Errors = append(inspection.Errors, fmt.Sprintf("unable to query controller agent: %v", err))
+			return
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if key, val, found := strings.Cut(line, ":"); found {
+				inspection.Runtime[strings.TrimSpace(key)] = strings.TrimSpace(val)
+			}
+		}
+	}
+
+	err := agent.MakeRequestF(addr, agent.CustomOpAsync, []byte{controller.AgentAppId}, func(conn net.Conn) error {
+		options := channel.DefaultOptions()
+		options.ConnectTimeout = time.Second
+		dialer := channel.NewExistingConnDialer(&identity.TokenId{Token: "agent"}, conn, nil)
+		ch, err := channel.NewChannel("agent", dialer, nil, options)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = ch.Close() }()
+
+		msg := channel.NewMessage(int32(mgmt_pb.ContentType_RaftListMembersRequestType), nil)
+		reply, err := msg.WithTimeout(5 * time.Second).SendForReply(ch)
+		if err != nil {
+			return err
+		}
+		if reply.ContentType == channel.ContentTypeResultType {
+			if result := channel.UnmarshalResult(reply); !result.Success {
+				return errors.New(result.Message)
+			}
+			return nil
+		}
+		resp := &mgmt_pb.RaftMemberListResponse{}
+		if err = proto.Unmarshal(reply.Body, resp); err != nil {
+			return err
+		}
+		for _, m := range resp.Members {
+			inspection.Raft = append(inspection.Raft, &controllerRaftMember{Id: m.Id, Addr: m.Addr, IsVoter: m.IsVoter, IsLeader: m.IsLeader})
+		}
+		return nil
+	})
+	if err != nil {
+		inspection.Errors = append(inspection.Errors, fmt.Sprintf("unable to list raft members: %v", err))
+	}
+}
+
+func (self *inspectControllerCmd) outputInspection(inspection *controllerInspection) {
+	self.Printf("controller %v, inspected %v\n\n", inspection.ControllerId, inspection.TakenAt.Format(time.RFC3339))
+
+	sessionCount := func(count *int64) string {
+		if count == nil {
+			return "unknown"
+		}
+		return fmt.Sprintf("%v", *count)
+	}
+	self.Printf("routers: %v connected of %v\n", inspection.ConnectedRouters, inspection.Routers)
+	self.Printf("api sessions: %v, sessions: %v\n", sessionCount(inspection.ApiSessions), sessionCount(inspection.Sessions))
+
+	var states []string
+	for state, count := range inspection.GoroutineStates {
+		states = append(states, fmt.Sprintf("%v: %v", state, count))
+	}
+	sort.Strings(states)
+	self.Printf("goroutines: %v (%v)\n\n", inspection.Goroutines, strings.Join(states, ", "))
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.SetTitle("Control Channels")
+	t.AppendHeader(table.Row{"Router", "Latency P50", "Latency P99", "Queue Time P50", "Queue Time P99", "Queue Time Max"})
+	for _, ch := range inspection.ControlChannels {
+		name := ch.RouterName
+		if name == "" {
+			name = ch.RouterId
+		}
+		t.AppendRow(table.Row{name, ch.LatencyP50, ch.LatencyP99, ch.QueueTimeP50, ch.QueueTimeP99, ch.QueueTimeMax})
+	}
+	api.RenderTable(&self.Options, t, nil)
+
+	if len(inspection.Timers) > 0 || len(inspection.Gauges) > 0 {
+		t = table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.SetTitle("Gauges and Timers")
+		t.AppendHeader(table.Row{"Name", "Value", "Count", "Mean", "P99", "Max", "Rate/s (1m)"})
+		var names []string
+		for name := range inspection.Gauges {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t.AppendRow(table.Row{name, inspection.Gauges[name], "", "", "", "", ""})
+		}
+		names = nil
+		for name := range inspection.Timers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			timer := inspection.Timers[name]
+			t.AppendRow(table.Row{name, "", timer.Count, timer.Mean, timer.P99, timer.MaxValue, fmt.Sprintf("%.2f", timer.RateM1)})
+		}
+		api.RenderTable(&self.Options, t, nil)
+	}
+
+	if len(inspection.Raft) > 0 {
+		t = table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.SetTitle("Raft Members")
+		t.AppendHeader(table.Row{"Id", "Address", "Voter", "Leader"})
+		for _, m := range inspection.Raft {
+			t.AppendRow(table.Row{m.Id, m.Addr, m.IsVoter, m.IsLeader})
+		}
+		api.RenderTable(&self.Options, t, nil)
+	}
+
+	if len(inspection.Runtime) > 0 {
+		var keys []string
+		for key := range inspection.Runtime {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		self.Println("runtime:")
+		for _, key := range keys {
+			self.Printf("    %v: %v\n", key, inspection.Runtime[key])
+		}
+	}
+
+	for _, errMsg := range inspection.Errors {
+		self.Printf("warning: %v\n", errMsg)
+	}
+}
@@ -0,0 +1,77 @@
+package fabric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/metrics/metrics_pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountGoroutines(t *testing.T) {
+	req := require.New(t)
+
+	stack := `goroutine 1 [running]:
+main.main()
+	/src/main.go:10 +0x1d
+
+goroutine 7 [select, 5 minutes]:
+github.com/openziti/channel.(*channelImpl).txer(0xc000180000)
+
+goroutine 8 [select]:
+github.com/openziti/channel.(*channelImpl).rxer(0xc000180000)
+
+goroutine 9 [IO wait]:
+internal/poll.runtime_pollWait(0x7f, 0x72)
+`
+	count, states := countGoroutines(stack)
+	req.Equal(4, count)
+	req.Equal(map[string]int{"running": 1, "select": 2, "IO wait": 1}, states)
+}
+
+func TestApplyControllerMetrics(t *testing.T) {
+	req := require.New(t)
+
+	msg := &metrics_pb.MetricsMessage{
+		IntValues: map[string]int64{"bolt.open_read_txs": 2},
+		Histograms: map[string]*metrics_pb.MetricsMessage_Histogram{
+			"ctrl.latency:r1":    {Count: 10, P50: float64(time.Millisecond), P99: float64(5 * time.Millisecond)},
+			"ctrl.queue_time:r1": {P50: 100, P99: 200, Max: 300},
+			"ctrl.latency:r2":    {Count: 5, P50: float64(time.Millisecond)},
+			"ctrl.queue_time:r2": {P50: 1000, P99: 2000, Max: 3000},
+		},
+		Timers: map[string]*metrics_pb.MetricsMessage_Timer{
+			"api-session.create": {Count: 3, Mean: float64(time.Millisecond), M1Rate: 0.5},
+		},
+	}
+
+	inspection := &controllerInspection{}
+	applyControllerMetrics(inspection, msg)
+
+	req.Len(inspection.ControlChannels, 2)
+	req.Equal("r2", inspection.ControlChannels[0].RouterId, "the control channel with the longest queue time is first")
+	req.Equal(2000*time.Nanosecond, inspection.ControlChannels[0].QueueTimeP99)
+	req.Equal(5*time.Millisecond, inspection.ControlChannels[1].LatencyP99)
+	req.Equal(int64(10), inspection.ControlChannels[1].LatencySamples)
+	req.Equal(int64(2), inspection.Gauges["bolt.open_read_txs"])
+	req.Equal(time.Millisecond, inspection.Timers["api-session.create"].Mean)
+}
+
+func TestControllerAppId(t *testing.T) {
+	req := require.New(t)
+
+	value := func(appId string) *rest_model.InspectResponseValue {
+		return &rest_model.InspectResponseValue{AppID: &appId}
+	}
+
+	id, err := controllerAppId([]*rest_model.InspectResponseValue{value("r1"), value("ctrl1"), value("r2")}, []string{"r1", "r2"})
+	req.NoError(err)
+	req.Equal("ctrl1", id)
+
+	_, err = controllerAppId([]*rest_model.InspectResponseValue{value("r1"), value("r3"), value("ctrl1")}, []string{"r1"})
+	req.Error(err)
+
+	_, err = controllerAppId(nil, []string{"r1"})
+	req.Error(err)
+}
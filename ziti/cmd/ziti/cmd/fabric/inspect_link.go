@@ -0,0 +1,322 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	fabricInspect "github.com/openziti/fabric/inspect"
+	"github.com/openziti/fabric/rest_client/inspect"
+	"github.com/openziti/fabric/rest_client/link"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/metrics/metrics_pb"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newInspectLinkCmd(p common.OptionsProvider) *cobra.Command {
+	action := &inspectLinkCmd{Options: api.Options{CommonOptions: p()}}
+	return action.newCobraCmd()
+}
+
+type inspectLinkCmd struct {
+	api.Options
+}
+
+func (self *inspectLinkCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "link <link id>",
+		Short: "Show a link as seen by the controller and by the routers at each end",
+		Long: "Show a link as seen by the controller and by the routers at each end, inspecting both routers for the " +
+			"link's connection details and metrics: latency, time spent queued for sending, and send and receive " +
+			"rates. The ack and retransmit queues and retransmission rate are shared by all links of a router, so are " +
+			"shown per router",
+		Args: cobra.ExactArgs(1),
+		RunE: self.run,
+	}
+	self.AddCommonFlags(cmd)
+	return cmd
+}
+
+// linkEndpointView is a link as seen by the router at one of its ends
+type linkEndpointView struct {
+	RouterId   string `json:"routerId"`
+	RouterName string `json:"routerName"`
+	Reported   bool   `json:"reported"`
+
+	Protocol    string `json:"protocol,omitempty"`
+	DialAddress string `json:"dialAddress,omitempty"`
+	Split       bool   `json:"split"`
+	PeerVersion string `json:"peerVersion,omitempty"`
+
+	LatencyMean   time.Duration `json:"latencyMean"`
+	LatencyP95    time.Duration `json:"latencyP95"`
+	QueueTimeMean time.Duration `json:"queueTimeMean"`
+	QueueTimeP95  time.Duration `json:"queueTimeP95"`
+	TxBytesRate   float64       `json:"txBytesRate"`
+	RxBytesRate   float64       `json:"rxBytesRate"`
+	TxMsgRate     float64       `json:"txMsgRate"`
+	RxMsgRate     float64       `json:"rxMsgRate"`
+
+	AckQueueSize        int64   `json:"ackQueueSize"`
+	RetransmitQueueSize int64   `json:"retransmitQueueSize"`
+	RetransmitRate      float64 `json:"retransmitRate"`
+}
+
+// inspectLinkResult is the -j output of inspect link, combining the controller's view of the link with the views of
+// the routers at each end
+type inspectLinkResult struct {
+	Link   *rest_model.LinkDetail `json:"link"`
+	Dialer *linkEndpointView      `json:"dialer"`
+	// Acceptor is the view of the router the link was dialed to
+	Acceptor *linkEndpointView `json:"acceptor"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+func (self *inspectLinkCmd) run(cmd *cobra.Command, args []string) error {
+	self.Cmd = cmd
+	self.Args = args
+
+	// with -j a single object combining the link and the inspection results is output, rather than each response
+	client, err := util.NewFabricManagementClient(api.QuietClientOpts{Options: &self.Options})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	detailOk, err := client.Link.DetailLink(&link.DetailLinkParams{ID: args[0], Context: ctx})
+	if err != nil {
+		return util.WrapIfApiError(err)
+	}
+	detail := detailOk.Payload.Data
+
+	linkId := stringz.OrEmpty(detail.ID)
+	source := &linkEndpointView{}
+	dest := &linkEndpointView{}
+	if detail.SourceRouter != nil {
+		source.RouterId, source.RouterName = detail.SourceRouter.ID, detail.SourceRouter.Name
+	}
+	if detail.DestRouter != nil {
+		dest.RouterId, dest.RouterName = detail.DestRouter.ID, detail.DestRouter.Name
+	}
+
+	appRegex := "^(" + regexp.QuoteMeta(source.RouterId) + "|" + regexp.QuoteMeta(dest.RouterId) + ")$"
+	inspectOk, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: []string{"links", "metrics"},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return util.WrapIfApiError(err)
+	}
+
+	var warnings []string
+	for _, errMsg := range inspectOk.Payload.Errors {
+		warnings = append(warnings, fmt.Sprintf("inspection error: %v", errMsg))
+	}
+
+	for _, value := range inspectOk.Payload.Values {
+		var view *linkEndpointView
+		switch stringz.OrEmpty(value.AppID) {
+		case source.RouterId:
+			view = source
+		case dest.RouterId:
+			view = dest
+		default:
+			continue
+		}
+
+		var err error
+		switch name := stringz.OrEmpty(value.Name); {
+		case strings.EqualFold(name, "links"):
+			err = view.applyLinks(linkId, value.Value)
+		case strings.EqualFold(name, "metrics"):
+			err = view.applyMetrics(linkId, value.Value)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("router %v: %v", view.RouterName, err))
+		}
+	}
+
+	if self.OutputJSONResponse {
+		result := &inspectLinkResult{Link: detail, Dialer: source, Acceptor: dest, Errors: warnings}
+		out, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Println(string(out))
+		return nil
+	}
+
+	for _, warning := range warnings {
+		self.Printf("warning: %v\n", warning)
+	}
+	self.outputLink(detail, source, dest)
+	return nil
+}
+
+// inspectValueBytes returns the json of an inspection value, which routers return as a json string
+func inspectValueBytes(val interface{}) ([]byte, error) {
+	if strVal, ok := val.(string); ok {
+		return []byte(strVal), nil
+	}
+	return json.Marshal(val)
+}
+
+// applyLinks fills in the connection details of the link from the router's links inspection value
+func (self *linkEndpointView) applyLinks(linkId string, val interface{}) error {
+	data, err := inspectValueBytes(val)
+	if err != nil {
+		return err
+	}
+
+	result := &fabricInspect.LinksInspectResult{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return errors.Wrap(err, "unable to parse links inspection result")
+	}
+
+	for _, l := range result.Links {
+		if l.Id == linkId {
+			self.Reported = true
+			self.Protocol = l.Protocol
+			self.DialAddress = l.DialAddress
+			self.Split = l.Split
+			self.PeerVersion = l.DestVersion
+		}
+	}
+	return nil
+}
+
+// applyMetrics fills in the link's metrics, and the router wide queue metrics, from the router's metrics inspection
+// value
+func (self *linkEndpointView) applyMetrics(linkId string, val interface{}) error {
+	data, err := inspectValueBytes(val)
+	if err != nil {
+		return err
+	}
+
+	msg := &metrics_pb.MetricsMessage{}
+	if err = json.Unmarshal(data, msg); err != nil {
+		return errors.Wrap(err, "unable to parse metrics inspection result")
+	}
+
+	prefix := "link." + linkId + "."
+	if h, found := msg.Histograms[prefix+"latency"]; found && h != nil {
+		self.LatencyMean, self.LatencyP95 = time.Duration(h.Mean), time.Duration(h.P95)
+	}
+	if h, found := msg.Histograms[prefix+"queue_time"]; found && h != nil {
+		self.QueueTimeMean, self.QueueTimeP95 = time.Duration(h.Mean), time.Duration(h.P95)
+	}
+
+	meterRate := func(name string) float64 {
+		if m, found := msg.Meters[name]; found && m != nil {
+			return m.M1Rate
+		}
+		return 0
+	}
+	self.TxBytesRate = meterRate(prefix + "tx.bytesrate")
+	self.RxBytesRate = meterRate(prefix + "rx.bytesrate")
+	self.TxMsgRate = meterRate(prefix + "tx.msgrate")
+	self.RxMsgRate = meterRate(prefix + "rx.msgrate")
+	self.RetransmitRate = meterRate("xgress.retransmissions")
+
+	self.AckQueueSize = msg.IntValues["xgress.acks.queue_size"]
+	self.RetransmitQueueSize = msg.IntValues["xgress.retransmits.queue_size"]
+	return nil
+}
+
+func (self *inspectLinkCmd) outputLink(detail *rest_model.LinkDetail, source, dest *linkEndpointView) {
+	self.Printf("Link %v: %v, protocol %v, cost %v, static cost %v, down: %v\n",
+		stringz.OrEmpty(detail.ID),
+		stringz.OrEmpty(detail.State),
+		stringz.OrEmpty(detail.Protocol),
+		int64OrZero(detail.Cost),
+		int64OrZero(detail.StaticCost),
+		detail.Down != nil && *detail.Down)
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"", "Dialer", "Acceptor"})
+
+	row := func(name string, f func(view *linkEndpointView) interface{}) {
+		t.AppendRow(table.Row{name, f(source), f(dest)})
+	}
+	reported := func(f func(view *linkEndpointView) interface{}) func(view *linkEndpointView) interface{} {
+		return func(view *linkEndpointView) interface{} {
+			if !view.Reported {
+				return "-"
+			}
+			return f(view)
+		}
+	}
+
+	row("Router", func(v *linkEndpointView) interface{} { return v.RouterName })
+	row("Router ID", func(v *linkEndpointView) interface{} { return v.RouterId })
+	row("Latency (controller)", func(v *linkEndpointView) interface{} {
+		if v == source {
+			return formatLinkLatency(detail.SourceLatency)
+		}
+		return formatLinkLatency(detail.DestLatency)
+	})
+	row("Reported by router", func(v *linkEndpointView) interface{} { return v.Reported })
+	row("Protocol", reported(func(v *linkEndpointView) interface{} { return v.Protocol }))
+	row("Dial address", reported(func(v *linkEndpointView) interface{} { return v.DialAddress }))
+	row("Split", reported(func(v *linkEndpointView) interface{} { return v.Split }))
+	row("Peer version", reported(func(v *linkEndpointView) interface{} { return v.PeerVersion }))
+	row("Latency mean / p95", func(v *linkEndpointView) interface{} {
+		return fmt.Sprintf("%v / %v", v.LatencyMean.Round(time.Microsecond), v.LatencyP95.Round(time.Microsecond))
+	})
+	row("Queue time mean / p95", func(v *linkEndpointView) interface{} {
+		return fmt.Sprintf("%v / %v", v.QueueTimeMean.Round(time.Microsecond), v.QueueTimeP95.Round(time.Microsecond))
+	})
+	row("Tx bytes/s", func(v *linkEndpointView) interface{} { return fmt.Sprintf("%.1f", v.TxBytesRate) })
+	row("Rx bytes/s", func(v *linkEndpointView) interface{} { return fmt.Sprintf("%.1f", v.RxBytesRate) })
+	row("Tx msgs/s", func(v *linkEndpointView) interface{} { return fmt.Sprintf("%.1f", v.TxMsgRate) })
+	row("Rx msgs/s", func(v *linkEndpointView) interface{} { return fmt.Sprintf("%.1f", v.RxMsgRate) })
+	row("Router ack queue", func(v *linkEndpointView) interface{} { return v.AckQueueSize })
+	row("Router retransmit queue", func(v *linkEndpointView) interface{} { return v.RetransmitQueueSize })
+	row("Router retransmits/s", func(v *linkEndpointView) interface{} { return fmt.Sprintf("%.2f", v.RetransmitRate) })
+
+	api.RenderTable(&self.Options, t, nil)
+}
+
+func formatLinkLatency(latency *int64) string {
+	if latency == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fms", float64(*latency)/float64(time.Millisecond))
+}
+
+func int64OrZero(val *int64) int64 {
+	if val == nil {
+		return 0
+	}
+	return *val
+}
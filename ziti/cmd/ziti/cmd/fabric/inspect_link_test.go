@@ -0,0 +1,43 @@
+package fabric
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openziti/metrics/metrics_pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkEndpointViewFromInspection(t *testing.T) {
+	req := require.New(t)
+
+	view := &linkEndpointView{}
+	links := `{"links":[{"id":"other","protocol":"dtls"},{"id":"l1","protocol":"tls","dialAddress":"tls:r2:6000","dest":"r2","destVersion":"v0.27.0"}]}`
+	req.NoError(view.applyLinks("l1", links))
+	req.True(view.Reported)
+	req.Equal("tls", view.Protocol)
+	req.Equal("tls:r2:6000", view.DialAddress)
+	req.Equal("v0.27.0", view.PeerVersion)
+
+	metrics, err := json.Marshal(&metrics_pb.MetricsMessage{
+		IntValues: map[string]int64{"xgress.retransmits.queue_size": 7},
+		Meters: map[string]*metrics_pb.MetricsMessage_Meter{
+			"link.l1.tx.bytesrate":    {M1Rate: 1024},
+			"link.other.tx.bytesrate": {M1Rate: 1},
+		},
+		Histograms: map[string]*metrics_pb.MetricsMessage_Histogram{
+			"link.l1.latency": {Mean: float64(2 * time.Millisecond), P95: float64(5 * time.Millisecond)},
+		},
+	})
+	req.NoError(err)
+	req.NoError(view.applyMetrics("l1", string(metrics)))
+	req.Equal(2*time.Millisecond, view.LatencyMean)
+	req.Equal(5*time.Millisecond, view.LatencyP95)
+	req.Equal(float64(1024), view.TxBytesRate)
+	req.Equal(int64(7), view.RetransmitQueueSize)
+
+	missing := &linkEndpointView{}
+	req.NoError(missing.applyLinks("l2", links))
+	req.False(missing.Reported)
+}
@@ -0,0 +1,378 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	fabricInspect "github.com/openziti/fabric/inspect"
+	"github.com/openziti/fabric/rest_client/inspect"
+	"github.com/openziti/fabric/rest_client/router"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newInspectRouterCmd(p common.OptionsProvider) *cobra.Command {
+	action := &inspectRouterCmd{Options: api.Options{CommonOptions: p()}}
+	return action.newCobraCmd()
+}
+
+type inspectRouterCmd struct {
+	api.Options
+	saveBaseline string
+	baseline     string
+	values       []string
+}
+
+func (self *inspectRouterCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "router-snapshot <router id or name>",
+		Short: "Snapshot a router's version, settings and links, optionally saving or comparing against a baseline",
+		Long: "Snapshot a router's version, settings and links. Use --save-baseline to store the snapshot in a file, " +
+			"and --baseline to compare a fresh snapshot against a previously saved one and report any drift. Exits with " +
+			"a validation error if drift is found, so that it can gate upgrade scripts. With -j the snapshot, or the drift " +
+			"from the baseline, is printed as JSON",
+		Args: cobra.ExactArgs(1),
+		RunE: self.run,
+	}
+	cmd.Flags().StringVar(&self.saveBaseline, "save-baseline", "", "Save the snapshot to the given file")
+	cmd.Flags().StringVar(&self.baseline, "baseline", "", "Compare the snapshot against the baseline in the given file")
+	cmd.Flags().StringSliceVar(&self.values, "values", nil, "Additional inspection values to include in the snapshot")
+	self.AddCommonFlags(cmd)
+	return cmd
+}
+
+// routerSnapshot captures the state of a router which is expected to stay stable between upgrades and restarts
+type routerSnapshot struct {
+	RouterId    string                 `json:"routerId"`
+	RouterName  string                 `json:"routerName"`
+	TakenAt     time.Time              `json:"takenAt"`
+	Version     string                 `json:"version"`
+	Revision    string                 `json:"revision"`
+	OsArch      string                 `json:"osArch"`
+	Fingerprint string                 `json:"fingerprint"`
+	Cost        int64                  `json:"cost"`
+	NoTraversal bool                   `json:"noTraversal"`
+	Listeners   []string               `json:"listeners"`
+	Links       []*routerSnapshotLink  `json:"links"`
+	Values      map[string]interface{} `json:"values,omitempty"`
+}
+
+type routerSnapshotLink struct {
+	Id          string `json:"id"`
+	Dest        string `json:"dest"`
+	DestVersion string `json:"destVersion"`
+	Protocol    string `json:"protocol"`
+	DialAddress string `json:"dialAddress"`
+	Split       bool   `json:"split"`
+}
+
+// key identifies a link independently of its id, which changes whenever the link is re-established
+func (self *routerSnapshotLink) key() string {
+	return self.Dest + "/" + self.Protocol
+}
+
+func (self *inspectRouterCmd) run(cmd *cobra.Command, args []string) error {
+	self.Cmd = cmd
+	self.Args = args
+
+	routerId, err := api.MapNameToID(util.FabricAPI, "routers", &self.Options, args[0])
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := self.takeSnapshot(routerId)
+	if err != nil {
+		return err
+	}
+
+	if self.saveBaseline != "" {
+		data, err := json.MarshalIndent(snapshot, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(self.saveBaseline, data, 0644); err != nil {
+			return errors.Wrapf(err, "unable to write baseline to %v", self.saveBaseline)
+		}
+		if !self.OutputJSONResponse {
+			self.Printf("saved baseline for router %v to %v\n", snapshot.RouterName, self.saveBaseline)
+		}
+	}
+
+	if self.baseline != "" {
+		data, err := ioutil.ReadFile(self.baseline)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read baseline from %v", self.baseline)
+		}
+		baseline := &routerSnapshot{}
+		if err = json.Unmarshal(data, baseline); err != nil {
+			return errors.Wrapf(err, "unable to parse baseline %v", self.baseline)
+		}
+		if baseline.RouterId != snapshot.RouterId {
+			self.Printf("warning: baseline was taken for router %v (%v)\n", baseline.RouterName, baseline.RouterId)
+		}
+		drift, err := self.outputDrift(baseline, snapshot)
+		if err != nil {
+			return err
+		}
+		if drift > 0 {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "router %v has drifted from the baseline in %v fields", snapshot.RouterName, drift)
+		}
+		return nil
+	}
+
+	if self.saveBaseline == "" || self.OutputJSONResponse {
+		data, err := json.MarshalIndent(snapshot, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Println(string(data))
+	}
+
+	return nil
+}
+
+func (self *inspectRouterCmd) takeSnapshot(routerId string) (*routerSnapshot, error) {
+	client, err := util.NewFabricManagementClient(self)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	detailOk, err := client.Router.DetailRouter(&router.DetailRouterParams{ID: routerId, Context: ctx})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+	detail := detailOk.Payload.Data
+
+	snapshot := &routerSnapshot{
+		RouterId:    routerId,
+		RouterName:  stringz.OrEmpty(detail.Name),
+		TakenAt:     time.Now(),
+		Fingerprint: stringz.OrEmpty(detail.Fingerprint),
+		NoTraversal: detail.NoTraversal != nil && *detail.NoTraversal,
+		Values:      map[string]interface{}{},
+	}
+
+	if detail.Cost != nil {
+		snapshot.Cost = *detail.Cost
+	}
+
+	if detail.VersionInfo != nil {
+		snapshot.Version = detail.VersionInfo.Version
+		snapshot.Revision = detail.VersionInfo.Revision
+		snapshot.OsArch = detail.VersionInfo.Os + "/" + detail.VersionInfo.Arch
+	}
+
+	for _, listener := range detail.ListenerAddresses {
+		snapshot.Listeners = append(snapshot.Listeners, stringz.OrEmpty(listener.Protocol)+":"+stringz.OrEmpty(listener.Address))
+	}
+	sort.Strings(snapshot.Listeners)
+
+	if detail.Connected == nil || !*detail.Connected {
+		self.Printf("warning: router %v is not connected, links and inspection values are not available\n", snapshot.RouterName)
+		return snapshot, nil
+	}
+
+	appRegex := "^" + regexp.QuoteMeta(routerId) + "$"
+	inspectOk, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: append([]string{"links"}, self.values...),
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+
+	for _, errMsg := range inspectOk.Payload.Errors {
+		self.Printf("warning: inspection error: %v\n", errMsg)
+	}
+
+	for _, value := range inspectOk.Payload.Values {
+		name := stringz.OrEmpty(value.Name)
+		if strings.EqualFold(name, "links") {
+			links, err := parseLinksInspectValue(value.Value)
+			if err != nil {
+				return nil, err
+			}
+			snapshot.Links = links
+		} else {
+			snapshot.Values[name] = value.Value
+		}
+	}
+
+	return snapshot, nil
+}
+
+func parseLinksInspectValue(val interface{}) ([]*routerSnapshotLink, error) {
+	data, err := inspectValueBytes(val)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &fabricInspect.LinksInspectResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, errors.Wrap(err, "unable to parse links inspection result")
+	}
+
+	var links []*routerSnapshotLink
+	for _, link := range result.Links {
+		links = append(links, &routerSnapshotLink{
+			Id:          link.Id,
+			Dest:        link.Dest,
+			DestVersion: link.DestVersion,
+			Protocol:    link.Protocol,
+			DialAddress: link.DialAddress,
+			Split:       link.Split,
+		})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].key() < links[j].key()
+	})
+	return links, nil
+}
+
+type routerDrift struct {
+	Field    string      `json:"field"`
+	Baseline interface{} `json:"baseline"`
+	Current  interface{} `json:"current"`
+}
+
+// routerDriftResult is the output of a comparison against a baseline in JSON mode
+type routerDriftResult struct {
+	RouterId        string         `json:"routerId"`
+	RouterName      string         `json:"routerName"`
+	BaselineTakenAt time.Time      `json:"baselineTakenAt"`
+	TakenAt         time.Time      `json:"takenAt"`
+	Drift           []*routerDrift `json:"drift"`
+}
+
+func compareRouterSnapshots(baseline, current *routerSnapshot) []*routerDrift {
+	var result []*routerDrift
+	compare := func(field string, baselineVal, currentVal interface{}) {
+		if !reflect.DeepEqual(baselineVal, currentVal) {
+			result = append(result, &routerDrift{Field: field, Baseline: baselineVal, Current: currentVal})
+		}
+	}
+
+	compare("name", baseline.RouterName, current.RouterName)
+	compare("version", baseline.Version, current.Version)
+	compare("revision", baseline.Revision, current.Revision)
+	compare("os/arch", baseline.OsArch, current.OsArch)
+	compare("fingerprint", baseline.Fingerprint, current.Fingerprint)
+	compare("cost", baseline.Cost, current.Cost)
+	compare("noTraversal", baseline.NoTraversal, current.NoTraversal)
+	compare("listeners", strings.Join(baseline.Listeners, "\n"), strings.Join(current.Listeners, "\n"))
+
+	baselineLinks := map[string]*routerSnapshotLink{}
+	for _, link := range baseline.Links {
+		baselineLinks[link.key()] = link
+	}
+	currentLinks := map[string]*routerSnapshotLink{}
+	for _, link := range current.Links {
+		currentLinks[link.key()] = link
+	}
+
+	for _, link := range baseline.Links {
+		currentLink, found := currentLinks[link.key()]
+		if !found {
+			compare("link "+link.key(), link.DialAddress, "<missing>")
+			continue
+		}
+		compare("link "+link.key()+" dial address", link.DialAddress, currentLink.DialAddress)
+		compare("link "+link.key()+" dest version", link.DestVersion, currentLink.DestVersion)
+		compare("link "+link.key()+" split", link.Split, currentLink.Split)
+	}
+
+	for _, link := range current.Links {
+		if _, found := baselineLinks[link.key()]; !found {
+			compare("link "+link.key(), "<missing>", link.DialAddress)
+		}
+	}
+
+	var valueNames []string
+	for name := range baseline.Values {
+		valueNames = append(valueNames, name)
+	}
+	for name := range current.Values {
+		if _, found := baseline.Values[name]; !found {
+			valueNames = append(valueNames, name)
+		}
+	}
+	sort.Strings(valueNames)
+	for _, name := range valueNames {
+		compare("value "+name, baseline.Values[name], current.Values[name])
+	}
+
+	return result
+}
+
+// outputDrift shows how the router has drifted from the baseline and returns the number of fields which drifted
+func (self *inspectRouterCmd) outputDrift(baseline, current *routerSnapshot) (int, error) {
+	drift := compareRouterSnapshots(baseline, current)
+	if self.OutputJSONResponse {
+		result := &routerDriftResult{
+			RouterId:        current.RouterId,
+			RouterName:      current.RouterName,
+			BaselineTakenAt: baseline.TakenAt,
+			TakenAt:         current.TakenAt,
+			Drift:           drift,
+		}
+		if result.Drift == nil {
+			result.Drift = []*routerDrift{}
+		}
+		data, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return 0, err
+		}
+		self.Println(string(data))
+		return len(drift), nil
+	}
+
+	self.Printf("comparing router %v against baseline taken %v\n", current.RouterName, baseline.TakenAt.Format(time.RFC3339))
+	if len(drift) == 0 {
+		self.Println("no drift detected")
+		return 0, nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Field", "Baseline", "Current"})
+	for _, d := range drift {
+		t.AppendRow(table.Row{d.Field, fmt.Sprintf("%v", d.Baseline), fmt.Sprintf("%v", d.Current)})
+	}
+	api.RenderTable(&self.Options, t, nil)
+	return len(drift), nil
+}
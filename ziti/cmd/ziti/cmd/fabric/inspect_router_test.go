@@ -0,0 +1,125 @@
+package fabric
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinksInspectValue(t *testing.T) {
+	req := require.New(t)
+
+	expected := []*routerSnapshotLink{
+		{Id: "l2", Dest: "r2", DestVersion: "v0.27.0", Protocol: "dtls", DialAddress: "dtls:r2:6000"},
+		{Id: "l1", Dest: "r2", DestVersion: "v0.27.0", Protocol: "tls", DialAddress: "tls:r2:6000", Split: true},
+		{Id: "l3", Dest: "r3", Protocol: "tls", DialAddress: "tls:r3:6000"},
+	}
+
+	links := `{"links": [
+		{"id": "l3", "dest": "r3", "protocol": "tls", "dialAddress": "tls:r3:6000"},
+		{"id": "l1", "dest": "r2", "destVersion": "v0.27.0", "protocol": "tls", "dialAddress": "tls:r2:6000", "split": true},
+		{"id": "l2", "dest": "r2", "destVersion": "v0.27.0", "protocol": "dtls", "dialAddress": "dtls:r2:6000"}
+	]}`
+	result, err := parseLinksInspectValue(links)
+	req.NoError(err)
+	req.Equal(expected, result)
+
+	// values may also come back already decoded
+	var decoded map[string]interface{}
+	req.NoError(json.Unmarshal([]byte(links), &decoded))
+	result, err = parseLinksInspectValue(decoded)
+	req.NoError(err)
+	req.Equal(expected, result)
+
+	result, err = parseLinksInspectValue(`{"links": []}`)
+	req.NoError(err)
+	req.Empty(result)
+
+	_, err = parseLinksInspectValue(`not json`)
+	req.Error(err)
+	req.Contains(err.Error(), "unable to parse links inspection result")
+}
+
+func testRouterSnapshot() *routerSnapshot {
+	return &routerSnapshot{
+		RouterId:    "r1",
+		RouterName:  "edge-1",
+		TakenAt:     time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC),
+		Version:     "v0.26.0",
+		OsArch:      "linux/amd64",
+		Fingerprint: "abc",
+		Cost:        10,
+		Listeners:   []string{"tls:edge-1:6000"},
+		Links: []*routerSnapshotLink{
+			{Id: "l1", Dest: "r2", DestVersion: "v0.26.0", Protocol: "tls", DialAddress: "tls:r2:6000"},
+			{Id: "l2", Dest: "r3", DestVersion: "v0.26.0", Protocol: "tls", DialAddress: "tls:r3:6000"},
+		},
+		Values: map[string]interface{}{"config": "a"},
+	}
+}
+
+func TestCompareRouterSnapshots(t *testing.T) {
+	req := require.New(t)
+
+	baseline := testRouterSnapshot()
+	current := testRouterSnapshot()
+	current.TakenAt = baseline.TakenAt.Add(time.Hour)
+	current.Links[0].Id = "l1-reconnected"
+	req.Empty(compareRouterSnapshots(baseline, current), "link ids and snapshot times aren't drift")
+
+	current.Version = "v0.27.0"
+	current.Cost = 20
+	current.Listeners = append(current.Listeners, "dtls:edge-1:6001")
+	current.Links = []*routerSnapshotLink{
+		{Id: "l1", Dest: "r2", DestVersion: "v0.27.0", Protocol: "tls", DialAddress: "tls:r2:6000", Split: true},
+		{Id: "l4", Dest: "r4", Protocol: "tls", DialAddress: "tls:r4:6000"},
+	}
+	current.Values = map[string]interface{}{"config": "b", "stackdump": "..."}
+
+	req.Equal([]*routerDrift{
+		{Field: "version", Baseline: "v0.26.0", Current: "v0.27.0"},
+		{Field: "cost", Baseline: int64(10), Current: int64(20)},
+		{Field: "listeners", Baseline: "tls:edge-1:6000", Current: "tls:edge-1:6000\ndtls:edge-1:6001"},
+		{Field: "link r2/tls dest version", Baseline: "v0.26.0", Current: "v0.27.0"},
+		{Field: "link r2/tls split", Baseline: false, Current: true},
+		{Field: "link r3/tls", Baseline: "tls:r3:6000", Current: "<missing>"},
+		{Field: "link r4/tls", Baseline: "<missing>", Current: "tls:r4:6000"},
+		{Field: "value config", Baseline: "a", Current: "b"},
+		{Field: "value stackdump", Baseline: nil, Current: "..."},
+	}, compareRouterSnapshots(baseline, current))
+}
+
+func TestOutputRouterDriftJson(t *testing.T) {
+	req := require.New(t)
+
+	out := &bytes.Buffer{}
+	cmd := &inspectRouterCmd{Options: api.Options{CommonOptions: common.CommonOptions{Out: out}, OutputJSONResponse: true}}
+
+	baseline := testRouterSnapshot()
+	current := testRouterSnapshot()
+	drift, err := cmd.outputDrift(baseline, current)
+	req.NoError(err)
+	req.Equal(0, drift)
+
+	result := &routerDriftResult{}
+	req.NoError(json.Unmarshal(out.Bytes(), result))
+	req.Equal("edge-1", result.RouterName)
+	req.NotNil(result.Drift, "no drift is an empty list")
+	req.Empty(result.Drift)
+
+	out.Reset()
+	current.Fingerprint = "def"
+	drift, err = cmd.outputDrift(baseline, current)
+	req.NoError(err)
+	req.Equal(1, drift)
+
+	result = &routerDriftResult{}
+	req.NoError(json.Unmarshal(out.Bytes(), result))
+	req.Equal([]*routerDrift{{Field: "fingerprint", Baseline: "abc", Current: "def"}}, result.Drift)
+	req.Equal(baseline.TakenAt, result.BaselineTakenAt)
+}
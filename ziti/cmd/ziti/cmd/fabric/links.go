@@ -0,0 +1,344 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+func newLinksCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "links",
+		Short: "Operational tools for fabric links",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newLinksCostCalibrationCmd(p))
+
+	return cmd
+}
+
+func newLinksCostCalibrationCmd(p common.OptionsProvider) *cobra.Command {
+	action := &linksCostCalibrationCmd{Options: api.Options{CommonOptions: p()}}
+	return action.newCobraCmd()
+}
+
+type linksCostCalibrationCmd struct {
+	api.Options
+	window       time.Duration
+	interval     time.Duration
+	percentile   int
+	costFunction string
+	scale        float64
+	offset       float64
+	minCost      int64
+	maxCost      int64
+	minChange    int64
+	apply        bool
+	bulk         api.BulkOptions
+}
+
+func (self *linksCostCalibrationCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cost-calibration",
+		Short: "Samples link latencies and proposes static link costs derived from them",
+		Long: "Samples the latencies reported for each link over a window and proposes a static cost for each link, " +
+			"computed from the chosen latency percentile with the chosen cost function. The linear function computes " +
+			"offset + scale * latency in ms, the log function offset + scale * ln(1 + latency in ms). " +
+			"Use --apply to update the static costs of links whose proposed cost differs by at least --min-change",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self.Cmd = cmd
+			self.Args = args
+			return self.run()
+		},
+	}
+
+	cmd.Flags().DurationVar(&self.window, "window", 5*time.Minute, "How long to sample link latencies for")
+	cmd.Flags().DurationVar(&self.interval, "interval", 15*time.Second, "How often to sample link latencies")
+	cmd.Flags().IntVar(&self.percentile, "percentile", 90, "Latency percentile to derive costs from")
+	cmd.Flags().StringVar(&self.costFunction, "cost-function", "linear", "Function mapping latency to cost [linear, log]")
+	cmd.Flags().Float64Var(&self.scale, "scale", 1, "Cost units per ms of latency for linear, or per unit of ln(1 + ms) for log")
+	cmd.Flags().Float64Var(&self.offset, "offset", 1, "Base cost added to every link")
+	cmd.Flags().Int64Var(&self.minCost, "min-cost", 1, "Lowest static cost to propose")
+	cmd.Flags().Int64Var(&self.maxCost, "max-cost", math.MaxUint16, "Highest static cost to propose")
+	cmd.Flags().Int64Var(&self.minChange, "min-change", 1, "Only apply proposals which differ from the current static cost by at least this much")
+	cmd.Flags().BoolVar(&self.apply, "apply", false, "Update link static costs to the proposed values")
+	self.bulk.AddBulkFlags(cmd, true)
+	self.AddTableOutputFlags(cmd)
+	self.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// linkLatencySamples collects the latencies observed for a link during calibration
+type linkLatencySamples struct {
+	Id          string    `json:"id"`
+	Source      string    `json:"source"`
+	Dest        string    `json:"dest"`
+	StaticCost  int64     `json:"staticCost"`
+	LatenciesMs []float64 `json:"latenciesMs"`
+}
+
+// linkCostProposal is the outcome of calibrating a single link
+type linkCostProposal struct {
+	*linkLatencySamples
+	MedianMs     float64 `json:"medianMs"`
+	PercentileMs float64 `json:"percentileMs"`
+	ProposedCost int64   `json:"proposedCost"`
+}
+
+func (self *linkCostProposal) change() int64 {
+	change := self.ProposedCost - self.StaticCost
+	if change < 0 {
+		return -change
+	}
+	return change
+}
+
+func (self *linksCostCalibrationCmd) run() error {
+	if self.percentile < 1 || self.percentile > 100 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid percentile %v, must be between 1 and 100", self.percentile)
+	}
+
+	if self.costFunction != "linear" && self.costFunction != "log" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid cost function %v, must be one of linear, log", self.costFunction)
+	}
+
+	if self.minCost < 1 || self.maxCost > math.MaxUint16 || self.minCost > self.maxCost {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid cost range %v-%v, must be within 1-%v", self.minCost, self.maxCost, math.MaxUint16)
+	}
+
+	run, err := self.bulk.StartBulk("update static cost of links")
+	if err != nil {
+		return err
+	}
+
+	// the responses of the API calls aren't the proposals, so aren't output with -j
+	quiet := self.Options
+	quiet.OutputJSONResponse = false
+
+	samples, err := self.sample(&quiet)
+	if err != nil {
+		return err
+	}
+
+	var proposals []*linkCostProposal
+	for _, s := range samples {
+		if len(s.LatenciesMs) == 0 {
+			continue
+		}
+		proposals = append(proposals, self.propose(s))
+	}
+
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].Id < proposals[j].Id
+	})
+
+	if err = self.outputProposals(proposals); err != nil {
+		return err
+	}
+
+	if !self.apply {
+		return nil
+	}
+
+	applied := 0
+	for _, proposal := range proposals {
+		if proposal.change() < self.minChange || !run.Include(proposal.Id) {
+			continue
+		}
+		if run.Stopped() {
+			run.Skipped(proposal.Id, "")
+			continue
+		}
+		ctx, cancel := self.TimeoutContext()
+		err = SetLinkStaticCost(ctx, &quiet, proposal.Id, proposal.ProposedCost)
+		cancel()
+		if err != nil {
+			if !self.OutputJSONResponse {
+				self.Printf("unable to update static cost of link %v: %v\n", proposal.Id, err)
+			}
+			run.Failed(proposal.Id, "", err)
+			continue
+		}
+		run.Succeeded()
+		applied++
+	}
+
+	if !self.OutputJSONResponse {
+		self.Printf("updated static cost of %v links\n", applied)
+	}
+
+	return run.Finish()
+}
+
+func (self *linksCostCalibrationCmd) sample(o *api.Options) (map[string]*linkLatencySamples, error) {
+	result := map[string]*linkLatencySamples{}
+	deadline := time.Now().Add(self.window)
+
+	if !self.OutputJSONResponse {
+		self.Printf("sampling link latencies every %v for %v\n", self.interval, self.window)
+	}
+
+	for {
+		ctx, cancel := self.TimeoutContext()
+		links, err := ListLinks(ctx, o)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range links {
+			id := stringz.OrEmpty(link.ID)
+			if link.Down != nil && *link.Down {
+				continue
+			}
+
+			s, found := result[id]
+			if !found {
+				s = &linkLatencySamples{Id: id}
+				if link.SourceRouter != nil {
+					s.Source = link.SourceRouter.Name
+				}
+				if link.DestRouter != nil {
+					s.Dest = link.DestRouter.Name
+				}
+				result[id] = s
+			}
+
+			if link.StaticCost != nil {
+				s.StaticCost = *link.StaticCost
+			}
+
+			if latency, ok := linkLatencyMs(link.SourceLatency, link.DestLatency); ok {
+				s.LatenciesMs = append(s.LatenciesMs, latency)
+			}
+		}
+
+		if time.Now().Add(self.interval).After(deadline) {
+			return result, nil
+		}
+		time.Sleep(self.interval)
+	}
+}
+
+// linkLatencyMs returns the average of the latencies reported by both ends of the link, in ms
+func linkLatencyMs(sourceLatency, destLatency *int64) (float64, bool) {
+	var total int64
+	count := 0
+	for _, latency := range []*int64{sourceLatency, destLatency} {
+		if latency != nil && *latency > 0 {
+			total += *latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return float64(total) / float64(count) / float64(time.Millisecond), true
+}
+
+func (self *linksCostCalibrationCmd) propose(samples *linkLatencySamples) *linkCostProposal {
+	sorted := append([]float64(nil), samples.LatenciesMs...)
+	sort.Float64s(sorted)
+
+	proposal := &linkCostProposal{
+		linkLatencySamples: samples,
+		MedianMs:           latencyPercentile(sorted, 50),
+		PercentileMs:       latencyPercentile(sorted, self.percentile),
+	}
+
+	var cost float64
+	if self.costFunction == "log" {
+		cost = self.offset + self.scale*math.Log1p(proposal.PercentileMs)
+	} else {
+		cost = self.offset + self.scale*proposal.PercentileMs
+	}
+
+	proposal.ProposedCost = int64(math.Round(cost))
+	if proposal.ProposedCost < self.minCost {
+		proposal.ProposedCost = self.minCost
+	}
+	if proposal.ProposedCost > self.maxCost {
+		proposal.ProposedCost = self.maxCost
+	}
+
+	return proposal
+}
+
+// latencyPercentile returns the nearest rank percentile of the given sorted values
+func latencyPercentile(sorted []float64, percentile int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(float64(percentile)/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func (self *linksCostCalibrationCmd) outputProposals(proposals []*linkCostProposal) error {
+	if self.OutputJSONResponse {
+		if proposals == nil {
+			proposals = []*linkCostProposal{}
+		}
+		data, err := json.MarshalIndent(proposals, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Println(string(data))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Source", "Dest", "Samples", "p50 (ms)", fmt.Sprintf("p%v (ms)", self.percentile), "Static Cost", "Proposed", "Change"})
+	for _, p := range proposals {
+		change := ""
+		if p.change() >= self.minChange {
+			change = fmt.Sprintf("%+d", p.ProposedCost-p.StaticCost)
+		}
+		t.AppendRow(table.Row{
+			p.Id,
+			p.Source,
+			p.Dest,
+			len(p.LatenciesMs),
+			fmt.Sprintf("%.1f", p.MedianMs),
+			fmt.Sprintf("%.1f", p.PercentileMs),
+			p.StaticCost,
+			p.ProposedCost,
+			change,
+		})
+	}
+	api.RenderTable(&self.Options, t, nil)
+	return nil
+}
@@ -0,0 +1,139 @@
+package fabric
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyPercentile(t *testing.T) {
+	req := require.New(t)
+
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	req.Equal(float64(5), latencyPercentile(sorted, 50))
+	req.Equal(float64(9), latencyPercentile(sorted, 90))
+	req.Equal(float64(10), latencyPercentile(sorted, 100))
+	req.Equal(float64(1), latencyPercentile(sorted, 1))
+	req.Equal(float64(0), latencyPercentile(nil, 50))
+}
+
+func TestLinkLatencyMs(t *testing.T) {
+	req := require.New(t)
+
+	source := int64(10 * time.Millisecond)
+	dest := int64(20 * time.Millisecond)
+
+	latency, ok := linkLatencyMs(&source, &dest)
+	req.True(ok)
+	req.Equal(float64(15), latency)
+
+	latency, ok = linkLatencyMs(&source, nil)
+	req.True(ok)
+	req.Equal(float64(10), latency)
+
+	_, ok = linkLatencyMs(nil, nil)
+	req.False(ok)
+}
+
+func TestProposeLinkCost(t *testing.T) {
+	req := require.New(t)
+
+	action := &linksCostCalibrationCmd{
+		percentile:   90,
+		costFunction: "linear",
+		scale:        2,
+		offset:       1,
+		minCost:      1,
+		maxCost:      100,
+	}
+
+	samples := &linkLatencySamples{Id: "l1", StaticCost: 1, LatenciesMs: []float64{30, 10, 20}}
+	proposal := action.propose(samples)
+	req.Equal(float64(20), proposal.MedianMs)
+	req.Equal(float64(30), proposal.PercentileMs)
+	req.Equal(int64(61), proposal.ProposedCost)
+	req.Equal(int64(60), proposal.change())
+
+	samples.LatenciesMs = []float64{500}
+	req.Equal(int64(100), action.propose(samples).ProposedCost)
+}
+
+func TestLinksCostCalibrationJSON(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"links": {
+			{"id": "l1", "sourceRouter": map[string]interface{}{"id": "r1", "name": "edge-1"}, "destRouter": map[string]interface{}{"id": "r2", "name": "edge-2"},
+				"sourceLatency": 10 * time.Millisecond, "destLatency": 20 * time.Millisecond, "staticCost": 1, "down": false},
+			{"id": "l2", "sourceLatency": 10 * time.Millisecond, "destLatency": 10 * time.Millisecond, "staticCost": 1, "down": true},
+			{"id": "l3", "sourceLatency": 0, "destLatency": 0, "staticCost": 1, "down": false},
+		},
+	})
+
+	out := &bytes.Buffer{}
+	cmd := &linksCostCalibrationCmd{
+		Options:      newTestOptions(out),
+		window:       time.Millisecond,
+		interval:     time.Millisecond,
+		percentile:   90,
+		costFunction: "linear",
+		scale:        1,
+		offset:       1,
+		minCost:      1,
+		maxCost:      100,
+		minChange:    1,
+		apply:        true,
+	}
+	cmd.OutputJSONResponse = true
+	cmd.Timeout = 5
+	req.NoError(cmd.run())
+
+	var proposals []map[string]interface{}
+	req.NoError(json.Unmarshal(out.Bytes(), &proposals), out.String())
+	req.Len(proposals, 1)
+	req.Equal("l1", proposals[0]["id"])
+	req.Equal("edge-1", proposals[0]["source"])
+	req.Equal("edge-2", proposals[0]["dest"])
+	req.Equal(float64(15), proposals[0]["percentileMs"])
+	req.Equal(float64(16), proposals[0]["proposedCost"])
+	req.Equal(float64(16), testController.List("links")[0]["staticCost"])
+
+	// without any links to propose costs for, an empty array is output
+	testController.Reset(t, nil)
+	out.Reset()
+	cmd.apply = false
+	req.NoError(cmd.run())
+	req.Equal("[]\n", out.String())
+
+	cmd.percentile = 0
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(cmd.run()))
+}
+
+func TestLinkProblems(t *testing.T) {
+	req := require.New(t)
+
+	parse := func(s string) *gabs.Container {
+		c, err := gabs.ParseJSON([]byte(s))
+		req.NoError(err)
+		return c
+	}
+
+	filter := &linkProblemFilter{
+		enabled:    true,
+		maxLatency: 100 * time.Millisecond,
+		flapWindow: time.Minute,
+		flapCount:  2,
+		changes:    map[string]int{"l3": 2, "l4": 1},
+	}
+
+	req.Empty(filter.problems(parse(`{"id": "l1", "state": "Connected", "down": false, "sourceLatency": 5000000, "destLatency": 7000000}`)))
+	req.Equal([]string{"down", "state failed"}, filter.problems(parse(`{"id": "l2", "state": "Failed", "down": true, "sourceLatency": 0, "destLatency": 0}`)))
+	req.Equal([]string{"flapping (2 changes in 1m0s)"}, filter.problems(parse(`{"id": "l3", "state": "Connected", "down": false, "sourceLatency": 0, "destLatency": 0}`)))
+	req.Empty(filter.problems(parse(`{"id": "l4", "state": "Connected", "down": false, "sourceLatency": 0, "destLatency": 0}`)))
+	req.Equal([]string{"dest latency 150.0ms"}, filter.problems(parse(`{"id": "l5", "state": "Connected", "down": false, "sourceLatency": 50000000, "destLatency": 150000000}`)))
+}
@@ -17,16 +17,24 @@
 package fabric
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jeffail/gabs"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -35,6 +43,7 @@ func newListCmd(p common.OptionsProvider) *cobra.Command {
 	listCmd := &cobra.Command{
 		Use:     "list",
 		Short:   "Lists various entities managed by the Ziti Controller",
+		Long:    "Lists various entities managed by the Ziti Controller. " + api.RelativeTimesDescription,
 		Aliases: []string{"ls"},
 		Run: func(cmd *cobra.Command, args []string) {
 			err := cmd.Help()
@@ -46,11 +55,14 @@ func newListCmd(p common.OptionsProvider) *cobra.Command {
 		return &api.Options{CommonOptions: p()}
 	}
 
-	listCmd.AddCommand(newListCmdForEntityType("circuits", runListCircuits, newOptions()))
-	listCmd.AddCommand(newListCmdForEntityType("links", runListLinks, newOptions()))
-	listCmd.AddCommand(newListCmdForEntityType("routers", runListRouters, newOptions()))
+	listCmd.AddCommand(newListCircuitsCmd(newOptions()))
+	listCmd.AddCommand(newListLinksCmd(newOptions()))
+	routersWatch := &listWatchOptions{}
+	listRoutersCmd := newListCmdForEntityType("routers", routersWatch.wrap(runListRouters), newOptions())
+	routersWatch.addFlags(listRoutersCmd)
+	listCmd.AddCommand(listRoutersCmd)
 	listCmd.AddCommand(newListCmdForEntityType("services", runListServices, newOptions()))
-	listCmd.AddCommand(newListCmdForEntityType("terminators", runListTerminators, newOptions()))
+	listCmd.AddCommand(newListTerminatorsCmd(newOptions()))
 
 	return listCmd
 }
@@ -59,6 +71,27 @@ func listEntitiesWithOptions(entityType string, options *api.Options) ([]*gabs.C
 	return api.ListEntitiesWithOptions(util.FabricAPI, entityType, options)
 }
 
+// listLinksWithOptions lists links, applying the filter on the client as the links API ignores filters
+func listLinksWithOptions(o *api.Options) ([]*gabs.Container, *api.Paging, error) {
+	filter := ""
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+	filter, err := o.SortFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter, err = util.ExpandFilterTimes(filter, time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	children, _, err := api.ListEntitiesOfType(util.FabricAPI, "links", url.Values{}, false, o.Out, o.Timeout, o.Verbose)
+	if err != nil {
+		return nil, nil, err
+	}
+	return api.FilterEntities(filter, children)
+}
+
 type listCommandRunner func(*api.Options) error
 
 // newListCmdForEntityType creates the list command for the given entity type
@@ -79,20 +112,137 @@ func newListCmdForEntityType(entityType string, command listCommandRunner, optio
 
 	// allow interspersing positional args and flags
 	cmd.Flags().SetInterspersed(true)
-	cmd.Flags().BoolVar(&options.OutputCSV, "csv", false, "Output CSV instead of a formatted table")
+	options.AddTableOutputFlags(cmd)
 	options.AddCommonFlags(cmd)
 
 	return cmd
 }
 
-func runListCircuits(o *api.Options) error {
+// newListCircuitsCmd creates the list command for circuits
+func newListCircuitsCmd(options *api.Options) *cobra.Command {
+	var pathContains []string
+	ageFilter := &circuitAgeFilter{}
+	watch := &listWatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "circuits <filter>?",
+		Short: "lists circuits managed by the Ziti Controller",
+		Long: "lists circuits managed by the Ziti Controller. Use --path-contains r/<router id or name> or l/<link id> " +
+			"to only show circuits whose path traverses the given routers and/or links. Use --min-age and --max-age " +
+			"to only show long lived circuits, or only those created recently. Use --watch to refresh the list periodically",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := watch.run(options, func() error {
+				return runListCircuits(pathContains, ageFilter, options)
+			})
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	cmd.Flags().StringSliceVar(&pathContains, "path-contains", nil, "Only show circuits whose path contains all of the given routers (r/<id or name>) or links (l/<id>)")
+	cmd.Flags().StringVar(&ageFilter.minAge, "min-age", "", "Only show circuits at least this old, e.g. 90s, 15m, 2h or 1d")
+	cmd.Flags().StringVar(&ageFilter.maxAge, "max-age", "", "Only show circuits at most this old, e.g. 90s, 15m, 2h or 1d")
+	watch.addFlags(cmd)
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func runListCircuits(pathContains []string, ageFilter *circuitAgeFilter, o *api.Options) error {
+	selectors, err := parseCircuitPathSelectors(pathContains)
+	if err != nil {
+		return err
+	}
+
+	if err := ageFilter.parse(); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
 	children, pagingInfo, err := listEntitiesWithOptions("circuits", o)
 	if err != nil {
 		return err
 	}
+
+	if len(selectors) > 0 {
+		var filtered []*gabs.Container
+		for _, entity := range children {
+			nodes, links, err := getCircuitPath(entity)
+			if err != nil {
+				return err
+			}
+			if circuitPathMatches(selectors, nodes, links) {
+				filtered = append(filtered, entity)
+			}
+		}
+		children = filtered
+	}
+
+	if ageFilter.enabled() {
+		now := time.Now()
+		var filtered []*gabs.Container
+		for _, entity := range children {
+			if ageFilter.matches(entity, now) {
+				filtered = append(filtered, entity)
+			}
+		}
+		children = filtered
+	}
+
 	return outputCircuits(o, children, pagingInfo)
 }
 
+// circuitAgeFilter selects circuits by how long ago they were created
+type circuitAgeFilter struct {
+	minAge string
+	maxAge string
+	min    time.Duration
+	max    time.Duration
+}
+
+func (self *circuitAgeFilter) parse() error {
+	var err error
+	if self.minAge != "" {
+		if self.min, err = api.ParseAge(self.minAge); err != nil {
+			return errors.Wrap(err, "invalid --min-age")
+		}
+	}
+	if self.maxAge != "" {
+		if self.max, err = api.ParseAge(self.maxAge); err != nil {
+			return errors.Wrap(err, "invalid --max-age")
+		}
+	}
+	if self.minAge != "" && self.maxAge != "" && self.min > self.max {
+		return errors.Errorf("--min-age %v is greater than --max-age %v", self.minAge, self.maxAge)
+	}
+	return nil
+}
+
+func (self *circuitAgeFilter) enabled() bool {
+	return self.minAge != "" || self.maxAge != ""
+}
+
+// matches returns true if the circuit's age at now is within the filter. Circuits without a creation time don't match
+func (self *circuitAgeFilter) matches(entity *gabs.Container, now time.Time) bool {
+	createdAt, err := time.Parse(time.RFC3339Nano, api.GetJsonString(entity, "createdAt"))
+	if err != nil {
+		return false
+	}
+	age := now.Sub(createdAt)
+	if self.minAge != "" && age < self.min {
+		return false
+	}
+	if self.maxAge != "" && age > self.max {
+		return false
+	}
+	return true
+}
+
 func outputCircuits(o *api.Options, children []*gabs.Container, pagingInfo *api.Paging) error {
 	if o.OutputJSONResponse {
 		return nil
@@ -110,12 +260,7 @@ func outputCircuits(o *api.Options, children []*gabs.Container, pagingInfo *api.
 
 		path := strings.Builder{}
 
-		nodes, err := getEntityRef(entity.Path("path.nodes"))
-		if err != nil {
-			return err
-		}
-
-		links, err := getEntityRef(entity.Path("path.links"))
+		nodes, links, err := getCircuitPath(entity)
 		if err != nil {
 			return err
 		}
@@ -135,11 +280,78 @@ func outputCircuits(o *api.Options, children []*gabs.Container, pagingInfo *api.
 		t.AppendRow(table.Row{id, client, service, terminatorId, path.String()})
 	}
 
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
 
+func getCircuitPath(entity *gabs.Container) ([]*entityRef, []*entityRef, error) {
+	nodes, err := getEntityRef(entity.Path("path.nodes"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links, err := getEntityRef(entity.Path("path.links"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nodes, links, nil
+}
+
+// circuitPathSelector matches a router (r/<id or name>) or link (l/<id>) in a circuit path
+type circuitPathSelector struct {
+	isLink   bool
+	idOrName string
+}
+
+func (self *circuitPathSelector) matches(nodes, links []*entityRef) bool {
+	if self.isLink {
+		for _, link := range links {
+			if link.id == self.idOrName {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, node := range nodes {
+		if node.id == self.idOrName || node.name == self.idOrName {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCircuitPathSelectors(values []string) ([]*circuitPathSelector, error) {
+	var result []*circuitPathSelector
+	for _, val := range values {
+		selector := &circuitPathSelector{}
+		if strings.HasPrefix(val, "r/") {
+			selector.idOrName = strings.TrimPrefix(val, "r/")
+		} else if strings.HasPrefix(val, "l/") {
+			selector.isLink = true
+			selector.idOrName = strings.TrimPrefix(val, "l/")
+		} else {
+			return nil, errors.Errorf("invalid path selector '%v'. Must be of the form r/<router id or name> or l/<link id>", val)
+		}
+		if selector.idOrName == "" {
+			return nil, errors.Errorf("invalid path selector '%v'. No router or link given", val)
+		}
+		result = append(result, selector)
+	}
+	return result, nil
+}
+
+func circuitPathMatches(selectors []*circuitPathSelector, nodes, links []*entityRef) bool {
+	for _, selector := range selectors {
+		if !selector.matches(nodes, links) {
+			return false
+		}
+	}
+	return true
+}
+
 type entityRef struct {
 	id   string
 	name string
@@ -167,17 +379,62 @@ func getEntityRef(c *gabs.Container) ([]*entityRef, error) {
 	return result, nil
 }
 
-func runListLinks(o *api.Options) error {
-	children, pagingInfo, err := listEntitiesWithOptions("links", o)
+// newListLinksCmd creates the list command for links
+func newListLinksCmd(options *api.Options) *cobra.Command {
+	problemFilter := &linkProblemFilter{}
+	watch := &listWatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "links <filter>?",
+		Short: "lists links managed by the Ziti Controller",
+		Long: "lists links managed by the Ziti Controller. Use --only-problems to hide healthy links and only show " +
+			"links which are down, not connected, above --max-latency or, if --flap-window is set, changed state at " +
+			"least --flap-count times while being watched. Use --watch to refresh the list periodically",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := watch.run(options, func() error {
+				return runListLinks(problemFilter, options)
+			})
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	problemFilter.addFlags(cmd)
+	watch.addFlags(cmd)
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func runListLinks(problemFilter *linkProblemFilter, o *api.Options) error {
+	children, pagingInfo, err := problemFilter.listLinks(o)
 	if err != nil {
 		return err
 	}
-	return outputLinks(o, children, pagingInfo)
+	return outputLinks(o, children, pagingInfo, problemFilter)
 }
 
-func outputLinks(o *api.Options, children []*gabs.Container, pagingInfo *api.Paging) error {
+func outputLinks(o *api.Options, children []*gabs.Container, pagingInfo *api.Paging, problemFilter *linkProblemFilter) error {
+	onlyProblems := problemFilter != nil && problemFilter.enabled
+
 	if o.OutputJSONResponse {
-		return nil
+		if onlyProblems {
+			var withProblems []*gabs.Container
+			for _, entity := range children {
+				if len(problemFilter.problems(entity)) > 0 {
+					withProblems = append(withProblems, entity)
+				}
+			}
+			children = withProblems
+			pagingInfo = &api.Paging{Limit: int64(len(children)), Count: int64(len(children))}
+		}
+		return api.OutputFilteredEntities(o, children, pagingInfo)
 	}
 
 	t := table.NewWriter()
@@ -188,9 +445,22 @@ func outputLinks(o *api.Options, children []*gabs.Container, pagingInfo *api.Pag
 		{Number: 8, Align: text.AlignRight},
 	}
 	t.SetColumnConfigs(columnConfigs)
-	t.AppendHeader(table.Row{"ID", "Dialer", "Acceptor", "Static Cost", "Src Latency", "Dst Latency", "State", "Status", "Full Cost"})
+	header := table.Row{"ID", "Dialer", "Acceptor", "Static Cost", "Src Latency", "Dst Latency", "State", "Status", "Full Cost"}
+	if onlyProblems {
+		header = append(header, "Problems")
+	}
+	t.AppendHeader(header)
 
+	problemCount := 0
 	for _, entity := range children {
+		var problems []string
+		if onlyProblems {
+			if problems = problemFilter.problems(entity); len(problems) == 0 {
+				continue
+			}
+			problemCount++
+		}
+
 		id := entity.Path("id").Data().(string)
 		srcRouter := api.GetJsonString(entity, "sourceRouter.name")
 		dstRouter := api.GetJsonString(entity, "destRouter.name")
@@ -206,52 +476,224 @@ func outputLinks(o *api.Options, children []*gabs.Container, pagingInfo *api.Pag
 			status = "down"
 		}
 
-		t.AppendRow(table.Row{id, srcRouter, dstRouter, staticCost,
+		row := table.Row{id, srcRouter, dstRouter, staticCost,
 			fmt.Sprintf("%.1fms", srcLatency),
 			fmt.Sprintf("%.1fms", dstLatency),
-			state, status, cost})
+			state, status, cost}
+		if onlyProblems {
+			row = append(row, strings.Join(problems, "\n"))
+		}
+		t.AppendRow(row)
+	}
+
+	if onlyProblems {
+		api.RenderTable(o, t, nil)
+		if format, _ := o.TableOutputFormat(); format == api.OutputFormatTable {
+			_, err := fmt.Fprintf(o.Out, "%v of %v links have problems\n", problemCount, len(children))
+			return err
+		}
+		return nil
 	}
 
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
 
-func runListTerminators(o *api.Options) error {
-	children, pagingInfo, err := listEntitiesWithOptions("terminators", o)
+// newListTerminatorsCmd creates the list command for terminators
+func newListTerminatorsCmd(options *api.Options) *cobra.Command {
+	var validateAddresses bool
+	var probeFromCLI bool
+	var probeTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "terminators <filter>?",
+		Short: "lists terminators managed by the Ziti Controller",
+		Long: "lists terminators managed by the Ziti Controller. Use --validate-addresses to check that addresses of " +
+			"router hosted terminators are well formed, and --probe-from-cli to also check that they accept TCP " +
+			"connections from the machine running the CLI. Routers can't be asked to dial an address, so the probe " +
+			"doesn't follow the path the hosting router uses. An address which the router reaches through its own " +
+			"network, DNS or firewall rules may be reported unreachable, and one reachable from the CLI may still be " +
+			"unreachable from the router",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			var checker *terminatorAddressChecker
+			if validateAddresses || probeFromCLI {
+				checker = &terminatorAddressChecker{probe: probeFromCLI, probeTimeout: probeTimeout}
+			}
+			err := runListTerminators(checker, options)
+			cmdhelper.CheckErr(err)
+		},
+		SuggestFor: []string{},
+	}
+
+	// allow interspersing positional args and flags
+	cmd.Flags().SetInterspersed(true)
+	cmd.Flags().BoolVar(&validateAddresses, "validate-addresses", false, "Check that addresses of router hosted terminators are well formed")
+	cmd.Flags().BoolVar(&probeFromCLI, "probe-from-cli", false, "Validate addresses and check that router hosted TCP/TLS terminator addresses accept connections from this machine")
+	cmd.Flags().DurationVar(&probeTimeout, "probe-timeout", 2*time.Second, "Timeout for each address probe")
+	options.AddTableOutputFlags(cmd)
+	options.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func runListTerminators(checker *terminatorAddressChecker, o *api.Options) error {
+	filter, err := o.SortFilter(stringz.OrEmpty(o.GetFilter()))
 	if err != nil {
 		return err
 	}
-	return outputTerminators(o, children, pagingInfo)
+
+	terminators, pagingInfo, err := ListTerminators(context.Background(), o, filter)
+	if err != nil {
+		return err
+	}
+	return outputTerminators(o, terminators, pagingInfo, checker)
 }
 
-func outputTerminators(o *api.Options, children []*gabs.Container, pagingInfo *api.Paging) error {
+func outputTerminators(o *api.Options, terminators []*rest_model.TerminatorDetail, pagingInfo *api.Paging, checker *terminatorAddressChecker) error {
 	if o.OutputJSONResponse {
 		return nil
 	}
 
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Service", "Router", "Binding", "Address", "Instance", "Cost", "Precedence", "Dynamic Cost", "Host ID"})
+	header := table.Row{"ID", "Service", "Router", "Binding", "Address", "Instance", "Cost", "Precedence", "Dynamic Cost", "Host ID"}
+	if checker != nil {
+		header = append(header, "Address Check")
+	}
+	t.AppendHeader(header)
 
-	for _, entity := range children {
-		id := api.GetJsonString(entity, "id")
-		service := api.GetJsonString(entity, "service.name")
-		router := api.GetJsonString(entity, "router.name")
-		binding := api.GetJsonString(entity, "binding")
-		address := api.GetJsonString(entity, "address")
-		instanceId := api.GetJsonString(entity, "instanceId")
-		staticCost := api.GetJsonString(entity, "cost")
-		precedence := api.GetJsonString(entity, "precedence")
-		dynamicCost := api.GetJsonString(entity, "dynamicCost")
-		hostId := api.GetJsonString(entity, "hostId")
-
-		t.AppendRow(table.Row{id, service, router, binding, address, instanceId, staticCost, precedence, dynamicCost, hostId})
-	}
-	api.RenderTable(o, t, pagingInfo)
+	problems := 0
+	for _, terminator := range terminators {
+		var service, router string
+		if terminator.Service != nil {
+			service = terminator.Service.Name
+		}
+		if terminator.Router != nil {
+			router = terminator.Router.Name
+		}
+
+		var staticCost, dynamicCost rest_model.TerminatorCost
+		if terminator.Cost != nil {
+			staticCost = *terminator.Cost
+		}
+		if terminator.DynamicCost != nil {
+			dynamicCost = *terminator.DynamicCost
+		}
+
+		var precedence rest_model.TerminatorPrecedence
+		if terminator.Precedence != nil {
+			precedence = *terminator.Precedence
+		}
+
+		row := table.Row{
+			stringz.OrEmpty(terminator.ID),
+			service,
+			router,
+			stringz.OrEmpty(terminator.Binding),
+			stringz.OrEmpty(terminator.Address),
+			stringz.OrEmpty(terminator.InstanceID),
+			staticCost,
+			precedence,
+			dynamicCost,
+			stringz.OrEmpty(terminator.HostID),
+		}
+
+		if checker != nil {
+			status, ok := checker.check(stringz.OrEmpty(terminator.Binding), stringz.OrEmpty(terminator.Address))
+			if !ok {
+				problems++
+			}
+			row = append(row, status)
+		}
+
+		t.AppendRow(row)
+	}
+	api.RenderEntityTable(o, t, terminators, pagingInfo)
+
+	if problems > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v terminator(s) failed address checks", problems)
+	}
 	return nil
 }
 
+// terminatorAddressChecker validates, and optionally probes, the addresses of router hosted terminators. Probes are
+// made from the machine running the CLI, so the statuses say so
+type terminatorAddressChecker struct {
+	probe        bool
+	probeTimeout time.Duration
+}
+
+// check returns a status description for the address, and false if a problem was found
+func (self *terminatorAddressChecker) check(binding, address string) (string, bool) {
+	var network string
+	switch binding {
+	case "transport":
+		network = "tcp"
+	case "transport_udp", "udp":
+		network = "udp"
+	default:
+		// addresses of sdk and tunneler hosted terminators are only meaningful to the hosting application
+		return "n/a", true
+	}
+
+	host, port, err := parseTerminatorAddress(network, address)
+	if err != nil {
+		return err.Error(), false
+	}
+
+	if !self.probe {
+		return "valid", true
+	}
+
+	if network == "udp" {
+		return "valid (udp not probed)", true
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), self.probeTimeout)
+	if err != nil {
+		return fmt.Sprintf("unreachable from CLI host: %v", err), false
+	}
+	_ = conn.Close()
+	return "reachable from CLI host", true
+}
+
+// parseTerminatorAddress checks that an address has the form <protocol>:<host>:<port>, returning the host and port
+func parseTerminatorAddress(network, address string) (string, string, error) {
+	validProtocols := []string{"tcp", "tls", "transport"}
+	if network == "udp" {
+		validProtocols = []string{"udp"}
+	}
+
+	idx := strings.Index(address, ":")
+	if idx < 0 {
+		return "", "", errors.Errorf("invalid address '%v', expected <protocol>:<host>:<port>", address)
+	}
+
+	protocol := address[:idx]
+	if !stringz.Contains(validProtocols, protocol) {
+		return "", "", errors.Errorf("invalid protocol '%v', expected one of %v", protocol, strings.Join(validProtocols, ", "))
+	}
+
+	host, port, err := net.SplitHostPort(address[idx+1:])
+	if err != nil {
+		return "", "", errors.Errorf("invalid host:port in '%v'", address)
+	}
+
+	if host == "" {
+		return "", "", errors.Errorf("no host in '%v'", address)
+	}
+
+	if portNum, err := strconv.Atoi(port); err != nil || portNum < 1 || portNum > 65535 {
+		return "", "", errors.Errorf("invalid port '%v'", port)
+	}
+
+	return host, port, nil
+}
+
 func runListServices(o *api.Options) error {
 	children, pagingInfo, err := listEntitiesWithOptions("services", o)
 	if err != nil {
@@ -265,31 +707,71 @@ func outputServices(o *api.Options, children []*gabs.Container, pagingInfo *api.
 		return nil
 	}
 
+	terminators, err := listServiceTerminators(o, children)
+	if err != nil {
+		return err
+	}
+
 	t := table.NewWriter()
 	t.SetStyle(table.StyleRounded)
-	t.AppendHeader(table.Row{"ID", "Name", "Terminator Strategy"})
+	t.AppendHeader(table.Row{"ID", "Name", "Terminator Strategy", "Terminators", "Addressing"})
 
 	for _, entity := range children {
 		id := entity.Path("id").Data().(string)
 		name := entity.Path("name").Data().(string)
 		terminatorStrategy, _ := entity.Path("terminatorStrategy").Data().(string)
-		t.AppendRow(table.Row{id, name, terminatorStrategy})
+		t.AppendRow(table.Row{id, name, terminatorStrategy, len(terminators[id]), terminatorAddressing(terminators[id])})
 	}
 
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, children, pagingInfo)
 
 	return nil
 }
 
+// listServiceTerminators returns the terminators of the given services, grouped by service id
+func listServiceTerminators(o *api.Options, services []*gabs.Container) (map[string][]*rest_model.TerminatorDetail, error) {
+	result := map[string][]*rest_model.TerminatorDetail{}
+
+	var ids []string
+	for _, entity := range services {
+		if id, ok := entity.Path("id").Data().(string); ok {
+			ids = append(ids, api.QuoteFilterString(id))
+		}
+	}
+
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	filter := fmt.Sprintf("service in [%v] limit none", strings.Join(ids, ","))
+	terminators, _, err := ListTerminators(context.Background(), o, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, terminator := range terminators {
+		if terminator.ServiceID != nil {
+			result[*terminator.ServiceID] = append(result[*terminator.ServiceID], terminator)
+		}
+	}
+
+	return result, nil
+}
+
 func runListRouters(o *api.Options) error {
-	children, pagingInfo, err := listEntitiesWithOptions("routers", o)
+	filter, err := o.SortFilter(stringz.OrEmpty(o.GetFilter()))
 	if err != nil {
 		return err
 	}
-	return outputRouters(o, children, pagingInfo)
+
+	routers, pagingInfo, err := ListRouters(context.Background(), o, filter)
+	if err != nil {
+		return err
+	}
+	return outputRouters(o, routers, pagingInfo)
 }
 
-func outputRouters(o *api.Options, children []*gabs.Container, pagingInfo *api.Paging) error {
+func outputRouters(o *api.Options, routers []*rest_model.RouterDetail, pagingInfo *api.Paging) error {
 	if o.OutputJSONResponse {
 		return nil
 	}
@@ -298,33 +780,34 @@ func outputRouters(o *api.Options, children []*gabs.Container, pagingInfo *api.P
 	t.SetStyle(table.StyleRounded)
 	t.AppendHeader(table.Row{"ID", "Name", "Online", "Cost", "No Traversal", "Version", "Listeners"})
 
-	for _, entity := range children {
-		id := entity.Path("id").Data().(string)
-		name := entity.Path("name").Data().(string)
-		connected := entity.Path("connected").Data().(bool)
-		cost := entity.Path("cost").Data().(float64)
-		versionInfo := entity.Path("versionInfo")
-		noTraversal := entity.Path("noTraversal").Data().(bool)
+	for _, router := range routers {
+		var cost int64
+		if router.Cost != nil {
+			cost = *router.Cost
+		}
+
 		var version string
-		if versionInfo != nil {
-			v := versionInfo.Path("version").Data().(string)
-			os := versionInfo.Path("os").Data().(string)
-			arch := versionInfo.Path("arch").Data().(string)
-			version = fmt.Sprintf("%v on %v/%v", v, os, arch)
+		if router.VersionInfo != nil {
+			version = fmt.Sprintf("%v on %v/%v", router.VersionInfo.Version, router.VersionInfo.Os, router.VersionInfo.Arch)
 		}
+
 		var listeners []string
-		listenerAddresses := entity.Path("listenerAddresses")
-		if listenerAddresses != nil {
-			children, _ := listenerAddresses.Children()
-			for idx, child := range children {
-				addr := child.Path("address").Data().(string)
-				listeners = append(listeners, fmt.Sprintf("%v: %v", idx+1, addr))
-			}
+		for idx, listener := range router.ListenerAddresses {
+			listeners = append(listeners, fmt.Sprintf("%v: %v", idx+1, stringz.OrEmpty(listener.Address)))
 		}
-		t.AppendRow(table.Row{id, name, connected, cost, noTraversal, version, strings.Join(listeners, "\n")})
+
+		t.AppendRow(table.Row{
+			stringz.OrEmpty(router.ID),
+			stringz.OrEmpty(router.Name),
+			router.Connected != nil && *router.Connected,
+			cost,
+			router.NoTraversal != nil && *router.NoTraversal,
+			version,
+			strings.Join(listeners, "\n"),
+		})
 	}
 
-	api.RenderTable(o, t, pagingInfo)
+	api.RenderEntityTable(o, t, routers, pagingInfo)
 
 	return nil
 }
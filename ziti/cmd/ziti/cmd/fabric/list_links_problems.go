@@ -0,0 +1,126 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+// linkProblemFilter selects the links shown by 'fabric list links --only-problems'
+type linkProblemFilter struct {
+	enabled      bool
+	maxLatency   time.Duration
+	flapWindow   time.Duration
+	flapInterval time.Duration
+	flapCount    int
+
+	// changes holds the number of state changes seen for each link while watching for flapping
+	changes map[string]int
+}
+
+func (self *linkProblemFilter) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&self.enabled, "only-problems", false, "Only show links which are down, not connected, flapping or above the latency threshold")
+	cmd.Flags().DurationVar(&self.maxLatency, "max-latency", 250*time.Millisecond, "With --only-problems, latency above which a link is reported. 0 disables the check")
+	cmd.Flags().DurationVar(&self.flapWindow, "flap-window", 0, "With --only-problems, watch links for this long to find flapping links. 0 disables the check")
+	cmd.Flags().DurationVar(&self.flapInterval, "flap-interval", 5*time.Second, "How often to sample links while watching for flapping")
+	cmd.Flags().IntVar(&self.flapCount, "flap-count", 2, "Number of state changes within the flap window at which a link is reported as flapping")
+}
+
+// linkState is the part of a link which is compared between samples to detect flapping
+func linkState(entity *gabs.Container) string {
+	down, _ := entity.Path("down").Data().(bool)
+	return fmt.Sprintf("%v/%v", api.GetJsonString(entity, "state"), down)
+}
+
+// listLinks lists links, sampling them repeatedly over the flap window if flapping should be detected. The links from
+// the last sample are returned
+func (self *linkProblemFilter) listLinks(o *api.Options) ([]*gabs.Container, *api.Paging, error) {
+	children, pagingInfo, err := listLinksWithOptions(o)
+	if err != nil || !self.enabled || self.flapWindow <= 0 {
+		return children, pagingInfo, err
+	}
+
+	self.changes = map[string]int{}
+	states := map[string]string{}
+	record := func(children []*gabs.Container) {
+		seen := map[string]bool{}
+		for _, entity := range children {
+			id := api.GetJsonString(entity, "id")
+			seen[id] = true
+			state := linkState(entity)
+			if previous, found := states[id]; found && previous != state {
+				self.changes[id]++
+			}
+			states[id] = state
+		}
+		// links which disappear, e.g. because they were removed after failing, change state as well
+		for id := range states {
+			if !seen[id] {
+				if states[id] != "" {
+					self.changes[id]++
+				}
+				states[id] = ""
+			}
+		}
+	}
+	record(children)
+
+	deadline := time.Now().Add(self.flapWindow)
+	for !time.Now().Add(self.flapInterval).After(deadline) {
+		time.Sleep(self.flapInterval)
+		if children, pagingInfo, err = listLinksWithOptions(o); err != nil {
+			return nil, nil, err
+		}
+		record(children)
+	}
+
+	return children, pagingInfo, nil
+}
+
+// problems returns the reasons the link needs attention, or nothing if it's healthy
+func (self *linkProblemFilter) problems(entity *gabs.Container) []string {
+	var result []string
+
+	if down, _ := entity.Path("down").Data().(bool); down {
+		result = append(result, "down")
+	}
+
+	if state := api.GetJsonString(entity, "state"); state != "Connected" {
+		result = append(result, "state "+strings.ToLower(state))
+	}
+
+	if count := self.changes[api.GetJsonString(entity, "id")]; self.flapCount > 0 && count >= self.flapCount {
+		result = append(result, fmt.Sprintf("flapping (%v changes in %v)", count, self.flapWindow))
+	}
+
+	if self.maxLatency > 0 {
+		for _, field := range []string{"sourceLatency", "destLatency"} {
+			latency, _ := entity.Path(field).Data().(float64)
+			if time.Duration(latency) > self.maxLatency {
+				result = append(result, fmt.Sprintf("%v %.1fms", strings.TrimSuffix(field, "Latency")+" latency", latency/1_000_000))
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,239 @@
+package fabric
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitPathSelectors(t *testing.T) {
+	req := require.New(t)
+
+	nodes := []*entityRef{{id: "r1", name: "router-one"}, {id: "r2", name: "router-two"}}
+	links := []*entityRef{{id: "link1"}}
+
+	selectors, err := parseCircuitPathSelectors([]string{"r/router-one", "l/link1"})
+	req.NoError(err)
+	req.True(circuitPathMatches(selectors, nodes, links))
+
+	selectors, err = parseCircuitPathSelectors([]string{"r/r2"})
+	req.NoError(err)
+	req.True(circuitPathMatches(selectors, nodes, links))
+
+	selectors, err = parseCircuitPathSelectors([]string{"r/router-one", "r/router-three"})
+	req.NoError(err)
+	req.False(circuitPathMatches(selectors, nodes, links))
+
+	selectors, err = parseCircuitPathSelectors([]string{"l/router-one"})
+	req.NoError(err)
+	req.False(circuitPathMatches(selectors, nodes, links))
+
+	_, err = parseCircuitPathSelectors([]string{"router-one"})
+	req.Error(err)
+
+	_, err = parseCircuitPathSelectors([]string{"r/"})
+	req.Error(err)
+}
+
+func TestCircuitAgeFilter(t *testing.T) {
+	req := require.New(t)
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	circuit := func(createdAt string) *gabs.Container {
+		c := gabs.New()
+		_, err := c.Set(createdAt, "createdAt")
+		req.NoError(err)
+		return c
+	}
+	young := circuit("2022-06-01T11:58:00.123Z")
+	old := circuit("2022-05-30T12:00:00Z")
+
+	filter := &circuitAgeFilter{minAge: "1d"}
+	req.NoError(filter.parse())
+	req.False(filter.matches(young, now))
+	req.True(filter.matches(old, now))
+
+	filter = &circuitAgeFilter{maxAge: "5m"}
+	req.NoError(filter.parse())
+	req.True(filter.matches(young, now))
+	req.False(filter.matches(old, now))
+	req.False(filter.matches(circuit(""), now))
+
+	filter = &circuitAgeFilter{minAge: "1m", maxAge: "3d"}
+	req.NoError(filter.parse())
+	req.True(filter.matches(young, now))
+	req.True(filter.matches(old, now))
+
+	req.Error((&circuitAgeFilter{minAge: "2h", maxAge: "1h"}).parse())
+	req.Error((&circuitAgeFilter{maxAge: "soon"}).parse())
+}
+
+func TestTerminatorAddressChecker(t *testing.T) {
+	req := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	req.NoError(err)
+	defer func() { _ = listener.Close() }()
+	open := listener.Addr().String()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	req.NoError(err)
+	closedAddr := closed.Addr().String()
+	req.NoError(closed.Close())
+
+	validator := &terminatorAddressChecker{}
+	prober := &terminatorAddressChecker{probe: true, probeTimeout: time.Second}
+
+	tests := []struct {
+		checker *terminatorAddressChecker
+		binding string
+		address string
+		status  string
+		ok      bool
+	}{
+		{validator, "edge", "hosted:abc", "n/a", true},
+		{validator, "transport", "tcp:" + closedAddr, "valid", true},
+		{validator, "transport", "tls:example.com:443", "valid", true},
+		{validator, "transport", "udp:example.com:53", "invalid protocol 'udp', expected one of tcp, tls, transport", false},
+		{validator, "transport", "tcp:example.com", "invalid host:port in 'tcp:example.com'", false},
+		{validator, "transport", "tcp::443", "no host in 'tcp::443'", false},
+		{validator, "transport", "tcp:example.com:70000", "invalid port '70000'", false},
+		{validator, "transport_udp", "udp:example.com:53", "valid", true},
+		{prober, "transport_udp", "udp:example.com:53", "valid (udp not probed)", true},
+		{prober, "transport", "tcp:" + open, "reachable from CLI host", true},
+		{prober, "transport", "tcp:" + closedAddr, "unreachable from CLI host", false},
+	}
+
+	for _, test := range tests {
+		status, ok := test.checker.check(test.binding, test.address)
+		req.Equal(test.ok, ok, test.address)
+		req.True(strings.HasPrefix(status, test.status), "%v: %v", test.address, status)
+	}
+}
+
+func TestOutputTerminatorsAddressChecks(t *testing.T) {
+	req := require.New(t)
+
+	terminator := func(id, binding, address string) *rest_model.TerminatorDetail {
+		result := &rest_model.TerminatorDetail{Binding: &binding, Address: &address}
+		result.ID = &id
+		return result
+	}
+
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+	o := &api.Options{CommonOptions: common.CommonOptions{Out: out, Cmd: cmd}}
+
+	valid := []*rest_model.TerminatorDetail{
+		terminator("t1", "transport", "tcp:example.com:443"),
+		terminator("t2", "edge", "hosted:abc"),
+	}
+	req.NoError(outputTerminators(o, valid, nil, &terminatorAddressChecker{}))
+	req.Contains(out.String(), "ADDRESS CHECK")
+
+	invalid := append(valid, terminator("t3", "transport", "tcp:example.com"))
+	err := outputTerminators(o, invalid, nil, &terminatorAddressChecker{})
+	req.Error(err)
+	req.Equal("1 terminator(s) failed address checks", err.Error())
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+
+	req.NoError(outputTerminators(o, invalid, nil, nil), "addresses aren't checked without a checker")
+}
+
+func TestListLinks(t *testing.T) {
+	newLink := func(id, source, dest, state string, cost int) map[string]interface{} {
+		return map[string]interface{}{
+			"id":            id,
+			"sourceRouter":  map[string]interface{}{"id": source, "name": "router-" + source},
+			"destRouter":    map[string]interface{}{"id": dest, "name": "router-" + dest},
+			"staticCost":    1,
+			"sourceLatency": 2_000_000,
+			"destLatency":   3_000_000,
+			"state":         state,
+			"down":          state != "Connected",
+			"cost":          cost,
+		}
+	}
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"links": {
+			newLink("l1", "r1", "r2", "Connected", 12),
+			newLink("l2", "r2", "r3", "Connected", 3),
+			newLink("l3", "r1", "r3", "Failed", 7),
+			newLink("l4", "r1", "r4", "Connected", 20),
+			newLink("l5", "r3", "r4", "Connected", 5),
+		},
+	})
+
+	t.Run("table", func(t *testing.T) {
+		req := require.New(t)
+		out := &bytes.Buffer{}
+		o := newTestOptions(out, `state = "Connected" sort by cost desc limit 2`)
+		req.NoError(runListLinks(&linkProblemFilter{}, &o))
+
+		output := out.String()
+		req.Contains(output, "results: 1-2 of 4")
+		req.NotContains(output, "l2")
+		req.NotContains(output, "l3")
+		req.NotContains(output, "l5")
+		// the sort clause picks the page, the rows are then shown in id order
+		req.Less(strings.Index(output, "l1"), strings.Index(output, "l4"))
+		req.Contains(output, "router-r1")
+	})
+
+	outputJSON := func(t *testing.T, problemFilter *linkProblemFilter, args ...string) ([]string, map[string]interface{}) {
+		out := &bytes.Buffer{}
+		o := newTestOptions(out, args...)
+		o.OutputJSONResponse = true
+		require.NoError(t, runListLinks(problemFilter, &o))
+
+		var result struct {
+			Data []map[string]interface{} `json:"data"`
+			Meta struct {
+				Pagination map[string]interface{} `json:"pagination"`
+			} `json:"meta"`
+		}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &result), out.String())
+		var ids []string
+		for _, link := range result.Data {
+			ids = append(ids, link["id"].(string))
+		}
+		return ids, result.Meta.Pagination
+	}
+
+	t.Run("json", func(t *testing.T) {
+		req := require.New(t)
+		ids, pagination := outputJSON(t, &linkProblemFilter{}, `sourceRouter.name = "router-r1" sort by id skip 1 limit 1`)
+		req.Equal([]string{"l3"}, ids)
+		req.Equal(map[string]interface{}{"limit": float64(1), "offset": float64(1), "totalCount": float64(3)}, pagination)
+
+		ids, pagination = outputJSON(t, &linkProblemFilter{})
+		req.Equal([]string{"l1", "l2", "l3", "l4", "l5"}, ids)
+		req.Equal(float64(5), pagination["totalCount"])
+	})
+
+	t.Run("json problems", func(t *testing.T) {
+		req := require.New(t)
+		ids, pagination := outputJSON(t, &linkProblemFilter{enabled: true}, `cost > 5`)
+		req.Equal([]string{"l3"}, ids)
+		req.Equal(float64(1), pagination["totalCount"])
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		o := newTestOptions(&bytes.Buffer{}, `state = `)
+		err := runListLinks(&linkProblemFilter{}, &o)
+		require.Equal(t, cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+	})
+}
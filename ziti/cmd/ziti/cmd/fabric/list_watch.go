@@ -0,0 +1,147 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+const clearScreen = "\033[H\033[2J"
+
+// listWatchOptions re-runs a list command periodically, redrawing its output in place, so that operators can monitor
+// circuits, links and routers without wrapping the CLI in watch(1)
+type listWatchOptions struct {
+	interval time.Duration
+}
+
+func (self *listWatchOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&self.interval, "watch", 0, "Refresh the output every interval, e.g. --watch or --watch=5s, highlighting rows which changed")
+	cmd.Flags().Lookup("watch").NoOptDefVal = "2s"
+}
+
+// wrap returns a runner which watches the given list command if --watch is set
+func (self *listWatchOptions) wrap(runner listCommandRunner) listCommandRunner {
+	return func(o *api.Options) error {
+		return self.run(o, func() error {
+			return runner(o)
+		})
+	}
+}
+
+// run runs the given list command once or, if --watch is set, until interrupted. Each time, the output of the command is
+// captured and then drawn on a cleared screen, with the lines which weren't in the previous output highlighted. Errors
+// after the first listing are shown in place of the output, so that watching survives a controller restart
+func (self *listWatchOptions) run(o *api.Options, list func() error) error {
+	if self.interval == 0 {
+		return list()
+	}
+	if self.interval < 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --watch %v, must be greater than 0", self.interval)
+	}
+
+	format, err := o.TableOutputFormat()
+	if err != nil {
+		return err
+	}
+	highlight := format == api.OutputFormatTable && !o.OutputJSONResponse
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	out := o.Cmd.OutOrStdout()
+	var previous []string
+	for first := true; ; first = false {
+		output, err := captureListOutput(o, list)
+		if err != nil && (first || cmdhelper.ExitCodeForError(err) == cmdhelper.ExitCodeUsage) {
+			return err
+		}
+
+		header := fmt.Sprintf("Every %v: %v", self.interval, strings.Join(append([]string{o.Cmd.CommandPath()}, o.Args...), " "))
+		_, _ = fmt.Fprintf(out, "%v%v    %v\n\n", clearScreen, header, time.Now().Format(time.RFC3339))
+
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "unable to list: %v\n", err)
+		} else {
+			lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+			if highlight && previous != nil {
+				lines = highlightChangedLines(previous, lines, color.New(color.Bold, color.FgYellow).Sprint)
+			}
+			writeLines(out, lines)
+			previous = strings.Split(strings.TrimRight(output, "\n"), "\n")
+		}
+
+		select {
+		case <-interrupted:
+			return nil
+		case <-time.After(self.interval):
+		}
+	}
+}
+
+// captureListOutput runs the given list command, returning what it wrote instead of writing it out
+func captureListOutput(o *api.Options, list func() error) (string, error) {
+	buf := &bytes.Buffer{}
+	out, cmdOut := o.Out, o.Cmd.OutOrStdout()
+	o.Out = buf
+	o.Cmd.SetOut(buf)
+	defer func() {
+		o.Out = out
+		o.Cmd.SetOut(cmdOut)
+	}()
+
+	err := list()
+	return buf.String(), err
+}
+
+// highlightChangedLines returns the given lines, with those which weren't in the previous lines highlighted. As rows are
+// compared as a whole, a row which moved is left as is, while a row with any changed cell is highlighted
+func highlightChangedLines(previous, lines []string, highlight func(a ...interface{}) string) []string {
+	seen := map[string]int{}
+	for _, line := range previous {
+		seen[line]++
+	}
+
+	var result []string
+	for _, line := range lines {
+		if seen[line] > 0 {
+			seen[line]--
+			result = append(result, line)
+		} else {
+			result = append(result, highlight(line))
+		}
+	}
+	return result
+}
+
+func writeLines(out io.Writer, lines []string) {
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(out, line)
+	}
+}
@@ -0,0 +1,34 @@
+package fabric
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightChangedLines(t *testing.T) {
+	req := require.New(t)
+
+	mark := func(a ...interface{}) string {
+		return "*" + a[0].(string)
+	}
+
+	previous := []string{"| ID | STATE     |", "| a  | Connected |", "| b  | Connected |", "|    |           |"}
+	lines := []string{"| ID | STATE     |", "| b  | Connected |", "| a  | Failed    |", "|    |           |", "|    |           |"}
+
+	req.Equal([]string{"| ID | STATE     |", "| b  | Connected |", "*| a  | Failed    |", "|    |           |", "*|    |           |"},
+		highlightChangedLines(previous, lines, mark))
+}
+
+func TestListWatchRunsOnceWithoutInterval(t *testing.T) {
+	req := require.New(t)
+
+	calls := 0
+	watch := &listWatchOptions{}
+	err := watch.run(nil, func() error {
+		calls++
+		return nil
+	})
+	req.NoError(err)
+	req.Equal(1, calls)
+}
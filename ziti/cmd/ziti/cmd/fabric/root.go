@@ -33,6 +33,10 @@ func NewFabricCmd(p common.OptionsProvider) *cobra.Command {
 	fabricCmd.AddCommand(newAddIdentityCmd(p), newRemoveIdentityCmd(p))
 	fabricCmd.AddCommand(newCreateCommand(p), newListCmd(p), newUpdateCommand(p), newDeleteCmd(p))
 	fabricCmd.AddCommand(newInspectCmd(p))
+	fabricCmd.AddCommand(newLinksCmd(p))
+	fabricCmd.AddCommand(newRoutersCmd(p))
+	fabricCmd.AddCommand(newServicesCmd(p))
+	fabricCmd.AddCommand(newTerminatorsCmd(p))
 	fabricCmd.AddCommand(newDbCmd(p))
 	fabricCmd.AddCommand(newStreamCommand(p))
 	return fabricCmd
@@ -82,6 +86,7 @@ func newStreamCommand(p common.OptionsProvider) *cobra.Command {
 
 	streamCmd.AddCommand(NewStreamMetricsCmd(p))
 	streamCmd.AddCommand(NewStreamCircuitsCmd(p))
+	streamCmd.AddCommand(newStreamEventsCmd(p))
 	streamTracesCmd := NewStreamTracesCmd(p)
 	streamCmd.AddCommand(streamTracesCmd)
 
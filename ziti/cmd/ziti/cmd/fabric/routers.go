@@ -0,0 +1,295 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openziti/agent"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/fabric/router"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/common/agentops"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newRoutersCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "routers",
+		Short: "Operational tools for fabric routers",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newRouterLifecycleCmd(p, false))
+	cmd.AddCommand(newRouterLifecycleCmd(p, true))
+	cmd.AddCommand(newRouterAdoptCmd(p))
+	cmd.AddCommand(newRouterPingCmd(p))
+
+	return cmd
+}
+
+func newRouterLifecycleCmd(p common.OptionsProvider, restart bool) *cobra.Command {
+	action := &routerLifecycleCmd{
+		Options: api.Options{CommonOptions: p()},
+		restart: restart,
+	}
+	return action.newCobraCmd()
+}
+
+type routerLifecycleCmd struct {
+	api.Options
+	restart        bool
+	agentTarget    string
+	noDrain        bool
+	drainTimeout   time.Duration
+	restartTimeout time.Duration
+	pollInterval   time.Duration
+	yes            bool
+}
+
+func (self *routerLifecycleCmd) verb() string {
+	if self.restart {
+		return "restart"
+	}
+	return "shutdown"
+}
+
+func (self *routerLifecycleCmd) newCobraCmd() *cobra.Command {
+	long := "Drains the router by marking it no-traversal and waiting for the circuits using it to finish, then " +
+		"shuts it down through the router's IPC agent, given with --agent. Without --agent the command waits for the " +
+		"router process to be stopped some other way. "
+	if self.restart {
+		long += "Once the router has disconnected, the command waits for it to be started again, e.g. by its " +
+			"supervisor, to reconnect and then restores its previous no-traversal setting. The setting is also " +
+			"restored if the restart fails or times out"
+	} else {
+		long += "The router is left marked no-traversal, so it isn't used for transit if it's started again until " +
+			"that is reset with 'ziti fabric update router <router> --no-traversal=false', also if the shutdown fails"
+	}
+
+	cmd := &cobra.Command{
+		Use:   self.verb() + " <router id or name>",
+		Short: fmt.Sprintf("Drains and %vs a router", self.verb()),
+		Long:  long,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self.Cmd = cmd
+			self.Args = args
+			return self.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&self.agentTarget, "agent", "", "IPC agent of the router process, as a pid or address. The agent is only reachable from the router host unless it listens on tcp")
+	cmd.Flags().BoolVar(&self.noDrain, "no-drain", false, "Don't wait for circuits using the router to finish")
+	cmd.Flags().DurationVar(&self.drainTimeout, "drain-timeout", 5*time.Minute, "How long to wait for circuits using the router to finish before proceeding anyway")
+	cmd.Flags().DurationVar(&self.pollInterval, "poll-interval", 5*time.Second, "How often to check the router and its circuits")
+	if self.restart {
+		cmd.Flags().DurationVar(&self.restartTimeout, "restart-timeout", 5*time.Minute, "How long to wait for the router to disconnect and reconnect")
+	} else {
+		cmd.Flags().DurationVar(&self.restartTimeout, "disconnect-timeout", 5*time.Minute, "How long to wait for the router to disconnect")
+	}
+	cmd.Flags().BoolVarP(&self.yes, "yes", "y", false, "Don't ask for confirmation")
+	self.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func (self *routerLifecycleCmd) run() (err error) {
+	id, err := api.MapNameToID(util.FabricAPI, "routers", &self.Options, self.Args[0])
+	if err != nil {
+		return err
+	}
+
+	r, err := self.detailRouter(id)
+	if err != nil {
+		return err
+	}
+	name := stringz.OrEmpty(r.Name)
+
+	if r.Connected == nil || !*r.Connected {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "router %v is not connected", name)
+	}
+
+	if !self.yes && !util.Confirm(fmt.Sprintf("%v router %v?", self.verb(), name), false, "") {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeCancelled, "cancelled")
+	}
+
+	// if the command fails after marking the router no-traversal, a restart restores traversal, while a shutdown
+	// leaves the router marked, and the user is told how to reset it
+	wasNoTraversal := r.NoTraversal != nil && *r.NoTraversal
+	restoreAttempted := false
+	if !wasNoTraversal {
+		if err = self.setNoTraversal(id, true); err != nil {
+			return err
+		}
+		self.Printf("marked router %v no-traversal\n", name)
+
+		defer func() {
+			if err == nil {
+				return
+			}
+			if self.restart && !restoreAttempted {
+				restoreErr := self.setNoTraversal(id, false)
+				if restoreErr == nil {
+					self.Printf("restored traversal for router %v\n", name)
+					return
+				}
+				self.Printf("unable to restore traversal for router %v: %v\n", name, restoreErr)
+			}
+			self.Printf("warning: router %v is still marked no-traversal, reset it with 'ziti fabric update router %v --no-traversal=false'\n", name, id)
+		}()
+	}
+
+	if !self.noDrain {
+		if err = self.drain(id, name); err != nil {
+			return err
+		}
+	}
+
+	if self.agentTarget != "" {
+		if err = self.requestShutdown(); err != nil {
+			return err
+		}
+	} else {
+		self.Printf("router %v is ready to %v, stop the router process now\n", name, self.verb())
+	}
+
+	deadline := time.Now().Add(self.restartTimeout)
+	if err = self.waitForConnected(id, false, deadline); err != nil {
+		return err
+	}
+	self.Printf("router %v disconnected\n", name)
+
+	if !self.restart {
+		return nil
+	}
+
+	if err = self.waitForConnected(id, true, deadline); err != nil {
+		return err
+	}
+	self.Printf("router %v reconnected\n", name)
+
+	if !wasNoTraversal {
+		restoreAttempted = true
+		if err = self.setNoTraversal(id, false); err != nil {
+			return err
+		}
+		self.Printf("restored traversal for router %v\n", name)
+	}
+
+	return nil
+}
+
+func (self *routerLifecycleCmd) detailRouter(id string) (*rest_model.RouterDetail, error) {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+	return DetailRouter(ctx, &self.Options, id)
+}
+
+func (self *routerLifecycleCmd) setNoTraversal(id string, noTraversal bool) error {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+	return SetRouterNoTraversal(ctx, &self.Options, id, noTraversal)
+}
+
+// drain waits until no circuits pass through or terminate at the router, or the drain timeout passes
+func (self *routerLifecycleCmd) drain(id, name string) error {
+	deadline := time.Now().Add(self.drainTimeout)
+	for {
+		ctx, cancel := self.TimeoutContext()
+		circuits, err := ListCircuits(ctx, &self.Options)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		count := CountRouterCircuits(circuits, id)
+		if count == 0 {
+			self.Printf("router %v has no circuits\n", name)
+			return nil
+		}
+
+		if time.Now().Add(self.pollInterval).After(deadline) {
+			self.Printf("router %v still has %v circuits after %v, proceeding\n", name, count, self.drainTimeout)
+			return nil
+		}
+
+		self.Printf("waiting for %v circuits using router %v to finish\n", count, name)
+		time.Sleep(self.pollInterval)
+	}
+}
+
+// CountRouterCircuits returns how many of the given circuits have the router in their path
+func CountRouterCircuits(circuits []*rest_model.CircuitDetail, routerId string) int {
+	count := 0
+	for _, c := range circuits {
+		if c.Path == nil {
+			continue
+		}
+		for _, node := range c.Path.Nodes {
+			if node != nil && node.ID == routerId {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func (self *routerLifecycleCmd) requestShutdown() error {
+	addr, err := agent.ParseGopsAddress([]string{self.agentTarget})
+	if err != nil {
+		return err
+	}
+
+	buf := []byte{router.AgentAppId, agentops.RouterShutdown}
+	if err = agent.MakeRequest(addr, agent.CustomOp, buf, self.Out); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, errors.Wrapf(err, "unable to request shutdown through agent %v", self.agentTarget))
+	}
+	return nil
+}
+
+func (self *routerLifecycleCmd) waitForConnected(id string, connected bool, deadline time.Time) error {
+	for {
+		r, err := self.detailRouter(id)
+		if err != nil {
+			return err
+		}
+
+		if r.Connected != nil && *r.Connected == connected {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			state := "disconnect"
+			if connected {
+				state = "reconnect"
+			}
+			return errors.Errorf("timed out waiting for router %v to %v", stringz.OrEmpty(r.Name), state)
+		}
+
+		time.Sleep(self.pollInterval)
+	}
+}
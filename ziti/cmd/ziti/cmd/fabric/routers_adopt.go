@@ -0,0 +1,376 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/identity/certtools"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// routerAdoptColumns are the columns understood in an adoption CSV. Either fingerprint or cert must be present
+var routerAdoptColumns = []string{"name", "id", "fingerprint", "cert", "cost", "noTraversal", "tags"}
+
+func newRouterAdoptCmd(p common.OptionsProvider) *cobra.Command {
+	action := &routerAdoptCmd{
+		Options: api.Options{CommonOptions: p()},
+	}
+	return action.newCobraCmd()
+}
+
+type routerAdoptCmd struct {
+	api.Options
+	fromCSV string
+	dryRun  bool
+	bulk    api.BulkOptions
+}
+
+// routerAdoption is a router to create, read from a row of the adoption CSV
+type routerAdoption struct {
+	line        int
+	name        string
+	id          string
+	fingerprint string
+	cost        uint16
+	noTraversal bool
+	tags        map[string]string
+	err         error
+	skipped     bool
+}
+
+// key identifies the row in failure reports
+func (self *routerAdoption) key() string {
+	if self.id != "" {
+		return self.id
+	}
+	return self.name
+}
+
+func (self *routerAdoptCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "adopt",
+		Short: "Creates router records in bulk for pre-provisioned routers, from a CSV file",
+		Long: "Creates a router record for each row of a CSV file, for large initial deployments of routers whose " +
+			"certificates were issued up front. The first row names the columns, which may be " +
+			strings.Join(routerAdoptColumns, ", ") + ". Each row needs a name and either the fingerprint of the " +
+			"router's certificate or the path to it, relative to the CSV file. The id defaults to the common name of " +
+			"the certificate, or else the name. Tags are given as key=value pairs separated by ';'.\n\n" +
+			"All rows are validated before any router is created. Rows which fail are reported and the remaining rows " +
+			"are still created, unless --fail-fast is set. Use --failure-report to record the rows which failed, and " +
+			"run the command again with --retry-failed to create just those.",
+		Example: "ziti fabric routers adopt --from-csv routers.csv\n\n" +
+			"routers.csv:\n" +
+			"name,cert,cost,noTraversal,tags\n" +
+			"edge-east-1,certs/edge-east-1.cert,10,false,region=east;tier=edge\n" +
+			"edge-west-1,certs/edge-west-1.cert,10,true,region=west",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self.Cmd = cmd
+			self.Args = args
+			return self.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&self.fromCSV, "from-csv", "", "CSV file listing the routers to create")
+	cmd.Flags().BoolVar(&self.dryRun, "dry-run", false, "Only validate the CSV file, without creating any routers")
+	_ = cmd.MarkFlagRequired("from-csv")
+	self.bulk.AddBulkFlags(cmd, true)
+	self.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func (self *routerAdoptCmd) run() error {
+	file, err := os.Open(self.fromCSV)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	adoptions, err := parseRouterAdoptions(file, filepath.Dir(self.fromCSV))
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid CSV file %v: %v", self.fromCSV, err)
+	}
+
+	run, err := self.bulk.StartBulk("create routers")
+	if err != nil {
+		return err
+	}
+
+	var included []*routerAdoption
+	for _, adoption := range adoptions {
+		if run.Include(adoption.key()) {
+			included = append(included, adoption)
+		}
+	}
+	adoptions = included
+	if len(adoptions) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no routers found in %v", self.fromCSV)
+	}
+
+	// invalid rows are recorded first, so that with --fail-fast no routers are created if any row is invalid
+	for _, adoption := range adoptions {
+		if adoption.err != nil {
+			run.Failed(adoption.key(), adoption.name, cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, adoption.err))
+		}
+	}
+
+	for _, adoption := range adoptions {
+		if adoption.err != nil || self.dryRun {
+			continue
+		}
+		if run.Stopped() {
+			adoption.skipped = true
+			run.Skipped(adoption.key(), adoption.name)
+			continue
+		}
+		if adoption.err = self.createRouter(adoption); adoption.err != nil {
+			run.Failed(adoption.key(), adoption.name, adoption.err)
+			continue
+		}
+		run.Succeeded()
+	}
+
+	self.outputAdoptions(adoptions)
+
+	return run.Finish()
+}
+
+func (self *routerAdoptCmd) createRouter(adoption *routerAdoption) error {
+	entityData := gabs.New()
+	api.SetJSONValue(entityData, adoption.id, "id")
+	api.SetJSONValue(entityData, adoption.name, "name")
+	api.SetJSONValue(entityData, adoption.fingerprint, "fingerprint")
+	api.SetJSONValue(entityData, adoption.tags, "tags")
+	api.SetJSONValue(entityData, adoption.cost, "cost")
+	api.SetJSONValue(entityData, adoption.noTraversal, "noTraversal")
+	_, err := createEntityOfType("routers", entityData.String(), &self.Options)
+	return err
+}
+
+func (self *routerAdoptCmd) outputAdoptions(adoptions []*routerAdoption) {
+	if self.OutputJSONResponse {
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Line", "Name", "ID", "Fingerprint", "Cost", "No Traversal", "Result"})
+	created := 0
+	for _, adoption := range adoptions {
+		result := "created"
+		if adoption.err != nil {
+			result = adoption.err.Error()
+		} else if adoption.skipped {
+			result = "not attempted"
+		} else if self.dryRun {
+			result = "valid"
+		} else {
+			created++
+		}
+		t.AppendRow(table.Row{adoption.line, adoption.name, adoption.id, adoption.fingerprint, adoption.cost, adoption.noTraversal, result})
+	}
+	api.RenderTable(&self.Options, t, nil)
+
+	if self.dryRun {
+		self.Printf("dry run, no routers created\n")
+	} else {
+		self.Printf("%v of %v routers created\n", created, len(adoptions))
+	}
+}
+
+// parseRouterAdoptions reads the routers to create from an adoption CSV. Certificate paths are relative to baseDir.
+// Errors in individual rows are recorded on the row, so that they can be reported together, while an error is only
+// returned if the file as a whole can't be read
+func parseRouterAdoptions(reader io.Reader, baseDir string) ([]*routerAdoption, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	csvReader.Comment = '#'
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for idx, column := range header {
+		column = strings.TrimSpace(column)
+		known := false
+		for _, name := range routerAdoptColumns {
+			if strings.EqualFold(column, name) {
+				columns[name] = idx
+				known = true
+			}
+		}
+		if !known {
+			return nil, errors.Errorf("unknown column '%v', must be one of %v", column, strings.Join(routerAdoptColumns, ", "))
+		}
+	}
+	if _, found := columns["name"]; !found {
+		return nil, errors.New("a name column is required")
+	}
+	_, hasFingerprint := columns["fingerprint"]
+	_, hasCert := columns["cert"]
+	if !hasFingerprint && !hasCert {
+		return nil, errors.New("a fingerprint or cert column is required")
+	}
+	csvReader.FieldsPerRecord = len(header)
+
+	var adoptions []*routerAdoption
+	seen := map[string]int{}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := csvReader.FieldPos(0)
+		value := func(column string) string {
+			if idx, found := columns[column]; found {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+
+		adoption := &routerAdoption{line: line}
+		adoption.err = adoption.parse(value, baseDir)
+		if adoption.err == nil {
+			for _, key := range []string{"name:" + adoption.name, "id:" + adoption.id, "fingerprint:" + adoption.fingerprint} {
+				if prevLine, found := seen[key]; found {
+					adoption.err = errors.Errorf("duplicate %v, already used on line %v", strings.Replace(key, ":", " ", 1), prevLine)
+					break
+				}
+			}
+			if adoption.err == nil {
+				for _, key := range []string{"name:" + adoption.name, "id:" + adoption.id, "fingerprint:" + adoption.fingerprint} {
+					seen[key] = line
+				}
+			}
+		}
+		adoptions = append(adoptions, adoption)
+	}
+	return adoptions, nil
+}
+
+// parse fills in the router from the values of a CSV row
+func (self *routerAdoption) parse(value func(column string) string, baseDir string) error {
+	self.name = value("name")
+	if self.name == "" {
+		return errors.New("name is required")
+	}
+
+	self.fingerprint = normalizeFingerprint(value("fingerprint"))
+	if self.fingerprint != "" {
+		if decoded, err := hex.DecodeString(self.fingerprint); err != nil || len(decoded) != sha1.Size {
+			return errors.Errorf("invalid fingerprint '%v', must be the hex encoded SHA-1 of the certificate", value("fingerprint"))
+		}
+	}
+
+	var commonName string
+	if certPath := value("cert"); certPath != "" {
+		if !filepath.IsAbs(certPath) {
+			certPath = filepath.Join(baseDir, certPath)
+		}
+		certs, err := certtools.LoadCertFromFile(certPath)
+		if err != nil {
+			return errors.Errorf("unable to load cert %v: %v", certPath, err)
+		}
+		if len(certs) == 0 {
+			return errors.Errorf("no certificate found in %v", certPath)
+		}
+		fingerprint := fmt.Sprintf("%x", sha1.Sum(certs[0].Raw))
+		if self.fingerprint != "" && self.fingerprint != fingerprint {
+			return errors.Errorf("fingerprint doesn't match cert %v", certPath)
+		}
+		self.fingerprint = fingerprint
+		commonName = certs[0].Subject.CommonName
+	}
+	if self.fingerprint == "" {
+		return errors.New("a fingerprint or cert is required")
+	}
+
+	self.id = value("id")
+	if self.id == "" {
+		self.id = commonName
+	}
+	if self.id == "" {
+		self.id = self.name
+	}
+	if commonName != "" && self.id != commonName {
+		return errors.Errorf("id %v doesn't match the common name %v of the cert", self.id, commonName)
+	}
+
+	if cost := value("cost"); cost != "" {
+		parsed, err := strconv.ParseUint(cost, 10, 16)
+		if err != nil {
+			return errors.Errorf("invalid cost '%v', must be between 0 and 65535", cost)
+		}
+		self.cost = uint16(parsed)
+	}
+
+	if noTraversal := value("noTraversal"); noTraversal != "" {
+		parsed, err := strconv.ParseBool(noTraversal)
+		if err != nil {
+			return errors.Errorf("invalid noTraversal '%v', must be true or false", noTraversal)
+		}
+		self.noTraversal = parsed
+	}
+
+	self.tags = map[string]string{}
+	if tags := value("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, ";") {
+			if tag = strings.TrimSpace(tag); tag == "" {
+				continue
+			}
+			key, tagValue, found := strings.Cut(tag, "=")
+			if !found || strings.TrimSpace(key) == "" {
+				return errors.Errorf("invalid tag '%v', must be key=value", tag)
+			}
+			self.tags[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+		}
+	}
+	return nil
+}
+
+// normalizeFingerprint lower cases a fingerprint and removes the separators of formats such as openssl's
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(fingerprint)
+	for _, separator := range []string{":", " ", "-"} {
+		fingerprint = strings.ReplaceAll(fingerprint, separator, "")
+	}
+	return fingerprint
+}
@@ -0,0 +1,79 @@
+package fabric
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRouterAdoptions(t *testing.T) {
+	req := require.New(t)
+	dir := t.TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "r-east"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	req.NoError(err)
+	req.NoError(os.WriteFile(filepath.Join(dir, "east.cert"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	certFingerprint := fmt.Sprintf("%x", sha1.Sum(der))
+
+	fingerprint := strings.Repeat("ab", sha1.Size)
+	csvData := "name,id,fingerprint,cert,cost,noTraversal,tags\n" +
+		"# comments are skipped\n" +
+		"east,,,east.cert,10,true,region=east; tier = edge\n" +
+		"west,r-west," + strings.ToUpper(strings.Repeat("AB:", sha1.Size-1)) + "AB,,,,\n" +
+		"north,,,,,,\n" +
+		"south,,zz,,,,\n" +
+		"dup,r-west," + strings.Repeat("cd", sha1.Size) + ",,,,\n" +
+		"costly,," + strings.Repeat("ef", sha1.Size) + ",,70000,,\n" +
+		"tagged,," + strings.Repeat("01", sha1.Size) + ",,,,region\n"
+
+	adoptions, err := parseRouterAdoptions(strings.NewReader(csvData), dir)
+	req.NoError(err)
+	req.Len(adoptions, 7)
+
+	east := adoptions[0]
+	req.NoError(east.err)
+	req.Equal(3, east.line)
+	req.Equal("r-east", east.id, "the id defaults to the common name of the cert")
+	req.Equal(certFingerprint, east.fingerprint)
+	req.Equal(uint16(10), east.cost)
+	req.True(east.noTraversal)
+	req.Equal(map[string]string{"region": "east", "tier": "edge"}, east.tags)
+
+	west := adoptions[1]
+	req.NoError(west.err)
+	req.Equal("r-west", west.id)
+	req.Equal(fingerprint, west.fingerprint, "fingerprints are normalized")
+
+	req.ErrorContains(adoptions[2].err, "a fingerprint or cert is required")
+	req.ErrorContains(adoptions[3].err, "invalid fingerprint")
+	req.ErrorContains(adoptions[4].err, "duplicate id r-west, already used on line 4")
+	req.ErrorContains(adoptions[5].err, "invalid cost")
+	req.ErrorContains(adoptions[6].err, "invalid tag")
+
+	_, err = parseRouterAdoptions(strings.NewReader("name,fingerprint,color\n"), dir)
+	req.ErrorContains(err, "unknown column 'color'")
+
+	_, err = parseRouterAdoptions(strings.NewReader("name,cost\n"), dir)
+	req.ErrorContains(err, "a fingerprint or cert column is required")
+}
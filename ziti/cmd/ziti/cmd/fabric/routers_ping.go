@@ -0,0 +1,428 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/fabric/rest_client"
+	"github.com/openziti/fabric/rest_client/inspect"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/metrics/metrics_pb"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// routerPingValue is requested from the routers being pinged. No router provides a value of this name, so each
+// request only measures the round trip over the control channel
+const routerPingValue = "ping"
+
+// Router ping statuses
+const (
+	routerPingOk                 = "ok"
+	routerPingDisconnected       = "disconnected"
+	routerPingUnreachable        = "unreachable"
+	routerPingControlPlaneSlow   = "control plane slow"
+	routerPingDataPlaneSlow      = "data plane slow"
+	routerPingControlAndDataSlow = "control and data plane slow"
+)
+
+func newRouterPingCmd(p common.OptionsProvider) *cobra.Command {
+	action := &routerPingCmd{Options: api.Options{CommonOptions: p()}}
+	return action.newCobraCmd()
+}
+
+type routerPingCmd struct {
+	api.Options
+	count     int
+	interval  time.Duration
+	threshold time.Duration
+}
+
+// routerPingResult is the outcome of pinging a router over its control channel
+type routerPingResult struct {
+	RouterId            string          `json:"routerId"`
+	RouterName          string          `json:"routerName"`
+	Connected           bool            `json:"connected"`
+	RoundTrips          []time.Duration `json:"roundTrips"`
+	RoundTripMin        time.Duration   `json:"roundTripMin"`
+	RoundTripAvg        time.Duration   `json:"roundTripAvg"`
+	RoundTripMax        time.Duration   `json:"roundTripMax"`
+	HeartbeatLatencyP50 time.Duration   `json:"heartbeatLatencyP50"`
+	HeartbeatLatencyP99 time.Duration   `json:"heartbeatLatencyP99"`
+	Heartbeats          int64           `json:"heartbeats"`
+	Links               int             `json:"links"`
+	LinkLatencyMax      *time.Duration  `json:"linkLatencyMax,omitempty"`
+	Error               string          `json:"error,omitempty"`
+	Status              string          `json:"status"`
+}
+
+func (self *routerPingCmd) newCobraCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ping [router id or name]",
+		Short: "Measure the control channel round trip time between the controller and one or all routers",
+		Long: "Measure the control channel round trip time between the controller and one or all connected routers, by " +
+			"sending requests which the controller relays to each router over its control channel. The time taken by " +
+			"the management API itself is measured first and subtracted. The latency the controller has measured with " +
+			"its periodic heartbeats is shown alongside, as is the highest latency of the router's links, so that a slow " +
+			"control plane can be told apart from a slow data plane. The controller doesn't expose when it last " +
+			"received a heartbeat, so the number of heartbeats it has measured is shown instead; a router with no " +
+			"heartbeats doesn't support them or hasn't been connected long. Exits with code 6 if a router is " +
+			"disconnected or doesn't respond, and 5 if a router's control channel or links are slower than --threshold",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self.Cmd = cmd
+			self.Args = args
+			return self.run()
+		},
+	}
+	cmd.Flags().IntVarP(&self.count, "count", "c", 3, "Number of round trips to measure for each router")
+	cmd.Flags().DurationVar(&self.interval, "interval", 200*time.Millisecond, "Time to wait between round trips")
+	cmd.Flags().DurationVar(&self.threshold, "threshold", 250*time.Millisecond, "Round trip time above which a control channel or link is reported as slow")
+	self.AddTableOutputFlags(cmd)
+	self.AddCommonFlags(cmd)
+	return cmd
+}
+
+func (self *routerPingCmd) run() error {
+	if self.count < 1 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --count %v, must be at least 1", self.count)
+	}
+
+	routers, err := self.selectRouters()
+	if err != nil {
+		return err
+	}
+
+	client, err := util.NewFabricManagementClient(self)
+	if err != nil {
+		return err
+	}
+
+	// the time the management API takes to answer an inspection matching no application is the part of each
+	// round trip which isn't spent on the control channel
+	var baseline time.Duration
+	for i := 0; i < self.count; i++ {
+		elapsed, _, err := self.timeInspect(client, "^$")
+		if err != nil {
+			return err
+		}
+		if i == 0 || elapsed < baseline {
+			baseline = elapsed
+		}
+	}
+
+	var results []*routerPingResult
+	for _, router := range routers {
+		result := &routerPingResult{
+			RouterId:   stringz.OrEmpty(router.ID),
+			RouterName: stringz.OrEmpty(router.Name),
+			Connected:  router.Connected != nil && *router.Connected,
+		}
+		if result.Connected {
+			self.ping(client, result, baseline)
+		}
+		results = append(results, result)
+	}
+
+	self.applyHeartbeats(results)
+	if err := self.applyLinks(results); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		result.summarize(self.threshold)
+	}
+
+	if self.OutputJSONResponse {
+		data, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Println(string(data))
+	} else {
+		self.outputResults(results)
+	}
+
+	return routerPingExitError(results, self.threshold)
+}
+
+func (self *routerPingCmd) selectRouters() ([]*rest_model.RouterDetail, error) {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	if len(self.Args) == 0 {
+		routers, _, err := ListRouters(ctx, &self.Options, "true limit none")
+		return routers, err
+	}
+
+	id, err := api.MapNameToID(util.FabricAPI, "routers", &self.Options, self.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	router, err := DetailRouter(ctx, &self.Options, id)
+	if err != nil {
+		return nil, err
+	}
+	return []*rest_model.RouterDetail{router}, nil
+}
+
+// timeInspect times an inspection of the applications matching the regex, returning the errors it reported
+func (self *routerPingCmd) timeInspect(client *rest_client.ZitiFabric, appRegex string) (time.Duration, []string, error) {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	start := time.Now()
+	resp, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: []string{routerPingValue},
+		},
+		Context: ctx,
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		return 0, nil, util.WrapIfApiError(err)
+	}
+	return elapsed, resp.Payload.Errors, nil
+}
+
+// ping measures the round trips to the router, stopping at the first failure
+func (self *routerPingCmd) ping(client *rest_client.ZitiFabric, result *routerPingResult, baseline time.Duration) {
+	appRegex := "^" + regexp.QuoteMeta(result.RouterId) + "$"
+	for i := 0; i < self.count; i++ {
+		if i > 0 {
+			time.Sleep(self.interval)
+		}
+		elapsed, errs, err := self.timeInspect(client, appRegex)
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+		if len(errs) > 0 {
+			result.Error = strings.TrimPrefix(errs[0], result.RouterId+": ")
+			return
+		}
+		roundTrip := elapsed - baseline
+		if roundTrip < 0 {
+			roundTrip = 0
+		}
+		result.RoundTrips = append(result.RoundTrips, roundTrip)
+	}
+}
+
+// applyHeartbeats fills in the heartbeat latency the controller has measured for each router. Failing to get it
+// only leaves it out, as the round trips are the main result
+func (self *routerPingCmd) applyHeartbeats(results []*routerPingResult) {
+	msg, err := self.controllerMetrics()
+	if err != nil {
+		_, _ = fmt.Fprintf(self.Err, "unable to get heartbeat latency from the controller: %v\n", err)
+		return
+	}
+
+	inspection := &controllerInspection{}
+	applyControllerMetrics(inspection, msg)
+	channels := map[string]*controlChannelInspection{}
+	for _, ch := range inspection.ControlChannels {
+		channels[ch.RouterId] = ch
+	}
+	for _, result := range results {
+		if ch, found := channels[result.RouterId]; found {
+			result.HeartbeatLatencyP50 = ch.LatencyP50
+			result.HeartbeatLatencyP99 = ch.LatencyP99
+			result.Heartbeats = ch.LatencySamples
+		}
+	}
+}
+
+func (self *routerPingCmd) controllerMetrics() (*metrics_pb.MetricsMessage, error) {
+	controllerId, err := discoverControllerId(&self.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := util.NewFabricManagementClient(self)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	appRegex := "^" + regexp.QuoteMeta(controllerId) + "$"
+	resp, err := client.Inspect.Inspect(&inspect.InspectParams{
+		Request: &rest_model.InspectRequest{
+			AppRegex:        &appRegex,
+			RequestedValues: []string{"metrics"},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, util.WrapIfApiError(err)
+	}
+
+	for _, value := range resp.Payload.Values {
+		if !strings.EqualFold(stringz.OrEmpty(value.Name), "metrics") {
+			continue
+		}
+		data, err := inspectValueBytes(value.Value)
+		if err != nil {
+			return nil, err
+		}
+		msg := &metrics_pb.MetricsMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			return nil, errors.Wrap(err, "unable to parse metrics inspection result")
+		}
+		return msg, nil
+	}
+	return nil, errors.Errorf("controller %v returned no metrics", controllerId)
+}
+
+// applyLinks fills in the number of links of each router and the highest latency measured on them
+func (self *routerPingCmd) applyLinks(results []*routerPingResult) error {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+
+	links, err := ListLinks(ctx, &self.Options)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		for _, link := range links {
+			var latency *int64
+			if link.SourceRouter != nil && link.SourceRouter.ID == result.RouterId {
+				latency = link.SourceLatency
+			} else if link.DestRouter != nil && link.DestRouter.ID == result.RouterId {
+				latency = link.DestLatency
+			} else {
+				continue
+			}
+			result.Links++
+			if latency != nil && (result.LinkLatencyMax == nil || time.Duration(*latency) > *result.LinkLatencyMax) {
+				max := time.Duration(*latency)
+				result.LinkLatencyMax = &max
+			}
+		}
+	}
+	return nil
+}
+
+// summarize computes the round trip statistics and the status of the router
+func (self *routerPingResult) summarize(threshold time.Duration) {
+	if len(self.RoundTrips) > 0 {
+		var total time.Duration
+		self.RoundTripMin, self.RoundTripMax = self.RoundTrips[0], self.RoundTrips[0]
+		for _, roundTrip := range self.RoundTrips {
+			total += roundTrip
+			if roundTrip < self.RoundTripMin {
+				self.RoundTripMin = roundTrip
+			}
+			if roundTrip > self.RoundTripMax {
+				self.RoundTripMax = roundTrip
+			}
+		}
+		self.RoundTripAvg = total / time.Duration(len(self.RoundTrips))
+	}
+
+	controlSlow := self.RoundTripAvg > threshold || self.HeartbeatLatencyP50 > threshold
+	dataSlow := self.LinkLatencyMax != nil && *self.LinkLatencyMax > threshold
+
+	switch {
+	case !self.Connected:
+		self.Status = routerPingDisconnected
+	case self.Error != "":
+		self.Status = routerPingUnreachable
+	case controlSlow && dataSlow:
+		self.Status = routerPingControlAndDataSlow
+	case controlSlow:
+		self.Status = routerPingControlPlaneSlow
+	case dataSlow:
+		self.Status = routerPingDataPlaneSlow
+	default:
+		self.Status = routerPingOk
+	}
+}
+
+// routerPingExitError returns an error with the exit code for the worst of the results, or nil if all are ok
+func routerPingExitError(results []*routerPingResult, threshold time.Duration) error {
+	var unreachable, slow []string
+	for _, result := range results {
+		switch result.Status {
+		case routerPingDisconnected, routerPingUnreachable:
+			unreachable = append(unreachable, result.RouterName)
+		case routerPingOk:
+		default:
+			slow = append(slow, result.RouterName)
+		}
+	}
+	if len(unreachable) > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeConnectivity, "%v of %v routers are disconnected or didn't respond: %v",
+			len(unreachable), len(results), strings.Join(unreachable, ", "))
+	}
+	if len(slow) > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v of %v routers have round trip times above %v: %v",
+			len(slow), len(results), threshold, strings.Join(slow, ", "))
+	}
+	return nil
+}
+
+func (self *routerPingCmd) outputResults(results []*routerPingResult) {
+	formatRoundTrip := func(result *routerPingResult, val time.Duration) string {
+		if len(result.RoundTrips) == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fms", float64(val)/float64(time.Millisecond))
+	}
+	formatHeartbeat := func(result *routerPingResult, val time.Duration) string {
+		if result.Heartbeats == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fms", float64(val)/float64(time.Millisecond))
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"ID", "Name", "RTT Min", "RTT Avg", "RTT Max", "Heartbeat P50", "Heartbeat P99",
+		"Heartbeats", "Links", "Link Latency Max", "Status"})
+	for _, result := range results {
+		var linkLatency *int64
+		if result.LinkLatencyMax != nil {
+			val := int64(*result.LinkLatencyMax)
+			linkLatency = &val
+		}
+		status := result.Status
+		if result.Error != "" {
+			status += ": " + result.Error
+		}
+		t.AppendRow(table.Row{result.RouterId, result.RouterName,
+			formatRoundTrip(result, result.RoundTripMin), formatRoundTrip(result, result.RoundTripAvg), formatRoundTrip(result, result.RoundTripMax),
+			formatHeartbeat(result, result.HeartbeatLatencyP50), formatHeartbeat(result, result.HeartbeatLatencyP99),
+			result.Heartbeats, result.Links, formatLinkLatency(linkLatency), status})
+	}
+	api.RenderTable(&self.Options, t, nil)
+}
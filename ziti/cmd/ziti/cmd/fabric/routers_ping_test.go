@@ -0,0 +1,66 @@
+package fabric
+
+import (
+	"testing"
+	"time"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterPingSummarize(t *testing.T) {
+	req := require.New(t)
+	threshold := 100 * time.Millisecond
+	linkLatency := func(d time.Duration) *time.Duration { return &d }
+
+	result := &routerPingResult{Connected: true, RoundTrips: []time.Duration{3 * time.Millisecond, 9 * time.Millisecond, 6 * time.Millisecond}}
+	result.summarize(threshold)
+	req.Equal(3*time.Millisecond, result.RoundTripMin)
+	req.Equal(6*time.Millisecond, result.RoundTripAvg)
+	req.Equal(9*time.Millisecond, result.RoundTripMax)
+	req.Equal(routerPingOk, result.Status)
+
+	result = &routerPingResult{Connected: true, RoundTrips: []time.Duration{300 * time.Millisecond}, LinkLatencyMax: linkLatency(5 * time.Millisecond)}
+	result.summarize(threshold)
+	req.Equal(routerPingControlPlaneSlow, result.Status)
+
+	result = &routerPingResult{Connected: true, RoundTrips: []time.Duration{time.Millisecond}, HeartbeatLatencyP50: 200 * time.Millisecond}
+	result.summarize(threshold)
+	req.Equal(routerPingControlPlaneSlow, result.Status)
+
+	result = &routerPingResult{Connected: true, RoundTrips: []time.Duration{time.Millisecond}, LinkLatencyMax: linkLatency(time.Second)}
+	result.summarize(threshold)
+	req.Equal(routerPingDataPlaneSlow, result.Status)
+
+	result = &routerPingResult{Connected: true, RoundTrips: []time.Duration{time.Second}, LinkLatencyMax: linkLatency(time.Second)}
+	result.summarize(threshold)
+	req.Equal(routerPingControlAndDataSlow, result.Status)
+
+	result = &routerPingResult{Connected: true, Error: "timeout waiting for message reply"}
+	result.summarize(threshold)
+	req.Equal(routerPingUnreachable, result.Status)
+	req.Zero(result.RoundTripAvg)
+
+	result = &routerPingResult{}
+	result.summarize(threshold)
+	req.Equal(routerPingDisconnected, result.Status)
+}
+
+func TestRouterPingExitError(t *testing.T) {
+	req := require.New(t)
+
+	ok := &routerPingResult{RouterName: "a", Status: routerPingOk}
+	slow := &routerPingResult{RouterName: "b", Status: routerPingDataPlaneSlow}
+	down := &routerPingResult{RouterName: "c", Status: routerPingDisconnected}
+
+	req.NoError(routerPingExitError([]*routerPingResult{ok}, time.Second))
+
+	err := routerPingExitError([]*routerPingResult{ok, slow}, time.Second)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+
+	err = routerPingExitError([]*routerPingResult{ok, slow, down}, time.Second)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeConnectivity, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "1 of 3 routers are disconnected or didn't respond: c")
+}
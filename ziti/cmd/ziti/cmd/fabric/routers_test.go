@@ -0,0 +1,110 @@
+package fabric
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openziti/fabric/rest_model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountRouterCircuits(t *testing.T) {
+	req := require.New(t)
+
+	newCircuit := func(nodes ...string) *rest_model.CircuitDetail {
+		path := &rest_model.CircuitDetailPath{}
+		for _, node := range nodes {
+			path.Nodes = append(path.Nodes, &rest_model.EntityRef{ID: node})
+		}
+		return &rest_model.CircuitDetail{Path: path}
+	}
+
+	circuits := []*rest_model.CircuitDetail{
+		newCircuit("r1", "r2"),
+		newCircuit("r2", "r3", "r1"),
+		newCircuit("r3"),
+		{},
+	}
+
+	req.Equal(2, CountRouterCircuits(circuits, "r1"))
+	req.Equal(2, CountRouterCircuits(circuits, "r3"))
+	req.Equal(2, CountRouterCircuits(circuits, "r2"))
+	req.Equal(0, CountRouterCircuits(circuits, "r4"))
+}
+
+func TestCountTerminatorCircuits(t *testing.T) {
+	req := require.New(t)
+
+	circuits := []*rest_model.CircuitDetail{
+		{Terminator: &rest_model.EntityRef{ID: "t1"}},
+		{Terminator: &rest_model.EntityRef{ID: "t2"}},
+		{Terminator: &rest_model.EntityRef{ID: "t1"}},
+		{},
+	}
+
+	req.Equal(2, countTerminatorCircuits(circuits, "t1"))
+	req.Equal(1, countTerminatorCircuits(circuits, "t2"))
+	req.Equal(0, countTerminatorCircuits(circuits, "t3"))
+}
+
+func TestRouterLifecycleFailureRestoresTraversal(t *testing.T) {
+	const stillMarked = "warning: router edge-1 is still marked no-traversal, reset it with 'ziti fabric update router r1 --no-traversal=false'"
+
+	tests := []struct {
+		name        string
+		restart     bool
+		fail        string
+		err         string
+		noTraversal bool
+		output      string
+	}{
+		{name: "restart times out", restart: true, err: "timed out waiting for router edge-1 to disconnect", output: "restored traversal for router edge-1"},
+		{name: "restart drain fails", restart: true, fail: "GET circuits", err: "listCircuitsUnauthorized", output: "restored traversal for router edge-1"},
+		{name: "shutdown times out", err: "timed out waiting for router edge-1 to disconnect", noTraversal: true, output: stillMarked},
+		{name: "shutdown drain fails", fail: "GET circuits", err: "listCircuitsUnauthorized", noTraversal: true, output: stillMarked},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+
+			testController.Reset(t, map[string][]map[string]interface{}{
+				"routers": {{"id": "r1", "name": "edge-1", "connected": true, "noTraversal": false}},
+			})
+			if test.fail != "" {
+				testController.Fail[test.fail] = http.StatusUnauthorized
+			}
+
+			out := &bytes.Buffer{}
+			cmd := &routerLifecycleCmd{
+				Options:        newTestOptions(out, "edge-1"),
+				restart:        test.restart,
+				yes:            true,
+				drainTimeout:   time.Millisecond,
+				restartTimeout: time.Millisecond,
+				pollInterval:   time.Millisecond,
+			}
+			cmd.Timeout = 5
+
+			err := cmd.run()
+			req.Error(err)
+			req.Contains(err.Error(), test.err)
+			req.Contains(out.String(), "marked router edge-1 no-traversal")
+			req.Contains(out.String(), test.output)
+			req.Equal(test.noTraversal, testController.List("routers")[0]["noTraversal"])
+		})
+	}
+
+	// routers which were already no-traversal are left as they were
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"routers": {{"id": "r1", "name": "edge-1", "connected": true, "noTraversal": true}},
+	})
+	out := &bytes.Buffer{}
+	cmd := &routerLifecycleCmd{Options: newTestOptions(out, "edge-1"), restart: true, yes: true, noDrain: true, pollInterval: time.Millisecond}
+	cmd.Timeout = 5
+	require.Error(t, cmd.run())
+	require.NotContains(t, out.String(), "traversal")
+	require.NotContains(t, testController.Requested(), "PATCH routers/r1")
+}
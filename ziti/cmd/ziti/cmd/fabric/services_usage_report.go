@@ -0,0 +1,345 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/fabric/event"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newServicesCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "services",
+		Short: "Operational tools for fabric services",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newServicesUsageReportCmd(p))
+
+	return cmd
+}
+
+type servicesUsageReportCmd struct {
+	api.Options
+	eventFiles []string
+	window     string
+	end        string
+	noNames    bool
+}
+
+func newServicesUsageReportCmd(p common.OptionsProvider) *cobra.Command {
+	action := &servicesUsageReportCmd{
+		Options: api.Options{CommonOptions: p()},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "usage-report",
+		Short: "Reports circuits, bytes, clients and failures per service over a time window",
+		Long: "Reports, per service, the circuits created, bytes sent and received by clients, the number of unique " +
+			"clients and the share of circuits which failed, over a time window. The report is built from the event " +
+			"log written by the controller's JSON file event handler, which needs to subscribe to the fabric.circuits " +
+			"and fabric.usage events. Give rotated log files with additional --events flags. Use --csv for a " +
+			"spreadsheet friendly report",
+		Example: "ziti fabric services usage-report --events /var/log/ziti/events.log --window 30d --csv > usage.csv",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&action.eventFiles, "events", nil, "Event log file written by the controller's JSON file event handler. May be given more than once")
+	cmd.Flags().StringVar(&action.window, "window", "24h", "Length of the reporting window, e.g. 24h, 7d or 30d")
+	cmd.Flags().StringVar(&action.end, "end", "", "End of the reporting window, as an RFC3339 time. Defaults to now")
+	cmd.Flags().BoolVar(&action.noNames, "no-names", false, "Don't look up service names from the controller, only report service ids")
+	_ = cmd.MarkFlagRequired("events")
+	action.AddTableOutputFlags(cmd)
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func (self *servicesUsageReportCmd) run() error {
+	window, err := api.ParseAge(self.window)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --window: %v", err)
+	}
+	end := time.Now()
+	if self.end != "" {
+		if end, err = time.Parse(time.RFC3339, self.end); err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --end, must be an RFC3339 time such as 2022-06-01T00:00:00Z: %v", err)
+		}
+	}
+
+	report := newServiceUsageReport(end.Add(-window), end)
+	for _, eventFile := range self.eventFiles {
+		if err := self.readEvents(report, eventFile); err != nil {
+			return err
+		}
+	}
+
+	usages := report.services()
+	if !self.noNames {
+		names, err := self.serviceNames()
+		if err != nil {
+			_, _ = fmt.Fprintf(self.ErrOutputWriter(), "unable to look up service names, reporting ids only: %v\n", err)
+		}
+		for _, usage := range usages {
+			usage.Name = names[usage.ServiceId]
+		}
+	}
+
+	if self.OutputJSONResponse {
+		return json.NewEncoder(self.Out).Encode(usages)
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Service ID", "Service", "Circuits", "Failed", "Failure Rate", "Unique Clients", "Bytes From Clients", "Bytes To Clients"})
+	for _, usage := range usages {
+		t.AppendRow(table.Row{
+			usage.ServiceId,
+			usage.Name,
+			usage.Circuits,
+			usage.Failed,
+			fmt.Sprintf("%.1f%%", usage.FailureRate*100),
+			usage.UniqueClients,
+			usage.BytesFromClients,
+			usage.BytesToClients,
+		})
+	}
+	api.RenderTable(&self.Options, t, nil)
+
+	if format, _ := self.TableOutputFormat(); format == api.OutputFormatTable {
+		self.Printf("%v services used between %v and %v. Skipped %v events outside the window, %v usage events for "+
+			"circuits not in the log and %v unparseable lines\n", len(usages), report.start.Format(time.RFC3339),
+			report.end.Format(time.RFC3339), report.outsideWindow, report.unattributed, report.skipped)
+	}
+	return nil
+}
+
+func (self *servicesUsageReportCmd) readEvents(report *serviceUsageReport, eventFile string) error {
+	f, err := os.Open(eventFile)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, errors.Wrapf(err, "unable to open event log %v", eventFile))
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := report.read(f); err != nil {
+		return errors.Wrapf(err, "failed reading event log %v", eventFile)
+	}
+	return nil
+}
+
+func (self *servicesUsageReportCmd) serviceNames() (map[string]string, error) {
+	result := map[string]string{}
+	params := url.Values{}
+	params.Add("filter", "true limit none")
+	services, _, err := api.ListEntitiesOfType(util.FabricAPI, "services", params, false, nil, self.Timeout, self.Verbose)
+	if err != nil {
+		return result, err
+	}
+	for _, service := range services {
+		result[api.GetJsonString(service, "id")] = api.GetJsonString(service, "name")
+	}
+	return result, nil
+}
+
+// serviceUsage is the usage of a service over the reporting window
+type serviceUsage struct {
+	ServiceId        string  `json:"serviceId"`
+	Name             string  `json:"name,omitempty"`
+	Circuits         int     `json:"circuits"`
+	Failed           int     `json:"failed"`
+	FailureRate      float64 `json:"failureRate"`
+	UniqueClients    int     `json:"uniqueClients"`
+	BytesFromClients uint64  `json:"bytesFromClients"`
+	BytesToClients   uint64  `json:"bytesToClients"`
+
+	clients map[string]struct{}
+}
+
+// serviceUsageReport aggregates circuit and usage events per service
+type serviceUsageReport struct {
+	start           time.Time
+	end             time.Time
+	usage           map[string]*serviceUsage
+	circuitServices map[string]string
+	outsideWindow   int
+	unattributed    int
+	skipped         int
+}
+
+func newServiceUsageReport(start, end time.Time) *serviceUsageReport {
+	return &serviceUsageReport{
+		start:           start,
+		end:             end,
+		usage:           map[string]*serviceUsage{},
+		circuitServices: map[string]string{},
+	}
+}
+
+func (self *serviceUsageReport) inWindow(t time.Time) bool {
+	if t.Before(self.start) || t.After(self.end) {
+		self.outsideWindow++
+		return false
+	}
+	return true
+}
+
+func (self *serviceUsageReport) serviceUsage(serviceId string) *serviceUsage {
+	usage, found := self.usage[serviceId]
+	if !found {
+		usage = &serviceUsage{ServiceId: serviceId, clients: map[string]struct{}{}}
+		self.usage[serviceId] = usage
+	}
+	return usage
+}
+
+// read aggregates the events in a JSON event log, one event per line. Usage events are attributed to services through
+// the circuits they're for, so circuit events are read in full even when they're outside the window
+func (self *serviceUsageReport) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var usageEvents []*event.UsageEvent
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		header := struct {
+			Namespace string `json:"namespace"`
+		}{}
+		if err := json.Unmarshal(line, &header); err != nil {
+			self.skipped++
+			continue
+		}
+
+		switch header.Namespace {
+		case event.CircuitEventsNs:
+			evt := &event.CircuitEvent{}
+			if err := json.Unmarshal(line, evt); err != nil {
+				self.skipped++
+				continue
+			}
+			self.acceptCircuitEvent(evt)
+		case event.UsageEventsNs:
+			evt := &event.UsageEvent{}
+			if err := json.Unmarshal(line, evt); err != nil {
+				self.skipped++
+				continue
+			}
+			usageEvents = append(usageEvents, evt)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, evt := range usageEvents {
+		self.acceptUsageEvent(evt)
+	}
+	return nil
+}
+
+func (self *serviceUsageReport) acceptCircuitEvent(evt *event.CircuitEvent) {
+	if evt.ServiceId != "" {
+		self.circuitServices[evt.CircuitId] = evt.ServiceId
+	}
+
+	if evt.EventType != event.CircuitCreated && evt.EventType != event.CircuitFailed {
+		return
+	}
+	if evt.ServiceId == "" || !self.inWindow(evt.Timestamp) {
+		return
+	}
+
+	usage := self.serviceUsage(evt.ServiceId)
+	if evt.EventType == event.CircuitCreated {
+		usage.Circuits++
+	} else {
+		usage.Failed++
+	}
+	if evt.ClientId != "" {
+		usage.clients[evt.ClientId] = struct{}{}
+	}
+}
+
+// acceptUsageEvent counts the bytes seen at the ingress router of a circuit, which are those exchanged with the client.
+// Egress and fabric usage is the same traffic seen at other routers, so isn't counted again
+func (self *serviceUsageReport) acceptUsageEvent(evt *event.UsageEvent) {
+	if evt.EventType != "usage.ingress.rx" && evt.EventType != "usage.ingress.tx" {
+		return
+	}
+	if !self.inWindow(time.Unix(evt.IntervalStartUTC, 0)) {
+		return
+	}
+
+	serviceId, found := self.circuitServices[evt.CircuitId]
+	if !found {
+		self.unattributed++
+		return
+	}
+
+	usage := self.serviceUsage(serviceId)
+	if evt.EventType == "usage.ingress.rx" {
+		usage.BytesFromClients += evt.Usage
+	} else {
+		usage.BytesToClients += evt.Usage
+	}
+}
+
+// services returns the usage of each service, busiest first
+func (self *serviceUsageReport) services() []*serviceUsage {
+	var result []*serviceUsage
+	for _, usage := range self.usage {
+		usage.UniqueClients = len(usage.clients)
+		if attempts := usage.Circuits + usage.Failed; attempts > 0 {
+			usage.FailureRate = float64(usage.Failed) / float64(attempts)
+		}
+		result = append(result, usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Circuits != result[j].Circuits {
+			return result[i].Circuits > result[j].Circuits
+		}
+		return result[i].ServiceId < result[j].ServiceId
+	})
+	return result
+}
@@ -0,0 +1,54 @@
+package fabric
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceUsageReport(t *testing.T) {
+	req := require.New(t)
+
+	end := time.Date(2022, 6, 2, 0, 0, 0, 0, time.UTC)
+	report := newServiceUsageReport(end.Add(-24*time.Hour), end)
+
+	events := `
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c0","timestamp":"2022-05-31T10:00:00Z","client_id":"i1","service_id":"s1"}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c1","timestamp":"2022-06-01T10:00:00Z","client_id":"i1","service_id":"s1"}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c2","timestamp":"2022-06-01T11:00:00Z","client_id":"i2","service_id":"s1"}
+{"namespace":"fabric.circuits","event_type":"failed","circuit_id":"c3","timestamp":"2022-06-01T12:00:00Z","client_id":"i3","service_id":"s1"}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c4","timestamp":"2022-06-01T13:00:00Z","client_id":"i1","service_id":"s2"}
+{"namespace":"fabric.circuits","event_type":"deleted","circuit_id":"c1","timestamp":"2022-06-01T14:00:00Z","client_id":"i1","service_id":"s1"}
+{"namespace":"fabric.usage","event_type":"usage.ingress.rx","circuit_id":"c0","usage":100,"interval_start_utc":1654077600}
+{"namespace":"fabric.usage","event_type":"usage.ingress.rx","circuit_id":"c1","usage":10,"interval_start_utc":1654077600}
+{"namespace":"fabric.usage","event_type":"usage.ingress.tx","circuit_id":"c1","usage":20,"interval_start_utc":1654077600}
+{"namespace":"fabric.usage","event_type":"usage.egress.tx","circuit_id":"c1","usage":10,"interval_start_utc":1654077600}
+{"namespace":"fabric.usage","event_type":"usage.ingress.rx","circuit_id":"unknown","usage":5,"interval_start_utc":1654077600}
+{"namespace":"fabric.usage","event_type":"usage.ingress.rx","circuit_id":"c1","usage":1000,"interval_start_utc":1653904800}
+not json
+`
+	req.NoError(report.read(strings.NewReader(events)))
+
+	usages := report.services()
+	req.Len(usages, 2)
+
+	s1 := usages[0]
+	req.Equal("s1", s1.ServiceId)
+	req.Equal(2, s1.Circuits)
+	req.Equal(1, s1.Failed)
+	req.InDelta(1.0/3, s1.FailureRate, 0.001)
+	req.Equal(3, s1.UniqueClients)
+	req.Equal(uint64(110), s1.BytesFromClients)
+	req.Equal(uint64(20), s1.BytesToClients)
+
+	s2 := usages[1]
+	req.Equal("s2", s2.ServiceId)
+	req.Equal(1, s2.Circuits)
+	req.Equal(1, s2.UniqueClients)
+
+	req.Equal(2, report.outsideWindow)
+	req.Equal(1, report.unattributed)
+	req.Equal(1, report.skipped)
+}
@@ -0,0 +1,431 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/channel"
+	"github.com/openziti/fabric/event"
+	"github.com/openziti/fabric/pb/mgmt_pb"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	streamEventsCircuits    = "circuits"
+	streamEventsLinks       = "links"
+	streamEventsRouters     = "routers"
+	streamEventsTerminators = "terminators"
+)
+
+var streamEventKinds = []string{streamEventsCircuits, streamEventsLinks, streamEventsRouters, streamEventsTerminators}
+
+// CircuitEventFields converts a circuit event from the management channel into the fields of the controller's json
+// circuit events, so that streamed and logged events can be processed alike
+func CircuitEventFields(evt *mgmt_pb.StreamCircuitsEvent) map[string]interface{} {
+	eventType := map[mgmt_pb.StreamCircuitEventType]event.CircuitEventType{
+		mgmt_pb.StreamCircuitEventType_CircuitCreated: event.CircuitCreated,
+		mgmt_pb.StreamCircuitEventType_CircuitDeleted: event.CircuitDeleted,
+		mgmt_pb.StreamCircuitEventType_PathUpdated:    event.CircuitUpdated,
+		mgmt_pb.StreamCircuitEventType_CircuitFailed:  event.CircuitFailed,
+	}[evt.EventType]
+
+	fields := map[string]interface{}{
+		"namespace":  event.CircuitEventsNs,
+		"event_type": string(eventType),
+		"timestamp":  time.Now().UTC().Format(time.RFC3339Nano),
+		"circuit_id": evt.CircuitId,
+	}
+	if evt.ClientId != "" {
+		fields["client_id"] = evt.ClientId
+	}
+	if evt.ServiceId != "" {
+		fields["service_id"] = evt.ServiceId
+	}
+	if evt.TerminatorId != "" {
+		fields["terminator_id"] = evt.TerminatorId
+	}
+	if evt.Path != nil {
+		fields["path"] = evt.Path.CalculateDisplayPath()
+	}
+	if evt.CreationTimespan != nil {
+		fields["creation_timespan"] = *evt.CreationTimespan
+	}
+	return fields
+}
+
+type streamEventsAction struct {
+	api.Options
+	eventTypes   []string
+	pollInterval time.Duration
+	table        bool
+
+	lock          sync.Mutex
+	headerPrinted bool
+}
+
+func newStreamEventsCmd(p common.OptionsProvider) *cobra.Command {
+	action := &streamEventsAction{
+		Options: api.Options{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Stream circuit, link, router and terminator events as they happen",
+		Long: "Streams controller events as json lines, in the same form as the controller's json file event logger, " +
+			"or as a live table with --table. Circuit events are streamed by the controller over the management " +
+			"channel. The controller doesn't stream link, router and terminator events to clients, so those are " +
+			"found by listing the entities every --poll-interval and reporting what changed: routers going online and " +
+			"offline, links connecting and failing, and terminators being created, updated and deleted.\n\n" +
+			"--event-type selects the events to show, either by kind (" + strings.Join(streamEventKinds, ", ") + ") " +
+			"or by kind and type, such as links.fault or terminators.updated",
+		Example: `  # show routers going online and offline, and failing links
+  ziti fabric stream events --event-type routers,links.fault --table`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	action.AddCommonFlags(cmd)
+	cmd.Flags().StringSliceVar(&action.eventTypes, "event-type", streamEventKinds, "Events to show, given as <kind> or <kind>.<type>")
+	cmd.Flags().DurationVar(&action.pollInterval, "poll-interval", 5*time.Second, "How often to list links, routers and terminators to find changes")
+	cmd.Flags().BoolVar(&action.table, "table", false, "Print events as a table instead of json lines")
+
+	return cmd
+}
+
+// kinds returns the kinds of events selected by --event-type
+func (self *streamEventsAction) kinds() ([]string, error) {
+	var result []string
+	for _, eventType := range self.eventTypes {
+		kind, _, _ := strings.Cut(eventType, ".")
+		if !stringz.Contains(streamEventKinds, kind) {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --event-type %v, kind must be one of %v", eventType, strings.Join(streamEventKinds, ", "))
+		}
+		if !stringz.Contains(result, kind) {
+			result = append(result, kind)
+		}
+	}
+	return result, nil
+}
+
+// selected returns whether an event with the given namespace and type was asked for
+func (self *streamEventsAction) selected(fields map[string]interface{}) bool {
+	kind := strings.TrimPrefix(fmt.Sprint(fields["namespace"]), "fabric.")
+	eventType := fmt.Sprint(fields["event_type"])
+	for _, selector := range self.eventTypes {
+		if selector == kind || selector == kind+"."+eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *streamEventsAction) run() error {
+	kinds, err := self.kinds()
+	if err != nil {
+		return err
+	}
+	if self.pollInterval <= 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --poll-interval %v, must be greater than 0", self.pollInterval)
+	}
+
+	closeNotify := make(chan struct{})
+	if stringz.Contains(kinds, streamEventsCircuits) {
+		bindHandler := func(binding channel.Binding) error {
+			binding.AddReceiveHandlerF(int32(mgmt_pb.ContentType_StreamCircuitsEventType), self.handleCircuitEvent)
+			binding.AddCloseHandler(channel.CloseHandlerF(func(ch channel.Channel) {
+				close(closeNotify)
+			}))
+			return nil
+		}
+
+		ch, err := api.NewWsMgmtChannel(channel.BindHandlerF(bindHandler))
+		if err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, err)
+		}
+		defer func() { _ = ch.Close() }()
+
+		requestMsg := channel.NewMessage(int32(mgmt_pb.ContentType_StreamCircuitsRequestType), nil)
+		if err = requestMsg.WithTimeout(time.Duration(self.Timeout) * time.Second).SendAndWaitForWire(ch); err != nil {
+			return errors.Wrap(err, "failed to request circuit events")
+		}
+	}
+
+	var pollers []*entityPoller
+	for _, kind := range kinds {
+		if poller := newEntityPoller(kind); poller != nil {
+			pollers = append(pollers, poller)
+		}
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	for {
+		for _, poller := range pollers {
+			entities, err := self.list(poller.entityType)
+			if err != nil {
+				_, _ = fmt.Fprintf(self.ErrOutputWriter(), "unable to list %v: %v\n", poller.entityType, err)
+				continue
+			}
+			for _, fields := range poller.update(entities, time.Now()) {
+				self.output(fields)
+			}
+		}
+
+		select {
+		case <-interrupted:
+			return nil
+		case <-closeNotify:
+			return cmdhelper.Errorf(cmdhelper.ExitCodeConnectivity, "connection to the controller was closed")
+		case <-time.After(self.pollInterval):
+		}
+	}
+}
+
+func (self *streamEventsAction) list(entityType string) (map[string]*gabs.Container, error) {
+	params := url.Values{}
+	params.Add("filter", "true limit none")
+	children, _, err := api.ListEntitiesOfType(util.FabricAPI, entityType, params, false, nil, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]*gabs.Container{}
+	for _, child := range children {
+		result[api.GetJsonString(child, "id")] = child
+	}
+	return result, nil
+}
+
+func (self *streamEventsAction) handleCircuitEvent(msg *channel.Message, _ channel.Channel) {
+	evt := &mgmt_pb.StreamCircuitsEvent{}
+	if err := proto.Unmarshal(msg.Body, evt); err != nil {
+		_, _ = fmt.Fprintf(self.ErrOutputWriter(), "failed to unmarshal circuit event: %v\n", err)
+		return
+	}
+	self.output(CircuitEventFields(evt))
+}
+
+// output prints an event, if it was selected, as a json line or table row
+func (self *streamEventsAction) output(fields map[string]interface{}) {
+	if !self.selected(fields) {
+		return
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if !self.table {
+		data, err := json.Marshal(fields)
+		if err != nil {
+			_, _ = fmt.Fprintf(self.ErrOutputWriter(), "unable to marshal event: %v\n", err)
+			return
+		}
+		_, _ = fmt.Fprintln(self.Out, string(data))
+		return
+	}
+
+	if !self.headerPrinted {
+		_, _ = fmt.Fprintf(self.Out, "%-24v %-18v %-14v %v\n", "TIME", "NAMESPACE", "TYPE", "DETAILS")
+		self.headerPrinted = true
+	}
+	timestamp := fmt.Sprint(fields["timestamp"])
+	if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		timestamp = t.Local().Format("2006-01-02 15:04:05.000")
+	}
+	_, _ = fmt.Fprintf(self.Out, "%-24v %-18v %-14v %v\n", timestamp, fields["namespace"], fields["event_type"], streamEventDetails(fields))
+}
+
+// streamEventDetails lists the fields of an event other than its namespace, type and time, as key=value pairs
+func streamEventDetails(fields map[string]interface{}) string {
+	var keys []string
+	for key := range fields {
+		if key != "namespace" && key != "event_type" && key != "timestamp" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result []string
+	for _, key := range keys {
+		result = append(result, fmt.Sprintf("%v=%v", key, fields[key]))
+	}
+	return strings.Join(result, " ")
+}
+
+// entityPoller turns successive listings of an entity type into events, by comparing each listing with the one before.
+// The first listing only records the current state
+type entityPoller struct {
+	entityType string
+	namespace  string
+	previous   map[string]*gabs.Container
+	changes    func(previous, current *gabs.Container) []string
+	fields     func(entity *gabs.Container) map[string]interface{}
+}
+
+func newEntityPoller(kind string) *entityPoller {
+	switch kind {
+	case streamEventsRouters:
+		return &entityPoller{entityType: "routers", namespace: event.RouterEventsNs, changes: routerChanges, fields: routerEventFields}
+	case streamEventsLinks:
+		return &entityPoller{entityType: "links", namespace: event.LinkEventsNs, changes: linkChanges, fields: linkEventFields}
+	case streamEventsTerminators:
+		return &entityPoller{entityType: "terminators", namespace: event.TerminatorEventsNs, changes: terminatorChanges, fields: terminatorEventFields}
+	}
+	return nil
+}
+
+// update compares the entities with those of the previous listing and returns an event for each change
+func (self *entityPoller) update(entities map[string]*gabs.Container, now time.Time) []map[string]interface{} {
+	previous := self.previous
+	self.previous = entities
+	if previous == nil {
+		return nil
+	}
+
+	var ids []string
+	for id := range entities {
+		ids = append(ids, id)
+	}
+	for id := range previous {
+		if _, found := entities[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var result []map[string]interface{}
+	for _, id := range ids {
+		entity, before := entities[id], previous[id]
+		source := entity
+		if source == nil {
+			source = before
+		}
+		for _, eventType := range self.changes(before, entity) {
+			fields := self.fields(source)
+			fields["namespace"] = self.namespace
+			fields["event_type"] = eventType
+			fields["timestamp"] = now.UTC().Format(time.RFC3339Nano)
+			result = append(result, fields)
+		}
+	}
+	return result
+}
+
+// routerChanges reports routers connecting and disconnecting. Routers which are created or deleted are reported if
+// they were connected
+func routerChanges(previous, current *gabs.Container) []string {
+	wasOnline := previous != nil && api.Wrap(previous).Bool("connected")
+	isOnline := current != nil && api.Wrap(current).Bool("connected")
+	switch {
+	case isOnline && !wasOnline:
+		return []string{string(event.RouterOnline)}
+	case wasOnline && !isOnline:
+		return []string{string(event.RouterOffline)}
+	}
+	return nil
+}
+
+func routerEventFields(router *gabs.Container) map[string]interface{} {
+	wrapper := api.Wrap(router)
+	return map[string]interface{}{
+		"router_id":     wrapper.String("id"),
+		"router_name":   wrapper.String("name"),
+		"router_online": wrapper.Bool("connected"),
+	}
+}
+
+// linkChanges reports links which connect, and those which fail or go away
+func linkChanges(previous, current *gabs.Container) []string {
+	linkUp := func(link *gabs.Container) bool {
+		return link != nil && api.GetJsonString(link, "state") == "Connected" && !api.Wrap(link).Bool("down")
+	}
+	switch {
+	case linkUp(current) && !linkUp(previous):
+		return []string{string(event.LinkConnected)}
+	case linkUp(previous) && !linkUp(current):
+		return []string{string(event.LinkFault)}
+	case previous == nil && current != nil:
+		return []string{string(event.LinkDialed)}
+	}
+	return nil
+}
+
+func linkEventFields(link *gabs.Container) map[string]interface{} {
+	wrapper := api.Wrap(link)
+	return map[string]interface{}{
+		"link_id":       wrapper.String("id"),
+		"src_router_id": wrapper.String("sourceRouter.id"),
+		"dst_router_id": wrapper.String("destRouter.id"),
+		"protocol":      wrapper.String("protocol"),
+		"state":         wrapper.String("state"),
+		"cost":          link.Path("cost").Data(),
+	}
+}
+
+// terminatorChanges reports terminators which are created, deleted or which change cost, precedence or router
+func terminatorChanges(previous, current *gabs.Container) []string {
+	switch {
+	case previous == nil:
+		return []string{string(event.TerminatorCreated)}
+	case current == nil:
+		return []string{string(event.TerminatorDeleted)}
+	}
+	for _, field := range []string{"cost", "dynamicCost", "precedence", "routerId"} {
+		if fmt.Sprint(previous.Path(field).Data()) != fmt.Sprint(current.Path(field).Data()) {
+			return []string{string(event.TerminatorUpdated)}
+		}
+	}
+	return nil
+}
+
+func terminatorEventFields(terminator *gabs.Container) map[string]interface{} {
+	wrapper := api.Wrap(terminator)
+	return map[string]interface{}{
+		"terminator_id": wrapper.String("id"),
+		"service_id":    wrapper.String("serviceId"),
+		"router_id":     wrapper.String("routerId"),
+		"precedence":    wrapper.String("precedence"),
+		"static_cost":   terminator.Path("cost").Data(),
+		"dynamic_cost":  terminator.Path("dynamicCost").Data(),
+	}
+}
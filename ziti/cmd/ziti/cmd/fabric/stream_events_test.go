@@ -0,0 +1,91 @@
+package fabric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/stretchr/testify/require"
+)
+
+func parseStreamEntities(t *testing.T, entities ...string) map[string]*gabs.Container {
+	result := map[string]*gabs.Container{}
+	for _, entity := range entities {
+		container, err := gabs.ParseJSON([]byte(entity))
+		require.NoError(t, err)
+		result[container.Path("id").Data().(string)] = container
+	}
+	return result
+}
+
+func TestEntityPollerRouters(t *testing.T) {
+	req := require.New(t)
+	poller := newEntityPoller(streamEventsRouters)
+	now := time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC)
+
+	req.Empty(poller.update(parseStreamEntities(t,
+		`{"id":"r1","name":"one","connected":true}`,
+		`{"id":"r2","name":"two","connected":false}`,
+	), now))
+
+	events := poller.update(parseStreamEntities(t,
+		`{"id":"r2","name":"two","connected":true}`,
+		`{"id":"r3","name":"three","connected":false}`,
+	), now)
+	req.Equal([]map[string]interface{}{
+		{"namespace": "fabric.routers", "event_type": "router-offline", "timestamp": "2022-06-01T03:00:00Z", "router_id": "r1", "router_name": "one", "router_online": true},
+		{"namespace": "fabric.routers", "event_type": "router-online", "timestamp": "2022-06-01T03:00:00Z", "router_id": "r2", "router_name": "two", "router_online": true},
+	}, events)
+}
+
+func TestEntityPollerLinksAndTerminators(t *testing.T) {
+	req := require.New(t)
+	now := time.Now()
+
+	links := newEntityPoller(streamEventsLinks)
+	links.update(parseStreamEntities(t,
+		`{"id":"l1","state":"Connected","down":false,"sourceRouter":{"id":"r1"},"destRouter":{"id":"r2"},"protocol":"tls","cost":3}`,
+	), now)
+	events := links.update(parseStreamEntities(t,
+		`{"id":"l1","state":"Failed","down":true,"sourceRouter":{"id":"r1"},"destRouter":{"id":"r2"},"protocol":"tls","cost":3}`,
+		`{"id":"l2","state":"Pending","down":false,"sourceRouter":{"id":"r2"},"destRouter":{"id":"r1"},"protocol":"tls","cost":1}`,
+	), now)
+	req.Len(events, 2)
+	req.Equal("fault", events[0]["event_type"])
+	req.Equal("Failed", events[0]["state"])
+	req.Equal("dialed", events[1]["event_type"])
+	req.Equal("r2", events[1]["src_router_id"])
+
+	terminators := newEntityPoller(streamEventsTerminators)
+	terminators.update(parseStreamEntities(t,
+		`{"id":"t1","serviceId":"s1","routerId":"r1","precedence":"default","cost":0,"dynamicCost":0}`,
+		`{"id":"t2","serviceId":"s1","routerId":"r1","precedence":"default","cost":0,"dynamicCost":0}`,
+	), now)
+	events = terminators.update(parseStreamEntities(t,
+		`{"id":"t1","serviceId":"s1","routerId":"r1","precedence":"failed","cost":0,"dynamicCost":0}`,
+		`{"id":"t3","serviceId":"s1","routerId":"r2","precedence":"default","cost":0,"dynamicCost":0}`,
+	), now)
+	var types []interface{}
+	for _, evt := range events {
+		types = append(types, evt["terminator_id"].(string)+" "+evt["event_type"].(string))
+	}
+	req.Equal([]interface{}{"t1 updated", "t2 deleted", "t3 created"}, types)
+	req.Equal("dynamic_cost=0 precedence=failed router_id=r1 service_id=s1 static_cost=0 terminator_id=t1", streamEventDetails(events[0]))
+}
+
+func TestStreamEventsSelection(t *testing.T) {
+	req := require.New(t)
+	action := &streamEventsAction{eventTypes: []string{"routers", "links.fault"}}
+
+	kinds, err := action.kinds()
+	req.NoError(err)
+	req.Equal([]string{"routers", "links"}, kinds)
+
+	req.True(action.selected(map[string]interface{}{"namespace": "fabric.routers", "event_type": "router-online"}))
+	req.True(action.selected(map[string]interface{}{"namespace": "fabric.links", "event_type": "fault"}))
+	req.False(action.selected(map[string]interface{}{"namespace": "fabric.links", "event_type": "connected"}))
+
+	action.eventTypes = []string{"usage"}
+	_, err = action.kinds()
+	req.Error(err)
+}
@@ -22,15 +22,24 @@ import (
 	"github.com/openziti/fabric/pb/mgmt_pb"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"sort"
+	"syscall"
 	"time"
 )
 
 type streamMetricsAction struct {
 	api.Options
+	prometheusAddr string
+	prometheus     *prometheusMetrics
 }
 
 func NewStreamMetricsCmd(p common.OptionsProvider) *cobra.Command {
@@ -43,16 +52,38 @@ func NewStreamMetricsCmd(p common.OptionsProvider) *cobra.Command {
 	streamMetricsCmd := &cobra.Command{
 		Use:   "metrics <metrics regex> <source regex>",
 		Short: "Stream fabric metrics",
-		Args:  cobra.MaximumNArgs(2),
-		Run:   action.streamMetrics,
+		Long: "Streams fabric metrics, printing each metrics message as it arrives. With --prometheus, the latest values " +
+			"are instead served in the Prometheus text format at /metrics on the given address, so fabric metrics may be " +
+			"scraped without a separate exporter. Metric names are prefixed with ziti_ and the source id and tags become " +
+			"labels. Interval metrics, such as usage, are served as counters of the total since streaming started",
+		Example: `  # serve the metrics of all routers for Prometheus to scrape
+  ziti fabric stream metrics --prometheus :2112`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.streamMetrics(args)
+		},
+		SilenceUsage: true,
 	}
 
 	action.AddCommonFlags(streamMetricsCmd)
+	streamMetricsCmd.Flags().StringVar(&action.prometheusAddr, "prometheus", "", "Serve metrics in the Prometheus format on this address, e.g. :2112, instead of printing them")
 
 	return streamMetricsCmd
 }
 
-func (self *streamMetricsAction) streamMetrics(_ *cobra.Command, args []string) {
+func (self *streamMetricsAction) streamMetrics(args []string) error {
+	var listener net.Listener
+	if self.prometheusAddr != "" {
+		var err error
+		if listener, err = net.Listen("tcp", self.prometheusAddr); err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "unable to listen on %v: %v", self.prometheusAddr, err)
+		}
+		defer func() { _ = listener.Close() }()
+		self.prometheus = newPrometheusMetrics()
+	}
+
 	closeNotify := make(chan struct{})
 
 	bindHandler := func(binding channel.Binding) error {
@@ -65,8 +96,9 @@ func (self *streamMetricsAction) streamMetrics(_ *cobra.Command, args []string)
 
 	ch, err := api.NewWsMgmtChannel(channel.BindHandlerF(bindHandler))
 	if err != nil {
-		panic(err)
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, err)
 	}
+	defer func() { _ = ch.Close() }()
 
 	var matchers []*mgmt_pb.StreamMetricsRequest_MetricMatcher
 
@@ -81,22 +113,58 @@ func (self *streamMetricsAction) streamMetrics(_ *cobra.Command, args []string)
 	request := &mgmt_pb.StreamMetricsRequest{Matchers: matchers}
 	body, err := proto.Marshal(request)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	requestMsg := channel.NewMessage(int32(mgmt_pb.ContentType_StreamMetricsRequestType), body)
 	if err = requestMsg.WithTimeout(time.Duration(self.Timeout) * time.Second).SendAndWaitForWire(ch); err != nil {
-		panic(err)
+		return errors.Wrap(err, "failed to request metrics")
 	}
 
-	<-closeNotify
+	if listener == nil {
+		<-closeNotify
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = self.prometheus.write(w, time.Now())
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	defer func() { _ = server.Close() }()
+
+	self.Printf("serving metrics at http://%v/metrics\n", listener.Addr())
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	select {
+	case <-interrupted:
+		return nil
+	case <-closeNotify:
+		return cmdhelper.Errorf(cmdhelper.ExitCodeConnectivity, "connection to the controller was closed")
+	case err = <-serveErr:
+		return errors.Wrap(err, "metrics endpoint failed")
+	}
 }
 
 func (self *streamMetricsAction) HandleReceive(msg *channel.Message, _ channel.Channel) {
 	response := &mgmt_pb.StreamMetricsEvent{}
 	err := proto.Unmarshal(msg.Body, response)
 	if err != nil {
-		panic(err)
+		_, _ = fmt.Fprintf(self.ErrOutputWriter(), "failed to unmarshal metrics event: %v\n", err)
+		return
+	}
+
+	if self.prometheus != nil {
+		self.prometheus.update(response, time.Now())
+		return
 	}
 
 	fmt.Printf("%v - source(%v)\n", self.format(response.Timestamp), response.SourceId)
@@ -0,0 +1,179 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openziti/fabric/pb/mgmt_pb"
+)
+
+// prometheusSeriesExpiry is how long a series is kept without updates. Routers report metrics every minute by default,
+// so this drops the series of routers which have gone away or links which have closed, without losing any of a source
+// which is reporting
+const prometheusSeriesExpiry = 5 * time.Minute
+
+// prometheusMetrics holds the latest value of each metric streamed from the controller and writes them in the
+// Prometheus text exposition format. Int and float metrics become gauges. Interval metrics, such as usage, hold counts
+// per circuit for an interval, and become counters of the total count since streaming started
+type prometheusMetrics struct {
+	lock   sync.Mutex
+	series map[string]*prometheusSeries
+}
+
+type prometheusSeries struct {
+	name    string
+	kind    string
+	labels  string
+	value   float64
+	updated time.Time
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	return &prometheusMetrics{
+		series: map[string]*prometheusSeries{},
+	}
+}
+
+func (self *prometheusMetrics) update(evt *mgmt_pb.StreamMetricsEvent, now time.Time) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	labels := map[string]string{}
+	for key, value := range evt.Tags {
+		labels[prometheusLabelName(key)] = value
+	}
+	labels["source_id"] = evt.SourceId
+
+	for name, value := range evt.IntMetrics {
+		self.set(name, "gauge", labels, float64(value), now)
+	}
+	for name, value := range evt.FloatMetrics {
+		self.set(name, "gauge", labels, value, now)
+	}
+	for _, interval := range evt.IntervalMetrics {
+		var total uint64
+		for _, value := range interval.Values {
+			total += value
+		}
+		self.set(interval.Name+".total", "counter", labels, float64(total), now)
+	}
+}
+
+func (self *prometheusMetrics) set(metric, kind string, labels map[string]string, value float64, now time.Time) {
+	name, metricLabels := prometheusMetricName(metric, labels)
+	renderedLabels := renderPrometheusLabels(metricLabels)
+	key := name + renderedLabels
+
+	series, found := self.series[key]
+	if !found {
+		series = &prometheusSeries{name: name, kind: kind, labels: renderedLabels}
+		self.series[key] = series
+	}
+	if kind == "counter" {
+		series.value += value
+	} else {
+		series.value = value
+	}
+	series.updated = now
+}
+
+// write writes all series updated within the expiry, grouped by metric
+func (self *prometheusMetrics) write(w io.Writer, now time.Time) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	var keys []string
+	for key, series := range self.series {
+		if now.Sub(series.updated) > prometheusSeriesExpiry {
+			delete(self.series, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lastName := ""
+	for _, key := range keys {
+		series := self.series[key]
+		if series.name != lastName {
+			if _, err := fmt.Fprintf(w, "# TYPE %v %v\n", series.name, series.kind); err != nil {
+				return err
+			}
+			lastName = series.name
+		}
+		if _, err := fmt.Fprintf(w, "%v%v %v\n", series.name, series.labels, strconv.FormatFloat(series.value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prometheusMetricName returns the Prometheus name of a metric and its labels. Link metrics hold the link id in their
+// name, such as link.<link id>.latency, which is moved to a link_id label so that all links share a metric
+func prometheusMetricName(metric string, labels map[string]string) (string, map[string]string) {
+	if parts := strings.SplitN(metric, ".", 3); len(parts) == 3 && parts[0] == "link" {
+		linkLabels := map[string]string{"link_id": parts[1]}
+		for key, value := range labels {
+			linkLabels[key] = value
+		}
+		return "ziti_" + prometheusSanitize("link."+parts[2]), linkLabels
+	}
+	return "ziti_" + prometheusSanitize(metric), labels
+}
+
+func prometheusLabelName(name string) string {
+	result := prometheusSanitize(name)
+	if result == "" || (result[0] >= '0' && result[0] <= '9') {
+		result = "_" + result
+	}
+	return result
+}
+
+// prometheusSanitize replaces the characters which aren't valid in Prometheus metric and label names with underscores
+func prometheusSanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func renderPrometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var result []string
+	for _, key := range keys {
+		result = append(result, fmt.Sprintf(`%v="%v"`, key, escaper.Replace(labels[key])))
+	}
+	return "{" + strings.Join(result, ",") + "}"
+}
@@ -0,0 +1,47 @@
+package fabric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/openziti/fabric/pb/mgmt_pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	req := require.New(t)
+	metrics := newPrometheusMetrics()
+	now := time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC)
+
+	usage := func(value uint64) *mgmt_pb.StreamMetricsEvent_IntervalMetric {
+		return &mgmt_pb.StreamMetricsEvent_IntervalMetric{Name: "usage.ingress.tx", Values: map[string]uint64{"c1": value, "c2": 1}}
+	}
+
+	metrics.update(&mgmt_pb.StreamMetricsEvent{
+		SourceId:        "r1",
+		Tags:            map[string]string{"env": `a"b`},
+		IntMetrics:      map[string]int64{"link.l1.latency": 120},
+		FloatMetrics:    map[string]float64{"egress.tx.bytesrate": 1.5},
+		IntervalMetrics: []*mgmt_pb.StreamMetricsEvent_IntervalMetric{usage(10)},
+	}, now)
+	metrics.update(&mgmt_pb.StreamMetricsEvent{
+		SourceId:        "r1",
+		Tags:            map[string]string{"env": `a"b`},
+		IntervalMetrics: []*mgmt_pb.StreamMetricsEvent_IntervalMetric{usage(5)},
+	}, now)
+	metrics.update(&mgmt_pb.StreamMetricsEvent{
+		SourceId:   "r2",
+		IntMetrics: map[string]int64{"link.l2.latency": 80},
+	}, now.Add(-time.Hour))
+
+	out := &bytes.Buffer{}
+	req.NoError(metrics.write(out, now))
+	req.Equal(`# TYPE ziti_egress_tx_bytesrate gauge
+ziti_egress_tx_bytesrate{env="a\"b",source_id="r1"} 1.5
+# TYPE ziti_link_latency gauge
+ziti_link_latency{env="a\"b",link_id="l1",source_id="r1"} 120
+# TYPE ziti_usage_ingress_tx_total counter
+ziti_usage_ingress_tx_total{env="a\"b",source_id="r1"} 17
+`, out.String())
+}
@@ -0,0 +1,207 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/openziti/edge/router/xgress_edge_transport"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/foundation/v2/stringz"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+const maxInstanceIdLength = 255
+
+var terminatorPrecedences = []string{"default", "required", "failed"}
+
+// terminatorSpec describes a terminator to create along with a service
+type terminatorSpec struct {
+	router     string
+	address    string
+	binding    string
+	instanceId string
+	precedence string
+	cost       int
+}
+
+// parseTerminatorSpec parses a terminator given as comma separated key=value pairs, with router and address required
+// and binding, instance, precedence and cost optional, e.g. router=r1,address=tcp:localhost:8080,instance=a
+func parseTerminatorSpec(val string) (*terminatorSpec, error) {
+	spec := &terminatorSpec{binding: xgress_edge_transport.BindingName}
+
+	for _, field := range strings.Split(val, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid terminator '%v', expected comma separated key=value pairs", val)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "router":
+			spec.router = value
+		case "address":
+			spec.address = value
+		case "binding":
+			spec.binding = value
+		case "instance":
+			spec.instanceId = value
+		case "precedence":
+			spec.precedence = value
+		case "cost":
+			cost, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid cost '%v' in terminator '%v'", value, val)
+			}
+			spec.cost = cost
+		default:
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "unknown key '%v' in terminator '%v', must be one of router, address, binding, instance, precedence, cost", key, val)
+		}
+	}
+
+	if spec.router == "" || spec.address == "" {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "terminator '%v' must include router and address", val)
+	}
+
+	if err := validateTerminatorSettings(spec.instanceId, spec.precedence, spec.cost); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// validateTerminatorSettings checks the instance id, precedence and cost of a terminator
+func validateTerminatorSettings(instanceId, precedence string, cost int) error {
+	if err := validateInstanceId(instanceId); err != nil {
+		return err
+	}
+
+	if precedence != "" && !stringz.Contains(terminatorPrecedences, precedence) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid precedence %v. Must be one of %+v", precedence, terminatorPrecedences)
+	}
+
+	if cost < 0 || cost > math.MaxUint16 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid cost %v. Must be positive number less than or equal to %v", cost, math.MaxUint16)
+	}
+
+	return nil
+}
+
+// validateInstanceId checks that an instance id can be used to address a terminator. Dialers have to match the id
+// exactly, so surrounding whitespace and control characters, which are easily introduced by scripts, are rejected
+func validateInstanceId(instanceId string) error {
+	if instanceId == "" {
+		return nil
+	}
+
+	if len(instanceId) > maxInstanceIdLength {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid instance id '%v', must be at most %v characters", instanceId, maxInstanceIdLength)
+	}
+
+	if strings.TrimSpace(instanceId) != instanceId {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid instance id '%v', must not start or end with whitespace", instanceId)
+	}
+
+	for _, r := range instanceId {
+		if unicode.IsControl(r) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "invalid instance id %q, must not contain control characters", instanceId)
+		}
+	}
+
+	return nil
+}
+
+// validateTerminatorSpecs checks a set of terminators for a service as a whole: the same router, binding, address and
+// instance id may only be used once, and each instance id needs a terminator which isn't failed so it can be dialed
+func validateTerminatorSpecs(specs []*terminatorSpec) error {
+	seen := map[string]bool{}
+	usable := map[string]bool{}
+
+	for _, spec := range specs {
+		key := strings.Join([]string{spec.router, spec.binding, spec.address, spec.instanceId}, "|")
+		if seen[key] {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "terminator for router %v and address %v with instance id '%v' given more than once", spec.router, spec.address, spec.instanceId)
+		}
+		seen[key] = true
+
+		if _, found := usable[spec.instanceId]; !found {
+			usable[spec.instanceId] = false
+		}
+		if spec.precedence != "failed" {
+			usable[spec.instanceId] = true
+		}
+	}
+
+	for instanceId, ok := range usable {
+		if !ok {
+			if instanceId == "" {
+				return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "all terminators without an instance id have precedence failed")
+			}
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "all terminators for instance id '%v' have precedence failed", instanceId)
+		}
+	}
+
+	return nil
+}
+
+// terminatorAddressing summarizes how the given terminators of a service may be addressed: by any dialer, by instance
+// id, or both. Instance groups are listed with the number of terminators at each precedence
+func terminatorAddressing(terminators []*rest_model.TerminatorDetail) string {
+	if len(terminators) == 0 {
+		return "none"
+	}
+
+	groups := map[string]map[string]int{}
+	for _, terminator := range terminators {
+		instanceId := stringz.OrEmpty(terminator.InstanceID)
+		precedence := "default"
+		if terminator.Precedence != nil && *terminator.Precedence != "" {
+			precedence = string(*terminator.Precedence)
+		}
+		if groups[instanceId] == nil {
+			groups[instanceId] = map[string]int{}
+		}
+		groups[instanceId][precedence]++
+	}
+
+	var instanceIds []string
+	for instanceId := range groups {
+		instanceIds = append(instanceIds, instanceId)
+	}
+	sort.Strings(instanceIds)
+
+	var result []string
+	for _, instanceId := range instanceIds {
+		var counts []string
+		for _, precedence := range []string{"required", "default", "failed"} {
+			if count := groups[instanceId][precedence]; count > 0 {
+				counts = append(counts, fmt.Sprintf("%v %v", count, precedence))
+			}
+		}
+		name := "any"
+		if instanceId != "" {
+			name = "instance:" + instanceId
+		}
+		result = append(result, fmt.Sprintf("%v (%v)", name, strings.Join(counts, ", ")))
+	}
+
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,78 @@
+package fabric
+
+import (
+	"testing"
+
+	"github.com/openziti/fabric/rest_model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTerminatorSpec(t *testing.T) {
+	req := require.New(t)
+
+	spec, err := parseTerminatorSpec("router=r1, address=tcp:localhost:8080,instance=a,precedence=required,cost=10")
+	req.NoError(err)
+	req.Equal("r1", spec.router)
+	req.Equal("tcp:localhost:8080", spec.address)
+	req.Equal("a", spec.instanceId)
+	req.Equal("required", spec.precedence)
+	req.Equal(10, spec.cost)
+	req.Equal("edge_transport", spec.binding)
+
+	for _, val := range []string{
+		"router=r1",
+		"address=tcp:localhost:8080",
+		"router=r1,address=a,unknown=x",
+		"router=r1,address=a,cost=x",
+		"router=r1,address=a,cost=70000",
+		"router=r1,address=a,precedence=first",
+		"router=r1,address=a,instance=a\tb",
+		"router=r1,address",
+	} {
+		_, err = parseTerminatorSpec(val)
+		req.Error(err, val)
+	}
+}
+
+func TestValidateTerminatorSpecs(t *testing.T) {
+	req := require.New(t)
+
+	parse := func(vals ...string) []*terminatorSpec {
+		var result []*terminatorSpec
+		for _, val := range vals {
+			spec, err := parseTerminatorSpec(val)
+			req.NoError(err)
+			result = append(result, spec)
+		}
+		return result
+	}
+
+	req.NoError(validateTerminatorSpecs(parse(
+		"router=r1,address=a,instance=i1,precedence=required",
+		"router=r2,address=a,instance=i1,precedence=failed",
+		"router=r1,address=a,instance=i2",
+		"router=r1,address=a",
+	)))
+
+	req.Error(validateTerminatorSpecs(parse("router=r1,address=a,instance=i1", "router=r1,address=a,instance=i1")))
+	req.Error(validateTerminatorSpecs(parse("router=r1,address=a,instance=i1,precedence=failed", "router=r1,address=a")))
+}
+
+func TestTerminatorAddressing(t *testing.T) {
+	req := require.New(t)
+
+	newTerminator := func(instanceId string, precedence rest_model.TerminatorPrecedence) *rest_model.TerminatorDetail {
+		return &rest_model.TerminatorDetail{InstanceID: &instanceId, Precedence: &precedence}
+	}
+
+	req.Equal("none", terminatorAddressing(nil))
+	req.Equal("any (2 default)", terminatorAddressing([]*rest_model.TerminatorDetail{
+		newTerminator("", rest_model.TerminatorPrecedenceDefault),
+		newTerminator("", ""),
+	}))
+	req.Equal("any (1 default)\ninstance:a (1 required, 1 failed)", terminatorAddressing([]*rest_model.TerminatorDetail{
+		newTerminator("a", rest_model.TerminatorPrecedenceFailed),
+		newTerminator("", rest_model.TerminatorPrecedenceDefault),
+		newTerminator("a", rest_model.TerminatorPrecedenceRequired),
+	}))
+}
@@ -0,0 +1,340 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package fabric
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/fabric/event"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newTerminatorsCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "terminators",
+		Short: "Operational tools for fabric terminators",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newTerminatorsHistoryCmd(p))
+
+	return cmd
+}
+
+type terminatorsHistoryCmd struct {
+	api.Options
+	eventFiles []string
+	since      string
+	bucket     time.Duration
+}
+
+func newTerminatorsHistoryCmd(p common.OptionsProvider) *cobra.Command {
+	action := &terminatorsHistoryCmd{
+		Options: api.Options{CommonOptions: p()},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "history <terminator id>",
+		Short: "Shows the lifecycle of a terminator and the circuits routed to it over time",
+		Long: "Shows the history of a terminator from the event log written by the controller's JSON file event " +
+			"handler: when it was created and deleted, changes to its cost and precedence, health check transitions, " +
+			"which show as the precedence changing to or from failed, its router going offline and online, and the " +
+			"circuits routed to it. The handler needs to subscribe to the fabric.terminators and fabric.circuits " +
+			"events. Circuits are counted per --bucket, or listed one by one with --bucket 0",
+		Example: "ziti fabric terminators history 2Lqtv6vMw --events /var/log/ziti/events.log --since 24h --bucket 15m",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&action.eventFiles, "events", nil, "Event log file written by the controller's JSON file event handler. May be given more than once")
+	cmd.Flags().StringVar(&action.since, "since", "", "Only show history within this time, e.g. 6h, 7d or 30d")
+	cmd.Flags().DurationVar(&action.bucket, "bucket", time.Hour, "Count circuits routed to the terminator per this interval. 0 lists each circuit")
+	_ = cmd.MarkFlagRequired("events")
+	action.AddTableOutputFlags(cmd)
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+func (self *terminatorsHistoryCmd) run() error {
+	if self.bucket < 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --bucket %v, must not be negative", self.bucket)
+	}
+	history := newTerminatorHistory(self.Args[0], self.bucket)
+	if self.since != "" {
+		age, err := api.ParseAge(self.since)
+		if err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --since: %v", err)
+		}
+		history.since = time.Now().Add(-age)
+	}
+
+	for _, eventFile := range self.eventFiles {
+		if err := self.readEvents(history, eventFile); err != nil {
+			return err
+		}
+	}
+
+	entries := history.entries()
+	if len(entries) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no events found for terminator %v", self.Args[0])
+	}
+
+	if self.OutputJSONResponse {
+		return json.NewEncoder(self.Out).Encode(entries)
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Time", "Event", "Details"})
+	for _, entry := range entries {
+		t.AppendRow(table.Row{entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Event, entry.Details})
+	}
+	api.RenderTable(&self.Options, t, nil)
+
+	if format, _ := self.TableOutputFormat(); format == api.OutputFormatTable && history.skipped > 0 {
+		self.Printf("skipped %v unparseable lines\n", history.skipped)
+	}
+	return nil
+}
+
+func (self *terminatorsHistoryCmd) readEvents(history *terminatorHistory, eventFile string) error {
+	f, err := os.Open(eventFile)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, errors.Wrapf(err, "unable to open event log %v", eventFile))
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := history.read(f); err != nil {
+		return errors.Wrapf(err, "failed reading event log %v", eventFile)
+	}
+	return nil
+}
+
+// terminatorHistoryEntry is a single line of a terminator's history
+type terminatorHistoryEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Event     string    `json:"event"`
+	Details   string    `json:"details"`
+}
+
+// circuitBucket counts the circuits routed to a terminator over an interval
+type circuitBucket struct {
+	created int
+	failed  int
+	clients map[string]struct{}
+}
+
+// terminatorHistory collects the terminator and circuit events of a terminator. As event logs may be given in any
+// order, events are only turned into history entries once all have been read
+type terminatorHistory struct {
+	terminatorId     string
+	since            time.Time
+	bucket           time.Duration
+	terminatorEvents []*event.TerminatorEvent
+	circuitEvents    []*event.CircuitEvent
+	skipped          int
+}
+
+func newTerminatorHistory(terminatorId string, bucket time.Duration) *terminatorHistory {
+	return &terminatorHistory{
+		terminatorId: terminatorId,
+		bucket:       bucket,
+	}
+}
+
+// read collects the events of the terminator in a JSON event log, one event per line
+func (self *terminatorHistory) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		header := struct {
+			Namespace    string `json:"namespace"`
+			TerminatorId string `json:"terminator_id"`
+		}{}
+		if err := json.Unmarshal(line, &header); err != nil {
+			self.skipped++
+			continue
+		}
+		if header.TerminatorId != self.terminatorId {
+			continue
+		}
+
+		switch header.Namespace {
+		case event.TerminatorEventsNs:
+			evt := &event.TerminatorEvent{}
+			if err := json.Unmarshal(line, evt); err != nil {
+				self.skipped++
+				continue
+			}
+			self.terminatorEvents = append(self.terminatorEvents, evt)
+		case event.CircuitEventsNs:
+			evt := &event.CircuitEvent{}
+			if err := json.Unmarshal(line, evt); err != nil {
+				self.skipped++
+				continue
+			}
+			self.circuitEvents = append(self.circuitEvents, evt)
+		}
+	}
+	return scanner.Err()
+}
+
+// entries returns the history of the terminator in time order. Terminator events are compared with the one before, so
+// that updates show what changed
+func (self *terminatorHistory) entries() []*terminatorHistoryEntry {
+	sort.SliceStable(self.terminatorEvents, func(i, j int) bool {
+		return self.terminatorEvents[i].Timestamp.Before(self.terminatorEvents[j].Timestamp)
+	})
+
+	var result []*terminatorHistoryEntry
+	var previous *event.TerminatorEvent
+	for _, evt := range self.terminatorEvents {
+		if !evt.Timestamp.Before(self.since) {
+			result = append(result, &terminatorHistoryEntry{
+				Timestamp: evt.Timestamp,
+				Event:     string(evt.EventType),
+				Details:   terminatorEventDetails(previous, evt),
+			})
+		}
+		previous = evt
+	}
+
+	result = append(result, self.circuitEntries()...)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result
+}
+
+// circuitEntries lists the circuits routed to the terminator or, if bucketed, how many were created and failed in each
+// interval
+func (self *terminatorHistory) circuitEntries() []*terminatorHistoryEntry {
+	var result []*terminatorHistoryEntry
+	buckets := map[time.Time]*circuitBucket{}
+	for _, evt := range self.circuitEvents {
+		if evt.Timestamp.Before(self.since) {
+			continue
+		}
+		if evt.EventType != event.CircuitCreated && evt.EventType != event.CircuitFailed {
+			continue
+		}
+
+		if self.bucket == 0 {
+			details := fmt.Sprintf("circuit %v for client %v", evt.CircuitId, evt.ClientId)
+			if evt.FailureCause != nil {
+				details += ": " + *evt.FailureCause
+			}
+			result = append(result, &terminatorHistoryEntry{
+				Timestamp: evt.Timestamp,
+				Event:     "circuit " + string(evt.EventType),
+				Details:   details,
+			})
+			continue
+		}
+
+		start := evt.Timestamp.Truncate(self.bucket)
+		bucket, found := buckets[start]
+		if !found {
+			bucket = &circuitBucket{clients: map[string]struct{}{}}
+			buckets[start] = bucket
+		}
+		if evt.EventType == event.CircuitCreated {
+			bucket.created++
+		} else {
+			bucket.failed++
+		}
+		if evt.ClientId != "" {
+			bucket.clients[evt.ClientId] = struct{}{}
+		}
+	}
+
+	for start, bucket := range buckets {
+		result = append(result, &terminatorHistoryEntry{
+			Timestamp: start,
+			Event:     "circuits",
+			Details: fmt.Sprintf("%v created, %v failed, %v clients in %v", bucket.created, bucket.failed,
+				len(bucket.clients), self.bucket),
+		})
+	}
+	return result
+}
+
+// terminatorEventDetails describes a terminator event. Updates list the fields which changed since the previous event
+func terminatorEventDetails(previous, evt *event.TerminatorEvent) string {
+	var details []string
+	switch {
+	case evt.EventType == event.TerminatorRouterOnline || evt.EventType == event.TerminatorRouterOffline:
+		details = append(details, "router "+evt.RouterId)
+	case previous == nil || evt.EventType == event.TerminatorCreated:
+		details = append(details, fmt.Sprintf("service %v, router %v, precedence %v, static cost %v, dynamic cost %v",
+			evt.ServiceId, evt.RouterId, evt.Precedence, evt.StaticCost, evt.DynamicCost))
+	default:
+		if previous.Precedence != evt.Precedence {
+			change := fmt.Sprintf("precedence %v -> %v", previous.Precedence, evt.Precedence)
+			if evt.Precedence == "failed" {
+				change += " (health check failed)"
+			} else if previous.Precedence == "failed" {
+				change += " (health check recovered)"
+			}
+			details = append(details, change)
+		}
+		if previous.StaticCost != evt.StaticCost {
+			details = append(details, fmt.Sprintf("static cost %v -> %v", previous.StaticCost, evt.StaticCost))
+		}
+		if previous.DynamicCost != evt.DynamicCost {
+			details = append(details, fmt.Sprintf("dynamic cost %v -> %v", previous.DynamicCost, evt.DynamicCost))
+		}
+		if previous.RouterId != evt.RouterId {
+			details = append(details, fmt.Sprintf("router %v -> %v", previous.RouterId, evt.RouterId))
+		}
+		if len(details) == 0 && evt.EventType == event.TerminatorUpdated {
+			details = append(details, "no change to cost or precedence")
+		}
+	}
+
+	if evt.TotalTerminators >= 0 {
+		details = append(details, fmt.Sprintf("service has %v usable of %v terminators",
+			evt.UsableDefaultTerminators+evt.UsableRequiredTerminators, evt.TotalTerminators))
+	}
+	return strings.Join(details, ", ")
+}
@@ -0,0 +1,58 @@
+package fabric
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminatorHistory(t *testing.T) {
+	req := require.New(t)
+
+	history := newTerminatorHistory("t1", 15*time.Minute)
+
+	// the second file is older, as happens with rotated logs
+	events := `
+{"namespace":"fabric.terminators","event_type":"updated","timestamp":"2022-06-01T03:02:00Z","service_id":"s1","terminator_id":"t1","router_id":"r1","router_online":true,"precedence":"failed","static_cost":10,"dynamic_cost":0,"total_terminators":2,"usable_default_terminators":1,"usable_required_terminators":0}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c1","timestamp":"2022-06-01T03:05:00Z","client_id":"i1","service_id":"s1","terminator_id":"t1"}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c2","timestamp":"2022-06-01T03:10:00Z","client_id":"i1","service_id":"s1","terminator_id":"t1"}
+{"namespace":"fabric.circuits","event_type":"failed","circuit_id":"c3","timestamp":"2022-06-01T03:20:00Z","client_id":"i2","service_id":"s1","terminator_id":"t1","failure_cause":"ROUTER_ERR_GENERIC"}
+{"namespace":"fabric.circuits","event_type":"created","circuit_id":"c4","timestamp":"2022-06-01T03:21:00Z","client_id":"i2","service_id":"s1","terminator_id":"t2"}
+{"namespace":"fabric.terminators","event_type":"router-offline","timestamp":"2022-06-01T03:30:00Z","service_id":"s1","terminator_id":"t1","router_id":"r1","router_online":false,"precedence":"failed","static_cost":10,"dynamic_cost":0,"total_terminators":2,"usable_default_terminators":1,"usable_required_terminators":0}
+not json
+`
+	older := `
+{"namespace":"fabric.terminators","event_type":"created","timestamp":"2022-06-01T01:00:00Z","service_id":"s1","terminator_id":"t1","router_id":"r1","router_online":true,"precedence":"default","static_cost":0,"dynamic_cost":0,"total_terminators":2,"usable_default_terminators":2,"usable_required_terminators":0}
+{"namespace":"fabric.terminators","event_type":"updated","timestamp":"2022-06-01T02:00:00Z","service_id":"s1","terminator_id":"t1","router_id":"r1","router_online":true,"precedence":"default","static_cost":10,"dynamic_cost":0,"total_terminators":2,"usable_default_terminators":2,"usable_required_terminators":0}
+`
+	req.NoError(history.read(strings.NewReader(events)))
+	req.NoError(history.read(strings.NewReader(older)))
+	req.Equal(1, history.skipped)
+
+	entries := history.entries()
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, entry.Timestamp.UTC().Format("15:04")+" "+entry.Event+": "+entry.Details)
+	}
+	req.Equal([]string{
+		"01:00 created: service s1, router r1, precedence default, static cost 0, dynamic cost 0, service has 2 usable of 2 terminators",
+		"02:00 updated: static cost 0 -> 10, service has 2 usable of 2 terminators",
+		"03:00 circuits: 2 created, 0 failed, 1 clients in 15m0s",
+		"03:02 updated: precedence default -> failed (health check failed), service has 1 usable of 2 terminators",
+		"03:15 circuits: 0 created, 1 failed, 1 clients in 15m0s",
+		"03:30 router-offline: router r1, service has 1 usable of 2 terminators",
+	}, lines)
+
+	history.bucket = 0
+	history.since = time.Date(2022, 6, 1, 3, 15, 0, 0, time.UTC)
+	lines = nil
+	for _, entry := range history.entries() {
+		lines = append(lines, entry.Event+": "+entry.Details)
+	}
+	req.Equal([]string{
+		"circuit failed: circuit c3 for client i2: ROUTER_ERR_GENERIC",
+		"router-offline: router r1, service has 1 usable of 2 terminators",
+	}, lines)
+}
@@ -17,17 +17,14 @@
 package fabric
 
 import (
-	"errors"
-	"fmt"
-	"github.com/Jeffail/gabs"
-	"github.com/openziti/foundation/v2/stringz"
+	"time"
+
+	"github.com/openziti/fabric/rest_model"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/util"
-	errors2 "github.com/pkg/errors"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"math"
 )
 
 type updateTerminatorOptions struct {
@@ -37,6 +34,11 @@ type updateTerminatorOptions struct {
 	binding    string
 	cost       int32
 	precedence string
+
+	drain        bool
+	drainTimeout time.Duration
+	pollInterval time.Duration
+	delete       bool
 }
 
 func newUpdateTerminatorCmd(p common.OptionsProvider) *cobra.Command {
@@ -47,7 +49,12 @@ func newUpdateTerminatorCmd(p common.OptionsProvider) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "terminator <id>",
 		Short: "updates a service terminator",
-		Args:  cobra.ExactArgs(1),
+		Long: "Updates a service terminator. With --drain the terminator is given failed precedence, so no new " +
+			"circuits select it while other terminators of the service are available, and the command waits for the " +
+			"circuits using it to finish. With --delete it's then deleted, which is the safe way to retire a backend",
+		Example: `  # stop sending new circuits to a terminator, wait for its circuits to finish and delete it
+  ziti fabric update terminator 7vBSbFkRW --drain --delete --drain-timeout 15m`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
@@ -64,57 +71,108 @@ func newUpdateTerminatorCmd(p common.OptionsProvider) *cobra.Command {
 	cmd.Flags().StringVar(&options.binding, "binding", "", "Set the terminator binding")
 	cmd.Flags().Int32VarP(&options.cost, "cost", "c", 0, "Set the terminator cost")
 	cmd.Flags().StringVarP(&options.precedence, "precedence", "p", "", "Set the terminator precedence ('default', 'required' or 'failed')")
+	cmd.Flags().BoolVar(&options.drain, "drain", false, "Set the terminator precedence to failed and wait for the circuits using it to finish")
+	cmd.Flags().DurationVar(&options.drainTimeout, "drain-timeout", 5*time.Minute, "With --drain, how long to wait for the circuits using the terminator to finish")
+	cmd.Flags().DurationVar(&options.pollInterval, "poll-interval", 5*time.Second, "With --drain, how often to check the circuits using the terminator")
+	cmd.Flags().BoolVar(&options.delete, "delete", false, "With --drain, delete the terminator once it has no circuits")
 	options.AddCommonFlags(cmd)
 
 	return cmd
 }
 
 // runUpdateTerminator implements the command to update a Terminator
-func runUpdateTerminator(o *updateTerminatorOptions) (err error) {
-	entityData := gabs.New()
-
-	router, err := api.MapNameToID(util.FabricAPI, "routers", &o.Options, o.router)
-	if err != nil {
-		return err
-	}
+func runUpdateTerminator(o *updateTerminatorOptions) error {
+	update := &TerminatorUpdate{}
 
-	change := false
 	if o.Cmd.Flags().Changed("router") {
-		api.SetJSONValue(entityData, router, "router")
-		change = true
+		update.Router = &o.router
 	}
 
 	if o.Cmd.Flags().Changed("binding") {
-		api.SetJSONValue(entityData, o.binding, "binding")
-		change = true
+		update.Binding = &o.binding
 	}
 
 	if o.Cmd.Flags().Changed("address") {
-		api.SetJSONValue(entityData, o.address, "address")
-		change = true
+		update.Address = &o.address
 	}
 
 	if o.Cmd.Flags().Changed("cost") {
-		if o.cost > math.MaxUint16 {
-			return errors2.Errorf("Invalid cost %v. Must be positive number less than or equal to %v", o.cost, math.MaxUint16)
-		}
-		api.SetJSONValue(entityData, o.cost, "cost")
-		change = true
+		update.Cost = &o.cost
 	}
 
 	if o.Cmd.Flags().Changed("precedence") {
-		validValues := []string{"default", "required", "failed"}
-		if !stringz.Contains(validValues, o.precedence) {
-			return errors2.Errorf("Invalid precedence %v. Must be one of %+v", o.precedence, validValues)
+		update.Precedence = &o.precedence
+	}
+
+	if o.delete && !o.drain {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--delete may only be used with --drain")
+	}
+
+	if o.drain {
+		if update.Precedence != nil && *update.Precedence != string(rest_model.TerminatorPrecedenceFailed) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--drain sets the precedence to failed and can't be combined with --precedence %v", *update.Precedence)
 		}
-		api.SetJSONValue(entityData, o.precedence, "precedence")
-		change = true
+		precedence := string(rest_model.TerminatorPrecedenceFailed)
+		update.Precedence = &precedence
 	}
 
-	if !change {
-		return errors.New("no change specified. must specify at least one attribute to change")
+	ctx, cancel := o.TimeoutContext()
+	err := UpdateTerminator(ctx, &o.Options, o.Args[0], update)
+	cancel()
+	if err != nil || !o.drain {
+		return err
 	}
 
-	_, err = patchEntityOfType(fmt.Sprintf("terminators/%v", o.Args[0]), entityData.String(), &o.Options)
-	return err
+	if err = o.drainTerminator(o.Args[0]); err != nil {
+		return err
+	}
+
+	if o.delete {
+		ctx, cancel := o.TimeoutContext()
+		defer cancel()
+		if err = DeleteTerminator(ctx, &o.Options, o.Args[0]); err != nil {
+			return err
+		}
+		o.Printf("terminator %v deleted\n", o.Args[0])
+	}
+	return nil
+}
+
+// drainTerminator waits until no circuits use the terminator. If the drain timeout passes first, an error is returned,
+// so that a terminator still in use isn't deleted
+func (o *updateTerminatorOptions) drainTerminator(id string) error {
+	deadline := time.Now().Add(o.drainTimeout)
+	for {
+		ctx, cancel := o.TimeoutContext()
+		circuits, err := ListCircuits(ctx, &o.Options)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		count := countTerminatorCircuits(circuits, id)
+		if count == 0 {
+			o.Printf("terminator %v has no circuits\n", id)
+			return nil
+		}
+
+		if time.Now().Add(o.pollInterval).After(deadline) {
+			return errors.Errorf("terminator %v still has %v circuits after %v. "+
+				"It stays at failed precedence", id, count, o.drainTimeout)
+		}
+
+		o.Printf("waiting for %v circuits using terminator %v to finish\n", count, id)
+		time.Sleep(o.pollInterval)
+	}
+}
+
+// countTerminatorCircuits returns how many of the given circuits end at the terminator
+func countTerminatorCircuits(circuits []*rest_model.CircuitDetail, terminatorId string) int {
+	count := 0
+	for _, c := range circuits {
+		if c.Terminator != nil && c.Terminator.ID == terminatorId {
+			count++
+		}
+	}
+	return count
 }
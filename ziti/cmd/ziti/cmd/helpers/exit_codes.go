@@ -0,0 +1,114 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// Exit codes returned by ziti commands, so scripts can branch on the class of failure without parsing stderr.
+// Any failure which doesn't fit one of the specific classes exits with ExitCodeGeneral.
+const (
+	// ExitCodeGeneral is returned for failures which don't fall into a more specific class
+	ExitCodeGeneral = DefaultErrorExitCode
+	// ExitCodeUsage is returned when the command line couldn't be parsed, e.g. unknown flags
+	ExitCodeUsage = 2
+	// ExitCodeAuth is returned when authentication or authorization failed, or no usable login is available
+	ExitCodeAuth = 3
+	// ExitCodeNotFound is returned when a requested entity doesn't exist
+	ExitCodeNotFound = 4
+	// ExitCodeValidation is returned when input was rejected as invalid, locally or by the controller
+	ExitCodeValidation = 5
+	// ExitCodeConnectivity is returned when the controller or another remote endpoint couldn't be reached
+	ExitCodeConnectivity = 6
+	// ExitCodePartialFailure is returned when a bulk operation failed for some, but not all, of its items
+	ExitCodePartialFailure = 7
+	// ExitCodeCancelled is returned when the user declined to confirm the operation
+	ExitCodeCancelled = 8
+)
+
+// ExitCoder is implemented by errors which know which exit code the CLI should return for them
+type ExitCoder interface {
+	ExitCode() int
+}
+
+type exitCodeError struct {
+	error
+	code int
+}
+
+func (self *exitCodeError) ExitCode() int {
+	return self.code
+}
+
+func (self *exitCodeError) Unwrap() error {
+	return self.error
+}
+
+// WithExitCode tags err with the given exit code. A nil err returns nil
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{error: err, code: code}
+}
+
+// Errorf creates an error tagged with the given exit code
+func Errorf(code int, format string, args ...interface{}) error {
+	return WithExitCode(code, fmt.Errorf(format, args...))
+}
+
+// ExitCodeForHttpStatus maps an HTTP response status onto the exit code scheme
+func ExitCodeForHttpStatus(status int) int {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ExitCodeAuth
+	case http.StatusNotFound:
+		return ExitCodeNotFound
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		return ExitCodeValidation
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ExitCodeConnectivity
+	}
+	return ExitCodeGeneral
+}
+
+// ExitCodeForError returns the exit code for err. Errors tagged with an exit code anywhere in their chain use that
+// code, network errors map to ExitCodeConnectivity and everything else to ExitCodeGeneral
+func ExitCodeForError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitCoder ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ExitCodeConnectivity
+	}
+
+	return ExitCodeGeneral
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	assert.Equal(t, 0, ExitCodeForError(nil))
+	assert.Equal(t, ExitCodeGeneral, ExitCodeForError(errors.New("boom")))
+	assert.Equal(t, ExitCodeGeneral, ExitCodeForError(ErrExit))
+	assert.Equal(t, ExitCodeNotFound, ExitCodeForError(Errorf(ExitCodeNotFound, "no service found")))
+	assert.Nil(t, WithExitCode(ExitCodeAuth, nil))
+}
+
+func TestExitCodeForWrappedError(t *testing.T) {
+	err := Errorf(ExitCodeAuth, "login expired")
+	assert.Equal(t, ExitCodeAuth, ExitCodeForError(pkgerrors.Wrap(err, "unable to list services")))
+	assert.Equal(t, ExitCodeAuth, ExitCodeForError(fmt.Errorf("unable to list services: %w", err)))
+}
+
+func TestExitCodeForConnectivityError(t *testing.T) {
+	err := &url.Error{Op: "Get", URL: "https://localhost:1280", Err: errors.New("connection refused")}
+	assert.Equal(t, ExitCodeConnectivity, ExitCodeForError(err))
+}
+
+func TestExitCodeForHttpStatus(t *testing.T) {
+	assert.Equal(t, ExitCodeAuth, ExitCodeForHttpStatus(http.StatusUnauthorized))
+	assert.Equal(t, ExitCodeNotFound, ExitCodeForHttpStatus(http.StatusNotFound))
+	assert.Equal(t, ExitCodeValidation, ExitCodeForHttpStatus(http.StatusBadRequest))
+	assert.Equal(t, ExitCodeConnectivity, ExitCodeForHttpStatus(http.StatusServiceUnavailable))
+	assert.Equal(t, ExitCodeGeneral, ExitCodeForHttpStatus(http.StatusInternalServerError))
+}
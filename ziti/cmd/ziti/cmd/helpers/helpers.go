@@ -17,6 +17,7 @@
 package helpers
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -38,6 +39,22 @@ type debugError interface {
 
 var fatalErrHandler = fatal
 
+var exitHooks []func()
+
+// AddExitHook registers a function to run when the CLI exits, whether it succeeded or failed
+func AddExitHook(hook func()) {
+	exitHooks = append(exitHooks, hook)
+}
+
+// RunExitHooks runs the registered exit hooks, each of which only runs once
+func RunExitHooks() {
+	hooks := exitHooks
+	exitHooks = nil
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
 // BehaviorOnFatal allows you to override the default behavior when a fatal
 // error occurs, which is to call os.Exit(code). You can pass 'panic' as a function
 // here if you prefer the panic() over os.Exit(1).
@@ -66,11 +83,12 @@ func fatal(msg string, code int) {
 		}
 		fmt.Fprint(os.Stderr, msg)
 	}
+	RunExitHooks()
 	os.Exit(code)
 }
 
 // ErrExit may be passed to CheckError to instruct it to output nothing but exit with
-// status code 1.
+// status code 1. Use WithExitCode to exit silently with a different code.
 var ErrExit = fmt.Errorf("exit")
 
 // CheckErr prints a user friendly error to STDERR and exits with a non-zero
@@ -100,8 +118,8 @@ func checkErr(prefix string, err error, handleErr func(string, int)) {
 	switch {
 	case err == nil:
 		return
-	case err == ErrExit:
-		handleErr("", DefaultErrorExitCode)
+	case errors.Is(err, ErrExit):
+		handleErr("", ExitCodeForError(err))
 		return
 	/*
 		case kerrors.IsInvalid(err):
@@ -144,7 +162,7 @@ func checkErr(prefix string, err error, handleErr func(string, int)) {
 					msg = fmt.Sprintf("error: %s", msg)
 				}
 			}
-			handleErr(msg, DefaultErrorExitCode)
+			handleErr(msg, ExitCodeForError(err))
 		}
 	}
 }
@@ -0,0 +1,406 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/resty.v1"
+)
+
+const (
+	benchmarkOpList   = "list"
+	benchmarkOpCreate = "create"
+	benchmarkOpDelete = "delete"
+)
+
+// default create bodies for entity types which need more than a name
+var benchmarkCreateBodies = map[string]string{
+	"identities": `{"name": "{{name}}", "type": "Device", "isAdmin": false}`,
+}
+
+type benchmarkControllerCmd struct {
+	api.Options
+	api         string
+	entityType  string
+	concurrency int
+	duration    time.Duration
+	mix         string
+	pageSize    int
+	prefix      string
+	createBody  string
+}
+
+func newBenchmarkControllerCmd(p common.OptionsProvider) *cobra.Command {
+	action := &benchmarkControllerCmd{Options: api.Options{CommonOptions: p()}}
+
+	cmd := &cobra.Command{
+		Use:   "controller",
+		Short: "Measures management API list/create/delete throughput and latency against the current controller",
+		Long: "Measures management API list/create/delete throughput and latency against the current controller. " +
+			"Entities created during the run are named with the given prefix and are removed when the run completes.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&action.api, "api", string(util.EdgeAPI), "Which management API to benchmark (edge or fabric)")
+	cmd.Flags().StringVar(&action.entityType, "entity-type", "services", "Entity type to list, create and delete")
+	cmd.Flags().IntVar(&action.concurrency, "concurrency", 10, "Number of concurrent clients")
+	cmd.Flags().DurationVar(&action.duration, "duration", 30*time.Second, "How long to run the benchmark")
+	cmd.Flags().StringVar(&action.mix, "mix", "list=80,create=10,delete=10", "Relative weights of list, create and delete operations")
+	cmd.Flags().IntVar(&action.pageSize, "page-size", 10, "Number of entities to request per list operation")
+	cmd.Flags().StringVar(&action.prefix, "prefix", "benchmark-", "Name prefix for created entities")
+	cmd.Flags().StringVar(&action.createBody, "create-body", "", "JSON body used when creating entities. {{name}} is replaced with a generated name")
+	action.AddTableOutputFlags(cmd)
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+type benchmarkOpWeight struct {
+	op     string
+	weight int
+}
+
+func parseBenchmarkMix(mix string) ([]*benchmarkOpWeight, error) {
+	var result []*benchmarkOpWeight
+	total := 0
+	for _, entry := range strings.Split(mix, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "=")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid mix entry '%v', expected <operation>=<weight>", entry)
+		}
+		op := strings.ToLower(parts[0])
+		if op != benchmarkOpList && op != benchmarkOpCreate && op != benchmarkOpDelete {
+			return nil, errors.Errorf("invalid operation '%v', must be one of list, create or delete", parts[0])
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, errors.Errorf("invalid weight '%v' for operation %v", parts[1], op)
+		}
+		total += weight
+		result = append(result, &benchmarkOpWeight{op: op, weight: weight})
+	}
+	if total == 0 {
+		return nil, errors.New("at least one operation must have a non-zero weight")
+	}
+	return result, nil
+}
+
+type benchmarkOpStats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+type benchmarkRun struct {
+	*benchmarkControllerCmd
+	client   *resty.Client
+	identity util.RestClientIdentity
+	baseUrl  string
+	weights  []*benchmarkOpWeight
+	total    int
+
+	lock    sync.Mutex
+	stats   map[string]*benchmarkOpStats
+	created []string
+	counter int
+	lastErr error
+}
+
+func (self *benchmarkControllerCmd) run() error {
+	weights, err := parseBenchmarkMix(self.mix)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	if self.concurrency < 1 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "concurrency must be at least 1")
+	}
+
+	identity, err := util.LoadSelectedRWIdentityForApi(util.API(self.api))
+	if err != nil {
+		return err
+	}
+
+	baseUrl, err := identity.GetBaseUrlForApi(util.API(self.api))
+	if err != nil {
+		return err
+	}
+
+	client, err := identity.NewClient(time.Duration(self.Timeout)*time.Second, self.Verbose)
+	if err != nil {
+		return err
+	}
+	client.SetRetryCount(0)
+
+	run := &benchmarkRun{
+		benchmarkControllerCmd: self,
+		client:                 client,
+		identity:               identity,
+		baseUrl:                baseUrl + "/" + self.entityType,
+		weights:                weights,
+		stats:                  map[string]*benchmarkOpStats{},
+	}
+	for _, w := range weights {
+		run.total += w.weight
+		run.stats[w.op] = &benchmarkOpStats{}
+	}
+
+	self.Printf("benchmarking %v %v with %v clients for %v\n", self.api, self.entityType, self.concurrency, self.duration)
+
+	start := time.Now()
+	deadline := start.Add(self.duration)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < self.concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			run.runWorker(rand.New(rand.NewSource(seed)), deadline)
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	run.cleanup()
+	run.report(elapsed)
+
+	return run.result()
+}
+
+// result returns an error if any operation failed. If some operations succeeded, the error has
+// ExitCodePartialFailure, so scripts can tell a degraded controller from an unusable one
+func (self *benchmarkRun) result() error {
+	succeeded, failed := 0, 0
+	for _, stats := range self.stats {
+		succeeded += len(stats.latencies)
+		failed += stats.errors
+	}
+
+	if failed == 0 {
+		return nil
+	}
+	if succeeded == 0 {
+		return errors.Wrapf(self.lastErr, "all %v operations failed, last error", failed)
+	}
+	return cmdhelper.Errorf(cmdhelper.ExitCodePartialFailure, "%v of %v operations failed, last error: %v", failed, succeeded+failed, self.lastErr)
+}
+
+func (self *benchmarkRun) runWorker(r *rand.Rand, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		op := self.pickOp(r)
+
+		var id string
+		if op == benchmarkOpDelete {
+			if id = self.takeCreated(); id == "" {
+				// nothing to delete yet, so create something instead
+				op = benchmarkOpCreate
+			}
+		}
+
+		start := time.Now()
+		var err error
+		switch op {
+		case benchmarkOpList:
+			err = self.list()
+		case benchmarkOpCreate:
+			err = self.create()
+		case benchmarkOpDelete:
+			err = self.delete(id)
+		}
+		self.record(op, time.Since(start), err)
+	}
+}
+
+func (self *benchmarkRun) pickOp(r *rand.Rand) string {
+	n := r.Intn(self.total)
+	for _, w := range self.weights {
+		if n < w.weight {
+			return w.op
+		}
+		n -= w.weight
+	}
+	return self.weights[len(self.weights)-1].op
+}
+
+func (self *benchmarkRun) newRequest() *resty.Request {
+	return self.identity.NewRequest(self.client).SetHeader("Content-Type", "application/json")
+}
+
+func (self *benchmarkRun) list() error {
+	resp, err := self.newRequest().SetQueryParam("limit", strconv.Itoa(self.pageSize)).Get(self.baseUrl)
+	return checkBenchmarkResponse(resp, err, http.StatusOK)
+}
+
+func (self *benchmarkRun) create() error {
+	self.lock.Lock()
+	self.counter++
+	name := fmt.Sprintf("%v%v-%v", self.prefix, time.Now().Unix(), self.counter)
+	self.lock.Unlock()
+
+	body := self.createBody
+	if body == "" {
+		var found bool
+		if body, found = benchmarkCreateBodies[self.entityType]; !found {
+			body = `{"name": "{{name}}"}`
+		}
+	}
+	body = strings.ReplaceAll(body, "{{name}}", name)
+
+	resp, err := self.newRequest().SetBody(body).Post(self.baseUrl)
+	if err = checkBenchmarkResponse(resp, err, http.StatusCreated); err != nil {
+		return err
+	}
+
+	result, err := gabs.ParseJSON(resp.Body())
+	if err != nil {
+		return err
+	}
+	if id, ok := result.S("data", "id").Data().(string); ok {
+		self.lock.Lock()
+		self.created = append(self.created, id)
+		self.lock.Unlock()
+	}
+	return nil
+}
+
+func (self *benchmarkRun) delete(id string) error {
+	resp, err := self.newRequest().Delete(self.baseUrl + "/" + id)
+	return checkBenchmarkResponse(resp, err, http.StatusOK)
+}
+
+func (self *benchmarkRun) takeCreated() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.created) == 0 {
+		return ""
+	}
+	id := self.created[len(self.created)-1]
+	self.created = self.created[:len(self.created)-1]
+	return id
+}
+
+func (self *benchmarkRun) record(op string, latency time.Duration, err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	stats := self.stats[op]
+	if stats == nil {
+		stats = &benchmarkOpStats{}
+		self.stats[op] = stats
+	}
+	if err != nil {
+		stats.errors++
+		self.lastErr = err
+		return
+	}
+	stats.latencies = append(stats.latencies, latency)
+}
+
+func (self *benchmarkRun) cleanup() {
+	if len(self.created) == 0 {
+		return
+	}
+	self.Printf("removing %v entities created during the benchmark\n", len(self.created))
+	for id := self.takeCreated(); id != ""; id = self.takeCreated() {
+		if err := self.delete(id); err != nil {
+			self.Printf("unable to delete %v %v: %v\n", self.entityType, id, err)
+		}
+	}
+}
+
+func (self *benchmarkRun) report(elapsed time.Duration) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Operation", "Count", "Errors", "Ops/sec", "Min", "P50", "P90", "P99", "Max"})
+	var columnConfigs []table.ColumnConfig
+	for i := 2; i <= 9; i++ {
+		columnConfigs = append(columnConfigs, table.ColumnConfig{Number: i, Align: text.AlignRight})
+	}
+	t.SetColumnConfigs(columnConfigs)
+
+	var ops []string
+	for op := range self.stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		stats := self.stats[op]
+		latencies := stats.latencies
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		opsPerSec := float64(len(latencies)) / elapsed.Seconds()
+		t.AppendRow(table.Row{op, len(latencies), stats.errors, fmt.Sprintf("%.1f", opsPerSec),
+			formatLatency(percentile(latencies, 0)),
+			formatLatency(percentile(latencies, 50)),
+			formatLatency(percentile(latencies, 90)),
+			formatLatency(percentile(latencies, 99)),
+			formatLatency(percentile(latencies, 100)),
+		})
+	}
+
+	api.RenderTable(&self.Options, t, nil)
+}
+
+// percentile returns the given percentile from a sorted list of latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted)*p+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+func checkBenchmarkResponse(resp *resty.Response, err error, expectedStatus int) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != expectedStatus {
+		return errors.Errorf("unexpected status %v: %v", resp.Status(), resp.String())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package ops
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBenchmarkMix(t *testing.T) {
+	tests := []struct {
+		mix      string
+		expected []*benchmarkOpWeight
+		err      string
+	}{
+		{
+			mix:      "list=80,create=10,delete=10",
+			expected: []*benchmarkOpWeight{{op: "list", weight: 80}, {op: "create", weight: 10}, {op: "delete", weight: 10}},
+		},
+		{
+			mix:      " LIST=1, create=0",
+			expected: []*benchmarkOpWeight{{op: "list", weight: 1}, {op: "create", weight: 0}},
+		},
+		{mix: "list", err: "invalid mix entry"},
+		{mix: "list=1=2", err: "invalid mix entry"},
+		{mix: "update=5", err: "invalid operation 'update'"},
+		{mix: "list=many", err: "invalid weight 'many'"},
+		{mix: "list=-1", err: "invalid weight '-1'"},
+		{mix: "list=0,create=0", err: "at least one operation"},
+		{mix: "", err: "invalid mix entry"},
+	}
+
+	for _, test := range tests {
+		weights, err := parseBenchmarkMix(test.mix)
+		if test.err != "" {
+			require.Error(t, err, test.mix)
+			require.Contains(t, err.Error(), test.err, test.mix)
+			continue
+		}
+		require.NoError(t, err, test.mix)
+		require.Equal(t, test.expected, weights, test.mix)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		latencies []time.Duration
+		p         int
+		expected  time.Duration
+	}{
+		{latencies: sorted, p: 0, expected: time.Millisecond},
+		{latencies: sorted, p: 50, expected: 5 * time.Millisecond},
+		{latencies: sorted, p: 90, expected: 9 * time.Millisecond},
+		{latencies: sorted, p: 99, expected: 10 * time.Millisecond},
+		{latencies: sorted, p: 100, expected: 10 * time.Millisecond},
+		{latencies: sorted[:1], p: 50, expected: time.Millisecond},
+		{latencies: nil, p: 50, expected: 0},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, percentile(test.latencies, test.p), "p%v of %v", test.p, test.latencies)
+	}
+}
+
+func TestBenchmarkResult(t *testing.T) {
+	req := require.New(t)
+
+	run := &benchmarkRun{stats: map[string]*benchmarkOpStats{}}
+	run.record(benchmarkOpList, time.Millisecond, nil)
+	req.NoError(run.result())
+
+	run.record(benchmarkOpCreate, time.Millisecond, errors.New("boom"))
+	err := run.result()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "1 of 2 operations failed")
+
+	run = &benchmarkRun{stats: map[string]*benchmarkOpStats{}}
+	run.record(benchmarkOpList, time.Millisecond, cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "not authorized"))
+	err = run.result()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeAuth, cmdhelper.ExitCodeForError(err), "the exit code of the failures is kept")
+	req.Contains(err.Error(), "all 1 operations failed")
+}
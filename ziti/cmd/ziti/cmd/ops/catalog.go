@@ -0,0 +1,318 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+)
+
+const catalogNoTeam = "Unassigned"
+
+// catalogMarkdownEscaper escapes the characters which would otherwise end a table cell or format its text, such as
+// the asterisks of wildcard addresses
+var catalogMarkdownEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+type catalogCmd struct {
+	api.Options
+	filter  string
+	teamTag string
+	outFile string
+}
+
+func newCatalogCmd(p common.OptionsProvider) *cobra.Command {
+	action := &catalogCmd{Options: api.Options{CommonOptions: p()}}
+
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Generates a catalog of the services on the network for application teams",
+		Long: "Generates a human-facing catalog of the services on the network from the controller, so that " +
+			"application teams can find what is available without admin access. Each service is listed with the " +
+			"addresses, ports and protocols its intercept.v1 and ziti-tunneler-client.v1 configs intercept, the team " +
+			"owning it, taken from the tag given with --team-tag, and the identity roles granted access to it by Dial " +
+			"service policies. The catalog is written as Markdown grouped by team, or as JSON with --output-json.",
+		Example: `  # publish the catalog of the services owned by teams
+  ziti ops catalog --filter 'tags.team != null' --out services.md`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVar(&action.filter, "filter", "true", "Only include the services matching this filter")
+	cmd.Flags().StringVar(&action.teamTag, "team-tag", "team", "Tag of the services naming the team which owns them")
+	cmd.Flags().StringVar(&action.outFile, "out", "", "File to write the catalog to, instead of stdout")
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// catalogService is the catalog entry of a service
+type catalogService struct {
+	Name        string              `json:"name"`
+	Team        string              `json:"team,omitempty"`
+	Intercepts  []*catalogIntercept `json:"intercepts"`
+	AccessRoles []string            `json:"accessRoles"`
+}
+
+// catalogIntercept is what a config of a service intercepts
+type catalogIntercept struct {
+	Protocols []string `json:"protocols"`
+	Addresses []string `json:"addresses"`
+	Ports     []string `json:"ports"`
+}
+
+type serviceCatalog struct {
+	Generated time.Time         `json:"generated"`
+	Services  []*catalogService `json:"services"`
+}
+
+func (self *catalogCmd) run() error {
+	filter := self.filter
+	if !strings.Contains(filter, "limit") {
+		filter += " limit none"
+	}
+	params := url.Values{}
+	params.Add("filter", filter)
+	services, _, err := api.ListEntitiesOfType(util.EdgeAPI, "services", params, false, nil, self.Timeout, self.Verbose)
+	if err != nil {
+		return err
+	}
+
+	intercepts, err := self.getIntercepts(services)
+	if err != nil {
+		return err
+	}
+
+	catalog := &serviceCatalog{Generated: time.Now().UTC(), Services: []*catalogService{}}
+	for _, service := range services {
+		wrapper := api.Wrap(service)
+		entry := &catalogService{
+			Name:       wrapper.String("name"),
+			Intercepts: []*catalogIntercept{},
+		}
+		if team, ok := service.S("tags", self.teamTag).Data().(string); ok {
+			entry.Team = strings.TrimSpace(team)
+		}
+		for _, configId := range wrapper.StringSlice("configs") {
+			if intercept, found := intercepts[configId]; found {
+				entry.Intercepts = append(entry.Intercepts, intercept)
+			}
+		}
+		if entry.AccessRoles, err = self.getAccessRoles(wrapper.String("id")); err != nil {
+			return err
+		}
+		catalog.Services = append(catalog.Services, entry)
+	}
+
+	sort.Slice(catalog.Services, func(i, j int) bool {
+		return catalog.Services[i].Name < catalog.Services[j].Name
+	})
+
+	out := self.Out
+	if self.outFile != "" {
+		file, err := os.Create(self.outFile)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+	}
+
+	if self.OutputJSONResponse {
+		data, err := json.MarshalIndent(catalog, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	return writeCatalogMarkdown(out, catalog)
+}
+
+// getIntercepts returns what each intercept.v1 and ziti-tunneler-client.v1 config of the services intercepts, by id
+func (self *catalogCmd) getIntercepts(services []*gabs.Container) (map[string]*catalogIntercept, error) {
+	var configIds []string
+	for _, service := range services {
+		for _, configId := range api.Wrap(service).StringSlice("configs") {
+			if quoted := api.QuoteFilterString(configId); !stringz.Contains(configIds, quoted) {
+				configIds = append(configIds, quoted)
+			}
+		}
+	}
+
+	result := map[string]*catalogIntercept{}
+	if len(configIds) == 0 {
+		return result, nil
+	}
+
+	params := url.Values{}
+	params.Add("filter", fmt.Sprintf("id in [%v] limit none", strings.Join(configIds, ",")))
+	configs, _, err := api.ListEntitiesOfType(util.EdgeAPI, "configs", params, false, nil, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, config := range configs {
+		if intercept := configIntercept(config); intercept != nil {
+			result[api.GetJsonString(config, "id")] = intercept
+		}
+	}
+	return result, nil
+}
+
+// configIntercept returns what an intercept.v1 or ziti-tunneler-client.v1 config intercepts, or nil for other configs
+func configIntercept(config *gabs.Container) *catalogIntercept {
+	data := api.Wrap(config.S("data"))
+	switch api.GetJsonString(config, "configType.name") {
+	case "intercept.v1":
+		result := &catalogIntercept{
+			Protocols: data.StringSlice("protocols"),
+			Addresses: data.StringSlice("addresses"),
+		}
+		portRanges, _ := config.S("data", "portRanges").Children()
+		for _, portRange := range portRanges {
+			low := fmt.Sprint(portRange.S("low").Data())
+			high := fmt.Sprint(portRange.S("high").Data())
+			if low == high {
+				result.Ports = append(result.Ports, low)
+			} else {
+				result.Ports = append(result.Ports, low+"-"+high)
+			}
+		}
+		return result
+	case "ziti-tunneler-client.v1":
+		return &catalogIntercept{
+			Protocols: []string{"tcp", "udp"},
+			Addresses: []string{data.String("hostname")},
+			Ports:     []string{fmt.Sprint(config.S("data", "port").Data())},
+		}
+	}
+	return nil
+}
+
+// getAccessRoles returns the identity roles of the Dial service policies of the service. Identities given by id are
+// shown by name
+func (self *catalogCmd) getAccessRoles(serviceId string) ([]string, error) {
+	params := url.Values{}
+	params.Add("filter", "true limit none")
+	policies, _, err := api.ListEntitiesOfType(util.EdgeAPI, "services/"+serviceId+"/service-policies", params, false, nil, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, policy := range policies {
+		if api.GetJsonString(policy, "type") != "Dial" {
+			continue
+		}
+		names := map[string]string{}
+		displays, _ := policy.S("identityRolesDisplay").Children()
+		for _, display := range displays {
+			names[api.GetJsonString(display, "role")] = api.GetJsonString(display, "name")
+		}
+		for _, role := range api.Wrap(policy).StringSlice("identityRoles") {
+			if name, found := names[role]; found && strings.HasPrefix(role, "@") {
+				role = "@" + name
+			}
+			if !stringz.Contains(result, role) {
+				result = append(result, role)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// writeCatalogMarkdown writes the catalog as a Markdown table of services per team, with the services without a team
+// last
+func writeCatalogMarkdown(out io.Writer, catalog *serviceCatalog) error {
+	teams := map[string][]*catalogService{}
+	var teamNames []string
+	for _, service := range catalog.Services {
+		team := service.Team
+		if team == "" {
+			team = catalogNoTeam
+		}
+		if _, found := teams[team]; !found {
+			teamNames = append(teamNames, team)
+		}
+		teams[team] = append(teams[team], service)
+	}
+	sort.Slice(teamNames, func(i, j int) bool {
+		if (teamNames[i] == catalogNoTeam) != (teamNames[j] == catalogNoTeam) {
+			return teamNames[j] == catalogNoTeam
+		}
+		return teamNames[i] < teamNames[j]
+	})
+
+	cell := func(values []string) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return catalogMarkdownEscaper.Replace(strings.Join(values, ", "))
+	}
+
+	lines := []string{
+		"# Service Catalog",
+		"",
+		fmt.Sprintf("Generated %v. %v services.", catalog.Generated.Format(time.RFC1123), len(catalog.Services)),
+	}
+	for _, team := range teamNames {
+		lines = append(lines, "", "## "+team, "",
+			"| Service | Addresses | Ports | Protocols | Access |",
+			"|---------|-----------|-------|-----------|--------|")
+		for _, service := range teams[team] {
+			var addresses, ports, protocols []string
+			for _, intercept := range service.Intercepts {
+				addresses = appendMissing(addresses, intercept.Addresses...)
+				ports = appendMissing(ports, intercept.Ports...)
+				protocols = appendMissing(protocols, intercept.Protocols...)
+			}
+			lines = append(lines, fmt.Sprintf("| %v | %v | %v | %v | %v |", cell([]string{service.Name}), cell(addresses),
+				cell(ports), cell(protocols), cell(service.AccessRoles)))
+		}
+	}
+
+	_, err := fmt.Fprintln(out, strings.Join(lines, "\n"))
+	return err
+}
+
+func appendMissing(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		if !stringz.Contains(values, addition) {
+			values = append(values, addition)
+		}
+	}
+	return values
+}
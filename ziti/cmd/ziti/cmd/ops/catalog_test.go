@@ -0,0 +1,116 @@
+package ops
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigIntercept(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected *catalogIntercept
+	}{
+		{
+			name: "intercept.v1",
+			config: `{"configType": {"name": "intercept.v1"}, "data": {"protocols": ["tcp"], "addresses": ["app.example.com", "*.corp.local"],
+				"portRanges": [{"low": 443, "high": 443}, {"low": 8000, "high": 8080}]}}`,
+			expected: &catalogIntercept{
+				Protocols: []string{"tcp"},
+				Addresses: []string{"app.example.com", "*.corp.local"},
+				Ports:     []string{"443", "8000-8080"},
+			},
+		},
+		{
+			name:     "intercept.v1 without ports",
+			config:   `{"configType": {"name": "intercept.v1"}, "data": {"protocols": ["udp"], "addresses": ["10.0.0.1"]}}`,
+			expected: &catalogIntercept{Protocols: []string{"udp"}, Addresses: []string{"10.0.0.1"}},
+		},
+		{
+			name:   "ziti-tunneler-client.v1",
+			config: `{"configType": {"name": "ziti-tunneler-client.v1"}, "data": {"hostname": "db.example.com", "port": 5432}}`,
+			expected: &catalogIntercept{
+				Protocols: []string{"tcp", "udp"},
+				Addresses: []string{"db.example.com"},
+				Ports:     []string{"5432"},
+			},
+		},
+		{
+			name:   "other config type",
+			config: `{"configType": {"name": "host.v1"}, "data": {"address": "app.example.com", "port": 443}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := gabs.ParseJSON([]byte(test.config))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, configIntercept(config))
+		})
+	}
+}
+
+func TestWriteCatalogMarkdown(t *testing.T) {
+	req := require.New(t)
+
+	catalog := &serviceCatalog{
+		Generated: time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+		Services: []*catalogService{
+			{
+				Name: "wiki",
+				Intercepts: []*catalogIntercept{
+					{Protocols: []string{"tcp"}, Addresses: []string{"*.wiki.corp"}, Ports: []string{"443"}},
+					{Protocols: []string{"tcp", "udp"}, Addresses: []string{"wiki.corp"}, Ports: []string{"443"}},
+				},
+				AccessRoles: []string{"#all"},
+			},
+			{Name: "db|primary", Team: "data", Intercepts: []*catalogIntercept{}, AccessRoles: []string{"@dba_1"}},
+			{Name: "billing", Team: "apps", Intercepts: []*catalogIntercept{}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	req.NoError(writeCatalogMarkdown(out, catalog))
+
+	expected := `# Service Catalog
+
+Generated Tue, 01 Mar 2022 12:00:00 UTC. 3 services.
+
+## apps
+
+| Service | Addresses | Ports | Protocols | Access |
+|---------|-----------|-------|-----------|--------|
+| billing | - | - | - | - |
+
+## data
+
+| Service | Addresses | Ports | Protocols | Access |
+|---------|-----------|-------|-----------|--------|
+| db\|primary | - | - | - | @dba\_1 |
+
+## Unassigned
+
+| Service | Addresses | Ports | Protocols | Access |
+|---------|-----------|-------|-----------|--------|
+| wiki | \*.wiki.corp, wiki.corp | 443 | tcp, udp | #all |
+`
+	req.Equal(expected, out.String())
+}
+
+func TestCatalogQuotesConfigIds(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{})
+
+	services, err := gabs.ParseJSON([]byte(`{"configs": ["cfg\"1"]}`))
+	req.NoError(err)
+
+	cmd := &catalogCmd{}
+	_, err = cmd.getIntercepts([]*gabs.Container{services})
+	req.NoError(err)
+	req.Contains(testController.Requested(), `GET configs?id in ["cfg\"1"] limit none`)
+}
@@ -0,0 +1,390 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pborman/uuid"
+	"github.com/spf13/cobra"
+)
+
+const (
+	systemResolver = "system"
+
+	dnsStatusOk          = "ok"
+	dnsStatusIntercepted = "intercepted"
+	dnsStatusShadowed    = "shadowed"
+	dnsStatusSplit       = "split-horizon"
+	dnsStatusError       = "error"
+)
+
+type dnsCheckCmd struct {
+	api.Options
+	resolvers   []string
+	dnsIpRange  string
+	lookupLimit time.Duration
+	noFail      bool
+
+	dnsRange *net.IPNet
+}
+
+func newDnsCheckCmd(p common.OptionsProvider) *cobra.Command {
+	action := &dnsCheckCmd{Options: api.Options{CommonOptions: p()}}
+
+	cmd := &cobra.Command{
+		Use:   "dns-check <identity>",
+		Short: "Checks the hostnames intercepted for an identity against the host's DNS",
+		Long: "Collects every hostname the given identity intercepts through its services' intercept.v1 and " +
+			"ziti-tunneler-client.v1 configs and resolves each through the host's DNS, and any resolvers given with " +
+			"--resolver. A tunneler answers for these names itself with addresses from its DNS IP range, so a name " +
+			"which also resolves in real DNS is shadowed while the tunneler runs, and a name which resolvers answer " +
+			"differently for points at split-horizon DNS. Wildcard domains are checked with a random subdomain. " +
+			"Exits with a validation error if conflicts are found, unless --no-fail is given.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&action.resolvers, "resolver", []string{systemResolver}, "DNS servers to resolve with, as host[:port]. Use 'system' for the host's resolver")
+	cmd.Flags().StringVar(&action.dnsIpRange, "dns-ip-range", "100.64.0.1/10", "IP range the tunneler assigns intercepted hostnames from")
+	cmd.Flags().DurationVar(&action.lookupLimit, "lookup-timeout", 5*time.Second, "Timeout for each DNS lookup")
+	cmd.Flags().BoolVar(&action.noFail, "no-fail", false, "Exit successfully even if conflicts are found")
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// dnsCheckResult holds the outcome of checking one intercepted hostname
+type dnsCheckResult struct {
+	Hostname  string              `json:"hostname"`
+	Services  []string            `json:"services"`
+	Lookups   map[string][]string `json:"lookups"`
+	Errors    map[string]string   `json:"errors,omitempty"`
+	Status    string              `json:"status"`
+	Details   string              `json:"details,omitempty"`
+	probeName string
+}
+
+func (self *dnsCheckCmd) run() error {
+	_, dnsRange, err := net.ParseCIDR(self.dnsIpRange)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --dns-ip-range %v: %v", self.dnsIpRange, err)
+	}
+	self.dnsRange = dnsRange
+
+	if len(self.resolvers) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "at least one --resolver is required")
+	}
+
+	identityId, err := api.MapNameToID(util.EdgeAPI, "identities", &self.Options, self.Args[0])
+	if err != nil {
+		return err
+	}
+
+	hostnames, err := self.getInterceptedHostnames(identityId)
+	if err != nil {
+		return err
+	}
+
+	var results []*dnsCheckResult
+	for _, hostname := range sortedKeys(hostnames) {
+		services := hostnames[hostname]
+		sort.Strings(services)
+		result := &dnsCheckResult{
+			Hostname: hostname,
+			Services: services,
+			Lookups:  map[string][]string{},
+			Errors:   map[string]string{},
+		}
+		self.check(result)
+		results = append(results, result)
+	}
+
+	conflicts := 0
+	for _, result := range results {
+		if result.Status == dnsStatusShadowed || result.Status == dnsStatusSplit {
+			conflicts++
+		}
+	}
+
+	if self.OutputJSONResponse {
+		out, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		self.Printf("%v\n", string(out))
+	} else {
+		self.outputResults(results)
+	}
+
+	if conflicts > 0 && !self.noFail {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v of %v intercepted hostnames conflict with DNS", conflicts, len(results))
+	}
+	return nil
+}
+
+// getInterceptedHostnames returns the hostnames intercepted by the identity's services, mapped to the names of the
+// services intercepting them
+func (self *dnsCheckCmd) getInterceptedHostnames(identityId string) (map[string][]string, error) {
+	params := url.Values{}
+	params.Add("filter", "true limit none")
+	services, _, err := api.ListEntitiesOfType(util.EdgeAPI, "identities/"+identityId+"/services", params, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	var configIds []string
+	configServices := map[string][]string{}
+	for _, service := range services {
+		serviceName, _ := service.S("name").Data().(string)
+
+		configs, _ := service.S("configs").Data().([]interface{})
+		for _, val := range configs {
+			if configId, ok := val.(string); ok {
+				if _, found := configServices[configId]; !found {
+					configIds = append(configIds, api.QuoteFilterString(configId))
+				}
+				configServices[configId] = append(configServices[configId], serviceName)
+			}
+		}
+	}
+
+	hostnames := map[string][]string{}
+	if len(configIds) == 0 {
+		return hostnames, nil
+	}
+
+	params = url.Values{}
+	params.Add("filter", fmt.Sprintf("id in [%v] limit none", strings.Join(configIds, ",")))
+	configs, _, err := api.ListEntitiesOfType(util.EdgeAPI, "configs", params, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, config := range configs {
+		configId, _ := config.S("id").Data().(string)
+		for _, hostname := range configHostnames(config) {
+			for _, serviceName := range configServices[configId] {
+				if !stringz.Contains(hostnames[hostname], serviceName) {
+					hostnames[hostname] = append(hostnames[hostname], serviceName)
+				}
+			}
+		}
+	}
+
+	return hostnames, nil
+}
+
+// configHostnames returns the hostnames intercepted by an intercept.v1 or ziti-tunneler-client.v1 config. IP addresses
+// and CIDRs are skipped, as they don't involve DNS
+func configHostnames(config *gabs.Container) []string {
+	configType, _ := config.S("configType", "name").Data().(string)
+
+	var addresses []string
+	switch configType {
+	case "intercept.v1":
+		values, _ := config.S("data", "addresses").Data().([]interface{})
+		for _, val := range values {
+			if address, ok := val.(string); ok {
+				addresses = append(addresses, address)
+			}
+		}
+	case "ziti-tunneler-client.v1":
+		if hostname, ok := config.S("data", "hostname").Data().(string); ok {
+			addresses = append(addresses, hostname)
+		}
+	}
+
+	var result []string
+	for _, address := range addresses {
+		address = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(address)), ".")
+		if address == "" || net.ParseIP(address) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(address); err == nil {
+			continue
+		}
+		result = append(result, address)
+	}
+	return result
+}
+
+// check resolves the hostname through each resolver and classifies the answers
+func (self *dnsCheckCmd) check(result *dnsCheckResult) {
+	name := result.Hostname
+	if strings.HasPrefix(name, "*.") {
+		result.probeName = "ziti-dns-check-" + strings.ToLower(uuid.New()[:8]) + name[1:]
+		name = result.probeName
+	}
+
+	for _, resolver := range self.resolvers {
+		addrs, err := self.lookup(resolver, name)
+		if err != nil {
+			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+				result.Lookups[resolver] = nil
+			} else {
+				result.Errors[resolver] = err.Error()
+			}
+			continue
+		}
+		sort.Strings(addrs)
+		result.Lookups[resolver] = addrs
+	}
+
+	result.Status, result.Details = classifyDnsResult(result, self.dnsRange)
+}
+
+func (self *dnsCheckCmd) lookup(resolver, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), self.lookupLimit)
+	defer cancel()
+
+	if resolver == systemResolver {
+		return net.DefaultResolver.LookupHost(ctx, name)
+	}
+
+	server := resolver
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+	return r.LookupHost(ctx, name)
+}
+
+// classifyDnsResult decides whether the answers for an intercepted hostname conflict with the tunneler. Answers from
+// the tunneler's DNS IP range mean a tunneler on this host is already resolving the name, answers outside of it mean
+// the tunneler hides a real host, and resolvers disagreeing means the name depends on which DNS is asked
+func classifyDnsResult(result *dnsCheckResult, dnsRange *net.IPNet) (string, string) {
+	if len(result.Errors) > 0 && len(result.Lookups) == 0 {
+		var errs []string
+		for resolver, err := range result.Errors {
+			errs = append(errs, fmt.Sprintf("%v: %v", resolver, err))
+		}
+		sort.Strings(errs)
+		return dnsStatusError, strings.Join(errs, "; ")
+	}
+
+	var answers []string
+	var real []string
+	intercepted := false
+	for _, resolver := range sortedKeys(result.Lookups) {
+		addrs := result.Lookups[resolver]
+		answers = append(answers, strings.Join(addrs, ","))
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip != nil && dnsRange.Contains(ip) {
+				intercepted = true
+			} else if !stringz.Contains(real, addr) {
+				real = append(real, addr)
+			}
+		}
+	}
+
+	split := false
+	for _, answer := range answers {
+		if answer != answers[0] {
+			split = true
+		}
+	}
+
+	var details []string
+	if result.probeName != "" {
+		details = append(details, "checked as "+result.probeName)
+	}
+	if len(result.Services) > 1 {
+		details = append(details, fmt.Sprintf("intercepted by %v services", len(result.Services)))
+	}
+
+	switch {
+	case split && !intercepted:
+		details = append([]string{"resolvers disagree"}, details...)
+		return dnsStatusSplit, strings.Join(details, ", ")
+	case len(real) > 0:
+		details = append([]string{"real DNS resolves to " + strings.Join(real, ",")}, details...)
+		return dnsStatusShadowed, strings.Join(details, ", ")
+	case intercepted:
+		return dnsStatusIntercepted, strings.Join(details, ", ")
+	default:
+		return dnsStatusOk, strings.Join(details, ", ")
+	}
+}
+
+func (self *dnsCheckCmd) outputResults(results []*dnsCheckResult) {
+	if len(results) == 0 {
+		self.Printf("identity %v doesn't intercept any hostnames\n", self.Args[0])
+		return
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	header := table.Row{"Hostname", "Services"}
+	for _, resolver := range self.resolvers {
+		header = append(header, resolver)
+	}
+	header = append(header, "Status", "Details")
+	t.AppendHeader(header)
+
+	for _, result := range results {
+		row := table.Row{result.Hostname, strings.Join(result.Services, "\n")}
+		for _, resolver := range self.resolvers {
+			if err, found := result.Errors[resolver]; found {
+				row = append(row, "error: "+err)
+			} else if addrs := result.Lookups[resolver]; len(addrs) > 0 {
+				row = append(row, strings.Join(addrs, "\n"))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		row = append(row, result.Status, result.Details)
+		t.AppendRow(row)
+	}
+
+	api.RenderTable(&self.Options, t, nil)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,127 @@
+package ops
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHostnames(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "intercept.v1",
+			config:   `{"configType": {"name": "intercept.v1"}, "data": {"addresses": ["App.Example.com.", "10.0.0.1", "10.0.0.0/8", "*.corp.local", " ", "fd00::1"]}}`,
+			expected: []string{"app.example.com", "*.corp.local"},
+		},
+		{
+			name:     "ziti-tunneler-client.v1",
+			config:   `{"configType": {"name": "ziti-tunneler-client.v1"}, "data": {"hostname": "db.example.com", "port": 5432}}`,
+			expected: []string{"db.example.com"},
+		},
+		{
+			name:   "ziti-tunneler-client.v1 with an IP",
+			config: `{"configType": {"name": "ziti-tunneler-client.v1"}, "data": {"hostname": "192.168.1.10"}}`,
+		},
+		{
+			name:   "other config type",
+			config: `{"configType": {"name": "host.v1"}, "data": {"address": "app.example.com"}}`,
+		},
+		{
+			name:   "no data",
+			config: `{"configType": {"name": "intercept.v1"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := gabs.ParseJSON([]byte(test.config))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, configHostnames(config))
+		})
+	}
+}
+
+func TestClassifyDnsResult(t *testing.T) {
+	_, dnsRange, err := net.ParseCIDR("100.64.0.1/10")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		result   *dnsCheckResult
+		status   string
+		contains string
+	}{
+		{
+			name:   "not in DNS",
+			result: &dnsCheckResult{Lookups: map[string][]string{"system": nil}},
+			status: dnsStatusOk,
+		},
+		{
+			name:   "answered by the tunneler",
+			result: &dnsCheckResult{Lookups: map[string][]string{"system": {"100.64.0.3"}}},
+			status: dnsStatusIntercepted,
+		},
+		{
+			name:     "real host",
+			result:   &dnsCheckResult{Lookups: map[string][]string{"system": {"93.184.216.34"}}},
+			status:   dnsStatusShadowed,
+			contains: "real DNS resolves to 93.184.216.34",
+		},
+		{
+			name:     "real host behind the tunneler",
+			result:   &dnsCheckResult{Lookups: map[string][]string{"system": {"100.64.0.3"}, "8.8.8.8": {"93.184.216.34"}}},
+			status:   dnsStatusShadowed,
+			contains: "93.184.216.34",
+		},
+		{
+			name:     "resolvers disagree",
+			result:   &dnsCheckResult{Lookups: map[string][]string{"system": {"10.1.1.1"}, "8.8.8.8": nil}},
+			status:   dnsStatusSplit,
+			contains: "resolvers disagree",
+		},
+		{
+			name:     "all lookups failed",
+			result:   &dnsCheckResult{Lookups: map[string][]string{}, Errors: map[string]string{"8.8.8.8": "timeout", "system": "refused"}},
+			status:   dnsStatusError,
+			contains: "8.8.8.8: timeout; system: refused",
+		},
+		{
+			name:   "some lookups failed",
+			result: &dnsCheckResult{Lookups: map[string][]string{"system": nil}, Errors: map[string]string{"8.8.8.8": "timeout"}},
+			status: dnsStatusOk,
+		},
+		{
+			name:     "wildcard shared by services",
+			result:   &dnsCheckResult{Lookups: map[string][]string{"system": nil}, Services: []string{"a", "b"}, probeName: "ziti-dns-check-1234.corp.local"},
+			status:   dnsStatusOk,
+			contains: "checked as ziti-dns-check-1234.corp.local, intercepted by 2 services",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, details := classifyDnsResult(test.result, dnsRange)
+			require.Equal(t, test.status, status)
+			require.Contains(t, details, test.contains)
+		})
+	}
+}
+
+func TestDnsCheckQuotesConfigIds(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, map[string][]map[string]interface{}{
+		"identities/id1/services": {{"id": "svc1", "name": "app", "configs": []string{`cfg"1`}}},
+	})
+
+	cmd := &dnsCheckCmd{}
+	_, err := cmd.getInterceptedHostnames("id1")
+	req.NoError(err)
+	req.Contains(testController.Requested(), `GET configs?id in ["cfg\"1"] limit none`)
+}
@@ -0,0 +1,441 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	driftMissing = "missing"
+	driftChanged = "changed"
+	driftExtra   = "extra"
+)
+
+// driftManifest maps edge entity types, such as services or service-policies, to the entities expected to exist. Each
+// entity is identified by its name and lists the fields it's expected to have
+type driftManifest map[string][]map[string]interface{}
+
+// driftItem is a single difference between the manifest and the controller
+type driftItem struct {
+	EntityType string      `json:"entityType"`
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"`
+	Field      string      `json:"field,omitempty"`
+	Expected   interface{} `json:"expected,omitempty"`
+	Actual     interface{} `json:"actual,omitempty"`
+}
+
+// driftReport is the outcome of comparing the controller against the manifest, also sent to the webhook
+type driftReport struct {
+	CheckedAt time.Time    `json:"checkedAt"`
+	Manifest  string       `json:"manifest"`
+	Entities  int          `json:"entities"`
+	Drifted   bool         `json:"drifted"`
+	Items     []*driftItem `json:"items"`
+}
+
+type driftWatchCmd struct {
+	api.Options
+	manifestFile string
+	interval     time.Duration
+	once         bool
+	exitOnDrift  bool
+	reportExtra  bool
+	webhook      string
+	manifest     driftManifest
+}
+
+func newDriftWatchCmd(p common.OptionsProvider) *cobra.Command {
+	action := &driftWatchCmd{
+		Options: api.Options{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "drift-watch",
+		Short: "Periodically compare the controller against a declarative manifest and report drift",
+		Long: "Compares the entities on the controller against a YAML manifest every --interval and reports any " +
+			"differences, or drift. The manifest maps edge entity types to the entities expected to exist, each " +
+			"identified by its name and listing the fields it's expected to have. Fields not listed aren't compared. " +
+			"Lists are compared ignoring order, and role fields, such as serviceRoles, may refer to entities by name " +
+			"(@name) or attribute (#attribute).\n\n" +
+			"Drift is logged when it first appears, changes or is resolved, and with --webhook the report is also " +
+			"POSTed as JSON. With --once the comparison is made a single time and the command exits with code 5 if " +
+			"there is drift, as it does in watch mode with --exit-on-drift",
+		Example: `  # manifest.yaml
+  services:
+    - name: web
+      roleAttributes: [web]
+      encryptionRequired: true
+  service-policies:
+    - name: web-dial
+      type: Dial
+      serviceRoles: ["@web"]
+      identityRoles: ["#web-users"]
+
+  ziti ops drift-watch -f manifest.yaml --interval 5m --webhook https://hooks.example.com/ziti-drift
+  ziti ops drift-watch -f manifest.yaml --once --report-extra`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	action.AddCommonFlags(cmd)
+	cmd.Flags().StringVarP(&action.manifestFile, "file", "f", "", "YAML manifest of the expected entities")
+	cmd.Flags().DurationVar(&action.interval, "interval", 5*time.Minute, "How often to compare the controller against the manifest")
+	cmd.Flags().BoolVar(&action.once, "once", false, "Compare a single time and exit, with code 5 if there is drift")
+	cmd.Flags().BoolVar(&action.exitOnDrift, "exit-on-drift", false, "Exit with code 5 as soon as drift is found")
+	cmd.Flags().BoolVar(&action.reportExtra, "report-extra", false, "Also report entities of the manifest's types which aren't in the manifest")
+	cmd.Flags().StringVar(&action.webhook, "webhook", "", "URL to POST the drift report to, as JSON, whenever the drift changes")
+	_ = cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func (self *driftWatchCmd) run() error {
+	if self.interval <= 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --interval %v, must be greater than 0", self.interval)
+	}
+
+	manifest, err := loadDriftManifest(self.manifestFile)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	self.manifest = manifest
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	lastState := ""
+	for {
+		report, err := self.check()
+		if err != nil {
+			if self.once {
+				return err
+			}
+			self.Printf("%v unable to compare against the controller: %v\n", time.Now().Format(time.RFC3339), err)
+		} else {
+			state := driftState(report)
+			if state != lastState || self.Verbose {
+				self.printReport(report)
+			}
+			if state != lastState && self.webhook != "" && !(lastState == "" && !report.Drifted) {
+				if err := self.notify(report); err != nil {
+					self.Printf("unable to send drift report to webhook: %v\n", err)
+				}
+			}
+			lastState = state
+
+			if report.Drifted && (self.once || self.exitOnDrift) {
+				return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "controller has drifted from %v: %v differences", self.manifestFile, len(report.Items))
+			}
+		}
+
+		if self.once {
+			return nil
+		}
+
+		select {
+		case <-interrupted:
+			return nil
+		case <-time.After(self.interval):
+		}
+	}
+}
+
+// check compares the controller against the manifest
+func (self *driftWatchCmd) check() (*driftReport, error) {
+	report := &driftReport{
+		CheckedAt: time.Now(),
+		Manifest:  self.manifestFile,
+	}
+
+	var entityTypes []string
+	for entityType := range self.manifest {
+		entityTypes = append(entityTypes, entityType)
+	}
+	sort.Strings(entityTypes)
+
+	for _, entityType := range entityTypes {
+		params := url.Values{}
+		params.Add("filter", "true limit none")
+		children, _, err := api.ListEntitiesOfType(util.EdgeAPI, entityType, params, false, self.Out, self.Timeout, self.Verbose)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list %v", entityType)
+		}
+
+		live := map[string]*gabs.Container{}
+		for _, child := range children {
+			live[api.GetJsonString(child, "name")] = child
+		}
+
+		expectedNames := map[string]bool{}
+		for _, expected := range self.manifest[entityType] {
+			name := fmt.Sprintf("%v", expected["name"])
+			expectedNames[name] = true
+			report.Entities++
+
+			entity, found := live[name]
+			if !found {
+				report.Items = append(report.Items, &driftItem{EntityType: entityType, Name: name, Kind: driftMissing})
+				continue
+			}
+			report.Items = append(report.Items, compareDriftEntity(entityType, name, expected, entity)...)
+		}
+
+		if self.reportExtra {
+			var extra []string
+			for name := range live {
+				if !expectedNames[name] {
+					extra = append(extra, name)
+				}
+			}
+			sort.Strings(extra)
+			for _, name := range extra {
+				report.Items = append(report.Items, &driftItem{EntityType: entityType, Name: name, Kind: driftExtra})
+			}
+		}
+	}
+
+	report.Drifted = len(report.Items) > 0
+	return report, nil
+}
+
+func (self *driftWatchCmd) printReport(report *driftReport) {
+	timestamp := report.CheckedAt.Format(time.RFC3339)
+	if !report.Drifted {
+		self.Printf("%v no drift, the controller matches the %v entities in %v\n", timestamp, report.Entities, report.Manifest)
+		return
+	}
+
+	self.Printf("%v drift detected, %v differences from %v\n", timestamp, len(report.Items), report.Manifest)
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Type", "Name", "Drift", "Field", "Expected", "Actual"})
+	for _, item := range report.Items {
+		expected, actual := "", ""
+		if item.Kind == driftChanged {
+			expected, actual = formatDriftValue(item.Expected), formatDriftValue(item.Actual)
+		}
+		t.AppendRow(table.Row{item.EntityType, item.Name, item.Kind, item.Field, expected, actual})
+	}
+	api.RenderTable(&self.Options, t, nil)
+}
+
+// notify POSTs the report to the webhook
+func (self *driftWatchCmd) notify(report *driftReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: time.Duration(self.Timeout) * time.Second}
+	resp, err := client.Post(self.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
+
+// loadDriftManifest reads and validates a manifest, converting it to the types JSON decoding produces so it can be
+// compared with the controller's responses
+func loadDriftManifest(path string) (driftManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read manifest %v", path)
+	}
+
+	raw := map[string][]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse manifest %v", path)
+	}
+
+	result := driftManifest{}
+	for entityType, entities := range raw {
+		names := map[string]bool{}
+		for idx, val := range entities {
+			normalized, err := normalizeDriftValue(val)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %v[%v] in manifest %v", entityType, idx, path)
+			}
+			entity, ok := normalized.(map[string]interface{})
+			if !ok {
+				return nil, errors.Errorf("%v[%v] in manifest %v must be a map of fields", entityType, idx, path)
+			}
+			name, ok := entity["name"].(string)
+			if !ok || name == "" {
+				return nil, errors.Errorf("%v[%v] in manifest %v has no name", entityType, idx, path)
+			}
+			if names[name] {
+				return nil, errors.Errorf("%v %v is in manifest %v more than once", entityType, name, path)
+			}
+			names[name] = true
+			result[entityType] = append(result[entityType], entity)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, errors.Errorf("manifest %v contains no entities", path)
+	}
+	return result, nil
+}
+
+// normalizeDriftValue converts YAML values to the types JSON decoding produces, e.g. string keyed maps and float64
+// numbers
+func normalizeDriftValue(val interface{}) (interface{}, error) {
+	var convert func(val interface{}) interface{}
+	convert = func(val interface{}) interface{} {
+		switch v := val.(type) {
+		case map[interface{}]interface{}:
+			result := map[string]interface{}{}
+			for k, child := range v {
+				result[fmt.Sprintf("%v", k)] = convert(child)
+			}
+			return result
+		case []interface{}:
+			result := make([]interface{}, len(v))
+			for i, child := range v {
+				result[i] = convert(child)
+			}
+			return result
+		}
+		return val
+	}
+
+	data, err := json.Marshal(convert(val))
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// compareDriftEntity compares the fields listed in the manifest with those of the entity on the controller
+func compareDriftEntity(entityType, name string, expected map[string]interface{}, entity *gabs.Container) []*driftItem {
+	var fields []string
+	for field := range expected {
+		if field != "name" {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var result []*driftItem
+	for _, field := range fields {
+		actual := entity.Path(field).Data()
+
+		// roles are returned as ids, with the names given in the matching display field
+		if display, err := entity.Path(field + "Display").Children(); err == nil && strings.HasSuffix(field, "Roles") {
+			var names []interface{}
+			for _, role := range display {
+				names = append(names, role.Path("name").Data())
+			}
+			actual = names
+		}
+
+		if !driftValuesEqual(expected[field], actual) {
+			result = append(result, &driftItem{
+				EntityType: entityType,
+				Name:       name,
+				Kind:       driftChanged,
+				Field:      field,
+				Expected:   expected[field],
+				Actual:     actual,
+			})
+		}
+	}
+	return result
+}
+
+// driftValuesEqual compares values as decoded from JSON, ignoring the order of lists
+func driftValuesEqual(expected, actual interface{}) bool {
+	if expectedList, ok := expected.([]interface{}); ok {
+		actualList, ok := actual.([]interface{})
+		if !ok && actual != nil {
+			return false
+		}
+		if len(expectedList) != len(actualList) {
+			return false
+		}
+		return reflect.DeepEqual(sortedDriftStrings(expectedList), sortedDriftStrings(actualList))
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+func sortedDriftStrings(list []interface{}) []string {
+	result := make([]string, len(list))
+	for i, val := range list {
+		result[i] = formatDriftValue(val)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func formatDriftValue(val interface{}) string {
+	if val == nil {
+		return "<none>"
+	}
+	if s, ok := val.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(data)
+}
+
+// driftState summarizes a report, so it's only logged and sent when the drift changes
+func driftState(report *driftReport) string {
+	data, _ := json.Marshal(report.Items)
+	return string(data)
+}
@@ -0,0 +1,160 @@
+package ops
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestManifest(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadDriftManifest(t *testing.T) {
+	req := require.New(t)
+
+	manifest, err := loadDriftManifest(writeTestManifest(t, `
+services:
+  - name: web
+    roleAttributes: [web, public]
+    encryptionRequired: true
+    maxIdleTimeMillis: 30000
+    tags:
+      owner: ops
+service-policies:
+  - name: web-dial
+    serviceRoles: ["@web"]
+`))
+	req.NoError(err)
+	req.Equal(driftManifest{
+		"services": {{
+			"name":               "web",
+			"roleAttributes":     []interface{}{"web", "public"},
+			"encryptionRequired": true,
+			"maxIdleTimeMillis":  float64(30000),
+			"tags":               map[string]interface{}{"owner": "ops"},
+		}},
+		"service-policies": {{"name": "web-dial", "serviceRoles": []interface{}{"@web"}}},
+	}, manifest)
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "not yaml", content: "services: [", err: "unable to parse manifest"},
+		{name: "no entities", content: "services: []", err: "contains no entities"},
+		{name: "entity not a map", content: "services: [web]", err: "must be a map of fields"},
+		{name: "no name", content: "services: [{roleAttributes: [web]}]", err: "has no name"},
+		{name: "duplicate name", content: "services: [{name: web}, {name: web}]", err: "more than once"},
+	}
+	for _, test := range tests {
+		_, err := loadDriftManifest(writeTestManifest(t, test.content))
+		req.Error(err, test.name)
+		req.Contains(err.Error(), test.err, test.name)
+	}
+
+	_, err = loadDriftManifest(filepath.Join(t.TempDir(), "missing.yaml"))
+	req.Error(err)
+	req.Contains(err.Error(), "unable to read manifest")
+}
+
+func TestNormalizeDriftValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      interface{}
+		expected interface{}
+	}{
+		{name: "int", val: 5, expected: float64(5)},
+		{name: "string", val: "web", expected: "web"},
+		{name: "nil", val: nil, expected: nil},
+		{
+			name:     "yaml map",
+			val:      map[interface{}]interface{}{"a": 1, 2: []interface{}{map[interface{}]interface{}{"b": true}}},
+			expected: map[string]interface{}{"a": float64(1), "2": []interface{}{map[string]interface{}{"b": true}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := normalizeDriftValue(test.val)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, result)
+		})
+	}
+
+	_, err := normalizeDriftValue(map[interface{}]interface{}{"f": func() {}})
+	require.Error(t, err)
+}
+
+func TestDriftValuesEqual(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected interface{}
+		actual   interface{}
+		equal    bool
+	}{
+		{name: "same string", expected: "web", actual: "web", equal: true},
+		{name: "different string", expected: "web", actual: "api"},
+		{name: "number", expected: float64(1), actual: float64(1), equal: true},
+		{name: "list in other order", expected: []interface{}{"a", "b"}, actual: []interface{}{"b", "a"}, equal: true},
+		{name: "list with other items", expected: []interface{}{"a", "b"}, actual: []interface{}{"a", "c"}},
+		{name: "list with more items", expected: []interface{}{"a"}, actual: []interface{}{"a", "a"}},
+		{name: "empty list and no list", expected: []interface{}{}, actual: nil, equal: true},
+		{name: "list and string", expected: []interface{}{"a"}, actual: "a"},
+		{name: "missing field", expected: true, actual: nil},
+		{
+			name:     "maps",
+			expected: map[string]interface{}{"owner": "ops"},
+			actual:   map[string]interface{}{"owner": "ops"},
+			equal:    true,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.equal, driftValuesEqual(test.expected, test.actual), test.name)
+	}
+}
+
+func TestCompareDriftEntity(t *testing.T) {
+	req := require.New(t)
+
+	entity, err := gabs.ParseJSON([]byte(`{
+		"id": "p1",
+		"name": "web-dial",
+		"type": "Dial",
+		"semantic": "AnyOf",
+		"serviceRoles": ["@svc-id-1"],
+		"serviceRolesDisplay": [{"role": "@svc-id-1", "name": "@web"}],
+		"identityRoles": ["#web-users", "#admins"],
+		"identityRolesDisplay": [{"role": "#web-users", "name": "#web-users"}, {"role": "#admins", "name": "#admins"}]
+	}`))
+	req.NoError(err)
+
+	items := compareDriftEntity("service-policies", "web-dial", map[string]interface{}{
+		"name":          "web-dial",
+		"type":          "Dial",
+		"serviceRoles":  []interface{}{"@web"},
+		"identityRoles": []interface{}{"#admins", "#web-users"},
+	}, entity)
+	req.Empty(items)
+
+	items = compareDriftEntity("service-policies", "web-dial", map[string]interface{}{
+		"name":          "web-dial",
+		"type":          "Bind",
+		"serviceRoles":  []interface{}{"@api"},
+		"postureChecks": []interface{}{"#mfa"},
+	}, entity)
+	req.Len(items, 3)
+	req.Equal(&driftItem{EntityType: "service-policies", Name: "web-dial", Kind: driftChanged, Field: "postureChecks",
+		Expected: []interface{}{"#mfa"}}, items[0])
+	req.Equal(&driftItem{EntityType: "service-policies", Name: "web-dial", Kind: driftChanged, Field: "serviceRoles",
+		Expected: []interface{}{"@api"}, Actual: []interface{}{"@web"}}, items[1])
+	req.Equal(&driftItem{EntityType: "service-policies", Name: "web-dial", Kind: driftChanged, Field: "type",
+		Expected: "Bind", Actual: "Dial"}, items[2])
+}
@@ -0,0 +1,318 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/michaelquigley/pfxlog"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var validEnrollmentName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+type enrollmentServerCmd struct {
+	api.Options
+	bind           string
+	certFile       string
+	keyFile        string
+	insecure       bool
+	clientCaFile   string
+	tokens         []string
+	tokenFile      string
+	namePrefix     string
+	roleAttributes []string
+	issuanceLog    string
+
+	logLock sync.Mutex
+}
+
+func newEnrollmentServerCmd(p common.OptionsProvider) *cobra.Command {
+	action := &enrollmentServerCmd{Options: api.Options{CommonOptions: p()}}
+
+	cmd := &cobra.Command{
+		Use:   "enrollment-server",
+		Short: "Runs an HTTP service which creates identities and hands out their enrollment JWTs to authenticated clients",
+		Long: "Runs an HTTP service which creates identities and hands out their enrollment JWTs to authenticated clients. " +
+			"Intended for provisioning lines and kiosks which can't run the full CLI. Clients authenticate with a bearer token " +
+			"or a client certificate signed by --client-ca, and POST to /enrollments, optionally with a JSON body of " +
+			"{\"name\": \"<identity name>\"}. Every issued JWT is recorded in the issuance log before it's handed out, if " +
+			"it can't be recorded the identity is deleted again and the request fails. Identities are created using the " +
+			"current CLI login. The server requires --cert and --key, unless plain HTTP is explicitly allowed with --insecure.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&action.bind, "bind", "0.0.0.0:8443", "Address to listen on")
+	cmd.Flags().StringVar(&action.certFile, "cert", "", "Server certificate")
+	cmd.Flags().StringVar(&action.keyFile, "key", "", "Server private key")
+	cmd.Flags().BoolVar(&action.insecure, "insecure", false, "Serve plain HTTP when no --cert and --key are given. Enrollment JWTs and tokens will be sent unencrypted")
+	cmd.Flags().StringVar(&action.clientCaFile, "client-ca", "", "CA bundle used to verify client certificates. Clients presenting a valid certificate are authorized")
+	cmd.Flags().StringSliceVar(&action.tokens, "token", nil, "Bearer token which authorizes clients")
+	cmd.Flags().StringVar(&action.tokenFile, "token-file", "", "File containing bearer tokens which authorize clients, one per line")
+	cmd.Flags().StringVar(&action.namePrefix, "name-prefix", "enrolled-", "Prefix for the names of created identities")
+	cmd.Flags().StringSliceVar(&action.roleAttributes, "role-attributes", nil, "Role attributes to assign to created identities")
+	cmd.Flags().StringVar(&action.issuanceLog, "issuance-log", "enrollment-issuance.log", "File to which issued enrollments are appended, as JSON lines")
+	action.AddCommonFlags(cmd)
+
+	return cmd
+}
+
+// enrollmentIssuance is recorded in the issuance log for every JWT handed out
+type enrollmentIssuance struct {
+	IssuedAt     time.Time `json:"issuedAt"`
+	Requester    string    `json:"requester"`
+	RemoteAddr   string    `json:"remoteAddr"`
+	IdentityId   string    `json:"identityId"`
+	IdentityName string    `json:"identityName"`
+	ExpiresAt    string    `json:"expiresAt,omitempty"`
+}
+
+func (self *enrollmentServerCmd) run() error {
+	log := pfxlog.Logger()
+
+	if self.tokenFile != "" {
+		data, err := ioutil.ReadFile(self.tokenFile)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read token file %v", self.tokenFile)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if token := strings.TrimSpace(line); token != "" && !strings.HasPrefix(token, "#") {
+				self.tokens = append(self.tokens, token)
+			}
+		}
+	}
+
+	if len(self.tokens) == 0 && self.clientCaFile == "" {
+		return errors.New("no authentication configured. Specify --token, --token-file and/or --client-ca")
+	}
+
+	if (self.certFile == "") != (self.keyFile == "") {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--cert and --key must be given together")
+	}
+
+	if self.certFile == "" && !self.insecure {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--cert and --key are required, use --insecure to serve plain HTTP")
+	}
+
+	if self.clientCaFile != "" && self.certFile == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--client-ca requires --cert and --key, client certificates can only be used with TLS")
+	}
+
+	// fail fast if there's no usable login, rather than on the first request
+	if _, err := util.LoadSelectedRWIdentityForApi(util.EdgeAPI); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/enrollments", self.handleEnrollment)
+
+	server := &http.Server{
+		Addr:              self.bind,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if self.certFile == "" {
+		log.Warnf("--insecure given, serving plain HTTP on %v. Enrollment JWTs and tokens will be sent unencrypted", self.bind)
+		return server.ListenAndServe()
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if self.clientCaFile != "" {
+		pemData, err := ioutil.ReadFile(self.clientCaFile)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read client CA file %v", self.clientCaFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return errors.Errorf("no certificates found in client CA file %v", self.clientCaFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	server.TLSConfig = tlsConfig
+
+	log.Infof("serving enrollments on https://%v/enrollments", self.bind)
+	return server.ListenAndServeTLS(self.certFile, self.keyFile)
+}
+
+// authorize returns a description of the authenticated requester, or false if the request isn't authorized
+func (self *enrollmentServerCmd) authorize(r *http.Request) (string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	presented := []byte(strings.TrimPrefix(auth, "Bearer "))
+	for idx, token := range self.tokens {
+		if subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+			return fmt.Sprintf("token:%v", idx+1), true
+		}
+	}
+	return "", false
+}
+
+func (self *enrollmentServerCmd) handleEnrollment(w http.ResponseWriter, r *http.Request) {
+	log := pfxlog.Logger().WithField("remoteAddr", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requester, ok := self.authorize(r)
+	if !ok {
+		log.Warn("rejected unauthorized enrollment request")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := struct {
+		Name string `json:"name"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	name := request.Name
+	if name == "" {
+		name = uuid.New()
+	}
+	if !validEnrollmentName.MatchString(name) {
+		http.Error(w, "invalid name, must be 1-64 characters of letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	name = self.namePrefix + name
+
+	issuance, jwt, err := self.createIdentity(name)
+	if err != nil {
+		log.WithError(err).Errorf("unable to create identity %v", name)
+		http.Error(w, "unable to create identity", http.StatusBadGateway)
+		return
+	}
+
+	issuance.Requester = requester
+	issuance.RemoteAddr = r.RemoteAddr
+	if err = self.recordIssuance(issuance); err != nil {
+		// an enrollment is only handed out once it's recorded, so the identity is deleted again rather than left unaccounted for
+		log.WithError(err).Errorf("unable to record issuance, deleting identity %v (%v)", issuance.IdentityName, issuance.IdentityId)
+		if err = util.ControllerDelete(util.EdgeAPI, "identities", issuance.IdentityId, "", self.Out, false, false, self.Timeout, self.Verbose); err != nil {
+			log.WithError(err).Errorf("unable to delete unrecorded identity %v (%v)", issuance.IdentityName, issuance.IdentityId)
+		}
+		http.Error(w, "unable to record issuance", http.StatusInternalServerError)
+		return
+	}
+
+	log.Infof("issued enrollment for identity %v (%v) to %v", issuance.IdentityName, issuance.IdentityId, requester)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"id":        issuance.IdentityId,
+		"name":      issuance.IdentityName,
+		"jwt":       jwt,
+		"expiresAt": issuance.ExpiresAt,
+	})
+}
+
+func (self *enrollmentServerCmd) createIdentity(name string) (*enrollmentIssuance, string, error) {
+	entityData := gabs.New()
+	api.SetJSONValue(entityData, name, "name")
+	api.SetJSONValue(entityData, "Device", "type")
+	api.SetJSONValue(entityData, false, "isAdmin")
+	api.SetJSONValue(entityData, true, "enrollment", "ott")
+	if len(self.roleAttributes) > 0 {
+		api.SetJSONValue(entityData, self.roleAttributes, "roleAttributes")
+	}
+
+	result, err := util.ControllerCreate(util.EdgeAPI, "identities", entityData.String(), self.Out, false, false, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, _ := result.S("data", "id").Data().(string)
+	detail, err := util.ControllerDetailEntity(util.EdgeAPI, "identities", id, false, self.Out, self.Timeout, self.Verbose)
+	if err != nil {
+		return nil, "", err
+	}
+
+	jwt, _ := detail.Path("data.enrollment.ott.jwt").Data().(string)
+	if jwt == "" {
+		return nil, "", errors.Errorf("enrollment JWT not present for new identity %v", id)
+	}
+
+	issuance := &enrollmentIssuance{
+		IssuedAt:     time.Now(),
+		IdentityId:   id,
+		IdentityName: name,
+	}
+	if expiresAt := detail.Path("data.enrollment.ott.expiresAt").Data(); expiresAt != nil {
+		issuance.ExpiresAt = fmt.Sprintf("%v", expiresAt)
+	}
+	return issuance, jwt, nil
+}
+
+func (self *enrollmentServerCmd) recordIssuance(issuance *enrollmentIssuance) error {
+	data, err := json.Marshal(issuance)
+	if err != nil {
+		return err
+	}
+
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+
+	f, err := os.OpenFile(self.issuanceLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
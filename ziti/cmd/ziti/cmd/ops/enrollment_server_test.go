@@ -0,0 +1,167 @@
+package ops
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEnrollmentServer(t *testing.T) *enrollmentServerCmd {
+	return &enrollmentServerCmd{
+		Options:     api.Options{CommonOptions: common.CommonOptions{Out: &bytes.Buffer{}}},
+		tokens:      []string{"first", "second"},
+		namePrefix:  "enrolled-",
+		issuanceLog: filepath.Join(t.TempDir(), "issuance.log"),
+	}
+}
+
+func TestEnrollmentServerAuthorize(t *testing.T) {
+	server := newTestEnrollmentServer(t)
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "kiosk-1"}}}}}
+
+	tests := []struct {
+		name      string
+		auth      string
+		tls       *tls.ConnectionState
+		requester string
+		ok        bool
+	}{
+		{name: "first token", auth: "Bearer first", requester: "token:1", ok: true},
+		{name: "second token", auth: "Bearer second", requester: "token:2", ok: true},
+		{name: "unknown token", auth: "Bearer third"},
+		{name: "token prefix", auth: "Bearer firs"},
+		{name: "not a bearer token", auth: "Basic first"},
+		{name: "no credentials"},
+		{name: "verified client certificate", tls: verified, requester: "cert:kiosk-1", ok: true},
+		{name: "unverified client certificate", tls: &tls.ConnectionState{}},
+		{name: "unverified client certificate with token", tls: &tls.ConnectionState{}, auth: "Bearer first", requester: "token:1", ok: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/enrollments", nil)
+			r.TLS = test.tls
+			if test.auth != "" {
+				r.Header.Set("Authorization", test.auth)
+			}
+			requester, ok := server.authorize(r)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.requester, requester)
+		})
+	}
+}
+
+func TestEnrollmentServerHandleEnrollment(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, nil)
+	testController.Created = func(entityType string, entity map[string]interface{}) {
+		entity["enrollment"] = map[string]interface{}{
+			"ott": map[string]interface{}{"jwt": "jwt-for-" + entity["name"].(string), "expiresAt": "2030-01-01T00:00:00Z"},
+		}
+	}
+
+	server := newTestEnrollmentServer(t)
+	enroll := func(method, auth, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/enrollments", strings.NewReader(body))
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		server.handleEnrollment(w, r)
+		return w
+	}
+
+	req.Equal(http.StatusMethodNotAllowed, enroll(http.MethodGet, "Bearer first", "").Code)
+	req.Equal(http.StatusUnauthorized, enroll(http.MethodPost, "Bearer wrong", "").Code)
+	req.Equal(http.StatusBadRequest, enroll(http.MethodPost, "Bearer first", `{"name": "../kiosk"}`).Code)
+	req.Equal(http.StatusBadRequest, enroll(http.MethodPost, "Bearer first", `{"name":`).Code)
+	req.Empty(testController.List("identities"))
+
+	w := enroll(http.MethodPost, "Bearer second", `{"name": "kiosk-1"}`)
+	req.Equal(http.StatusCreated, w.Code, w.Body.String())
+
+	response := map[string]string{}
+	req.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	req.Equal("enrolled-kiosk-1", response["name"])
+	req.Equal("jwt-for-enrolled-kiosk-1", response["jwt"])
+	req.Equal("2030-01-01T00:00:00Z", response["expiresAt"])
+
+	identities := testController.List("identities")
+	req.Len(identities, 1)
+	req.Equal(response["id"], identities[0]["id"])
+	req.Equal("enrolled-kiosk-1", identities[0]["name"])
+
+	data, err := ioutil.ReadFile(server.issuanceLog)
+	req.NoError(err)
+	issuance := &enrollmentIssuance{}
+	req.NoError(json.Unmarshal(data, issuance))
+	req.Equal(response["id"], issuance.IdentityId)
+	req.Equal("enrolled-kiosk-1", issuance.IdentityName)
+	req.Equal("token:2", issuance.Requester)
+
+	// without a name, one is generated
+	w = enroll(http.MethodPost, "Bearer first", "")
+	req.Equal(http.StatusCreated, w.Code, w.Body.String())
+	req.NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	req.True(strings.HasPrefix(response["name"], "enrolled-"))
+	req.Len(testController.List("identities"), 2)
+}
+
+func TestEnrollmentServerDeletesUnrecordedIdentities(t *testing.T) {
+	req := require.New(t)
+
+	testController.Reset(t, nil)
+	testController.Created = func(entityType string, entity map[string]interface{}) {
+		entity["enrollment"] = map[string]interface{}{"ott": map[string]interface{}{"jwt": "jwt"}}
+	}
+
+	server := newTestEnrollmentServer(t)
+	server.issuanceLog = filepath.Join(t.TempDir(), "missing", "issuance.log")
+
+	r := httptest.NewRequest(http.MethodPost, "/enrollments", strings.NewReader(`{"name": "kiosk-1"}`))
+	r.Header.Set("Authorization", "Bearer first")
+	w := httptest.NewRecorder()
+	server.handleEnrollment(w, r)
+
+	req.Equal(http.StatusInternalServerError, w.Code)
+	req.NotContains(w.Body.String(), "jwt")
+	req.Empty(testController.List("identities"))
+	req.Contains(testController.Requested(), "DELETE identities/identities-1")
+}
+
+func TestEnrollmentServerRequiresTls(t *testing.T) {
+	req := require.New(t)
+
+	server := newTestEnrollmentServer(t)
+	err := server.run()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+	req.Contains(err.Error(), "--insecure")
+
+	server.certFile = "server.cert"
+	err = server.run()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+
+	server.certFile = ""
+	server.insecure = true
+	server.clientCaFile = "ca.cert"
+	err = server.run()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
@@ -0,0 +1,202 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+func newEventsCmd(p common.OptionsProvider) *cobra.Command {
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "Record controller events to a file and replay and analyze them offline",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	eventsCmd.AddCommand(newEventsRecordCmd(p))
+	eventsCmd.AddCommand(newEventsReplayCmd(p))
+	return eventsCmd
+}
+
+// recordedEvent is a single event, as written by the controller's json event logger or by 'ops events record'
+type recordedEvent struct {
+	Fields    map[string]interface{}
+	Timestamp time.Time
+}
+
+func (self *recordedEvent) Namespace() string {
+	return self.String("namespace")
+}
+
+// EventType returns the type of the event. Metrics events don't have an event type, so the metric type or name is
+// used instead
+func (self *recordedEvent) EventType() string {
+	for _, field := range []string{"event_type", "eventType", "metric_type", "metric"} {
+		if val := self.String(field); val != "" {
+			return val
+		}
+	}
+	return "-"
+}
+
+// String returns the value of the field with the given dotted path, formatted as a string
+func (self *recordedEvent) String(path string) string {
+	val, found := self.Lookup(path)
+	if !found || val == nil {
+		return ""
+	}
+	switch v := val.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// Lookup returns the value of the field with the given dotted path, such as 'tags.host'
+func (self *recordedEvent) Lookup(path string) (interface{}, bool) {
+	var current interface{} = self.Fields
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// eventTimestamp extracts the time of the event, which is given as an RFC3339 string for most events, as a protobuf
+// timestamp for metrics events and as the start of the interval for usage events
+func eventTimestamp(fields map[string]interface{}) (time.Time, bool) {
+	switch v := fields["timestamp"].(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+	case map[string]interface{}:
+		seconds, _ := jsonInt(v["seconds"])
+		nanos, _ := jsonInt(v["nanos"])
+		if seconds != 0 || nanos != 0 {
+			return time.Unix(seconds, nanos), true
+		}
+	case json.Number:
+		if seconds, ok := jsonInt(v); ok {
+			return time.Unix(seconds, 0), true
+		}
+	}
+	if seconds, ok := jsonInt(fields["interval_start_utc"]); ok {
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
+
+// jsonInt returns the value of a json number, which protobuf json encodes as a string for 64 bit values
+func jsonInt(val interface{}) (int64, bool) {
+	var str string
+	switch v := val.(type) {
+	case json.Number:
+		str = v.String()
+	case string:
+		str = v
+	default:
+		return 0, false
+	}
+	result, err := strconv.ParseInt(str, 10, 64)
+	return result, err == nil
+}
+
+// readEvents reads the json lines event files and returns the events ordered by time. Lines which aren't json objects,
+// such as log output mixed into the file, are skipped and counted
+func readEvents(files []string, stdin io.Reader) ([]*recordedEvent, int, error) {
+	var events []*recordedEvent
+	skipped := 0
+
+	for _, file := range files {
+		fileEvents, fileSkipped, err := readEventFile(file, stdin)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, fileEvents...)
+		skipped += fileSkipped
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	return events, skipped, nil
+}
+
+// readEventFile reads the events of a single file, or of stdin if the file is '-'
+func readEventFile(file string, stdin io.Reader) ([]*recordedEvent, int, error) {
+	reader := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, 0, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		defer func() { _ = f.Close() }()
+		reader = f
+	}
+
+	var events []*recordedEvent
+	skipped := 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := map[string]interface{}{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			skipped++
+			continue
+		}
+		timestamp, _ := eventTimestamp(fields)
+		events = append(events, &recordedEvent{
+			Fields:    fields,
+			Timestamp: timestamp,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed reading %v: %w", file, err)
+	}
+	return events, skipped, nil
+}
@@ -0,0 +1,233 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/openziti/channel"
+	"github.com/openziti/fabric/pb/mgmt_pb"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/fabric"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	eventStreamCircuits = "circuits"
+	eventStreamMetrics  = "metrics"
+)
+
+var eventStreams = []string{eventStreamCircuits, eventStreamMetrics}
+
+type eventsRecordCmd struct {
+	api.Options
+	streams  []string
+	duration time.Duration
+	append   bool
+
+	lock   sync.Mutex
+	output io.Writer
+	count  int
+	err    error
+}
+
+func newEventsRecordCmd(p common.OptionsProvider) *cobra.Command {
+	action := &eventsRecordCmd{
+		Options: api.Options{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "record <file>",
+		Short: "Record controller event streams to a json lines file",
+		Long: "Records the circuit and metrics event streams of the controller to a file, one json event per line, until " +
+			"interrupted or the duration has passed. Events are written in the same form as the controller's json file " +
+			"event logger, so files written by either can be replayed with 'ziti ops events replay'. Use '-' to write to stdout.",
+		Example: `  ziti ops events record incident.jsonl --duration 30m`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	action.AddCommonFlags(cmd)
+	cmd.Flags().StringSliceVar(&action.streams, "streams", eventStreams, "Event streams to record ("+strings.Join(eventStreams, ", ")+")")
+	cmd.Flags().DurationVar(&action.duration, "duration", 0, "Stop recording after this long. 0 records until interrupted")
+	cmd.Flags().BoolVar(&action.append, "append", false, "Append to the file instead of replacing it")
+
+	return cmd
+}
+
+func (self *eventsRecordCmd) run() error {
+	if len(self.streams) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "at least one stream must be given")
+	}
+	for _, stream := range self.streams {
+		if !stringz.Contains(eventStreams, stream) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "unknown stream %v, must be one of %v", stream, strings.Join(eventStreams, ", "))
+		}
+	}
+
+	if self.Args[0] == "-" {
+		self.output = self.Out
+	} else {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if self.append {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(self.Args[0], flags, 0644)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		self.output = f
+	}
+
+	closeNotify := make(chan struct{})
+	bindHandler := func(binding channel.Binding) error {
+		binding.AddReceiveHandlerF(int32(mgmt_pb.ContentType_StreamCircuitsEventType), self.handleCircuitEvent)
+		binding.AddReceiveHandlerF(int32(mgmt_pb.ContentType_StreamMetricsEventType), self.handleMetricsEvent)
+		binding.AddCloseHandler(channel.CloseHandlerF(func(ch channel.Channel) {
+			close(closeNotify)
+		}))
+		return nil
+	}
+
+	ch, err := api.NewWsMgmtChannel(channel.BindHandlerF(bindHandler))
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, err)
+	}
+	defer func() { _ = ch.Close() }()
+
+	timeout := time.Duration(self.Timeout) * time.Second
+	if stringz.Contains(self.streams, eventStreamCircuits) {
+		requestMsg := channel.NewMessage(int32(mgmt_pb.ContentType_StreamCircuitsRequestType), nil)
+		if err = requestMsg.WithTimeout(timeout).SendAndWaitForWire(ch); err != nil {
+			return errors.Wrap(err, "failed to request circuit events")
+		}
+	}
+	if stringz.Contains(self.streams, eventStreamMetrics) {
+		body, err := proto.Marshal(&mgmt_pb.StreamMetricsRequest{})
+		if err != nil {
+			return err
+		}
+		requestMsg := channel.NewMessage(int32(mgmt_pb.ContentType_StreamMetricsRequestType), body)
+		if err = requestMsg.WithTimeout(timeout).SendAndWaitForWire(ch); err != nil {
+			return errors.Wrap(err, "failed to request metrics events")
+		}
+	}
+
+	var done <-chan time.Time
+	if self.duration > 0 {
+		done = time.After(self.duration)
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	select {
+	case <-done:
+	case <-interrupted:
+	case <-closeNotify:
+		err = errors.New("connection to the controller was closed")
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.Args[0] != "-" {
+		self.Printf("recorded %v events to %v\n", self.count, self.Args[0])
+	}
+	if self.err != nil {
+		return self.err
+	}
+	return err
+}
+
+func (self *eventsRecordCmd) write(event map[string]interface{}) {
+	data, err := json.Marshal(event)
+	if err == nil {
+		data = append(data, '\n')
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err == nil {
+		_, err = self.output.Write(data)
+	}
+	if err != nil && self.err == nil {
+		self.err = err
+	}
+	self.count++
+}
+
+func (self *eventsRecordCmd) handleCircuitEvent(msg *channel.Message, _ channel.Channel) {
+	event := &mgmt_pb.StreamCircuitsEvent{}
+	if err := proto.Unmarshal(msg.Body, event); err != nil {
+		self.Printf("failed to unmarshal circuit event: %v\n", err)
+		return
+	}
+
+	self.write(fabric.CircuitEventFields(event))
+}
+
+func (self *eventsRecordCmd) handleMetricsEvent(msg *channel.Message, _ channel.Channel) {
+	event := &mgmt_pb.StreamMetricsEvent{}
+	if err := proto.Unmarshal(msg.Body, event); err != nil {
+		self.Printf("failed to unmarshal metrics event: %v\n", err)
+		return
+	}
+
+	metrics := map[string]interface{}{}
+	for name, value := range event.IntMetrics {
+		metrics[name] = value
+	}
+	for name, value := range event.FloatMetrics {
+		metrics[name] = value
+	}
+
+	timestamp := time.Now()
+	if event.Timestamp != nil {
+		timestamp = event.Timestamp.AsTime()
+	}
+
+	fields := map[string]interface{}{
+		"namespace": "metrics",
+		"source_id": event.SourceId,
+		"timestamp": timestamp.UTC().Format(time.RFC3339Nano),
+		"metrics":   metrics,
+	}
+	if len(event.Tags) > 0 {
+		fields["tags"] = event.Tags
+	}
+	self.write(fields)
+}
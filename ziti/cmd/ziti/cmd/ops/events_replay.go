@@ -0,0 +1,347 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+)
+
+type eventsReplayCmd struct {
+	api.Options
+	namespaces []string
+	eventTypes []string
+	matches    []string
+	since      string
+	until      string
+	aggregate  []string
+	speed      float64
+	maxGap     time.Duration
+
+	fieldMatches map[string]string
+	sinceTime    time.Time
+	untilTime    time.Time
+}
+
+func newEventsReplayCmd(p common.OptionsProvider) *cobra.Command {
+	action := &eventsReplayCmd{
+		Options: api.Options{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "replay <file>...",
+		Short: "Replay and analyze recorded controller events",
+		Long: "Reads json lines event files, as written by the controller's json file event logger or by 'ziti ops events record', " +
+			"and renders the matching events as a timeline, aggregates them, or writes them out as json. Events from several " +
+			"files are merged in time order. Use '-' to read from stdin.",
+		Example: `  # show what happened to circuits of a service during an incident
+  ziti ops events replay ctrl-events.jsonl --namespace 'fabric.circuits' --match service_id=3Hk1 \
+      --since 2022-08-01T10:00:00Z --until 2022-08-01T10:15:00Z
+
+  # count router and link events by type and router
+  ziti ops events replay ctrl-events.jsonl --namespace 'fabric.*' --aggregate namespace,event_type,router_id
+
+  # replay the timeline at ten times the original speed
+  ziti ops events replay ctrl-events.jsonl --speed 10`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	action.AddCommonFlags(cmd)
+	cmd.Flags().StringSliceVar(&action.namespaces, "namespace", nil, "Only include events in these namespaces. Supports glob patterns such as 'edge.*'")
+	cmd.Flags().StringSliceVar(&action.eventTypes, "type", nil, "Only include events of these types, such as created or deleted")
+	cmd.Flags().StringArrayVar(&action.matches, "match", nil, "Only include events where the field has the value, given as <field>=<pattern>. Nested fields use dots, such as tags.host. May be repeated")
+	cmd.Flags().StringVar(&action.since, "since", "", "Only include events at or after this time (RFC3339)")
+	cmd.Flags().StringVar(&action.until, "until", "", "Only include events before this time (RFC3339)")
+	cmd.Flags().StringSliceVar(&action.aggregate, "aggregate", nil, "Instead of a timeline, count the events grouped by these fields, such as namespace,event_type")
+	cmd.Flags().Float64Var(&action.speed, "speed", 0, "Replay the timeline in real time, sped up by this factor. 0 prints the timeline without pauses")
+	cmd.Flags().DurationVar(&action.maxGap, "max-gap", 5*time.Second, "With --speed, the longest pause between two events")
+
+	return cmd
+}
+
+func (self *eventsReplayCmd) run() error {
+	if err := self.parseFilters(); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	events, skipped, err := readEvents(self.Args, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	var matched []*recordedEvent
+	for _, event := range events {
+		if self.include(event) {
+			matched = append(matched, event)
+		}
+	}
+
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(self.Err, "skipped %v lines which aren't json events\n", skipped)
+	}
+
+	if len(self.aggregate) > 0 {
+		return self.outputAggregate(matched)
+	}
+
+	if self.OutputJSONResponse {
+		for _, event := range matched {
+			data, err := json.Marshal(event.Fields)
+			if err != nil {
+				return err
+			}
+			self.Printf("%v\n", string(data))
+		}
+		return nil
+	}
+
+	self.outputTimeline(matched)
+	return nil
+}
+
+func (self *eventsReplayCmd) parseFilters() error {
+	self.fieldMatches = map[string]string{}
+	for _, match := range self.matches {
+		idx := strings.Index(match, "=")
+		if idx < 1 {
+			return fmt.Errorf("invalid match '%v', must be of the form <field>=<pattern>", match)
+		}
+		if _, err := path.Match(match[idx+1:], ""); err != nil {
+			return fmt.Errorf("invalid pattern in match '%v': %w", match, err)
+		}
+		self.fieldMatches[match[:idx]] = match[idx+1:]
+	}
+
+	for _, pattern := range self.namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern '%v': %w", pattern, err)
+		}
+	}
+
+	var err error
+	if self.since != "" {
+		if self.sinceTime, err = time.Parse(time.RFC3339, self.since); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if self.until != "" {
+		if self.untilTime, err = time.Parse(time.RFC3339, self.until); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if self.speed < 0 {
+		return fmt.Errorf("invalid --speed %v, must not be negative", self.speed)
+	}
+	return nil
+}
+
+func (self *eventsReplayCmd) include(event *recordedEvent) bool {
+	if !self.sinceTime.IsZero() && event.Timestamp.Before(self.sinceTime) {
+		return false
+	}
+	if !self.untilTime.IsZero() && !event.Timestamp.Before(self.untilTime) {
+		return false
+	}
+	if len(self.namespaces) > 0 && !matchesAny(self.namespaces, event.Namespace()) {
+		return false
+	}
+	if len(self.eventTypes) > 0 && !matchesAny(self.eventTypes, event.EventType()) {
+		return false
+	}
+	for field, pattern := range self.fieldMatches {
+		if matched, _ := path.Match(pattern, event.String(field)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// outputTimeline prints one line per event, with the ids of the entities the event concerns
+func (self *eventsReplayCmd) outputTimeline(events []*recordedEvent) {
+	var previous time.Time
+	for _, event := range events {
+		if self.speed > 0 && !previous.IsZero() && !event.Timestamp.IsZero() {
+			gap := time.Duration(float64(event.Timestamp.Sub(previous)) / self.speed)
+			if gap > self.maxGap {
+				gap = self.maxGap
+			}
+			if gap > 0 {
+				time.Sleep(gap)
+			}
+		}
+		if !event.Timestamp.IsZero() {
+			previous = event.Timestamp
+		}
+
+		timestamp := "-"
+		if !event.Timestamp.IsZero() {
+			timestamp = event.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+		self.Printf("%v  %-20v %-14v %v\n", timestamp, event.Namespace(), event.EventType(), eventDetails(event))
+	}
+
+	if len(events) == 0 {
+		self.Printf("no matching events found\n")
+	} else if first, last := events[0].Timestamp, events[len(events)-1].Timestamp; !first.IsZero() {
+		self.Printf("\n%v events over %v\n", len(events), last.Sub(first).Round(time.Millisecond))
+	}
+}
+
+// eventDetails lists the ids, paths and other short fields of the event which identify what it's about
+func eventDetails(event *recordedEvent) string {
+	skip := map[string]bool{"namespace": true, "event_type": true, "eventType": true, "timestamp": true, "version": true,
+		"metric_type": true}
+
+	var keys []string
+	for key, val := range event.Fields {
+		if skip[key] {
+			continue
+		}
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []string
+	for _, key := range keys {
+		if val := event.String(key); val != "" {
+			result = append(result, key+"="+val)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+// outputAggregate counts the events by the values of the aggregate fields
+func (self *eventsReplayCmd) outputAggregate(events []*recordedEvent) error {
+	type group struct {
+		values []string
+		count  int
+		first  time.Time
+		last   time.Time
+	}
+
+	groups := map[string]*group{}
+	var order []string
+
+	for _, event := range events {
+		var values []string
+		for _, field := range self.aggregate {
+			var val string
+			switch field {
+			case "namespace":
+				val = event.Namespace()
+			case "event_type":
+				val = event.EventType()
+			default:
+				val = event.String(field)
+			}
+			if val == "" {
+				val = "-"
+			}
+			values = append(values, val)
+		}
+
+		key := strings.Join(values, "\x00")
+		g, found := groups[key]
+		if !found {
+			g = &group{values: values, first: event.Timestamp}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.count++
+		g.last = event.Timestamp
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return groups[order[i]].count > groups[order[j]].count
+	})
+
+	if self.OutputJSONResponse {
+		result := []map[string]interface{}{}
+		for _, key := range order {
+			g := groups[key]
+			entry := map[string]interface{}{"count": g.count, "first": g.first, "last": g.last}
+			for i, field := range self.aggregate {
+				entry[field] = g.values[i]
+			}
+			result = append(result, entry)
+		}
+		enc := json.NewEncoder(self.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	var header table.Row
+	for _, field := range self.aggregate {
+		header = append(header, field)
+	}
+	header = append(header, "Count", "First", "Last")
+	t.AppendHeader(header)
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		var row table.Row
+		for _, val := range g.values {
+			row = append(row, val)
+		}
+		row = append(row, g.count, formatTime(g.first), formatTime(g.last))
+		t.AppendRow(row)
+	}
+	api.RenderTable(&self.Options, t, nil)
+	self.Printf("%v events in %v groups\n", len(events), len(groups))
+	return nil
+}
@@ -0,0 +1,73 @@
+package ops
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchesAny(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		value    string
+		matches  bool
+	}{
+		{patterns: []string{"fabric.circuits"}, value: "fabric.circuits", matches: true},
+		{patterns: []string{"edge.*", "fabric.*"}, value: "fabric.links", matches: true},
+		{patterns: []string{"edge.*"}, value: "fabric.links"},
+		{patterns: []string{"*"}, value: "fabric.links", matches: true},
+		{patterns: []string{"fabric.circuit?"}, value: "fabric.circuits", matches: true},
+		{patterns: []string{"[invalid"}, value: "[invalid"},
+		{patterns: nil, value: "fabric.links"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.matches, matchesAny(test.patterns, test.value), "%v against %v", test.value, test.patterns)
+	}
+}
+
+func newTestReplayEvent(seconds int, fields map[string]interface{}) *recordedEvent {
+	return &recordedEvent{Fields: fields, Timestamp: time.Unix(int64(1659348000+seconds), 0)}
+}
+
+func TestOutputAggregate(t *testing.T) {
+	req := require.New(t)
+
+	events := []*recordedEvent{
+		newTestReplayEvent(1, map[string]interface{}{"namespace": "fabric.circuits", "event_type": "created", "tags": map[string]interface{}{"host": "a"}}),
+		newTestReplayEvent(2, map[string]interface{}{"namespace": "fabric.routers", "event_type": "router-online"}),
+		newTestReplayEvent(3, map[string]interface{}{"namespace": "fabric.circuits", "event_type": "created", "tags": map[string]interface{}{"host": "a"}}),
+		newTestReplayEvent(4, map[string]interface{}{"namespace": "fabric.circuits", "event_type": "created", "tags": map[string]interface{}{"host": "b"}}),
+		newTestReplayEvent(5, map[string]interface{}{"namespace": "fabric.circuits", "event_type": "created", "tags": map[string]interface{}{"host": "a"}}),
+	}
+
+	out := &bytes.Buffer{}
+	cmd := &eventsReplayCmd{
+		Options:   newTestOptions(out),
+		aggregate: []string{"namespace", "tags.host"},
+	}
+	cmd.OutputJSONResponse = true
+	req.NoError(cmd.outputAggregate(events))
+
+	var result []map[string]interface{}
+	req.NoError(json.Unmarshal(out.Bytes(), &result))
+	req.Len(result, 3)
+	req.Equal(map[string]interface{}{
+		"namespace": "fabric.circuits", "tags.host": "a", "count": float64(3),
+		"first": time.Unix(1659348001, 0).Format(time.RFC3339Nano), "last": time.Unix(1659348005, 0).Format(time.RFC3339Nano),
+	}, result[0])
+	req.Equal("-", result[1]["tags.host"], "groups keep the order they're first seen in when counts tie")
+	req.Equal("b", result[2]["tags.host"])
+
+	out.Reset()
+	req.NoError(cmd.outputAggregate(nil))
+	req.JSONEq("[]", out.String())
+
+	out.Reset()
+	cmd.OutputJSONResponse = false
+	req.NoError(cmd.outputAggregate(events))
+	req.Contains(out.String(), "5 events in 3 groups")
+}
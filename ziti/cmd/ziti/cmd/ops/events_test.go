@@ -0,0 +1,114 @@
+package ops
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonInt(t *testing.T) {
+	tests := []struct {
+		val      interface{}
+		expected int64
+		ok       bool
+	}{
+		{val: json.Number("42"), expected: 42, ok: true},
+		{val: "1659348000", expected: 1659348000, ok: true},
+		{val: "-7", expected: -7, ok: true},
+		{val: json.Number("1.5")},
+		{val: "abc"},
+		{val: 42.0},
+		{val: nil},
+	}
+
+	for _, test := range tests {
+		val, ok := jsonInt(test.val)
+		require.Equal(t, test.ok, ok, "%v", test.val)
+		require.Equal(t, test.expected, val, "%v", test.val)
+	}
+}
+
+func TestEventTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]interface{}
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "RFC3339",
+			fields:   map[string]interface{}{"timestamp": "2022-08-01T10:00:00.5Z"},
+			expected: time.Date(2022, 8, 1, 10, 0, 0, 500000000, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "protobuf timestamp",
+			fields:   map[string]interface{}{"timestamp": map[string]interface{}{"seconds": "1659348000", "nanos": json.Number("250")}},
+			expected: time.Unix(1659348000, 250),
+			ok:       true,
+		},
+		{
+			name:     "unix seconds",
+			fields:   map[string]interface{}{"timestamp": json.Number("1659348000")},
+			expected: time.Unix(1659348000, 0),
+			ok:       true,
+		},
+		{
+			name:     "usage interval",
+			fields:   map[string]interface{}{"interval_start_utc": json.Number("1659348000")},
+			expected: time.Unix(1659348000, 0),
+			ok:       true,
+		},
+		{name: "invalid string", fields: map[string]interface{}{"timestamp": "yesterday"}},
+		{name: "empty protobuf timestamp", fields: map[string]interface{}{"timestamp": map[string]interface{}{}}},
+		{name: "missing", fields: map[string]interface{}{"namespace": "fabric.circuits"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timestamp, ok := eventTimestamp(test.fields)
+			require.Equal(t, test.ok, ok)
+			require.True(t, test.expected.Equal(timestamp), "expected %v, got %v", test.expected, timestamp)
+		})
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	req := require.New(t)
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.jsonl")
+	second := filepath.Join(dir, "second.jsonl")
+	req.NoError(ioutil.WriteFile(first, []byte(
+		`{"namespace": "fabric.circuits", "event_type": "created", "timestamp": "2022-08-01T10:00:02Z"}
+INFO some log output
+{"namespace": "fabric.circuits", "event_type": "deleted", "timestamp": "2022-08-01T10:00:04Z"}
+
+`), 0600))
+	req.NoError(ioutil.WriteFile(second, []byte(
+		`{"namespace": "fabric.routers", "event_type": "router-online", "timestamp": "2022-08-01T10:00:03Z"}
+[1, 2]
+`), 0600))
+	stdin := strings.NewReader(`{"namespace": "edge.sessions", "event_type": "created", "timestamp": "2022-08-01T10:00:01Z", "size": 12345678901234}`)
+
+	events, skipped, err := readEvents([]string{first, second, "-"}, stdin)
+	req.NoError(err)
+	req.Equal(2, skipped)
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Namespace()+"/"+event.EventType())
+	}
+	req.Equal([]string{"edge.sessions/created", "fabric.circuits/created", "fabric.routers/router-online", "fabric.circuits/deleted"}, types)
+	req.Equal("12345678901234", events[0].String("size"), "numbers are kept exactly")
+
+	_, _, err = readEvents([]string{filepath.Join(dir, "missing.jsonl")}, nil)
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+}
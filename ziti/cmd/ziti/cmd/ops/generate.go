@@ -0,0 +1,485 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func newGenerateCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate files for other tools from the network's inventory",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newGenerateAnsibleCmd(p))
+	cmd.AddCommand(newGenerateTerraformCmd(p))
+	return cmd
+}
+
+// generateInventoryCmd holds the options shared by the generate commands, which read the routers and identities of
+// the network
+type generateInventoryCmd struct {
+	api.Options
+	outFile        string
+	routerFilter   string
+	identityFilter string
+	noRouters      bool
+	noIdentities   bool
+}
+
+func (self *generateInventoryCmd) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&self.outFile, "out", "o", "", "File to write to. Defaults to stdout")
+	cmd.Flags().StringVar(&self.routerFilter, "router-filter", "", "Only include routers matching this filter")
+	cmd.Flags().StringVar(&self.identityFilter, "identity-filter", "", "Only include identities matching this filter")
+	cmd.Flags().BoolVar(&self.noRouters, "no-routers", false, "Leave routers out")
+	cmd.Flags().BoolVar(&self.noIdentities, "no-identities", false, "Leave identities out")
+	self.AddCommonFlags(cmd)
+}
+
+type inventoryRouter struct {
+	Id              string
+	Name            string
+	Hostname        string
+	Version         string
+	RoleAttributes  []string
+	Online          bool
+	Edge            bool
+	TunnelerEnabled bool
+}
+
+type inventoryIdentity struct {
+	Id             string
+	Name           string
+	Type           string
+	RoleAttributes []string
+	IsAdmin        bool
+}
+
+type inventory struct {
+	Routers    []*inventoryRouter
+	Identities []*inventoryIdentity
+}
+
+// getInventory reads the edge and transit routers and the identities of the network. Router identities are left out,
+// as they're managed through their routers
+func (self *generateInventoryCmd) getInventory() (*inventory, error) {
+	result := &inventory{}
+
+	list := func(entityType, filter string) ([]*api.GabsWrapper, error) {
+		if filter == "" {
+			filter = "true"
+		}
+		params := url.Values{}
+		params.Add("filter", filter+" limit none")
+		children, _, err := api.ListEntitiesOfType(util.EdgeAPI, entityType, params, false, self.Out, self.Timeout, self.Verbose)
+		if err != nil {
+			return nil, err
+		}
+		var wrappers []*api.GabsWrapper
+		for _, child := range children {
+			wrappers = append(wrappers, api.Wrap(child))
+		}
+		return wrappers, nil
+	}
+
+	if !self.noRouters {
+		edgeRouters, err := list("edge-routers", self.routerFilter)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range edgeRouters {
+			result.Routers = append(result.Routers, &inventoryRouter{
+				Id:              r.String("id"),
+				Name:            r.String("name"),
+				Hostname:        r.String("hostname"),
+				Version:         r.String("versionInfo.version"),
+				RoleAttributes:  r.StringSlice("roleAttributes"),
+				Online:          r.Bool("isOnline"),
+				Edge:            true,
+				TunnelerEnabled: r.Bool("isTunnelerEnabled"),
+			})
+		}
+
+		transitRouters, err := list("transit-routers", self.routerFilter)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range transitRouters {
+			result.Routers = append(result.Routers, &inventoryRouter{
+				Id:      r.String("id"),
+				Name:    r.String("name"),
+				Version: r.String("versionInfo.version"),
+				Online:  r.Bool("isOnline"),
+			})
+		}
+	}
+
+	if !self.noIdentities {
+		identities, err := list("identities", self.identityFilter)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range identities {
+			if strings.EqualFold(i.String("type.name"), "Router") {
+				continue
+			}
+			result.Identities = append(result.Identities, &inventoryIdentity{
+				Id:             i.String("id"),
+				Name:           i.String("name"),
+				Type:           i.String("type.name"),
+				RoleAttributes: i.StringSlice("roleAttributes"),
+				IsAdmin:        i.Bool("isAdmin"),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func (self *generateInventoryCmd) write(data []byte) error {
+	if self.outFile == "" {
+		_, err := self.Out.Write(data)
+		return err
+	}
+	if err := ioutil.WriteFile(self.outFile, data, 0644); err != nil {
+		return fmt.Errorf("failed writing %v: %w", self.outFile, err)
+	}
+	self.Printf("wrote %v\n", self.outFile)
+	return nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// sanitizeName turns a name into one usable as an ansible group or terraform resource name, which may only contain
+// letters, digits and underscores, and may not start with a digit
+func sanitizeName(name string) string {
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+type generateAnsibleCmd struct {
+	generateInventoryCmd
+}
+
+func newGenerateAnsibleCmd(p common.OptionsProvider) *cobra.Command {
+	action := &generateAnsibleCmd{generateInventoryCmd{Options: api.Options{CommonOptions: p()}}}
+
+	cmd := &cobra.Command{
+		Use:   "ansible",
+		Short: "Generates an Ansible inventory of the network's routers and identities",
+		Long: "Generates an Ansible YAML inventory of the network's routers and identities. Routers are in the " +
+			"ziti_routers group, with edge routers in ziti_edge_routers and transit routers in ziti_transit_routers, " +
+			"and identities in the ziti_identities group. Each role attribute gets its own group, e.g. " +
+			"ziti_router_attr_east, so playbooks can target routers and identities by role. Edge routers with a " +
+			"hostname have it set as ansible_host. The ids, versions and attributes are set as host variables " +
+			"prefixed with ziti_router_ or ziti_identity_. Ansible has a single namespace for hosts, so an identity " +
+			"with the same name as a router is listed as <name>_identity, with its name in ziti_identity_name",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	action.addFlags(cmd)
+	return cmd
+}
+
+type ansibleGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts,omitempty"`
+	Children map[string]*ansibleGroup          `yaml:"children,omitempty"`
+}
+
+func (self *ansibleGroup) addHost(name string, vars map[string]interface{}) {
+	if self.Hosts == nil {
+		self.Hosts = map[string]map[string]interface{}{}
+	}
+	self.Hosts[name] = vars
+}
+
+func (self *ansibleGroup) child(name string) *ansibleGroup {
+	if self.Children == nil {
+		self.Children = map[string]*ansibleGroup{}
+	}
+	group, found := self.Children[name]
+	if !found {
+		group = &ansibleGroup{}
+		self.Children[name] = group
+	}
+	return group
+}
+
+func (self *generateAnsibleCmd) run() error {
+	inv, err := self.getInventory()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(map[string]*ansibleGroup{"all": ansibleInventory(inv)})
+	if err != nil {
+		return err
+	}
+	return self.write(append([]byte("# Ansible inventory generated by 'ziti ops generate ansible'\n"), data...))
+}
+
+// ansibleInventory builds the inventory. Hosts only get their variables in the ziti_edge_routers,
+// ziti_transit_routers and ziti_identities groups, and are listed without variables in the attribute groups. Host
+// names must be unique across all groups, otherwise ansible merges the hosts, so identities named like a router
+// get a suffix
+func ansibleInventory(inv *inventory) *ansibleGroup {
+	all := &ansibleGroup{}
+
+	used := map[string]bool{}
+	hostName := func(name, suffix string) string {
+		result := name
+		for i := 1; used[result]; i++ {
+			result = name + suffix
+			if i > 1 {
+				result += "_" + strconv.Itoa(i)
+			}
+		}
+		used[result] = true
+		return result
+	}
+
+	if len(inv.Routers) > 0 {
+		routers := all.child("ziti_routers")
+		for _, r := range inv.Routers {
+			vars := map[string]interface{}{
+				"ziti_router_id":      r.Id,
+				"ziti_router_online":  r.Online,
+				"ziti_router_version": r.Version,
+			}
+			group := routers.child("ziti_transit_routers")
+			if r.Edge {
+				group = routers.child("ziti_edge_routers")
+				vars["ziti_router_role_attributes"] = stringSliceOrEmpty(r.RoleAttributes)
+				vars["ziti_router_tunneler_enabled"] = r.TunnelerEnabled
+			}
+			if r.Hostname != "" {
+				vars["ansible_host"] = r.Hostname
+			}
+			host := hostName(r.Name, "_router")
+			group.addHost(host, vars)
+			for _, attr := range r.RoleAttributes {
+				routers.child("ziti_router_attr_"+sanitizeName(attr)).addHost(host, nil)
+			}
+		}
+	}
+
+	if len(inv.Identities) > 0 {
+		identities := all.child("ziti_identities")
+		for _, i := range inv.Identities {
+			host := hostName(i.Name, "_identity")
+			identities.addHost(host, map[string]interface{}{
+				"ziti_identity_id":              i.Id,
+				"ziti_identity_name":            i.Name,
+				"ziti_identity_type":            i.Type,
+				"ziti_identity_is_admin":        i.IsAdmin,
+				"ziti_identity_role_attributes": stringSliceOrEmpty(i.RoleAttributes),
+			})
+			for _, attr := range i.RoleAttributes {
+				identities.child("ziti_identity_attr_"+sanitizeName(attr)).addHost(host, nil)
+			}
+		}
+	}
+
+	return all
+}
+
+func stringSliceOrEmpty(val []string) []string {
+	if val == nil {
+		return []string{}
+	}
+	return val
+}
+
+type generateTerraformCmd struct {
+	generateInventoryCmd
+	resourcePrefix string
+}
+
+func newGenerateTerraformCmd(p common.OptionsProvider) *cobra.Command {
+	action := &generateTerraformCmd{generateInventoryCmd: generateInventoryCmd{Options: api.Options{CommonOptions: p()}}}
+
+	cmd := &cobra.Command{
+		Use:   "terraform",
+		Short: "Generates Terraform import blocks and resource stubs for the network's routers and identities",
+		Long: "Generates a Terraform configuration with an import block and a resource stub for each of the network's " +
+			"routers and identities, so an existing network can be brought under Terraform with 'terraform plan'. " +
+			"Import blocks need Terraform 1.5 or newer. The resources are named <prefix>_edge_router, " +
+			"<prefix>_transit_router and <prefix>_identity, with the prefix set by --resource-prefix to match the " +
+			"provider used. Check the generated attributes against the provider's schema before applying",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+	}
+
+	action.addFlags(cmd)
+	cmd.Flags().StringVar(&action.resourcePrefix, "resource-prefix", "ziti", "Prefix of the resource types, as used by the Terraform provider")
+	return cmd
+}
+
+func (self *generateTerraformCmd) run() error {
+	if self.resourcePrefix == "" || sanitizeName(self.resourcePrefix) != self.resourcePrefix {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --resource-prefix %v, may only contain letters, digits and underscores", self.resourcePrefix)
+	}
+
+	inv, err := self.getInventory()
+	if err != nil {
+		return err
+	}
+
+	return self.write(terraformConfig(inv, self.resourcePrefix))
+}
+
+type terraformAttr struct {
+	name  string
+	value interface{}
+}
+
+// terraformConfig renders an import block and resource stub per router and identity. Resource names are made unique,
+// as different entity names may sanitize to the same resource name
+func terraformConfig(inv *inventory, prefix string) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("# Terraform configuration generated by 'ziti ops generate terraform'\n")
+
+	used := map[string]bool{}
+	resource := func(resourceType, id, name string, attrs []terraformAttr) {
+		resourceName := sanitizeName(name)
+		for i := 2; used[resourceType+"."+resourceName]; i++ {
+			resourceName = sanitizeName(name) + "_" + strconv.Itoa(i)
+		}
+		used[resourceType+"."+resourceName] = true
+
+		_, _ = fmt.Fprintf(buf, "\nimport {\n  to = %v.%v\n  id = %v\n}\n", resourceType, resourceName, hclString(id))
+		_, _ = fmt.Fprintf(buf, "\nresource %q %q {\n", resourceType, resourceName)
+		writeTerraformAttrs(buf, attrs)
+		buf.WriteString("}\n")
+	}
+
+	routers := append([]*inventoryRouter{}, inv.Routers...)
+	sort.SliceStable(routers, func(i, j int) bool { return routers[i].Name < routers[j].Name })
+	for _, r := range routers {
+		if r.Edge {
+			resource(prefix+"_edge_router", r.Id, r.Name, []terraformAttr{
+				{"name", r.Name},
+				{"role_attributes", stringSliceOrEmpty(r.RoleAttributes)},
+				{"is_tunneler_enabled", r.TunnelerEnabled},
+			})
+		} else {
+			resource(prefix+"_transit_router", r.Id, r.Name, []terraformAttr{
+				{"name", r.Name},
+			})
+		}
+	}
+
+	identities := append([]*inventoryIdentity{}, inv.Identities...)
+	sort.SliceStable(identities, func(i, j int) bool { return identities[i].Name < identities[j].Name })
+	for _, i := range identities {
+		resource(prefix+"_identity", i.Id, i.Name, []terraformAttr{
+			{"name", i.Name},
+			{"type", i.Type},
+			{"is_admin", i.IsAdmin},
+			{"role_attributes", stringSliceOrEmpty(i.RoleAttributes)},
+		})
+	}
+
+	return buf.Bytes()
+}
+
+func writeTerraformAttrs(out io.Writer, attrs []terraformAttr) {
+	width := 0
+	for _, attr := range attrs {
+		if len(attr.name) > width {
+			width = len(attr.name)
+		}
+	}
+	for _, attr := range attrs {
+		var value string
+		switch v := attr.value.(type) {
+		case string:
+			value = hclString(v)
+		case []string:
+			var quoted []string
+			for _, s := range v {
+				quoted = append(quoted, hclString(s))
+			}
+			value = "[" + strings.Join(quoted, ", ") + "]"
+		default:
+			value = fmt.Sprintf("%v", v)
+		}
+		_, _ = fmt.Fprintf(out, "  %-*s = %v\n", width, attr.name, value)
+	}
+}
+
+// hclString quotes a string for HCL, escaping the template sequences HCL would otherwise interpolate. HCL only has
+// the \n, \r, \t, \", \\ and \u escapes, so other control characters are written as \u escapes, and invalid UTF-8
+// as the replacement character
+func hclString(val string) string {
+	val = strings.ReplaceAll(val, "${", "$${")
+	val = strings.ReplaceAll(val, "%{", "%%{")
+
+	result := &strings.Builder{}
+	result.WriteByte('"')
+	for _, r := range val {
+		switch {
+		case r == '"' || r == '\\':
+			result.WriteByte('\\')
+			result.WriteRune(r)
+		case r == '\n':
+			result.WriteString(`\n`)
+		case r == '\r':
+			result.WriteString(`\r`)
+		case r == '\t':
+			result.WriteString(`\t`)
+		case unicode.IsControl(r):
+			_, _ = fmt.Fprintf(result, `\u%04X`, r)
+		default:
+			result.WriteRune(r)
+		}
+	}
+	result.WriteByte('"')
+	return result.String()
+}
@@ -0,0 +1,161 @@
+package ops
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "edge_router_1", expected: "edge_router_1"},
+		{name: "us-east.router", expected: "us_east_router"},
+		{name: "1st router", expected: "_1st_router"},
+		{name: "", expected: "_"},
+		{name: "höst", expected: "h_st"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, sanitizeName(test.name), test.name)
+	}
+}
+
+func TestHclString(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected string
+	}{
+		{val: "plain", expected: `"plain"`},
+		{val: `quote " and \ backslash`, expected: `"quote \" and \\ backslash"`},
+		{val: "line\nbreak\r\ttab", expected: `"line\nbreak\r\ttab"`},
+		{val: "nul\x00 and bell\a", expected: `"nul\u0000 and bell\u0007"`},
+		{val: "${var.secret} and %{if true}", expected: `"$${var.secret} and %%{if true}"`},
+		{val: "ünïcode ✓", expected: `"ünïcode ✓"`},
+		{val: "bad \xff utf8", expected: "\"bad � utf8\""},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, hclString(test.val), "%q", test.val)
+	}
+}
+
+func testInventory() *inventory {
+	return &inventory{
+		Routers: []*inventoryRouter{
+			{Id: "er1", Name: "edge-1", Hostname: "edge-1.example.com", Version: "v0.27.0", RoleAttributes: []string{"us-east"}, Online: true, Edge: true, TunnelerEnabled: true},
+			{Id: "tr1", Name: "transit-1", Version: "v0.26.0"},
+		},
+		Identities: []*inventoryIdentity{
+			{Id: "id1", Name: "alice", Type: "User", RoleAttributes: []string{"us-east"}},
+			{Id: "id2", Name: "edge-1", Type: "Device"},
+		},
+	}
+}
+
+func TestAnsibleInventory(t *testing.T) {
+	req := require.New(t)
+
+	all := ansibleInventory(testInventory())
+
+	routers := all.Children["ziti_routers"]
+	req.NotNil(routers)
+	req.Equal(map[string]interface{}{
+		"ziti_router_id":               "er1",
+		"ziti_router_online":           true,
+		"ziti_router_version":          "v0.27.0",
+		"ziti_router_role_attributes":  []string{"us-east"},
+		"ziti_router_tunneler_enabled": true,
+		"ansible_host":                 "edge-1.example.com",
+	}, routers.Children["ziti_edge_routers"].Hosts["edge-1"])
+	req.Contains(routers.Children["ziti_transit_routers"].Hosts, "transit-1")
+	req.Contains(routers.Children["ziti_router_attr_us_east"].Hosts, "edge-1")
+	req.Nil(routers.Children["ziti_router_attr_us_east"].Hosts["edge-1"], "attribute groups don't repeat the variables")
+
+	identities := all.Children["ziti_identities"]
+	req.NotNil(identities)
+	req.Equal("id1", identities.Hosts["alice"]["ziti_identity_id"])
+	req.Equal([]string{"us-east"}, identities.Hosts["alice"]["ziti_identity_role_attributes"])
+	req.Contains(identities.Children["ziti_identity_attr_us_east"].Hosts, "alice")
+
+	// the identity named like a router is kept apart from it
+	req.NotContains(identities.Hosts, "edge-1")
+	req.Equal("id2", identities.Hosts["edge-1_identity"]["ziti_identity_id"])
+	req.Equal("edge-1", identities.Hosts["edge-1_identity"]["ziti_identity_name"])
+
+	data, err := yaml.Marshal(map[string]*ansibleGroup{"all": all})
+	req.NoError(err)
+	req.Contains(string(data), "ziti_edge_routers:")
+
+	req.Empty(ansibleInventory(&inventory{}).Children)
+}
+
+func TestTerraformConfig(t *testing.T) {
+	req := require.New(t)
+
+	inv := testInventory()
+	inv.Identities = append(inv.Identities, &inventoryIdentity{Id: "id3", Name: "edge.1", Type: "Device"})
+
+	expected := `# Terraform configuration generated by 'ziti ops generate terraform'
+
+import {
+  to = ziti_edge_router.edge_1
+  id = "er1"
+}
+
+resource "ziti_edge_router" "edge_1" {
+  name                = "edge-1"
+  role_attributes     = ["us-east"]
+  is_tunneler_enabled = true
+}
+
+import {
+  to = ziti_transit_router.transit_1
+  id = "tr1"
+}
+
+resource "ziti_transit_router" "transit_1" {
+  name = "transit-1"
+}
+
+import {
+  to = ziti_identity.alice
+  id = "id1"
+}
+
+resource "ziti_identity" "alice" {
+  name            = "alice"
+  type            = "User"
+  is_admin        = false
+  role_attributes = ["us-east"]
+}
+
+import {
+  to = ziti_identity.edge_1
+  id = "id2"
+}
+
+resource "ziti_identity" "edge_1" {
+  name            = "edge-1"
+  type            = "Device"
+  is_admin        = false
+  role_attributes = []
+}
+
+import {
+  to = ziti_identity.edge_1_2
+  id = "id3"
+}
+
+resource "ziti_identity" "edge_1_2" {
+  name            = "edge.1"
+  type            = "Device"
+  is_admin        = false
+  role_attributes = []
+}
+`
+	req.Equal(expected, string(terraformConfig(inv, "ziti")))
+}
@@ -0,0 +1,620 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/agent"
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/fabric/router"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/common/agentops"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/fabric"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	rolloutStatusUpgraded = "upgraded"
+	rolloutStatusFailed   = "failed"
+)
+
+func newRolloutCmd(p common.OptionsProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollout",
+		Short: "Orchestrate upgrades of Ziti components",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newRolloutRoutersCmd(p))
+	return cmd
+}
+
+type rolloutRoutersCmd struct {
+	api.Options
+	version         string
+	upgradeCommand  string
+	agentTemplate   string
+	batchSize       int
+	maxFailures     int
+	drainTimeout    time.Duration
+	upgradeTimeout  time.Duration
+	verifyTimeout   time.Duration
+	pollInterval    time.Duration
+	stateFile       string
+	pauseFile       string
+	bulk            api.BulkOptions
+	dryRun          bool
+	yes             bool
+	upgradeTemplate *template.Template
+	agentAddrTmpl   *template.Template
+
+	lock  sync.Mutex
+	state *rolloutState
+}
+
+// rolloutState records the outcome for each router, so an interrupted or halted rollout can be resumed
+type rolloutState struct {
+	Version string                         `json:"version"`
+	Routers map[string]*rolloutRouterState `json:"routers"`
+}
+
+type rolloutRouterState struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// rolloutTarget is the data available to the upgrade command and agent address templates
+type rolloutTarget struct {
+	Id      string
+	Name    string
+	Version string
+}
+
+func newRolloutRoutersCmd(p common.OptionsProvider) *cobra.Command {
+	action := &rolloutRoutersCmd{
+		Options: api.Options{
+			CommonOptions: p(),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "routers [filter]",
+		Short: "Upgrade routers in batches, draining and verifying each",
+		Long: "Upgrades the routers matching the filter, which aren't already at the given version, in batches. Each " +
+			"router in a batch is marked no-traversal and drained of circuits, then upgraded by running the " +
+			"--upgrade-command, which has the router id, name and target version available as {{.Id}}, {{.Name}} and " +
+			"{{.Version}}, and in the ZITI_ROUTER_ID, ZITI_ROUTER_NAME and ZITI_VERSION environment variables. The " +
+			"values come from the controller, so they're substituted into the command shell-quoted, and must not be " +
+			"quoted again. If the " +
+			"command only installs the new binary, --agent-template gives the address of each router's IPC agent, " +
+			"through which it's asked to shut down so its supervisor restarts it. The router must then reconnect " +
+			"reporting the new version, after which its previous traversal setting is restored. Routers which fail " +
+			"are left no-traversal.\n\n" +
+			"The rollout halts after a batch in which more than --max-failures routers have failed in total, or " +
+			"carries on regardless with --continue-on-error. It pauses after the current batch when interrupted, or " +
+			"when the --pause-file exists. Running the same command again resumes it, skipping routers already " +
+			"upgraded, and with --state-file, those which failed. With --failure-report, the routers which failed or " +
+			"weren't attempted are written to a report, and running the command again with --retry-failed and that " +
+			"report upgrades only those, including the ones which failed",
+		Example: `  ziti ops rollout routers --version v0.27.0 --batch-size 3 --max-failures 1 --state-file rollout.json \
+    --upgrade-command 'ssh {{.Name}} sudo /opt/ziti/upgrade.sh {{.Version}}' --agent-template 'tcp:{{.Name}}:10001'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			action.Cmd = cmd
+			action.Args = args
+			return action.run()
+		},
+		SilenceUsage: true,
+	}
+
+	action.AddCommonFlags(cmd)
+	cmd.Flags().StringVar(&action.version, "version", "", "Version to upgrade routers to, as reported by the routers, e.g. v0.27.0")
+	cmd.Flags().StringVar(&action.upgradeCommand, "upgrade-command", "", "Shell command which upgrades a router. May use {{.Id}}, {{.Name}} and {{.Version}}, which are substituted shell-quoted")
+	cmd.Flags().StringVar(&action.agentTemplate, "agent-template", "", "Address of each router's IPC agent, through which it's shut down after the upgrade command. May use {{.Id}} and {{.Name}}")
+	cmd.Flags().IntVar(&action.batchSize, "batch-size", 1, "Number of routers to upgrade at the same time")
+	cmd.Flags().IntVar(&action.maxFailures, "max-failures", 0, "Number of routers which may fail before the rollout halts. Can't be combined with --fail-fast or --continue-on-error")
+	cmd.Flags().DurationVar(&action.drainTimeout, "drain-timeout", 5*time.Minute, "How long to wait for circuits using a router to finish before upgrading it anyway")
+	cmd.Flags().DurationVar(&action.upgradeTimeout, "upgrade-timeout", 10*time.Minute, "How long the upgrade command may run")
+	cmd.Flags().DurationVar(&action.verifyTimeout, "verify-timeout", 5*time.Minute, "How long to wait for an upgraded router to reconnect with the new version")
+	cmd.Flags().DurationVar(&action.pollInterval, "poll-interval", 5*time.Second, "How often to check routers and their circuits")
+	cmd.Flags().StringVar(&action.stateFile, "state-file", "", "File recording the outcome for each router, used to resume the rollout")
+	cmd.Flags().StringVar(&action.pauseFile, "pause-file", "", "Pause the rollout after the current batch while this file exists")
+	cmd.Flags().BoolVar(&action.dryRun, "dry-run", false, "Show the batches which would be upgraded without changing anything")
+	cmd.Flags().BoolVarP(&action.yes, "yes", "y", false, "Don't ask for confirmation")
+	action.bulk.AddBulkFlags(cmd, false)
+	_ = cmd.MarkFlagRequired("version")
+
+	return cmd
+}
+
+func (self *rolloutRoutersCmd) run() error {
+	if err := self.validate(); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	run, err := self.bulk.StartBulk("upgrade routers")
+	if err != nil {
+		return err
+	}
+
+	if err = self.loadState(); err != nil {
+		return err
+	}
+
+	routers, err := self.listTargets(run)
+	if err != nil {
+		return err
+	}
+
+	if len(routers) == 0 {
+		self.Printf("no routers need upgrading to %v\n", self.version)
+		return nil
+	}
+
+	batches := rolloutBatches(routers, self.batchSize)
+	self.printPlan(batches)
+
+	if self.dryRun {
+		return nil
+	}
+
+	if !self.yes && !util.Confirm(fmt.Sprintf("upgrade %v routers to %v?", len(routers), self.version), false, "") {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeCancelled, "cancelled")
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	upgraded, failed := 0, 0
+	for i, batch := range batches {
+		if i > 0 && self.paused(interrupted) {
+			skipRolloutBatches(run, batches[i:])
+			if err = run.Finish(); err != nil {
+				return err
+			}
+			return cmdhelper.Errorf(cmdhelper.ExitCodePartialFailure, "rollout paused after %v of %v routers, run the command again to resume", upgraded+failed, len(routers))
+		}
+
+		self.Printf("starting batch %v of %v\n", i+1, len(batches))
+		results := make([]error, len(batch))
+		wg := sync.WaitGroup{}
+		for j, r := range batch {
+			wg.Add(1)
+			go func(j int, r *rest_model.RouterDetail) {
+				defer wg.Done()
+				results[j] = self.upgradeRouter(r)
+			}(j, r)
+		}
+		wg.Wait()
+
+		for j, r := range batch {
+			if results[j] != nil {
+				failed++
+				self.printf(r, "upgrade failed: %v\n", results[j])
+				run.Failed(stringz.OrEmpty(r.ID), stringz.OrEmpty(r.Name), results[j])
+			} else {
+				upgraded++
+				run.Succeeded()
+			}
+			if err = self.recordResult(r, results[j]); err != nil {
+				return err
+			}
+		}
+
+		if !self.bulk.ContinueOnError && failed > self.maxFailures {
+			self.Printf("rollout halted after %v routers failed\n", failed)
+			skipRolloutBatches(run, batches[i+1:])
+			break
+		}
+	}
+
+	self.Printf("upgraded %v routers to %v\n", upgraded, self.version)
+	return run.Finish()
+}
+
+// skipRolloutBatches records the routers in the batches as not attempted
+func skipRolloutBatches(run *api.BulkRun, batches [][]*rest_model.RouterDetail) {
+	for _, batch := range batches {
+		for _, r := range batch {
+			run.Skipped(stringz.OrEmpty(r.ID), stringz.OrEmpty(r.Name))
+		}
+	}
+}
+
+func (self *rolloutRoutersCmd) validate() error {
+	if self.version == "" {
+		return errors.New("--version is required")
+	}
+	if self.batchSize < 1 {
+		return errors.Errorf("invalid --batch-size %v, must be at least 1", self.batchSize)
+	}
+	if self.maxFailures < 0 {
+		return errors.Errorf("invalid --max-failures %v, must not be negative", self.maxFailures)
+	}
+	if self.maxFailures > 0 && (self.bulk.FailFast || self.bulk.ContinueOnError) {
+		return errors.New("--max-failures can't be combined with --fail-fast or --continue-on-error")
+	}
+	if self.upgradeCommand == "" && !self.dryRun {
+		return errors.New("--upgrade-command is required")
+	}
+
+	var err error
+	if self.upgradeTemplate, err = template.New("upgrade-command").Option("missingkey=error").Parse(self.upgradeCommand); err != nil {
+		return errors.Wrap(err, "invalid --upgrade-command")
+	}
+	if self.agentTemplate != "" {
+		if self.agentAddrTmpl, err = template.New("agent-template").Option("missingkey=error").Parse(self.agentTemplate); err != nil {
+			return errors.Wrap(err, "invalid --agent-template")
+		}
+	}
+	return nil
+}
+
+// listTargets returns the routers matching the filter which aren't at the target version, less those already
+// handled according to the state file. With --retry-failed, only the routers in the failure report are returned
+func (self *rolloutRoutersCmd) listTargets(run *api.BulkRun) ([]*rest_model.RouterDetail, error) {
+	filter := "true"
+	if len(self.Args) > 0 {
+		filter = self.Args[0]
+	}
+	if !strings.Contains(filter, "limit") {
+		filter += " sort by name limit none"
+	}
+
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+	routers, _, err := fabric.ListRouters(ctx, &self.Options, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*rest_model.RouterDetail
+	for _, r := range routers {
+		id := stringz.OrEmpty(r.ID)
+		if rolloutVersionMatches(routerVersion(r), self.version) || !run.Include(id) {
+			continue
+		}
+		if prev := self.state.Routers[id]; prev != nil && prev.Status == rolloutStatusFailed && self.bulk.RetryFailed == "" {
+			self.Printf("skipping router %v, which failed previously: %v\n", stringz.OrEmpty(r.Name), prev.Error)
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func routerVersion(r *rest_model.RouterDetail) string {
+	if r.VersionInfo == nil {
+		return ""
+	}
+	return r.VersionInfo.Version
+}
+
+// rolloutVersionMatches compares versions, ignoring a leading v
+func rolloutVersionMatches(current, target string) bool {
+	return current != "" && strings.TrimPrefix(current, "v") == strings.TrimPrefix(target, "v")
+}
+
+// rolloutBatches splits the routers into batches of at most size routers
+func rolloutBatches(routers []*rest_model.RouterDetail, size int) [][]*rest_model.RouterDetail {
+	var batches [][]*rest_model.RouterDetail
+	for len(routers) > 0 {
+		n := size
+		if n > len(routers) {
+			n = len(routers)
+		}
+		batches = append(batches, routers[:n])
+		routers = routers[n:]
+	}
+	return batches
+}
+
+func (self *rolloutRoutersCmd) printPlan(batches [][]*rest_model.RouterDetail) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Batch", "ID", "Name", "Version", "Connected"})
+	for i, batch := range batches {
+		for _, r := range batch {
+			t.AppendRow(table.Row{i + 1, stringz.OrEmpty(r.ID), stringz.OrEmpty(r.Name), routerVersion(r), r.Connected != nil && *r.Connected})
+		}
+	}
+	api.RenderTable(&self.Options, t, nil)
+}
+
+// paused returns true if the rollout should stop before the next batch, because it was interrupted or the pause file
+// exists. While the pause file exists, it waits for it to be removed if the rollout isn't interrupted
+func (self *rolloutRoutersCmd) paused(interrupted chan os.Signal) bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+	}
+
+	if self.pauseFile == "" {
+		return false
+	}
+
+	announced := false
+	for {
+		if _, err := os.Stat(self.pauseFile); os.IsNotExist(err) {
+			if announced {
+				self.Printf("pause file %v removed, resuming rollout\n", self.pauseFile)
+			}
+			return false
+		}
+		if !announced {
+			self.Printf("rollout paused until %v is removed, interrupt to stop\n", self.pauseFile)
+			announced = true
+		}
+		select {
+		case <-interrupted:
+			return true
+		case <-time.After(self.pollInterval):
+		}
+	}
+}
+
+// upgradeRouter drains, upgrades and verifies the router. If the router doesn't come back with the new version, it's
+// left no-traversal
+func (self *rolloutRoutersCmd) upgradeRouter(r *rest_model.RouterDetail) error {
+	id := stringz.OrEmpty(r.ID)
+
+	current, err := self.detailRouter(id)
+	if err != nil {
+		return err
+	}
+	if current.Connected == nil || !*current.Connected {
+		return errors.New("router is not connected")
+	}
+
+	wasNoTraversal := current.NoTraversal != nil && *current.NoTraversal
+	if !wasNoTraversal {
+		if err = self.setNoTraversal(id, true); err != nil {
+			return err
+		}
+		self.printf(r, "marked no-traversal\n")
+	}
+
+	if err = self.drain(r); err != nil {
+		return err
+	}
+
+	target := &rolloutTarget{Id: id, Name: stringz.OrEmpty(r.Name), Version: self.version}
+	if err = self.runUpgradeCommand(target); err != nil {
+		return err
+	}
+
+	if self.agentAddrTmpl != nil {
+		if err = self.requestShutdown(target); err != nil {
+			return err
+		}
+	}
+
+	if err = self.verify(r); err != nil {
+		return err
+	}
+
+	if !wasNoTraversal {
+		if err = self.setNoTraversal(id, false); err != nil {
+			return err
+		}
+		self.printf(r, "restored traversal\n")
+	}
+
+	return nil
+}
+
+func (self *rolloutRoutersCmd) detailRouter(id string) (*rest_model.RouterDetail, error) {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+	return fabric.DetailRouter(ctx, &self.Options, id)
+}
+
+func (self *rolloutRoutersCmd) setNoTraversal(id string, noTraversal bool) error {
+	ctx, cancel := self.TimeoutContext()
+	defer cancel()
+	return fabric.SetRouterNoTraversal(ctx, &self.Options, id, noTraversal)
+}
+
+// drain waits until no circuits use the router, or the drain timeout passes
+func (self *rolloutRoutersCmd) drain(r *rest_model.RouterDetail) error {
+	deadline := time.Now().Add(self.drainTimeout)
+	for {
+		ctx, cancel := self.TimeoutContext()
+		circuits, err := fabric.ListCircuits(ctx, &self.Options)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		count := fabric.CountRouterCircuits(circuits, stringz.OrEmpty(r.ID))
+		if count == 0 {
+			self.printf(r, "drained\n")
+			return nil
+		}
+
+		if time.Now().Add(self.pollInterval).After(deadline) {
+			self.printf(r, "still has %v circuits after %v, proceeding\n", count, self.drainTimeout)
+			return nil
+		}
+
+		time.Sleep(self.pollInterval)
+	}
+}
+
+func (self *rolloutRoutersCmd) runUpgradeCommand(target *rolloutTarget) error {
+	// router names are set through the controller, so they're quoted to keep them from being run as shell code
+	quoted := &rolloutTarget{
+		Id:      rolloutShellQuote(target.Id),
+		Name:    rolloutShellQuote(target.Name),
+		Version: rolloutShellQuote(target.Version),
+	}
+	command := &bytes.Buffer{}
+	if err := self.upgradeTemplate.Execute(command, quoted); err != nil {
+		return errors.Wrap(err, "unable to render upgrade command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), self.upgradeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command.String())
+	cmd.Env = append(os.Environ(),
+		"ZITI_ROUTER_ID="+target.Id,
+		"ZITI_ROUTER_NAME="+target.Name,
+		"ZITI_VERSION="+target.Version)
+	output, err := cmd.CombinedOutput()
+	if self.Verbose || err != nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if line != "" {
+				self.Printf("[%v] | %v\n", target.Name, line)
+			}
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("upgrade command timed out after %v", self.upgradeTimeout)
+	}
+	if err != nil {
+		return errors.Wrap(err, "upgrade command failed")
+	}
+	return nil
+}
+
+// rolloutShellQuote quotes the value as a single word for sh
+func rolloutShellQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
+
+func (self *rolloutRoutersCmd) requestShutdown(target *rolloutTarget) error {
+	addrBuf := &bytes.Buffer{}
+	if err := self.agentAddrTmpl.Execute(addrBuf, target); err != nil {
+		return errors.Wrap(err, "unable to render agent address")
+	}
+
+	addr, err := agent.ParseGopsAddress([]string{addrBuf.String()})
+	if err != nil {
+		return err
+	}
+
+	buf := []byte{router.AgentAppId, agentops.RouterShutdown}
+	if err = agent.MakeRequest(addr, agent.CustomOp, buf, ioutil.Discard); err != nil {
+		return errors.Wrapf(err, "unable to request shutdown through agent %v", addrBuf.String())
+	}
+	return nil
+}
+
+// verify waits for the router to be connected and report the target version
+func (self *rolloutRoutersCmd) verify(r *rest_model.RouterDetail) error {
+	deadline := time.Now().Add(self.verifyTimeout)
+	for {
+		current, err := self.detailRouter(stringz.OrEmpty(r.ID))
+		if err != nil {
+			return err
+		}
+
+		version := routerVersion(current)
+		if current.Connected != nil && *current.Connected && rolloutVersionMatches(version, self.version) {
+			self.printf(r, "online with version %v\n", version)
+			return nil
+		}
+
+		if time.Now().Add(self.pollInterval).After(deadline) {
+			return errors.Errorf("router didn't reconnect with version %v within %v, last seen version %v", self.version, self.verifyTimeout, version)
+		}
+
+		time.Sleep(self.pollInterval)
+	}
+}
+
+func (self *rolloutRoutersCmd) printf(r *rest_model.RouterDetail, format string, args ...interface{}) {
+	self.Printf("[%v] "+format, append([]interface{}{stringz.OrEmpty(r.Name)}, args...)...)
+}
+
+func (self *rolloutRoutersCmd) loadState() error {
+	self.state = &rolloutState{Version: self.version, Routers: map[string]*rolloutRouterState{}}
+	if self.stateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(self.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	state := &rolloutState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return errors.Wrapf(err, "invalid state file %v", self.stateFile)
+	}
+	if state.Version != self.version {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "state file %v is for a rollout to %v, not %v", self.stateFile, state.Version, self.version)
+	}
+	if state.Routers != nil {
+		self.state.Routers = state.Routers
+	}
+	return nil
+}
+
+func (self *rolloutRoutersCmd) recordResult(r *rest_model.RouterDetail, result error) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	routerState := &rolloutRouterState{
+		Name:      stringz.OrEmpty(r.Name),
+		Status:    rolloutStatusUpgraded,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if result != nil {
+		routerState.Status = rolloutStatusFailed
+		routerState.Error = result.Error()
+	}
+	self.state.Routers[stringz.OrEmpty(r.ID)] = routerState
+
+	if self.stateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(self.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(self.stateFile, data, 0644)
+}
@@ -0,0 +1,145 @@
+package ops
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openziti/fabric/rest_model"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRolloutRouter(id string) *rest_model.RouterDetail {
+	name := "router " + id
+	return &rest_model.RouterDetail{BaseEntity: rest_model.BaseEntity{ID: &id}, Name: &name}
+}
+
+func newTestRolloutCmd(t *testing.T) *rolloutRoutersCmd {
+	return &rolloutRoutersCmd{
+		Options:        api.Options{CommonOptions: common.CommonOptions{Out: &bytes.Buffer{}}},
+		version:        "v0.27.0",
+		batchSize:      1,
+		upgradeTimeout: time.Minute,
+		stateFile:      filepath.Join(t.TempDir(), "rollout.json"),
+	}
+}
+
+func TestRolloutBatches(t *testing.T) {
+	var routers []*rest_model.RouterDetail
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		routers = append(routers, newTestRolloutRouter(id))
+	}
+
+	tests := []struct {
+		size     int
+		routers  []*rest_model.RouterDetail
+		expected [][]string
+	}{
+		{size: 1, routers: routers[:3], expected: [][]string{{"a"}, {"b"}, {"c"}}},
+		{size: 2, routers: routers, expected: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{size: 5, routers: routers, expected: [][]string{{"a", "b", "c", "d", "e"}}},
+		{size: 10, routers: routers[:2], expected: [][]string{{"a", "b"}}},
+		{size: 3, routers: nil, expected: nil},
+	}
+
+	for _, test := range tests {
+		var ids [][]string
+		for _, batch := range rolloutBatches(test.routers, test.size) {
+			var batchIds []string
+			for _, r := range batch {
+				batchIds = append(batchIds, *r.ID)
+			}
+			ids = append(ids, batchIds)
+		}
+		require.Equal(t, test.expected, ids, "batch size %v", test.size)
+	}
+}
+
+func TestRolloutVersionMatches(t *testing.T) {
+	tests := []struct {
+		current string
+		target  string
+		matches bool
+	}{
+		{current: "v0.27.0", target: "v0.27.0", matches: true},
+		{current: "0.27.0", target: "v0.27.0", matches: true},
+		{current: "v0.27.0", target: "0.27.0", matches: true},
+		{current: "v0.26.11", target: "v0.27.0"},
+		{current: "v0.27.0", target: "v0.27.01"},
+		{current: "", target: "v0.27.0"},
+		{current: "", target: ""},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.matches, rolloutVersionMatches(test.current, test.target), "%v against %v", test.current, test.target)
+	}
+}
+
+func TestRolloutStateResumes(t *testing.T) {
+	req := require.New(t)
+
+	cmd := newTestRolloutCmd(t)
+	req.NoError(cmd.loadState())
+	req.Empty(cmd.state.Routers, "a missing state file starts a new rollout")
+
+	req.NoError(cmd.recordResult(newTestRolloutRouter("a"), nil))
+	req.NoError(cmd.recordResult(newTestRolloutRouter("b"), errors.New("router didn't reconnect")))
+
+	resumed := newTestRolloutCmd(t)
+	resumed.stateFile = cmd.stateFile
+	req.NoError(resumed.loadState())
+	req.Len(resumed.state.Routers, 2)
+	req.Equal(rolloutStatusUpgraded, resumed.state.Routers["a"].Status)
+	req.Equal("router a", resumed.state.Routers["a"].Name)
+	req.Equal(rolloutStatusFailed, resumed.state.Routers["b"].Status)
+	req.Equal("router didn't reconnect", resumed.state.Routers["b"].Error)
+
+	// a retry which succeeds replaces the failure
+	req.NoError(resumed.recordResult(newTestRolloutRouter("b"), nil))
+	req.NoError(cmd.loadState())
+	req.Equal(rolloutStatusUpgraded, cmd.state.Routers["b"].Status)
+	req.Empty(cmd.state.Routers["b"].Error)
+
+	other := newTestRolloutCmd(t)
+	other.stateFile = cmd.stateFile
+	other.version = "v0.28.0"
+	err := other.loadState()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+
+	req.NoError(ioutil.WriteFile(cmd.stateFile, []byte("{"), 0600))
+	req.Error(cmd.loadState())
+
+	// without a state file, results are only kept in memory
+	inMemory := newTestRolloutCmd(t)
+	inMemory.stateFile = ""
+	req.NoError(inMemory.loadState())
+	req.NoError(inMemory.recordResult(newTestRolloutRouter("a"), nil))
+	req.Equal(rolloutStatusUpgraded, inMemory.state.Routers["a"].Status)
+}
+
+func TestRolloutUpgradeCommandQuotesValues(t *testing.T) {
+	req := require.New(t)
+
+	dir := t.TempDir()
+	cmd := newTestRolloutCmd(t)
+	cmd.upgradeCommand = `printf '%s\n' {{.Name}} {{.Version}} "$ZITI_ROUTER_NAME" > ` + rolloutShellQuote(filepath.Join(dir, "out"))
+	req.NoError(cmd.validate())
+
+	name := `edge'; touch "` + filepath.Join(dir, "pwned") + `"; echo '`
+	req.NoError(cmd.runUpgradeCommand(&rolloutTarget{Id: "a", Name: name, Version: "v0.27.0"}))
+
+	_, err := os.Stat(filepath.Join(dir, "pwned"))
+	req.True(os.IsNotExist(err), "router name was run as shell code")
+
+	output, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	req.NoError(err)
+	req.Equal(name+"\nv0.27.0\n"+name+"\n", string(output))
+}
@@ -0,0 +1,52 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package ops
+
+import (
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+)
+
+// NewOpsCmd creates a command object for the ops command
+func NewOpsCmd(p common.OptionsProvider) *cobra.Command {
+	opsCmd := util.NewEmptyParentCmd("ops", "Operational tools for running Ziti networks")
+
+	opsCmd.AddCommand(newBenchmarkCmd(p))
+	opsCmd.AddCommand(newCatalogCmd(p))
+	opsCmd.AddCommand(newEnrollmentServerCmd(p))
+	opsCmd.AddCommand(newDnsCheckCmd(p))
+	opsCmd.AddCommand(newDriftWatchCmd(p))
+	opsCmd.AddCommand(newEventsCmd(p))
+	opsCmd.AddCommand(newGenerateCmd(p))
+	opsCmd.AddCommand(newRolloutCmd(p))
+	return opsCmd
+}
+
+func newBenchmarkCmd(p common.OptionsProvider) *cobra.Command {
+	benchmarkCmd := &cobra.Command{
+		Use:   "benchmark",
+		Short: "benchmark Ziti components",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	benchmarkCmd.AddCommand(newBenchmarkControllerCmd(p))
+	return benchmarkCmd
+}
@@ -17,8 +17,11 @@
 package cmd
 
 import (
-	"github.com/spf13/cobra"
 	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/lets_encrypt"
@@ -42,10 +45,26 @@ type PKIFlags struct {
 	PKIProvince           string
 	CAFile                string
 	CAName                string
+	CAKeyURI              string
+	KMSKeyURI             string
+	CAKeyPassword         string
+	CAKeyPasswordFile     string
+	KeyPassword           string
+	KeyPasswordFile       string
+	PromptKeyPassword     bool
+	CrossSignCA           string
+	PKIBackend            string
+	VaultAddr             string
+	VaultToken            string
+	VaultMount            string
+	VaultPrefix           string
 	CommonName            string
 	CAExpire              int
 	CAMaxpath             int
 	CAPrivateKeySize      int
+	KeyAlgorithm          string
+	Curve                 string
+	SignatureAlgorithm    string
 	IntermediateFile      string
 	IntermediateName      string
 	ServerFile            string
@@ -59,12 +78,41 @@ type PKIFlags struct {
 	DNSName               []string
 	IP                    []string
 	Email                 []string
+	URI                   []string
+	SpiffeID              string
+	KeyUsage              []string
+	ExtKeyUsage           []string
+	PermittedDNS          []string
+	ExcludedDNS           []string
+	PermittedIP           []string
+	Organization          []string
+	OrganizationalUnit    []string
+	Country               []string
+	Locality              []string
+	Province              []string
+	AutoDNSFromConfig     string
+	SerialStrategy        string
+	Serial                string
+	JSON                  bool
+	Output                pkiOutputFormat
 	PKI                   *pki.ZitiPKI
 }
 
+const (
+	PKIBackendLocal = "local"
+	PKIBackendVault = "vault"
+)
+
+// PKIBackends are the stores a PKI may be kept in
+var PKIBackends = []string{PKIBackendLocal, PKIBackendVault}
+
 var (
 	pkiLong = templates.LongDesc(`
 Provide the components needed to manage a Ziti PKI.
+
+Commands which create, change, export or report on the PKI accept --output json or --output yaml (--json for short)
+to output what they did, such as the paths written, serial numbers, fingerprints and expiry, instead of progress
+messages, so that scripts can capture it.
 	`)
 )
 
@@ -90,12 +138,44 @@ func NewCmdPKI(out io.Writer, errOut io.Writer) *cobra.Command {
 	}
 
 	cmd.AddCommand(NewCmdPKICreate(out, errOut))
+	cmd.AddCommand(NewCmdPKIList(out, errOut))
+	cmd.AddCommand(NewCmdPKIDescribe(out, errOut))
+	cmd.AddCommand(NewCmdPKIVerify(out, errOut))
+	cmd.AddCommand(NewCmdPKICheckExpiry(out, errOut))
+	cmd.AddCommand(NewCmdPKICheckEndpoints(out, errOut))
+	cmd.AddCommand(NewCmdPKIRenew(out, errOut))
+	cmd.AddCommand(NewCmdPKISign(out, errOut))
+	cmd.AddCommand(NewCmdPKIRevoke(out, errOut))
+	cmd.AddCommand(NewCmdPKIExport(out, errOut))
+	cmd.AddCommand(NewCmdPKIImport(out, errOut))
+	cmd.AddCommand(NewCmdPKIMigrate(out, errOut))
+	cmd.AddCommand(NewCmdPKIAudit(out, errOut))
 
 	cmd.AddCommand(lets_encrypt.NewCmdLE(out, errOut))
 
+	options.addPKIBackendFlags(cmd)
 	return cmd
 }
 
+func (options *PKIOptions) addPKIBackendFlags(cmd *cobra.Command) {
+	viperLock.Lock()
+	cmd.PersistentFlags().StringVarP(&options.Flags.PKIBackend, "pki-backend", "", PKIBackendLocal, "Where the PKI is stored ("+strings.Join(PKIBackends, ", ")+")")
+	viper.BindPFlag("pki-backend", cmd.PersistentFlags().Lookup("pki-backend"))
+
+	cmd.PersistentFlags().StringVarP(&options.Flags.VaultAddr, "vault-addr", "", "", "Address of the Vault server, when the PKI backend is vault. Defaults to VAULT_ADDR")
+	viper.BindPFlag("vault-addr", cmd.PersistentFlags().Lookup("vault-addr"))
+
+	cmd.PersistentFlags().StringVarP(&options.Flags.VaultToken, "vault-token", "", "", "Vault token, when the PKI backend is vault. Defaults to VAULT_TOKEN or the token saved by 'vault login'")
+	viper.BindPFlag("vault-token", cmd.PersistentFlags().Lookup("vault-token"))
+
+	cmd.PersistentFlags().StringVarP(&options.Flags.VaultMount, "vault-mount", "", "secret", "Path at which the Vault KV version 2 secrets engine is mounted")
+	viper.BindPFlag("vault-mount", cmd.PersistentFlags().Lookup("vault-mount"))
+
+	cmd.PersistentFlags().StringVarP(&options.Flags.VaultPrefix, "vault-prefix", "", "ziti-pki", "Path within the Vault mount under which the PKI is stored")
+	viper.BindPFlag("vault-prefix", cmd.PersistentFlags().Lookup("vault-prefix"))
+	viperLock.Unlock()
+}
+
 // Run implements this command
 func (o *PKIOptions) Run() error {
 	return o.Cmd.Help()
@@ -0,0 +1,217 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pkiAuditListLong = templates.LongDesc(`
+Lists the audit log of a PKI, which records every certificate issued, renewed and revoked, when, by whom and by which
+CA, and certificates removed again when a batch fails part way. The log is kept in the audit.jsonl file of the PKI root, or in a secret per record under _audit with the vault backend.
+
+Each record holds the hash of the record before it, so that changing or removing a record in the middle of the log
+breaks the chain. The whole chain is verified each time the log is listed, and the command exits with code 5 if it's
+broken. The hashes aren't keyed, so the chain catches careless edits, not someone who can write the log and recomputes
+the hashes of the records after the ones they change. Records removed from the end of audit.jsonl go unnoticed, while
+the vault backend keeps the last record's sequence number and hash apart from the records, so removing or changing
+the last records is noticed there. Keep the log where only the operators of the PKI can write it.
+	`)
+
+	pkiAuditListExample = templates.Examples(`
+		# list the certificates revoked in the last 30 days
+		ziti pki audit list --pki-root ./pki --operation revoke --since 30d
+
+		# export the issuance history of a CA for a compliance review
+		ziti pki audit list --pki-root ./pki --ca-name intermediate --output json
+	`)
+)
+
+// pkiAuditListResult is the output of pki audit list
+type pkiAuditListResult struct {
+	ChainIntact bool                 `json:"chainIntact"`
+	ChainError  string               `json:"chainError,omitempty"`
+	Records     []*store.AuditRecord `json:"records"`
+}
+
+// PKIAuditListOptions the options for the pki audit list command
+type PKIAuditListOptions struct {
+	PKICreateOptions
+
+	operation string
+	name      string
+	serial    string
+	since     string
+}
+
+// NewCmdPKIAudit creates a command object for the "pki audit" command
+func NewCmdPKIAudit(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Queries the audit log of the certificates issued, renewed and revoked",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(NewCmdPKIAuditList(out, errOut))
+	return cmd
+}
+
+// NewCmdPKIAuditList creates a command object for the "pki audit list" command
+func NewCmdPKIAuditList(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIAuditListOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "Lists the audit log and verifies its hash chain",
+		Long:    pkiAuditListLong,
+		Example: pkiAuditListExample,
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Only list records of this CA")
+	cmd.Flags().StringVarP(&options.operation, "operation", "", "", "Only list records of this operation ("+strings.Join(store.AuditOperations, ", ")+")")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Only list records of certificates with a name matching this pattern")
+	cmd.Flags().StringVarP(&options.serial, "serial", "", "", "Only list records of the certificate with this serial number, in hex")
+	cmd.Flags().StringVarP(&options.since, "since", "", "", "Only list records written within this time, e.g. 30d, 2w or 72h")
+	options.addOutputFlags(cmd, "the matching records")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIAuditListOptions) Run() error {
+	if o.operation != "" && !stringz.Contains(store.AuditOperations, o.operation) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid operation %v, must be one of %v", o.operation, strings.Join(store.AuditOperations, ", "))
+	}
+	if _, err := path.Match(o.name, ""); err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid pattern %v: %v", o.name, err)
+	}
+	var since time.Time
+	if o.since != "" {
+		age, err := api.ParseAge(o.since)
+		if err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --since: %v", err)
+		}
+		since = time.Now().Add(-age)
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	records, err := pkiStore.AuditRecords()
+	if err != nil {
+		return err
+	}
+
+	result := &pkiAuditListResult{ChainIntact: true, Records: []*store.AuditRecord{}}
+	chainErr := store.VerifyAuditRecords(records)
+	if chainErr != nil {
+		result.ChainIntact = false
+		result.ChainError = chainErr.Error()
+	}
+
+	for _, record := range records {
+		if o.matches(record, since) {
+			result.Records = append(result.Records, record)
+		}
+	}
+
+	if o.structuredOutput() {
+		if err := o.writeResult(result); err != nil {
+			return err
+		}
+	} else if err := o.renderTable(result.Records); err != nil {
+		return err
+	}
+
+	if chainErr != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "the audit log has been tampered with: %v", chainErr)
+	}
+	return nil
+}
+
+func (o *PKIAuditListOptions) renderTable(records []*store.AuditRecord) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(o.Out, "no matching records found")
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Seq", "Time", "Operation", "CA", "Name", "Serial", "Subject", "Not After", "Actor"})
+	for _, record := range records {
+		notAfter := ""
+		if record.NotAfter != nil {
+			notAfter = record.NotAfter.Format("2006-01-02 15:04:05")
+		}
+		t.AppendRow(table.Row{record.Seq, record.Time.Local().Format("2006-01-02 15:04:05"), record.Operation, record.CA,
+			record.Name, record.Serial, record.Subject, notAfter, record.Actor})
+	}
+	t.SetOutputMirror(o.Out)
+	t.Render()
+	return nil
+}
+
+func (o *PKIAuditListOptions) matches(record *store.AuditRecord, since time.Time) bool {
+	if o.operation != "" && record.Operation != o.operation {
+		return false
+	}
+	if o.Flags.CAName != "" && record.CA != o.Flags.CAName {
+		return false
+	}
+	if o.name != "" && !pkiGlobMatch(o.name, record.Name) {
+		return false
+	}
+	if o.serial != "" && !strings.EqualFold(strings.TrimLeft(o.serial, "0"), strings.TrimLeft(record.Serial, "0")) {
+		return false
+	}
+	return since.IsZero() || !record.Time.Before(since)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIAuditListVerifiesChain(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) *pkiAuditListResult {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		if args[0] != "audit" {
+			return nil
+		}
+		result := &pkiAuditListResult{}
+		req.NoError(json.Unmarshal(out.Bytes(), result))
+		return result
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "web", "--dns", "web.example.com", "--key-algorithm", "ecdsa")
+	run("renew", "--pki-root", root, "--ca-name", "root", "--name", "web")
+	run("revoke", "--pki-root", root, "--ca-name", "root", "--cert", "web")
+
+	result := run("audit", "list", "--pki-root", root, "-j")
+	req.True(result.ChainIntact)
+	var operations []string
+	for _, record := range result.Records {
+		operations = append(operations, record.Operation+":"+record.CA+"/"+record.Name)
+	}
+	req.Equal([]string{"issue:root/root", "issue:root/web", "renew:root/web", "revoke:root/web"}, operations)
+
+	// the revocation is of the renewed certificate, which is the one left in the index
+	renewed, revoked := result.Records[2], result.Records[3]
+	req.Equal(renewed.Serial, revoked.Serial)
+	req.Equal(renewed.Subject, revoked.Subject)
+	req.NotEqual(result.Records[1].Serial, renewed.Serial)
+
+	result = run("audit", "list", "--pki-root", root, "--operation", "renew", "--serial", strings.ToLower(renewed.Serial), "-j")
+	req.Len(result.Records, 1)
+	req.Equal(int64(3), result.Records[0].Seq)
+
+	auditPath := filepath.Join(root, store.LocalAuditFile)
+	data, err := ioutil.ReadFile(auditPath)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(auditPath, bytes.Replace(data, []byte(`"name":"web"`), []byte(`"name":"api"`), 1), 0644))
+
+	records, err := (&store.Local{Root: root}).AuditRecords()
+	req.NoError(err)
+	req.EqualError(store.VerifyAuditRecords(records), "audit record 2 was changed after it was written")
+
+	req.EqualError(store.VerifyAuditRecords(append(records[:1], records[2:]...)), "audit record 3 follows record 1, records are missing or reordered")
+}
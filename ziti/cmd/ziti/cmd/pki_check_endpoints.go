@@ -0,0 +1,374 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCheckEndpointsLong = templates.LongDesc(`
+Connects to each TLS endpoint listed in an endpoints file, such as the controller and routers, and checks that the
+certificate chain it serves matches the certificates currently issued from the PKI root. This detects deployments
+which still serve a certificate that was since renewed, rotated or revoked.
+
+Each endpoint is reported with one of these statuses:
+
+  * ok: the endpoint serves a current certificate from the PKI with a complete chain
+  * stale: the certificate, or a CA in the served chain, was issued by the PKI but since replaced
+  * revoked: the certificate has been revoked
+  * expired: the certificate has expired
+  * foreign: the certificate wasn't issued by a CA in the PKI
+  * incomplete: the served chain is missing intermediate CAs needed to verify the certificate
+  * name-mismatch: the certificate isn't valid for the endpoint's server name
+  * unreachable: no TLS connection could be made
+
+The command exits with code 5 if any endpoint isn't ok.
+
+The endpoints file has a list of endpoints, each with a name, an address and optionally the server name to verify
+the certificate against, which defaults to the host of the address.
+	`)
+
+	pkiCheckEndpointsExample = templates.Examples(`
+		# an endpoints file
+		endpoints: [{name: ctrl, address: "ctrl.example.com:6262"}, {name: router1, address: "10.0.0.11:3022", serverName: router1.example.com}]
+
+		# check the endpoints after rotating certificates
+		ziti pki check-endpoints --pki-root ./pki --endpoints endpoints.yaml
+	`)
+)
+
+const (
+	endpointStatusOk           = "ok"
+	endpointStatusStale        = "stale"
+	endpointStatusRevoked      = "revoked"
+	endpointStatusExpired      = "expired"
+	endpointStatusForeign      = "foreign"
+	endpointStatusIncomplete   = "incomplete"
+	endpointStatusNameMismatch = "name-mismatch"
+	endpointStatusUnreachable  = "unreachable"
+)
+
+// pkiEndpoint is an endpoint in an endpoints file
+type pkiEndpoint struct {
+	Name       string `yaml:"name"`
+	Address    string `yaml:"address"`
+	ServerName string `yaml:"serverName"`
+}
+
+// pkiEndpointsFile is the file listing the endpoints for pki check-endpoints
+type pkiEndpointsFile struct {
+	Endpoints []*pkiEndpoint `yaml:"endpoints"`
+}
+
+// pkiEndpointResult is the result of checking an endpoint, as output by pki check-endpoints
+type pkiEndpointResult struct {
+	Name     string     `json:"name"`
+	Address  string     `json:"address"`
+	Status   string     `json:"status"`
+	Cert     string     `json:"cert,omitempty"`
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+	Detail   string     `json:"detail,omitempty"`
+}
+
+// pkiCert is a certificate in the PKI
+type pkiCert struct {
+	entry *store.IndexEntry
+	cert  *x509.Certificate
+}
+
+// PKICheckEndpointsOptions the options for the pki check-endpoints command
+type PKICheckEndpointsOptions struct {
+	PKICreateOptions
+
+	endpointsFile string
+	timeout       time.Duration
+}
+
+// NewCmdPKICheckEndpoints creates a command object for the "pki check-endpoints" command
+func NewCmdPKICheckEndpoints(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKICheckEndpointsOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "check-endpoints",
+		Short:   "Checks that live TLS endpoints serve current certificates from the PKI",
+		Long:    pkiCheckEndpointsLong,
+		Example: pkiCheckEndpointsExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.endpointsFile, "endpoints", "f", "", "YAML file listing the endpoints to check")
+	cmd.Flags().DurationVar(&options.timeout, "timeout", 5*time.Second, "Timeout for connecting to each endpoint")
+	options.addOutputFlags(cmd, "the results")
+	_ = cmd.MarkFlagRequired("endpoints")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKICheckEndpointsOptions) Run() error {
+	endpoints, err := o.loadEndpoints()
+	if err != nil {
+		return err
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+	local, ok := pkiStore.(*store.Local)
+	if !ok {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "checking endpoints is only supported for the %v PKI backend", PKIBackendLocal)
+	}
+
+	index, err := local.ReadIndex()
+	if err != nil {
+		return err
+	}
+
+	var certs []*pkiCert
+	for _, entry := range index.Entries {
+		if entry.Type == store.EntryTypeKey || entry.Type == store.EntryTypeCSR {
+			continue
+		}
+		raw, err := pkiStore.FetchCert(entry.CA, entry.Name)
+		if err != nil {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(raw); err == nil {
+			certs = append(certs, &pkiCert{entry: entry, cert: cert})
+		}
+	}
+
+	var results []*pkiEndpointResult
+	failed := 0
+	for _, endpoint := range endpoints {
+		result := o.checkEndpoint(endpoint, certs)
+		if result.Status != endpointStatusOk {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if o.structuredOutput() {
+		if err := o.writeResult(results); err != nil {
+			return err
+		}
+	} else {
+		t := table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.AppendHeader(table.Row{"Name", "Address", "Status", "Certificate", "Not After", "Detail"})
+		for _, result := range results {
+			notAfter := ""
+			if result.NotAfter != nil {
+				notAfter = result.NotAfter.Format("2006-01-02 15:04:05")
+			}
+			t.AppendRow(table.Row{result.Name, result.Address, strings.ToUpper(result.Status), result.Cert, notAfter, result.Detail})
+		}
+		t.SetOutputMirror(o.Out)
+		t.Render()
+	}
+
+	if failed > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v of %v endpoints aren't serving current certificates from the PKI", failed, len(results))
+	}
+	return nil
+}
+
+func (o *PKICheckEndpointsOptions) loadEndpoints() ([]*pkiEndpoint, error) {
+	data, err := ioutil.ReadFile(o.endpointsFile)
+	if err != nil {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "unable to read endpoints file %v: %v", o.endpointsFile, err)
+	}
+
+	file := &pkiEndpointsFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unable to parse endpoints file %v: %v", o.endpointsFile, err)
+	}
+	if len(file.Endpoints) == 0 {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no endpoints found in %v", o.endpointsFile)
+	}
+
+	for i, endpoint := range file.Endpoints {
+		host, _, err := net.SplitHostPort(endpoint.Address)
+		if err != nil {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "endpoint %v: invalid address %v, must be host:port", i+1, endpoint.Address)
+		}
+		if endpoint.Name == "" {
+			endpoint.Name = endpoint.Address
+		}
+		if endpoint.ServerName == "" {
+			endpoint.ServerName = host
+		}
+	}
+	return file.Endpoints, nil
+}
+
+// checkEndpoint connects to the endpoint and compares the chain it serves with the certificates in the PKI
+func (o *PKICheckEndpointsOptions) checkEndpoint(endpoint *pkiEndpoint, certs []*pkiCert) *pkiEndpointResult {
+	result := &pkiEndpointResult{
+		Name:    endpoint.Name,
+		Address: endpoint.Address,
+	}
+
+	// the chain is verified below against the PKI rather than the system roots
+	dialer := &net.Dialer{Timeout: o.timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", endpoint.Address, &tls.Config{
+		ServerName:         endpoint.ServerName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		result.Status, result.Detail = endpointStatusUnreachable, err.Error()
+		return result
+	}
+	served := conn.ConnectionState().PeerCertificates
+	_ = conn.Close()
+
+	if len(served) == 0 {
+		result.Status, result.Detail = endpointStatusUnreachable, "no certificate served"
+		return result
+	}
+
+	leaf := served[0]
+	notAfter := leaf.NotAfter.UTC()
+	result.NotAfter = &notAfter
+	result.Cert = leaf.Subject.CommonName
+
+	current := findPKICert(certs, leaf)
+	if current != nil {
+		result.Cert = current.entry.CA + "/" + current.entry.Name
+	}
+
+	roots := x509.NewCertPool()
+	pkiIntermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if !c.cert.IsCA {
+			continue
+		}
+		if bytes.Equal(c.cert.RawIssuer, c.cert.RawSubject) {
+			roots.AddCert(c.cert)
+		} else {
+			pkiIntermediates.AddCert(c.cert)
+		}
+	}
+	servedIntermediates := x509.NewCertPool()
+	for _, c := range served[1:] {
+		servedIntermediates.AddCert(c)
+	}
+
+	verify := func(intermediates *x509.CertPool) error {
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   leaf.NotBefore.Add(time.Second),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+
+	switch {
+	case current != nil && current.entry.Revoked:
+		result.Status, result.Detail = endpointStatusRevoked, "serial "+current.entry.Serial+" has been revoked"
+	case verify(servedIntermediates) != nil && verify(pkiIntermediates) != nil:
+		result.Status, result.Detail = endpointStatusForeign, "issued by "+leaf.Issuer.CommonName+", which isn't a CA in the PKI"
+	case current == nil:
+		result.Status, result.Detail = endpointStatusStale, "issued by the PKI, but no longer its current certificate"
+		if replacement := findPKIReplacement(certs, leaf); replacement != nil {
+			result.Detail = "replaced by " + replacement.entry.CA + "/" + replacement.entry.Name + " (serial " + replacement.entry.Serial + ")"
+		}
+	case staleServedCA(certs, served[1:]) != "":
+		result.Status, result.Detail = endpointStatusStale, "serves outdated CA "+staleServedCA(certs, served[1:])
+	case verify(servedIntermediates) != nil:
+		result.Status, result.Detail = endpointStatusIncomplete, "the served chain is missing intermediate CAs"
+	case time.Now().After(leaf.NotAfter):
+		result.Status = endpointStatusExpired
+	case leaf.VerifyHostname(endpoint.ServerName) != nil:
+		result.Status, result.Detail = endpointStatusNameMismatch, "not valid for "+endpoint.ServerName
+	default:
+		result.Status = endpointStatusOk
+	}
+
+	return result
+}
+
+// findPKICert returns the PKI's entry for the given certificate, if it's current
+func findPKICert(certs []*pkiCert, cert *x509.Certificate) *pkiCert {
+	for _, c := range certs {
+		if c.cert.Equal(cert) {
+			return c
+		}
+	}
+	return nil
+}
+
+// findPKIReplacement returns the current certificate in the PKI with the subject of the given certificate, signed by
+// the same issuer
+func findPKIReplacement(certs []*pkiCert, cert *x509.Certificate) *pkiCert {
+	for _, c := range certs {
+		if bytes.Equal(c.cert.RawSubject, cert.RawSubject) && bytes.Equal(c.cert.RawIssuer, cert.RawIssuer) && !c.cert.IsCA {
+			return c
+		}
+	}
+	return nil
+}
+
+// staleServedCA returns the common name of the first served CA which isn't current in the PKI, but has the subject of
+// a CA in it
+func staleServedCA(certs []*pkiCert, served []*x509.Certificate) string {
+	for _, ca := range served {
+		if findPKICert(certs, ca) != nil {
+			continue
+		}
+		for _, c := range certs {
+			if c.cert.IsCA && bytes.Equal(c.cert.RawSubject, ca.RawSubject) {
+				return ca.Subject.CommonName
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serveTLS(t *testing.T, certFile, keyFile string) string {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestPKICheckEndpoints(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "inter", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "router1", "--ip", "127.0.0.1", "--key-algorithm", "ecdsa")
+	run("export", "chain", "--pki-root", root, "--ca-name", "inter", "--name", "router1", "--out", filepath.Join(root, "router1.chain.pem"))
+
+	certFile := filepath.Join(root, "inter", "certs", "router1.cert")
+	keyFile := filepath.Join(root, "inter", "keys", "router1.key")
+	complete := serveTLS(t, filepath.Join(root, "router1.chain.pem"), keyFile)
+	incomplete := serveTLS(t, certFile, keyFile)
+
+	// keep the current certificate, then replace it in the PKI
+	staleCert := filepath.Join(root, "router1.old.pem")
+	data, err := ioutil.ReadFile(certFile)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(staleCert, data, 0600))
+	staleKey := filepath.Join(root, "router1.old.key")
+	data, err = ioutil.ReadFile(keyFile)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(staleKey, data, 0600))
+	stale := serveTLS(t, staleCert, staleKey)
+
+	endpoints := filepath.Join(root, "endpoints.yaml")
+	writeEndpoints := func(addresses ...string) {
+		buf := &bytes.Buffer{}
+		buf.WriteString("endpoints:\n")
+		for i, address := range addresses {
+			_, _ = fmt.Fprintf(buf, "  - name: ep%v\n    address: %v\n", i, address)
+		}
+		req.NoError(ioutil.WriteFile(endpoints, buf.Bytes(), 0600))
+	}
+
+	check := func() ([]*pkiEndpointResult, error) {
+		out := &bytes.Buffer{}
+		options := &PKICheckEndpointsOptions{endpointsFile: endpoints, timeout: 5 * time.Second}
+		options.Out = out
+		options.Flags.PKIRoot = root
+		options.Flags.JSON = true
+		err := options.Run()
+		var results []*pkiEndpointResult
+		req.NoError(json.Unmarshal(out.Bytes(), &results))
+		return results, err
+	}
+
+	writeEndpoints(complete)
+	results, err := check()
+	req.NoError(err)
+	req.Equal(endpointStatusOk, results[0].Status)
+	req.Equal("inter/router1", results[0].Cert)
+
+	writeEndpoints(complete, incomplete)
+	results, err = check()
+	req.Error(err)
+	req.Equal(endpointStatusOk, results[0].Status)
+	req.Equal(endpointStatusIncomplete, results[1].Status)
+
+	run("renew", "--pki-root", root, "--ca-name", "inter", "--name", "router1")
+
+	writeEndpoints(stale)
+	results, err = check()
+	req.Error(err)
+	req.Equal(endpointStatusStale, results[0].Status)
+}
@@ -0,0 +1,399 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCheckExpiryLong = templates.LongDesc(`
+Checks when the certificates in a PKI root, or those referenced by router and controller config files, expire. Lists
+the certificates which have expired or expire within --threshold, and exits with code 5 if there are any, so it can be
+run from cron or a monitoring system.
+
+With --config, the identity certificates, server certificates and CA bundles referenced by the config file are
+checked, including those of web listeners and the edge enrollment signer. Every certificate in a bundle is checked.
+
+With --nagios, a single status line is printed and the exit code follows the Nagios plugin convention: 0 when all
+certificates are OK, 1 when any expire within --threshold, 2 when any have expired or expire within --critical, and
+3 when they couldn't be checked.
+	`)
+
+	pkiCheckExpiryExample = templates.Examples(`
+		# list the certificates in the PKI root which expire within 30 days
+		ziti pki check-expiry --pki-root ./pki --threshold 30d
+
+		# check the certificates used by a router, from a Nagios check
+		ziti pki check-expiry --config /etc/ziti/router.yml --threshold 30d --critical 7d --nagios
+	`)
+)
+
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+// pkiExpiryEntry is a checked certificate as output by pki check-expiry
+type pkiExpiryEntry struct {
+	Source     string    `json:"source"`
+	Name       string    `json:"name"`
+	CommonName string    `json:"commonName"`
+	NotAfter   time.Time `json:"notAfter"`
+	DaysLeft   int       `json:"daysLeft"`
+	Expired    bool      `json:"expired"`
+	Critical   bool      `json:"critical,omitempty"`
+}
+
+// PKICheckExpiryOptions the options for the pki check-expiry command
+type PKICheckExpiryOptions struct {
+	PKICreateOptions
+
+	configFiles []string
+	threshold   string
+	critical    string
+	all         bool
+	nagios      bool
+
+	nagiosReported bool
+}
+
+// NewCmdPKICheckExpiry creates a command object for the "pki check-expiry" command
+func NewCmdPKICheckExpiry(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKICheckExpiryOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "check-expiry",
+		Short:   "Checks for certificates which have expired or expire soon",
+		Long:    pkiCheckExpiryLong,
+		Example: pkiCheckExpiryExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringSliceVar(&options.configFiles, "config", nil, "Router or controller config file whose certificates to check, instead of a PKI root")
+	cmd.Flags().StringVar(&options.threshold, "threshold", "30d", "Report certificates expiring within this time, e.g. 30d, 2w or 72h")
+	cmd.Flags().StringVar(&options.critical, "critical", "", "Treat certificates expiring within this time as critical, in addition to expired ones")
+	cmd.Flags().BoolVar(&options.all, "all", false, "List all the certificates checked, not only those expiring")
+	cmd.Flags().BoolVar(&options.nagios, "nagios", false, "Print a single Nagios status line and exit with a Nagios plugin exit code")
+	options.addOutputFlags(cmd, "the certificates")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKICheckExpiryOptions) Run() error {
+	err := o.run()
+	if err != nil && o.nagios && !o.nagiosReported {
+		_, _ = fmt.Fprintf(o.Out, "PKI UNKNOWN - %v\n", err)
+		return cmdhelper.WithExitCode(nagiosUnknown, err)
+	}
+	return err
+}
+
+func (o *PKICheckExpiryOptions) run() error {
+	threshold, err := api.ParseAge(o.threshold)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --threshold: %v", err)
+	}
+	critical := time.Duration(0)
+	if o.critical != "" {
+		if critical, err = api.ParseAge(o.critical); err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --critical: %v", err)
+		}
+	}
+
+	var entries []*pkiExpiryEntry
+	if len(o.configFiles) > 0 {
+		for _, configFile := range o.configFiles {
+			configEntries, err := expiryEntriesFromConfig(configFile)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, configEntries...)
+		}
+	} else {
+		if entries, err = o.expiryEntriesFromPKI(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	var expiring []*pkiExpiryEntry
+	criticalCount := 0
+	for _, entry := range entries {
+		remaining := entry.NotAfter.Sub(now)
+		entry.DaysLeft = int(remaining.Hours() / 24)
+		entry.Expired = remaining <= 0
+		entry.Critical = entry.Expired || (o.critical != "" && remaining <= critical)
+		if entry.Critical {
+			criticalCount++
+		}
+		if remaining <= threshold || entry.Critical {
+			expiring = append(expiring, entry)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+	})
+
+	if o.nagios {
+		return o.outputNagios(entries, expiring, criticalCount)
+	}
+
+	listed := expiring
+	if o.all {
+		listed = entries
+	}
+
+	if o.structuredOutput() {
+		if listed == nil {
+			listed = []*pkiExpiryEntry{}
+		}
+		if err := o.writeResult(listed); err != nil {
+			return err
+		}
+	} else if len(listed) > 0 {
+		t := table.NewWriter()
+		t.SetStyle(table.StyleRounded)
+		t.AppendHeader(table.Row{"Source", "Name", "Common Name", "Not After", "Days Left"})
+		for _, entry := range listed {
+			daysLeft := fmt.Sprintf("%d", entry.DaysLeft)
+			if entry.Expired {
+				daysLeft = "expired"
+			}
+			t.AppendRow(table.Row{entry.Source, entry.Name, entry.CommonName, entry.NotAfter.Format("2006-01-02 15:04:05"), daysLeft})
+		}
+		t.SetOutputMirror(o.Out)
+		t.Render()
+	}
+
+	if len(expiring) > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v of %v certificates have expired or expire within %v", len(expiring), len(entries), o.threshold)
+	}
+	if !o.structuredOutput() {
+		_, err = fmt.Fprintf(o.Out, "none of the %v certificates checked expire within %v\n", len(entries), o.threshold)
+	}
+	return err
+}
+
+func (o *PKICheckExpiryOptions) outputNagios(entries, expiring []*pkiExpiryEntry, criticalCount int) error {
+	var names []string
+	for _, entry := range expiring {
+		status := fmt.Sprintf("%vd", entry.DaysLeft)
+		if entry.Expired {
+			status = "expired"
+		}
+		names = append(names, fmt.Sprintf("%v (%v)", entry.Name, status))
+	}
+
+	var status string
+	code := nagiosOK
+	switch {
+	case criticalCount > 0:
+		status, code = "CRITICAL", nagiosCritical
+	case len(expiring) > 0:
+		status, code = "WARNING", nagiosWarning
+	default:
+		status = "OK"
+	}
+
+	msg := fmt.Sprintf("%v certificates checked, none expire within %v", len(entries), o.threshold)
+	if len(expiring) > 0 {
+		msg = fmt.Sprintf("%v of %v certificates expiring: %v", len(expiring), len(entries), strings.Join(names, ", "))
+	}
+	o.nagiosReported = true
+	if _, err := fmt.Fprintf(o.Out, "PKI %v - %v | expiring=%v;;;0 critical=%v;;;0\n", status, msg, len(expiring), criticalCount); err != nil {
+		return err
+	}
+
+	if code != nagiosOK {
+		return cmdhelper.Errorf(code, "%v", msg)
+	}
+	return nil
+}
+
+// expiryEntriesFromPKI returns the CA and leaf certificates in the PKI root which haven't been revoked
+func (o *PKICheckExpiryOptions) expiryEntriesFromPKI() ([]*pkiExpiryEntry, error) {
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return nil, err
+	}
+	local, ok := pkiStore.(*store.Local)
+	if !ok {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "checking a PKI root is only supported for the %v PKI backend, use --config", PKIBackendLocal)
+	}
+
+	index, err := local.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*pkiExpiryEntry
+	for _, entry := range index.Entries {
+		if entry.NotAfter == nil || entry.Revoked || entry.Type == store.EntryTypeCSR || entry.Type == store.EntryTypeKey {
+			continue
+		}
+		result = append(result, &pkiExpiryEntry{
+			Source:     entry.Type,
+			Name:       entry.CA + "/" + entry.Name,
+			CommonName: entry.CommonName,
+			NotAfter:   *entry.NotAfter,
+		})
+	}
+	return result, nil
+}
+
+// pkiConfigCertKeys are the config keys which reference certificates or CA bundles
+var pkiConfigCertKeys = map[string]bool{
+	"cert":        true,
+	"server_cert": true,
+	"ca":          true,
+}
+
+// expiryEntriesFromConfig returns the certificates referenced by a router or controller config file
+func expiryEntriesFromConfig(configFile string) ([]*pkiExpiryEntry, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %v: %v", configFile, err)
+	}
+
+	config := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %v: %v", configFile, err)
+	}
+
+	var paths []string
+	var walk func(key string, val interface{})
+	walk = func(key string, val interface{}) {
+		switch v := val.(type) {
+		case map[interface{}]interface{}:
+			for k, child := range v {
+				walk(fmt.Sprintf("%v", k), child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(key, child)
+			}
+		case string:
+			if pkiConfigCertKeys[key] {
+				paths = appendMissing(paths, v)
+			}
+		}
+	}
+	walk("", config)
+	sort.Strings(paths)
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no certificates found in config file %v", configFile)
+	}
+
+	var result []*pkiExpiryEntry
+	for _, ref := range paths {
+		certs, path, err := loadConfigCerts(configFile, ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			result = append(result, &pkiExpiryEntry{
+				Source:     filepath.Base(configFile),
+				Name:       path,
+				CommonName: cert.Subject.CommonName,
+				NotAfter:   cert.NotAfter,
+			})
+		}
+	}
+	return result, nil
+}
+
+// loadConfigCerts loads the certificates referenced from a config file. References may be file paths, optionally
+// prefixed with file:, or inline PEM prefixed with pem:. Relative paths which don't exist relative to the working
+// directory are tried relative to the config file
+func loadConfigCerts(configFile, ref string) ([]*x509.Certificate, string, error) {
+	var data []byte
+	path := ref
+	if strings.HasPrefix(ref, "pem:") {
+		data, path = []byte(strings.TrimPrefix(ref, "pem:")), "inline PEM"
+	} else {
+		path = os.ExpandEnv(strings.TrimPrefix(strings.TrimPrefix(ref, "file://"), "file:"))
+		if _, err := os.Stat(path); err != nil && !filepath.IsAbs(path) {
+			if relative := filepath.Join(filepath.Dir(configFile), path); fileExists(relative) {
+				path = relative
+			}
+		}
+		var err error
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, path, fmt.Errorf("unable to read certificate %v referenced by %v: %v", path, configFile, err)
+		}
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, path, fmt.Errorf("unable to parse certificate in %v referenced by %v: %v", path, configFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, path, fmt.Errorf("no certificates found in %v referenced by %v", path, configFile)
+	}
+	return certs, path, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
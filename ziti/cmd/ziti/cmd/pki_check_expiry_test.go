@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKICheckExpiry(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa"})
+	req.NoError(cmd.Execute())
+
+	cmd = NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "router1",
+		"--dns", "router1.example.com", "--key-algorithm", "ecdsa", "--expire-limit", "10"})
+	req.NoError(cmd.Execute())
+
+	out := &bytes.Buffer{}
+	options := &PKICheckExpiryOptions{threshold: "30d"}
+	options.Out = out
+	options.Flags.PKIRoot = root
+	err := options.Run()
+	req.Error(err)
+	req.Equal(cmdhelper.ExitCodeValidation, cmdhelper.ExitCodeForError(err))
+	req.Contains(out.String(), "root/router1")
+	req.NotContains(out.String(), "root/root")
+
+	out.Reset()
+	options = &PKICheckExpiryOptions{threshold: "5d"}
+	options.Out = out
+	options.Flags.PKIRoot = root
+	req.NoError(options.Run())
+	req.Contains(out.String(), "none of the 2 certificates checked expire within 5d")
+
+	config := filepath.Join(root, "router.yml")
+	req.NoError(ioutil.WriteFile(config, []byte(fmt.Sprintf(`
+identity:
+  cert: %v
+  server_cert: %v
+  key: %v
+  ca: root/certs/root.cert
+`, filepath.Join(root, "root", "certs", "router1.cert"), filepath.Join(root, "root", "certs", "router1.cert"),
+		filepath.Join(root, "root", "keys", "router1.key"))), 0600))
+
+	out.Reset()
+	options = &PKICheckExpiryOptions{threshold: "30d", critical: "7d", nagios: true, configFiles: []string{config}}
+	options.Out = out
+	err = options.Run()
+	req.Equal(nagiosWarning, cmdhelper.ExitCodeForError(err))
+	req.Contains(out.String(), "PKI WARNING - 1 of 2 certificates expiring")
+
+	out.Reset()
+	options = &PKICheckExpiryOptions{threshold: "30d", nagios: true, configFiles: []string{filepath.Join(root, "missing.yml")}}
+	options.Out = out
+	err = options.Run()
+	req.Equal(nagiosUnknown, cmdhelper.ExitCodeForError(err))
+	req.Contains(out.String(), "PKI UNKNOWN")
+}
@@ -20,11 +20,9 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"strings"
 	"sync"
 	"time"
@@ -33,6 +31,8 @@ import (
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
 	"github.com/spf13/viper"
 )
 
@@ -68,8 +68,11 @@ func NewCmdPKICreate(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd.AddCommand(NewCmdPKICreateIntermediate(out, errOut))
 	cmd.AddCommand(NewCmdPKICreateKey(out, errOut))
 	cmd.AddCommand(NewCmdPKICreateServer(out, errOut))
+	cmd.AddCommand(NewCmdPKICreateSelfSigned(out, errOut))
 	cmd.AddCommand(NewCmdPKICreateClient(out, errOut))
 	cmd.AddCommand(NewCmdPKICreateCSR(out, errOut))
+	cmd.AddCommand(NewCmdPKICreateCRL(out, errOut))
+	cmd.AddCommand(NewCmdPKICreateBatch(out, errOut))
 
 	options.addPKICreateFlags(cmd)
 	return cmd
@@ -111,6 +114,45 @@ func (options *PKICreateOptions) addPKICreateFlags(cmd *cobra.Command) {
 	viperLock.Unlock()
 }
 
+// addKeyAlgorithmFlags adds the flags selecting the type of private key to generate
+func (o *PKICreateOptions) addKeyAlgorithmFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Flags.KeyAlgorithm, "key-algorithm", "", pki.KeyAlgorithmRSA, "Algorithm of the private key ("+strings.Join(pki.KeyAlgorithms, ", ")+")")
+	cmd.Flags().StringVarP(&o.Flags.Curve, "curve", "", pki.Curves[0], "Elliptic curve of ecdsa private keys ("+strings.Join(pki.Curves, ", ")+")")
+}
+
+// addSignatureAlgorithmFlag adds the flag selecting the algorithm the new certificate is signed with
+func (o *PKICreateOptions) addSignatureAlgorithmFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.Flags.SignatureAlgorithm, "signature-algorithm", "", "Algorithm to sign with ("+strings.Join(pki.SignatureAlgorithms, ", ")+"). SHA256, SHA384 and SHA512 use the RSA or ECDSA algorithm matching the signing key. Defaults to the signing key's default")
+}
+
+// addCAKeyFlags adds the flags selecting where the private key of the signing CA is held
+func (o *PKICreateOptions) addCAKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Flags.CAKeyURI, "ca-key-uri", "", "", "PKCS #11 URI of the signing CA's private key, when it's held in an HSM instead of the PKI root. The CA's certificate must still be in the PKI root")
+	cmd.Flags().StringVar(&o.Flags.KMSKeyURI, "kms-key-uri", "", "URI of the signing CA's private key, when it's held in AWS KMS (awskms:///<key id>?region=<region>) or GCP Cloud KMS (gcpkms://projects/.../cryptoKeyVersions/<version>) instead of the PKI root. The CA's certificate must still be in the PKI root")
+	o.addCAKeyPasswordFlags(cmd)
+}
+
+// ObtainSigner returns the Signer providing the private key of the signing CA, from an HSM or KMS, or nil if it's read
+// from the PKI root
+func (o *PKICreateOptions) ObtainSigner() (pki.Signer, error) {
+	if o.Flags.KMSKeyURI != "" {
+		if o.Flags.CAKeyURI != "" {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--ca-key-uri and --kms-key-uri can't be combined")
+		}
+		if err := pki.ValidateKMSURI(o.Flags.KMSKeyURI); err != nil {
+			return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		return &pki.KMSSigner{URI: o.Flags.KMSKeyURI}, nil
+	}
+	if o.Flags.CAKeyURI == "" {
+		return nil, nil
+	}
+	if _, err := pki.ParsePKCS11URI(o.Flags.CAKeyURI); err != nil {
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	return &pki.PKCS11Signer{URI: o.Flags.CAKeyURI}, nil
+}
+
 // Run implements this command
 func (o *PKICreateOptions) Run() error {
 	return o.Cmd.Help()
@@ -135,6 +177,27 @@ func (o *PKICreateOptions) ObtainPKIRoot() (string, error) {
 	return pkiroot, nil
 }
 
+// ObtainPKIStore returns the store in which the PKI resides, selected by pki-backend, and the PKI root if it's local
+func (o *PKICreateOptions) ObtainPKIStore() (store.Store, string, error) {
+	switch backend := viper.GetString("pki-backend"); backend {
+	case "", PKIBackendLocal:
+		pkiroot, err := o.ObtainPKIRoot()
+		if err != nil {
+			return nil, "", err
+		}
+		return &store.Local{Root: pkiroot}, pkiroot, nil
+	case PKIBackendVault:
+		vault, err := store.NewVaultFromEnv(viper.GetString("vault-addr"), viper.GetString("vault-token"),
+			viper.GetString("vault-mount"), viper.GetString("vault-prefix"))
+		if err != nil {
+			return nil, "", cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		return vault, "", nil
+	default:
+		return nil, "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid PKI backend %v, must be one of %v", backend, strings.Join(PKIBackends, ", "))
+	}
+}
+
 // ObtainCAFile returns the value for ca-file
 func (o *PKICreateOptions) ObtainCAFile() (string, error) {
 	cafile := o.Flags.CAFile
@@ -182,7 +245,10 @@ func (o *PKICreateOptions) ObtainIntermediateCSRFile() (string, error) {
 
 // ObtainCSRFile returns the value for csr-file
 func (o *PKICreateOptions) ObtainCSRFile() (string, error) {
-	csrfile := viper.GetString("csr-file")
+	csrfile := o.Flags.CSRFile
+	if csrfile == "" {
+		csrfile = viper.GetString("csr-file")
+	}
 	if csrfile == "" {
 		var err error
 		csrfile, err = util.PickValue("Required flag 'csr-file' not specified; Enter CSR name now:", "csr", true)
@@ -250,25 +316,29 @@ func (o *PKICreateOptions) ObtainCAName(pkiroot string) (string, error) {
 		caname = viper.GetString("ca-name")
 		if caname == "" {
 			var err error
-			files, err := ioutil.ReadDir(pkiroot)
+			var pkiStore store.Store = &store.Local{Root: pkiroot}
+			if o.Flags.PKI != nil {
+				pkiStore = o.Flags.PKI.Store
+			}
+			dirs, err := pkiStore.CANames()
 			if err != nil {
 				return "", err
 			}
 			names := make([]string, 0)
-			for _, f := range files {
-				if f.IsDir() {
-					if f.Name() != "ca" {
-						names = append(names, f.Name())
-					}
+			for _, name := range dirs {
+				if name != "ca" {
+					names = append(names, name)
 				}
 			}
-			caname, err = util.PickName(names, "Required flag 'ca-name' not specified; choose from below (dirs seen in your ZITI_PKI_ROOT):")
+			caname, err = util.PickName(names, "Required flag 'ca-name' not specified; choose from below (CAs seen in your PKI):")
 			if err != nil {
 				return "", err
 			}
 		}
 	}
-	fmt.Println("Using CA name: ", caname)
+	if !o.structuredOutput() {
+		fmt.Println("Using CA name: ", caname)
+	}
 	return caname, nil
 }
 
@@ -298,33 +368,29 @@ func (o *PKICreateOptions) ObtainFileName(cafile string, commonName string) stri
 	return filename
 }
 
-// ObtainPKIRequestTemplate returns the 'template' used in the PKI request
-func (o *PKICreateOptions) ObtainPKIRequestTemplate(commonName string) *x509.Certificate {
-
-	subject := pkix.Name{CommonName: commonName}
-	if str := viper.GetString("pki-organization"); str != "" {
-		subject.Organization = []string{str}
+// ObtainPKIRequestTemplate returns the 'template' used in the PKI request, for a CA certificate if isCA is set, with the
+// key usages given by the key usage flags
+func (o *PKICreateOptions) ObtainPKIRequestTemplate(commonName string, isCA bool) (*x509.Certificate, error) {
+	keyUsage, extKeyUsage, err := o.ObtainKeyUsages(isCA)
+	if err != nil {
+		return nil, err
 	}
-	if str := viper.GetString("pki-locality"); str != "" {
-		subject.Locality = []string{str}
-	}
-	if str := viper.GetString("pki-country"); str != "" {
-		subject.Country = []string{str}
-	}
-	if str := viper.GetString("pki-state"); str != "" {
-		subject.Province = []string{str}
-	}
-	if str := viper.GetString("pki-organizational-unit"); str != "" {
-		subject.OrganizationalUnit = []string{str}
+
+	subject, err := o.ObtainSubject(commonName)
+	if err != nil {
+		return nil, err
 	}
 
 	template := &x509.Certificate{
-		Subject:    subject,
-		NotAfter:   time.Now().AddDate(0, 0, o.Flags.CAExpire),
-		MaxPathLen: o.Flags.CAMaxpath,
+		Subject:     subject,
+		NotAfter:    time.Now().AddDate(0, 0, o.Flags.CAExpire),
+		MaxPathLen:  o.Flags.CAMaxpath,
+		IsCA:        isCA,
+		KeyUsage:    keyUsage,
+		ExtKeyUsage: extKeyUsage,
 	}
 
-	return template
+	return template, nil
 }
 
 // ObtainKeyName returns the private key from the key-file
@@ -351,61 +417,34 @@ func (o *PKICreateOptions) ObtainKeyName(pkiroot string) (string, error) {
 	return keyname, nil
 }
 
-// ObtainPKICSRRequestTemplate returns the CSR 'template' used in the PKI request
-func (o *PKICreateOptions) ObtainPKICSRRequestTemplate(commonName string) *x509.CertificateRequest {
-
-	subject := pkix.Name{CommonName: commonName}
-	if str := viper.GetString("pki-organization"); str != "" {
-		subject.Organization = []string{str}
-	}
-	if str := viper.GetString("pki-locality"); str != "" {
-		subject.Locality = []string{str}
-	}
-	if str := viper.GetString("pki-country"); str != "" {
-		subject.Country = []string{str}
+// ObtainPKICSRRequestTemplate returns the CSR 'template' used in the PKI request, asking for a CA certificate if isCA is set
+func (o *PKICreateOptions) ObtainPKICSRRequestTemplate(commonName string, isCA bool) (*x509.CertificateRequest, error) {
+	subject, err := o.ObtainSubject(commonName)
+	if err != nil {
+		return nil, err
 	}
-	if str := viper.GetString("pki-state"); str != "" {
-		subject.Province = []string{str}
-	}
-	if str := viper.GetString("pki-organizational-unit"); str != "" {
-		subject.OrganizationalUnit = []string{str}
-	}
-
-	type basicConstraints struct {
-		IsCA       bool `asn1:"optional"`
-		MaxPathLen int  `asn1:"optional,default:-1"`
-	}
-
-	val, _ := asn1.Marshal(basicConstraints{true, 0})
 
 	csrTemplate := &x509.CertificateRequest{
 		Subject:            subject,
 		SignatureAlgorithm: x509.SHA512WithRSA,
-		ExtraExtensions: []pkix.Extension{
+	}
+
+	if isCA {
+		type basicConstraints struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+
+		val, _ := asn1.Marshal(basicConstraints{true, 0})
+
+		csrTemplate.ExtraExtensions = []pkix.Extension{
 			{
 				Id:       asn1.ObjectIdentifier{2, 5, 29, 19},
 				Value:    val,
 				Critical: true,
 			},
-		},
-	}
-
-	return csrTemplate
-}
-
-// ObtainIPsAndDNSNames returns the IP addrs and/or DNS names used in the PKI request template
-func (o *PKICreateOptions) ObtainIPsAndDNSNames() ([]net.IP, []string, error) {
-
-	if (len(o.Flags.IP) == 0) && (len(o.Flags.DNSName) == 0) {
-		return nil, nil, errors.New("neither --ip or --dns were specified (either one, or both, must be specified)")
-	}
-
-	IPs := make([]net.IP, 0, len(o.Flags.IP))
-	for _, ipStr := range o.Flags.IP {
-		if i := net.ParseIP(ipStr); i != nil {
-			IPs = append(IPs, i)
 		}
 	}
 
-	return IPs, o.Flags.DNSName, nil
+	return csrTemplate, nil
 }
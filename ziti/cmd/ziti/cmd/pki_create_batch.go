@@ -0,0 +1,548 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/certificate"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCreateBatchLong = templates.LongDesc(`
+Creates many server and client certificates from a YAML manifest.
+
+Every certificate in the manifest is validated and signed before any of them are written to the PKI. If any
+certificate can't be issued, for example because its name is already taken or its SANs are invalid, nothing is
+written and the problems are reported. With --continue-on-error, the certificates which can be issued are written
+and the others are reported. If writing to the PKI fails part way, the certificates already written are removed again.
+
+With --failure-report, the certificates which weren't created are written to a report, and running the command again
+with --retry-failed and that report only creates those. Certificates are identified in the report as <ca>/<name>.
+
+Settings under 'defaults' apply to every certificate which doesn't set them itself, except for 'serial', which gives
+the serial number of a single certificate. Certificates without one get a serial number according to --serial-strategy.
+	`)
+
+	pkiCreateBatchExample = templates.Examples(`
+		# issue the certificates in certs.yaml
+		ziti pki create batch --pki-root ./pki --file certs.yaml
+
+		# issue the certificates which can be, then retry the others once the manifest is fixed
+		ziti pki create batch --pki-root ./pki --file certs.yaml --continue-on-error --failure-report failed.json
+		ziti pki create batch --pki-root ./pki --file certs.yaml --retry-failed failed.json
+
+		# example certs.yaml, each certificate may also set any of the defaults
+		defaults: {ca: intermediate, keyAlgorithm: ecdsa, curve: P-256, expireDays: 365, organization: [Acme Inc.], country: [US]}
+		certs:
+		- {name: router1, type: server, dns: [router1.example.com], ip: [10.0.0.11]}
+		- {name: router1-client, type: client, commonName: router1}
+		- {name: router2, type: server, dns: [router2.example.com], keyAlgorithm: rsa, privateKeySize: 2048}
+		- {name: router3, type: server, dns: [router3.example.com], serial: 7A:01}
+	`)
+)
+
+const (
+	pkiBatchServer = "server"
+	pkiBatchClient = "client"
+)
+
+// pkiBatchCert is a certificate in a pki create batch manifest. Settings left empty come from the manifest defaults
+type pkiBatchCert struct {
+	Name               string   `yaml:"name"`
+	Type               string   `yaml:"type"`
+	CommonName         string   `yaml:"commonName"`
+	CA                 string   `yaml:"ca"`
+	DNS                []string `yaml:"dns"`
+	IP                 []string `yaml:"ip"`
+	Email              []string `yaml:"email"`
+	URI                []string `yaml:"uri"`
+	SpiffeID           string   `yaml:"spiffeId"`
+	KeyAlgorithm       string   `yaml:"keyAlgorithm"`
+	Curve              string   `yaml:"curve"`
+	PrivateKeySize     int      `yaml:"privateKeySize"`
+	SignatureAlgorithm string   `yaml:"signatureAlgorithm"`
+	ExpireDays         int      `yaml:"expireDays"`
+	Organization       []string `yaml:"organization"`
+	OrganizationalUnit []string `yaml:"organizationalUnit"`
+	Country            []string `yaml:"country"`
+	Locality           []string `yaml:"locality"`
+	Province           []string `yaml:"province"`
+	Serial             string   `yaml:"serial"`
+}
+
+// pkiBatchManifest is the manifest read by pki create batch
+type pkiBatchManifest struct {
+	Defaults pkiBatchCert    `yaml:"defaults"`
+	Certs    []*pkiBatchCert `yaml:"certs"`
+}
+
+// PKICreateBatchOptions the options for the create batch command
+type PKICreateBatchOptions struct {
+	PKICreateOptions
+
+	file string
+	bulk api.BulkOptions
+}
+
+// NewCmdPKICreateBatch creates a command object for the "create batch" command
+func NewCmdPKICreateBatch(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKICreateBatchOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "batch",
+		Short:   "Creates many server and client certificates from a YAML manifest",
+		Long:    pkiCreateBatchLong,
+		Example: pkiCreateBatchExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.file, "file", "f", "", "YAML manifest of the certificates to create")
+	options.addKeyPasswordFlags(cmd)
+	options.addCAKeyPasswordFlags(cmd)
+	options.addSerialStrategyFlag(cmd)
+	options.addOutputFlags(cmd, "the created certificates, including the paths of their files,")
+	options.bulk.AddBulkFlags(cmd, false)
+	_ = cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKICreateBatchOptions) Run() error {
+	manifest, err := readPKIBatchManifest(o.file)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	run, err := o.bulk.StartBulk("create certificates")
+	if err != nil {
+		return err
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	// everything is signed against the staging store first, so nothing is written unless all certificates can be issued,
+	// or --continue-on-error is given
+	staging := &pkiBatchStore{Store: pkiStore}
+	o.Flags.PKI = &pki.ZitiPKI{Store: staging}
+	if err := o.ApplySerialStrategy(); err != nil {
+		return err
+	}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	signers := map[string]*certificate.Bundle{}
+	seen := map[string]bool{}
+	var problems []string
+	var issued []*pkiBatchCert
+
+	for idx, cert := range manifest.Certs {
+		if !run.Include(cert.bulkEntity()) {
+			continue
+		}
+		label := fmt.Sprintf("certs[%v] %v", idx, cert.Name)
+		pending := len(staging.pending)
+		if err := o.issue(cert, pkiStore, signers, seen); err != nil {
+			// drop anything held back for the certificate before it failed
+			staging.pending = staging.pending[:pending]
+			problems = append(problems, fmt.Sprintf("%v: %v", label, err))
+			run.Failed(cert.bulkEntity(), cert.Name, cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, err))
+			continue
+		}
+		issued = append(issued, cert)
+	}
+
+	if len(problems) > 0 && run.Stopped() {
+		for _, cert := range issued {
+			run.Skipped(cert.bulkEntity(), cert.Name)
+		}
+		if err := run.WriteReport(); err != nil {
+			return err
+		}
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no certificates were created, as %v of %v could not be issued:\n  %v",
+			len(problems), len(problems)+len(issued), strings.Join(problems, "\n  "))
+	}
+
+	for _, problem := range problems {
+		o.logWarnf("not created, %v", problem)
+	}
+
+	if err := staging.commit(); err != nil {
+		for _, cert := range issued {
+			run.Failed(cert.bulkEntity(), cert.Name, err)
+		}
+		if reportErr := run.WriteReport(); reportErr != nil {
+			return fmt.Errorf("%v. %v", err, reportErr)
+		}
+		return err
+	}
+
+	for range issued {
+		run.Succeeded()
+	}
+	if err := o.outputBatch(pkiStore, issued); err != nil {
+		return err
+	}
+	return run.Finish()
+}
+
+// bulkEntity identifies the certificate in failure reports
+func (cert *pkiBatchCert) bulkEntity() string {
+	return cert.CA + "/" + cert.Name
+}
+
+// issue signs a certificate from the manifest against the staging store
+func (o *PKICreateBatchOptions) issue(cert *pkiBatchCert, pkiStore store.Store, signers map[string]*certificate.Bundle, seen map[string]bool) error {
+	if cert.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if cert.CA == "" {
+		return fmt.Errorf("ca is required")
+	}
+	if cert.Type != pkiBatchServer && cert.Type != pkiBatchClient {
+		return fmt.Errorf("type must be %v or %v, not '%v'", pkiBatchServer, pkiBatchClient, cert.Type)
+	}
+
+	key := cert.CA + "/" + cert.Name
+	if seen[key] {
+		return fmt.Errorf("%v is in the manifest more than once", key)
+	}
+	seen[key] = true
+
+	var serial *big.Int
+	if cert.Serial != "" {
+		var err error
+		if serial, err = parseUnusedSerial(pkiStore, cert.CA, cert.Serial); err != nil {
+			return err
+		}
+		serialKey := fmt.Sprintf("%v/serial/%X", cert.CA, serial)
+		if seen[serialKey] {
+			return fmt.Errorf("serial number %X is given more than once for CA %v", serial, cert.CA)
+		}
+		seen[serialKey] = true
+	}
+
+	if _, err := pkiStore.FetchCert(cert.CA, cert.Name); err == nil {
+		return fmt.Errorf("a certificate named %v already exists within CA %v", cert.Name, cert.CA)
+	}
+	if local, ok := pkiStore.(*store.Local); ok && local.Exists(cert.CA, cert.Name) {
+		return fmt.Errorf("a bundle named %v already exists within CA %v", cert.Name, cert.CA)
+	}
+
+	if err := pki.ValidateKeyAlgorithm(cert.KeyAlgorithm, cert.Curve); err != nil {
+		return err
+	}
+	if err := pki.ValidateSignatureAlgorithm(cert.SignatureAlgorithm); err != nil {
+		return err
+	}
+
+	// the SANs and template are built the same way as by pki create server and client
+	options := o.PKICreateOptions
+	options.Flags.DNSName = cert.DNS
+	options.Flags.IP = cert.IP
+	options.Flags.Email = cert.Email
+	options.Flags.URI = cert.URI
+	options.Flags.SpiffeID = cert.SpiffeID
+	options.Flags.CAExpire = cert.ExpireDays
+	options.Flags.Organization = cert.Organization
+	options.Flags.OrganizationalUnit = cert.OrganizationalUnit
+	options.Flags.Country = cert.Country
+	options.Flags.Locality = cert.Locality
+	options.Flags.Province = cert.Province
+	options.Flags.CAMaxpath = -1
+
+	sans, err := options.ObtainSANs()
+	if err != nil {
+		return err
+	}
+	if cert.Type == pkiBatchServer && len(sans.DNSNames) == 0 && len(sans.IPAddresses) == 0 {
+		return fmt.Errorf("server certificates need at least one dns or ip SAN")
+	}
+
+	template, err := options.ObtainPKIRequestTemplate(cert.CommonName, false)
+	if err != nil {
+		return err
+	}
+	template.DNSNames = sans.DNSNames
+	template.IPAddresses = sans.IPAddresses
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
+	template.SerialNumber = serial
+
+	signer, found := signers[cert.CA]
+	if !found {
+		if signer, err = o.Flags.PKI.GetCA(cert.CA); err != nil {
+			return fmt.Errorf("cannot locate CA %v: %v", cert.CA, err)
+		}
+		signers[cert.CA] = signer
+	}
+
+	if err := options.ApplySpiffeID(template, signer.Cert); err != nil {
+		return err
+	}
+
+	req := &pki.Request{
+		Name:                cert.Name,
+		Template:            template,
+		IsClientCertificate: cert.Type == pkiBatchClient,
+		PrivateKeySize:      cert.PrivateKeySize,
+		KeyAlgorithm:        cert.KeyAlgorithm,
+		Curve:               cert.Curve,
+		SignatureAlgorithm:  cert.SignatureAlgorithm,
+	}
+
+	if err := o.Flags.PKI.Sign(signer, req); err != nil {
+		return err
+	}
+	if cert.Type == pkiBatchServer {
+		return o.Flags.PKI.Chain(signer, req)
+	}
+	return nil
+}
+
+// outputBatch reports the certificates created, as a table or, with --output, as JSON or YAML
+func (o *PKICreateBatchOptions) outputBatch(pkiStore store.Store, certs []*pkiBatchCert) error {
+	if o.structuredOutput() {
+		var results []*pkiCreateResult
+		for _, cert := range certs {
+			var chainCAs []string
+			if cert.Type == pkiBatchServer {
+				chainCAs = append(chainCAs, cert.CA)
+			}
+			result, err := createdResult(pkiStore, cert.Type, cert.CA, cert.Name, chainCAs...)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+		return o.writeResult(results)
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Type", "CA", "Name", "Common Name", "SANs", "Key Algorithm", "Expires In"})
+	for _, cert := range certs {
+		sans := append(append(append(append([]string{}, cert.DNS...), cert.IP...), cert.Email...), cert.URI...)
+		if cert.SpiffeID != "" {
+			sans = append(sans, cert.SpiffeID)
+		}
+		keyAlgorithm := cert.KeyAlgorithm
+		if keyAlgorithm == pki.KeyAlgorithmECDSA {
+			keyAlgorithm += " " + cert.Curve
+		} else if keyAlgorithm == pki.KeyAlgorithmRSA {
+			keyAlgorithm = fmt.Sprintf("%v %v", keyAlgorithm, cert.PrivateKeySize)
+		}
+		t.AppendRow(table.Row{cert.Type, cert.CA, cert.Name, cert.CommonName, strings.Join(sans, "\n"), keyAlgorithm,
+			fmt.Sprintf("%v days", cert.ExpireDays)})
+	}
+	t.SetOutputMirror(o.Out)
+	t.Render()
+
+	_, err := fmt.Fprintf(o.Out, "created %v certificates\n", len(certs))
+	return err
+}
+
+// readPKIBatchManifest reads a manifest, applying the defaults to each certificate
+func readPKIBatchManifest(path string) (*pkiBatchManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading manifest %v: %v", path, err)
+	}
+
+	manifest := &pkiBatchManifest{}
+	if err := yaml.UnmarshalStrict(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed parsing manifest %v: %v", path, err)
+	}
+	if len(manifest.Certs) == 0 {
+		return nil, fmt.Errorf("manifest %v contains no certs", path)
+	}
+	if manifest.Defaults.Serial != "" {
+		return nil, fmt.Errorf("manifest %v sets a serial in its defaults, serial numbers must be unique per certificate", path)
+	}
+
+	defaults := &manifest.Defaults
+	if defaults.KeyAlgorithm == "" {
+		defaults.KeyAlgorithm = pki.KeyAlgorithmRSA
+	}
+	if defaults.Curve == "" {
+		defaults.Curve = pki.Curves[0]
+	}
+	if defaults.ExpireDays == 0 {
+		defaults.ExpireDays = 365
+	}
+
+	for _, cert := range manifest.Certs {
+		if cert.CommonName == "" {
+			cert.CommonName = cert.Name
+		}
+		if cert.Type == "" {
+			cert.Type = defaults.Type
+		}
+		cert.Type = strings.ToLower(cert.Type)
+		if cert.CA == "" {
+			cert.CA = defaults.CA
+		}
+		if cert.KeyAlgorithm == "" {
+			cert.KeyAlgorithm = defaults.KeyAlgorithm
+		}
+		if cert.Curve == "" {
+			cert.Curve = defaults.Curve
+		}
+		if cert.PrivateKeySize == 0 {
+			cert.PrivateKeySize = defaults.PrivateKeySize
+		}
+		if cert.PrivateKeySize == 0 {
+			// matches the defaults of pki create server and client
+			cert.PrivateKeySize = 4096
+			if cert.Type == pkiBatchClient {
+				cert.PrivateKeySize = 2048
+			}
+		}
+		if cert.SignatureAlgorithm == "" {
+			cert.SignatureAlgorithm = defaults.SignatureAlgorithm
+		}
+		if cert.ExpireDays == 0 {
+			cert.ExpireDays = defaults.ExpireDays
+		}
+		if cert.Organization == nil {
+			cert.Organization = defaults.Organization
+		}
+		if cert.OrganizationalUnit == nil {
+			cert.OrganizationalUnit = defaults.OrganizationalUnit
+		}
+		if cert.Country == nil {
+			cert.Country = defaults.Country
+		}
+		if cert.Locality == nil {
+			cert.Locality = defaults.Locality
+		}
+		if cert.Province == nil {
+			cert.Province = defaults.Province
+		}
+	}
+
+	return manifest, nil
+}
+
+// pkiBatchStore holds back the bundles and chains added to it until commit is called. Everything else goes straight
+// to the underlying store
+type pkiBatchStore struct {
+	store.Store
+	pending []*pkiBatchChange
+}
+
+// pkiBatchChange is a held back change, and how to undo it once it's been written
+type pkiBatchChange struct {
+	apply func() error
+	undo  func(remover store.Remover) error
+}
+
+func (s *pkiBatchStore) Add(caName, name string, isCa bool, key, cert []byte) error {
+	s.pending = append(s.pending, &pkiBatchChange{
+		apply: func() error {
+			return s.Store.Add(caName, name, isCa, key, cert)
+		},
+		undo: func(remover store.Remover) error {
+			return remover.Remove(caName, name)
+		},
+	})
+	return nil
+}
+
+func (s *pkiBatchStore) Chain(caName, name string) error {
+	s.pending = append(s.pending, &pkiBatchChange{
+		apply: func() error {
+			return s.Store.Chain(caName, name)
+		},
+		undo: func(remover store.Remover) error {
+			return remover.RemoveChain(caName, name)
+		},
+	})
+	return nil
+}
+
+// commit writes the held back bundles and chains to the underlying store. If one can't be written, those written
+// before it are removed again, so that the batch is written either completely or not at all
+func (s *pkiBatchStore) commit() error {
+	for idx, change := range s.pending {
+		if err := change.apply(); err != nil {
+			return s.rollback(s.pending[:idx], fmt.Errorf("failed writing to the PKI after %v of %v changes: %v", idx, len(s.pending), err))
+		}
+	}
+	s.pending = nil
+	return nil
+}
+
+// rollback undoes the written changes, newest first, and returns the error which caused it along with any changes
+// which couldn't be undone
+func (s *pkiBatchStore) rollback(written []*pkiBatchChange, cause error) error {
+	s.pending = nil
+	if len(written) == 0 {
+		return cause
+	}
+
+	remover, ok := s.Store.(store.Remover)
+	if !ok {
+		return fmt.Errorf("%v. The %v changes written before the failure could not be rolled back, as the PKI backend doesn't support removing certificates", cause, len(written))
+	}
+
+	var problems []string
+	for idx := len(written) - 1; idx >= 0; idx-- {
+		if err := written[idx].undo(remover); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%v. Rolling back the %v changes written before the failure failed:\n  %v", cause, len(written), strings.Join(problems, "\n  "))
+	}
+	return fmt.Errorf("%v. The %v changes written before the failure were rolled back", cause, len(written))
+}
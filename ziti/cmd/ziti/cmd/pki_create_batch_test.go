@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKICreateBatch(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa"})
+	req.NoError(cmd.Execute())
+
+	manifest := filepath.Join(root, "certs.yaml")
+	req.NoError(ioutil.WriteFile(manifest, []byte(`
+defaults:
+  ca: root
+  keyAlgorithm: ecdsa
+  expireDays: 30
+certs:
+  - name: router1
+    type: server
+    dns: [router1.example.com]
+    ip: [10.0.0.11]
+  - name: router1-client
+    type: client
+    commonName: router1
+`), 0600))
+
+	out := &bytes.Buffer{}
+	options := &PKICreateBatchOptions{file: manifest}
+	options.Out = out
+	options.Flags.PKIRoot = root
+	req.NoError(options.Run())
+	req.Contains(out.String(), "created 2 certificates")
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "router1.cert"))
+	req.NoError(err)
+	req.Equal("router1", certs[0].Subject.CommonName)
+	req.Equal([]string{"router1.example.com"}, certs[0].DNSNames)
+	req.FileExists(filepath.Join(root, "root", "certs", "router1.chain.pem"))
+
+	certs, err = certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "router1-client.cert"))
+	req.NoError(err)
+	req.Equal("router1", certs[0].Subject.CommonName)
+
+	// router1 now exists, so nothing in this manifest is created
+	req.NoError(ioutil.WriteFile(manifest, []byte(`
+defaults:
+  ca: root
+  type: server
+certs:
+  - name: router2
+    dns: [router2.example.com]
+    keyAlgorithm: ecdsa
+  - name: router1
+    dns: [router1.example.com]
+  - name: router3
+`), 0600))
+
+	options = &PKICreateBatchOptions{file: manifest}
+	options.Out = ioutil.Discard
+	options.Flags.PKIRoot = root
+	err = options.Run()
+	req.ErrorContains(err, "2 of 3 could not be issued")
+	req.ErrorContains(err, "a certificate named router1 already exists")
+	req.ErrorContains(err, "server certificates need at least one dns or ip SAN")
+
+	_, err = os.Stat(filepath.Join(root, "root", "certs", "router2.cert"))
+	req.True(os.IsNotExist(err))
+}
+
+func TestPKIBatchStoreRollback(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa"})
+	req.NoError(cmd.Execute())
+
+	indexPath := filepath.Join(root, "root", "index.txt")
+	index, err := ioutil.ReadFile(indexPath)
+	req.NoError(err)
+
+	newBundle := func(serial int64) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		req.NoError(err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "batch"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		cert, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		req.NoError(err)
+		keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+		req.NoError(err)
+		return keyDer, cert
+	}
+
+	// the last change fails, as its bundle exists by the time the batch is committed
+	local := &store.Local{Root: root}
+	staging := &pkiBatchStore{Store: local}
+	key, cert := newBundle(100)
+	req.NoError(staging.Add("root", "a", false, key, cert))
+	req.NoError(staging.Chain("root", "a"))
+	key, cert = newBundle(101)
+	req.NoError(staging.Add("root", "b", false, key, cert))
+	key, cert = newBundle(102)
+	req.NoError(staging.Add("root", "taken", false, key, cert))
+	req.NoError(local.Add("root", "taken", false, key, cert))
+
+	err = staging.commit()
+	req.ErrorContains(err, "failed writing to the PKI after 3 of 4 changes")
+	req.ErrorContains(err, "were rolled back")
+
+	for _, name := range []string{"a.cert", "a.chain.pem", "b.cert"} {
+		req.False(fileExists(filepath.Join(root, "root", "certs", name)), name)
+	}
+	req.False(fileExists(filepath.Join(root, "root", "keys", "a.key")))
+	req.True(fileExists(filepath.Join(root, "root", "certs", "taken.cert")))
+
+	updated, err := ioutil.ReadFile(indexPath)
+	req.NoError(err)
+	req.True(strings.HasPrefix(string(updated), string(index)))
+	req.Equal(1, strings.Count(strings.TrimPrefix(string(updated), string(index)), "\n"))
+	req.Contains(string(updated), "\t66\ttaken.cert\t")
+
+	records, err := local.AuditRecords()
+	req.NoError(err)
+	req.NoError(store.VerifyAuditRecords(records))
+	var operations []string
+	for _, record := range records {
+		operations = append(operations, record.Operation+":"+record.Name)
+	}
+	req.Equal([]string{"issue:root", "issue:taken", "issue:a", "issue:b", "remove:b", "remove:a"}, operations)
+}
+
+func TestPKICreateBatchContinueOnError(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa"})
+	req.NoError(cmd.Execute())
+
+	manifest := filepath.Join(root, "certs.yaml")
+	writeManifest := func(router3 string) {
+		req.NoError(ioutil.WriteFile(manifest, []byte(`
+defaults:
+  ca: root
+  type: server
+  keyAlgorithm: ecdsa
+certs:
+  - name: router1
+    dns: [router1.example.com]
+  - name: router2
+    dns: [router2.example.com]
+  - name: router3
+`+router3), 0600))
+	}
+	writeManifest("")
+
+	report := filepath.Join(root, "failed.json")
+	out := &bytes.Buffer{}
+	options := &PKICreateBatchOptions{file: manifest}
+	options.Out, options.Err = out, ioutil.Discard
+	options.Flags.PKIRoot = root
+	options.bulk = api.BulkOptions{ContinueOnError: true, FailureReport: report}
+	err := options.Run()
+	req.ErrorContains(err, "unable to create certificates: 1 of 3 failed")
+	req.Equal(cmdhelper.ExitCodePartialFailure, cmdhelper.ExitCodeForError(err))
+	req.Contains(out.String(), "created 2 certificates")
+	req.FileExists(filepath.Join(root, "root", "certs", "router1.cert"))
+	req.FileExists(filepath.Join(root, "root", "certs", "router2.cert"))
+
+	failures, err := api.ReadBulkReport(report)
+	req.NoError(err)
+	req.Len(failures.Failures, 1)
+	req.Equal("root/router3", failures.Failures[0].Entity)
+	req.False(failures.Failures[0].Retriable)
+	req.Contains(failures.Failures[0].Error, "server certificates need at least one dns or ip SAN")
+
+	// once fixed, retrying only creates the certificate which failed, though the others are still in the manifest
+	writeManifest("    dns: [router3.example.com]\n")
+	out.Reset()
+	options = &PKICreateBatchOptions{file: manifest}
+	options.Out = out
+	options.Flags.PKIRoot = root
+	options.bulk = api.BulkOptions{RetryFailed: report}
+	req.NoError(options.Run())
+	req.Contains(out.String(), "created 1 certificates")
+	req.FileExists(filepath.Join(root, "root", "certs", "router3.cert"))
+}
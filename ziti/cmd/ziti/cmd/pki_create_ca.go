@@ -17,15 +17,14 @@
 package cmd
 
 import (
+	"crypto"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
 	"github.com/openziti/ziti/ziti/pki/certificate"
 	"github.com/openziti/ziti/ziti/pki/pki"
-	"github.com/openziti/ziti/ziti/pki/store"
 )
 
 // PKICreateCAOptions the options for the create spring command
@@ -68,19 +67,37 @@ func (o *PKICreateCAOptions) addPKICreateCAFlags(cmd *cobra.Command) {
 	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 3650, "Expiration limit in days")
 	cmd.Flags().IntVarP(&o.Flags.CAMaxpath, "max-path-len", "", -1, "Intermediate maximum path length")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
+	o.addKeyUsageFlags(cmd)
+	o.addNameConstraintFlags(cmd)
+	o.addSpiffeIDFlag(cmd, "new CA")
+	o.addSubjectFlags(cmd, "new CA")
+	o.addSerialFlags(cmd)
+	cmd.Flags().StringVar(&o.Flags.KMSKeyURI, "kms-key-uri", "", "URI of an existing key in AWS KMS (awskms:///<key id>?region=<region>) or GCP Cloud KMS (gcpkms://projects/.../cryptoKeyVersions/<version>) to use as the private key of the new CA. Only the CA's certificate is stored in the PKI root")
 }
 
 // Run implements this command
 func (o *PKICreateCAOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	pkiStore, _, err := o.ObtainPKIStore()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	cafile, err := o.ObtainCAFile()
 	if err != nil {
@@ -90,25 +107,47 @@ func (o *PKICreateCAOptions) Run() error {
 	commonName := o.Flags.CAName
 
 	filename := o.ObtainFileName(cafile, commonName)
-	template := o.ObtainPKIRequestTemplate(commonName)
-
-	template.IsCA = true
+	template, err := o.ObtainPKIRequestTemplate(commonName, true)
+	if err != nil {
+		return err
+	}
+	if err := o.ApplyNameConstraints(template); err != nil {
+		return err
+	}
+	if err := o.ApplySpiffeID(template, nil); err != nil {
+		return err
+	}
+	if template.SerialNumber, err = o.ObtainSerial(pkiStore, filename); err != nil {
+		return err
+	}
 
 	var signer *certificate.Bundle
 
+	var key crypto.Signer
+	if o.Flags.KMSKeyURI != "" {
+		if err := pki.ValidateKMSURI(o.Flags.KMSKeyURI); err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		if key, err = pki.NewKMSKey(o.Flags.KMSKeyURI, nil); err != nil {
+			return err
+		}
+		o.logInfof("Using the private key %v, held in KMS\n", o.Flags.KMSKeyURI)
+	}
+
 	req := &pki.Request{
 		Name:                filename,
 		Template:            template,
 		IsClientCertificate: false,
 		PrivateKeySize:      o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:        o.Flags.KeyAlgorithm,
+		Curve:               o.Flags.Curve,
+		SignatureAlgorithm:  o.Flags.SignatureAlgorithm,
+		Key:                 key,
 	}
 
 	if err := o.Flags.PKI.Sign(signer, req); err != nil {
 		return fmt.Errorf("Cannot Sign: %v", err)
 	}
 
-	log.Infoln("Success")
-
-	return nil
-
+	return o.outputCreated(pkiStore, pkiResultCA, filename, filename)
 }
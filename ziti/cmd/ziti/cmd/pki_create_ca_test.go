@@ -0,0 +1,562 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openziti/identity/certtools"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKICreateWithECDSAKeys(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa", "--curve", "P-384")
+	run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "server", "--dns", "localhost",
+		"--key-algorithm", "ecdsa")
+
+	keyPem, err := ioutil.ReadFile(filepath.Join(root, "root", "keys", "server.key"))
+	req.NoError(err)
+	key, err := certtools.LoadPrivateKey(keyPem)
+	req.NoError(err)
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	req.True(ok)
+	req.Equal(elliptic.P256(), ecKey.Curve)
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "server.cert"))
+	req.NoError(err)
+	req.Equal(x509.ECDSAWithSHA384, certs[0].SignatureAlgorithm)
+	req.Zero(certs[0].KeyUsage & x509.KeyUsageKeyEncipherment)
+}
+
+func TestPKICreateWithEd25519Keys(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ed25519")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "inter", "--key-algorithm", "ed25519")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "server", "--dns", "localhost",
+		"--key-algorithm", "ed25519")
+	run("create", "client", "--pki-root", root, "--ca-name", "inter", "--client-file", "client", "--key-algorithm", "ed25519")
+	run("create", "key", "--pki-root", root, "--ca-name", "inter", "--key-file", "spare", "--key-algorithm", "ed25519")
+
+	keyPem, err := ioutil.ReadFile(filepath.Join(root, "inter", "keys", "spare.key"))
+	req.NoError(err)
+	key, err := certtools.LoadPrivateKey(keyPem)
+	req.NoError(err)
+	_, ok := key.(ed25519.PrivateKey)
+	req.True(ok)
+
+	for _, name := range []string{"server", "client"} {
+		certs, err := certtools.LoadCertFromFile(filepath.Join(root, "inter", "certs", name+".cert"))
+		req.NoError(err)
+		req.Equal(x509.PureEd25519, certs[0].SignatureAlgorithm)
+		req.Equal(x509.Ed25519, certs[0].PublicKeyAlgorithm)
+		req.Zero(certs[0].KeyUsage & (x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement))
+	}
+}
+
+func TestPKISignExternalCSR(t *testing.T) {
+	req := require.New(t)
+	caRoot := t.TempDir()
+	hostRoot := t.TempDir()
+	csrFile := filepath.Join(t.TempDir(), "router1.csr")
+	certFile := filepath.Join(t.TempDir(), "router1.cert")
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", caRoot, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "csr", "--pki-root", hostRoot, "--csr-file", "router1", "--csr-name", "router1",
+		"--dns", "router1.example.com", "--key-algorithm", "ed25519", "--out", csrFile)
+	run("sign", "--pki-root", caRoot, "--ca-name", "root", "--csr", csrFile, "--out", certFile, "--chain")
+
+	certs, err := certtools.LoadCertFromFile(certFile)
+	req.NoError(err)
+	req.Len(certs, 2)
+	req.Equal("router1", certs[0].Subject.CommonName)
+	req.Equal([]string{"router1.example.com"}, certs[0].DNSNames)
+	req.NoError(certs[0].CheckSignatureFrom(certs[1]))
+
+	keyPem, err := ioutil.ReadFile(filepath.Join(hostRoot, "csrs", "keys", "router1.key"))
+	req.NoError(err)
+	key, err := certtools.LoadPrivateKey(keyPem)
+	req.NoError(err)
+	req.Equal(key.(ed25519.PrivateKey).Public(), certs[0].PublicKey)
+
+	req.NoFileExists(filepath.Join(caRoot, "root", "keys", "router1.key"))
+}
+
+func TestPKIExportP12(t *testing.T) {
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is required to verify PKCS #12 archives")
+	}
+
+	req := require.New(t)
+	root := t.TempDir()
+	p12File := filepath.Join(t.TempDir(), "client1.p12")
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "intermediate")
+	run("create", "client", "--pki-root", root, "--ca-name", "intermediate", "--client-file", "client1",
+		"--client-name", "client1", "--key-algorithm", "ecdsa")
+	run("export", "p12", "--pki-root", root, "--ca-name", "intermediate", "--name", "client1", "--out", p12File,
+		"--password", "s3cret")
+
+	out, err := exec.Command(opensslPath, "pkcs12", "-in", p12File, "-passin", "pass:s3cret", "-nodes").CombinedOutput()
+	req.NoError(err, string(out))
+	req.Equal(3, strings.Count(string(out), "BEGIN CERTIFICATE"))
+	req.Equal(1, strings.Count(string(out), "BEGIN PRIVATE KEY"))
+	req.Contains(string(out), "friendlyName: client1")
+
+	out, err = exec.Command(opensslPath, "pkcs12", "-in", p12File, "-passin", "pass:wrong", "-noout").CombinedOutput()
+	req.Error(err, string(out))
+}
+
+func TestPKICreateClientP12(t *testing.T) {
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is required to verify PKCS #12 archives")
+	}
+
+	req := require.New(t)
+	root := t.TempDir()
+	p12Dir := t.TempDir()
+
+	run := func(args ...string) error {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	req.NoError(run("create", "ca", "--pki-root", root, "--ca-file", "root"))
+	req.NoError(run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "modern",
+		"--client-name", "modern", "--p12", filepath.Join(p12Dir, "modern.p12"), "--p12-password", "s3cret"))
+	req.NoError(run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "legacy",
+		"--client-name", "legacy", "--p12", filepath.Join(p12Dir, "legacy.p12"), "--p12-password", "s3cret",
+		"--p12-legacy-ciphers", "--p12-iterations", "10000"))
+
+	// the command exits on errors, so run the options directly to see the error
+	options := &PKICreateClientOptions{}
+	options.Out, options.Err = ioutil.Discard, ioutil.Discard
+	options.Cmd = &cobra.Command{}
+	options.addPKICreateClientFlags(options.Cmd)
+	req.NoError(options.Cmd.ParseFlags([]string{"--pki-root", root, "--ca-name", "root", "--client-file", "iterations",
+		"--p12-iterations", "10000"}))
+	err = options.Run()
+	req.EqualError(err, "--p12-iterations can only be used with --p12")
+	req.Equal(cmdhelper.ExitCodeUsage, cmdhelper.ExitCodeForError(err))
+	req.False(fileExists(filepath.Join(root, "root", "certs", "iterations.cert")))
+
+	info := func(name string) string {
+		out, err := exec.Command(opensslPath, "pkcs12", "-in", filepath.Join(p12Dir, name), "-passin", "pass:s3cret",
+			"-info", "-nodes").CombinedOutput()
+		req.NoError(err, string(out))
+		req.Equal(2, strings.Count(string(out), "BEGIN CERTIFICATE"))
+		req.Equal(1, strings.Count(string(out), "BEGIN PRIVATE KEY"))
+		return string(out)
+	}
+
+	modern := info("modern.p12")
+	req.Contains(modern, "MAC: sha256, Iteration 2048")
+	req.Contains(modern, "AES-256-CBC")
+
+	legacy := info("legacy.p12")
+	req.Contains(legacy, "MAC: sha1, Iteration 10000")
+	req.Contains(legacy, "pbeWithSHA1And3-KeyTripleDES-CBC, Iteration 10000")
+	req.NotContains(legacy, "AES-256-CBC")
+}
+
+func TestPKIRevokeAndCreateCRL(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client1", "--key-algorithm", "ecdsa")
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client2", "--key-algorithm", "ecdsa")
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "client2.cert"))
+	req.NoError(err)
+	client2Serial := certs[0].SerialNumber
+
+	readCRL := func(path string) (*pkix.CertificateList, *big.Int) {
+		raw, err := ioutil.ReadFile(path)
+		req.NoError(err)
+		crl, err := x509.ParseCRL(raw)
+		req.NoError(err)
+		number := new(big.Int)
+		for _, ext := range crl.TBSCertList.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 20}) {
+				_, err = asn1.Unmarshal(ext.Value, &number)
+				req.NoError(err)
+			}
+		}
+		return crl, number
+	}
+
+	run("revoke", "--pki-root", root, "--ca-name", "root", "--cert", "client1", "--crl")
+	crl, number := readCRL(filepath.Join(root, "root", "crls", "root.crl"))
+	req.Equal(int64(1), number.Int64())
+	req.Len(crl.TBSCertList.RevokedCertificates, 1)
+
+	// revoke by serial number, as printed by openssl
+	run("revoke", "--pki-root", root, "--ca-name", "root", "--cert", fmt.Sprintf("%X", client2Serial))
+	out := filepath.Join(t.TempDir(), "crl.pem")
+	run("create", "crl", "--pki-root", root, "--ca-name", "root", "--out", out)
+	crl, number = readCRL(out)
+	req.Equal(int64(2), number.Int64())
+	req.Len(crl.TBSCertList.RevokedCertificates, 2)
+
+	ca, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "root.cert"))
+	req.NoError(err)
+	req.NoError(ca[0].CheckCRLSignature(crl))
+
+	var revoked []string
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		revoked = append(revoked, entry.SerialNumber.String())
+	}
+	req.Contains(revoked, client2Serial.String())
+}
+
+func TestPKIRenew(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	load := func() *x509.Certificate {
+		certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "server1.cert"))
+		req.NoError(err)
+		return certs[0]
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "server1", "--dns", "ctrl.example.com",
+		"--ip", "10.0.0.5", "--key-algorithm", "ecdsa")
+	original := load()
+
+	run("renew", "--pki-root", root, "--ca-name", "root", "--name", "server1", "--duration", "30d")
+	renewed := load()
+	req.NotEqual(original.SerialNumber, renewed.SerialNumber)
+	req.Equal(original.Subject.String(), renewed.Subject.String())
+	req.Equal(original.DNSNames, renewed.DNSNames)
+	req.Equal(original.IPAddresses, renewed.IPAddresses)
+	req.Equal(original.ExtKeyUsage, renewed.ExtKeyUsage)
+	req.Equal(original.RawSubjectPublicKeyInfo, renewed.RawSubjectPublicKeyInfo)
+	req.WithinDuration(time.Now().AddDate(0, 0, 30), renewed.NotAfter, time.Hour)
+
+	run("renew", "--pki-root", root, "--ca-name", "root", "--name", "server1", "--new-key", "--key-algorithm", "ed25519")
+	rekeyed := load()
+	_, isEd25519 := rekeyed.PublicKey.(ed25519.PublicKey)
+	req.True(isEd25519)
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join(root, "root", "keys", "server1.key"))
+	req.NoError(err)
+	key, err := certtools.LoadPrivateKey(keyPEM)
+	req.NoError(err)
+	req.Equal(rekeyed.PublicKey, key.(ed25519.PrivateKey).Public())
+}
+
+func TestPKICreateCrossSignedIntermediate(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root1", "--ca-name", "root1", "--key-algorithm", "ecdsa")
+	run("create", "ca", "--pki-root", root, "--ca-file", "root2", "--ca-name", "root2", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root1", "--cross-sign-ca", "root2",
+		"--intermediate-file", "inter", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "server", "--dns", "localhost",
+		"--key-algorithm", "ecdsa")
+
+	server, err := certtools.LoadCertFromFile(filepath.Join(root, "inter", "certs", "server.cert"))
+	req.NoError(err)
+
+	for _, rootName := range []string{"root1", "root2"} {
+		chain, err := certtools.LoadCertFromFile(filepath.Join(root, rootName, "certs", "inter.chain.pem"))
+		req.NoError(err)
+		req.Len(chain, 2)
+		req.Equal(rootName, chain[0].Issuer.CommonName)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(chain[1])
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(chain[0])
+		_, err = server[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		req.NoError(err, "server cert doesn't chain to %v", rootName)
+	}
+}
+
+func TestPKICreateSignatureAlgorithm(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+	loadCert := func(caName, name string) *x509.Certificate {
+		certs, err := certtools.LoadCertFromFile(filepath.Join(root, caName, "certs", name+".cert"))
+		req.NoError(err)
+		return certs[0]
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa",
+		"--signature-algorithm", "SHA512")
+	req.Equal(x509.ECDSAWithSHA512, loadCert("root", "root").SignatureAlgorithm)
+
+	// the signing CA's key picks the algorithm, not the new certificate's key
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client",
+		"--private-key-size", "2048", "--signature-algorithm", "ecdsa-sha384")
+	req.Equal(x509.ECDSAWithSHA384, loadCert("root", "client").SignatureAlgorithm)
+
+	createClient := func(signatureAlgorithm string) error {
+		options := &PKICreateClientOptions{}
+		options.Flags.PKIRoot = root
+		options.Flags.CAName = "root"
+		options.Flags.ClientFile = "client-" + signatureAlgorithm
+		options.Flags.ClientName = "client-" + signatureAlgorithm
+		options.Flags.KeyAlgorithm = "ecdsa"
+		options.Flags.CAExpire = 365
+		options.Flags.SignatureAlgorithm = signatureAlgorithm
+		return options.Run()
+	}
+	req.ErrorContains(createClient("SHA256-RSA"), "can't be used with an ECDSA signer key")
+	req.ErrorContains(createClient("MD5"), "unsupported signature algorithm")
+}
+
+func TestPKICreateIntermediateWithNameConstraints(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "partner",
+		"--key-algorithm", "ecdsa", "--permitted-dns", "Partner.example.com", "--excluded-dns", "internal.partner.example.com",
+		"--permitted-ip", "10.20.0.0/16,192.168.1.1")
+	run("create", "server", "--pki-root", root, "--ca-name", "partner", "--server-file", "inside",
+		"--key-algorithm", "ecdsa", "--dns", "api.partner.example.com")
+	run("create", "server", "--pki-root", root, "--ca-name", "partner", "--server-file", "outside",
+		"--key-algorithm", "ecdsa", "--dns", "api.other.example.com")
+
+	loadCert := func(caName, name string) *x509.Certificate {
+		certs, err := certtools.LoadCertFromFile(filepath.Join(root, caName, "certs", name+".cert"))
+		req.NoError(err)
+		return certs[0]
+	}
+
+	rootCert := loadCert("root", "root")
+	partner := loadCert("root", "partner")
+	req.True(partner.PermittedDNSDomainsCritical)
+	req.Equal([]string{"partner.example.com"}, partner.PermittedDNSDomains)
+	req.Equal([]string{"internal.partner.example.com"}, partner.ExcludedDNSDomains)
+	req.Len(partner.PermittedIPRanges, 2)
+	req.Equal("10.20.0.0/16", partner.PermittedIPRanges[0].String())
+	req.Equal("192.168.1.1/32", partner.PermittedIPRanges[1].String())
+
+	verify := func(name string) error {
+		roots := x509.NewCertPool()
+		roots.AddCert(rootCert)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(partner)
+		_, err := loadCert("partner", name).Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+	req.NoError(verify("inside"))
+	req.Error(verify("outside"))
+
+	options := &PKICreateIntermediateOptions{}
+	options.Flags.PermittedIP = []string{"10.20.0.0/33"}
+	req.ErrorContains(options.ApplyNameConstraints(&x509.Certificate{}), "invalid IP range")
+}
+
+func TestPKICreateSpiffeID(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa", "--spiffe-id", "spiffe://example.org")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "inter", "--key-algorithm", "ecdsa",
+		"--spiffe-id", "spiffe://example.org/intermediate")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "router1", "--key-algorithm", "ecdsa",
+		"--dns", "router1.example.org", "--spiffe-id", "spiffe://example.org/router/router1")
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "inter", "certs", "router1.cert"))
+	req.NoError(err)
+	req.Len(certs[0].URIs, 1)
+	req.Equal("spiffe://example.org/router/router1", certs[0].URIs[0].String())
+
+	createClient := func(spiffeID string, uris ...string) error {
+		options := &PKICreateClientOptions{}
+		options.Flags.PKIRoot = root
+		options.Flags.CAName = "inter"
+		options.Flags.ClientFile = "client"
+		options.Flags.ClientName = "client"
+		options.Flags.KeyAlgorithm = "ecdsa"
+		options.Flags.CAExpire = 365
+		options.Flags.SpiffeID = spiffeID
+		options.Flags.URI = uris
+		return options.Run()
+	}
+	req.ErrorContains(createClient("spiffe://other.org/client"), "not in trust domain example.org")
+	req.ErrorContains(createClient("spiffe://example.org"), "a path identifying the workload is required")
+	req.ErrorContains(createClient("spiffe://example.org/a/../b"), "path segments may not be empty")
+	req.ErrorContains(createClient("spiffe://Example.org/client"), "trust domain may only contain lowercase")
+	req.ErrorContains(createClient("spiffe://example.org/client", "spiffe://example.org/other"), "only have one SPIFFE ID")
+	req.ErrorContains(createClient("", "spiffe://other.org/client"), "not in trust domain example.org")
+	req.NoError(createClient("spiffe://example.org/client"))
+}
+
+func TestPKICreateSubjectFlags(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) error {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		return cmd.Execute()
+	}
+
+	req.NoError(run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa",
+		"--organization", "Acme Inc.", "--organizational-unit", "Security,Platform", "--country", "de", "--locality", "Berlin",
+		"--province", "Berlin"))
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "root.cert"))
+	req.NoError(err)
+	req.Equal([]string{"Acme Inc."}, certs[0].Subject.Organization)
+	req.ElementsMatch([]string{"Security", "Platform"}, certs[0].Subject.OrganizationalUnit)
+	req.Equal([]string{"DE"}, certs[0].Subject.Country)
+	req.Equal([]string{"Berlin"}, certs[0].Subject.Locality)
+	req.Equal([]string{"Berlin"}, certs[0].Subject.Province)
+
+	// the --pki-* flags of pki create still apply to attributes which aren't overridden
+	req.NoError(run("create", "--pki-province", "Ontario", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "server",
+		"--dns", "localhost", "--key-algorithm", "ecdsa", "--organization", ""))
+
+	certs, err = certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "server.cert"))
+	req.NoError(err)
+	req.Empty(certs[0].Subject.Organization)
+	req.Equal([]string{"Ontario"}, certs[0].Subject.Province)
+
+	options := &PKICreateOptions{}
+	options.Flags.Country = []string{"USA"}
+	_, err = options.ObtainSubject("test")
+	req.ErrorContains(err, "invalid country USA")
+}
+
+func TestPKICreateSerialStrategies(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+	serialOf := func(name string) *big.Int {
+		certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", name+".cert"))
+		req.NoError(err)
+		return certs[0].SerialNumber
+	}
+
+	// the root CA takes the first serial number of its own counter
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa", "--serial-strategy", "sequential")
+	req.Equal(int64(1), serialOf("root").Int64())
+
+	for _, name := range []string{"server1", "server2"} {
+		run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", name, "--dns", "localhost",
+			"--key-algorithm", "ecdsa", "--serial-strategy", "sequential")
+	}
+	req.Equal(int64(2), serialOf("server1").Int64())
+	req.Equal(int64(3), serialOf("server2").Int64())
+
+	counter, err := ioutil.ReadFile(filepath.Join(root, "root", "serial"))
+	req.NoError(err)
+	req.Equal("04", strings.TrimSpace(string(counter)))
+
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client", "--key-algorithm", "ecdsa",
+		"--serial", "7A:01:FF")
+	req.Equal(int64(0x7a01ff), serialOf("client").Int64())
+
+	// random serial numbers remain the default
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client2", "--key-algorithm", "ecdsa")
+	req.True(serialOf("client2").Cmp(big.NewInt(0x7a01ff)) > 0)
+
+	options := &PKICreateOptions{}
+	options.Flags.PKIRoot = root
+	pkiStore, _, err := options.ObtainPKIStore()
+	req.NoError(err)
+	_, err = parseUnusedSerial(pkiStore, "root", "0x7a01ff")
+	req.ErrorContains(err, "serial number 7A01FF was already issued by CA root, to client")
+	_, err = parseUnusedSerial(pkiStore, "root", "0")
+	req.ErrorContains(err, "must be positive")
+	_, err = parseUnusedSerial(pkiStore, "root", strings.Repeat("FF", 21))
+	req.ErrorContains(err, "longer than 20 octets")
+}
@@ -20,9 +20,9 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
+	"strings"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
 	"github.com/openziti/ziti/ziti/pki/certificate"
 	"github.com/openziti/ziti/ziti/pki/pki"
 	"github.com/openziti/ziti/ziti/pki/store"
@@ -31,6 +31,9 @@ import (
 // PKICreateClientOptions the options for the create spring command
 type PKICreateClientOptions struct {
 	PKICreateOptions
+
+	p12File string
+	p12     pkiP12Flags
 }
 
 // NewCmdPKICreateClient creates a command object for the "create" command
@@ -68,23 +71,64 @@ func (o *PKICreateClientOptions) addPKICreateClientFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&o.Flags.ClientFile, "client-file", "", "client", "Name of file (under chosen CA) in which to store new Client certificate and private key")
 	cmd.Flags().StringVarP(&o.Flags.KeyFile, "key-file", "", "", "Name of file (under chosen CA) containing private key to use when generating Client certificate")
 	cmd.Flags().StringVarP(&o.Flags.ClientName, "client-name", "", "NetFoundry Inc. Client", "Common Name (CN) to use for new Client certificate")
-	cmd.Flags().StringSliceVar(&o.Flags.Email, "email", []string{}, "Email addr(s) to add to Subject Alternate Name (SAN) for new Client certificate")
+	o.addSANFlags(cmd, "new Client certificate")
+	o.addSubjectFlags(cmd, "new Client certificate")
+	o.addSerialFlags(cmd)
+	o.addSpiffeIDFlag(cmd, "new Client certificate")
 	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 365, "Expiration limit in days")
 	cmd.Flags().IntVarP(&o.Flags.CAMaxpath, "max-path-len", "", -1, "Intermediate maximum path length")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 2048, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
+	o.addKeyUsageFlags(cmd)
+	o.addCAKeyFlags(cmd)
+	cmd.Flags().StringVar(&o.p12File, "p12", "", "Also write the new Client certificate, its key and CA chain to this file as a PKCS #12 archive")
+	o.p12.addFlags(cmd, "p12-")
 }
 
 // Run implements this command
 func (o *PKICreateClientOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	var p12Password string
+	if o.p12File != "" {
+		var err error
+		if p12Password, err = o.p12.obtainPassword(); err != nil {
+			return err
+		}
+	} else if o.Cmd != nil {
+		if changed := o.p12.changedFlags(o.Cmd); len(changed) > 0 {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "%v can only be used with --p12", strings.Join(changed, ", "))
+		}
+	}
+
+	sans, err := o.ObtainSANs()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	commonName := o.Flags.ClientName
 
@@ -94,10 +138,15 @@ func (o *PKICreateClientOptions) Run() error {
 	}
 
 	filename := o.ObtainFileName(clientCertFile, commonName)
-	template := o.ObtainPKIRequestTemplate(commonName)
+	template, err := o.ObtainPKIRequestTemplate(commonName, false)
+	if err != nil {
+		return err
+	}
 
-	template.IsCA = false
-	template.EmailAddresses = o.Flags.Email
+	template.DNSNames = sans.DNSNames
+	template.IPAddresses = sans.IPAddresses
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
 
 	var signer *certificate.Bundle
 
@@ -116,20 +165,52 @@ func (o *PKICreateClientOptions) Run() error {
 		return fmt.Errorf("Cannot locate signer: %v", err)
 	}
 
+	if err := o.ApplySpiffeID(template, signer.Cert); err != nil {
+		return err
+	}
+	if template.SerialNumber, err = o.ObtainSerial(pkiStore, caname); err != nil {
+		return err
+	}
+
 	req := &pki.Request{
 		Name:                filename,
 		KeyName:             keyFile,
 		Template:            template,
 		IsClientCertificate: true,
 		PrivateKeySize:      o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:        o.Flags.KeyAlgorithm,
+		Curve:               o.Flags.Curve,
+		SignatureAlgorithm:  o.Flags.SignatureAlgorithm,
 	}
 
 	if err := o.Flags.PKI.Sign(signer, req); err != nil {
 		return fmt.Errorf("Cannot Sign: %v", err)
 	}
 
-	log.Infoln("Success")
+	if o.p12File == "" {
+		return o.outputCreated(pkiStore, pkiResultClient, caname, filename)
+	}
 
-	return nil
+	bundle, err := o.Flags.PKI.GetBundle(caname, filename)
+	if err != nil {
+		return fmt.Errorf("Cannot locate new certificate and key: %v", err)
+	}
+	chain, err := store.CAChain(pkiStore, caname)
+	if err != nil {
+		return fmt.Errorf("Cannot locate CA chain: %v", err)
+	}
+	if err := o.p12.write(o.p12File, bundle, chain, p12Password, commonName); err != nil {
+		return err
+	}
+	o.logInfof("Wrote %v with %v CA certificates to %v\n", filename, len(chain), o.p12File)
 
+	if !o.structuredOutput() {
+		return o.outputCreated(pkiStore, pkiResultClient, caname, filename)
+	}
+	result, err := createdResult(pkiStore, pkiResultClient, caname, filename)
+	if err != nil {
+		return err
+	}
+	result.P12Path = o.p12File
+	return o.writeResult(result)
 }
@@ -0,0 +1,155 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+const defaultCRLExpireDays = 30
+
+var (
+	pkiCreateCRLLong = templates.LongDesc(`
+Creates a Certificate Revocation List (CRL) signed by a CA in the PKI, listing the certificates revoked with
+'ziti pki revoke'.
+
+The CRL is numbered from the CA's crlnumber and stored with the CA, in crls/<ca-name>.crl for a local PKI.
+	`)
+
+	pkiCreateCRLExample = templates.Examples(`
+		# create a CRL for the intermediate CA, due to be updated in a week, and copy it to crl.pem
+		ziti pki create crl --pki-root ./pki --ca-name intermediate --expire-limit 7 --out crl.pem
+	`)
+)
+
+// PKICreateCRLOptions the options for the create crl command
+type PKICreateCRLOptions struct {
+	PKICreateOptions
+
+	outFile string
+}
+
+// NewCmdPKICreateCRL creates a command object for the "create crl" command
+func NewCmdPKICreateCRL(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKICreateCRLOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "crl",
+		Short:   "Creates a CRL listing the certificates revoked by a CA",
+		Long:    pkiCreateCRLLong,
+		Example: pkiCreateCRLExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) to create the CRL for")
+	options.addCAKeyFlags(cmd)
+	options.addResultOutputFlags(cmd)
+	cmd.Flags().IntVarP(&options.Flags.CAExpire, "expire-limit", "", defaultCRLExpireDays, "Days until the next CRL update is due")
+	cmd.Flags().StringVarP(&options.outFile, "out", "o", "", "Also write the CRL in PEM format to this file")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKICreateCRLOptions) Run() error {
+	if o.Flags.CAExpire <= 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --expire-limit %v, must be at least one day", o.Flags.CAExpire)
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	if err := o.writeCRL(caname, o.Flags.CAExpire, o.outFile); err != nil {
+		return err
+	}
+	if o.structuredOutput() {
+		result, err := createdResult(pkiStore, pkiResultCRL, caname, caname)
+		if err != nil {
+			return err
+		}
+		result.OutPath = o.outFile
+		return o.writeResult(result)
+	}
+	return nil
+}
+
+// writeCRL creates and stores a new CRL for the CA, also writing it to outFile if given
+func (o *PKICreateOptions) writeCRL(caname string, expireDays int, outFile string) error {
+	crl, err := o.Flags.PKI.CRL(caname, time.Now().AddDate(0, 0, expireDays))
+	if err != nil {
+		return fmt.Errorf("Cannot create CRL: %v", err)
+	}
+
+	if outFile != "" {
+		if err := ioutil.WriteFile(outFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), 0644); err != nil {
+			return fmt.Errorf("failed writing CRL to %v: %v", outFile, err)
+		}
+	}
+
+	if local, ok := o.Flags.PKI.Store.(*store.Local); ok {
+		o.logInfof("Created CRL for %v at %v\n", caname, local.CRLPath(caname))
+	} else {
+		o.logInfof("Created CRL for %v\n", caname)
+	}
+
+	return nil
+}
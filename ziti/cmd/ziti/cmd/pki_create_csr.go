@@ -17,19 +17,38 @@
 package cmd
 
 import (
+	"encoding/pem"
 	"fmt"
-	"github.com/spf13/cobra"
 	"io"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
 	"github.com/openziti/ziti/ziti/pki/pki"
-	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCreateCSRLong = templates.LongDesc(`
+Creates a private key and a Certificate Signing Request (CSR) for it, without signing it.
+
+The key and CSR are stored in a directory of the PKI root like other bundles. The CSR can be signed by a CA held in
+another PKI using 'ziti pki sign', so that the private key never leaves the host it was created on.
+	`)
+
+	pkiCreateCSRExample = templates.Examples(`
+		# create a key and CSR on a router host and copy the CSR to the host holding the CA
+		ziti pki create csr --pki-root ./pki --csr-file router1 --csr-name router1 --dns router1.example.com --out router1.csr
+	`)
 )
 
 // PKICreateCSROptions the options for the create spring command
 type PKICreateCSROptions struct {
 	PKICreateOptions
+
+	isCA    bool
+	outFile string
 }
 
 // NewCmdPKICreateCSR creates a command object for the "create" command
@@ -46,8 +65,10 @@ func NewCmdPKICreateCSR(out io.Writer, errOut io.Writer) *cobra.Command {
 	}
 
 	cmd := &cobra.Command{
-		Use:   "csr",
-		Short: "Creates new Certificate Signing Request (CSR)",
+		Use:     "csr",
+		Short:   "Creates new private key and Certificate Signing Request (CSR)",
+		Long:    pkiCreateCSRLong,
+		Example: pkiCreateCSRExample,
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
 			options.Args = args
@@ -61,49 +82,84 @@ func NewCmdPKICreateCSR(out io.Writer, errOut io.Writer) *cobra.Command {
 }
 
 func (o *PKICreateCSROptions) addPKICreateCSRFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&o.Flags.CAName, "ca-name", "", "csrs", "Name of the directory (within PKI_ROOT) in which to store the new key and CSR")
 	cmd.Flags().StringVarP(&o.Flags.CSRFile, "csr-file", "", "csr", "File in which to store new CSR")
-	cmd.Flags().StringVarP(&o.Flags.CSRName, "csr-name", "", "NetFoundry Inc. CSR", "Name of CSR")
-	cmd.Flags().StringVarP(&o.Flags.KeyName, "key-name", "", "", "Name of file that contains private key for CSR")
-	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 365, "Expiration limit in days")
-	cmd.Flags().IntVarP(&o.Flags.CAMaxpath, "max-path-len", "", -1, "Intermediate maximum path length")
+	cmd.Flags().StringVarP(&o.Flags.CSRName, "csr-name", "", "NetFoundry Inc. CSR", "Common Name (CN) to request")
+	cmd.Flags().StringVarP(&o.Flags.KeyName, "key-name", "", "", "Name of an existing private key (within the --ca-name directory) to use instead of generating one")
+	o.addSANFlags(cmd, "the CSR")
+	o.addSubjectFlags(cmd, "CSR")
+	cmd.Flags().BoolVar(&o.isCA, "ca", false, "Request an intermediate CA certificate")
+	cmd.Flags().StringVarP(&o.outFile, "out", "o", "", "Also write the CSR in PEM format to this file")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
 }
 
 // Run implements this command
 func (o *PKICreateCSROptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	pkiStore, _, err := o.ObtainPKIStore()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	csrfile, err := o.ObtainCSRFile()
 	if err != nil {
 		return fmt.Errorf("%s", err)
 	}
 
-	keyname, err := o.ObtainKeyName(pkiroot)
+	template, err := o.ObtainPKICSRRequestTemplate(o.Flags.CSRName, o.isCA)
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
 	}
-
-	commonName := o.Flags.CSRName
-	template := o.ObtainPKICSRRequestTemplate(commonName)
-
-	key, err := o.Flags.PKI.GetPrivateKey(keyname, keyname)
+	sans, err := o.ObtainSANs()
 	if err != nil {
-		return fmt.Errorf("Cannot locate private key: %v", err)
+		return err
+	}
+	template.DNSNames = sans.DNSNames
+	template.IPAddresses = sans.IPAddresses
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
+
+	req := &pki.CSRRequest{
+		Name:               csrfile,
+		KeyName:            o.Flags.KeyName,
+		PrivateKeySize:     o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:       o.Flags.KeyAlgorithm,
+		Curve:              o.Flags.Curve,
+		SignatureAlgorithm: o.Flags.SignatureAlgorithm,
+		Template:           template,
 	}
 
-	if err := o.Flags.PKI.CSR(keyname, csrfile, *template, key); err != nil {
+	if err := o.Flags.PKI.CreateCSR(o.Flags.CAName, req); err != nil {
 		return fmt.Errorf("Cannot create CSR: %v", err)
 	}
 
-	log.Infoln("Success")
+	if o.outFile != "" {
+		raw, err := pkiStore.FetchCert(o.Flags.CAName, csrfile)
+		if err != nil {
+			return err
+		}
+		block := &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: raw}
+		if err := ioutil.WriteFile(o.outFile, pem.EncodeToMemory(block), 0644); err != nil {
+			return fmt.Errorf("failed writing CSR to %v: %v", o.outFile, err)
+		}
+	}
 
-	return nil
+	return o.outputCreated(pkiStore, pkiResultCSR, o.Flags.CAName, csrfile)
 }
@@ -22,10 +22,30 @@ import (
 	"io"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
 	"github.com/openziti/ziti/ziti/pki/certificate"
 	"github.com/openziti/ziti/ziti/pki/pki"
-	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCreateIntermediateLong = templates.LongDesc(`
+Creates a new Intermediate CA, signed by a previously created CA.
+
+With --cross-sign-ca the Intermediate CA is also issued, with the same subject and public key, by a second CA.
+Certificates issued by the Intermediate CA then chain to either CA, which allows rotating roots without re-issuing the
+certificates of existing routers and identities. A chain to each CA is written within each of the CAs.
+
+--permitted-dns, --excluded-dns and --permitted-ip add name constraints to the Intermediate CA, limiting the names the
+certificates it issues are trusted for. This scopes intermediates delegated to partners to their own domains.
+	`)
+
+	pkiCreateIntermediateExample = templates.Examples(`
+		# create an intermediate signed by the current root and cross-signed by its replacement
+		ziti pki create intermediate --pki-root ./pki --ca-name root --cross-sign-ca root2 --intermediate-file intermediate
+
+		# create an intermediate for a partner, which may only issue certificates for their own domain and network
+		ziti pki create intermediate --pki-root ./pki --ca-name root --intermediate-file partner --permitted-dns partner.example.com --permitted-ip 10.20.0.0/16
+	`)
 )
 
 // PKICreateIntermediateOptions the options for the create spring command
@@ -49,6 +69,8 @@ func NewCmdPKICreateIntermediate(out io.Writer, errOut io.Writer) *cobra.Command
 	cmd := &cobra.Command{
 		Use:     "intermediate",
 		Short:   "Creates new Intermediate-chain certificate (signed by previously created CA)",
+		Long:    pkiCreateIntermediateLong,
+		Example: pkiCreateIntermediateExample,
 		Aliases: []string{"i"},
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
@@ -70,19 +92,43 @@ func (o *PKICreateIntermediateOptions) addPKICreateIntermediateFlags(cmd *cobra.
 	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 3650, "Expiration limit in days")
 	cmd.Flags().IntVarP(&o.Flags.CAMaxpath, "max-path-len", "", 0, "Intermediate maximum path length")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key")
+	cmd.Flags().StringVar(&o.Flags.CrossSignCA, "cross-sign-ca", "", "Name of a second CA (within PKI_ROOT) to also issue the new Intermediate CA, for root rotation")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
+	o.addKeyUsageFlags(cmd)
+	o.addNameConstraintFlags(cmd)
+	o.addSpiffeIDFlag(cmd, "new Intermediate CA")
+	o.addSubjectFlags(cmd, "new Intermediate CA")
+	o.addSerialFlags(cmd)
+	o.addCAKeyFlags(cmd)
 }
 
 // Run implements this command
 func (o *PKICreateIntermediateOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
+	}
+
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	intermediatefile, err := o.ObtainIntermediateCAFile()
 	if err != nil {
@@ -92,9 +138,13 @@ func (o *PKICreateIntermediateOptions) Run() error {
 	commonName := o.Flags.IntermediateName
 
 	filename := o.ObtainFileName(intermediatefile, commonName)
-	template := o.ObtainPKIRequestTemplate(commonName)
-
-	template.IsCA = true
+	template, err := o.ObtainPKIRequestTemplate(commonName, true)
+	if err != nil {
+		return err
+	}
+	if err := o.ApplyNameConstraints(template); err != nil {
+		return err
+	}
 
 	var signer *certificate.Bundle
 
@@ -108,18 +158,52 @@ func (o *PKICreateIntermediateOptions) Run() error {
 		return fmt.Errorf("Cannot locate signer: %v", err)
 	}
 
+	if err := o.ApplySpiffeID(template, signer.Cert); err != nil {
+		return err
+	}
+	if template.SerialNumber, err = o.ObtainSerial(pkiStore, caname); err != nil {
+		return err
+	}
+
+	var crossSigner *certificate.Bundle
+	if o.Flags.CrossSignCA != "" {
+		if o.Flags.CrossSignCA == caname {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--cross-sign-ca must be a different CA than --ca-name")
+		}
+		if crossSigner, err = o.Flags.PKI.GetCA(o.Flags.CrossSignCA); err != nil {
+			return fmt.Errorf("Cannot locate cross-signer: %v", err)
+		}
+		if err := checkSpiffeIDs(template, crossSigner.Cert); err != nil {
+			return err
+		}
+	}
+
 	req := &pki.Request{
 		Name:                filename,
 		Template:            template,
 		IsClientCertificate: false,
 		PrivateKeySize:      o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:        o.Flags.KeyAlgorithm,
+		Curve:               o.Flags.Curve,
+		SignatureAlgorithm:  o.Flags.SignatureAlgorithm,
 	}
 
 	if err := o.Flags.PKI.Sign(signer, req); err != nil {
 		return fmt.Errorf("Cannot Sign: %v", err)
 	}
 
-	log.Infoln("Success")
+	if crossSigner != nil {
+		if _, err := o.Flags.PKI.CrossSign(crossSigner, filename); err != nil {
+			return fmt.Errorf("Cannot cross-sign: %v", err)
+		}
+		for _, chainSigner := range []*certificate.Bundle{signer, crossSigner} {
+			if err := o.Flags.PKI.Chain(chainSigner, req); err != nil {
+				return err
+			}
+		}
+		o.logInfof("Cross-signed intermediate %v with CA %v\n", filename, crossSigner.Name)
+		return o.outputCreated(pkiStore, pkiResultIntermediate, caname, filename, caname, crossSigner.Name)
+	}
 
-	return nil
+	return o.outputCreated(pkiStore, pkiResultIntermediate, caname, filename)
 }
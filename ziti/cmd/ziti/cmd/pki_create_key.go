@@ -22,10 +22,8 @@ import (
 	"io"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
-	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
 	"github.com/openziti/ziti/ziti/pki/certificate"
 	"github.com/openziti/ziti/ziti/pki/pki"
-	"github.com/openziti/ziti/ziti/pki/store"
 )
 
 // PKICreateKeyOptions the options for the create spring command
@@ -67,19 +65,27 @@ func (o *PKICreateKeyOptions) addPKICreateKeyFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&o.Flags.CAName, "ca-name", "", "intermediate", "Name of Intermediate CA (within PKI_ROOT) to use to sign the new Client certificate")
 	cmd.Flags().StringVarP(&o.Flags.KeyFile, "key-file", "", "key", "Name of file (under chosen CA) in which to store new private key")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
 }
 
 // Run implements this command
 func (o *PKICreateKeyOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	keyFile, err := o.ObtainKeyFile(true)
 	if err != nil {
@@ -91,7 +97,10 @@ func (o *PKICreateKeyOptions) Run() error {
 		return fmt.Errorf("%s", err)
 	}
 
-	template := o.ObtainPKIRequestTemplate("")
+	template, err := o.ObtainPKIRequestTemplate("", false)
+	if err != nil {
+		return err
+	}
 	var signer *certificate.Bundle
 
 	signer, err = o.Flags.PKI.GetCA(caname)
@@ -104,13 +113,13 @@ func (o *PKICreateKeyOptions) Run() error {
 		Template:            template,
 		IsClientCertificate: false,
 		PrivateKeySize:      o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:        o.Flags.KeyAlgorithm,
+		Curve:               o.Flags.Curve,
 	}
 
 	if err := o.Flags.PKI.GeneratePrivateKey(signer, req); err != nil {
 		return fmt.Errorf("Cannot Generate Private key: %v", err)
 	}
 
-	log.Infoln("Success")
-
-	return nil
+	return o.outputCreated(pkiStore, pkiResultKey, caname, keyFile)
 }
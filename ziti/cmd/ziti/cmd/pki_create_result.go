@@ -0,0 +1,170 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+const (
+	pkiResultCA           = "ca"
+	pkiResultIntermediate = "intermediate"
+	pkiResultServer       = "server"
+	pkiResultClient       = "client"
+	pkiResultKey          = "key"
+	pkiResultCSR          = "csr"
+	pkiResultCRL          = "crl"
+	pkiResultSelfSigned   = "self-signed"
+)
+
+// pkiCreateResult describes what a pki create command created, output with --output so scripts don't need to know the
+// layout of the PKI. Paths are only given for a local PKI
+type pkiCreateResult struct {
+	Type        string              `json:"type"`
+	CA          string              `json:"ca"`
+	Name        string              `json:"name"`
+	KeyPath     string              `json:"keyPath,omitempty"`
+	CertPath    string              `json:"certPath,omitempty"`
+	ChainPaths  []string            `json:"chainPaths,omitempty"`
+	CSRPath     string              `json:"csrPath,omitempty"`
+	CRLPath     string              `json:"crlPath,omitempty"`
+	OutPath     string              `json:"outPath,omitempty"`
+	P12Path     string              `json:"p12Path,omitempty"`
+	Subject     string              `json:"subject,omitempty"`
+	Certificate *pkiCertDescription `json:"certificate,omitempty"`
+}
+
+// addResultOutputFlags adds the flags outputting the result of the command as JSON or YAML
+func (o *PKICreateOptions) addResultOutputFlags(cmd *cobra.Command) {
+	o.addOutputFlags(cmd, "the result, including the paths of the files created,")
+}
+
+// logInfof writes a progress message, unless the result is output as JSON or YAML, so that stdout is only the result
+func (o *PKIOptions) logInfof(msg string, args ...interface{}) {
+	if !o.structuredOutput() {
+		log.Infof(msg, args...)
+	}
+}
+
+// logWarnf writes a warning, to stderr if the result is output as JSON or YAML
+func (o *PKIOptions) logWarnf(msg string, args ...interface{}) {
+	if !o.structuredOutput() {
+		log.Warnf(msg, args...)
+		return
+	}
+	errOut := o.Err
+	if errOut == nil {
+		errOut = os.Stderr
+	}
+	_, _ = fmt.Fprintf(errOut, "WARNING: "+strings.TrimSuffix(msg, "\n")+"\n", args...)
+}
+
+// outputCreated reports the creation of the named bundle within the CA, as JSON or YAML with --output. The chains of
+// the bundle within each of chainCAs are included
+func (o *PKICreateOptions) outputCreated(pkiStore store.Store, resultType, caName, name string, chainCAs ...string) error {
+	if !o.structuredOutput() {
+		log.Infoln("Success")
+		return nil
+	}
+
+	result, err := createdResult(pkiStore, resultType, caName, name, chainCAs...)
+	if err != nil {
+		return err
+	}
+	return o.writeResult(result)
+}
+
+// createdResult describes the named bundle within the CA
+func createdResult(pkiStore store.Store, resultType, caName, name string, chainCAs ...string) (*pkiCreateResult, error) {
+	result := &pkiCreateResult{
+		Type: resultType,
+		CA:   caName,
+		Name: name,
+	}
+
+	local, isLocal := pkiStore.(*store.Local)
+	if isLocal {
+		keyPath, certPath := local.BundlePaths(caName, name)
+		if _, err := os.Stat(keyPath); err == nil {
+			result.KeyPath = keyPath
+		}
+		switch resultType {
+		case pkiResultCSR:
+			result.CSRPath = certPath
+		case pkiResultCRL:
+			result.CRLPath = local.CRLPath(caName)
+		case pkiResultKey:
+		default:
+			result.CertPath = certPath
+		}
+		for _, chainCA := range chainCAs {
+			result.ChainPaths = append(result.ChainPaths, local.ChainPath(chainCA, name))
+		}
+	}
+
+	switch resultType {
+	case pkiResultKey, pkiResultCRL:
+	case pkiResultCSR:
+		raw, err := pkiStore.FetchCert(caName, name)
+		if err != nil {
+			return nil, err
+		}
+		csr, err := x509.ParseCertificateRequest(raw)
+		if err != nil {
+			return nil, err
+		}
+		result.Subject = csr.Subject.String()
+	default:
+		raw, err := pkiStore.FetchCert(caName, name)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		result.Subject = cert.Subject.String()
+		result.Certificate = describeCert(cert)
+		result.Certificate.CA = caName
+		result.Certificate.Name = name
+	}
+
+	return result, nil
+}
+
+// pkiResultTypeOf returns the result type of a certificate, classified the same way as in the index of the PKI
+func pkiResultTypeOf(cert *x509.Certificate) string {
+	switch {
+	case cert.IsCA && bytes.Equal(cert.RawIssuer, cert.RawSubject):
+		return pkiResultCA
+	case cert.IsCA:
+		return pkiResultIntermediate
+	case len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0:
+		return pkiResultServer
+	default:
+		return pkiResultClient
+	}
+}
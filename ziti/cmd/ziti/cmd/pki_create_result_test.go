@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPKICreateJSONResult(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) *pkiCreateResult {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(append(args, "--json"))
+		req.NoError(cmd.Execute())
+
+		result := &pkiCreateResult{}
+		req.NoError(json.Unmarshal(out.Bytes(), result), out.String())
+		return result
+	}
+
+	result := run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	req.Equal(pkiResultCA, result.Type)
+	req.Equal(filepath.Join(root, "root", "keys", "root.key"), result.KeyPath)
+	req.Equal(filepath.Join(root, "root", "certs", "root.cert"), result.CertPath)
+	req.NotNil(result.Certificate)
+	req.True(result.Certificate.IsCA)
+	req.NotEmpty(result.Certificate.SHA256Fingerprint)
+
+	result = run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "server",
+		"--dns", "localhost", "--key-algorithm", "ecdsa")
+	req.Equal(pkiResultServer, result.Type)
+	req.Equal("root", result.CA)
+	req.Equal("server", result.Name)
+	req.Equal(filepath.Join(root, "root", "keys", "server.key"), result.KeyPath)
+	req.Equal([]string{filepath.Join(root, "root", "certs", "server.chain.pem")}, result.ChainPaths)
+	req.Equal([]string{"localhost"}, result.Certificate.DNSNames)
+	req.FileExists(result.ChainPaths[0])
+
+	result = run("create", "key", "--pki-root", root, "--ca-name", "root", "--key-file", "spare", "--key-algorithm", "ecdsa")
+	req.Equal(pkiResultKey, result.Type)
+	req.FileExists(result.KeyPath)
+	req.Empty(result.CertPath)
+	req.Nil(result.Certificate)
+
+	result = run("create", "crl", "--pki-root", root, "--ca-name", "root")
+	req.Equal(pkiResultCRL, result.Type)
+	req.FileExists(result.CRLPath)
+}
+
+func TestPKIStructuredOutput(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) string {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		return out.String()
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa", "--json")
+
+	// YAML uses the same field names, in the same order, as JSON
+	out := run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "client",
+		"--key-algorithm", "ecdsa", "--output", "yaml")
+	req.True(strings.HasPrefix(out, "type: client\nca: root\nname: client\n"), out)
+	result := &struct {
+		KeyPath     string `yaml:"keyPath"`
+		Certificate struct {
+			Serial          string `yaml:"serial"`
+			DaysUntilExpiry int    `yaml:"daysUntilExpiry"`
+		} `yaml:"certificate"`
+	}{}
+	req.NoError(yaml.Unmarshal([]byte(out), result))
+	req.Equal(filepath.Join(root, "root", "keys", "client.key"), result.KeyPath)
+	req.NotEmpty(result.Certificate.Serial)
+	req.Equal(364, result.Certificate.DaysUntilExpiry)
+
+	renewed := &pkiCreateResult{}
+	req.NoError(json.Unmarshal([]byte(run("renew", "--pki-root", root, "--ca-name", "root", "--name", "client", "--json")), renewed))
+	req.Equal(pkiResultClient, renewed.Type)
+	req.NotEqual(result.Certificate.Serial, renewed.Certificate.Serial)
+
+	exported := &pkiExportResult{}
+	p12 := filepath.Join(root, "client.p12")
+	req.NoError(json.Unmarshal([]byte(run("export", "p12", "--pki-root", root, "--ca-name", "root", "--name", "client",
+		"--out", p12, "--password", "secret", "--output", "json")), exported))
+	req.Equal(p12, exported.Path)
+	req.Len(exported.Certificates, 2)
+	req.Equal(renewed.Certificate.SHA256Fingerprint, exported.Certificates[0].SHA256Fingerprint)
+
+	revoked := &pkiRevokeResult{}
+	req.NoError(json.Unmarshal([]byte(run("revoke", "--pki-root", root, "--ca-name", "root", "--cert", "client", "--crl", "--json")), revoked))
+	req.Equal(renewed.Certificate.Serial, revoked.Serial)
+	req.FileExists(revoked.CRLPath)
+
+	cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+	cmd.SetArgs([]string{"list", "--pki-root", root, "--output", "xml"})
+	req.ErrorContains(cmd.Execute(), "unsupported output format xml")
+}
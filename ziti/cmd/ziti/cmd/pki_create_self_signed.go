@@ -0,0 +1,187 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/pki"
+)
+
+var (
+	pkiCreateSelfSignedLong = templates.LongDesc(`
+Creates a standalone, self-signed Server certificate, outside of any CA hierarchy, for quick development setups such as
+the web listener of a controller. The certificate and its private key are stored in a directory of their own within
+PKI_ROOT.
+
+Without --dns or --ip the certificate is valid for localhost and 127.0.0.1. It expires after 30 days by default, as
+self-signed certificates aren't meant for production, where a certificate signed by a CA should be used instead.
+	`)
+
+	pkiCreateSelfSignedExample = templates.Examples(`
+		# create a self-signed certificate for a controller's web listener on this machine
+		ziti pki create self-signed --pki-root ./pki
+
+		# create a self-signed certificate for a dev controller reachable by name and address, valid for a week
+		ziti pki create self-signed --pki-root ./pki --server-file ctrl-web --dns ctrl.dev.local --ip 192.168.1.10 --expire-limit 7
+	`)
+)
+
+// PKICreateSelfSignedOptions the options for the create self-signed command
+type PKICreateSelfSignedOptions struct {
+	PKICreateOptions
+}
+
+// NewCmdPKICreateSelfSigned creates a command object for the "create self-signed" command
+func NewCmdPKICreateSelfSigned(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKICreateSelfSignedOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "self-signed",
+		Short:   "Creates new standalone self-signed Server certificate (no CA), for development",
+		Long:    pkiCreateSelfSignedLong,
+		Example: pkiCreateSelfSignedExample,
+		Aliases: []string{"ss"},
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	options.addPKICreateSelfSignedFlags(cmd)
+	return cmd
+}
+
+func (o *PKICreateSelfSignedOptions) addPKICreateSelfSignedFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&o.Flags.ServerFile, "server-file", "", "self-signed", "Dir/File name (within PKI_ROOT) in which to store new self-signed Server certificate and private key")
+	cmd.Flags().StringVarP(&o.Flags.ServerName, "server-name", "", "", "Common Name (CN) to use for new self-signed Server certificate. Defaults to the first DNS name, or localhost")
+	o.addSANFlags(cmd, "new self-signed Server certificate")
+	o.addSubjectFlags(cmd, "new self-signed Server certificate")
+	cmd.Flags().StringVar(&o.Flags.AutoDNSFromConfig, "auto-dns-from-config", "", "Controller config file from which to derive the Subject Alternate Names (SANs) for new self-signed Server certificate")
+	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 30, "Expiration limit in days")
+	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 2048, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
+	o.addKeyUsageFlags(cmd)
+}
+
+// Run implements this command
+func (o *PKICreateSelfSignedOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if o.Flags.CAExpire <= 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--expire-limit must be at least one day")
+	}
+
+	if o.Flags.AutoDNSFromConfig != "" {
+		ips, dnsNames, err := sansFromConfigFile(o.Flags.AutoDNSFromConfig)
+		if err != nil {
+			return err
+		}
+		o.logInfof("adding SANs from %v: ips %v, dns names %v\n", o.Flags.AutoDNSFromConfig, ips, dnsNames)
+		o.Flags.IP = appendMissing(o.Flags.IP, ips...)
+		o.Flags.DNSName = appendMissing(o.Flags.DNSName, dnsNames...)
+	}
+
+	sans, err := o.ObtainSANs()
+	if err != nil {
+		return err
+	}
+	if len(sans.DNSNames) == 0 && len(sans.IPAddresses) == 0 {
+		sans.DNSNames = []string{"localhost"}
+		sans.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		o.logInfof("neither --ip or --dns were specified, creating certificate for localhost and 127.0.0.1\n")
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	commonName := o.Flags.ServerName
+	if commonName == "" {
+		commonName = "localhost"
+		if len(sans.DNSNames) > 0 {
+			commonName = sans.DNSNames[0]
+		}
+	}
+
+	serverCertFile, err := o.ObtainServerCertFile()
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+	filename := o.ObtainFileName(serverCertFile, commonName)
+
+	template, err := o.ObtainPKIRequestTemplate(commonName, false)
+	if err != nil {
+		return err
+	}
+	if len(template.ExtKeyUsage) == 0 {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	template.IPAddresses = sans.IPAddresses
+	template.DNSNames = sans.DNSNames
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
+
+	req := &pki.Request{
+		Name:               filename,
+		Template:           template,
+		PrivateKeySize:     o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:       o.Flags.KeyAlgorithm,
+		Curve:              o.Flags.Curve,
+		SignatureAlgorithm: o.Flags.SignatureAlgorithm,
+	}
+
+	if err := o.Flags.PKI.SelfSign(req); err != nil {
+		return fmt.Errorf("Cannot Sign: %v", err)
+	}
+
+	return o.outputCreated(pkiStore, pkiResultSelfSigned, filename, filename)
+}
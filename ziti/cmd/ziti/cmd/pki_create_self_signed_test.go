@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKICreateSelfSigned(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	out := &bytes.Buffer{}
+	cmd := NewCmdPKI(out, ioutil.Discard)
+	cmd.SetArgs([]string{"create", "self-signed", "--pki-root", root, "--key-algorithm", "ecdsa", "--output", "json"})
+	req.NoError(cmd.Execute())
+
+	result := &pkiCreateResult{}
+	req.NoError(json.Unmarshal(out.Bytes(), result))
+	req.Equal(pkiResultSelfSigned, result.Type)
+	req.Equal("self-signed", result.CA)
+	req.Equal("self-signed", result.Name)
+	req.FileExists(result.KeyPath)
+
+	raw, err := ioutil.ReadFile(result.CertPath)
+	req.NoError(err)
+	block, _ := pem.Decode(raw)
+	req.NotNil(block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	req.NoError(err)
+
+	req.False(cert.IsCA)
+	req.Equal("localhost", cert.Subject.CommonName)
+	req.Equal(cert.Subject.String(), cert.Issuer.String())
+	req.NoError(cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature))
+	req.Equal([]string{"localhost"}, cert.DNSNames)
+	req.Len(cert.IPAddresses, 1)
+	req.Equal("127.0.0.1", cert.IPAddresses[0].String())
+	req.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+	req.WithinDuration(time.Now().AddDate(0, 0, 30), cert.NotAfter, time.Hour)
+}
@@ -17,20 +17,43 @@
 package cmd
 
 import (
+	"crypto/x509"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
 
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
 	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
 	"github.com/openziti/ziti/ziti/pki/certificate"
 	"github.com/openziti/ziti/ziti/pki/pki"
-	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiCreateServerLong = templates.LongDesc(`
+Creates a new Server certificate, signed by a previously created CA or Intermediate CA.
+
+With --also-client a Client certificate with the same subject and SANs is also created, sharing the private key of the
+Server certificate. This suits routers, which both accept and dial connections with the same identity.
+	`)
+
+	pkiCreateServerExample = templates.Examples(`
+		# create a server and client certificate for a router, sharing a key
+		ziti pki create server --pki-root ./pki --ca-name intermediate --server-file router1 --dns router1.example.com --also-client
+	`)
 )
 
 // PKICreateServerOptions the options for the create spring command
 type PKICreateServerOptions struct {
 	PKICreateOptions
+
+	alsoClient bool
 }
 
 // NewCmdPKICreateServer creates a command object for the "create" command
@@ -49,6 +72,8 @@ func NewCmdPKICreateServer(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "server",
 		Short:   "Creates new Server certificate (signed by previously created Intermediate-chain)",
+		Long:    pkiCreateServerLong,
+		Example: pkiCreateServerExample,
 		Aliases: []string{"s"},
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
@@ -68,29 +93,74 @@ func (o *PKICreateServerOptions) addPKICreateServerFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&o.Flags.ServerFile, "server-file", "", "server", "Name of file (under chosen CA) in which to store new Server certificate and private key")
 	cmd.Flags().StringVarP(&o.Flags.KeyFile, "key-file", "", "", "Name of file (under chosen CA) containing private key to use when generating Server certificate")
 	cmd.Flags().StringVarP(&o.Flags.ServerName, "server-name", "", "NetFoundry Inc. Server", "Common Name (CN) to use for new Server certificate")
-	cmd.Flags().StringSliceVar(&o.Flags.DNSName, "dns", []string{}, "DNS name(s) to add to Subject Alternate Name (SAN) for new Server certificate")
-	cmd.Flags().StringSliceVar(&o.Flags.IP, "ip", []string{}, "IP addr(s) to add to Subject Alternate Name (SAN) for new Server certificate")
+	o.addSANFlags(cmd, "new Server certificate")
+	o.addSubjectFlags(cmd, "new Server certificate")
+	o.addSerialFlags(cmd)
+	o.addSpiffeIDFlag(cmd, "new Server certificate")
+	cmd.Flags().StringVar(&o.Flags.AutoDNSFromConfig, "auto-dns-from-config", "", "Router or controller config file from which to derive the Subject Alternate Names (SANs) for new Server certificate")
 	cmd.Flags().IntVarP(&o.Flags.CAExpire, "expire-limit", "", 365, "Expiration limit in days")
 	cmd.Flags().IntVarP(&o.Flags.CAMaxpath, "max-path-len", "", -1, "Intermediate maximum path length")
 	cmd.Flags().IntVarP(&o.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key")
+	o.addKeyAlgorithmFlags(cmd)
+	o.addSignatureAlgorithmFlag(cmd)
+	o.addKeyPasswordFlags(cmd)
+	o.addResultOutputFlags(cmd)
+	o.addKeyUsageFlags(cmd)
+	o.addCAKeyFlags(cmd)
+	cmd.Flags().BoolVar(&o.alsoClient, "also-client", false, "Also create a Client certificate with the same subject and SANs, sharing the private key of the new Server certificate")
+	cmd.Flags().StringVar(&o.Flags.ClientFile, "client-file", "", "Name of file (under chosen CA) in which to store the Client certificate created with --also-client. Defaults to the server file suffixed with -client")
+	cmd.Flags().StringVar(&o.Flags.ClientName, "client-name", "", "Common Name (CN) to use for the Client certificate created with --also-client. Defaults to --server-name")
 }
 
 // Run implements this command
 func (o *PKICreateServerOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
 
-	IPs, DNSNames, err := o.ObtainIPsAndDNSNames()
+	if o.Flags.AutoDNSFromConfig != "" {
+		ips, dnsNames, err := sansFromConfigFile(o.Flags.AutoDNSFromConfig)
+		if err != nil {
+			return err
+		}
+		o.logInfof("adding SANs from %v: ips %v, dns names %v\n", o.Flags.AutoDNSFromConfig, ips, dnsNames)
+		o.Flags.IP = appendMissing(o.Flags.IP, ips...)
+		o.Flags.DNSName = appendMissing(o.Flags.DNSName, dnsNames...)
+	}
+
+	if o.alsoClient && o.Flags.Serial != "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--serial can't be used with --also-client, as both certificates would have the same serial number")
+	}
+	if !o.alsoClient && (o.Flags.ClientFile != "" || o.Flags.ClientName != "") {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--client-file and --client-name are only used with --also-client")
+	}
+
+	sans, err := o.ObtainSANs()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
+	}
+	if len(sans.DNSNames) == 0 && len(sans.IPAddresses) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "neither --ip or --dns were specified (either one, or both, must be specified)")
 	}
 
-	pkiroot, err := o.ObtainPKIRoot()
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
 	if err != nil {
-		return fmt.Errorf("%s", err)
+		return err
 	}
 
-	o.Flags.PKI = &pki.ZitiPKI{Store: &store.Local{}}
-	local := o.Flags.PKI.Store.(*store.Local)
-	local.Root = pkiroot
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
 
 	commonName := o.Flags.ServerName
 
@@ -100,11 +170,15 @@ func (o *PKICreateServerOptions) Run() error {
 	}
 
 	filename := o.ObtainFileName(serverCertFile, commonName)
-	template := o.ObtainPKIRequestTemplate(commonName)
+	template, err := o.ObtainPKIRequestTemplate(commonName, false)
+	if err != nil {
+		return err
+	}
 
-	template.IsCA = false
-	template.IPAddresses = IPs
-	template.DNSNames = DNSNames
+	template.IPAddresses = sans.IPAddresses
+	template.DNSNames = sans.DNSNames
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
 
 	var signer *certificate.Bundle
 
@@ -123,12 +197,22 @@ func (o *PKICreateServerOptions) Run() error {
 		return fmt.Errorf("Cannot locate signer: %v", err)
 	}
 
+	if err := o.ApplySpiffeID(template, signer.Cert); err != nil {
+		return err
+	}
+	if template.SerialNumber, err = o.ObtainSerial(pkiStore, caname); err != nil {
+		return err
+	}
+
 	req := &pki.Request{
 		Name:                filename,
 		KeyName:             keyFile,
 		Template:            template,
 		IsClientCertificate: false,
 		PrivateKeySize:      o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:        o.Flags.KeyAlgorithm,
+		Curve:               o.Flags.Curve,
+		SignatureAlgorithm:  o.Flags.SignatureAlgorithm,
 	}
 
 	if err := o.Flags.PKI.Sign(signer, req); err != nil {
@@ -140,7 +224,198 @@ func (o *PKICreateServerOptions) Run() error {
 		return fmt.Errorf("Cannot Sign: %v", err)
 	}
 
-	log.Infoln("Success")
+	if !o.alsoClient {
+		return o.outputCreated(pkiStore, pkiResultServer, caname, filename, caname)
+	}
+
+	clientFilename, err := o.signAlsoClient(signer, req)
+	if err != nil {
+		return err
+	}
+
+	if !o.structuredOutput() {
+		log.Infoln("Success")
+		return nil
+	}
+	var results []*pkiCreateResult
+	for _, created := range []struct{ resultType, name string }{{pkiResultServer, filename}, {pkiResultClient, clientFilename}} {
+		result, err := createdResult(pkiStore, created.resultType, caname, created.name, caname)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+	return o.writeResult(results)
+}
 
-	return nil
+// signAlsoClient creates the Client certificate of --also-client, with the private key of the just created Server
+// certificate, returning its name
+func (o *PKICreateServerOptions) signAlsoClient(signer *certificate.Bundle, serverReq *pki.Request) (string, error) {
+	clientFilename := o.Flags.ClientFile
+	if clientFilename == "" {
+		clientFilename = serverReq.Name + "-client"
+	}
+
+	template := *serverReq.Template
+	template.SerialNumber = nil
+	if o.Flags.ClientName != "" {
+		template.Subject.CommonName = o.Flags.ClientName
+	}
+	// an explicit server auth usage becomes client auth
+	template.ExtKeyUsage = nil
+	for _, usage := range serverReq.Template.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			usage = x509.ExtKeyUsageClientAuth
+		}
+		found := false
+		for _, existing := range template.ExtKeyUsage {
+			found = found || existing == usage
+		}
+		if !found {
+			template.ExtKeyUsage = append(template.ExtKeyUsage, usage)
+		}
+	}
+
+	keyName := serverReq.KeyName
+	if keyName == "" {
+		keyName = serverReq.Name
+	}
+
+	req := &pki.Request{
+		Name:                clientFilename,
+		KeyName:             keyName,
+		Template:            &template,
+		IsClientCertificate: true,
+		SignatureAlgorithm:  serverReq.SignatureAlgorithm,
+	}
+	if err := o.Flags.PKI.Sign(signer, req); err != nil {
+		return "", fmt.Errorf("Cannot Sign client certificate: %v", err)
+	}
+	if err := o.Flags.PKI.Chain(signer, req); err != nil {
+		return "", fmt.Errorf("Cannot Sign client certificate: %v", err)
+	}
+	o.logInfof("Created client certificate %v sharing the private key of %v\n", clientFilename, serverReq.Name)
+	return clientFilename, nil
+}
+
+// configAddressKeys are the config keys which hold addresses a router or controller listens on or advertises
+var configAddressKeys = map[string]bool{
+	"address":          true,
+	"advertise":        true,
+	"advertiseAddress": true,
+	"bind":             true,
+	"interface":        true,
+	"listener":         true,
+}
+
+// sansFromConfigFile derives the IP and DNS SANs a server certificate needs from the addresses in a router or controller config file
+func sansFromConfigFile(path string) ([]string, []string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to read config file %v", path)
+	}
+
+	config := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to parse config file %v", path)
+	}
+
+	var ips, dnsNames []string
+	addHost := func(host string) {
+		host = strings.TrimSpace(os.ExpandEnv(host))
+		if host == "" || strings.Contains(host, "$") {
+			return
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() {
+				ips = appendMissing(ips, ip.String())
+			}
+		} else {
+			dnsNames = appendMissing(dnsNames, host)
+		}
+	}
+
+	var walk func(key string, val interface{})
+	walk = func(key string, val interface{}) {
+		switch v := val.(type) {
+		case map[interface{}]interface{}:
+			for k, child := range v {
+				childKey := fmt.Sprintf("%v", k)
+				if sans, ok := child.(map[interface{}]interface{}); ok && childKey == "sans" {
+					for _, dns := range toStringSlice(sans["dns"]) {
+						addHost(dns)
+					}
+					for _, ip := range toStringSlice(sans["ip"]) {
+						addHost(ip)
+					}
+					continue
+				}
+				walk(childKey, child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(key, child)
+			}
+		case string:
+			if configAddressKeys[key] {
+				addHost(hostFromConfigAddress(v))
+			}
+		}
+	}
+	walk("", config)
+
+	if len(ips) == 0 && len(dnsNames) == 0 {
+		return nil, nil, errors.Errorf("no addresses found in config file %v", path)
+	}
+	return ips, dnsNames, nil
+}
+
+// hostFromConfigAddress extracts the host from config addresses such as tls:host:port, host:port or host
+func hostFromConfigAddress(address string) string {
+	address = os.ExpandEnv(address)
+	if net.ParseIP(address) == nil {
+		// strip leading transport, ex: tls: or transport:
+		if idx := strings.Index(address, ":"); idx > 0 && strings.Count(address, ":") > 1 && isLetters(address[:idx]) {
+			address = address[idx+1:]
+		}
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.Trim(address, "[]")
+}
+
+func isLetters(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func toStringSlice(val interface{}) []string {
+	var result []string
+	if list, ok := val.([]interface{}); ok {
+		for _, v := range list {
+			result = append(result, fmt.Sprintf("%v", v))
+		}
+	}
+	return result
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, val := range values {
+		found := false
+		for _, existing := range list {
+			if existing == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, val)
+		}
+	}
+	return list
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSansFromConfigFile(t *testing.T) {
+	req := require.New(t)
+
+	config := `
+ctrl:
+  endpoint: tls:ctrl.example.com:6262
+link:
+  listeners:
+    - binding: transport
+      bind: tls:0.0.0.0:10080
+      advertise: tls:router.example.com:10080
+listeners:
+  - binding: edge
+    address: tls:0.0.0.0:3022
+    options:
+      advertise: 10.0.0.5:3022
+edge:
+  csr:
+    sans:
+      dns:
+        - localhost
+        - router.example.com
+      ip:
+        - 127.0.0.1
+`
+	path := filepath.Join(t.TempDir(), "router.yml")
+	req.NoError(ioutil.WriteFile(path, []byte(config), 0600))
+
+	ips, dnsNames, err := sansFromConfigFile(path)
+	req.NoError(err)
+	req.ElementsMatch([]string{"10.0.0.5", "127.0.0.1"}, ips)
+	req.ElementsMatch([]string{"router.example.com", "localhost"}, dnsNames)
+}
+
+func TestHostFromConfigAddress(t *testing.T) {
+	req := require.New(t)
+	req.Equal("example.com", hostFromConfigAddress("tls:example.com:443"))
+	req.Equal("example.com", hostFromConfigAddress("example.com:443"))
+	req.Equal("example.com", hostFromConfigAddress("example.com"))
+	req.Equal("::1", hostFromConfigAddress("tls:[::1]:443"))
+	req.Equal("::1", hostFromConfigAddress("::1"))
+}
+
+func TestPKICreateServerAlsoClient(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) *bytes.Buffer {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		return out
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--private-key-size", "2048")
+	out := run("create", "server", "--pki-root", root, "--ca-name", "root", "--server-file", "router1",
+		"--server-name", "router1", "--dns", "router1.example.com", "--ext-key-usage", "server-auth",
+		"--private-key-size", "2048", "--also-client", "--output", "json")
+
+	var results []*pkiCreateResult
+	req.NoError(json.Unmarshal(out.Bytes(), &results))
+	req.Len(results, 2)
+	req.Equal(pkiResultServer, results[0].Type)
+	req.Equal(pkiResultClient, results[1].Type)
+	req.Equal("router1-client", results[1].Name)
+
+	server := readPKICerts(t, results[0].CertPath)[0]
+	client := readPKICerts(t, results[1].CertPath)[0]
+	req.Equal(server.RawSubjectPublicKeyInfo, client.RawSubjectPublicKeyInfo)
+	req.NotEqual(server.SerialNumber, client.SerialNumber)
+	req.Equal([]string{"router1.example.com"}, client.DNSNames)
+	req.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, server.ExtKeyUsage)
+	req.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, client.ExtKeyUsage)
+
+	serverKey, err := ioutil.ReadFile(filepath.Join(root, "root", "keys", "router1.key"))
+	req.NoError(err)
+	clientKey, err := ioutil.ReadFile(filepath.Join(root, "root", "keys", "router1-client.key"))
+	req.NoError(err)
+	req.Equal(serverKey, clientKey)
+}
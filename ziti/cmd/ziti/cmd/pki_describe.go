@@ -0,0 +1,352 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiDescribeLong = templates.LongDesc(`
+Describes a certificate in the PKI: its subject, SANs, key type, validity, key usages and whether it chains to a
+root CA in the PKI and has been revoked.
+	`)
+
+	pkiDescribeExample = templates.Examples(`
+		# describe the server certificate 'server1' issued by the intermediate CA
+		ziti pki describe --pki-root ./pki --ca-name intermediate --name server1
+
+		# describe the intermediate CA itself, as JSON
+		ziti pki describe --pki-root ./pki --ca-name intermediate --json
+	`)
+)
+
+// PKIDescribeOptions the options for the pki describe command
+type PKIDescribeOptions struct {
+	PKICreateOptions
+
+	name string
+}
+
+// pkiCertDescription describes a certificate in the PKI
+type pkiCertDescription struct {
+	CA                 string    `json:"ca"`
+	Name               string    `json:"name"`
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	Serial             string    `json:"serial"`
+	IsCA               bool      `json:"isCA"`
+	MaxPathLen         *int      `json:"maxPathLen,omitempty"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	Emails             []string  `json:"emails,omitempty"`
+	URIs               []string  `json:"uris,omitempty"`
+	KeyType            string    `json:"keyType"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DaysUntilExpiry    int       `json:"daysUntilExpiry"`
+	KeyUsages          []string  `json:"keyUsages,omitempty"`
+	ExtKeyUsages       []string  `json:"extKeyUsages,omitempty"`
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+	Revoked            bool      `json:"revoked"`
+	Chain              []string  `json:"chain,omitempty"`
+	ChainValid         bool      `json:"chainValid"`
+	ChainError         string    `json:"chainError,omitempty"`
+}
+
+// NewCmdPKIDescribe creates a command object for the "pki describe" command
+func NewCmdPKIDescribe(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIDescribeOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "describe",
+		Short:   "Describes a certificate in the PKI",
+		Long:    pkiDescribeLong,
+		Example: pkiDescribeExample,
+		Aliases: []string{"inspect"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificate")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the certificate (within the CA) to describe. Defaults to the CA itself")
+	options.addOutputFlags(cmd, "the description")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIDescribeOptions) Run() error {
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	name := o.name
+	if name == "" {
+		name = caname
+	}
+
+	raw, err := pkiStore.FetchCert(caname, name)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "Cannot locate certificate %v within CA %v: %v", name, caname, err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return fmt.Errorf("failed parsing certificate %v: %v", name, err)
+	}
+
+	desc := describeCert(cert)
+	desc.CA = caname
+	desc.Name = name
+
+	// a CA's own certificate is revoked by its issuer, which isn't necessarily in the PKI
+	if revoked, err := pkiStore.Revoked(caname); err == nil && name != caname {
+		for _, entry := range revoked {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				desc.Revoked = true
+			}
+		}
+	}
+
+	verifyCertChain(desc, cert, pkiStore, caname)
+
+	if o.structuredOutput() {
+		return o.writeResult(desc)
+	}
+
+	o.outputDescription(desc)
+	return nil
+}
+
+func describeCert(cert *x509.Certificate) *pkiCertDescription {
+	fingerprint := sha256.Sum256(cert.Raw)
+	desc := &pkiCertDescription{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             fmt.Sprintf("%X", cert.SerialNumber),
+		IsCA:               cert.IsCA,
+		DNSNames:           cert.DNSNames,
+		Emails:             cert.EmailAddresses,
+		KeyType:            describeKeyType(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		DaysUntilExpiry:    int(time.Until(cert.NotAfter).Hours() / 24),
+		KeyUsages:          describeKeyUsage(cert.KeyUsage),
+		SHA256Fingerprint:  fmt.Sprintf("%X", fingerprint[:]),
+	}
+	if cert.IsCA && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+		maxPathLen := cert.MaxPathLen
+		desc.MaxPathLen = &maxPathLen
+	}
+	for _, ip := range cert.IPAddresses {
+		desc.IPAddresses = append(desc.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		desc.URIs = append(desc.URIs, uri.String())
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		desc.ExtKeyUsages = append(desc.ExtKeyUsages, describeExtKeyUsage(usage))
+	}
+	return desc
+}
+
+// verifyCertChain checks that the certificate chains to a self-signed root through the CAs in the store
+func verifyCertChain(desc *pkiCertDescription, cert *x509.Certificate, pkiStore store.Store, caname string) {
+	chain, err := store.CAChain(pkiStore, caname)
+	if err != nil {
+		desc.ChainError = err.Error()
+		return
+	}
+	if len(chain) > 0 && chain[0].Equal(cert) {
+		chain = chain[1:]
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for i, ca := range chain {
+		if i == len(chain)-1 {
+			roots.AddCert(ca)
+		} else {
+			intermediates.AddCert(ca)
+		}
+	}
+	if len(chain) == 0 {
+		// a root CA verifies against itself
+		roots.AddCert(cert)
+	}
+
+	verified, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		desc.ChainError = err.Error()
+		return
+	}
+
+	desc.ChainValid = true
+	for _, c := range verified[0] {
+		desc.Chain = append(desc.Chain, c.Subject.CommonName)
+	}
+}
+
+func describeKeyType(publicKey interface{}) string {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", publicKey)
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Content Commitment"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+func describeKeyUsage(usage x509.KeyUsage) []string {
+	var result []string
+	for _, u := range keyUsageNames {
+		if usage&u.usage != 0 {
+			result = append(result, u.name)
+		}
+	}
+	return result
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "Any",
+	x509.ExtKeyUsageServerAuth:      "Server Auth",
+	x509.ExtKeyUsageClientAuth:      "Client Auth",
+	x509.ExtKeyUsageCodeSigning:     "Code Signing",
+	x509.ExtKeyUsageEmailProtection: "Email Protection",
+	x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+}
+
+func describeExtKeyUsage(usage x509.ExtKeyUsage) string {
+	if name, found := extKeyUsageNames[usage]; found {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%d)", usage)
+}
+
+func (o *PKIDescribeOptions) outputDescription(desc *pkiCertDescription) {
+	validity := "valid"
+	switch {
+	case desc.Revoked:
+		validity = "revoked"
+	case time.Now().After(desc.NotAfter):
+		validity = "expired"
+	case time.Now().Before(desc.NotBefore):
+		validity = "not yet valid"
+	}
+
+	chain := strings.Join(desc.Chain, " -> ")
+	if !desc.ChainValid {
+		chain = "invalid: " + desc.ChainError
+	}
+
+	maxPathLen := ""
+	if desc.MaxPathLen != nil {
+		maxPathLen = fmt.Sprintf("%d", *desc.MaxPathLen)
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Field", "Value"})
+	t.AppendRows([]table.Row{
+		{"CA", desc.CA},
+		{"Name", desc.Name},
+		{"Subject", desc.Subject},
+		{"Issuer", desc.Issuer},
+		{"Serial", desc.Serial},
+		{"Is CA", desc.IsCA},
+		{"Max Path Length", maxPathLen},
+		{"DNS SANs", strings.Join(desc.DNSNames, "\n")},
+		{"IP SANs", strings.Join(desc.IPAddresses, "\n")},
+		{"Email SANs", strings.Join(desc.Emails, "\n")},
+		{"URI SANs", strings.Join(desc.URIs, "\n")},
+		{"Key Type", desc.KeyType},
+		{"Signature Algorithm", desc.SignatureAlgorithm},
+		{"Not Before", desc.NotBefore.Format("2006-01-02 15:04:05")},
+		{"Not After", desc.NotAfter.Format("2006-01-02 15:04:05")},
+		{"Days Until Expiry", desc.DaysUntilExpiry},
+		{"Status", validity},
+		{"Key Usages", strings.Join(desc.KeyUsages, "\n")},
+		{"Extended Key Usages", strings.Join(desc.ExtKeyUsages, "\n")},
+		{"SHA-256 Fingerprint", desc.SHA256Fingerprint},
+		{"Chain", chain},
+	})
+	t.SetOutputMirror(o.Out)
+	t.Render()
+}
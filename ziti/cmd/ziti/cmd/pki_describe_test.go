@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIDescribe(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) *bytes.Buffer {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		return out
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "intermediate", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "intermediate", "--server-file", "server1",
+		"--dns", "localhost,ctrl.example.com", "--ip", "127.0.0.1", "--key-algorithm", "ecdsa")
+
+	describe := func(args ...string) *pkiCertDescription {
+		out := run(append([]string{"describe", "--pki-root", root, "--json"}, args...)...)
+		desc := &pkiCertDescription{}
+		req.NoError(json.Unmarshal(out.Bytes(), desc))
+		return desc
+	}
+
+	desc := describe("--ca-name", "intermediate", "--name", "server1")
+	req.Equal("server1", desc.Name)
+	req.False(desc.IsCA)
+	req.Equal([]string{"localhost", "ctrl.example.com"}, desc.DNSNames)
+	req.Equal([]string{"127.0.0.1"}, desc.IPAddresses)
+	req.Equal("ECDSA P-256", desc.KeyType)
+	req.True(desc.ChainValid, desc.ChainError)
+	req.Len(desc.Chain, 3)
+	req.False(desc.Revoked)
+
+	desc = describe("--ca-name", "root")
+	req.True(desc.IsCA)
+	req.Contains(desc.KeyUsages, "Certificate Sign")
+	req.True(desc.ChainValid, desc.ChainError)
+	req.Len(desc.Chain, 1)
+
+	run("revoke", "--pki-root", root, "--ca-name", "intermediate", "--cert", "server1")
+	req.True(describe("--ca-name", "intermediate", "--name", "server1").Revoked)
+
+	table := run("describe", "--pki-root", root, "--ca-name", "intermediate", "--name", "server1").String()
+	req.Contains(table, "ctrl.example.com")
+	req.Contains(table, "revoked")
+}
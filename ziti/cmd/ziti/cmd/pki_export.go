@@ -0,0 +1,103 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+const (
+	pkiExportP12   = "p12"
+	pkiExportChain = "chain"
+)
+
+// pkiExportResult describes what a pki export command wrote, output with --output
+type pkiExportResult struct {
+	Type         string             `json:"type"`
+	CA           string             `json:"ca"`
+	Name         string             `json:"name"`
+	Path         string             `json:"path"`
+	Certificates []*pkiExportedCert `json:"certificates"`
+}
+
+// pkiExportedCert is a certificate within an export, in the order they were written
+type pkiExportedCert struct {
+	Subject           string    `json:"subject"`
+	Serial            string    `json:"serial"`
+	SHA256Fingerprint string    `json:"sha256Fingerprint"`
+	NotAfter          time.Time `json:"notAfter"`
+}
+
+func newExportResult(exportType, caName, name, path string, certs []*x509.Certificate) *pkiExportResult {
+	result := &pkiExportResult{
+		Type: exportType,
+		CA:   caName,
+		Name: name,
+		Path: path,
+	}
+	for _, cert := range certs {
+		fingerprint := sha256.Sum256(cert.Raw)
+		result.Certificates = append(result.Certificates, &pkiExportedCert{
+			Subject:           cert.Subject.String(),
+			Serial:            fmt.Sprintf("%X", cert.SerialNumber),
+			SHA256Fingerprint: fmt.Sprintf("%X", fingerprint[:]),
+			NotAfter:          cert.NotAfter.UTC(),
+		})
+	}
+	return result
+}
+
+// PKIExportOptions the options for the pki export command
+type PKIExportOptions struct {
+	PKIOptions
+}
+
+// NewCmdPKIExport creates a command object for the "pki export" command
+func NewCmdPKIExport(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIExportOptions{
+		PKIOptions: PKIOptions{
+			CommonOptions: CommonOptions{
+				Out: out,
+				Err: errOut,
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports certificates and keys from the PKI in other formats",
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.AddCommand(NewCmdPKIExportP12(out, errOut))
+	cmd.AddCommand(NewCmdPKIExportChain(out, errOut))
+
+	return cmd
+}
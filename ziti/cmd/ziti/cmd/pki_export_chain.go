@@ -0,0 +1,189 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiExportChainLong = templates.LongDesc(`
+Exports a certificate from the PKI together with the CAs which issued it as a single PEM bundle, in the order TLS
+servers and clients expect: the certificate first, followed by each issuing CA up to, but not including, the root.
+
+The root CA is normally distributed separately as a trust anchor, so it's only included with --include-root.
+	`)
+
+	pkiExportChainExample = templates.Examples(`
+		# write the server certificate 'router1' followed by its intermediate CAs to router1.chain.pem
+		ziti pki export chain --pki-root ./pki --ca-name intermediate --name router1 --out router1.chain.pem
+
+		# print the full chain of the intermediate CA, including the root
+		ziti pki export chain --pki-root ./pki --ca-name intermediate --include-root
+	`)
+)
+
+// PKIExportChainOptions the options for the pki export chain command
+type PKIExportChainOptions struct {
+	PKICreateOptions
+
+	name        string
+	outFile     string
+	includeRoot bool
+}
+
+// NewCmdPKIExportChain creates a command object for the "pki export chain" command
+func NewCmdPKIExportChain(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIExportChainOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "chain",
+		Short:   "Exports a certificate and the CAs which issued it as a PEM bundle",
+		Long:    pkiExportChainLong,
+		Example: pkiExportChainExample,
+		Aliases: []string{"bundle"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificate")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the certificate (within the CA) to export. Defaults to the CA itself")
+	cmd.Flags().StringVarP(&options.outFile, "out", "o", "", "File to write the PEM bundle to. Defaults to standard output")
+	cmd.Flags().BoolVar(&options.includeRoot, "include-root", false, "Also include the self-signed root CA at the end of the bundle")
+	options.addOutputFlags(cmd, "what was exported, with --out,")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIExportChainOptions) Run() error {
+	if o.structuredOutput() && o.outFile == "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--output and --json require --out, as the PEM bundle is otherwise written to standard output")
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	name := o.name
+	if name == "" {
+		name = caname
+	}
+
+	raw, err := pkiStore.FetchCert(caname, name)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "Cannot locate certificate %v of CA %v: %v", name, caname, err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return fmt.Errorf("failed parsing certificate %v: %v", name, err)
+	}
+
+	chain, err := o.exportChain(pkiStore, caname, cert)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, c := range chain {
+		if err := pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+			return err
+		}
+	}
+
+	if o.outFile == "" {
+		_, err = o.Out.Write(buf.Bytes())
+		return err
+	}
+
+	if err := ioutil.WriteFile(o.outFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed writing certificate chain to %v: %v", o.outFile, err)
+	}
+
+	if o.structuredOutput() {
+		return o.writeResult(newExportResult(pkiExportChain, caname, name, o.outFile, chain))
+	}
+
+	log.Infof("Exported %v with %v CA certificates to %v\n", name, len(chain)-1, o.outFile)
+	return nil
+}
+
+// exportChain orders the certificate and the CAs which issued it from leaf to root, checking that each certificate
+// was signed by the next, and drops the root unless it was asked for
+func (o *PKIExportChainOptions) exportChain(pkiStore store.Store, caname string, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	caChain, err := store.CAChain(pkiStore, caname)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot locate CA chain: %v", err)
+	}
+
+	// when exporting a CA, the CA chain starts with the CA itself
+	if len(caChain) > 0 && caChain[0].Equal(cert) {
+		caChain = caChain[1:]
+	}
+
+	chain := []*x509.Certificate{cert}
+	for _, ca := range caChain {
+		last := chain[len(chain)-1]
+		if err := last.CheckSignatureFrom(ca); err != nil {
+			return nil, fmt.Errorf("certificate %v was not issued by CA %v: %v", last.Subject.CommonName, ca.Subject.CommonName, err)
+		}
+		chain = append(chain, ca)
+	}
+
+	last := chain[len(chain)-1]
+	isRoot := bytes.Equal(last.RawIssuer, last.RawSubject) && last.CheckSignatureFrom(last) == nil
+	if !isRoot {
+		o.logWarnf("the chain of %v ends at %v, which isn't a self-signed root. Its issuer isn't in the PKI\n", cert.Subject.CommonName, last.Subject.CommonName)
+	} else if !o.includeRoot && len(chain) > 1 {
+		chain = chain[:len(chain)-1]
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIExportChain(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "inter", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "router1", "--dns", "router1.example.com", "--key-algorithm", "ecdsa")
+
+	out := &bytes.Buffer{}
+	options := &PKIExportChainOptions{name: "router1"}
+	options.Out = out
+	options.Flags.PKIRoot = root
+	options.Flags.CAName = "inter"
+	req.NoError(options.Run())
+
+	var commonNames []string
+	for block, rest := pem.Decode(out.Bytes()); block != nil; block, rest = pem.Decode(rest) {
+		req.Equal("CERTIFICATE", block.Type)
+		certs, err := certtools.LoadCert(pem.EncodeToMemory(block))
+		req.NoError(err)
+		commonNames = append(commonNames, certs[0].Subject.CommonName)
+	}
+	req.Len(commonNames, 2)
+	req.Equal("NetFoundry Inc. Server", commonNames[0])
+
+	outFile := filepath.Join(root, "router1.chain.pem")
+	options = &PKIExportChainOptions{name: "router1", outFile: outFile, includeRoot: true}
+	options.Out = ioutil.Discard
+	options.Flags.PKIRoot = root
+	options.Flags.CAName = "inter"
+	req.NoError(options.Run())
+
+	certs, err := certtools.LoadCertFromFile(outFile)
+	req.NoError(err)
+	req.Len(certs, 3)
+	for i := 0; i < len(certs)-1; i++ {
+		req.NoError(certs[i].CheckSignatureFrom(certs[i+1]))
+	}
+	req.Equal(certs[2].RawSubject, certs[2].RawIssuer)
+}
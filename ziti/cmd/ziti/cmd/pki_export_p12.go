@@ -0,0 +1,240 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/certificate"
+	"github.com/openziti/ziti/ziti/pki/pkcs12"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiExportP12Long = templates.LongDesc(`
+Exports a certificate, its private key and the chain of CAs which issued it from the PKI as a password protected
+PKCS #12 (.p12/.pfx) archive, for Java key stores, Windows and other consumers which can't use PEM files.
+
+The archive is encrypted with AES-256 and PBKDF2, as OpenSSL 3 does by default. Java before 8u301, Windows before
+Server 2019 and other older consumers fail to import such archives, often with a misleading error about the password.
+For those, --legacy-ciphers encrypts the archive with PBE-SHA1-3DES and a SHA-1 MAC instead.
+	`)
+
+	pkiExportP12Example = templates.Examples(`
+		# export the client certificate 'client1' issued by the intermediate CA
+		ziti pki export p12 --pki-root ./pki --ca-name intermediate --name client1 --out client1.p12 --password-file ./p12.pass
+
+		# import the archive into a Java key store
+		keytool -importkeystore -srckeystore client1.p12 -srcstoretype pkcs12 -destkeystore client1.jks
+
+		# export for an older Windows or Java consumer
+		ziti pki export p12 --pki-root ./pki --ca-name intermediate --name client1 --out client1.p12 --password-file ./p12.pass --legacy-ciphers
+	`)
+)
+
+// PKIExportP12Options the options for the pki export p12 command
+type PKIExportP12Options struct {
+	PKICreateOptions
+
+	name         string
+	outFile      string
+	friendlyName string
+	noChain      bool
+	p12          pkiP12Flags
+}
+
+// pkiP12Flags are the flags protecting a PKCS #12 archive, shared by the commands which write archives
+type pkiP12Flags struct {
+	prefix        string
+	password      string
+	passwordFile  string
+	legacyCiphers bool
+	iterations    int
+}
+
+// NewCmdPKIExportP12 creates a command object for the "pki export p12" command
+func NewCmdPKIExportP12(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIExportP12Options{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "p12",
+		Short:   "Exports a certificate, its key and CA chain as a PKCS #12 archive",
+		Long:    pkiExportP12Long,
+		Example: pkiExportP12Example,
+		Aliases: []string{"pkcs12", "pfx"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificate")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the certificate (within the CA) to export. Defaults to the CA itself")
+	cmd.Flags().StringVarP(&options.outFile, "out", "o", "", "File to write the PKCS #12 archive to")
+	options.p12.addFlags(cmd, "")
+	cmd.Flags().StringVarP(&options.friendlyName, "friendly-name", "", "", "Friendly name (alias) of the key entry. Defaults to the name of the certificate")
+	cmd.Flags().BoolVar(&options.noChain, "no-chain", false, "Only include the certificate and key, not the CA chain")
+	cmd.Flags().StringVar(&options.Flags.KeyPassword, "key-password", "", "Password of the private key in the PKI, if it's encrypted. Prompted for if needed and not given")
+	cmd.Flags().StringVar(&options.Flags.KeyPasswordFile, "key-password-file", "", "File containing the password of the private key in the PKI")
+	options.addOutputFlags(cmd, "what was exported")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIExportP12Options) Run() error {
+	password, err := o.p12.obtainPassword()
+	if err != nil {
+		return err
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	// the exported key may be a CA's own key, which is protected by the same --key-password
+	o.Flags.CAKeyPassword, o.Flags.CAKeyPasswordFile = o.Flags.KeyPassword, o.Flags.KeyPasswordFile
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	name := o.name
+	if name == "" {
+		name = caname
+	}
+
+	bundle, err := o.Flags.PKI.GetBundle(caname, name)
+	if err != nil {
+		return fmt.Errorf("Cannot locate certificate and key: %v", err)
+	}
+
+	var chain []*x509.Certificate
+	if !o.noChain {
+		if chain, err = store.CAChain(pkiStore, caname); err != nil {
+			return fmt.Errorf("Cannot locate CA chain: %v", err)
+		}
+		// when exporting a CA, the chain starts with the CA itself
+		if len(chain) > 0 && chain[0].Equal(bundle.Cert) {
+			chain = chain[1:]
+		}
+	}
+
+	friendlyName := o.friendlyName
+	if friendlyName == "" {
+		friendlyName = name
+	}
+
+	if err := o.p12.write(o.outFile, bundle, chain, password, friendlyName); err != nil {
+		return err
+	}
+
+	if o.structuredOutput() {
+		return o.writeResult(newExportResult(pkiExportP12, caname, name, o.outFile, append([]*x509.Certificate{bundle.Cert}, chain...)))
+	}
+
+	log.Infof("Exported %v with %v CA certificates to %v\n", name, len(chain), o.outFile)
+
+	return nil
+}
+
+// addFlags adds the flags, with their names prefixed, as commands which also write PEM files need to tell the password
+// of the archive apart from that of the key
+func (f *pkiP12Flags) addFlags(cmd *cobra.Command, prefix string) {
+	f.prefix = prefix
+	cmd.Flags().StringVar(&f.password, prefix+"password", "", "Password protecting the PKCS #12 archive")
+	cmd.Flags().StringVar(&f.passwordFile, prefix+"password-file", "", "File containing the password protecting the PKCS #12 archive")
+	cmd.Flags().BoolVar(&f.legacyCiphers, prefix+"legacy-ciphers", false, "Encrypt the PKCS #12 archive with PBE-SHA1-3DES and a SHA-1 MAC instead of AES-256, for Java before 8u301, Windows before Server 2019 and other older consumers")
+	cmd.Flags().IntVar(&f.iterations, prefix+"iterations", pkcs12.DefaultIterations, "Iteration count of the key derivation protecting the PKCS #12 archive")
+}
+
+// changedFlags returns the names of the flags which were given, so commands where the archive is optional can reject
+// them without it
+func (f *pkiP12Flags) changedFlags(cmd *cobra.Command) []string {
+	var result []string
+	for _, name := range []string{"password", "password-file", "legacy-ciphers", "iterations"} {
+		if cmd.Flags().Changed(f.prefix + name) {
+			result = append(result, "--"+f.prefix+name)
+		}
+	}
+	return result
+}
+
+func (f *pkiP12Flags) obtainPassword() (string, error) {
+	if f.iterations < 1 {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid --%viterations %v, must be at least 1", f.prefix, f.iterations)
+	}
+	if f.password != "" && f.passwordFile != "" {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "only one of --%vpassword and --%vpassword-file may be given", f.prefix, f.prefix)
+	}
+	if f.passwordFile != "" {
+		data, err := ioutil.ReadFile(f.passwordFile)
+		if err != nil {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "failed reading password file %v: %v", f.passwordFile, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if f.password == "" {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "a password is required, use --%vpassword or --%vpassword-file", f.prefix, f.prefix)
+	}
+	return f.password, nil
+}
+
+// write writes the certificate, its key and chain to the file as a PKCS #12 archive
+func (f *pkiP12Flags) write(path string, bundle *certificate.Bundle, chain []*x509.Certificate, password, friendlyName string) error {
+	options := pkcs12.Options{Legacy: f.legacyCiphers, Iterations: f.iterations}
+	data, err := pkcs12.EncodeWithOptions(bundle.Key, bundle.Cert, chain, password, friendlyName, options)
+	if err != nil {
+		return fmt.Errorf("failed encoding PKCS #12 archive: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed writing PKCS #12 archive to %v: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/pki"
+)
+
+var (
+	pkiImportCALong = templates.LongDesc(`
+Imports an externally generated CA, such as one issued by a corporate PKI, into the PKI, so that 'ziti pki create
+server' and 'ziti pki create client' can sign certificates with it.
+
+The certificate must be a CA which is currently valid, and the private key must match it. If the CA isn't
+self-signed, the certificates of the CAs which issued it may be given with --chain. The chain is verified, and stored
+with the CA as <name>.chain.pem.
+	`)
+
+	pkiImportCAExample = templates.Examples(`
+		# import a CA issued by the corporate root
+		ziti pki import ca --pki-root ./pki --ca-name corp-intermediate --cert ca.pem --key ca.key --chain corp-root.pem
+	`)
+)
+
+// PKIImportCAOptions the options for the pki import ca command
+type PKIImportCAOptions struct {
+	PKICreateOptions
+
+	certFile  string
+	keyFile   string
+	chainFile string
+}
+
+// NewCmdPKIImport creates a command object for the "pki import" command
+func NewCmdPKIImport(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIOptions{
+		CommonOptions: CommonOptions{
+			Out: out,
+			Err: errOut,
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Imports externally generated certificates and keys into the PKI",
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.AddCommand(NewCmdPKIImportCA(out, errOut))
+
+	return cmd
+}
+
+// NewCmdPKIImportCA creates a command object for the "pki import ca" command
+func NewCmdPKIImportCA(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIImportCAOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "ca",
+		Short:   "Imports an externally generated CA into the PKI",
+		Long:    pkiImportCALong,
+		Example: pkiImportCAExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name (within PKI_ROOT) to import the CA as. Defaults to the CA's Common Name")
+	cmd.Flags().StringVar(&options.certFile, "cert", "", "PEM file containing the CA's certificate")
+	cmd.Flags().StringVar(&options.keyFile, "key", "", "PEM file containing the CA's private key")
+	cmd.Flags().StringVar(&options.chainFile, "chain", "", "PEM file containing the certificates of the CAs which issued the CA, up to the root")
+	options.addKeyPasswordFlags(cmd)
+	options.addOutputFlags(cmd, "the imported CA, including the paths of its files,")
+	_ = cmd.MarkFlagRequired("cert")
+	_ = cmd.MarkFlagRequired("key")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIImportCAOptions) Run() error {
+	certs, err := certtools.LoadCertFromFile(o.certFile)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unable to load certificate from %v: %v", o.certFile, err)
+	}
+	if len(certs) == 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "no certificate found in %v", o.certFile)
+	}
+	// certificates following the CA's own are taken as its chain
+	cert, chain := certs[0], certs[1:]
+
+	keyPem, err := ioutil.ReadFile(o.keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := certtools.LoadPrivateKey(keyPem)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unable to load private key from %v: %v", o.keyFile, err)
+	}
+
+	if o.chainFile != "" {
+		chainCerts, err := certtools.LoadCertFromFile(o.chainFile)
+		if err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unable to load chain from %v: %v", o.chainFile, err)
+		}
+		chain = append(chain, chainCerts...)
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	name := o.Flags.CAName
+	if name == "" {
+		name = o.ObtainFileName("", cert.Subject.CommonName)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid CA name %q, use --ca-name to choose one", name)
+	}
+
+	if err := o.Flags.PKI.ImportCA(name, cert, key, chain); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, fmt.Errorf("Cannot Import: %v", err))
+	}
+
+	if len(chain) == 0 && cert.CheckSignatureFrom(cert) != nil {
+		o.logWarnf("CA %v isn't self-signed and no chain was given, so it can't be verified up to its root", name)
+	}
+	if o.structuredOutput() {
+		result, err := createdResult(pkiStore, pkiResultTypeOf(cert), name, name)
+		if err != nil {
+			return err
+		}
+		return o.writeResult(result)
+	}
+	log.Infof("Imported CA %v as %v, valid until %v", cert.Subject.CommonName, name, cert.NotAfter.Format("2006-01-02"))
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIImportCA(t *testing.T) {
+	req := require.New(t)
+	externalRoot := t.TempDir()
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", externalRoot, "--ca-file", "corp", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", externalRoot, "--ca-name", "corp", "--intermediate-file", "issuing",
+		"--key-algorithm", "ecdsa")
+
+	externalCert := func(caName, name string) string {
+		return filepath.Join(externalRoot, caName, "certs", name+".cert")
+	}
+	externalKey := func(caName, name string) string {
+		return filepath.Join(externalRoot, caName, "keys", name+".key")
+	}
+
+	run("import", "ca", "--pki-root", root, "--ca-name", "issuing", "--cert", externalCert("issuing", "issuing"),
+		"--key", externalKey("issuing", "issuing"), "--chain", externalCert("corp", "corp"))
+	run("create", "server", "--pki-root", root, "--ca-name", "issuing", "--server-file", "server", "--dns", "localhost",
+		"--key-algorithm", "ecdsa")
+
+	chain, err := certtools.LoadCertFromFile(filepath.Join(root, "issuing", "certs", "issuing.chain.pem"))
+	req.NoError(err)
+	req.Len(chain, 2)
+
+	server, err := certtools.LoadCertFromFile(filepath.Join(root, "issuing", "certs", "server.cert"))
+	req.NoError(err)
+	req.NoError(server[0].CheckSignatureFrom(chain[0]))
+
+	importCA := func(name, certFile, keyFile, chainFile string) error {
+		options := &PKIImportCAOptions{certFile: certFile, keyFile: keyFile, chainFile: chainFile}
+		options.Flags.PKIRoot = root
+		options.Flags.CAName = name
+		return options.Run()
+	}
+
+	// the key must match the certificate
+	req.Error(importCA("mismatched", externalCert("corp", "corp"), externalKey("issuing", "issuing"), ""))
+
+	// the chain must lead to a root
+	req.Error(importCA("unchained", externalCert("issuing", "issuing"), externalKey("issuing", "issuing"),
+		externalCert("issuing", "issuing")))
+
+	// only CAs may be imported
+	run("create", "client", "--pki-root", externalRoot, "--ca-name", "corp", "--client-file", "client")
+	req.Error(importCA("client", externalCert("corp", "client"), externalKey("corp", "client"), ""))
+
+	// names aren't reused
+	req.Error(importCA("issuing", externalCert("issuing", "issuing"), externalKey("issuing", "issuing"), ""))
+}
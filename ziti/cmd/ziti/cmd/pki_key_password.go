@@ -0,0 +1,133 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/spf13/cobra"
+)
+
+// addKeyPasswordFlags adds the flags giving the password of the private key, which is written encrypted as PKCS #8
+func (o *PKICreateOptions) addKeyPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.Flags.KeyPassword, "key-password", "", "Password protecting the private key, which is written encrypted as PKCS #8. Visible in the process list, prefer --key-password-file")
+	cmd.Flags().StringVar(&o.Flags.KeyPasswordFile, "key-password-file", "", "File containing the password protecting the private key")
+	cmd.Flags().BoolVar(&o.Flags.PromptKeyPassword, "prompt-key-password", false, "Prompt for the password protecting the private key")
+}
+
+// addCAKeyPasswordFlags adds the flags giving the password of the signing CA's private key, if it's encrypted
+func (o *PKICreateOptions) addCAKeyPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.Flags.CAKeyPassword, "ca-key-password", "", "Password of the signing CA's private key, if it's encrypted. Prompted for if needed and not given")
+	cmd.Flags().StringVar(&o.Flags.CAKeyPasswordFile, "ca-key-password-file", "", "File containing the password of the signing CA's private key")
+}
+
+// ObtainKeyPasswords sets the password encrypting the private keys written by the PKI, and how the passwords of
+// encrypted keys it reads are found. Keys are decrypted on demand, so passwords are only prompted for when needed
+func (o *PKICreateOptions) ObtainKeyPasswords() error {
+	keyPassword, err := readPasswordFlags("key-password", o.Flags.KeyPassword, o.Flags.KeyPasswordFile)
+	if err != nil {
+		return err
+	}
+	if o.Flags.PromptKeyPassword {
+		if keyPassword != "" {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--prompt-key-password can't be used with --key-password or --key-password-file")
+		}
+		if keyPassword, err = promptNewKeyPassword(); err != nil {
+			return err
+		}
+	}
+
+	caKeyPassword, err := readPasswordFlags("ca-key-password", o.Flags.CAKeyPassword, o.Flags.CAKeyPasswordFile)
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI.KeyPassword = keyPassword
+	prompted := map[string]string{}
+	o.Flags.PKI.Password = func(caName, name string) (string, error) {
+		if name == caName && caKeyPassword != "" {
+			return caKeyPassword, nil
+		}
+		if name != caName && keyPassword != "" {
+			return keyPassword, nil
+		}
+		if password, found := prompted[caName+"/"+name]; found {
+			return password, nil
+		}
+		flag := "--key-password"
+		if name == caName {
+			flag = "--ca-key-password"
+		}
+		if !isInteractive() {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "private key %v within CA %v is encrypted, use %v or %v-file", name, caName, flag, flag)
+		}
+		password, err := util.PickPassword(fmt.Sprintf("Password of private key %v within CA %v:", name, caName))
+		if err != nil {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "private key %v within CA %v is encrypted and the password couldn't be prompted for (%v), use %v or %v-file", name, caName, err, flag, flag)
+		}
+		prompted[caName+"/"+name] = password
+		return password, nil
+	}
+	return nil
+}
+
+// readPasswordFlags returns the password given directly or in a file by the named pair of flags
+func readPasswordFlags(flag, password, passwordFile string) (string, error) {
+	if password != "" && passwordFile != "" {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "only one of --%v and --%v-file may be given", flag, flag)
+	}
+	if passwordFile != "" {
+		data, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed reading password file %v: %v", passwordFile, err)
+		}
+		if password = strings.TrimRight(string(data), "\r\n"); password == "" {
+			return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "password file %v is empty", passwordFile)
+		}
+	}
+	return password, nil
+}
+
+// promptNewKeyPassword prompts for the password of a new private key, twice to catch typos
+func promptNewKeyPassword() (string, error) {
+	if !isInteractive() {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--prompt-key-password requires a terminal, use --key-password-file instead")
+	}
+	password, err := util.PickPassword("Password of the new private key:")
+	if err != nil {
+		return "", err
+	}
+	confirmed, err := util.PickPassword("Confirm the password:")
+	if err != nil {
+		return "", err
+	}
+	if password != confirmed {
+		return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "the passwords don't match")
+	}
+	return password, nil
+}
+
+// isInteractive returns whether stdin may be a terminal which can be prompted, rather than a pipe or file
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
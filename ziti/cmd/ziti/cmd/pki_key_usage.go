@@ -0,0 +1,157 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/pki/pki"
+)
+
+// pkiKeyUsages are the key usages accepted by --key-usage
+var pkiKeyUsages = map[string]x509.KeyUsage{
+	"digital-signature":  x509.KeyUsageDigitalSignature,
+	"content-commitment": x509.KeyUsageContentCommitment,
+	"key-encipherment":   x509.KeyUsageKeyEncipherment,
+	"data-encipherment":  x509.KeyUsageDataEncipherment,
+	"key-agreement":      x509.KeyUsageKeyAgreement,
+	"cert-sign":          x509.KeyUsageCertSign,
+	"crl-sign":           x509.KeyUsageCRLSign,
+	"encipher-only":      x509.KeyUsageEncipherOnly,
+	"decipher-only":      x509.KeyUsageDecipherOnly,
+}
+
+// pkiExtKeyUsages are the extended key usages accepted by --ext-key-usage
+var pkiExtKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":              x509.ExtKeyUsageAny,
+	"server-auth":      x509.ExtKeyUsageServerAuth,
+	"client-auth":      x509.ExtKeyUsageClientAuth,
+	"code-signing":     x509.ExtKeyUsageCodeSigning,
+	"email-protection": x509.ExtKeyUsageEmailProtection,
+	"time-stamping":    x509.ExtKeyUsageTimeStamping,
+	"ocsp-signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// addKeyUsageFlags adds the repeatable --key-usage and --ext-key-usage flags, each of which also takes a comma separated
+// list
+func (o *PKICreateOptions) addKeyUsageFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&o.Flags.KeyUsage, "key-usage", []string{}, "Key usage(s) of the new certificate, replacing the defaults ("+strings.Join(keyUsageFlagValues(), ", ")+")")
+	cmd.Flags().StringSliceVar(&o.Flags.ExtKeyUsage, "ext-key-usage", []string{}, "Extended key usage(s) of the new certificate ("+strings.Join(extKeyUsageFlagValues(), ", ")+")")
+}
+
+// ObtainKeyUsages returns the key usages and extended key usages given with the key usage flags, for a CA certificate
+// if isCA is set. A zero key usage is returned if none were given, leaving the defaults to the PKI
+func (o *PKICreateOptions) ObtainKeyUsages(isCA bool) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var keyUsage x509.KeyUsage
+	for _, val := range o.Flags.KeyUsage {
+		usage, found := pkiKeyUsages[strings.ToLower(strings.TrimSpace(val))]
+		if !found {
+			return 0, nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid key usage %v, must be one of: %v", val, strings.Join(keyUsageFlagValues(), ", "))
+		}
+		keyUsage |= usage
+	}
+
+	var extKeyUsage []x509.ExtKeyUsage
+	seen := map[x509.ExtKeyUsage]bool{}
+	for _, val := range o.Flags.ExtKeyUsage {
+		usage, found := pkiExtKeyUsages[strings.ToLower(strings.TrimSpace(val))]
+		if !found {
+			return 0, nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid extended key usage %v, must be one of: %v", val, strings.Join(extKeyUsageFlagValues(), ", "))
+		}
+		if !seen[usage] {
+			seen[usage] = true
+			extKeyUsage = append(extKeyUsage, usage)
+		}
+	}
+
+	if err := o.validateKeyUsages(isCA, keyUsage, extKeyUsage); err != nil {
+		return 0, nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	return keyUsage, extKeyUsage, nil
+}
+
+// validateKeyUsages rejects combinations of key usages which are invalid per RFC 5280, or which the certificate's key
+// couldn't be used for
+func (o *PKICreateOptions) validateKeyUsages(isCA bool, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) error {
+	if keyUsage&(x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 && keyUsage&x509.KeyUsageKeyAgreement == 0 {
+		return errors.New("encipher-only and decipher-only key usages require the key-agreement key usage")
+	}
+	if keyUsage&x509.KeyUsageEncipherOnly != 0 && keyUsage&x509.KeyUsageDecipherOnly != 0 {
+		return errors.New("encipher-only and decipher-only key usages can't be combined")
+	}
+
+	if keyUsage != 0 {
+		if isCA && keyUsage&x509.KeyUsageCertSign == 0 {
+			return errors.New("CA certificates require the cert-sign key usage")
+		}
+		if !isCA && keyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+			return errors.New("cert-sign and crl-sign key usages are only valid for CA certificates")
+		}
+	}
+
+	for _, usage := range extKeyUsage {
+		if usage == x509.ExtKeyUsageAny && len(extKeyUsage) > 1 {
+			return errors.New("the any extended key usage can't be combined with other extended key usages")
+		}
+		// signing purposes need a key which can sign, the defaults always include digital signature
+		signing := usage == x509.ExtKeyUsageCodeSigning || usage == x509.ExtKeyUsageOCSPSigning || usage == x509.ExtKeyUsageTimeStamping
+		if signing && keyUsage != 0 && keyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment) == 0 {
+			return errors.New("code-signing, ocsp-signing and time-stamping extended key usages require the digital-signature or content-commitment key usage")
+		}
+	}
+
+	// the usages the key can have depend on its type, which is only known when it's generated here
+	if o.Flags.KeyFile == "" {
+		switch o.Flags.KeyAlgorithm {
+		case pki.KeyAlgorithmECDSA, pki.KeyAlgorithmEd25519:
+			if keyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+				return errors.Errorf("key-encipherment and data-encipherment key usages require an rsa key, not %v", o.Flags.KeyAlgorithm)
+			}
+		}
+		if o.Flags.KeyAlgorithm != pki.KeyAlgorithmECDSA && keyUsage&x509.KeyUsageKeyAgreement != 0 {
+			return errors.Errorf("the key-agreement key usage requires an ecdsa key, not %v", o.Flags.KeyAlgorithm)
+		}
+	}
+
+	return nil
+}
+
+// keyUsageFlagValues returns the sorted names of the key usages accepted by --key-usage
+func keyUsageFlagValues() []string {
+	var result []string
+	for name := range pkiKeyUsages {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// extKeyUsageFlagValues returns the sorted names of the extended key usages accepted by --ext-key-usage
+func extKeyUsageFlagValues() []string {
+	var result []string
+	for name := range pkiExtKeyUsages {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
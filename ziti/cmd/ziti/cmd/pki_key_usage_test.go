@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKICreateWithKeyUsages(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-usage", "cert-sign,crl-sign")
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "signer",
+		"--key-usage", "digital-signature", "--ext-key-usage", "code-signing", "--ext-key-usage", "ocsp-signing")
+
+	certs, err := certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "root.cert"))
+	req.NoError(err)
+	req.Equal(x509.KeyUsageCertSign|x509.KeyUsageCRLSign, certs[0].KeyUsage)
+
+	certs, err = certtools.LoadCertFromFile(filepath.Join(root, "root", "certs", "signer.cert"))
+	req.NoError(err)
+	req.Equal(x509.KeyUsageDigitalSignature, certs[0].KeyUsage)
+	req.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageOCSPSigning}, certs[0].ExtKeyUsage)
+}
+
+func TestPKIObtainKeyUsages(t *testing.T) {
+	req := require.New(t)
+
+	obtain := func(isCA bool, keyAlgorithm string, keyUsage []string, extKeyUsage ...string) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+		o := &PKICreateOptions{}
+		o.Flags.KeyAlgorithm = keyAlgorithm
+		o.Flags.KeyUsage = keyUsage
+		o.Flags.ExtKeyUsage = extKeyUsage
+		return o.ObtainKeyUsages(isCA)
+	}
+
+	keyUsage, extKeyUsage, err := obtain(false, "rsa", nil)
+	req.NoError(err)
+	req.Zero(keyUsage)
+	req.Empty(extKeyUsage)
+
+	keyUsage, extKeyUsage, err = obtain(false, "rsa", []string{"Digital-Signature", "key-encipherment"}, "server-auth", "server-auth")
+	req.NoError(err)
+	req.Equal(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, keyUsage)
+	req.Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, extKeyUsage)
+
+	_, _, err = obtain(false, "ecdsa", []string{"key-agreement", "encipher-only"})
+	req.NoError(err)
+
+	for _, invalid := range []struct {
+		isCA         bool
+		keyAlgorithm string
+		keyUsage     []string
+		extKeyUsage  []string
+	}{
+		{keyAlgorithm: "rsa", keyUsage: []string{"signing"}},
+		{keyAlgorithm: "rsa", extKeyUsage: []string{"plugin-signing"}},
+		{keyAlgorithm: "rsa", keyUsage: []string{"cert-sign"}},
+		{isCA: true, keyAlgorithm: "rsa", keyUsage: []string{"crl-sign"}},
+		{keyAlgorithm: "ecdsa", keyUsage: []string{"encipher-only"}},
+		{keyAlgorithm: "ecdsa", keyUsage: []string{"key-agreement", "encipher-only", "decipher-only"}},
+		{keyAlgorithm: "ecdsa", keyUsage: []string{"key-encipherment"}},
+		{keyAlgorithm: "ed25519", keyUsage: []string{"key-agreement"}},
+		{keyAlgorithm: "rsa", keyUsage: []string{"key-encipherment"}, extKeyUsage: []string{"code-signing"}},
+		{keyAlgorithm: "rsa", extKeyUsage: []string{"any", "server-auth"}},
+	} {
+		_, _, err = obtain(invalid.isCA, invalid.keyAlgorithm, invalid.keyUsage, invalid.extKeyUsage...)
+		req.Error(err, "%+v", invalid)
+	}
+}
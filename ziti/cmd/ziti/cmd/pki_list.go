@@ -0,0 +1,239 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pkiListLong = templates.LongDesc(`
+Lists the CAs, certificates, CSRs and keys in a PKI root, along with how many days are left until each certificate
+expires. Pass a category to only list CAs, intermediate CAs, leaf certificates, private keys or CSRs.
+
+The contents of the PKI root are kept in an index.json file in the PKI root, which is updated whenever
+'ziti pki create' adds to it. Use --rebuild to rebuild the index after changing the PKI root by hand.
+	`)
+
+	pkiListExample = templates.Examples(`
+		# list the intermediate CAs and when they expire
+		ziti pki list intermediates --pki-root ./pki
+
+		# list all server certificates issued for a subdomain of example.com
+		ziti pki list --pki-root ./pki --type server --cn '*.example.com'
+
+		# find the certificates with a given SAN
+		ziti pki list --pki-root ./pki --san 10.0.0.5 -j
+	`)
+)
+
+// pkiListCategories maps the categories which may be passed to pki list to the entry types they include. Keys also
+// includes the certificates which have a private key in the PKI root
+var pkiListCategories = map[string][]string{
+	"cas":           {store.EntryTypeCA},
+	"intermediates": {store.EntryTypeIntermediate},
+	"certs":         {store.EntryTypeServer, store.EntryTypeClient},
+	"keys":          {store.EntryTypeKey},
+	"csrs":          {store.EntryTypeCSR},
+}
+
+// pkiListEntry is an index entry as output by pki list
+type pkiListEntry struct {
+	*store.IndexEntry
+	DaysUntilExpiry *int `json:"daysUntilExpiry,omitempty"`
+}
+
+// PKIListOptions the options for the pki list command
+type PKIListOptions struct {
+	PKICreateOptions
+
+	category   string
+	entryType  string
+	commonName string
+	san        string
+	caName     string
+	rebuild    bool
+}
+
+// NewCmdPKIList creates a command object for the "pki list" command
+func NewCmdPKIList(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIListOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:       "list [cas|intermediates|certs|keys|csrs]",
+		Short:     "Lists and searches the contents of a PKI root",
+		Long:      pkiListLong,
+		Example:   pkiListExample,
+		Aliases:   []string{"ls"},
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"cas", "intermediates", "certs", "keys", "csrs"},
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.entryType, "type", "", "", "Only list entries of this type ("+strings.Join(store.EntryTypes, ", ")+")")
+	cmd.Flags().StringVarP(&options.commonName, "cn", "", "", "Only list entries with a common name matching this pattern, e.g. '*.example.com'")
+	cmd.Flags().StringVarP(&options.san, "san", "", "", "Only list entries with a DNS, IP or email SAN matching this pattern")
+	cmd.Flags().StringVarP(&options.caName, "ca-name", "", "", "Only list entries within this CA")
+	cmd.Flags().BoolVar(&options.rebuild, "rebuild", false, "Rebuild the index from the contents of the PKI root before listing")
+	options.addOutputFlags(cmd, "the matching entries")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIListOptions) Run() error {
+	if len(o.Args) > 0 {
+		if _, found := pkiListCategories[o.Args[0]]; !found {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid category %v, must be one of cas, intermediates, certs, keys or csrs", o.Args[0])
+		}
+		o.category = o.Args[0]
+	}
+	if o.entryType != "" && !stringz.Contains(store.EntryTypes, o.entryType) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid type %v, must be one of %v", o.entryType, strings.Join(store.EntryTypes, ", "))
+	}
+	for _, pattern := range []string{o.commonName, o.san} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid pattern %v: %v", pattern, err)
+		}
+	}
+
+	pkiStore, _, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+	local, ok := pkiStore.(*store.Local)
+	if !ok {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "listing is only supported for the %v PKI backend", PKIBackendLocal)
+	}
+
+	var index *store.Index
+	if o.rebuild {
+		index, err = local.WriteIndex()
+	} else {
+		index, err = local.ReadIndex()
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := []*pkiListEntry{}
+	now := time.Now()
+	for _, entry := range index.Entries {
+		if o.matches(entry) {
+			listEntry := &pkiListEntry{IndexEntry: entry}
+			if entry.NotAfter != nil {
+				days := int(entry.NotAfter.Sub(now).Hours() / 24)
+				listEntry.DaysUntilExpiry = &days
+			}
+			entries = append(entries, listEntry)
+		}
+	}
+
+	if o.structuredOutput() {
+		return o.writeResult(entries)
+	}
+
+	if len(entries) == 0 {
+		_, err = fmt.Fprintln(o.Out, "no matching entries found")
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Type", "CA", "Name", "Common Name", "SANs", "Key Algorithm", "Not After", "Days Left", "Status"})
+	for _, entry := range entries {
+		notAfter, daysLeft := "", ""
+		if entry.NotAfter != nil {
+			notAfter = entry.NotAfter.Format("2006-01-02 15:04:05")
+			daysLeft = fmt.Sprintf("%d", *entry.DaysUntilExpiry)
+		}
+		t.AppendRow(table.Row{entry.Type, entry.CA, entry.Name, entry.CommonName, strings.Join(entry.SANs(), "\n"),
+			entry.KeyAlgorithm, notAfter, daysLeft, pkiEntryStatus(entry.IndexEntry)})
+	}
+	t.SetOutputMirror(o.Out)
+	t.Render()
+	return nil
+}
+
+func (o *PKIListOptions) matches(entry *store.IndexEntry) bool {
+	if o.entryType != "" && entry.Type != o.entryType {
+		return false
+	}
+	if o.category != "" && !stringz.Contains(pkiListCategories[o.category], entry.Type) &&
+		!(o.category == "keys" && entry.KeyPath != "") {
+		return false
+	}
+	if o.caName != "" && entry.CA != o.caName {
+		return false
+	}
+	if o.commonName != "" && !pkiGlobMatch(o.commonName, entry.CommonName) {
+		return false
+	}
+	if o.san != "" {
+		for _, san := range entry.SANs() {
+			if pkiGlobMatch(o.san, san) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// pkiGlobMatch matches names case-insensitively, as DNS names are case-insensitive
+func pkiGlobMatch(pattern, name string) bool {
+	matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return matched
+}
+
+func pkiEntryStatus(entry *store.IndexEntry) string {
+	switch {
+	case entry.Revoked:
+		return "revoked"
+	case entry.NotAfter != nil && entry.NotAfter.Before(time.Now()):
+		return "expired"
+	case entry.NotAfter != nil:
+		return "valid"
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIListSearchesIndex(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) []*store.IndexEntry {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		if args[0] != "list" {
+			return nil
+		}
+		var result []*store.IndexEntry
+		req.NoError(json.Unmarshal(out.Bytes(), &result))
+		return result
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "inter", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "web", "--server-name", "web.example.com", "--dns", "web.example.com", "--key-algorithm", "ecdsa")
+	run("create", "server", "--pki-root", root, "--ca-name", "inter", "--server-file", "other", "--server-name", "other.example.org", "--dns", "other.example.org", "--key-algorithm", "ecdsa")
+	run("create", "client", "--pki-root", root, "--ca-name", "inter", "--client-file", "user", "--key-algorithm", "ecdsa")
+
+	entries := run("list", "--pki-root", root, "-j")
+	var types []string
+	for _, entry := range entries {
+		types = append(types, entry.Type+":"+entry.CA+"/"+entry.Name)
+	}
+	req.ElementsMatch([]string{"ca:root/root", "intermediate:root/inter", "server:inter/web", "server:inter/other", "client:inter/user"}, types)
+
+	entries = run("list", "--pki-root", root, "--type", "server", "--cn", "*.EXAMPLE.com", "-j")
+	req.Len(entries, 1)
+	req.Equal("web", entries[0].Name)
+	req.Equal([]string{"web.example.com"}, entries[0].DNSNames)
+
+	entries = run("list", "--pki-root", root, "--type", "client", "--rebuild", "-j")
+	req.Len(entries, 1)
+	req.Equal("inter/keys/user.key", entries[0].KeyPath)
+
+	entries = run("list", "intermediates", "--pki-root", root, "-j")
+	req.Len(entries, 1)
+	req.Equal("inter", entries[0].Name)
+
+	entries = run("list", "certs", "--pki-root", root, "-j")
+	req.Len(entries, 3)
+
+	out := &bytes.Buffer{}
+	cmd := NewCmdPKI(out, ioutil.Discard)
+	cmd.SetArgs([]string{"list", "cas", "--pki-root", root, "-j"})
+	req.NoError(cmd.Execute())
+	var cas []struct {
+		Name            string `json:"name"`
+		DaysUntilExpiry *int   `json:"daysUntilExpiry"`
+	}
+	req.NoError(json.Unmarshal(out.Bytes(), &cas))
+	req.Len(cas, 1)
+	req.NotNil(cas[0].DaysUntilExpiry)
+	req.Greater(*cas[0].DaysUntilExpiry, 0)
+}
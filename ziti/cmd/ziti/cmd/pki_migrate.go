@@ -0,0 +1,420 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiMigrateLong = templates.LongDesc(`
+Re-roots an existing PKI onto a new root CA, to rotate the root of a long-lived network without re-issuing the
+certificates of its controllers, routers and identities.
+
+The new root CA is created, unless it already exists, and each intermediate CA issued by the current root is
+cross-signed by it. Certificates issued by the intermediates then chain to either root. A rotation plan is output,
+listing which trust bundles to update where and in which order, along with any certificates issued directly by the
+current root, which can't be cross-signed and must be re-issued.
+
+Migrating again with the same new root only cross-signs intermediates which haven't been yet, so intermediates created
+after a migration may be added to it. Use --dry-run to only output the plan.
+	`)
+
+	pkiMigrateExample = templates.Examples(`
+		# show what re-rooting the PKI onto a new root would involve
+		ziti pki migrate --pki-root ./pki --ca-name root --new-ca-file root2 --dry-run
+
+		# re-root the PKI, saving the rotation plan
+		ziti pki migrate --pki-root ./pki --ca-name root --new-ca-file root2 --new-ca-name "Example Root CA 2" --output yaml > rotation.yml
+	`)
+)
+
+const (
+	pkiMigrateCrossSigned        = "cross-signed"
+	pkiMigrateAlreadyCrossSigned = "already cross-signed"
+	pkiMigratePlanned            = "planned"
+)
+
+// pkiMigrateResult describes a migration onto a new root and the plan for rotating the trust bundles of the network
+type pkiMigrateResult struct {
+	CA            string                    `json:"ca"`
+	NewCA         string                    `json:"newCa"`
+	NewCACreated  bool                      `json:"newCaCreated"`
+	NewCACertPath string                    `json:"newCaCertPath"`
+	DryRun        bool                      `json:"dryRun,omitempty"`
+	Intermediates []*pkiMigrateIntermediate `json:"intermediates"`
+	Reissue       []*pkiMigrateReissue      `json:"reissue"`
+	Plan          []*pkiMigrateStep         `json:"plan"`
+}
+
+// pkiMigrateIntermediate is an intermediate CA of the current root, and its cross-signed certificate
+type pkiMigrateIntermediate struct {
+	Name               string     `json:"name"`
+	Subject            string     `json:"subject"`
+	Status             string     `json:"status"`
+	IssuedCertificates int        `json:"issuedCertificates"`
+	NotAfter           *time.Time `json:"notAfter,omitempty"`
+	CertPath           string     `json:"certPath"`
+	ChainPath          string     `json:"chainPath"`
+}
+
+// pkiMigrateReissue is a certificate issued directly by the current root, which must be re-issued by the new root
+type pkiMigrateReissue struct {
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	CommonName string     `json:"commonName,omitempty"`
+	NotAfter   *time.Time `json:"notAfter,omitempty"`
+}
+
+// pkiMigrateStep is a step of the rotation plan
+type pkiMigrateStep struct {
+	Step        int      `json:"step"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Files       []string `json:"files,omitempty"`
+}
+
+// PKIMigrateOptions the options for the pki migrate command
+type PKIMigrateOptions struct {
+	PKICreateOptions
+
+	newCAFile     string
+	newCAName     string
+	intermediates []string
+	dryRun        bool
+}
+
+// NewCmdPKIMigrate creates a command object for the "pki migrate" command
+func NewCmdPKIMigrate(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIMigrateOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Short:   "Re-roots a PKI onto a new root CA and outputs a rotation plan",
+		Long:    pkiMigrateLong,
+		Example: pkiMigrateExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of the current root CA (within PKI_ROOT)")
+	cmd.Flags().StringVar(&options.newCAFile, "new-ca-file", "", "Dir/File name (within PKI_ROOT) of the new root CA, which is created if it doesn't exist")
+	cmd.Flags().StringVar(&options.newCAName, "new-ca-name", "", "Common Name (CN) of the new root CA. Defaults to --new-ca-file")
+	cmd.Flags().StringSliceVar(&options.intermediates, "intermediate", nil, "Only cross-sign these intermediate CAs of the current root. Defaults to all of them")
+	cmd.Flags().BoolVar(&options.dryRun, "dry-run", false, "Only output the rotation plan, without changing the PKI")
+	cmd.Flags().IntVarP(&options.Flags.CAExpire, "expire-limit", "", 3650, "Expiration limit of the new root CA in days")
+	cmd.Flags().IntVarP(&options.Flags.CAMaxpath, "max-path-len", "", -1, "Maximum path length of the new root CA")
+	cmd.Flags().IntVarP(&options.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the private key of the new root CA")
+	options.addKeyAlgorithmFlags(cmd)
+	options.addSignatureAlgorithmFlag(cmd)
+	options.addKeyPasswordFlags(cmd)
+	options.addSubjectFlags(cmd, "new root CA")
+	options.addSerialStrategyFlag(cmd)
+	options.addOutputFlags(cmd, "the migration and rotation plan")
+	_ = cmd.MarkFlagRequired("new-ca-file")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIMigrateOptions) Run() error {
+	if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+	local, ok := pkiStore.(*store.Local)
+	if !ok {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "migrating is only supported for the %v PKI backend", PKIBackendLocal)
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore}
+	if err := o.ApplySerialStrategy(); err != nil {
+		return err
+	}
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+	// the private key of the new root is encrypted with --key-password, rather than --ca-key-password
+	password := o.Flags.PKI.Password
+	o.Flags.PKI.Password = func(caName, name string) (string, error) {
+		if caName == o.newCAFile && name == o.newCAFile && o.Flags.PKI.KeyPassword != "" {
+			return o.Flags.PKI.KeyPassword, nil
+		}
+		return password(caName, name)
+	}
+
+	caName, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return err
+	}
+	if caName == o.newCAFile {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--new-ca-file must be a different CA than --ca-name")
+	}
+
+	rawCert, err := pkiStore.FetchCert(caName, caName)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "CA %v not found: %v", caName, err)
+	}
+	caCert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		return fmt.Errorf("failed parsing certificate of CA %v: %v", caName, err)
+	}
+	if !bytes.Equal(caCert.RawIssuer, caCert.RawSubject) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "CA %v isn't a root CA, only the PKI of a root CA may be migrated", caName)
+	}
+
+	index, err := local.WriteIndex()
+	if err != nil {
+		return err
+	}
+
+	result := &pkiMigrateResult{
+		CA:            caName,
+		NewCA:         o.newCAFile,
+		DryRun:        o.dryRun,
+		Intermediates: []*pkiMigrateIntermediate{},
+		Reissue:       []*pkiMigrateReissue{},
+	}
+	_, result.NewCACertPath = local.BundlePaths(o.newCAFile, o.newCAFile)
+
+	issued := map[string]int{}
+	for _, entry := range index.Entries {
+		if entry.Type != store.EntryTypeKey && entry.Type != store.EntryTypeCSR {
+			issued[entry.CA]++
+		}
+	}
+
+	for _, entry := range index.Entries {
+		if entry.CA != caName || entry.Name == caName {
+			continue
+		}
+		switch entry.Type {
+		case store.EntryTypeIntermediate:
+			if len(o.intermediates) > 0 && !stringz.Contains(o.intermediates, entry.Name) {
+				continue
+			}
+			_, certPath := local.BundlePaths(o.newCAFile, entry.Name)
+			status := pkiMigratePlanned
+			if local.Exists(o.newCAFile, entry.Name) {
+				status = pkiMigrateAlreadyCrossSigned
+			}
+			result.Intermediates = append(result.Intermediates, &pkiMigrateIntermediate{
+				Name:               entry.Name,
+				Subject:            entry.CommonName,
+				Status:             status,
+				IssuedCertificates: issued[entry.Name],
+				NotAfter:           entry.NotAfter,
+				CertPath:           certPath,
+				ChainPath:          local.ChainPath(o.newCAFile, entry.Name),
+			})
+		case store.EntryTypeServer, store.EntryTypeClient:
+			if !entry.Revoked {
+				result.Reissue = append(result.Reissue, &pkiMigrateReissue{
+					Type:       entry.Type,
+					Name:       entry.Name,
+					CommonName: entry.CommonName,
+					NotAfter:   entry.NotAfter,
+				})
+			}
+		}
+	}
+
+	for _, name := range o.intermediates {
+		found := false
+		for _, intermediate := range result.Intermediates {
+			found = found || intermediate.Name == name
+		}
+		if !found {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "intermediate CA %v wasn't issued by CA %v", name, caName)
+		}
+	}
+
+	if !o.dryRun {
+		if err := o.migrate(local, result); err != nil {
+			return err
+		}
+	}
+
+	result.Plan = pkiMigratePlan(local, caCert, result)
+
+	if o.structuredOutput() {
+		return o.writeResult(result)
+	}
+	return o.outputMigration(result)
+}
+
+// migrate creates the new root, unless it exists, and cross-signs the intermediates with it
+func (o *PKIMigrateOptions) migrate(local *store.Local, result *pkiMigrateResult) error {
+	if !local.Exists(o.newCAFile, o.newCAFile) {
+		commonName := o.newCAName
+		if commonName == "" {
+			commonName = o.newCAFile
+		}
+		template, err := o.ObtainPKIRequestTemplate(commonName, true)
+		if err != nil {
+			return err
+		}
+		req := &pki.Request{
+			Name:               o.newCAFile,
+			Template:           template,
+			PrivateKeySize:     o.Flags.CAPrivateKeySize,
+			KeyAlgorithm:       o.Flags.KeyAlgorithm,
+			Curve:              o.Flags.Curve,
+			SignatureAlgorithm: o.Flags.SignatureAlgorithm,
+		}
+		if err := o.Flags.PKI.Sign(nil, req); err != nil {
+			return fmt.Errorf("Cannot create new root CA: %v", err)
+		}
+		result.NewCACreated = true
+		o.logInfof("Created new root CA %v\n", o.newCAFile)
+	} else if o.newCAName != "" {
+		o.logWarnf("New root CA %v already exists, --new-ca-name is ignored\n", o.newCAFile)
+	}
+
+	newCA, err := o.Flags.PKI.GetCA(o.newCAFile)
+	if err != nil {
+		return fmt.Errorf("Cannot locate new root CA: %v", err)
+	}
+	if !newCA.Cert.IsCA || !bytes.Equal(newCA.Cert.RawIssuer, newCA.Cert.RawSubject) {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v isn't a root CA", o.newCAFile)
+	}
+
+	for _, intermediate := range result.Intermediates {
+		if intermediate.Status == pkiMigratePlanned {
+			if _, err := o.Flags.PKI.CrossSign(newCA, intermediate.Name); err != nil {
+				return fmt.Errorf("Cannot cross-sign intermediate %v: %v", intermediate.Name, err)
+			}
+			intermediate.Status = pkiMigrateCrossSigned
+			o.logInfof("Cross-signed intermediate %v with CA %v\n", intermediate.Name, o.newCAFile)
+		}
+		if _, err := os.Stat(intermediate.ChainPath); os.IsNotExist(err) {
+			if err := o.Flags.PKI.Chain(newCA, &pki.Request{Name: intermediate.Name}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pkiMigratePlan returns the steps for rotating the trust bundles of the network onto the new root. The new root is
+// trusted everywhere before anything presents a chain to it, and the current root is only retired once nothing
+// depends on it anymore
+func pkiMigratePlan(local *store.Local, caCert *x509.Certificate, result *pkiMigrateResult) []*pkiMigrateStep {
+	_, caCertPath := local.BundlePaths(result.CA, result.CA)
+
+	var plan []*pkiMigrateStep
+	add := func(title, description string, files ...string) {
+		plan = append(plan, &pkiMigrateStep{Step: len(plan) + 1, Title: title, Description: description, Files: files})
+	}
+
+	add("Trust the new root",
+		"Add the new root CA certificate, alongside the current root, to the CA bundle (identity.ca) of every "+
+			"controller and router, then restart them. Identities are given the controller's CA bundle when they "+
+			"enroll, so add it to the CA bundle of the identities enrolled before the controller's was updated as well.",
+		result.NewCACertPath)
+
+	if len(result.Intermediates) > 0 {
+		var chains []string
+		for _, intermediate := range result.Intermediates {
+			chains = append(chains, intermediate.ChainPath)
+		}
+		add("Present chains to the new root",
+			"Once everything trusts the new root, replace the intermediate CA certificates presented by the controllers "+
+				"and routers, and given to third parties, with the cross-signed chains to the new root. Certificates "+
+				"issued by the intermediates don't need to be re-issued.",
+			chains...)
+	}
+
+	if len(result.Reissue) > 0 {
+		var names []string
+		for _, reissue := range result.Reissue {
+			names = append(names, reissue.Name)
+		}
+		add("Re-issue certificates of the current root",
+			"Re-issue the certificates issued directly by the current root with the new root, or with one of its "+
+				"intermediates, as they can't be cross-signed.",
+			names...)
+	}
+
+	add("Retire the current root",
+		fmt.Sprintf("Once nothing presents a chain to the current root anymore, remove it from every CA bundle. It "+
+			"expires on %v, by when this must be done.", caCert.NotAfter.UTC().Format("2006-01-02")),
+		caCertPath)
+
+	return plan
+}
+
+func (o *PKIMigrateOptions) outputMigration(result *pkiMigrateResult) error {
+	var b strings.Builder
+	if result.DryRun {
+		fmt.Fprintf(&b, "Dry run, the PKI wasn't changed\n\n")
+	}
+	fmt.Fprintf(&b, "Migrating CA %v to new root CA %v\n", result.CA, result.NewCA)
+	for _, intermediate := range result.Intermediates {
+		fmt.Fprintf(&b, "  intermediate %v: %v (%v issued certificates)\n", intermediate.Name, intermediate.Status, intermediate.IssuedCertificates)
+	}
+	for _, reissue := range result.Reissue {
+		fmt.Fprintf(&b, "  %v certificate %v: must be re-issued\n", reissue.Type, reissue.Name)
+	}
+
+	fmt.Fprintf(&b, "\nRotation plan:\n")
+	for _, step := range result.Plan {
+		fmt.Fprintf(&b, "\n%v. %v\n   %v\n", step.Step, step.Title, step.Description)
+		for _, file := range step.Files {
+			fmt.Fprintf(&b, "     - %v\n", file)
+		}
+	}
+
+	_, err := fmt.Fprint(o.Out, b.String())
+	return err
+}
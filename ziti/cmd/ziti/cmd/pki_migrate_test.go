@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIMigrate(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) *bytes.Buffer {
+		out := &bytes.Buffer{}
+		cmd := NewCmdPKI(out, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+		return out
+	}
+	migrate := func(args ...string) *pkiMigrateResult {
+		args = append([]string{"migrate", "--pki-root", root, "--ca-name", "root", "--new-ca-file", "root2",
+			"--private-key-size", "2048", "--output", "json"}, args...)
+		result := &pkiMigrateResult{}
+		req.NoError(json.Unmarshal(run(args...).Bytes(), result))
+		return result
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--private-key-size", "2048")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "int",
+		"--private-key-size", "2048")
+	run("create", "server", "--pki-root", root, "--ca-name", "int", "--server-file", "server", "--dns", "localhost",
+		"--private-key-size", "2048")
+	run("create", "client", "--pki-root", root, "--ca-name", "root", "--client-file", "legacy",
+		"--private-key-size", "2048")
+
+	result := migrate("--dry-run")
+	req.True(result.DryRun)
+	req.False(result.NewCACreated)
+	req.Len(result.Intermediates, 1)
+	req.Equal(pkiMigratePlanned, result.Intermediates[0].Status)
+	req.Equal(1, result.Intermediates[0].IssuedCertificates)
+	req.Len(result.Reissue, 1)
+	req.Equal("legacy", result.Reissue[0].Name)
+	req.Len(result.Plan, 4)
+	req.NoFileExists(result.NewCACertPath)
+
+	result = migrate()
+	req.True(result.NewCACreated)
+	req.Equal(pkiMigrateCrossSigned, result.Intermediates[0].Status)
+	req.FileExists(result.NewCACertPath)
+
+	// the server certificate now chains to the new root through the cross-signed intermediate
+	newRoot := readPKICerts(t, result.NewCACertPath)
+	chain := readPKICerts(t, result.Intermediates[0].ChainPath)
+	server := readPKICerts(t, filepath.Join(root, "int", "certs", "server.cert"))
+	roots := x509.NewCertPool()
+	roots.AddCert(newRoot[0])
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(chain[0])
+	_, err := server[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	req.NoError(err)
+
+	// migrating again only cross-signs new intermediates
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "int2",
+		"--private-key-size", "2048")
+	result = migrate()
+	req.False(result.NewCACreated)
+	req.Len(result.Intermediates, 2)
+	req.Equal(pkiMigrateAlreadyCrossSigned, result.Intermediates[0].Status)
+	req.Equal(pkiMigrateCrossSigned, result.Intermediates[1].Status)
+}
+
+func readPKICerts(t *testing.T, path string) []*x509.Certificate {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	certs, err := certtools.LoadCert(data)
+	require.NoError(t, err)
+	return certs
+}
@@ -0,0 +1,97 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+// addNameConstraintFlags adds the repeatable flags scoping the names a new CA may issue certificates for, each of which
+// also takes a comma separated list
+func (o *PKICreateOptions) addNameConstraintFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&o.Flags.PermittedDNS, "permitted-dns", []string{}, "DNS domain(s) the new CA may issue certificates for. 'example.com' permits the domain and its subdomains, '.example.com' only its subdomains")
+	cmd.Flags().StringSliceVar(&o.Flags.ExcludedDNS, "excluded-dns", []string{}, "DNS domain(s) the new CA may not issue certificates for, even when permitted")
+	cmd.Flags().StringSliceVar(&o.Flags.PermittedIP, "permitted-ip", []string{}, "IP range(s) in CIDR notation, or single IPs, the new CA may issue certificates for")
+}
+
+// ApplyNameConstraints adds the name constraints given with the name constraint flags to a CA template. The constraints
+// are marked critical, as RFC 5280 requires
+func (o *PKICreateOptions) ApplyNameConstraints(template *x509.Certificate) error {
+	permittedDNS, err := nameConstraintDomains("--permitted-dns", o.Flags.PermittedDNS)
+	if err != nil {
+		return err
+	}
+	excludedDNS, err := nameConstraintDomains("--excluded-dns", o.Flags.ExcludedDNS)
+	if err != nil {
+		return err
+	}
+
+	var permittedIPs []*net.IPNet
+	for _, val := range o.Flags.PermittedIP {
+		ipNet, err := parseIPRange(val)
+		if err != nil {
+			return err
+		}
+		permittedIPs = append(permittedIPs, ipNet)
+	}
+
+	template.PermittedDNSDomains = permittedDNS
+	template.ExcludedDNSDomains = excludedDNS
+	template.PermittedIPRanges = permittedIPs
+	template.PermittedDNSDomainsCritical = len(permittedDNS) > 0 || len(excludedDNS) > 0 || len(permittedIPs) > 0
+
+	return nil
+}
+
+func nameConstraintDomains(flag string, values []string) ([]string, error) {
+	var result []string
+	for _, val := range values {
+		domain := strings.ToLower(strings.TrimSpace(val))
+		if strings.Trim(domain, ".") == "" || strings.ContainsAny(domain, " */:") || strings.Contains(domain, "..") {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid DNS domain '%v' for %v", val, flag)
+		}
+		result = append(result, domain)
+	}
+	return result, nil
+}
+
+// parseIPRange parses a CIDR range, treating a single IP as a range containing only that IP
+func parseIPRange(val string) (*net.IPNet, error) {
+	val = strings.TrimSpace(val)
+	if !strings.Contains(val, "/") {
+		ip := net.ParseIP(val)
+		if ip == nil {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid IP '%v' for --permitted-ip", val)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(val)
+	if err != nil {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid IP range '%v' for --permitted-ip: %v", val, err)
+	}
+	return ipNet, nil
+}
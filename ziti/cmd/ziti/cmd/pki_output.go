@@ -0,0 +1,142 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	pkiOutputJSON = "json"
+	pkiOutputYAML = "yaml"
+)
+
+// pkiOutputFormats are the structured formats pki commands can output their results in
+var pkiOutputFormats = []string{pkiOutputJSON, pkiOutputYAML}
+
+// pkiOutputFormat is the value of the --output flag. It's checked when the flag is parsed, so that nothing is created
+// before an unsupported format is noticed
+type pkiOutputFormat string
+
+func (f *pkiOutputFormat) String() string {
+	return string(*f)
+}
+
+func (f *pkiOutputFormat) Set(value string) error {
+	value = strings.ToLower(value)
+	for _, format := range pkiOutputFormats {
+		if value == format {
+			*f = pkiOutputFormat(value)
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %v, must be one of %v", value, strings.Join(pkiOutputFormats, ", "))
+}
+
+func (f *pkiOutputFormat) Type() string {
+	return "format"
+}
+
+// addOutputFlags adds the --output flag, outputting the result of the command as JSON or YAML instead of text, and
+// --json as a shorthand for --output json
+func (o *PKIOptions) addOutputFlags(cmd *cobra.Command, result string) {
+	cmd.Flags().VarP(&o.Flags.Output, "output", "", "Output "+result+" in the given format ("+strings.Join(pkiOutputFormats, ", ")+") instead of text")
+	cmd.Flags().BoolVarP(&o.Flags.JSON, "json", "j", false, "Output "+result+" as JSON. Same as --output json")
+}
+
+// structuredOutput returns true if the result is output as JSON or YAML, in which case nothing else may be written
+// to stdout
+func (o *PKIOptions) structuredOutput() bool {
+	return o.Flags.JSON || o.Flags.Output != ""
+}
+
+// writeResult writes the result of the command in the selected output format. YAML is converted from the JSON, so
+// that the fields are named and ordered the same in both
+func (o *PKIOptions) writeResult(result interface{}) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if o.Flags.JSON || o.Flags.Output != pkiOutputYAML {
+		_, err = fmt.Fprintf(o.Out, "%s\n", data)
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := jsonToYAMLValue(dec)
+	if err != nil {
+		return err
+	}
+	data, err = yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(data)
+	return err
+}
+
+// jsonToYAMLValue reads the next JSON value from the decoder, keeping the order of object fields
+func jsonToYAMLValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			fields := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := jsonToYAMLValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err = dec.Token()
+			return fields, err
+		}
+		values := []interface{}{}
+		for dec.More() {
+			value, err := jsonToYAMLValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = dec.Token()
+		return values, err
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	default:
+		return t, nil
+	}
+}
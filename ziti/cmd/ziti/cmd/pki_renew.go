@@ -0,0 +1,190 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/pki"
+)
+
+var (
+	pkiRenewLong = templates.LongDesc(`
+Renews a server or client certificate in the PKI, re-issuing it with the same subject, SANs and key usages, signed by
+the CA which issued it. The existing private key is kept, unless --new-key is given.
+
+The renewed certificate replaces the existing one in the PKI root. The existing certificate isn't revoked, so stays
+valid until it expires. Use 'ziti pki revoke' to revoke it.
+	`)
+
+	pkiRenewExample = templates.Examples(`
+		# renew the server certificate of router1 for another year
+		ziti pki renew --pki-root ./pki --ca-name intermediate --name router1-server
+
+		# renew it for 90 days with a new ecdsa key
+		ziti pki renew --pki-root ./pki --ca-name intermediate --name router1-server --duration 90d --new-key --key-algorithm ecdsa
+	`)
+)
+
+// PKIRenewOptions the options for the pki renew command
+type PKIRenewOptions struct {
+	PKICreateOptions
+
+	name     string
+	duration string
+	newKey   bool
+}
+
+// NewCmdPKIRenew creates a command object for the "pki renew" command
+func NewCmdPKIRenew(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIRenewOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "renew",
+		Short:   "Renews a server or client certificate in the PKI",
+		Long:    pkiRenewLong,
+		Example: pkiRenewExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificate")
+	options.addCAKeyFlags(cmd)
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the certificate (within the CA) to renew")
+	cmd.Flags().StringVarP(&options.duration, "duration", "", "365d", "How long the renewed certificate is valid for, in days, e.g. 365d, or as a duration, e.g. 720h")
+	cmd.Flags().BoolVar(&options.newKey, "new-key", false, "Generate a new private key for the renewed certificate instead of keeping the existing one")
+	cmd.Flags().IntVarP(&options.Flags.CAPrivateKeySize, "private-key-size", "", 4096, "Size of the new private key")
+	options.addKeyAlgorithmFlags(cmd)
+	options.addKeyPasswordFlags(cmd)
+	options.addSerialFlags(cmd)
+	options.addOutputFlags(cmd, "the renewed certificate, including the paths of its files,")
+	_ = cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIRenewOptions) Run() error {
+	duration, err := parsePKIDuration(o.duration)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	if o.newKey {
+		if err := pki.ValidateKeyAlgorithm(o.Flags.KeyAlgorithm, o.Flags.Curve); err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	signer, err := o.Flags.PKI.GetCA(caname)
+	if err != nil {
+		return fmt.Errorf("Cannot locate signer: %v", err)
+	}
+
+	serial, err := o.ObtainSerial(pkiStore, caname)
+	if err != nil {
+		return err
+	}
+
+	cert, err := o.Flags.PKI.Renew(signer, &pki.RenewRequest{
+		Name:           o.name,
+		NotAfter:       time.Now().Add(duration),
+		NewKey:         o.newKey,
+		PrivateKeySize: o.Flags.CAPrivateKeySize,
+		KeyAlgorithm:   o.Flags.KeyAlgorithm,
+		Curve:          o.Flags.Curve,
+		Serial:         serial,
+	})
+	if err != nil {
+		return fmt.Errorf("Cannot Renew: %v", err)
+	}
+
+	if o.structuredOutput() {
+		result, err := createdResult(pkiStore, pkiResultTypeOf(cert), caname, o.name)
+		if err != nil {
+			return err
+		}
+		return o.writeResult(result)
+	}
+
+	log.Infof("Renewed certificate %v for %v, serial %X, valid until %v\n", o.name, cert.Subject.CommonName, cert.SerialNumber, cert.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// parsePKIDuration parses a number of days, with or without a d suffix, or a duration such as 720h
+func parsePKIDuration(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	if days, err := strconv.Atoi(strings.TrimSuffix(val, "d")); err == nil {
+		if days <= 0 {
+			return 0, fmt.Errorf("invalid duration %v, must be positive", val)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %v, expected days, e.g. 365d, or a duration, e.g. 720h", val)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %v, must be positive", val)
+	}
+	return duration, nil
+}
@@ -0,0 +1,182 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiRevokeLong = templates.LongDesc(`
+Revokes a certificate issued by a CA in the PKI, marking it as revoked in the CA's index.
+
+The certificate is given by its name within the CA or by its serial number, in hex. Revoked certificates are listed
+in the CA's next CRL, created with 'ziti pki create crl'.
+	`)
+
+	pkiRevokeExample = templates.Examples(`
+		# revoke the client certificate 'client1' issued by the intermediate CA
+		ziti pki revoke --pki-root ./pki --ca-name intermediate --cert client1
+
+		# revoke a certificate by serial number and publish a new CRL
+		ziti pki revoke --pki-root ./pki --ca-name intermediate --cert 0A:1F:33 --crl
+	`)
+)
+
+// PKIRevokeOptions the options for the pki revoke command
+type PKIRevokeOptions struct {
+	PKICreateOptions
+
+	cert      string
+	createCRL bool
+}
+
+// NewCmdPKIRevoke creates a command object for the "pki revoke" command
+func NewCmdPKIRevoke(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIRevokeOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "revoke",
+		Short:   "Revokes a certificate issued by a CA in the PKI",
+		Long:    pkiRevokeLong,
+		Example: pkiRevokeExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificate")
+	cmd.Flags().StringVarP(&options.cert, "cert", "", "", "Name (within the CA) or serial number of the certificate to revoke")
+	options.addCAKeyFlags(cmd)
+	cmd.Flags().BoolVar(&options.createCRL, "crl", false, "Create a new CRL for the CA after revoking the certificate")
+	cmd.Flags().IntVarP(&options.Flags.CAExpire, "crl-expire-limit", "", defaultCRLExpireDays, "With --crl, days until the next CRL update is due")
+	options.addOutputFlags(cmd, "the revoked certificate")
+	_ = cmd.MarkFlagRequired("cert")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIRevokeOptions) Run() error {
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	cert, err := o.resolveCert(caname)
+	if err != nil {
+		return err
+	}
+
+	if err := o.Flags.PKI.Revoke(caname, cert); err != nil {
+		return fmt.Errorf("Cannot revoke %v: %v", o.cert, err)
+	}
+
+	o.logInfof("Revoked certificate %v issued by %v, serial %X\n", o.cert, caname, cert.SerialNumber)
+
+	if o.createCRL {
+		if err := o.writeCRL(caname, o.Flags.CAExpire, ""); err != nil {
+			return err
+		}
+	}
+
+	if o.structuredOutput() {
+		result := &pkiRevokeResult{
+			CA:     caname,
+			Serial: fmt.Sprintf("%X", cert.SerialNumber),
+		}
+		if cert.Raw != nil {
+			result.Name = o.cert
+			result.Subject = cert.Subject.String()
+		}
+		if local, ok := pkiStore.(*store.Local); ok && o.createCRL {
+			result.CRLPath = local.CRLPath(caname)
+		}
+		return o.writeResult(result)
+	}
+	return nil
+}
+
+// pkiRevokeResult describes a revoked certificate. The name and subject are only known if the certificate was
+// revoked by name rather than serial number
+type pkiRevokeResult struct {
+	CA      string `json:"ca"`
+	Name    string `json:"name,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Serial  string `json:"serial"`
+	CRLPath string `json:"crlPath,omitempty"`
+}
+
+// resolveCert returns the certificate named within the CA or, if there is none, a certificate with the serial number
+// given instead
+func (o *PKIRevokeOptions) resolveCert(caname string) (*x509.Certificate, error) {
+	if raw, err := o.Flags.PKI.Store.FetchCert(caname, o.cert); err == nil {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing certificate %v: %v", o.cert, err)
+		}
+		return cert, nil
+	}
+
+	serial := strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(o.cert), "0x"), ":", "")
+	sn, ok := new(big.Int).SetString(serial, 16)
+	if !ok {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no certificate named %v found in CA %v, and it isn't a serial number", o.cert, caname)
+	}
+	return &x509.Certificate{SerialNumber: sn}, nil
+}
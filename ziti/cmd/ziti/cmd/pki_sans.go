@@ -0,0 +1,136 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+// pkiSANs are the validated subject alternative names of a certificate or CSR
+type pkiSANs struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+}
+
+// addSANFlags adds the repeatable --dns, --ip, --email and --uri flags, each of which also takes a comma separated list
+func (o *PKICreateOptions) addSANFlags(cmd *cobra.Command, certDescription string) {
+	cmd.Flags().StringSliceVar(&o.Flags.DNSName, "dns", []string{}, "DNS name(s) to add to Subject Alternate Name (SAN) for "+certDescription+". Wildcards are allowed as the leftmost label, e.g. *.example.com")
+	cmd.Flags().StringSliceVar(&o.Flags.IP, "ip", []string{}, "IP addr(s) to add to Subject Alternate Name (SAN) for "+certDescription)
+	cmd.Flags().StringSliceVar(&o.Flags.Email, "email", []string{}, "Email addr(s) to add to Subject Alternate Name (SAN) for "+certDescription)
+	cmd.Flags().StringSliceVar(&o.Flags.URI, "uri", []string{}, "URI(s) to add to Subject Alternate Name (SAN) for "+certDescription+", e.g. spiffe://example.com/router1")
+}
+
+// ObtainSANs validates the SANs given with the SAN flags, dropping duplicates
+func (o *PKICreateOptions) ObtainSANs() (*pkiSANs, error) {
+	result := &pkiSANs{}
+	seen := map[string]bool{}
+	isNew := func(kind, val string) bool {
+		key := kind + ":" + val
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+
+	for _, val := range o.Flags.DNSName {
+		name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(val)), ".")
+		if err := validateDNSSAN(name); err != nil {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid DNS name %v: %v", val, err)
+		}
+		if isNew("dns", name) {
+			result.DNSNames = append(result.DNSNames, name)
+		}
+	}
+
+	for _, val := range o.Flags.IP {
+		ip := net.ParseIP(strings.TrimSpace(val))
+		if ip == nil {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid IP address %v", val)
+		}
+		if isNew("ip", ip.String()) {
+			result.IPAddresses = append(result.IPAddresses, ip)
+		}
+	}
+
+	for _, val := range o.Flags.Email {
+		email := strings.TrimSpace(val)
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid email address %v", val)
+		}
+		if isNew("email", strings.ToLower(email)) {
+			result.EmailAddresses = append(result.EmailAddresses, email)
+		}
+	}
+
+	for _, val := range o.Flags.URI {
+		uri, err := url.Parse(strings.TrimSpace(val))
+		if err != nil || uri.Scheme == "" || (uri.Host == "" && uri.Opaque == "") {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid URI %v, must be absolute, e.g. spiffe://example.com/router1", val)
+		}
+		if isNew("uri", uri.String()) {
+			result.URIs = append(result.URIs, uri)
+		}
+	}
+
+	return result, nil
+}
+
+// validateDNSSAN checks that name is a valid DNS name, allowing a wildcard as the whole of the leftmost label as long
+// as at least two labels follow it
+func validateDNSSAN(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 {
+			if len(labels) < 3 {
+				return fmt.Errorf("wildcards must be followed by at least two labels, e.g. *.example.com")
+			}
+			continue
+		}
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("labels must be between 1 and 63 characters")
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("labels may not start or end with a hyphen")
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				if c == '*' {
+					return fmt.Errorf("wildcards are only allowed as the whole of the leftmost label")
+				}
+				return fmt.Errorf("invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObtainSANs(t *testing.T) {
+	req := require.New(t)
+
+	o := &PKICreateOptions{}
+	o.Flags.DNSName = []string{"*.Example.com", "ctrl.example.com", "*.example.com", "ctrl.example.com."}
+	o.Flags.IP = []string{"10.0.0.5", "::1", "10.0.0.5", "0:0:0:0:0:0:0:1"}
+	o.Flags.Email = []string{"ops@example.com", "OPS@example.com"}
+	o.Flags.URI = []string{"spiffe://example.com/router1", "spiffe://example.com/router1"}
+
+	sans, err := o.ObtainSANs()
+	req.NoError(err)
+	req.Equal([]string{"*.example.com", "ctrl.example.com"}, sans.DNSNames)
+	req.Len(sans.IPAddresses, 2)
+	req.Equal("10.0.0.5", sans.IPAddresses[0].String())
+	req.Equal("::1", sans.IPAddresses[1].String())
+	req.Equal([]string{"ops@example.com"}, sans.EmailAddresses)
+	req.Len(sans.URIs, 1)
+	req.Equal("spiffe://example.com/router1", sans.URIs[0].String())
+}
+
+func TestObtainSANsRejectsInvalid(t *testing.T) {
+	for _, flags := range []PKIFlags{
+		{DNSName: []string{"*.com"}},
+		{DNSName: []string{"ctrl.*.example.com"}},
+		{DNSName: []string{"web*.example.com"}},
+		{DNSName: []string{"-bad.example.com"}},
+		{DNSName: []string{"a..example.com"}},
+		{IP: []string{"10.0.0.256"}},
+		{Email: []string{"Ops <ops@example.com>"}},
+		{URI: []string{"/relative/path"}},
+	} {
+		o := &PKICreateOptions{}
+		o.Flags = flags
+		_, err := o.ObtainSANs()
+		require.Error(t, err, "%+v", flags)
+	}
+}
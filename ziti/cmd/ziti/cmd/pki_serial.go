@@ -0,0 +1,90 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/pki/pki"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+// addSerialStrategyFlag adds the flag selecting how serial numbers are picked for the certificates issued
+func (o *PKICreateOptions) addSerialStrategyFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.Flags.SerialStrategy, "serial-strategy", pki.SerialStrategyRandom, "How the serial number is picked ("+strings.Join(pki.SerialStrategies, ", ")+"). "+
+		"Sequential serial numbers are taken from a counter kept per CA in the PKI")
+}
+
+// addSerialFlags adds the serial strategy flag and the flag giving the serial number of the certificate issued
+func (o *PKICreateOptions) addSerialFlags(cmd *cobra.Command) {
+	o.addSerialStrategyFlag(cmd)
+	cmd.Flags().StringVar(&o.Flags.Serial, "serial", "", "Serial number to issue the certificate with, in hex, e.g. 1F:A0 or 0x1FA0, as assigned by an external certificate inventory")
+}
+
+// ApplySerialStrategy validates the serial strategy flag and sets it on the PKI
+func (o *PKICreateOptions) ApplySerialStrategy() error {
+	if err := pki.ValidateSerialStrategy(o.Flags.SerialStrategy); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+	o.Flags.PKI.SerialStrategy = o.Flags.SerialStrategy
+	return nil
+}
+
+// ObtainSerial applies the serial strategy and returns the serial number given with --serial for a certificate to be
+// issued by the given CA, or nil if none was given
+func (o *PKICreateOptions) ObtainSerial(pkiStore store.Store, caName string) (*big.Int, error) {
+	if err := o.ApplySerialStrategy(); err != nil {
+		return nil, err
+	}
+	if o.Flags.Serial == "" {
+		return nil, nil
+	}
+	if o.Cmd != nil && o.Cmd.Flags().Changed("serial-strategy") {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "--serial and --serial-strategy can't be combined")
+	}
+	return parseUnusedSerial(pkiStore, caName, o.Flags.Serial)
+}
+
+// parseUnusedSerial parses a serial number given by the operator and, for a local PKI, makes sure the CA hasn't issued
+// a certificate with it yet, as serial numbers must be unique per CA
+func parseUnusedSerial(pkiStore store.Store, caName, value string) (*big.Int, error) {
+	serial, err := pki.ParseSerial(value)
+	if err != nil {
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	local, ok := pkiStore.(*store.Local)
+	if !ok {
+		return serial, nil
+	}
+	index, err := local.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	hex := fmt.Sprintf("%X", serial)
+	for _, entry := range index.Entries {
+		if entry.CA == caName && entry.Serial == hex && entry.Type != store.EntryTypeCSR && entry.Type != store.EntryTypeKey {
+			return nil, cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "serial number %v was already issued by CA %v, to %v", hex, caName, entry.Name)
+		}
+	}
+	return serial, nil
+}
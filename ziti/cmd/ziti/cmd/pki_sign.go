@@ -0,0 +1,236 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/internal/log"
+	"github.com/openziti/ziti/ziti/pki/pki"
+)
+
+var (
+	pkiSignLong = templates.LongDesc(`
+Signs a Certificate Signing Request (CSR) created on another host, or in an HSM, with a CA from the local PKI.
+
+The subject and SANs of the new certificate are taken from the CSR. The signed certificate is added to the CA's
+directory without a private key, as the private key stays with whoever created the CSR.
+	`)
+
+	pkiSignExample = templates.Examples(`
+		# sign a router's CSR with the intermediate CA and write the certificate to router1.cert
+		ziti pki sign --pki-root ./pki --ca-name intermediate --csr router1.csr --out router1.cert
+
+		# sign a CSR for an intermediate CA
+		ziti pki sign --pki-root ./pki --ca-name root --csr site-ca.csr --intermediate --expire-limit 1825
+	`)
+)
+
+// PKISignOptions the options for the pki sign command
+type PKISignOptions struct {
+	PKICreateOptions
+
+	csrFile      string
+	name         string
+	intermediate bool
+	outFile      string
+	chain        bool
+}
+
+// NewCmdPKISign creates a command object for the "pki sign" command
+func NewCmdPKISign(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKISignOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "sign",
+		Short:   "Signs a Certificate Signing Request (CSR) with a CA from the PKI",
+		Long:    pkiSignLong,
+		Example: pkiSignExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) to use to sign the CSR")
+	options.addCAKeyFlags(cmd)
+	cmd.Flags().StringVarP(&options.csrFile, "csr", "", "", "File containing the CSR to sign, in PEM or DER format")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the file (under the chosen CA) in which to store the signed certificate. Defaults to the name of the CSR file")
+	cmd.Flags().BoolVar(&options.intermediate, "intermediate", false, "Sign the CSR as an intermediate CA")
+	cmd.Flags().IntVarP(&options.Flags.CAExpire, "expire-limit", "", 365, "Expiration limit in days")
+	cmd.Flags().StringVarP(&options.outFile, "out", "o", "", "Also write the signed certificate in PEM format to this file")
+	cmd.Flags().BoolVar(&options.chain, "chain", false, "With --out, append the signing CA's certificate to the signed certificate")
+	options.addSignatureAlgorithmFlag(cmd)
+	options.addSerialFlags(cmd)
+	options.addOutputFlags(cmd, "the signed certificate, including the paths of its files,")
+	_ = cmd.MarkFlagRequired("csr")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKISignOptions) Run() error {
+	if err := pki.ValidateSignatureAlgorithm(o.Flags.SignatureAlgorithm); err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+	}
+
+	csr, err := readCSR(o.csrFile)
+	if err != nil {
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeValidation, err)
+	}
+
+	if csrRequestsCA(csr) && !o.intermediate {
+		o.logWarnf("CSR %v requests a CA certificate, signing it as a leaf certificate. Use --intermediate to sign it as an intermediate CA", o.csrFile)
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caKeySigner, err := o.ObtainSigner()
+	if err != nil {
+		return err
+	}
+
+	o.Flags.PKI = &pki.ZitiPKI{Store: pkiStore, Signer: caKeySigner}
+
+	if err := o.ObtainKeyPasswords(); err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	signer, err := o.Flags.PKI.GetCA(caname)
+	if err != nil {
+		return fmt.Errorf("Cannot locate signer: %v", err)
+	}
+
+	serial, err := o.ObtainSerial(pkiStore, caname)
+	if err != nil {
+		return err
+	}
+
+	name := o.name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(o.csrFile), filepath.Ext(o.csrFile))
+	}
+
+	req := &pki.Request{
+		Name:               name,
+		SignatureAlgorithm: o.Flags.SignatureAlgorithm,
+		Template: &x509.Certificate{
+			NotAfter:     time.Now().AddDate(0, 0, o.Flags.CAExpire),
+			IsCA:         o.intermediate,
+			MaxPathLen:   -1,
+			SerialNumber: serial,
+		},
+	}
+
+	cert, err := o.Flags.PKI.SignCSR(signer, csr, req)
+	if err != nil {
+		return fmt.Errorf("Cannot Sign: %v", err)
+	}
+
+	if o.outFile != "" {
+		out := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if o.chain {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.Cert.Raw})...)
+		}
+		if err := ioutil.WriteFile(o.outFile, out, 0644); err != nil {
+			return fmt.Errorf("failed writing certificate to %v: %v", o.outFile, err)
+		}
+	}
+
+	if o.structuredOutput() {
+		result, err := createdResult(pkiStore, pkiResultTypeOf(cert), caname, name)
+		if err != nil {
+			return err
+		}
+		result.OutPath = o.outFile
+		return o.writeResult(result)
+	}
+
+	log.Infof("Signed certificate %v for %v, serial %X\n", name, cert.Subject.CommonName, cert.SerialNumber)
+
+	return nil
+}
+
+// readCSR reads a CSR in PEM or DER format and checks its signature
+func readCSR(path string) (*x509.CertificateRequest, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading CSR %v: %v", path, err)
+	}
+
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing CSR %v: %v", path, err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid signature on CSR %v: %v", path, err)
+	}
+	return csr, nil
+}
+
+// csrRequestsCA returns true if the CSR asks for CA basic constraints
+func csrRequestsCA(csr *x509.CertificateRequest) bool {
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 19}) {
+			var constraints struct {
+				IsCA       bool `asn1:"optional"`
+				MaxPathLen int  `asn1:"optional,default:-1"`
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &constraints); err == nil {
+				return constraints.IsCA
+			}
+		}
+	}
+	return false
+}
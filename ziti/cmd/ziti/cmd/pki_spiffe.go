@@ -0,0 +1,124 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+const spiffeScheme = "spiffe"
+
+// addSpiffeIDFlag adds the --spiffe-id flag
+func (o *PKICreateOptions) addSpiffeIDFlag(cmd *cobra.Command, certDescription string) {
+	cmd.Flags().StringVar(&o.Flags.SpiffeID, "spiffe-id", "", "SPIFFE ID to add as a URI SAN to "+certDescription+", e.g. spiffe://example.org/router/router1. Its trust domain must match the signing CA's SPIFFE ID, if it has one")
+}
+
+// ApplySpiffeID adds the SPIFFE ID given with --spiffe-id to the template's URI SANs, then checks that the template
+// has at most one SPIFFE ID, whose trust domain matches that of the signing CA. signer is nil for self-signed CAs
+func (o *PKICreateOptions) ApplySpiffeID(template *x509.Certificate, signer *x509.Certificate) error {
+	if o.Flags.SpiffeID != "" {
+		id, err := parseSpiffeID(o.Flags.SpiffeID, template.IsCA)
+		if err != nil {
+			return cmdhelper.WithExitCode(cmdhelper.ExitCodeUsage, err)
+		}
+		template.URIs = append(template.URIs, id)
+	}
+	return checkSpiffeIDs(template, signer)
+}
+
+// checkSpiffeIDs checks that the template has at most one SPIFFE ID, whose trust domain matches that of the signing CA
+func checkSpiffeIDs(template *x509.Certificate, signer *x509.Certificate) error {
+	var ids []*url.URL
+	for _, uri := range template.URIs {
+		if strings.EqualFold(uri.Scheme, spiffeScheme) {
+			ids = append(ids, uri)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) > 1 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "a certificate may only have one SPIFFE ID, found %v and %v", ids[0], ids[1])
+	}
+
+	if signer != nil {
+		if signerID := spiffeIDOf(signer); signerID != nil && !strings.EqualFold(signerID.Host, ids[0].Host) {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "SPIFFE ID %v is not in trust domain %v of the signing CA %v",
+				ids[0], signerID.Host, signer.Subject.CommonName)
+		}
+	}
+	return nil
+}
+
+// parseSpiffeID validates a SPIFFE ID as described by the SPIFFE ID specification. Leaf certificates must identify a
+// workload within the trust domain, so the ID needs a path, while CAs may have an ID of only the trust domain
+func parseSpiffeID(val string, isCA bool) (*url.URL, error) {
+	id, err := url.Parse(strings.TrimSpace(val))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPIFFE ID %v: %v", val, err)
+	}
+	if id.Scheme != spiffeScheme {
+		return nil, fmt.Errorf("invalid SPIFFE ID %v, it must start with spiffe://", val)
+	}
+	if id.User != nil || id.Port() != "" || id.RawQuery != "" || id.Fragment != "" {
+		return nil, fmt.Errorf("invalid SPIFFE ID %v, it may not contain a user, port, query or fragment", val)
+	}
+	if id.Host == "" {
+		return nil, fmt.Errorf("invalid SPIFFE ID %v, the trust domain is missing", val)
+	}
+	for _, c := range id.Host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return nil, fmt.Errorf("invalid SPIFFE ID %v, the trust domain may only contain lowercase letters, digits, '.', '-' and '_'", val)
+		}
+	}
+
+	if id.Path == "" {
+		if !isCA {
+			return nil, fmt.Errorf("invalid SPIFFE ID %v, a path identifying the workload is required, e.g. spiffe://%v/router/router1", val, id.Host)
+		}
+		return id, nil
+	}
+
+	for _, segment := range strings.Split(strings.TrimPrefix(id.Path, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid SPIFFE ID %v, path segments may not be empty, '.' or '..'", val)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return nil, fmt.Errorf("invalid SPIFFE ID %v, the path may only contain letters, digits, '.', '-' and '_'", val)
+			}
+		}
+	}
+	return id, nil
+}
+
+// spiffeIDOf returns the SPIFFE ID of a certificate, or nil if it doesn't have one
+func spiffeIDOf(cert *x509.Certificate) *url.URL {
+	for _, uri := range cert.URIs {
+		if strings.EqualFold(uri.Scheme, spiffeScheme) {
+			return uri
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509/pkix"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+)
+
+// addSubjectFlags adds the repeatable flags setting the subject attributes besides the common name. Each overrides the
+// matching --pki-* flag of pki create, and may be given an empty value to leave the attribute out
+func (o *PKICreateOptions) addSubjectFlags(cmd *cobra.Command, certDescription string) {
+	cmd.Flags().StringSliceVar(&o.Flags.Organization, "organization", nil, "Organization (O) of the "+certDescription+". Overrides --pki-organization")
+	cmd.Flags().StringSliceVar(&o.Flags.OrganizationalUnit, "organizational-unit", nil, "Organizational unit(s) (OU) of the "+certDescription+". Overrides --pki-organizational-unit")
+	cmd.Flags().StringSliceVar(&o.Flags.Country, "country", nil, "Two letter ISO 3166 country code (C) of the "+certDescription+". Overrides --pki-country")
+	cmd.Flags().StringSliceVar(&o.Flags.Locality, "locality", nil, "Locality or city (L) of the "+certDescription+". Overrides --pki-locality")
+	cmd.Flags().StringSliceVar(&o.Flags.Province, "province", nil, "State or province (ST) of the "+certDescription+". Overrides --pki-province")
+}
+
+// ObtainSubject returns the subject for a new certificate or CSR with the given common name. Attributes set with the
+// subject flags replace those given to pki create with the --pki-* flags
+func (o *PKICreateOptions) ObtainSubject(commonName string) (pkix.Name, error) {
+	subject := pkix.Name{CommonName: commonName}
+
+	attributes := []struct {
+		name     string
+		pkiFlag  string
+		override []string
+		target   *[]string
+	}{
+		{"organization", "pki-organization", o.Flags.Organization, &subject.Organization},
+		{"organizational unit", "pki-organizational-unit", o.Flags.OrganizationalUnit, &subject.OrganizationalUnit},
+		{"country", "pki-country", o.Flags.Country, &subject.Country},
+		{"locality", "pki-locality", o.Flags.Locality, &subject.Locality},
+		{"province", "pki-province", o.Flags.Province, &subject.Province},
+	}
+
+	for _, attr := range attributes {
+		// a nil override means the flag wasn't given, while an empty one clears the attribute
+		if attr.override == nil {
+			if str := viper.GetString(attr.pkiFlag); str != "" {
+				*attr.target = []string{str}
+			}
+			continue
+		}
+		for _, val := range attr.override {
+			val = strings.TrimSpace(val)
+			if val == "" {
+				return subject, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "empty %v given", attr.name)
+			}
+			*attr.target = append(*attr.target, val)
+		}
+	}
+
+	for i, country := range subject.Country {
+		if !isCountryCode(country) {
+			return subject, cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid country %v, must be a two letter ISO 3166 code, e.g. US", country)
+		}
+		subject.Country[i] = strings.ToUpper(country)
+	}
+
+	return subject, nil
+}
+
+func isCountryCode(val string) bool {
+	if len(val) != 2 {
+		return false
+	}
+	for _, c := range val {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/pki/store"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault implements enough of the KV version 2 secrets engine API, mounted
+// at secret/, to test the vault PKI backend.
+type fakeVault struct {
+	sync.Mutex
+	secrets  map[string]json.RawMessage
+	versions map[string]int
+}
+
+func newFakeVault() *httptest.Server {
+	v := &fakeVault{secrets: map[string]json.RawMessage{}, versions: map[string]int{}}
+	return httptest.NewServer(v)
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.Lock()
+	defer v.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		data, found := v.secrets[path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": v.versions[path]},
+			},
+		})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		var body struct {
+			Data    json.RawMessage `json:"data"`
+			Options struct {
+				CAS *int `json:"cas"`
+			} `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Options.CAS != nil && *body.Options.CAS != v.versions[path] {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		v.secrets[path] = body.Data
+		v.versions[path]++
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+		delete(v.secrets, path)
+		delete(v.versions, path)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "LIST" && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		prefix := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/"), "/") + "/"
+		keys := map[string]bool{}
+		for path := range v.secrets {
+			if strings.HasPrefix(path, prefix) {
+				rest := strings.TrimPrefix(path, prefix)
+				if idx := strings.Index(rest, "/"); idx >= 0 {
+					rest = rest[:idx+1]
+				}
+				keys[rest] = true
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var result []string
+		for key := range keys {
+			result = append(result, key)
+		}
+		sort.Strings(result)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": result}})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPKIVaultBackend(t *testing.T) {
+	req := require.New(t)
+	server := newFakeVault()
+	defer server.Close()
+
+	run := func(args ...string) error {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(append(args, "--pki-backend", "vault", "--vault-addr", server.URL, "--vault-token", "test-token"))
+		return cmd.Execute()
+	}
+
+	req.NoError(run("create", "ca", "--ca-file", "root"))
+	req.NoError(run("create", "intermediate", "--ca-name", "root", "--intermediate-file", "inter"))
+	req.NoError(run("create", "client", "--ca-name", "inter", "--client-file", "client"))
+
+	csrFile := t.TempDir() + "/spare.csr"
+	req.NoError(run("create", "csr", "--ca-name", "inter", "--csr-file", "spare", "--out", csrFile))
+	csrPem, err := ioutil.ReadFile(csrFile)
+	req.NoError(err)
+	block, _ := pem.Decode(csrPem)
+	req.NotNil(block)
+	_, err = x509.ParseCertificateRequest(block.Bytes)
+	req.NoError(err)
+
+	vault := server.Config.Handler.(*fakeVault)
+	var bundle struct {
+		Key  string `json:"key"`
+		Cert string `json:"cert"`
+	}
+	req.NoError(json.Unmarshal(vault.secrets["ziti-pki/inter/client"], &bundle))
+	req.Contains(bundle.Key, "PRIVATE KEY")
+
+	block, _ = pem.Decode([]byte(bundle.Cert))
+	req.NotNil(block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	req.NoError(err)
+	req.Equal("NetFoundry Inc. Client", cert.Subject.CommonName)
+	req.Equal("NetFoundry Inc. Intermediate CA", cert.Issuer.CommonName)
+
+	var index struct {
+		Certs []struct {
+			Name  string `json:"name"`
+			State string `json:"state"`
+		} `json:"certs"`
+	}
+	req.NoError(json.Unmarshal(vault.secrets["ziti-pki/inter/_index"], &index))
+	req.Len(index.Certs, 1)
+	req.Equal("client", index.Certs[0].Name)
+
+	req.NoError(run("revoke", "--ca-name", "inter", "--cert", "client", "--crl"))
+	req.NoError(json.Unmarshal(vault.secrets["ziti-pki/inter/_index"], &index))
+	req.Equal("R", index.Certs[0].State)
+
+	var crlSecret struct {
+		CRL string `json:"crl"`
+	}
+	req.NoError(json.Unmarshal(vault.secrets["ziti-pki/inter/_crl"], &crlSecret))
+	block, _ = pem.Decode([]byte(crlSecret.CRL))
+	req.NotNil(block)
+	crl, err := x509.ParseCRL(block.Bytes)
+	req.NoError(err)
+	req.Len(crl.TBSCertList.RevokedCertificates, 1)
+	req.Equal(0, crl.TBSCertList.RevokedCertificates[0].SerialNumber.Cmp(cert.SerialNumber))
+
+	vaultStore := &store.Vault{Addr: server.URL, Token: "test-token", Mount: "secret", Prefix: "ziti-pki"}
+	records, err := vaultStore.AuditRecords()
+	req.NoError(err)
+	req.NoError(store.VerifyAuditRecords(records))
+	req.Contains(vault.secrets, "ziti-pki/_audit/000000000004")
+	var operations []string
+	for _, record := range records {
+		operations = append(operations, record.Operation+":"+record.CA+"/"+record.Name)
+	}
+	req.Equal([]string{"issue:root/root", "issue:root/inter", "issue:inter/client", "revoke:inter/client"}, operations)
+
+	caNames, err := vaultStore.CANames()
+	req.NoError(err)
+	req.Equal([]string{"inter", "root"}, caNames)
+
+	// a record written without moving the head, as if its writer failed part way, is adopted by the next writer
+	head, err := json.Marshal(map[string]interface{}{"seq": 3, "hash": records[2].Hash})
+	req.NoError(err)
+	vault.Lock()
+	vault.secrets["ziti-pki/_audit"] = head
+	vault.versions["ziti-pki/_audit"]++
+	vault.Unlock()
+
+	req.NoError(run("create", "client", "--ca-name", "inter", "--client-file", "client2"))
+	records, err = vaultStore.AuditRecords()
+	req.NoError(err)
+	req.NoError(store.VerifyAuditRecords(records))
+	req.Len(records, 5)
+	req.Equal("issue:inter/client2", records[4].Operation+":"+records[4].CA+"/"+records[4].Name)
+
+	// removing a bundle, as when rolling back a batch, frees its name and drops it from the index
+	req.NoError(vaultStore.RemoveChain("inter", "client2"))
+	req.NoError(vaultStore.Remove("inter", "client2"))
+	req.NotContains(vault.secrets, "ziti-pki/inter/client2")
+	req.NoError(json.Unmarshal(vault.secrets["ziti-pki/inter/_index"], &index))
+	req.Len(index.Certs, 1)
+	records, err = vaultStore.AuditRecords()
+	req.NoError(err)
+	req.NoError(store.VerifyAuditRecords(records))
+	req.Equal("remove:inter/client2", records[5].Operation+":"+records[5].CA+"/"+records[5].Name)
+	req.NoError(run("create", "client", "--ca-name", "inter", "--client-file", "client2"))
+
+	// the head anchors the end of the chain, so the last records can't be changed or removed unnoticed
+	vault.Lock()
+	head = vault.secrets["ziti-pki/_audit"]
+	vault.secrets["ziti-pki/_audit"] = json.RawMessage(`{"seq": 7, "hash": "rewritten"}`)
+	vault.Unlock()
+	_, err = vaultStore.AuditRecords()
+	req.EqualError(err, "audit record 7 doesn't match the head of the audit log in vault")
+
+	vault.Lock()
+	vault.secrets["ziti-pki/_audit"] = head
+	delete(vault.secrets, "ziti-pki/_audit/000000000007")
+	vault.Unlock()
+	_, err = vaultStore.AuditRecords()
+	req.EqualError(err, "audit record 7 is missing from vault")
+}
@@ -0,0 +1,421 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/openziti/foundation/v2/stringz"
+	"github.com/openziti/identity/certtools"
+	"github.com/spf13/cobra"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+var (
+	pkiVerifyLong = templates.LongDesc(`
+Verifies certificates against the chain of CAs in the PKI, so that broken certificates are caught before they're
+deployed. Each certificate is checked for:
+
+  * expiry: the certificate and its CAs are currently valid, warning if they expire within --warn-days
+  * path length: no CA in the chain has more intermediate CAs below it than its maximum path length allows
+  * key usage: leaf certificates can sign but not issue certificates, and have the extended key usage of their type
+  * SAN: server certificates have DNS or IP SANs, and the SANs given with --san are present
+  * signature: the certificate and each CA in the chain are signed by the next CA, up to a self-signed root
+  * revocation: the certificate hasn't been revoked by its CA
+
+Verifies the named certificate, a certificate file issued by the CA, or by default all server and client certificates
+within the CA. Exits with a non-zero exit code if any certificate has errors, or warnings with --strict, so that it
+can gate deployment pipelines.
+	`)
+
+	pkiVerifyExample = templates.Examples(`
+		# verify all certificates issued by the intermediate CA
+		ziti pki verify --pki-root ./pki --ca-name intermediate
+
+		# verify a server certificate before deploying it, failing if it expires within 30 days
+		ziti pki verify --pki-root ./pki --ca-name intermediate --name server1 --san ctrl.example.com --warn-days 30 --strict
+	`)
+)
+
+// Checks made by pki verify
+const (
+	pkiCheckExpiry     = "expiry"
+	pkiCheckPathLength = "path-length"
+	pkiCheckKeyUsage   = "key-usage"
+	pkiCheckSAN        = "san"
+	pkiCheckSignature  = "signature"
+	pkiCheckRevocation = "revocation"
+)
+
+// PKIVerifyOptions the options for the pki verify command
+type PKIVerifyOptions struct {
+	PKICreateOptions
+
+	name     string
+	certFile string
+	sans     []string
+	warnDays int
+	strict   bool
+}
+
+// pkiVerifyProblem is a failed check of a certificate
+type pkiVerifyProblem struct {
+	Check   string `json:"check"`
+	Warning bool   `json:"warning,omitempty"`
+	Message string `json:"message"`
+}
+
+// pkiVerifyResult is the outcome of verifying a certificate
+type pkiVerifyResult struct {
+	CA         string              `json:"ca"`
+	Name       string              `json:"name"`
+	Type       string              `json:"type"`
+	CommonName string              `json:"commonName"`
+	NotAfter   time.Time           `json:"notAfter"`
+	Valid      bool                `json:"valid"`
+	Problems   []*pkiVerifyProblem `json:"problems,omitempty"`
+}
+
+func (r *pkiVerifyResult) addProblem(check string, warning bool, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, &pkiVerifyProblem{Check: check, Warning: warning, Message: fmt.Sprintf(format, args...)})
+}
+
+// passed returns whether the certificate has no errors, and no warnings if strict
+func (r *pkiVerifyResult) passed(strict bool) bool {
+	for _, problem := range r.Problems {
+		if !problem.Warning || strict {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCmdPKIVerify creates a command object for the "pki verify" command
+func NewCmdPKIVerify(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PKIVerifyOptions{
+		PKICreateOptions: PKICreateOptions{
+			PKIOptions: PKIOptions{
+				CommonOptions: CommonOptions{
+					Out: out,
+					Err: errOut,
+				},
+			},
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "verify",
+		Short:   "Verifies certificates against the CA chain in the PKI",
+		Long:    pkiVerifyLong,
+		Example: pkiVerifyExample,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&options.Flags.PKIRoot, "pki-root", "", "", "Directory in which PKI resides")
+	cmd.Flags().StringVarP(&options.Flags.CAName, "ca-name", "", "", "Name of CA (within PKI_ROOT) which issued the certificates")
+	cmd.Flags().StringVarP(&options.name, "name", "", "", "Name of the certificate (within the CA) to verify. Defaults to all server and client certificates within the CA")
+	cmd.Flags().StringVarP(&options.certFile, "cert", "", "", "PEM file of a certificate issued by the CA to verify, instead of one in the PKI")
+	cmd.Flags().StringSliceVar(&options.sans, "san", nil, "DNS name, IP address, email or URI which must be among the SANs of the certificates. May be repeated")
+	cmd.Flags().IntVar(&options.warnDays, "warn-days", 14, "Warn about certificates which expire within this many days")
+	cmd.Flags().BoolVar(&options.strict, "strict", false, "Fail on warnings as well as errors")
+	options.addOutputFlags(cmd, "the results")
+
+	return cmd
+}
+
+// Run implements this command
+func (o *PKIVerifyOptions) Run() error {
+	if o.name != "" && o.certFile != "" {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "only one of --name and --cert may be given")
+	}
+
+	pkiStore, pkiroot, err := o.ObtainPKIStore()
+	if err != nil {
+		return err
+	}
+
+	caname, err := o.ObtainCAName(pkiroot)
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+
+	chain, err := store.CAChain(pkiStore, caname)
+	if err != nil {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "Cannot locate CA %v: %v", caname, err)
+	}
+
+	revoked := map[string]bool{}
+	if revokedCerts, err := pkiStore.Revoked(caname); err == nil {
+		for _, entry := range revokedCerts {
+			revoked[entry.SerialNumber.String()] = true
+		}
+	}
+
+	var results []*pkiVerifyResult
+	verify := func(name, certType string, cert *x509.Certificate) {
+		result := o.verifyCert(cert, certType, chain, revoked, time.Now())
+		result.CA = caname
+		result.Name = name
+		results = append(results, result)
+	}
+
+	switch {
+	case o.certFile != "":
+		certs, err := certtools.LoadCertFromFile(o.certFile)
+		if err != nil {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "unable to load certificate from %v: %v", o.certFile, err)
+		}
+		verify(o.certFile, "", certs[0])
+	case o.name != "":
+		cert, err := fetchCert(pkiStore, caname, o.name)
+		if err != nil {
+			return err
+		}
+		verify(o.name, "", cert)
+	default:
+		local, ok := pkiStore.(*store.Local)
+		if !ok {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "verifying all certificates of a CA is only supported for the %v PKI backend, use --name", PKIBackendLocal)
+		}
+		index, err := local.BuildIndex()
+		if err != nil {
+			return err
+		}
+		for _, entry := range index.Entries {
+			if entry.CA != caname || (entry.Type != store.EntryTypeServer && entry.Type != store.EntryTypeClient) {
+				continue
+			}
+			cert, err := fetchCert(pkiStore, caname, entry.Name)
+			if err != nil {
+				return err
+			}
+			verify(entry.Name, entry.Type, cert)
+		}
+		if len(results) == 0 {
+			return cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "no server or client certificates found within CA %v", caname)
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.passed(o.strict) {
+			failed++
+		}
+	}
+
+	if o.structuredOutput() {
+		if err := o.writeResult(results); err != nil {
+			return err
+		}
+	} else {
+		o.outputResults(results)
+	}
+
+	if failed > 0 {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "%v of %v certificates failed verification", failed, len(results))
+	}
+	return nil
+}
+
+func fetchCert(pkiStore store.Store, caname, name string) (*x509.Certificate, error) {
+	raw, err := pkiStore.FetchCert(caname, name)
+	if err != nil {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeNotFound, "Cannot locate certificate %v within CA %v: %v", name, caname, err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate %v: %v", name, err)
+	}
+	return cert, nil
+}
+
+// verifyCert checks a leaf certificate against the chain of CAs which issued it, starting with its issuer. The type
+// of certificate, server or client, is inferred from its extended key usage, or else its SANs, if not given
+func (o *PKIVerifyOptions) verifyCert(cert *x509.Certificate, certType string, chain []*x509.Certificate, revoked map[string]bool, now time.Time) *pkiVerifyResult {
+	if certType == "" {
+		certType = store.EntryTypeClient
+		hasHostSANs := len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0
+		if hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) || (len(cert.ExtKeyUsage) == 0 && hasHostSANs) {
+			certType = store.EntryTypeServer
+		}
+	}
+	result := &pkiVerifyResult{
+		Type:       certType,
+		CommonName: cert.Subject.CommonName,
+		NotAfter:   cert.NotAfter.UTC(),
+	}
+
+	// expiry
+	warnWithin := time.Duration(o.warnDays) * 24 * time.Hour
+	for i, c := range append([]*x509.Certificate{cert}, chain...) {
+		subject := "certificate"
+		if i > 0 {
+			subject = "CA " + c.Subject.CommonName
+		}
+		switch {
+		case now.Before(c.NotBefore):
+			result.addProblem(pkiCheckExpiry, false, "%v isn't valid until %v", subject, c.NotBefore.UTC().Format(time.RFC3339))
+		case now.After(c.NotAfter):
+			result.addProblem(pkiCheckExpiry, false, "%v expired on %v", subject, c.NotAfter.UTC().Format(time.RFC3339))
+		case c.NotAfter.Sub(now) < warnWithin:
+			result.addProblem(pkiCheckExpiry, true, "%v expires in %v days", subject, int(c.NotAfter.Sub(now).Hours()/24))
+		}
+	}
+	if len(chain) > 0 && cert.NotAfter.After(chain[0].NotAfter) {
+		result.addProblem(pkiCheckExpiry, true, "certificate outlives CA %v, which expires first", chain[0].Subject.CommonName)
+	}
+
+	// path length: the CA at index i has i intermediate CAs between it and the leaf
+	for i, ca := range chain {
+		if !ca.BasicConstraintsValid || !ca.IsCA {
+			result.addProblem(pkiCheckPathLength, false, "%v in the chain isn't a CA", ca.Subject.CommonName)
+		} else if (ca.MaxPathLen > 0 || ca.MaxPathLenZero) && i > ca.MaxPathLen {
+			result.addProblem(pkiCheckPathLength, false, "CA %v allows %v intermediate CAs below it, but has %v", ca.Subject.CommonName, ca.MaxPathLen, i)
+		}
+	}
+
+	// key usage
+	if cert.IsCA {
+		result.addProblem(pkiCheckKeyUsage, false, "certificate is a CA, not a leaf certificate")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement|x509.KeyUsageKeyEncipherment) == 0 {
+		result.addProblem(pkiCheckKeyUsage, false, "key usage doesn't allow digital-signature, key-agreement or key-encipherment")
+	}
+	if !cert.IsCA && cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		result.addProblem(pkiCheckKeyUsage, false, "key usage of a leaf certificate allows signing certificates or CRLs")
+	}
+	requiredExtKeyUsage, extKeyUsageName := x509.ExtKeyUsageClientAuth, "client-auth"
+	if certType == store.EntryTypeServer {
+		requiredExtKeyUsage, extKeyUsageName = x509.ExtKeyUsageServerAuth, "server-auth"
+	}
+	if len(cert.ExtKeyUsage) > 0 && !hasExtKeyUsage(cert, requiredExtKeyUsage) && !hasExtKeyUsage(cert, x509.ExtKeyUsageAny) {
+		result.addProblem(pkiCheckKeyUsage, false, "extended key usage doesn't include %v", extKeyUsageName)
+	}
+	for _, ca := range chain {
+		if ca.KeyUsage != 0 && ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+			result.addProblem(pkiCheckKeyUsage, false, "key usage of CA %v doesn't allow cert-sign", ca.Subject.CommonName)
+		}
+	}
+
+	// SANs
+	if certType == store.EntryTypeServer && len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 {
+		result.addProblem(pkiCheckSAN, false, "server certificate has no DNS or IP SANs, clients ignore the common name")
+	}
+	sans := certSANs(cert)
+	for _, san := range o.sans {
+		if !stringz.Contains(sans, san) {
+			result.addProblem(pkiCheckSAN, false, "SAN %v is missing", san)
+		}
+	}
+
+	// signature
+	if len(chain) == 0 {
+		result.addProblem(pkiCheckSignature, false, "no CA chain found")
+	}
+	for i, c := range append([]*x509.Certificate{cert}, chain...) {
+		var issuer *x509.Certificate
+		if i < len(chain) {
+			issuer = chain[i]
+		} else if i > 0 {
+			// the last CA of the chain must be a self-signed root
+			issuer = c
+		} else {
+			break
+		}
+		if err := c.CheckSignatureFrom(issuer); err != nil {
+			if issuer == c {
+				result.addProblem(pkiCheckSignature, true, "chain ends at CA %v, which isn't a self-signed root in the PKI", c.Subject.CommonName)
+			} else {
+				result.addProblem(pkiCheckSignature, false, "%v isn't signed by CA %v: %v", c.Subject.CommonName, issuer.Subject.CommonName, err)
+			}
+		}
+	}
+
+	// revocation
+	if revoked[cert.SerialNumber.String()] {
+		result.addProblem(pkiCheckRevocation, false, "certificate has been revoked")
+	}
+
+	result.Valid = result.passed(o.strict)
+	return result
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+func (o *PKIVerifyOptions) outputResults(results []*pkiVerifyResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return len(results[i].Problems) > len(results[j].Problems)
+	})
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.AppendHeader(table.Row{"Name", "Type", "Common Name", "Not After", "Result", "Problems"})
+	passed := 0
+	for _, result := range results {
+		status := "FAIL"
+		if result.Valid {
+			status = "OK"
+			passed++
+		}
+		var problems []string
+		for _, problem := range result.Problems {
+			severity := "error"
+			if problem.Warning {
+				severity = "warning"
+			}
+			problems = append(problems, fmt.Sprintf("%v (%v): %v", problem.Check, severity, problem.Message))
+		}
+		t.AppendRow(table.Row{result.Name, result.Type, result.CommonName, result.NotAfter.Format("2006-01-02 15:04:05"), status, strings.Join(problems, "\n")})
+	}
+	t.SetOutputMirror(o.Out)
+	t.Render()
+	_, _ = fmt.Fprintf(o.Out, "%v of %v certificates passed verification\n", passed, len(results))
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIVerify(t *testing.T) {
+	req := require.New(t)
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := NewCmdPKI(ioutil.Discard, ioutil.Discard)
+		cmd.SetArgs(args)
+		req.NoError(cmd.Execute())
+	}
+
+	run("create", "ca", "--pki-root", root, "--ca-file", "root", "--key-algorithm", "ecdsa")
+	run("create", "intermediate", "--pki-root", root, "--ca-name", "root", "--intermediate-file", "intermediate",
+		"--key-algorithm", "ecdsa", "--max-path-len", "1")
+	run("create", "server", "--pki-root", root, "--ca-name", "intermediate", "--server-file", "server",
+		"--dns", "ctrl.example.com", "--ip", "10.0.0.5", "--key-algorithm", "ecdsa")
+	run("create", "client", "--pki-root", root, "--ca-name", "intermediate", "--client-file", "client",
+		"--key-algorithm", "ecdsa")
+
+	verify := func(configure func(o *PKIVerifyOptions)) ([]*pkiVerifyResult, error) {
+		out := &bytes.Buffer{}
+		options := &PKIVerifyOptions{warnDays: 14}
+		options.Out = out
+		options.Flags.PKIRoot = root
+		options.Flags.CAName = "intermediate"
+		options.Flags.JSON = true
+		if configure != nil {
+			configure(options)
+		}
+		err := options.Run()
+		var results []*pkiVerifyResult
+		req.NoError(json.Unmarshal(out.Bytes(), &results))
+		return results, err
+	}
+
+	results, err := verify(nil)
+	req.NoError(err)
+	req.Len(results, 2)
+	for _, result := range results {
+		req.True(result.Valid, "%v: %+v", result.Name, result.Problems)
+		req.Empty(result.Problems)
+	}
+
+	results, err = verify(func(o *PKIVerifyOptions) {
+		o.name = "server"
+		o.sans = []string{"ctrl.example.com", "10.0.0.5", "edge.example.com"}
+	})
+	req.Error(err)
+	req.Len(results, 1)
+	req.Equal("server", results[0].Type)
+	req.Len(results[0].Problems, 1)
+	req.Equal(pkiCheckSAN, results[0].Problems[0].Check)
+	req.Contains(results[0].Problems[0].Message, "edge.example.com")
+
+	// warnings only fail with --strict
+	results, err = verify(func(o *PKIVerifyOptions) { o.warnDays = 100000 })
+	req.NoError(err)
+	req.Equal(pkiCheckExpiry, results[0].Problems[0].Check)
+	req.True(results[0].Problems[0].Warning)
+	_, err = verify(func(o *PKIVerifyOptions) {
+		o.warnDays = 100000
+		o.strict = true
+	})
+	req.Error(err)
+
+	run("revoke", "--pki-root", root, "--ca-name", "intermediate", "--cert", "client")
+	results, err = verify(func(o *PKIVerifyOptions) { o.name = "client" })
+	req.Error(err)
+	req.Equal(pkiCheckRevocation, results[0].Problems[0].Check)
+}
@@ -0,0 +1,212 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
+	"github.com/openziti/ziti/ziti/cmd/ziti/plugin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pluginLong = templates.LongDesc(`
+Provides utilities for interacting with plugins.
+
+Plugins are executables found on your PATH whose names start with 'ziti-'. A plugin named
+'ziti-foo' can be invoked as 'ziti foo', and 'ziti-foo-bar' as 'ziti foo bar'. Plugins cannot
+override built-in ziti commands.
+`)
+)
+
+// PluginOptions are the flags for plugin commands
+type PluginOptions struct {
+	CommonOptions
+	NameOnly bool
+}
+
+// NewCmdPlugin creates the command
+func NewCmdPlugin(out io.Writer, errOut io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Provides utilities for interacting with plugins",
+		Long:  pluginLong,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdhelper.CheckErr(cmd.Help())
+		},
+	}
+
+	cmd.AddCommand(newCmdPluginList(out, errOut))
+	return cmd
+}
+
+func newCmdPluginList(out io.Writer, errOut io.Writer) *cobra.Command {
+	options := &PluginOptions{
+		CommonOptions: CommonOptions{
+			Out: out,
+			Err: errOut,
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all visible plugin executables on the user's PATH",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			cmdhelper.CheckErr(err)
+		},
+	}
+
+	cmd.Flags().BoolVar(&options.NameOnly, "name-only", false, "If true, display only the binary name of each plugin, rather than its full path")
+	return cmd
+}
+
+// Run implements the command
+func (o *PluginOptions) Run() error {
+	plugins := findPlugins(filepath.SplitList(os.Getenv("PATH")))
+	if len(plugins) == 0 {
+		return fmt.Errorf("unable to find any ziti plugins in your PATH")
+	}
+
+	root := o.Cmd.Root()
+	seen := map[string]string{}
+
+	_, _ = fmt.Fprintln(o.Out, "The following compatible plugins are available:")
+	_, _ = fmt.Fprintln(o.Out)
+	for _, p := range plugins {
+		if o.NameOnly {
+			_, _ = fmt.Fprintln(o.Out, filepath.Base(p))
+		} else {
+			_, _ = fmt.Fprintln(o.Out, p)
+		}
+
+		name := pluginCommandName(p)
+		if prev, found := seen[name]; found {
+			_, _ = fmt.Fprintf(o.Out, "  - warning: %v is shadowed by a similarly named plugin: %v\n", p, prev)
+		} else {
+			seen[name] = p
+		}
+
+		if cmd, _, err := root.Find(strings.Split(name, "-")); err == nil && cmd != root {
+			_, _ = fmt.Fprintf(o.Out, "  - warning: %v overwrites existing command: '%v'\n", p, cmd.CommandPath())
+		}
+	}
+	return nil
+}
+
+// findPlugins returns the full paths of all plugin executables found in the given directories, in search order
+func findPlugins(dirs []string) []string {
+	var result []string
+	visited := map[string]struct{}{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if _, found := visited[dir]; found {
+			continue
+		}
+		visited[dir] = struct{}{}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasPrefix(f.Name(), plugin.BinaryPrefix) {
+				continue
+			}
+			if !isExecutable(f) {
+				continue
+			}
+			result = append(result, filepath.Join(dir, f.Name()))
+		}
+	}
+	return result
+}
+
+func isExecutable(f os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return f.Mode()&0111 != 0
+}
+
+// pluginCommandName returns the command path a plugin binary provides, ie ziti-foo-bar provides foo-bar
+func pluginCommandName(path string) string {
+	name := strings.TrimPrefix(filepath.Base(path), plugin.BinaryPrefix)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// dispatchPlugin runs the plugin providing the command given by args, unless it's a built-in command. Returns false if
+// no plugin was run
+func dispatchPlugin(root *cobra.Command, args []string, out, errOut io.Writer) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if _, _, err := root.Find(args); err == nil {
+		return false, nil
+	}
+	return runPlugin(args, out, errOut)
+}
+
+// runPlugin looks for the plugin executable best matching the given arguments and runs it. Returns false
+// if no matching plugin was found
+func runPlugin(args []string, out, errOut io.Writer) (bool, error) {
+	var parts []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		parts = append(parts, strings.ReplaceAll(arg, "-", "_"))
+	}
+
+	// prefer the longest matching name, so ziti-foo-bar wins over ziti-foo for 'ziti foo bar'
+	for i := len(parts); i > 0; i-- {
+		path, err := exec.LookPath(plugin.BinaryPrefix + strings.Join(parts[:i], "-"))
+		if err != nil {
+			continue
+		}
+
+		pluginCmd := exec.Command(path, args[i:]...)
+		pluginCmd.Stdin = os.Stdin
+		pluginCmd.Stdout = out
+		pluginCmd.Stderr = errOut
+		pluginCmd.Env = os.Environ()
+		if self, err := os.Executable(); err == nil {
+			pluginCmd.Env = append(pluginCmd.Env, plugin.EnvZitiBinary+"="+self)
+		}
+
+		return true, pluginCmd.Run()
+	}
+	return false, nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPlugin writes a plugin running the given shell script to the directory, with the given file mode
+func writeTestPlugin(t *testing.T, dir, name string, script string, mode os.FileMode) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0600))
+	require.NoError(t, os.Chmod(path, mode))
+	return path
+}
+
+func skipPluginTestsOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+}
+
+func newTestPluginRoot() *cobra.Command {
+	root := &cobra.Command{Use: "ziti"}
+	edge := &cobra.Command{Use: "edge", Run: func(*cobra.Command, []string) {}}
+	edge.AddCommand(&cobra.Command{Use: "list", Run: func(*cobra.Command, []string) {}})
+	root.AddCommand(edge, &cobra.Command{Use: "version", Run: func(*cobra.Command, []string) {}})
+	return root
+}
+
+func TestFindPlugins(t *testing.T) {
+	skipPluginTestsOnWindows(t)
+	req := require.New(t)
+
+	first, second := t.TempDir(), t.TempDir()
+	foo := writeTestPlugin(t, first, "ziti-foo", "", 0700)
+	writeTestPlugin(t, first, "ziti-bar", "", 0600)
+	writeTestPlugin(t, first, "other-foo", "", 0700)
+	req.NoError(os.Mkdir(filepath.Join(first, "ziti-dir"), 0700))
+	shadowed := writeTestPlugin(t, second, "ziti-foo", "", 0700)
+	fooBar := writeTestPlugin(t, second, "ziti-foo-bar", "", 0500)
+
+	plugins := findPlugins([]string{"", first, filepath.Join(first, "missing"), second, first})
+	req.Equal([]string{foo, shadowed, fooBar}, plugins)
+
+	req.Equal("foo", pluginCommandName(foo))
+	req.Equal("foo-bar", pluginCommandName(fooBar))
+}
+
+func TestPluginList(t *testing.T) {
+	skipPluginTestsOnWindows(t)
+	req := require.New(t)
+
+	first, second := t.TempDir(), t.TempDir()
+	foo := writeTestPlugin(t, first, "ziti-foo", "", 0700)
+	shadowed := writeTestPlugin(t, second, "ziti-foo", "", 0700)
+	edgeList := writeTestPlugin(t, second, "ziti-edge-list", "", 0700)
+	t.Setenv("PATH", first+string(filepath.ListSeparator)+second)
+
+	out := &bytes.Buffer{}
+	options := &PluginOptions{CommonOptions: CommonOptions{Out: out}}
+	options.Cmd = &cobra.Command{Use: "list"}
+	newTestPluginRoot().AddCommand(options.Cmd)
+	req.NoError(options.Run())
+
+	req.Equal("The following compatible plugins are available:\n\n"+
+		foo+"\n"+
+		edgeList+"\n"+
+		"  - warning: "+edgeList+" overwrites existing command: 'ziti edge list'\n"+
+		shadowed+"\n"+
+		"  - warning: "+shadowed+" is shadowed by a similarly named plugin: "+foo+"\n", out.String())
+
+	t.Setenv("PATH", t.TempDir())
+	req.Error(options.Run())
+}
+
+func TestDispatchPlugin(t *testing.T) {
+	skipPluginTestsOnWindows(t)
+
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "ziti-foo", `echo "foo $*"; echo "stderr" >&2; exit 3`, 0700)
+	writeTestPlugin(t, dir, "ziti-foo-bar", `echo "foo-bar $*"; test -n "$ZITI_CLI_BINARY"`, 0700)
+	writeTestPlugin(t, dir, "ziti-version", `echo "plugin version"`, 0700)
+	writeTestPlugin(t, dir, "ziti-tool", `echo "not executable"`, 0600)
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		name     string
+		args     []string
+		found    bool
+		out      string
+		exitCode int
+	}{
+		{name: "longest name wins", args: []string{"foo", "bar", "--flag", "a b"}, found: true, out: "foo-bar --flag a b\n"},
+		{name: "arguments are forwarded", args: []string{"foo", "baz", "--flag"}, found: true, out: "foo baz --flag\n", exitCode: 3},
+		{name: "flags end the command name", args: []string{"foo", "--flag", "bar"}, found: true, out: "foo --flag bar\n", exitCode: 3},
+		{name: "built-in commands aren't overridden", args: []string{"version"}},
+		{name: "unknown command", args: []string{"missing"}},
+		{name: "non-executable plugin", args: []string{"tool"}},
+		{name: "no arguments"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := require.New(t)
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			found, err := dispatchPlugin(newTestPluginRoot(), test.args, out, errOut)
+			req.Equal(test.found, found)
+			req.Equal(test.out, out.String())
+			if test.exitCode == 0 {
+				req.NoError(err)
+				return
+			}
+			exitErr, ok := err.(*exec.ExitError)
+			req.True(ok, "expected an exit error, got %v", err)
+			req.Equal(test.exitCode, exitErr.ExitCode())
+			req.Equal("stderr\n", errOut.String())
+		})
+	}
+}
@@ -17,6 +17,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/blang/semver"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/table"
@@ -28,19 +29,35 @@ import (
 
 	"github.com/openziti/ziti/common/version"
 	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/templates"
 	c "github.com/openziti/ziti/ziti/cmd/ziti/constants"
 	"github.com/openziti/ziti/ziti/cmd/ziti/util"
 
 	"github.com/spf13/cobra"
 )
 
-const ()
+var (
+	versionLong = templates.LongDesc(`
+Print the version of ziti and of the other installed Ziti applications, then check for updates.
+
+--json outputs the version, revision and build date of ziti along with the range of controller versions it's
+compatible with, for use by installers and wrappers. --check also checks the version of the controller the CLI is
+logged in to, exiting with an error if the controller isn't compatible with the CLI.
+	`)
+
+	versionExample = templates.Examples(`
+		# check that the CLI can manage the controller it's logged in to
+		ziti version --check --json
+	`)
+)
 
 type VersionOptions struct {
 	CommonOptions
 
 	Container      string
 	NoVersionCheck bool
+	Check          bool
+	JSON           bool
 }
 
 func NewCmdVersion(out io.Writer, errOut io.Writer) *cobra.Command {
@@ -54,6 +71,8 @@ func NewCmdVersion(out io.Writer, errOut io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "version",
 		Short:   "Print the version information",
+		Long:    versionLong,
+		Example: versionExample,
 		Aliases: []string{"ver", "v"},
 		Run: func(cmd *cobra.Command, args []string) {
 			options.Cmd = cmd
@@ -66,6 +85,10 @@ func NewCmdVersion(out io.Writer, errOut io.Writer) *cobra.Command {
 
 	cmd.Flags().BoolVarP(&options.NoVersionCheck, "no-update", "n", false,
 		"disable update check")
+	cmd.Flags().BoolVarP(&options.JSON, "json", "j", false,
+		"output the version, build details and controller compatibility range as JSON, without checking for updates")
+	cmd.Flags().BoolVar(&options.Check, "check", false,
+		"check that the controller the CLI is logged in to is compatible with this version of the CLI")
 
 	return cmd
 }
@@ -75,6 +98,10 @@ func (o *VersionOptions) Run() error {
 
 	util.ConfigDir()
 
+	if o.JSON {
+		return o.outputJSON()
+	}
+
 	info := util.ColorInfo
 
 	t := table.CreateTable(os.Stdout)
@@ -90,6 +117,12 @@ func (o *VersionOptions) Run() error {
 
 	t.Render()
 
+	if o.Check {
+		if err := o.checkController(); err != nil {
+			return err
+		}
+	}
+
 	if !o.NoVersionCheck && !o.Verbose {
 		return o.versionCheck()
 	}
@@ -97,6 +130,43 @@ func (o *VersionOptions) Run() error {
 	return nil
 }
 
+func (o *VersionOptions) outputJSON() error {
+	info := newVersionInfo()
+
+	var problem error
+	if o.Check {
+		controller, err := checkControllerVersion(o.Timeout, o.Verbose)
+		if err != nil {
+			return err
+		}
+		info.Controller = controller
+		if !controller.Compatible {
+			problem = cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "controller at %v isn't compatible: %v", controller.Url, controller.Problem)
+		}
+	}
+
+	output, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintln(o.Out, string(output)); err != nil {
+		return err
+	}
+	return problem
+}
+
+func (o *VersionOptions) checkController() error {
+	controller, err := checkControllerVersion(o.Timeout, o.Verbose)
+	if err != nil {
+		return err
+	}
+	if !controller.Compatible {
+		return cmdhelper.Errorf(cmdhelper.ExitCodeValidation, "controller at %v isn't compatible: %v", controller.Url, controller.Problem)
+	}
+	_, err = fmt.Fprintf(o.Out, "\nController at %v is version %v, which is compatible with this CLI\n", controller.Url, controller.Version)
+	return err
+}
+
 func (o *VersionOptions) getVersionFromZitiApp(zitiApp string, versionArg string) (string, error) {
 	if o.Verbose {
 		return o.getCommandOutput("", zitiApp, versionArg, "--verbose")
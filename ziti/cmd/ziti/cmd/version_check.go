@@ -0,0 +1,161 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver"
+
+	"github.com/openziti/ziti/common/version"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+)
+
+const (
+	// minControllerVersion is the oldest controller this CLI works with, the first to split the edge management API
+	// from the edge client API
+	minControllerVersion = "0.20.0"
+
+	// edgeManagementApiVersion is the version of the edge management API used by this CLI
+	edgeManagementApiVersion = "v1"
+)
+
+// versionInfo is the output of ziti version --json
+type versionInfo struct {
+	Version          string                  `json:"version"`
+	Revision         string                  `json:"revision"`
+	Branch           string                  `json:"branch"`
+	BuildDate        string                  `json:"buildDate"`
+	GoVersion        string                  `json:"goVersion"`
+	OS               string                  `json:"os"`
+	Arch             string                  `json:"arch"`
+	ApiCompatibility versionApiCompatibility `json:"apiCompatibility"`
+	Controller       *controllerVersionCheck `json:"controller,omitempty"`
+}
+
+// versionApiCompatibility is the range of controllers this CLI works with. Controllers from a later minor release than
+// the CLI may have changed APIs, so the CLI should be upgraded first. No maximum is given for development builds
+type versionApiCompatibility struct {
+	EdgeManagementApi    string `json:"edgeManagementApi"`
+	MinControllerVersion string `json:"minControllerVersion"`
+	MaxControllerVersion string `json:"maxControllerVersion,omitempty"`
+}
+
+// controllerVersionCheck is the result of checking the version of the controller the CLI is logged in to
+type controllerVersionCheck struct {
+	Url                string   `json:"url"`
+	Version            string   `json:"version"`
+	Revision           string   `json:"revision"`
+	BuildDate          string   `json:"buildDate"`
+	EdgeManagementApis []string `json:"edgeManagementApis"`
+	Compatible         bool     `json:"compatible"`
+	Problem            string   `json:"problem,omitempty"`
+}
+
+func newVersionInfo() *versionInfo {
+	return &versionInfo{
+		Version:   version.GetVersion(),
+		Revision:  version.GetRevision(),
+		Branch:    version.GetBranch(),
+		BuildDate: version.GetBuildDate(),
+		GoVersion: version.GetGoVersion(),
+		OS:        version.GetOS(),
+		Arch:      version.GetArchitecture(),
+		ApiCompatibility: versionApiCompatibility{
+			EdgeManagementApi:    edgeManagementApiVersion,
+			MinControllerVersion: minControllerVersion,
+			MaxControllerVersion: maxControllerVersion(version.GetVersion()),
+		},
+	}
+}
+
+// maxControllerVersion returns the latest controller release the given CLI version is compatible with, which is the
+// last patch release of the same minor release, or an empty string for development builds
+func maxControllerVersion(cliVersion string) string {
+	v, err := semver.ParseTolerant(cliVersion)
+	if err != nil || (v.Major == 0 && v.Minor == 0) {
+		return ""
+	}
+	return fmt.Sprintf("%v.%v.x", v.Major, v.Minor)
+}
+
+// checkControllerVersion fetches the version of the controller the CLI is logged in to and checks it against the
+// compatibility range of the CLI
+func checkControllerVersion(timeout int, verbose bool) (*controllerVersionCheck, error) {
+	identity, err := util.LoadSelectedIdentityForApi(util.EdgeAPI)
+	if err != nil {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "unable to check the controller version, log in with ziti edge login first: %v", err)
+	}
+
+	baseUrl, err := identity.GetBaseUrlForApi(util.EdgeAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := util.EdgeControllerList("version", nil, false, nil, timeout, verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &controllerVersionCheck{Url: baseUrl}
+	result.Version, _ = data.Path("data.version").Data().(string)
+	result.Revision, _ = data.Path("data.revision").Data().(string)
+	result.BuildDate, _ = data.Path("data.buildDate").Data().(string)
+	if apis, err := data.Path("data.apiVersions.edge-management").ChildrenMap(); err == nil {
+		for apiVersion := range apis {
+			result.EdgeManagementApis = append(result.EdgeManagementApis, apiVersion)
+		}
+		sort.Strings(result.EdgeManagementApis)
+	}
+
+	result.Compatible, result.Problem = controllerCompatibility(version.GetVersion(), result.Version, result.EdgeManagementApis)
+	return result, nil
+}
+
+// controllerCompatibility checks whether a controller of the given version, serving the given edge management API
+// versions, may be managed by the given version of the CLI, returning the problem if not
+func controllerCompatibility(cliVersion, controllerVersion string, edgeManagementApis []string) (bool, string) {
+	controller, err := semver.ParseTolerant(controllerVersion)
+	if err != nil {
+		return false, fmt.Sprintf("unable to parse controller version %q", controllerVersion)
+	}
+
+	if controller.LT(semver.MustParse(minControllerVersion)) {
+		return false, fmt.Sprintf("controller version %v is older than %v, the oldest supported by this CLI", controllerVersion, minControllerVersion)
+	}
+
+	supported := false
+	for _, api := range edgeManagementApis {
+		if api == edgeManagementApiVersion {
+			supported = true
+		}
+	}
+	if !supported {
+		return false, fmt.Sprintf("controller doesn't serve version %v of the edge management API used by this CLI", edgeManagementApiVersion)
+	}
+
+	if maxControllerVersion(cliVersion) != "" {
+		cli, _ := semver.ParseTolerant(cliVersion)
+		if controller.Major > cli.Major || (controller.Major == cli.Major && controller.Minor > cli.Minor) {
+			return false, fmt.Sprintf("controller version %v is newer than this CLI (%v), upgrade the CLI with ziti upgrade ziti", controllerVersion, cliVersion)
+		}
+	}
+
+	return true, ""
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxControllerVersion(t *testing.T) {
+	req := require.New(t)
+	req.Equal("0.26.x", maxControllerVersion("v0.26.3"))
+	req.Equal("1.2.x", maxControllerVersion("1.2.0"))
+	req.Equal("", maxControllerVersion("v0.0.0"))
+	req.Equal("", maxControllerVersion("dev"))
+}
+
+func TestControllerCompatibility(t *testing.T) {
+	req := require.New(t)
+	v1 := []string{"v1"}
+
+	ok, problem := controllerCompatibility("v0.26.3", "v0.26.1", v1)
+	req.True(ok)
+	req.Empty(problem)
+
+	ok, _ = controllerCompatibility("v0.26.3", "v0.21.0", v1)
+	req.True(ok)
+
+	ok, problem = controllerCompatibility("v0.26.3", "v0.19.12", v1)
+	req.False(ok)
+	req.Contains(problem, "older than")
+
+	ok, problem = controllerCompatibility("v0.26.3", "v0.27.0", v1)
+	req.False(ok)
+	req.Contains(problem, "newer than this CLI")
+
+	ok, _ = controllerCompatibility("v0.0.0", "v0.27.0", v1)
+	req.True(ok, "development builds don't have a maximum controller version")
+
+	ok, problem = controllerCompatibility("v0.26.3", "v0.26.3", []string{"v2"})
+	req.False(ok)
+	req.Contains(problem, "edge management API")
+
+	ok, problem = controllerCompatibility("v0.26.3", "unknown", v1)
+	req.False(ok)
+	req.Contains(problem, "unable to parse")
+}
@@ -0,0 +1,349 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package fakecontroller provides a fake of the controller's edge management and fabric APIs, for testing the CLI
+// commands which use them
+package fakecontroller
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// apiPrefixes are the base paths of the APIs served. Entities are shared between the APIs
+var apiPrefixes = []string{"/edge/management/v1/", "/fabric/v1/"}
+
+// Run logs the CLI in to the controller, serving it over TLS, and runs the tests. The CLI caches the login it loads, so
+// one controller is shared by all tests of a package, each resetting it first. It returns the exit code of the tests
+func Run(m *testing.M, controller *Controller) int {
+	home, err := ioutil.TempDir("", "ziti-cli-test")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = os.RemoveAll(home) }()
+
+	server := httptest.NewTLSServer(controller)
+	defer server.Close()
+
+	caCert := filepath.Join(home, "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err = ioutil.WriteFile(caCert, caPem, 0600); err != nil {
+		panic(err)
+	}
+
+	config := map[string]interface{}{
+		"edgeIdentities": map[string]interface{}{
+			"default": map[string]interface{}{
+				"url":      server.URL + "/edge/management/v1",
+				"username": "admin",
+				"token":    "test-token",
+				"caCert":   caCert,
+			},
+		},
+		"default": "default",
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		panic(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(home, "ziti-cli.json"), data, 0600); err != nil {
+		panic(err)
+	}
+	if err = os.Setenv("ZITI_HOME", home); err != nil {
+		panic(err)
+	}
+	return m.Run()
+}
+
+// Controller keeps entities by type and serves lists, details, creates, updates and deletes of them. Lists of related
+// entities are served for types such as identities/<id>/services. Lists support the limit and skip clauses, true,
+// filters comparing fields to strings with = joined by or, and a field in a list of strings. Other filters can be
+// handled by setting Match
+type Controller struct {
+	sync.Mutex
+	entities map[string][]map[string]interface{}
+	requests []string
+	nextId   int
+
+	// Match decides whether an entity matches the predicate of a list filter which isn't understood by the fake
+	Match func(entityType, predicate string, entity map[string]interface{}) bool
+
+	// Created is called with each entity created, before its id is returned, to fill in fields set by the controller
+	Created func(entityType string, entity map[string]interface{})
+
+	// Fail makes requests, given as "METHOD type", "METHOD type/id" or "METHOD type/action", fail with the given status
+	Fail map[string]int
+
+	// Details is data served for GETs of paths which aren't entities, such as identities/<id>/posture-data
+	Details map[string]interface{}
+}
+
+// Reset clears the fake, and seeds it with the given entities by type. Entities get an id if they have none
+func (self *Controller) Reset(t *testing.T, entities map[string][]map[string]interface{}) {
+	self.Lock()
+	defer self.Unlock()
+	self.entities = map[string][]map[string]interface{}{}
+	self.requests = nil
+	self.nextId = 0
+	self.Match = nil
+	self.Created = nil
+	self.Fail = map[string]int{}
+	self.Details = map[string]interface{}{}
+	for entityType, list := range entities {
+		for _, entity := range list {
+			self.add(entityType, entity)
+		}
+	}
+	t.Cleanup(func() {
+		self.Lock()
+		defer self.Unlock()
+		self.entities = nil
+	})
+}
+
+func (self *Controller) add(entityType string, entity map[string]interface{}) string {
+	id, _ := entity["id"].(string)
+	if id == "" {
+		self.nextId++
+		id = fmt.Sprintf("%v-%v", entityType, self.nextId)
+		entity["id"] = id
+	}
+	self.entities[entityType] = append(self.entities[entityType], entity)
+	return id
+}
+
+// List returns the entities of the type currently held
+func (self *Controller) List(entityType string) []map[string]interface{} {
+	self.Lock()
+	defer self.Unlock()
+	return append([]map[string]interface{}(nil), self.entities[entityType]...)
+}
+
+// Requested returns the requests made, as "METHOD path", with the filter for lists. Paths are relative to the API
+func (self *Controller) Requested() []string {
+	self.Lock()
+	defer self.Unlock()
+	return append([]string(nil), self.requests...)
+}
+
+func (self *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.Lock()
+	defer self.Unlock()
+
+	path := r.URL.Path
+	for _, prefix := range apiPrefixes {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	parts := strings.Split(path, "/")
+	entityType := parts[0]
+
+	request := r.Method + " " + path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.Query().Get("filter")
+	}
+	self.requests = append(self.requests, request)
+
+	action := entityType
+	if len(parts) == 3 {
+		action += "/" + parts[2]
+	}
+	status, found := self.Fail[r.Method+" "+action]
+	if !found {
+		status, found = self.Fail[r.Method+" "+path]
+	}
+	if found {
+		WriteResponse(w, status, map[string]interface{}{"error": map[string]interface{}{"code": "FAKE_FAILURE", "message": "failed by the test"}})
+		return
+	}
+
+	if data, found := self.Details[path]; found && r.Method == http.MethodGet {
+		WriteResponse(w, http.StatusOK, map[string]interface{}{"data": data})
+		return
+	}
+
+	_, isRelatedList := self.entities[path]
+	switch {
+	case r.Method == http.MethodGet && (len(parts) == 1 || isRelatedList):
+		self.serveList(w, path, r.URL.Query().Get("filter"))
+	case r.Method == http.MethodGet && len(parts) == 2:
+		if entity := self.find(entityType, parts[1]); entity != nil {
+			WriteResponse(w, http.StatusOK, map[string]interface{}{"data": entity})
+		} else {
+			WriteResponse(w, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"code": "NOT_FOUND"}})
+		}
+	case r.Method == http.MethodPost && len(parts) == 1:
+		entity := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&entity); err != nil {
+			WriteResponse(w, http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"code": "COULD_NOT_PARSE_BODY"}})
+			return
+		}
+		delete(entity, "id")
+		id := self.add(entityType, entity)
+		if self.Created != nil {
+			self.Created(entityType, entity)
+		}
+		WriteResponse(w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{"id": id}})
+	case (r.Method == http.MethodPatch || r.Method == http.MethodPut) && len(parts) == 2:
+		entity := self.find(entityType, parts[1])
+		if entity == nil {
+			WriteResponse(w, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"code": "NOT_FOUND"}})
+			return
+		}
+		changes := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			WriteResponse(w, http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"code": "COULD_NOT_PARSE_BODY"}})
+			return
+		}
+		for key, val := range changes {
+			entity[key] = val
+		}
+		WriteResponse(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{}})
+	case r.Method == http.MethodDelete && len(parts) == 2:
+		list := self.entities[entityType]
+		for idx, entity := range list {
+			if entity["id"] == parts[1] {
+				self.entities[entityType] = append(list[:idx:idx], list[idx+1:]...)
+				WriteResponse(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{}})
+				return
+			}
+		}
+		WriteResponse(w, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"code": "NOT_FOUND"}})
+	default:
+		WriteResponse(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{}})
+	}
+}
+
+func (self *Controller) find(entityType, id string) map[string]interface{} {
+	for _, entity := range self.entities[entityType] {
+		if entity["id"] == id {
+			return entity
+		}
+	}
+	return nil
+}
+
+var (
+	limitRegex  = regexp.MustCompile(`(?i)\s*\blimit\s+(\d+|none)\b`)
+	skipRegex   = regexp.MustCompile(`(?i)\s*\bskip\s+(\d+)\b`)
+	sortRegex   = regexp.MustCompile(`(?i)\s*\bsort\s+by\s+.*$`)
+	equalsRegex = regexp.MustCompile(`^\s*(\w+)\s*=\s*"((?:[^"\\]|\\.)*)"\s*$`)
+	inRegex     = regexp.MustCompile(`^\s*(\w+)\s+in\s+\[(.*)\]\s*$`)
+	stringRegex = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+)
+
+func (self *Controller) serveList(w http.ResponseWriter, entityType, filter string) {
+	limit, offset := 10, 0
+	if match := limitRegex.FindStringSubmatch(filter); match != nil {
+		if strings.EqualFold(match[1], "none") {
+			limit = -1
+		} else {
+			limit, _ = strconv.Atoi(match[1])
+		}
+	}
+	if match := skipRegex.FindStringSubmatch(filter); match != nil {
+		offset, _ = strconv.Atoi(match[1])
+	}
+	predicate := limitRegex.ReplaceAllString(filter, "")
+	predicate = skipRegex.ReplaceAllString(predicate, "")
+	predicate = strings.TrimSpace(sortRegex.ReplaceAllString(predicate, ""))
+
+	var matched []map[string]interface{}
+	for _, entity := range self.entities[entityType] {
+		if self.matches(entityType, predicate, entity) {
+			matched = append(matched, entity)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return fmt.Sprint(matched[i]["id"]) < fmt.Sprint(matched[j]["id"])
+	})
+
+	total := len(matched)
+	page := []map[string]interface{}{}
+	for idx := offset; idx < total && (limit < 0 || idx < offset+limit); idx++ {
+		page = append(page, matched[idx])
+	}
+	if limit < 0 {
+		limit = total
+	}
+	WriteResponse(w, http.StatusOK, map[string]interface{}{
+		"data": page,
+		"meta": map[string]interface{}{
+			"pagination": map[string]interface{}{"limit": limit, "offset": offset, "totalCount": total},
+		},
+	})
+}
+
+func (self *Controller) matches(entityType, predicate string, entity map[string]interface{}) bool {
+	if predicate == "" || strings.EqualFold(predicate, "true") {
+		return true
+	}
+	if match := inRegex.FindStringSubmatch(predicate); match != nil {
+		for _, quoted := range stringRegex.FindAllStringSubmatch(match[2], -1) {
+			val, err := strconv.Unquote(`"` + quoted[1] + `"`)
+			if err != nil {
+				panic(err)
+			}
+			if fieldValue(entity, match[1]) == val {
+				return true
+			}
+		}
+		return false
+	}
+	for _, term := range strings.Split(predicate, " or ") {
+		match := equalsRegex.FindStringSubmatch(term)
+		if match == nil {
+			if self.Match != nil {
+				return self.Match(entityType, predicate, entity)
+			}
+			panic(fmt.Sprintf("fake controller doesn't understand filter %v", predicate))
+		}
+		val, err := strconv.Unquote(`"` + match[2] + `"`)
+		if err != nil {
+			panic(err)
+		}
+		if fieldValue(entity, match[1]) == val {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValue returns the field of the entity as compared by filters. References to other entities compare by id
+func fieldValue(entity map[string]interface{}, field string) string {
+	if ref, ok := entity[field].(map[string]interface{}); ok {
+		return fmt.Sprint(ref["id"])
+	}
+	return fmt.Sprint(entity[field])
+}
+
+// WriteResponse writes the body as a JSON response with the given status
+func WriteResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
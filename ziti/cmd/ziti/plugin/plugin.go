@@ -0,0 +1,100 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package plugin provides helpers for ziti CLI plugins. Plugins are executables named ziti-<name>
+// found on the PATH, which the ziti CLI runs when invoked as 'ziti <name>'. Plugins written in Go can
+// use this package to share the CLI's saved logins rather than implementing their own authentication.
+package plugin
+
+import (
+	"io"
+	"os"
+
+	"github.com/openziti/edge/rest_management_api_client"
+	fabric_rest_client "github.com/openziti/fabric/rest_client"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/api"
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+)
+
+const (
+	// BinaryPrefix is the prefix executables must have to be picked up as ziti plugins
+	BinaryPrefix = "ziti-"
+
+	// EnvZitiBinary is set by the ziti CLI to the path of the ziti executable which launched the plugin
+	EnvZitiBinary = "ZITI_CLI_BINARY"
+
+	// EnvCliIdentity may be set to select which saved login a plugin should use. If not set, the
+	// default login is used
+	EnvCliIdentity = "ZITI_CLI_IDENTITY"
+)
+
+// Context gives plugins access to the ziti CLI's saved logins
+type Context struct {
+	api.Options
+	identity string
+}
+
+// NewContext returns a plugin context writing to the given outputs
+func NewContext(out, errOut io.Writer) *Context {
+	return &Context{
+		Options: api.Options{
+			CommonOptions: common.CommonOptions{
+				Out:     out,
+				Err:     errOut,
+				Timeout: 5,
+			},
+		},
+	}
+}
+
+// SetIdentity selects the saved login this context uses. Takes precedence over the ZITI_CLI_IDENTITY environment
+// variable
+func (self *Context) SetIdentity(identity string) {
+	self.identity = identity
+}
+
+// LoadIdentity returns the saved login selected for this context
+func (self *Context) LoadIdentity() (util.RestClientIdentity, error) {
+	identity := self.identity
+	if identity == "" {
+		identity = os.Getenv(EnvCliIdentity)
+	}
+	return util.LoadIdentity(identity)
+}
+
+// NewEdgeManagementClient returns an edge management API client authenticated with the selected login
+func (self *Context) NewEdgeManagementClient() (*rest_management_api_client.ZitiEdgeManagement, error) {
+	restClientIdentity, err := self.LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return restClientIdentity.NewEdgeManagementClient(self)
+}
+
+// NewFabricManagementClient returns a fabric management API client authenticated with the selected login
+func (self *Context) NewFabricManagementClient() (*fabric_rest_client.ZitiFabric, error) {
+	restClientIdentity, err := self.LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return restClientIdentity.NewFabricManagementClient(self)
+}
+
+// ZitiBinary returns the path to the ziti executable which launched the plugin, if known
+func (self *Context) ZitiBinary() string {
+	return os.Getenv(EnvZitiBinary)
+}
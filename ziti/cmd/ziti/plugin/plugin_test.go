@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/openziti/ziti/ziti/cmd/ziti/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextIdentity(t *testing.T) {
+	req := require.New(t)
+
+	home := t.TempDir()
+	config := map[string]interface{}{
+		"edgeIdentities": map[string]interface{}{
+			"default": map[string]interface{}{"url": "https://default:1280/edge/management/v1"},
+			"prod":    map[string]interface{}{"url": "https://prod:1280/edge/management/v1"},
+			"staging": map[string]interface{}{"url": "https://staging:1280/edge/management/v1"},
+		},
+		"default": "default",
+	}
+	data, err := json.Marshal(config)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(filepath.Join(home, "ziti-cli.json"), data, 0600))
+	t.Setenv("ZITI_HOME", home)
+	t.Setenv(EnvCliIdentity, "")
+
+	loadUrl := func(ctx *Context) string {
+		identity, err := ctx.LoadIdentity()
+		req.NoError(err)
+		return identity.(*util.RestClientEdgeIdentity).Url
+	}
+
+	prod := NewContext(&bytes.Buffer{}, &bytes.Buffer{})
+	prod.SetIdentity("prod")
+	staging := NewContext(&bytes.Buffer{}, &bytes.Buffer{})
+	staging.SetIdentity("staging")
+	unset := NewContext(&bytes.Buffer{}, &bytes.Buffer{})
+
+	req.Equal("https://prod:1280/edge/management/v1", loadUrl(prod))
+	req.Equal("https://staging:1280/edge/management/v1", loadUrl(staging))
+	req.Equal("https://default:1280/edge/management/v1", loadUrl(unset))
+	req.Empty(common.CliIdentity, "the login selected for the CLI is left alone")
+
+	t.Setenv(EnvCliIdentity, "staging")
+	req.Equal("https://staging:1280/edge/management/v1", loadUrl(unset))
+	req.Equal("https://prod:1280/edge/management/v1", loadUrl(prod), "the context's login takes precedence")
+
+	missing := NewContext(&bytes.Buffer{}, &bytes.Buffer{})
+	missing.SetIdentity("missing")
+	_, err = missing.LoadIdentity()
+	req.Error(err)
+	req.Contains(err.Error(), "no identity 'missing'")
+}
@@ -0,0 +1,210 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+)
+
+// Cached responses are stored per login, in a directory per session, so that logging in again, or as someone else
+// under the same login name, never serves responses fetched with other credentials. Each file is named for the entity
+// types in the path of its url, so that a change to an entity type only drops the responses which may include it.
+
+// responseCacheDir returns the directory cached responses for the session of the given login are stored in
+func responseCacheDir(identity RestClientIdentity) (string, error) {
+	cfgDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	name := common.CliIdentity
+	if name == "" {
+		config, _, err := LoadRestClientConfig()
+		if err != nil {
+			return "", err
+		}
+		name = config.GetIdentity()
+	}
+
+	return filepath.Join(cfgDir, "cache", name, responseCacheSession(identity)), nil
+}
+
+// responseCacheSession identifies the controller and the credentials a login uses
+func responseCacheSession(identity RestClientIdentity) string {
+	var session string
+	switch id := identity.(type) {
+	case *RestClientEdgeIdentity:
+		session = id.Url + "\n" + id.Token
+	case *RestClientFabricIdentity:
+		session = id.Url + "\n" + id.ClientCert
+	}
+	hash := sha256.Sum256([]byte(session))
+	return hex.EncodeToString(hash[:16])
+}
+
+// responseCacheEntityTypes returns the entity types in the path of the url, so for
+// https://ctrl:1280/edge/management/v1/services/abc/configs, services and configs
+func responseCacheEntityTypes(queryUrl string) []string {
+	path := queryUrl
+	if parsed, err := url.Parse(queryUrl); err == nil {
+		path = parsed.Path
+	}
+	if idx := strings.Index(path, "/v1/"); idx >= 0 {
+		path = path[idx+len("/v1/"):]
+	}
+
+	var result []string
+	for idx, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if idx%2 == 0 && segment != "" {
+			result = append(result, segment)
+		}
+	}
+	return result
+}
+
+func responseCacheFile(identity RestClientIdentity, queryUrl string) (string, error) {
+	dir, err := responseCacheDir(identity)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(queryUrl))
+	name := strings.Join(responseCacheEntityTypes(queryUrl), "+") + "_" + hex.EncodeToString(hash[:]) + ".json"
+	return filepath.Join(dir, name), nil
+}
+
+// readCachedResponse returns the cached response body for the given url, if caching is enabled and the
+// cached response is younger than the configured TTL. Returns nil otherwise
+func readCachedResponse(identity RestClientIdentity, queryUrl string) []byte {
+	if common.CacheTTL <= 0 || common.NoCache {
+		return nil
+	}
+
+	file, err := responseCacheFile(identity, queryUrl)
+	if err != nil {
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > common.CacheTTL {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// writeCachedResponse stores the response body for the given url, if caching is enabled. The responses of earlier
+// sessions of the login are removed. Failures are ignored, as the cache is only an optimization
+func writeCachedResponse(identity RestClientIdentity, queryUrl string, body []byte) {
+	if common.CacheTTL <= 0 || common.NoCache {
+		return
+	}
+
+	file, err := responseCacheFile(identity, queryUrl)
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(file)
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		sessions, _ := ioutil.ReadDir(filepath.Dir(dir))
+		for _, session := range sessions {
+			_ = os.RemoveAll(filepath.Join(filepath.Dir(dir), session.Name()))
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(file, body, 0600)
+}
+
+// newCachedHTTPResponse returns a response to the request holding the cached body, for the generated REST clients
+func newCachedHTTPResponse(r *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// cacheHTTPResponse stores the body of a response received by the generated REST clients, if caching is enabled,
+// leaving the body to be read again
+func cacheHTTPResponse(identity RestClientIdentity, r *http.Request, resp *http.Response) error {
+	if common.CacheTTL <= 0 || common.NoCache || resp.Body == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	writeCachedResponse(identity, r.URL.String(), body)
+	return nil
+}
+
+// invalidateCachedResponses removes the cached responses which may be changed by a modifying request to the url:
+// those listing or detailing its entity type, and all lists of related entities, as the relations of any entity may
+// depend on others, such as the services of an identity on service policies. Called after any modifying operation,
+// so subsequent reads don't return stale data
+func invalidateCachedResponses(identity RestClientIdentity, requestUrl string) {
+	types := responseCacheEntityTypes(requestUrl)
+	if len(types) == 0 {
+		return
+	}
+
+	dir, err := responseCacheDir(identity)
+	if err != nil {
+		return
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		idx := strings.LastIndex(file.Name(), "_")
+		if idx < 0 {
+			continue
+		}
+		cachedTypes := strings.Split(file.Name()[:idx], "+")
+		if cachedTypes[0] == types[0] || len(cachedTypes) > 1 {
+			_ = os.Remove(filepath.Join(dir, file.Name()))
+		}
+	}
+}
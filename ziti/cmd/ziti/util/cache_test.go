@@ -0,0 +1,149 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	req := require.New(t)
+
+	t.Setenv("ZITI_HOME", t.TempDir())
+	common.CliIdentity = "test"
+	defer func() {
+		common.CliIdentity = ""
+		common.CacheTTL = 0
+		common.NoCache = false
+	}()
+
+	login := &RestClientEdgeIdentity{Url: "https://localhost:1280/edge/management/v1", Token: "token1"}
+	queryUrl := "https://localhost:1280/edge/management/v1/services?filter=true"
+	body := []byte(`{"data":[]}`)
+
+	writeCachedResponse(login, queryUrl, body)
+	req.Nil(readCachedResponse(login, queryUrl), "caching is disabled by default")
+
+	common.CacheTTL = 30 * time.Second
+	writeCachedResponse(login, queryUrl, body)
+	req.Equal(body, readCachedResponse(login, queryUrl))
+	req.Nil(readCachedResponse(login, queryUrl+"&limit=5"))
+
+	common.NoCache = true
+	req.Nil(readCachedResponse(login, queryUrl))
+	common.NoCache = false
+
+	// other sessions and controllers don't see the response, and a new session drops those of the old one
+	relogin := &RestClientEdgeIdentity{Url: login.Url, Token: "token2"}
+	req.Nil(readCachedResponse(relogin, queryUrl))
+	req.Nil(readCachedResponse(&RestClientEdgeIdentity{Url: "https://other:1280/edge/management/v1", Token: "token1"}, queryUrl))
+	writeCachedResponse(relogin, queryUrl, body)
+	req.Equal(body, readCachedResponse(relogin, queryUrl))
+	req.Nil(readCachedResponse(login, queryUrl))
+}
+
+func TestInvalidateCachedResponses(t *testing.T) {
+	req := require.New(t)
+
+	t.Setenv("ZITI_HOME", t.TempDir())
+	common.CliIdentity = "test"
+	common.CacheTTL = 30 * time.Second
+	defer func() {
+		common.CliIdentity = ""
+		common.CacheTTL = 0
+	}()
+
+	login := &RestClientEdgeIdentity{Url: "https://localhost:1280/edge/management/v1", Token: "token"}
+	base := "https://localhost:1280/edge/management/v1/"
+	urls := []string{
+		base + "services?filter=true",
+		base + "services/svc1",
+		base + "identities?filter=true",
+		base + "identities/id1/services",
+		"https://localhost:1280/fabric/v1/routers",
+	}
+	for _, queryUrl := range urls {
+		writeCachedResponse(login, queryUrl, []byte(`{}`))
+	}
+
+	req.Equal([]string{"identities", "services"}, responseCacheEntityTypes(base+"identities/id1/services?limit=5"))
+
+	invalidateCachedResponses(login, base+"services/svc1")
+	req.Nil(readCachedResponse(login, urls[0]))
+	req.Nil(readCachedResponse(login, urls[1]))
+	req.NotNil(readCachedResponse(login, urls[2]), "lists of other types are kept")
+	req.Nil(readCachedResponse(login, urls[3]), "lists of related entities are dropped")
+	req.NotNil(readCachedResponse(login, urls[4]))
+
+	invalidateCachedResponses(login, "https://localhost:1280/fabric/v1/routers/r1")
+	req.Nil(readCachedResponse(login, urls[4]))
+	req.NotNil(readCachedResponse(login, urls[2]))
+}
+
+type jsonClientOpts struct {
+	out *bytes.Buffer
+}
+
+func (jsonClientOpts) OutputRequestJson() bool         { return false }
+func (jsonClientOpts) OutputResponseJson() bool        { return true }
+func (self jsonClientOpts) OutputWriter() io.Writer    { return self.out }
+func (self jsonClientOpts) ErrOutputWriter() io.Writer { return self.out }
+
+func TestEdgeTransportCachesAndPrintsResponses(t *testing.T) {
+	req := require.New(t)
+
+	t.Setenv("ZITI_HOME", t.TempDir())
+	common.CliIdentity = "test"
+	common.CacheTTL = 30 * time.Second
+	defer func() {
+		common.CliIdentity = ""
+		common.CacheTTL = 0
+	}()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":[{"id":"svc1"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	client := &http.Client{Transport: &edgeTransport{
+		Transport:    &http.Transport{},
+		Identity:     &RestClientEdgeIdentity{Url: server.URL, Token: "token"},
+		ResponseFunc: newRestClientResponseF(jsonClientOpts{out: out}),
+	}}
+
+	get := func() string {
+		resp, err := client.Get(server.URL + "/edge/management/v1/services?filter=true")
+		req.NoError(err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := ioutil.ReadAll(resp.Body)
+		req.NoError(err)
+		return string(body)
+	}
+
+	// the body printed for -j is still there to be decoded, and the second request is answered from the cache
+	req.Equal(`{"data":[{"id":"svc1"}]}`, get())
+	req.Equal(`{"data":[{"id":"svc1"}]}`, get())
+	req.Equal(int32(1), atomic.LoadInt32(&requests))
+	req.Equal(2, strings.Count(out.String(), `{"data":[{"id":"svc1"}]}`))
+
+	// a change to the entity type drops the cached response
+	resp, err := client.Post(server.URL+"/edge/management/v1/services", "application/json", strings.NewReader(`{}`))
+	req.NoError(err)
+	_ = resp.Body.Close()
+	get()
+	req.Equal(int32(3), atomic.LoadInt32(&requests))
+}
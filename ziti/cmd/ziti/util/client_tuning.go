@@ -0,0 +1,237 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"gopkg.in/resty.v1"
+)
+
+var tlsSessionCache = struct {
+	sync.Mutex
+	cache tls.ClientSessionCache
+}{}
+
+// newHttpTransport returns the transport used by the REST clients, tuned by the client flags
+func newHttpTransport() *http.Transport {
+	enableClientStats()
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 10 * time.Second,
+		}).DialContext,
+
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          common.MaxIdleConns,
+		MaxIdleConnsPerHost:   common.MaxIdleConns,
+		IdleConnTimeout:       common.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       withTLSSessionCache(&tls.Config{}),
+	}
+}
+
+var httpTransports = struct {
+	sync.Mutex
+	transports map[string]*http.Transport
+}{
+	transports: map[string]*http.Transport{},
+}
+
+// sharedHttpTransport returns the transport for the controller and credentials identified by key, creating it with the
+// TLS config returned by newTLSConfig on first use. Clients for the same login share the transport, so connections and
+// TLS sessions are reused across requests, rather than each request dialing the controller
+func sharedHttpTransport(key string, newTLSConfig func() (*tls.Config, error)) (*http.Transport, error) {
+	httpTransports.Lock()
+	defer httpTransports.Unlock()
+	if transport, found := httpTransports.transports[key]; found {
+		return transport, nil
+	}
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := newHttpTransport()
+	transport.TLSClientConfig = withTLSSessionCache(tlsConfig)
+	httpTransports.transports[key] = transport
+	return transport, nil
+}
+
+// withTLSSessionCache returns a copy of the TLS config using the shared TLS session cache, if it's enabled
+func withTLSSessionCache(config *tls.Config) *tls.Config {
+	if config == nil || common.TLSSessionCacheSize <= 0 {
+		return config
+	}
+	tlsSessionCache.Lock()
+	defer tlsSessionCache.Unlock()
+	if tlsSessionCache.cache == nil {
+		tlsSessionCache.cache = tls.NewLRUClientSessionCache(common.TLSSessionCacheSize)
+	}
+	result := config.Clone()
+	result.ClientSessionCache = tlsSessionCache.cache
+	return result
+}
+
+// setClientTLSConfig sets the TLS config of a resty client, keeping the TLS session cache
+func setClientTLSConfig(client *resty.Client, config *tls.Config) *resty.Client {
+	return client.SetTLSClientConfig(withTLSSessionCache(config))
+}
+
+type clientStatsContextKey struct{}
+
+type requestStats struct {
+	start time.Time
+}
+
+// clientStats are the totals reported by --client-stats
+var clientStats = struct {
+	sync.Mutex
+	enabled        sync.Once
+	requests       int
+	failures       int
+	newConns       int
+	reusedConns    int
+	tlsHandshakes  int
+	tlsResumed     int
+	totalTime      time.Duration
+	maxTime        time.Duration
+	statusCounts   map[int]int
+	requestsByPath map[string]int
+}{
+	statusCounts:   map[int]int{},
+	requestsByPath: map[string]int{},
+}
+
+// enableClientStats starts collecting client stats if --client-stats was given, reporting them on exit
+func enableClientStats() {
+	if !common.ClientStats {
+		return
+	}
+	clientStats.enabled.Do(func() {
+		AddRequestMutator(traceRequest)
+		AddResponseObserver(recordResponse)
+		cmdhelper.AddExitHook(func() {
+			_, _ = fmt.Fprint(os.Stderr, ClientStatsSummary())
+		})
+	})
+}
+
+// traceRequest tracks the connection used by the request and when it started
+func traceRequest(request *http.Request) error {
+	if request.Context().Value(clientStatsContextKey{}) != nil {
+		return nil
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			clientStats.Lock()
+			defer clientStats.Unlock()
+			if info.Reused {
+				clientStats.reusedConns++
+			} else {
+				clientStats.newConns++
+			}
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			clientStats.Lock()
+			defer clientStats.Unlock()
+			if err == nil {
+				clientStats.tlsHandshakes++
+				if state.DidResume {
+					clientStats.tlsResumed++
+				}
+			}
+		},
+	}
+	ctx := context.WithValue(request.Context(), clientStatsContextKey{}, &requestStats{start: time.Now()})
+	*request = *request.WithContext(httptrace.WithClientTrace(ctx, trace))
+	return nil
+}
+
+// recordResponse adds the outcome and duration of a request to the totals
+func recordResponse(request *http.Request, response *http.Response, err error) {
+	clientStats.Lock()
+	defer clientStats.Unlock()
+	clientStats.requests++
+	if err != nil || response == nil {
+		clientStats.failures++
+	} else {
+		clientStats.statusCounts[response.StatusCode]++
+	}
+	if request != nil {
+		clientStats.requestsByPath[request.Method+" "+request.URL.Path]++
+		if stats, ok := request.Context().Value(clientStatsContextKey{}).(*requestStats); ok {
+			elapsed := time.Since(stats.start)
+			clientStats.totalTime += elapsed
+			if elapsed > clientStats.maxTime {
+				clientStats.maxTime = elapsed
+			}
+		}
+	}
+}
+
+// ClientStatsSummary returns a summary of the requests made and connections used by the REST clients
+func ClientStatsSummary() string {
+	clientStats.Lock()
+	defer clientStats.Unlock()
+
+	b := &strings.Builder{}
+	_, _ = fmt.Fprintf(b, "\nclient stats: %v requests, %v failed\n", clientStats.requests, clientStats.failures)
+	if clientStats.requests > 0 {
+		avg := clientStats.totalTime / time.Duration(clientStats.requests)
+		_, _ = fmt.Fprintf(b, "  latency: avg %v, max %v\n", avg.Round(time.Millisecond), clientStats.maxTime.Round(time.Millisecond))
+	}
+	_, _ = fmt.Fprintf(b, "  connections: %v new, %v reused\n", clientStats.newConns, clientStats.reusedConns)
+	_, _ = fmt.Fprintf(b, "  tls handshakes: %v, %v resumed\n", clientStats.tlsHandshakes, clientStats.tlsResumed)
+
+	var statuses []int
+	for status := range clientStats.statusCounts {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		_, _ = fmt.Fprintf(b, "  status %v: %v\n", status, clientStats.statusCounts[status])
+	}
+
+	var paths []string
+	for path := range clientStats.requestsByPath {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return clientStats.requestsByPath[paths[i]] > clientStats.requestsByPath[paths[j]]
+	})
+	if len(paths) > 5 {
+		paths = paths[:5]
+	}
+	for _, path := range paths {
+		_, _ = fmt.Fprintf(b, "  %v: %v\n", path, clientStats.requestsByPath[path])
+	}
+	return b.String()
+}
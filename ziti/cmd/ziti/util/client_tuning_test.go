@@ -0,0 +1,123 @@
+package util
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpTransportTuning(t *testing.T) {
+	req := require.New(t)
+
+	defer func() {
+		common.MaxIdleConns = 10
+		common.IdleConnTimeout = 10 * time.Second
+		common.TLSSessionCacheSize = 0
+	}()
+
+	transport := newHttpTransport()
+	req.Equal(10, transport.MaxIdleConns)
+	req.Nil(transport.TLSClientConfig.ClientSessionCache, "the session cache is disabled by default")
+
+	common.MaxIdleConns = 50
+	common.IdleConnTimeout = time.Minute
+	common.TLSSessionCacheSize = 32
+
+	transport = newHttpTransport()
+	req.Equal(50, transport.MaxIdleConns)
+	req.Equal(50, transport.MaxIdleConnsPerHost)
+	req.Equal(time.Minute, transport.IdleConnTimeout)
+
+	config := &tls.Config{ServerName: "ctrl"}
+	cached := withTLSSessionCache(config)
+	req.NotNil(cached.ClientSessionCache)
+	req.Nil(config.ClientSessionCache, "the original config is left unchanged")
+	req.Equal("ctrl", cached.ServerName)
+	req.Same(cached.ClientSessionCache, transport.TLSClientConfig.ClientSessionCache, "the session cache is shared")
+}
+
+func TestClientStatsSummary(t *testing.T) {
+	req := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newHttpTransport()}
+	for i := 0; i < 3; i++ {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/services", nil)
+		req.NoError(err)
+		req.NoError(traceRequest(request))
+		response, err := client.Do(request)
+		req.NoError(err)
+		_ = response.Body.Close()
+		recordResponse(request, response, nil)
+	}
+	recordResponse(nil, nil, http.ErrHandlerTimeout)
+
+	summary := ClientStatsSummary()
+	req.Contains(summary, "4 requests, 1 failed")
+	req.Contains(summary, "1 new, 2 reused")
+	req.Contains(summary, "status 404: 3")
+	req.Contains(summary, "GET /services: 3")
+}
+
+type testClientOpts struct{}
+
+func (testClientOpts) OutputRequestJson() bool    { return false }
+func (testClientOpts) OutputResponseJson() bool   { return false }
+func (testClientOpts) OutputWriter() io.Writer    { return ioutil.Discard }
+func (testClientOpts) ErrOutputWriter() io.Writer { return ioutil.Discard }
+
+func TestHttpTransportSharedByLogin(t *testing.T) {
+	req := require.New(t)
+
+	var newConns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	login := &RestClientEdgeIdentity{Url: server.URL}
+	for i := 0; i < 3; i++ {
+		client, err := login.NewClient(time.Second, false)
+		req.NoError(err)
+		resp, err := login.NewRequest(client).Get(server.URL + "/services")
+		req.NoError(err)
+		req.Equal(http.StatusOK, resp.StatusCode())
+	}
+
+	httpClient, err := newRestClientTransport(&testClientOpts{}, login)
+	req.NoError(err)
+	resp, err := httpClient.Get(server.URL + "/identities")
+	req.NoError(err)
+	_ = resp.Body.Close()
+
+	req.Equal(int32(1), atomic.LoadInt32(&newConns), "requests for the same login reuse the connection")
+
+	first, err := login.httpTransport()
+	req.NoError(err)
+	second, err := (&RestClientEdgeIdentity{Url: server.URL}).httpTransport()
+	req.NoError(err)
+	req.Same(first, second)
+
+	other, err := (&RestClientEdgeIdentity{Url: "https://other:1280"}).httpTransport()
+	req.NoError(err)
+	req.NotSame(first, other)
+}
@@ -0,0 +1,164 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package util
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
+	"github.com/pkg/errors"
+)
+
+var (
+	relativeTimeFunctionRegex = regexp.MustCompile(`^(?i)(now|today)\(\s*([^)]*?)\s*\)`)
+	relativeTimeOffsetRegex   = regexp.MustCompile(`^[+-]([0-9]+(\.[0-9]+)?(ms|s|m|h|d|w))+`)
+	relativeTimePartRegex     = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)(ms|s|m|h|d|w)`)
+)
+
+var relativeTimeUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// ExpandFilterTimes replaces the relative times in a filter with the datetime literals the controller expects, so
+// scripts don't have to build RFC3339 timestamps themselves. The following are supported, outside of quoted strings:
+//
+//	now()         the current time
+//	now(-15m)     the current time offset by the given duration
+//	today()       the start of the current day in the local time zone, which may also be given an offset
+//	-24h          the current time offset by the given duration, a shorthand for now(-24h)
+//
+// Durations are given as for time.ParseDuration, and may also use days (d) and weeks (w), such as -1d12h
+func ExpandFilterTimes(filter string, now time.Time) (string, error) {
+	var result strings.Builder
+	var quote byte
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			result.WriteByte(c)
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+			result.WriteByte(c)
+			continue
+		}
+
+		if i == 0 || !isFilterIdentifierChar(filter[i-1]) {
+			if match := relativeTimeFunctionRegex.FindStringSubmatch(filter[i:]); match != nil {
+				base := now
+				if strings.EqualFold(match[1], "today") {
+					local := now.Local()
+					base = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+				}
+				offset, err := parseRelativeTimeOffset(match[2])
+				if err != nil {
+					return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid relative time '%v' in filter: %v", match[0], err)
+				}
+				result.WriteString(filterDatetime(base.Add(offset)))
+				i += len(match[0]) - 1
+				continue
+			}
+
+			if match := relativeTimeOffsetRegex.FindString(filter[i:]); match != "" {
+				end := i + len(match)
+				if end == len(filter) || !isFilterIdentifierChar(filter[end]) {
+					offset, err := parseRelativeTimeOffset(match)
+					if err != nil {
+						return "", cmdhelper.Errorf(cmdhelper.ExitCodeUsage, "invalid relative time '%v' in filter: %v", match, err)
+					}
+					result.WriteString(filterDatetime(now.Add(offset)))
+					i = end - 1
+					continue
+				}
+			}
+		}
+
+		result.WriteByte(c)
+	}
+	return result.String(), nil
+}
+
+// parseRelativeTimeOffset parses a signed duration, such as -1d12h. An empty offset is zero
+func parseRelativeTimeOffset(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	sign := time.Duration(1)
+	switch val[0] {
+	case '-':
+		sign = -1
+		val = val[1:]
+	case '+':
+		val = val[1:]
+	}
+
+	if val == "" || relativeTimePartRegex.ReplaceAllString(val, "") != "" {
+		return 0, errors.Errorf("'%v' isn't a duration, such as -15m or -1d12h", val)
+	}
+
+	var result time.Duration
+	for _, part := range relativeTimePartRegex.FindAllStringSubmatch(val, -1) {
+		count, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		result += time.Duration(count * float64(relativeTimeUnits[part[2]]))
+	}
+	return sign * result, nil
+}
+
+func filterDatetime(t time.Time) string {
+	return "datetime(" + t.UTC().Format(time.RFC3339) + ")"
+}
+
+func isFilterIdentifierChar(c byte) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// expandFilterParams returns the query params with the relative times of the filter expanded
+func expandFilterParams(params url.Values) (url.Values, error) {
+	if len(params["filter"]) == 0 {
+		return params, nil
+	}
+
+	result := url.Values{}
+	for key, values := range params {
+		result[key] = append([]string(nil), values...)
+	}
+	for idx, filter := range result["filter"] {
+		expanded, err := ExpandFilterTimes(filter, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		result["filter"][idx] = expanded
+	}
+	return result, nil
+}
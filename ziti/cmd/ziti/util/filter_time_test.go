@@ -0,0 +1,37 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandFilterTimes(t *testing.T) {
+	req := require.New(t)
+	now := time.Date(2022, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	expand := func(filter string) string {
+		result, err := ExpandFilterTimes(filter, now)
+		req.NoError(err)
+		return result
+	}
+
+	req.Equal("createdAt > datetime(2022-03-10T12:15:00Z)", expand("createdAt > now(-15m)"))
+	req.Equal("createdAt < datetime(2022-03-10T12:30:00Z)", expand("createdAt < NOW()"))
+	req.Equal("createdAt > datetime(2022-03-09T12:30:00Z) limit 5", expand("createdAt > -24h limit 5"))
+	req.Equal("updatedAt >= datetime(2022-02-26T00:30:00Z)", expand("updatedAt >= now(-1w5d12h)"))
+	req.Equal("(createdAt > datetime(2022-03-10T12:29:30Z))", expand("(createdAt > -30s)"))
+
+	// quoted strings, datetime literals, identifiers and numbers are left alone
+	req.Equal(`name = "now(-1h)" and x = 'a -1h'`, expand(`name = "now(-1h)" and x = 'a -1h'`))
+	req.Equal("createdAt > datetime(2022-03-01T10:00:00Z)", expand("createdAt > datetime(2022-03-01T10:00:00Z)"))
+	req.Equal("cost > -5 and name = x-1h", expand("cost > -5 and name = x-1h"))
+
+	local := now.Local()
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()).AddDate(0, 0, -1)
+	req.Equal("createdAt > datetime("+midnight.UTC().Format(time.RFC3339)+")", expand("createdAt > today(-1d)"))
+
+	_, err := ExpandFilterTimes("createdAt > now(yesterday)", now)
+	req.Error(err)
+}
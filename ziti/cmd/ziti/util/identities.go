@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -9,12 +10,13 @@ import (
 	"github.com/openziti/edge/rest_management_api_client"
 	fabric_rest_client "github.com/openziti/fabric/rest_client"
 	"github.com/openziti/identity"
+	"github.com/openziti/sdk-golang/ziti/config"
 	"github.com/openziti/sdk-golang/ziti/constants"
 	"github.com/openziti/ziti/ziti/cmd/ziti/cmd/common"
+	cmdhelper "github.com/openziti/ziti/ziti/cmd/ziti/cmd/helpers"
 	"github.com/pkg/errors"
 	"gopkg.in/resty.v1"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -66,12 +68,15 @@ func NewRequest(restClientIdentity RestClientIdentity, timeoutInSeconds int, ver
 }
 
 type RestClientEdgeIdentity struct {
-	Url       string `json:"url"`
-	Username  string `json:"username"`
-	Token     string `json:"token"`
-	LoginTime string `json:"loginTime"`
-	CaCert    string `json:"caCert,omitempty"`
-	ReadOnly  bool   `json:"readOnly"`
+	Url          string `json:"url"`
+	Username     string `json:"username"`
+	Token        string `json:"token"`
+	LoginTime    string `json:"loginTime"`
+	CaCert       string `json:"caCert,omitempty"`
+	ReadOnly     bool   `json:"readOnly"`
+	IdentityFile string `json:"identityFile,omitempty"`
+	// DefaultFilters are filters, by entity type, applied to the list and bulk commands run with this login
+	DefaultFilters map[string]string `json:"defaultFilters,omitempty"`
 }
 
 func (self *RestClientEdgeIdentity) IsReadOnly() bool {
@@ -79,6 +84,25 @@ func (self *RestClientEdgeIdentity) IsReadOnly() bool {
 }
 
 func (self *RestClientEdgeIdentity) NewTlsClientConfig() (*tls.Config, error) {
+	if self.IdentityFile != "" {
+		id, err := LoadIdentityFile(self.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig := id.ClientTLSConfig()
+		if self.CaCert != "" {
+			if tlsConfig.RootCAs == nil {
+				tlsConfig.RootCAs = x509.NewCertPool()
+			}
+			rootPemData, err := ioutil.ReadFile(self.CaCert)
+			if err != nil {
+				return nil, errors.Errorf("could not read session certificates [%s]: %v", self.CaCert, err)
+			}
+			tlsConfig.RootCAs.AppendCertsFromPEM(rootPemData)
+		}
+		return tlsConfig, nil
+	}
+
 	rootCaPool := x509.NewCertPool()
 
 	rootPemData, err := ioutil.ReadFile(self.CaCert)
@@ -94,13 +118,27 @@ func (self *RestClientEdgeIdentity) NewTlsClientConfig() (*tls.Config, error) {
 }
 
 func (self *RestClientEdgeIdentity) NewClient(timeout time.Duration, verbose bool) (*resty.Client, error) {
-	client := newClient()
-	client.SetRootCertificate(self.CaCert)
+	transport, err := self.httpTransport()
+	if err != nil {
+		return nil, err
+	}
+	client := applyMiddleware(newClientWithTransport(transport))
 	client.SetTimeout(timeout)
 	client.SetDebug(verbose)
 	return client, nil
 }
 
+// httpTransport returns the transport shared by the clients of this login
+func (self *RestClientEdgeIdentity) httpTransport() (*http.Transport, error) {
+	key := strings.Join([]string{"edge", self.Url, self.CaCert, self.IdentityFile}, "|")
+	return sharedHttpTransport(key, func() (*tls.Config, error) {
+		if self.IdentityFile == "" && self.CaCert == "" {
+			return &tls.Config{}, nil
+		}
+		return self.NewTlsClientConfig()
+	})
+}
+
 func (self *RestClientEdgeIdentity) NewRequest(client *resty.Client) *resty.Request {
 	r := client.R()
 	r.SetHeader(constants.ZitiSession, self.Token)
@@ -167,6 +205,19 @@ func (self *RestClientEdgeIdentity) NewWsHeader() http.Header {
 	return result
 }
 
+// LoadIdentityFile loads the certificates and key from an enrolled identity json file, as used by SDK applications
+func LoadIdentityFile(identityFile string) (identity.Identity, error) {
+	cfg, err := config.NewFromFile(identityFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read identity file %v", identityFile)
+	}
+	id, err := identity.LoadIdentity(cfg.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load identity from %v", identityFile)
+	}
+	return id, nil
+}
+
 type RestClientFabricIdentity struct {
 	Url        string `json:"url"`
 	CaCert     string `json:"caCert,omitempty"`
@@ -184,17 +235,22 @@ func (self *RestClientFabricIdentity) NewTlsClientConfig() (*tls.Config, error)
 }
 
 func (self *RestClientFabricIdentity) NewClient(timeout time.Duration, verbose bool) (*resty.Client, error) {
-	id, err := identity.LoadClientIdentity(self.ClientCert, self.ClientKey, self.CaCert)
+	transport, err := self.httpTransport()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to load identity")
+		return nil, err
 	}
-	client := newClient()
-	client.SetTLSClientConfig(id.ClientTLSConfig())
+	client := applyMiddleware(newClientWithTransport(transport))
 	client.SetTimeout(timeout)
 	client.SetDebug(verbose)
 	return client, nil
 }
 
+// httpTransport returns the transport shared by the clients of this login
+func (self *RestClientFabricIdentity) httpTransport() (*http.Transport, error) {
+	key := strings.Join([]string{"fabric", self.Url, self.CaCert, self.ClientCert, self.ClientKey}, "|")
+	return sharedHttpTransport(key, self.NewTlsClientConfig)
+}
+
 func (self *RestClientFabricIdentity) NewRequest(client *resty.Client) *resty.Request {
 	return client.R()
 }
@@ -305,29 +361,55 @@ func PersistRestClientConfig(config *RestClientConfig) error {
 
 var selectedIdentity RestClientIdentity
 
+// LoadDefaultFilter returns the default filter for the entity type of the selected login, if it has one, and the name
+// of the login
+func LoadDefaultFilter(entityType string) (string, string) {
+	config, _, err := LoadRestClientConfig()
+	if err != nil {
+		return "", ""
+	}
+	name := config.GetIdentity()
+	if clientIdentity, found := config.EdgeIdentities[name]; found {
+		return clientIdentity.DefaultFilters[entityType], name
+	}
+	return "", name
+}
+
 func LoadSelectedIdentity() (RestClientIdentity, error) {
 	if selectedIdentity == nil {
-		config, configFile, err := LoadRestClientConfig()
+		clientIdentity, err := LoadIdentity("")
 		if err != nil {
 			return nil, err
 		}
-		id := config.GetIdentity()
-		clientIdentity, found := config.EdgeIdentities[id]
-		if !found {
-			return nil, errors.Errorf("no identity '%v' found in cli config %v", id, configFile)
-		}
 		selectedIdentity = clientIdentity
 	}
 	return selectedIdentity, nil
 }
 
+// LoadIdentity returns the saved login with the given name, or the login selected for the CLI if no name is given.
+// Unlike LoadSelectedIdentity, the login isn't kept as the one selected for the CLI
+func LoadIdentity(name string) (RestClientIdentity, error) {
+	config, configFile, err := LoadRestClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = config.GetIdentity()
+	}
+	clientIdentity, found := config.EdgeIdentities[name]
+	if !found {
+		return nil, cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "no identity '%v' found in cli config %v", name, configFile)
+	}
+	return clientIdentity, nil
+}
+
 func LoadSelectedRWIdentity() (RestClientIdentity, error) {
 	id, err := LoadSelectedIdentity()
 	if err != nil {
 		return nil, err
 	}
 	if id.IsReadOnly() {
-		return nil, errors.New("this login is marked read-only, only GET operations are allowed")
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeAuth, errors.New("this login is marked read-only, only GET operations are allowed"))
 	}
 	return id, nil
 }
@@ -350,7 +432,7 @@ func LoadSelectedIdentityForApi(api API) (RestClientIdentity, error) {
 			if !found {
 				clientIdentity, found = config.FabricIdentities[id]
 				if !found {
-					return nil, errors.Errorf("no identity '%v' found in cli config %v", id, configFile)
+					return nil, cmdhelper.Errorf(cmdhelper.ExitCodeAuth, "no identity '%v' found in cli config %v", id, configFile)
 				}
 			}
 			selectedIdentity = clientIdentity
@@ -366,7 +448,7 @@ func LoadSelectedRWIdentityForApi(api API) (RestClientIdentity, error) {
 		return nil, err
 	}
 	if id.IsReadOnly() {
-		return nil, errors.New("this login is marked read-only, only GET operations are allowed")
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeAuth, errors.New("this login is marked read-only, only GET operations are allowed"))
 	}
 	return id, nil
 }
@@ -379,8 +461,10 @@ func newRestClientResponseF(clientOpts ClientOpts) func(*http.Response, error) {
 				return
 			}
 
-			resp.Body = ioutil.NopCloser(resp.Body)
+			// the body is read here, so it's put back for the client to decode
 			bodyContent, err := ioutil.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			resp.Body = ioutil.NopCloser(bytes.NewReader(bodyContent))
 			if err != nil {
 				_, _ = fmt.Fprintf(clientOpts.ErrOutputWriter(), "could not read response body: %v", err)
 				return
@@ -418,31 +502,33 @@ func newRestClientRequestF(clientOpts ClientOpts, readOnly bool) func(*http.Requ
 	}
 }
 
+// httpTransportProvider is implemented by logins which share a transport between their clients
+type httpTransportProvider interface {
+	httpTransport() (*http.Transport, error)
+}
+
 func newRestClientTransport(clientOpts ClientOpts, clientIdentity RestClientIdentity) (*http.Client, error) {
-	httpClientTransport := &edgeTransport{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 10 * time.Second,
-			}).DialContext,
-
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          10,
-			IdleConnTimeout:       10 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		ResponseFunc: newRestClientResponseF(clientOpts),
-		RequestFunc:  newRestClientRequestF(clientOpts, clientIdentity.IsReadOnly()),
+	var transport *http.Transport
+	var err error
+	if provider, ok := clientIdentity.(httpTransportProvider); ok {
+		transport, err = provider.httpTransport()
+	} else {
+		transport = newHttpTransport()
+		var tlsClientConfig *tls.Config
+		if tlsClientConfig, err = clientIdentity.NewTlsClientConfig(); err == nil {
+			transport.TLSClientConfig = withTLSSessionCache(tlsClientConfig)
+		}
 	}
-
-	tlsClientConfig, err := clientIdentity.NewTlsClientConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	httpClientTransport.TLSClientConfig = tlsClientConfig
+	httpClientTransport := &edgeTransport{
+		Transport:    transport,
+		Identity:     clientIdentity,
+		ResponseFunc: newRestClientResponseF(clientOpts),
+		RequestFunc:  newRestClientRequestF(clientOpts, clientIdentity.IsReadOnly()),
+	}
 
 	httpClient := &http.Client{
 		Transport: httpClientTransport,
@@ -0,0 +1,114 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package util
+
+import (
+	"net/http"
+	"sync"
+
+	"gopkg.in/resty.v1"
+)
+
+// RequestMutator is called before every request made to the controller by the shared edge and fabric
+// REST clients. It may add headers, change authentication or otherwise modify the request. Returning an
+// error aborts the request
+type RequestMutator func(request *http.Request) error
+
+// ResponseObserver is called after every request made to the controller by the shared edge and fabric
+// REST clients, with either the response or the error which occurred. Observers must not consume the
+// response body
+type ResponseObserver func(request *http.Request, response *http.Response, err error)
+
+var middleware = struct {
+	sync.RWMutex
+	requestMutators   []RequestMutator
+	responseObservers []ResponseObserver
+}{}
+
+// AddRequestMutator registers a mutator which will be applied to all subsequent controller requests
+func AddRequestMutator(mutator RequestMutator) {
+	middleware.Lock()
+	defer middleware.Unlock()
+	middleware.requestMutators = append(middleware.requestMutators, mutator)
+}
+
+// AddResponseObserver registers an observer which will be notified of all subsequent controller responses
+func AddResponseObserver(observer ResponseObserver) {
+	middleware.Lock()
+	defer middleware.Unlock()
+	middleware.responseObservers = append(middleware.responseObservers, observer)
+}
+
+// ClearMiddleware removes all registered request mutators and response observers
+func ClearMiddleware() {
+	middleware.Lock()
+	defer middleware.Unlock()
+	middleware.requestMutators = nil
+	middleware.responseObservers = nil
+}
+
+func applyRequestMutators(request *http.Request) error {
+	middleware.RLock()
+	defer middleware.RUnlock()
+	for _, mutator := range middleware.requestMutators {
+		if err := mutator(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notifyResponseObservers(request *http.Request, response *http.Response, err error) {
+	middleware.RLock()
+	defer middleware.RUnlock()
+	for _, observer := range middleware.responseObservers {
+		observer(request, response, err)
+	}
+}
+
+// applyMiddleware hooks the registered request mutators and response observers into a resty client. Resty doesn't run
+// its response middleware for requests which fail without a response, so the observers are told of those by the
+// transport of the client
+func applyMiddleware(client *resty.Client) *resty.Client {
+	client.SetPreRequestHook(func(_ *resty.Client, request *resty.Request) error {
+		return applyRequestMutators(request.RawRequest)
+	})
+	client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
+		notifyResponseObservers(response.Request.RawRequest, response.RawResponse, nil)
+		return nil
+	})
+	httpClient := client.GetClient()
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient.Transport = &errorObservingTransport{RoundTripper: transport}
+	return client
+}
+
+// errorObservingTransport notifies the response observers of requests which fail without a response
+type errorObservingTransport struct {
+	http.RoundTripper
+}
+
+func (self *errorObservingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := self.RoundTripper.RoundTrip(request)
+	if err != nil {
+		notifyResponseObservers(request, nil, err)
+	}
+	return response, err
+}
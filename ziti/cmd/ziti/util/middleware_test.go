@@ -0,0 +1,71 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type observedResponse struct {
+	path   string
+	status int
+	err    error
+}
+
+func TestMiddleware(t *testing.T) {
+	req := require.New(t)
+	t.Cleanup(ClearMiddleware)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "mutated" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var observed []observedResponse
+	AddRequestMutator(func(request *http.Request) error {
+		request.Header.Set("X-Test", "mutated")
+		return nil
+	})
+	AddResponseObserver(func(request *http.Request, response *http.Response, err error) {
+		result := observedResponse{path: request.URL.Path, err: err}
+		if response != nil {
+			result.status = response.StatusCode
+		}
+		observed = append(observed, result)
+	})
+
+	login := &RestClientEdgeIdentity{Url: server.URL}
+	client, err := login.NewClient(time.Second, false)
+	req.NoError(err)
+	client.SetRetryCount(0)
+
+	resp, err := client.R().Get(server.URL + "/ok")
+	req.NoError(err)
+	req.Equal(http.StatusNoContent, resp.StatusCode())
+	req.Equal([]observedResponse{{path: "/ok", status: http.StatusNoContent}}, observed)
+
+	// observers are told of requests which fail without a response as well
+	observed = nil
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, err = client.R().Get(closed.URL + "/down")
+	req.Error(err)
+	req.Len(observed, 1)
+	req.Equal("/down", observed[0].path)
+	req.Zero(observed[0].status)
+	req.Error(observed[0].err)
+
+	ClearMiddleware()
+	observed = nil
+	resp, err = client.R().Get(server.URL + "/ok")
+	req.NoError(err)
+	req.Equal(http.StatusBadRequest, resp.StatusCode(), "cleared mutators aren't applied")
+	req.Empty(observed)
+}
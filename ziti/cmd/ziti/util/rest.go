@@ -82,8 +82,14 @@ func DownloadFile(filepath string, url string) (err error) {
 
 // Use a 2-second timeout with a retry count of 5
 func newClient() *resty.Client {
+	return newClientWithTransport(newHttpTransport())
+}
+
+// newClientWithTransport returns a client using the given transport, which may be shared with other clients
+func newClientWithTransport(transport *http.Transport) *resty.Client {
 	return resty.
 		New().
+		SetTransport(transport).
 		SetTimeout(2 * time.Second).
 		SetRetryCount(5).
 		SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
@@ -159,7 +165,10 @@ type GitHubReleasesData struct {
 	Version string `json:"tag_name"`
 	SemVer  semver.Version
 	Assets  []struct {
+		Name               string `json:"name"`
 		BrowserDownloadURL string `json:"browser_download_url"`
+		// Digest is the checksum GitHub records for the asset, such as sha256:<hex>. Older assets have none
+		Digest string `json:"digest"`
 	}
 }
 
@@ -247,6 +256,29 @@ func GetLatestGitHubReleaseAsset(verbose bool, appName string) (*GitHubReleasesD
 	return result, nil
 }
 
+// GetGitHubReleaseByTag returns the release of the app with the given tag
+func GetGitHubReleaseByTag(verbose bool, appName string, tag string) (*GitHubReleasesData, error) {
+	resp, err := getRequest(verbose).
+		SetQueryParams(map[string]string{}).
+		SetHeader("Accept", "application/vnd.github.v3+json").
+		SetResult(&GitHubReleasesData{}).
+		Get("https://api.github.com/repos/openziti/" + appName + "/releases/tags/" + url.PathEscape(tag))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get release %s of '%s'; %s", tag, appName, err)
+	}
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("unable to get release %s of '%s'; Not Found", tag, appName)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unable to get release %s of '%s'; %s", tag, appName, resp.Status())
+	}
+
+	result := resp.Result().(*GitHubReleasesData)
+	return result, nil
+}
+
 // DownloadGitHubReleaseAsset will download a file from the given GitHUb release area
 func DownloadGitHubReleaseAsset(fullUrl string, filepath string) (err error) {
 	resp, err := getRequest(false).
@@ -587,11 +619,54 @@ func EdgeControllerLogin(url string, cert string, authentication string, out io.
 		Post(url + "/authenticate")
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to authenticate to %v. Error: %v", url, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to authenticate to %v. Error: %v", url, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("unable to authenticate to %v. Status code: %v, Server returned: %v", url, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("unable to authenticate to %v. Status code: %v, Server returned: %v", url, resp.Status(), prettyPrintResponse(resp)))
+	}
+
+	if logJSON {
+		outputJson(out, resp.Body())
+	}
+
+	jsonParsed, err := gabs.ParseJSON(resp.Body())
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse response from %v. Server returned: %v", url, resp.String())
+	}
+
+	return jsonParsed, nil
+}
+
+// EdgeControllerCertLogin will authenticate to the given Edge Controller using the certificate and key from an identity file
+func EdgeControllerCertLogin(url string, cert string, identityFile string, out io.Writer, logJSON bool, timeout int, verbose bool) (*gabs.Container, error) {
+	id, err := LoadIdentityFile(identityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newClient()
+	setClientTLSConfig(client, id.ClientTLSConfig())
+
+	if cert != "" {
+		client.SetRootCertificate(cert)
+	}
+
+	resp, err := client.
+		SetTimeout(time.Duration(time.Duration(timeout)*time.Second)).
+		SetDebug(verbose).
+		R().
+		SetQueryParam("method", "cert").
+		SetHeader("Content-Type", "application/json").
+		SetBody("{}").
+		Post(url + "/authenticate")
+
+	if err != nil {
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to authenticate to %v. Error: %v", url, err))
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, newStatusCodeError(resp, fmt.Errorf("unable to authenticate to %v. Status code: %v, Server returned: %v", url, resp.Status(), prettyPrintResponse(resp)))
 	}
 
 	if logJSON {
@@ -629,6 +704,16 @@ func outputJson(out io.Writer, data []byte) {
 }
 
 func ControllerDetailEntity(api API, entityType, entityId string, logJSON bool, out io.Writer, timeout int, verbose bool) (*gabs.Container, error) {
+	return controllerDetailEntity(api, entityType, entityId, logJSON, out, timeout, verbose, true)
+}
+
+// ControllerDetailEntityUncached works like ControllerDetailEntity, but always fetches the entity from the controller,
+// for callers such as watches which a cached response would hide changes from
+func ControllerDetailEntityUncached(api API, entityType, entityId string, logJSON bool, out io.Writer, timeout int, verbose bool) (*gabs.Container, error) {
+	return controllerDetailEntity(api, entityType, entityId, logJSON, out, timeout, verbose, false)
+}
+
+func controllerDetailEntity(api API, entityType, entityId string, logJSON bool, out io.Writer, timeout int, verbose bool, cached bool) (*gabs.Container, error) {
 	restClientIdentity, err := LoadSelectedRWIdentityForApi(api)
 	if err != nil {
 		return nil, err
@@ -646,15 +731,21 @@ func ControllerDetailEntity(api API, entityType, entityId string, logJSON bool,
 
 	queryUrl := baseUrl + "/" + path.Join(entityType, entityId)
 
+	if cached {
+		if body := readCachedResponse(restClientIdentity, queryUrl); body != nil {
+			return parseCachedResponse(queryUrl, body, logJSON, out)
+		}
+	}
+
 	resp, err := req.Get(queryUrl)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to list entities at %v in Ziti Edge Controller at %v. Error: %v", queryUrl, baseUrl, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to list entities at %v in Ziti Edge Controller at %v. Error: %v", queryUrl, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("error listing %v in Ziti Edge Controller. Status code: %v, Server returned: %v",
-			queryUrl, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("error listing %v in Ziti Edge Controller. Status code: %v, Server returned: %v",
+			queryUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
 	if logJSON {
@@ -667,6 +758,8 @@ func ControllerDetailEntity(api API, entityType, entityId string, logJSON bool,
 		return nil, fmt.Errorf("unable to parse response from %v. Server returned: %v", queryUrl, resp.String())
 	}
 
+	writeCachedResponse(restClientIdentity, queryUrl, resp.Body())
+
 	return jsonParsed, nil
 }
 
@@ -701,21 +794,29 @@ func ControllerList(api API, path string, params url.Values, logJSON bool, out i
 		return nil, err
 	}
 
+	if params, err = expandFilterParams(params); err != nil {
+		return nil, err
+	}
+
 	queryUrl := baseUrl + "/" + path
 
 	if len(params) > 0 {
 		queryUrl += "?" + params.Encode()
 	}
 
+	if body := readCachedResponse(restClientIdentity, queryUrl); body != nil {
+		return parseCachedResponse(queryUrl, body, logJSON, out)
+	}
+
 	resp, err := req.Get(queryUrl)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to list entities at %v in Ziti Controller at %v. Error: %v", queryUrl, baseUrl, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to list entities at %v in Ziti Controller at %v. Error: %v", queryUrl, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("error listing %v in Ziti Edge Controller. Status code: %v, Server returned: %v",
-			queryUrl, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("error listing %v in Ziti Edge Controller. Status code: %v, Server returned: %v",
+			queryUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
 	if logJSON {
@@ -728,6 +829,20 @@ func ControllerList(api API, path string, params url.Values, logJSON bool, out i
 		return nil, fmt.Errorf("unable to parse response from %v. Server returned: %v", queryUrl, resp.String())
 	}
 
+	writeCachedResponse(restClientIdentity, queryUrl, resp.Body())
+
+	return jsonParsed, nil
+}
+
+func parseCachedResponse(queryUrl string, body []byte, logJSON bool, out io.Writer) (*gabs.Container, error) {
+	if logJSON {
+		outputJson(out, body)
+	}
+
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse cached response from %v: %v", queryUrl, err)
+	}
 	return jsonParsed, nil
 }
 
@@ -735,6 +850,7 @@ var _ http.RoundTripper = &edgeTransport{}
 
 type edgeTransport struct {
 	*http.Transport
+	Identity     RestClientIdentity
 	RequestFunc  func(*http.Request) error
 	ResponseFunc func(*http.Response, error)
 }
@@ -746,7 +862,32 @@ func (edgeTransport *edgeTransport) RoundTrip(r *http.Request) (*http.Response,
 		}
 	}
 
+	if err := applyRequestMutators(r); err != nil {
+		return nil, err
+	}
+
+	if r.Method == http.MethodGet {
+		if body := readCachedResponse(edgeTransport.Identity, r.URL.String()); body != nil {
+			resp := newCachedHTTPResponse(r, body)
+			if edgeTransport.ResponseFunc != nil {
+				edgeTransport.ResponseFunc(resp, nil)
+			}
+			return resp, nil
+		}
+	}
+
 	resp, err := edgeTransport.Transport.RoundTrip(r)
+	notifyResponseObservers(r, resp, err)
+
+	if err == nil && r.Method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		if err = cacheHTTPResponse(edgeTransport.Identity, r, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	if err == nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		invalidateCachedResponses(edgeTransport.Identity, r.URL.String())
+	}
 
 	if edgeTransport.ResponseFunc != nil {
 		edgeTransport.ResponseFunc(resp, err)
@@ -791,6 +932,29 @@ func (a RestApiError) Error() string {
 	return fmt.Sprintf("could not read API error, payload was nil: %v", a.Error())
 }
 
+// ExitCode maps the API error code onto the CLI exit code scheme
+func (a RestApiError) ExitCode() int {
+	payload := a.ApiErrorPayload.GetPayload()
+	if payload == nil || payload.Error == nil {
+		return cmdhelper.ExitCodeGeneral
+	}
+
+	switch payload.Error.Code {
+	case "UNAUTHORIZED", "INVALID_AUTH", "FORBIDDEN":
+		return cmdhelper.ExitCodeAuth
+	case "NOT_FOUND":
+		return cmdhelper.ExitCodeNotFound
+	case "COULD_NOT_VALIDATE", "INVALID_FIELD", "INVALID_FILTER", "COULD_NOT_PARSE_BODY", "CONSTRAINT_VIOLATION":
+		return cmdhelper.ExitCodeValidation
+	}
+	return cmdhelper.ExitCodeGeneral
+}
+
+// newStatusCodeError attaches the exit code matching the response status to err
+func newStatusCodeError(resp *resty.Response, err error) error {
+	return cmdhelper.WithExitCode(cmdhelper.ExitCodeForHttpStatus(resp.StatusCode()), err)
+}
+
 func WrapIfApiError(err error) error {
 	if apiErrorPayload, ok := err.(ApiErrorPayload); ok {
 		return &RestApiError{apiErrorPayload}
@@ -857,14 +1021,16 @@ func ControllerCreate(api API, entityType string, body string, out io.Writer, lo
 	resp, err := req.SetBody(body).Post(url)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to create %v instance in Ziti Edge Controller at %v. Error: %v", entityType, baseUrl, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to create %v instance in Ziti Edge Controller at %v. Error: %v", entityType, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusCreated {
-		return nil, fmt.Errorf("error creating %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
-			entityType, baseUrl, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("error creating %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
+			entityType, baseUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
+	invalidateCachedResponses(restClientIdentity, url)
+
 	if logResponseJson {
 		outputJson(out, resp.Body())
 	}
@@ -911,14 +1077,16 @@ func ControllerDelete(api API, entityType string, id string, body string, out io
 	resp, err := req.Delete(fullUrl)
 
 	if err != nil {
-		return fmt.Errorf("unable to delete %v instance in Ziti Edge Controller at %v. Error: %v", entityPath, baseUrl, err)
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to delete %v instance in Ziti Edge Controller at %v. Error: %v", entityPath, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("error deleting %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
-			entityPath, baseUrl, resp.Status(), prettyPrintResponse(resp))
+		return newStatusCodeError(resp, fmt.Errorf("error deleting %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
+			entityPath, baseUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
+	invalidateCachedResponses(restClientIdentity, fullUrl)
+
 	if logResponseJson {
 		outputJson(out, resp.Body())
 	}
@@ -954,14 +1122,16 @@ func ControllerUpdate(api API, entityType string, body string, out io.Writer, me
 	resp, err := req.SetBody(body).Execute(method, url)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to update %v instance in Ziti Edge Controller at %v. Error: %v", entityType, baseUrl, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to update %v instance in Ziti Edge Controller at %v. Error: %v", entityType, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusAccepted {
-		return nil, fmt.Errorf("error updating %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
-			entityType, baseUrl, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("error updating %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
+			entityType, baseUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
+	invalidateCachedResponses(restClientIdentity, url)
+
 	if logResponseJSON {
 		outputJson(out, resp.Body())
 	}
@@ -1004,14 +1174,16 @@ func EdgeControllerVerify(entityType, id, body string, out io.Writer, logJSON bo
 		Post(baseUrl + "/" + entityType + "/" + id + "/verify")
 
 	if err != nil {
-		return fmt.Errorf("unable to verify %v instance [%s] in Ziti Edge Controller at %v. Error: %v", entityType, id, baseUrl, err)
+		return cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to verify %v instance [%s] in Ziti Edge Controller at %v. Error: %v", entityType, id, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("error verifying %v instance (%v) in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
-			entityType, id, baseUrl, resp.Status(), prettyPrintResponse(resp))
+		return newStatusCodeError(resp, fmt.Errorf("error verifying %v instance (%v) in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
+			entityType, id, baseUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
+	invalidateCachedResponses(restClientIdentity, baseUrl+"/"+entityType+"/"+id+"/verify")
+
 	if logJSON {
 		outputJson(out, resp.Body())
 	}
@@ -1038,14 +1210,16 @@ func EdgeControllerRequest(entityType string, out io.Writer, logJSON bool, timeo
 	resp, err := doRequest(request, baseUrl+"/"+entityType)
 
 	if err != nil {
-		return nil, fmt.Errorf("unable to [%s] %v instance in Ziti Edge Controller at %v. Error: %v", request.Method, entityType, baseUrl, err)
+		return nil, cmdhelper.WithExitCode(cmdhelper.ExitCodeConnectivity, fmt.Errorf("unable to [%s] %v instance in Ziti Edge Controller at %v. Error: %v", request.Method, entityType, baseUrl, err))
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("error performing request [%s] %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
-			request.Method, entityType, baseUrl, resp.Status(), prettyPrintResponse(resp))
+		return nil, newStatusCodeError(resp, fmt.Errorf("error performing request [%s] %v instance in Ziti Edge Controller at %v. Status code: %v, Server returned: %v",
+			request.Method, entityType, baseUrl, resp.Status(), prettyPrintResponse(resp)))
 	}
 
+	invalidateCachedResponses(restClientIdentity, baseUrl+"/"+entityType)
+
 	if logJSON {
 		outputJson(out, resp.Body())
 	}
@@ -17,27 +17,83 @@
 package certificate
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
+
+	"github.com/openziti/ziti/ziti/pki/pkcs12"
 )
 
 // Bundle represents a pair of private key and certificate.
 type Bundle struct {
 	Name string
-	Key  *rsa.PrivateKey
+	Key  crypto.Signer
 	Cert *x509.Certificate
 }
 
 // Raw returns the raw bytes for the private key and certificate.
 func (b *Bundle) Raw() ([]byte, []byte) {
-	return x509.MarshalPKCS1PrivateKey(b.Key), b.Cert.Raw
+	key, _ := MarshalPrivateKey(b.Key)
+	return key, b.Cert.Raw
+}
+
+// MarshalPrivateKey returns the raw bytes for a private key, in PKCS #1 form
+// for RSA keys, SEC 1 form for EC keys and PKCS #8 form for Ed25519 keys.
+func MarshalPrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return x509.MarshalPKCS1PrivateKey(k), nil
+	case *ecdsa.PrivateKey:
+		return x509.MarshalECPrivateKey(k)
+	case ed25519.PrivateKey:
+		return x509.MarshalPKCS8PrivateKey(k)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// ParsePrivateKey parses the raw bytes of a private key as written by
+// MarshalPrivateKey.
+func ParsePrivateKey(key []byte) (crypto.Signer, error) {
+	if k, err := x509.ParsePKCS1PrivateKey(key); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(key); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key format: %v", err)
+	}
+	signer, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", k)
+	}
+	return signer, nil
+}
+
+// PrivateKeyPEMType returns the PEM block type for the raw bytes of a private
+// key as written by MarshalPrivateKey, or encrypted by pkcs12.EncryptPrivateKey.
+func PrivateKeyPEMType(key []byte) string {
+	if pkcs12.IsEncryptedPrivateKey(key) {
+		return "ENCRYPTED PRIVATE KEY"
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(key); err == nil {
+		return "RSA PRIVATE KEY"
+	}
+	if _, err := x509.ParseECPrivateKey(key); err == nil {
+		return "EC PRIVATE KEY"
+	}
+	return "PRIVATE KEY"
 }
 
 // RawToBundle creates a bundle from the name and bytes given for a private key
 // and a certificate.
 func RawToBundle(name string, key []byte, cert []byte) (*Bundle, error) {
-	k, err := x509.ParsePKCS1PrivateKey(key)
+	k, err := ParsePrivateKey(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed parsing private key: %v", err)
 	}
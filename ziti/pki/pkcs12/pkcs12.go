@@ -0,0 +1,526 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package pkcs12 encodes private keys and certificates as PKCS #12 archives
+// (RFC 7292), as consumed by Java key stores and the Windows certificate store.
+//
+// Keys and certificates are encrypted with PBES2, using PBKDF2 with
+// HMAC-SHA256 and AES-256-CBC, and the archive is integrity protected with an
+// HMAC-SHA256 MAC. These are the defaults of OpenSSL 3 and are supported by
+// Java 8u301 and later and Windows Server 2019 and later. Archives for older
+// consumers may instead use the legacy PBE-SHA1-3DES encryption and a SHA-1
+// MAC, see Options.
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidShroudedKeyBag       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHmacWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidPBESHA3DES           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	saltLength              = 16
+	legacySaltLength        = 8
+	pkcs12KDFEncKeyID  byte = 1
+	pkcs12KDFIVID      byte = 2
+	pkcs12KDFMacKeyID  byte = 3
+)
+
+// DefaultIterations is the iteration count of the key derivation functions,
+// unless another is given in the Options
+const DefaultIterations = 2048
+
+// Options select how an archive is protected
+type Options struct {
+	// Legacy encrypts keys and certificates with PBE-SHA1-3DES and protects the
+	// archive with an HMAC-SHA1 MAC, as OpenSSL 1.1 did, for consumers which
+	// don't support PBES2, such as Java before 8u301 and Windows before Server
+	// 2019. Certificates are encrypted with 3DES rather than the RC2-40 OpenSSL
+	// used, as RC2-40 is trivially broken and all consumers which read it also
+	// read 3DES.
+	Legacy bool
+
+	// Iterations of the key derivation functions, DefaultIterations if 0
+	Iterations int
+}
+
+// encryptFunc encrypts data with a key derived from the password, returning the
+// algorithm identifier describing how
+type encryptFunc func(data []byte, password string) (*pkix.AlgorithmIdentifier, []byte, error)
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue `asn1:"tag:0,explicit"`
+	Attributes []attribute   `asn1:"set,optional"`
+}
+
+type attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the PBKDF2-params of RFC 8018. The PRF is left out when it's the default of HMAC-SHA1
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+// Encode returns a PKCS #12 archive holding the private key, its certificate
+// and the chain of CA certificates which issued it, protected by the password.
+// The friendly name is shown by tools like keytool as the alias of the entry
+// and may be empty.
+func Encode(key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password, friendlyName string) ([]byte, error) {
+	return EncodeWithOptions(key, cert, caCerts, password, friendlyName, Options{})
+}
+
+// EncodeWithOptions is Encode, with the encryption and iterations selected by
+// the options.
+func EncodeWithOptions(key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password, friendlyName string, options Options) ([]byte, error) {
+	if cert == nil {
+		return nil, errors.New("a certificate is required")
+	}
+
+	iterations := options.Iterations
+	if iterations == 0 {
+		iterations = DefaultIterations
+	}
+	if iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count %v, must be at least 1", iterations)
+	}
+
+	encrypt := func(data []byte, password string) (*pkix.AlgorithmIdentifier, []byte, error) {
+		return pbes2Encrypt(data, password, iterations)
+	}
+	macHash, macAlgorithm := sha256.New, oidSHA256
+	if options.Legacy {
+		encrypt = func(data []byte, password string) (*pkix.AlgorithmIdentifier, []byte, error) {
+			return pbeSHA1TripleDESEncrypt(data, password, iterations)
+		}
+		macHash, macAlgorithm = sha1.New, oidSHA1
+	}
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	localKeyID := sha1.Sum(cert.Raw)
+	leafAttributes, err := bagAttributes(localKeyID[:], friendlyName)
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	leafBag, err := newCertBag(cert, leafAttributes)
+	if err != nil {
+		return nil, err
+	}
+	certBags = append(certBags, *leafBag)
+	for _, caCert := range caCerts {
+		caBag, err := newCertBag(caCert, nil)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, *caBag)
+	}
+
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	encryptedCerts, err := newEncryptedContentInfo(certContents, password, encrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	var authenticatedSafe []contentInfo
+	authenticatedSafe = append(authenticatedSafe, *encryptedCerts)
+
+	if key != nil {
+		keyBag, err := newShroudedKeyBag(key, password, leafAttributes, encrypt)
+		if err != nil {
+			return nil, err
+		}
+		keyContents, err := asn1.Marshal([]safeBag{*keyBag})
+		if err != nil {
+			return nil, err
+		}
+		keyContentInfo, err := newDataContentInfo(keyContents)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedSafe = append(authenticatedSafe, *keyContentInfo)
+	}
+
+	authenticatedSafeBytes, err := asn1.Marshal(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	pfx := pfxPdu{Version: 3}
+	authSafe, err := newDataContentInfo(authenticatedSafeBytes)
+	if err != nil {
+		return nil, err
+	}
+	pfx.AuthSafe = *authSafe
+
+	macSalt := make([]byte, saltLength)
+	if _, err := rand.Read(macSalt); err != nil {
+		return nil, err
+	}
+	macKey := pkcs12KDF(macHash, encodedPassword, macSalt, pkcs12KDFMacKeyID, iterations, macHash().Size())
+	mac := hmac.New(macHash, macKey)
+	mac.Write(authenticatedSafeBytes)
+	pfx.MacData = macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: macAlgorithm, Parameters: asn1.NullRawValue},
+			Digest:    mac.Sum(nil),
+		},
+		MacSalt:    macSalt,
+		Iterations: iterations,
+	}
+
+	return asn1.Marshal(pfx)
+}
+
+func bagAttributes(localKeyID []byte, friendlyName string) ([]attribute, error) {
+	keyIDValue, err := asn1.Marshal(localKeyID)
+	if err != nil {
+		return nil, err
+	}
+	result := []attribute{{ID: oidLocalKeyID, Value: asn1.RawValue{FullBytes: setOf(keyIDValue)}}}
+
+	if friendlyName != "" {
+		name, err := bmpString(friendlyName)
+		if err != nil {
+			return nil, err
+		}
+		// strip the terminating null, which is only used for passwords
+		nameValue, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: name[:len(name)-2]})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, attribute{ID: oidFriendlyName, Value: asn1.RawValue{FullBytes: setOf(nameValue)}})
+	}
+	return result, nil
+}
+
+// setOf wraps the DER encoded value in a SET
+func setOf(value []byte) []byte {
+	result, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value})
+	return result
+}
+
+func newCertBag(cert *x509.Certificate, attributes []attribute) (*safeBag, error) {
+	value, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: cert.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return &safeBag{
+		ID:         oidCertBag,
+		Value:      asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value},
+		Attributes: attributes,
+	}, nil
+}
+
+func newShroudedKeyBag(key crypto.PrivateKey, password string, attributes []attribute, encrypt encryptFunc) (*safeBag, error) {
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling private key: %v", err)
+	}
+
+	algorithm, encrypted, err := encrypt(pkcs8Key, password)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: *algorithm, EncryptedData: encrypted})
+	if err != nil {
+		return nil, err
+	}
+	return &safeBag{
+		ID:         oidShroudedKeyBag,
+		Value:      asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value},
+		Attributes: attributes,
+	}, nil
+}
+
+func newDataContentInfo(content []byte) (*contentInfo, error) {
+	data, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return &contentInfo{
+		ContentType: oidData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	}, nil
+}
+
+func newEncryptedContentInfo(content []byte, password string, encrypt encryptFunc) (*contentInfo, error) {
+	algorithm, encrypted, err := encrypt(content, password)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := asn1.Marshal(encryptedData{
+		Version: 0,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: *algorithm,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &contentInfo{
+		ContentType: oidEncryptedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	}, nil
+}
+
+// pbes2Encrypt encrypts the data with AES-256-CBC, using a key derived from the password with PBKDF2
+func pbes2Encrypt(data []byte, password string, iterations int) (*pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, err
+	}
+
+	// PBES2 uses the password as UTF-8 bytes, unlike the PKCS #12 KDF
+	key := pbkdf2.Key([]byte(password), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypted := pad(data, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHmacWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}, encrypted, nil
+}
+
+// pbeSHA1TripleDESEncrypt encrypts the data with pbeWithSHAAnd3-KeyTripleDES-CBC from RFC 7292 appendix C, deriving
+// the key and IV from the password with the PKCS #12 KDF
+func pbeSHA1TripleDESEncrypt(data []byte, password string, iterations int) (*pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, legacySaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+
+	encodedPassword, err := bmpString(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := pkcs12KDF(sha1.New, encodedPassword, salt, pkcs12KDFEncKeyID, iterations, 24)
+	iv := pkcs12KDF(sha1.New, encodedPassword, salt, pkcs12KDFIVID, iterations, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypted := pad(data, des.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: iterations})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pkix.AlgorithmIdentifier{Algorithm: oidPBESHA3DES, Parameters: asn1.RawValue{FullBytes: params}}, encrypted, nil
+}
+
+// pad returns a copy of the data padded to a multiple of the block size, as described in RFC 5652 section 6.3
+func pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	result := make([]byte, len(data)+padding)
+	copy(result, data)
+	for i := len(data); i < len(result); i++ {
+		result[i] = byte(padding)
+	}
+	return result
+}
+
+// pkcs12KDF implements the key derivation function from RFC 7292 appendix B.2, used to derive the MAC key and the
+// keys and IVs of the legacy encryption
+func pkcs12KDF(h func() hash.Hash, password, salt []byte, id byte, iterations, size int) []byte {
+	hasher := h()
+	v := hasher.BlockSize()
+
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		length := v * ((len(data) + v - 1) / v)
+		result := make([]byte, length)
+		for i := range result {
+			result[i] = data[i%len(data)]
+		}
+		return result
+	}
+	I := append(fill(salt), fill(password)...)
+
+	var result []byte
+	for len(result) < size {
+		hasher.Reset()
+		hasher.Write(D)
+		hasher.Write(I)
+		A := hasher.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			hasher.Reset()
+			hasher.Write(A)
+			A = hasher.Sum(A[:0])
+		}
+		result = append(result, A...)
+
+		if len(result) < size {
+			// I_j = (I_j + B + 1) mod 2^(v*8) for each v sized block of I
+			B := fill(A)[:v]
+			for j := 0; j < len(I); j += v {
+				carry := 1
+				for k := v - 1; k >= 0; k-- {
+					sum := int(I[j+k]) + int(B[k]) + carry
+					I[j+k] = byte(sum)
+					carry = sum >> 8
+				}
+			}
+		}
+	}
+	return result[:size]
+}
+
+// bmpString encodes the string as a null terminated big endian UTF-16 string, as used for PKCS #12 passwords
+func bmpString(s string) ([]byte, error) {
+	result := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if r > 0xffff {
+			return nil, fmt.Errorf("character %q is not supported in PKCS #12 passwords and names", r)
+		}
+		encoded := utf16.Encode([]rune{r})
+		result = append(result, byte(encoded[0]>>8), byte(encoded[0]))
+	}
+	return append(result, 0, 0), nil
+}
@@ -0,0 +1,151 @@
+package pkcs12
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	xpkcs12 "golang.org/x/crypto/pkcs12"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return data
+}
+
+// TestPKCS12KDF checks the key derivation of RFC 7292 appendix B.2 against known answers, from the BouncyCastle
+// PKCS #12 tests and the golang.org/x/crypto/pkcs12 tests
+func TestPKCS12KDF(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		id         byte
+		iterations int
+		expected   string
+	}{
+		{"smeg", "0A58CF64530D823F", pkcs12KDFEncKeyID, 1, "8AAAE6297B6CB04642AB5B077851284EB7128F1A2A7FBCA3"},
+		{"smeg", "0A58CF64530D823F", pkcs12KDFIVID, 1, "79993DFE048D3B76"},
+		{"smeg", "3D83C0E4546AC140", pkcs12KDFMacKeyID, 1, "8D967D88F6CAA9D714800AB3D48051D63F73A312"},
+		{"queeg", "05DEC959ACFF72F7", pkcs12KDFEncKeyID, 1000, "ED2034E36328830FF09DF1E1A07DD357185DAC0D4F9EB3D4"},
+		{"queeg", "05DEC959ACFF72F7", pkcs12KDFIVID, 1000, "11DEDAD7758D4860"},
+		{"sesame", "FFFFFFFFFFFFFFFF", pkcs12KDFEncKeyID, 2048, "7CD9FD3E2B3BE7691A44E3BEF0F9EA0FB9B897D4E325D9D1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.password+"/"+test.salt, func(t *testing.T) {
+			password, err := bmpString(test.password)
+			require.NoError(t, err)
+			expected := mustHex(t, test.expected)
+			key := pkcs12KDF(sha1.New, password, mustHex(t, test.salt), test.id, test.iterations, len(expected))
+			require.Equal(t, expected, key)
+		})
+	}
+}
+
+// TestPKCS12KDFLeadingZeros checks the case where adding B to a block of I leaves a leading zero byte, from the
+// golang.org/x/crypto/pkcs12 tests
+func TestPKCS12KDFLeadingZeros(t *testing.T) {
+	key := pkcs12KDF(sha1.New, []byte{0, 0}, mustHex(t, "F37E05B518324B4B"), pkcs12KDFEncKeyID, 2048, 24)
+	require.Equal(t, mustHex(t, "00F759FF47D14DD03665D5943CB3C4A39A2555C02AED66E1"), key)
+}
+
+func TestBmpString(t *testing.T) {
+	req := require.New(t)
+
+	encoded, err := bmpString("Beavis")
+	req.NoError(err)
+	req.Equal(mustHex(t, "0042006500610076006900730000"), encoded)
+
+	encoded, err = bmpString("")
+	req.NoError(err)
+	req.Equal([]byte{0, 0}, encoded)
+
+	_, err = bmpString("\U0001F512")
+	req.Error(err)
+}
+
+// TestPBESHA1TripleDESEncrypt decrypts the output of pbeSHA1TripleDESEncrypt with the key and IV derived from its
+// parameters, for data which is and isn't a multiple of the block size
+func TestPBESHA1TripleDESEncrypt(t *testing.T) {
+	for _, data := range []string{"", "short", "exactly8", "longer than a single 3DES block"} {
+		t.Run(data, func(t *testing.T) {
+			req := require.New(t)
+
+			algorithm, encrypted, err := pbeSHA1TripleDESEncrypt([]byte(data), "s3cret", 100)
+			req.NoError(err)
+			req.Equal(oidPBESHA3DES, algorithm.Algorithm)
+			req.Equal(0, len(encrypted)%des.BlockSize)
+			req.Greater(len(encrypted), len(data))
+
+			params := pbeParams{}
+			_, err = asn1.Unmarshal(algorithm.Parameters.FullBytes, &params)
+			req.NoError(err)
+			req.Len(params.Salt, legacySaltLength)
+			req.Equal(100, params.Iterations)
+
+			password, err := bmpString("s3cret")
+			req.NoError(err)
+			key := pkcs12KDF(sha1.New, password, params.Salt, pkcs12KDFEncKeyID, params.Iterations, 24)
+			iv := pkcs12KDF(sha1.New, password, params.Salt, pkcs12KDFIVID, params.Iterations, des.BlockSize)
+			block, err := des.NewTripleDESCipher(key)
+			req.NoError(err)
+
+			decrypted := make([]byte, len(encrypted))
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+			padding := int(decrypted[len(decrypted)-1])
+			req.Equal(len(encrypted)-len(data), padding)
+			for _, b := range decrypted[len(data):] {
+				req.Equal(byte(padding), b)
+			}
+			req.Equal(data, string(decrypted[:len(data)]))
+		})
+	}
+}
+
+// TestEncodeLegacyDecode reads a legacy archive with golang.org/x/crypto/pkcs12, which only supports PBE-SHA1-3DES
+// and SHA-1 MACs
+func TestEncodeLegacyDecode(t *testing.T) {
+	req := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "legacy"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	req.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	req.NoError(err)
+
+	pfx, err := EncodeWithOptions(key, cert, nil, "s3cret", "legacy", Options{Legacy: true, Iterations: 1000})
+	req.NoError(err)
+
+	decodedKey, decodedCert, err := xpkcs12.Decode(pfx, "s3cret")
+	req.NoError(err)
+	req.True(key.Equal(decodedKey))
+	req.Equal(cert.Raw, decodedCert.Raw)
+
+	_, _, err = xpkcs12.Decode(pfx, "wrong")
+	req.Equal(xpkcs12.ErrIncorrectPassword, err)
+
+	// the default PBES2 archives aren't readable by it, which is what the legacy option is for
+	pfx, err = EncodeWithOptions(key, cert, nil, "s3cret", "modern", Options{})
+	req.NoError(err)
+	_, _, err = xpkcs12.Decode(pfx, "s3cret")
+	req.Error(err)
+}
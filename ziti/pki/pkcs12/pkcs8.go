@@ -0,0 +1,151 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidHmacWithSHA1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidAES128CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+)
+
+// ErrIncorrectKeyPassword is returned when an encrypted private key can't be decrypted with the password given
+var ErrIncorrectKeyPassword = errors.New("incorrect password for the encrypted private key")
+
+// EncryptPrivateKey returns the private key as a PKCS #8 EncryptedPrivateKeyInfo
+// (RFC 5958), encrypted with the password using the same PBES2 scheme as the
+// keys of PKCS #12 archives. It's written in PEM blocks of type
+// "ENCRYPTED PRIVATE KEY", as by openssl pkcs8 -topk8.
+func EncryptPrivateKey(key crypto.PrivateKey, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("a password is required to encrypt a private key")
+	}
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling private key: %v", err)
+	}
+	algorithm, encrypted, err := pbes2Encrypt(pkcs8Key, password, DefaultIterations)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: *algorithm, EncryptedData: encrypted})
+}
+
+// IsEncryptedPrivateKey returns whether the raw bytes are a PKCS #8
+// EncryptedPrivateKeyInfo.
+func IsEncryptedPrivateKey(der []byte) bool {
+	var info encryptedPrivateKeyInfo
+	rest, err := asn1.Unmarshal(der, &info)
+	return err == nil && len(rest) == 0 && info.Algorithm.Algorithm.Equal(oidPBES2)
+}
+
+// DecryptPrivateKey decrypts a PKCS #8 EncryptedPrivateKeyInfo with the
+// password. PBES2 with PBKDF2 using HMAC-SHA1 or HMAC-SHA256 and AES-CBC is
+// supported, which covers the keys written by EncryptPrivateKey and OpenSSL.
+func DecryptPrivateKey(der []byte, password string) (crypto.PrivateKey, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return nil, errors.New("not a PKCS #8 encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption algorithm %v", info.Algorithm.Algorithm)
+	}
+	pkcs8Key, err := pbes2Decrypt(info.Algorithm.Parameters.FullBytes, info.EncryptedData, password)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(pkcs8Key)
+	if err != nil {
+		// a wrong password usually fails the padding check, but may produce garbage with valid padding
+		return nil, ErrIncorrectKeyPassword
+	}
+	return key, nil
+}
+
+// pbes2Decrypt decrypts data encrypted by pbes2Encrypt, or by OpenSSL with any AES-CBC cipher
+func pbes2Decrypt(rawParams, data []byte, password string) ([]byte, error) {
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(rawParams, &params); err != nil {
+		return nil, fmt.Errorf("failed parsing PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("failed parsing PBKDF2 parameters: %v", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHmacWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHmacWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %v", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %v", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC initialization vector")
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+
+	key := pbkdf2.Key([]byte(password), kdfParams.Salt, kdfParams.IterationCount, keyLen, prf)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectKeyPassword
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
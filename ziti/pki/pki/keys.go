@@ -0,0 +1,90 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+)
+
+// Supported private key algorithms.
+const (
+	KeyAlgorithmRSA     = "rsa"
+	KeyAlgorithmECDSA   = "ecdsa"
+	KeyAlgorithmEd25519 = "ed25519"
+)
+
+// KeyAlgorithms lists the supported private key algorithms.
+var KeyAlgorithms = []string{KeyAlgorithmRSA, KeyAlgorithmECDSA, KeyAlgorithmEd25519}
+
+// Curves lists the supported elliptic curves for ECDSA keys, P-256 being the
+// default.
+var Curves = []string{"P-256", "P-384", "P-521"}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch strings.ToUpper(name) {
+	case "", "P-256", "P256":
+		return elliptic.P256(), nil
+	case "P-384", "P384":
+		return elliptic.P384(), nil
+	case "P-521", "P521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported curve %v, must be one of %v", name, strings.Join(Curves, ", "))
+}
+
+// ValidateKeyAlgorithm checks that the given key algorithm and curve can be
+// used to generate private keys. The curve is only used for ECDSA keys, as
+// Ed25519 keys always use Curve25519.
+func ValidateKeyAlgorithm(algorithm, curve string) error {
+	switch strings.ToLower(algorithm) {
+	case "", KeyAlgorithmRSA, KeyAlgorithmEd25519:
+		return nil
+	case KeyAlgorithmECDSA:
+		_, err := curveByName(curve)
+		return err
+	}
+	return fmt.Errorf("unsupported key algorithm %v, must be one of %v", algorithm, strings.Join(KeyAlgorithms, ", "))
+}
+
+// generatePrivateKey generates a private key as configured by the request,
+// defaulting to an RSA key.
+func generatePrivateKey(req *Request) (crypto.Signer, error) {
+	switch strings.ToLower(req.KeyAlgorithm) {
+	case "", KeyAlgorithmRSA:
+		if req.PrivateKeySize == 0 {
+			req.PrivateKeySize = defaultPrivateKeySize
+		}
+		return rsa.GenerateKey(rand.Reader, req.PrivateKeySize)
+	case KeyAlgorithmECDSA:
+		curve, err := curveByName(req.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %v, must be one of %v", req.KeyAlgorithm, strings.Join(KeyAlgorithms, ", "))
+}
@@ -0,0 +1,452 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsKMSScheme = "awskms"
+	gcpKMSScheme = "gcpkms"
+)
+
+// KMSSigner is a Signer for a CA private key held in a cloud key management
+// service. The key is used through the service's sign operation and never
+// leaves it, so only public material is kept in the store.
+//
+// The key is given by a URI, either for AWS KMS, with the key id, alias or ARN
+// as path
+//
+//	awskms:///alias/ziti-root?region=us-east-1
+//
+// or for GCP Cloud KMS, with the resource name of the key version as path
+//
+//	gcpkms://projects/ziti/locations/global/keyRings/pki/cryptoKeys/root/cryptoKeyVersions/1
+//
+// An endpoint query parameter overrides the service endpoint, such as for a
+// VPC endpoint or emulator. AWS credentials are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and the region, if not given,
+// from the ARN, AWS_REGION or AWS_DEFAULT_REGION. The GCP access token is read
+// from GOOGLE_OAUTH_ACCESS_TOKEN, or else obtained with gcloud.
+type KMSSigner struct {
+	URI string
+	// Client is used for the requests to the service. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// CAKey returns the private key in the service. The same key is used for any
+// CA, so it's checked against the CA's certificate by the caller.
+func (s *KMSSigner) CAKey(_ string, _ *x509.Certificate) (crypto.Signer, error) {
+	return NewKMSKey(s.URI, s.Client)
+}
+
+// kmsBackend performs the operations of a cloud key management service.
+type kmsBackend interface {
+	publicKey() ([]byte, error)
+	sign(digest []byte, hash crypto.Hash, isRSA, pss bool) ([]byte, error)
+}
+
+// kmsKey is a crypto.Signer whose signatures are made by a key management
+// service.
+type kmsKey struct {
+	uri     string
+	backend kmsBackend
+	public  crypto.PublicKey
+}
+
+// NewKMSKey returns the key given by a KMS URI, as described by KMSSigner, as
+// a crypto.Signer. Its public key is fetched from the service.
+func NewKMSKey(uri string, client *http.Client) (crypto.Signer, error) {
+	backend, err := parseKMSURI(uri, client)
+	if err != nil {
+		return nil, err
+	}
+	der, err := backend.publicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching public key of %v: %v", uri, err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing public key of %v: %v", uri, err)
+	}
+	switch public.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T of %v, only RSA and ECDSA keys can be used", public, uri)
+	}
+	return &kmsKey{uri: uri, backend: backend, public: public}, nil
+}
+
+// ValidateKMSURI checks that a KMS URI is well formed, without contacting the
+// service.
+func ValidateKMSURI(uri string) error {
+	_, err := parseKMSURI(uri, nil)
+	return err
+}
+
+func (k *kmsKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *kmsKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return nil, fmt.Errorf("unsupported hash %v for signing with %v", hash, k.uri)
+	}
+	_, pss := opts.(*rsa.PSSOptions)
+	_, isRSA := k.public.(*rsa.PublicKey)
+	if !isRSA && pss {
+		return nil, fmt.Errorf("RSA-PSS signatures need an RSA key, %v isn't one", k.uri)
+	}
+	signature, err := k.backend.sign(digest, hash, isRSA, pss)
+	if err != nil {
+		return nil, fmt.Errorf("failed signing with %v: %v", k.uri, err)
+	}
+	return signature, nil
+}
+
+func parseKMSURI(uri string, client *http.Client) (kmsBackend, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMS URI %v: %v", uri, err)
+	}
+	switch parsed.Scheme {
+	case awsKMSScheme:
+		return newAWSKMS(uri, parsed, client)
+	case gcpKMSScheme:
+		return newGCPKMS(uri, parsed, client)
+	default:
+		return nil, fmt.Errorf("invalid KMS URI %v, must start with %v:// or %v://", uri, awsKMSScheme, gcpKMSScheme)
+	}
+}
+
+// kmsDo sends a request to a key management service and decodes the JSON
+// response, returning the error message of the service if it failed.
+func kmsDo(client *http.Client, req *http.Request, result interface{}, errorMessage func([]byte) string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if msg := errorMessage(body); msg != "" {
+			return fmt.Errorf("%v: %v", resp.Status, msg)
+		}
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// awsKMS signs with an AWS KMS key, using the KMS JSON API with Signature
+// Version 4 signed requests.
+type awsKMS struct {
+	client   *http.Client
+	keyId    string
+	region   string
+	endpoint string
+}
+
+func newAWSKMS(uri string, parsed *url.URL, client *http.Client) (*awsKMS, error) {
+	keyId := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host != "" || keyId == "" {
+		return nil, fmt.Errorf("invalid KMS URI %v, must be %v:///<key id, alias or ARN>", uri, awsKMSScheme)
+	}
+
+	region := parsed.Query().Get("region")
+	if region == "" && strings.HasPrefix(keyId, "arn:") {
+		// arn:<partition>:kms:<region>:<account>:key/<id>
+		if parts := strings.Split(keyId, ":"); len(parts) > 3 {
+			region = parts[3]
+		}
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("no region for KMS URI %v, set the region query parameter or AWS_REGION", uri)
+	}
+
+	endpoint := parsed.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "https://kms." + region + ".amazonaws.com/"
+	}
+	return &awsKMS{client: client, keyId: keyId, region: region, endpoint: endpoint}, nil
+}
+
+func (a *awsKMS) publicKey() ([]byte, error) {
+	result := struct {
+		PublicKey []byte
+	}{}
+	if err := a.call("GetPublicKey", map[string]interface{}{"KeyId": a.keyId}, &result); err != nil {
+		return nil, err
+	}
+	return result.PublicKey, nil
+}
+
+func (a *awsKMS) sign(digest []byte, hash crypto.Hash, isRSA, pss bool) ([]byte, error) {
+	bits := map[crypto.Hash]string{crypto.SHA256: "256", crypto.SHA384: "384", crypto.SHA512: "512"}[hash]
+	algorithm := "ECDSA_SHA_" + bits
+	if isRSA {
+		algorithm = "RSASSA_PKCS1_V1_5_SHA_" + bits
+		if pss {
+			algorithm = "RSASSA_PSS_SHA_" + bits
+		}
+	}
+
+	result := struct {
+		Signature []byte
+	}{}
+	request := map[string]interface{}{
+		"KeyId":            a.keyId,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": algorithm,
+	}
+	if err := a.call("Sign", request, &result); err != nil {
+		return nil, err
+	}
+	return result.Signature, nil
+}
+
+// call calls the named KMS operation
+func (a *awsKMS) call(operation string, request interface{}, result interface{}) error {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("no AWS credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSRequest(req, body, a.region, "kms", accessKey, secretKey, time.Now().UTC())
+
+	return kmsDo(a.client, req, result, func(body []byte) string {
+		failure := struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(body, &failure) != nil {
+			return ""
+		}
+		return strings.TrimSpace(failure.Type + " " + failure.Message)
+	})
+}
+
+// signAWSRequest adds the AWS Signature Version 4 authorization to the request
+func signAWSRequest(req *http.Request, body []byte, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpKMS signs with a GCP Cloud KMS key version, using the Cloud KMS REST API.
+type gcpKMS struct {
+	client   *http.Client
+	name     string
+	endpoint string
+}
+
+func newGCPKMS(uri string, parsed *url.URL, client *http.Client) (*gcpKMS, error) {
+	name := strings.Trim(parsed.Host+parsed.Path, "/")
+	parts := strings.Split(name, "/")
+	if len(parts) != 10 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" ||
+		parts[6] != "cryptoKeys" || parts[8] != "cryptoKeyVersions" {
+		return nil, fmt.Errorf("invalid KMS URI %v, must be %v://projects/<project>/locations/<location>/keyRings/<key ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>", uri, gcpKMSScheme)
+	}
+
+	endpoint := parsed.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "https://cloudkms.googleapis.com/v1/"
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return &gcpKMS{client: client, name: name, endpoint: endpoint}, nil
+}
+
+func (g *gcpKMS) publicKey() ([]byte, error) {
+	result := struct {
+		Pem string `json:"pem"`
+	}{}
+	if err := g.call(http.MethodGet, "/publicKey", nil, &result); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(result.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key returned for %v", g.name)
+	}
+	return block.Bytes, nil
+}
+
+func (g *gcpKMS) sign(digest []byte, hash crypto.Hash, _, _ bool) ([]byte, error) {
+	// the padding of RSA signatures is fixed by the algorithm of the key version
+	digestName := map[crypto.Hash]string{crypto.SHA256: "sha256", crypto.SHA384: "sha384", crypto.SHA512: "sha512"}[hash]
+	request := map[string]interface{}{
+		"digest": map[string][]byte{digestName: digest},
+	}
+	result := struct {
+		Signature []byte `json:"signature"`
+	}{}
+	if err := g.call(http.MethodPost, ":asymmetricSign", request, &result); err != nil {
+		return nil, err
+	}
+	return result.Signature, nil
+}
+
+// call calls the given method of the key version
+func (g *gcpKMS) call(method, suffix string, request interface{}, result interface{}) error {
+	token, err := gcpAccessToken()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, g.endpoint+g.name+suffix, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return kmsDo(g.client, req, result, func(body []byte) string {
+		failure := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		if json.Unmarshal(body, &failure) != nil {
+			return ""
+		}
+		return failure.Error.Message
+	})
+}
+
+// gcpAccessToken returns the OAuth access token for Cloud KMS requests
+func gcpAccessToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	out, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		return "", fmt.Errorf("no GCP access token, set GOOGLE_OAUTH_ACCESS_TOKEN or log in with gcloud: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
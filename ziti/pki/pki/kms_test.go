@@ -0,0 +1,282 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSignAWSRequest checks the Signature Version 4 signing against the examples of the AWS documentation and test
+// suite, which use these credentials and time
+func TestSignAWSRequest(t *testing.T) {
+	const accessKey, secretKey = "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		url           string
+		region        string
+		service       string
+		headers       map[string]string
+		authorization string
+	}{
+		{
+			name:    "get-vanilla",
+			url:     "https://example.amazonaws.com/",
+			region:  "us-east-1",
+			service: "service",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:    "iam list users",
+			url:     "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			region:  "us-east-1",
+			service: "iam",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"},
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			require.NoError(t, err)
+			for name, val := range test.headers {
+				req.Header.Set(name, val)
+			}
+			signAWSRequest(req, nil, test.region, test.service, accessKey, secretKey, now)
+			require.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			require.Equal(t, test.authorization, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+// newTestKMSCert returns a certificate signed with the signer, after checking its signature
+func newTestKMSCert(t *testing.T, signer crypto.Signer, signatureAlgorithm x509.SignatureAlgorithm) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kms-ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		SignatureAlgorithm:    signatureAlgorithm,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.NoError(t, cert.CheckSignatureFrom(cert))
+	return cert
+}
+
+// fakeAWSKMS implements the GetPublicKey and Sign operations of the KMS JSON API for a single key
+type fakeAWSKMS struct {
+	key        crypto.Signer
+	keyId      string
+	algorithms []string
+}
+
+func (f *fakeAWSKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, errType, msg string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": errType, "message": msg})
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIATEST/") || !strings.Contains(authorization, "/us-east-1/kms/aws4_request") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Security-Token") != "session" {
+		fail(http.StatusForbidden, "UnrecognizedClientException", "bad authorization "+authorization)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/x-amz-json-1.1" {
+		fail(http.StatusBadRequest, "SerializationException", "bad content type")
+		return
+	}
+
+	var request struct {
+		KeyId            string
+		Message          []byte
+		MessageType      string
+		SigningAlgorithm string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		fail(http.StatusBadRequest, "SerializationException", err.Error())
+		return
+	}
+	if request.KeyId != f.keyId {
+		fail(http.StatusBadRequest, "NotFoundException", "no key "+request.KeyId)
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "TrentService.GetPublicKey":
+		der, err := x509.MarshalPKIXPublicKey(f.key.Public())
+		if err != nil {
+			fail(http.StatusInternalServerError, "KMSInternalException", err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": f.keyId, "PublicKey": der})
+	case "TrentService.Sign":
+		if request.MessageType != "DIGEST" {
+			fail(http.StatusBadRequest, "ValidationException", "only digests are signed by the fake")
+			return
+		}
+		f.algorithms = append(f.algorithms, request.SigningAlgorithm)
+		var opts crypto.SignerOpts = crypto.SHA256
+		if strings.HasPrefix(request.SigningAlgorithm, "RSASSA_PSS_") {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		}
+		signature, err := f.key.Sign(rand.Reader, request.Message, opts)
+		if err != nil {
+			fail(http.StatusInternalServerError, "KMSInternalException", err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": f.keyId, "Signature": signature, "SigningAlgorithm": request.SigningAlgorithm})
+	default:
+		fail(http.StatusBadRequest, "UnknownOperationException", r.Header.Get("X-Amz-Target"))
+	}
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	req := require.New(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIATEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+	fake := &fakeAWSKMS{key: ecKey, keyId: "alias/ziti-root"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	signer := &KMSSigner{URI: "awskms:///alias/ziti-root?region=us-east-1&endpoint=" + server.URL + "/", Client: server.Client()}
+	key, err := signer.CAKey("root", nil)
+	req.NoError(err)
+	req.True(ecKey.PublicKey.Equal(key.Public()))
+	newTestKMSCert(t, key, x509.ECDSAWithSHA256)
+	req.Equal([]string{"ECDSA_SHA_256"}, fake.algorithms)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	req.NoError(err)
+	fake.key, fake.algorithms = rsaKey, nil
+	key, err = signer.CAKey("root", nil)
+	req.NoError(err)
+	newTestKMSCert(t, key, x509.SHA256WithRSA)
+	newTestKMSCert(t, key, x509.SHA256WithRSAPSS)
+	req.Equal([]string{"RSASSA_PKCS1_V1_5_SHA_256", "RSASSA_PSS_SHA_256"}, fake.algorithms)
+
+	// the error of the service is reported
+	signer.URI = "awskms:///alias/missing?region=us-east-1&endpoint=" + server.URL + "/"
+	_, err = signer.CAKey("root", nil)
+	req.Error(err)
+	req.Contains(err.Error(), "NotFoundException no key alias/missing")
+}
+
+// fakeGCPKMS implements the getPublicKey and asymmetricSign methods of the Cloud KMS REST API for a single key version
+type fakeGCPKMS struct {
+	key  crypto.Signer
+	name string
+}
+
+func (f *fakeGCPKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": msg}})
+	}
+	if r.Header.Get("Authorization") != "Bearer gcp-token" {
+		fail(http.StatusUnauthorized, "Request had invalid authentication credentials.")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case r.Method == http.MethodGet && path == f.name+"/publicKey":
+		der, err := x509.MarshalPKIXPublicKey(f.key.Public())
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			"algorithm": "EC_SIGN_P256_SHA256",
+		})
+	case r.Method == http.MethodPost && path == f.name+":asymmetricSign":
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			Digest map[string][]byte `json:"digest"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil || len(request.Digest["sha256"]) != sha256.Size {
+			fail(http.StatusBadRequest, "invalid digest "+string(body))
+			return
+		}
+		signature, err := f.key.Sign(rand.Reader, request.Digest["sha256"], crypto.SHA256)
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"signature": signature, "name": f.name})
+	default:
+		fail(http.StatusNotFound, "CryptoKeyVersion "+path+" not found.")
+	}
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	req := require.New(t)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "gcp-token")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req.NoError(err)
+	name := "projects/ziti/locations/global/keyRings/pki/cryptoKeys/root/cryptoKeyVersions/1"
+	server := httptest.NewServer(&fakeGCPKMS{key: ecKey, name: name})
+	defer server.Close()
+
+	signer := &KMSSigner{URI: "gcpkms://" + name + "?endpoint=" + server.URL + "/v1", Client: server.Client()}
+	key, err := signer.CAKey("root", nil)
+	req.NoError(err)
+	req.True(ecKey.PublicKey.Equal(key.Public()))
+	newTestKMSCert(t, key, x509.ECDSAWithSHA256)
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "expired")
+	_, err = signer.CAKey("root", nil)
+	req.Error(err)
+	req.Contains(err.Error(), "invalid authentication credentials")
+}
+
+func TestParseKMSURI(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	backend, err := parseKMSURI("awskms:///arn:aws:kms:eu-west-1:111122223333:key/1234", nil)
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-1", backend.(*awsKMS).region)
+	require.Equal(t, "https://kms.eu-west-1.amazonaws.com/", backend.(*awsKMS).endpoint)
+
+	for _, uri := range []string{
+		"awskms://host/alias/root?region=us-east-1",
+		"awskms:///alias/root",
+		"gcpkms://projects/ziti/locations/global/keyRings/pki/cryptoKeys/root",
+		"pkcs11:token=ziti",
+	} {
+		require.Error(t, ValidateKMSURI(uri), uri)
+	}
+}
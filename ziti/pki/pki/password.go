@@ -0,0 +1,68 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/openziti/identity/certtools"
+	"github.com/openziti/ziti/ziti/pki/certificate"
+	"github.com/openziti/ziti/ziti/pki/pkcs12"
+)
+
+// KeyPasswordFunc returns the password of the encrypted private key name
+// within CA caName. It's only called when an encrypted key is read, so it may
+// prompt for the password.
+type KeyPasswordFunc func(caName, name string) (string, error)
+
+// marshalPrivateKey returns the raw bytes of a private key to store,
+// encrypted as PKCS #8 if a key password is set.
+func (e *ZitiPKI) marshalPrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	if e.KeyPassword == "" {
+		return certificate.MarshalPrivateKey(key)
+	}
+	return pkcs12.EncryptPrivateKey(key, e.KeyPassword)
+}
+
+// loadPrivateKey parses a PEM encoded private key read from the store,
+// decrypting it with the password from the given function if it's encrypted.
+func loadPrivateKey(caName, name string, raw []byte, password KeyPasswordFunc) (crypto.PrivateKey, error) {
+	if block, _ := pem.Decode(raw); block != nil && pkcs12.IsEncryptedPrivateKey(block.Bytes) {
+		return decryptPrivateKey(caName, name, block.Bytes, password)
+	}
+	return certtools.LoadPrivateKey(raw)
+}
+
+// decryptPrivateKey decrypts the raw bytes of an encrypted private key read
+// from the store.
+func decryptPrivateKey(caName, name string, der []byte, password KeyPasswordFunc) (crypto.PrivateKey, error) {
+	if password == nil {
+		return nil, fmt.Errorf("private key %v within CA %v is encrypted and no password was given", name, caName)
+	}
+	pass, err := password(caName, name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := pkcs12.DecryptPrivateKey(der, pass)
+	if errors.Is(err, pkcs12.ErrIncorrectKeyPassword) {
+		return nil, fmt.Errorf("incorrect password for private key %v within CA %v", name, caName)
+	}
+	return key, err
+}
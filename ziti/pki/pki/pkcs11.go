@@ -0,0 +1,165 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/openziti/identity/certtools"
+)
+
+const pkcs11EngineId = "pkcs11"
+
+// PKCS11Signer is a Signer for a CA private key held in a PKCS #11 token, such
+// as an HSM. The key is used through the token and never leaves it.
+//
+// The key is given by a PKCS #11 URI (RFC 7512), such as
+//
+//	pkcs11:id=%01;slot-id=0?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/etc/ziti/hsm.pin
+//
+// or by a key URL as used in Ziti identity configurations, such as
+//
+//	pkcs11:/usr/lib/softhsm/libsofthsm2.so?slot=0&id=01&pin=1234
+type PKCS11Signer struct {
+	URI string
+}
+
+// CAKey returns the private key in the token. The same key is used for any
+// CA, so it's checked against the CA's certificate by the caller.
+func (s *PKCS11Signer) CAKey(_ string, _ *x509.Certificate) (key crypto.Signer, err error) {
+	keyURL, err := ParsePKCS11URI(s.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	// the engine panics if the module can't be loaded
+	defer func() {
+		if r := recover(); r != nil {
+			key, err = nil, fmt.Errorf("failed loading PKCS #11 module %v: %v", keyURL.Path, r)
+		}
+	}()
+
+	pk, err := certtools.LoadEngineKey(pkcs11EngineId, keyURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading key from PKCS #11 token: %v", err)
+	}
+	key, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", pk)
+	}
+	return key, nil
+}
+
+// ParsePKCS11URI converts a PKCS #11 URI or Ziti key URL into the key URL
+// expected by the PKCS #11 engine of the identity library. Of the RFC 7512
+// attributes, id, slot-id, module-path, module-name, pin-value and pin-source
+// are supported. Tokens and objects can't be selected by label.
+func ParsePKCS11URI(uri string) (*url.URL, error) {
+	if !strings.HasPrefix(uri, pkcs11EngineId+":") {
+		return nil, fmt.Errorf("invalid PKCS #11 URI %v, must start with %v:", uri, pkcs11EngineId)
+	}
+
+	pathPart, queryPart := strings.TrimPrefix(uri, pkcs11EngineId+":"), ""
+	if idx := strings.Index(pathPart, "?"); idx >= 0 {
+		pathPart, queryPart = pathPart[:idx], pathPart[idx+1:]
+	}
+
+	query, err := url.ParseQuery(queryPart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PKCS #11 URI query %v: %v", queryPart, err)
+	}
+
+	result := url.Values{}
+	driver := ""
+
+	if strings.Contains(pathPart, "=") || pathPart == "" {
+		// RFC 7512 form, with path attributes separated by semicolons
+		for _, attr := range strings.Split(pathPart, ";") {
+			if attr == "" {
+				continue
+			}
+			kv := strings.SplitN(attr, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid PKCS #11 URI attribute %v", attr)
+			}
+			value, err := url.PathUnescape(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for PKCS #11 URI attribute %v: %v", kv[0], err)
+			}
+			switch kv[0] {
+			case "id":
+				result.Set("id", hex.EncodeToString([]byte(value)))
+			case "slot-id":
+				result.Set("slot", value)
+			case "object", "token", "serial", "model", "manufacturer", "library-description", "library-manufacturer",
+				"library-version", "slot-description", "slot-manufacturer", "type":
+				// selecting by these isn't supported by the engine, but they may narrow down an id given as well
+			default:
+				return nil, fmt.Errorf("unknown PKCS #11 URI attribute %v", kv[0])
+			}
+		}
+
+		driver = query.Get("module-path")
+		if driver == "" {
+			driver = query.Get("module-name")
+		}
+		if pin := query.Get("pin-value"); pin != "" {
+			result.Set("pin", pin)
+		}
+		if source := query.Get("pin-source"); source != "" {
+			pin, err := readPINSource(source)
+			if err != nil {
+				return nil, err
+			}
+			result.Set("pin", pin)
+		}
+		if result.Get("id") == "" {
+			return nil, fmt.Errorf("PKCS #11 URI %v must select the key by id", uri)
+		}
+	} else {
+		// Ziti key URL form, with the driver as path
+		driver = pathPart
+		for _, key := range []string{"slot", "id", "pin"} {
+			if value := query.Get(key); value != "" {
+				result.Set(key, value)
+			}
+		}
+	}
+
+	if driver == "" {
+		return nil, fmt.Errorf("PKCS #11 URI %v doesn't give the module (driver) to use", uri)
+	}
+
+	return &url.URL{Scheme: pkcs11EngineId, Path: driver, RawQuery: result.Encode()}, nil
+}
+
+// readPINSource reads the PIN from the file given by an RFC 7512 pin-source,
+// which is a file path or file URI.
+func readPINSource(source string) (string, error) {
+	path := strings.TrimPrefix(source, "file://")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed reading PKCS #11 PIN from %v: %v", path, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
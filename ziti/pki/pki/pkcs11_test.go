@@ -0,0 +1,83 @@
+package pki
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "hsm.pin")
+	require.NoError(t, ioutil.WriteFile(pinFile, []byte("s3cret\n"), 0600))
+
+	tests := []struct {
+		name   string
+		uri    string
+		driver string
+		query  string
+		err    string
+	}{
+		{
+			name:   "RFC 7512 id and slot-id",
+			uri:    "pkcs11:id=%01%a0;slot-id=2?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			driver: "/usr/lib/softhsm/libsofthsm2.so",
+			query:  "id=01a0&pin=1234&slot=2",
+		},
+		{
+			name:   "RFC 7512 textual id",
+			uri:    "pkcs11:id=ca;object=root-ca;token=ziti?module-name=libsofthsm2.so",
+			driver: "libsofthsm2.so",
+			query:  "id=6361",
+		},
+		{
+			name:   "RFC 7512 pin-source path",
+			uri:    "pkcs11:id=%01?module-path=/lib/hsm.so&pin-source=" + pinFile,
+			driver: "/lib/hsm.so",
+			query:  "id=01&pin=s3cret",
+		},
+		{
+			name:   "RFC 7512 pin-source file URI",
+			uri:    "pkcs11:id=%01?module-path=/lib/hsm.so&pin-source=file://" + pinFile,
+			driver: "/lib/hsm.so",
+			query:  "id=01&pin=s3cret",
+		},
+		{
+			name:   "Ziti key URL",
+			uri:    "pkcs11:/usr/lib/softhsm/libsofthsm2.so?slot=0&id=01&pin=1234",
+			driver: "/usr/lib/softhsm/libsofthsm2.so",
+			query:  "id=01&pin=1234&slot=0",
+		},
+		{
+			name:   "Ziti key URL ignores other parameters",
+			uri:    "pkcs11:/lib/hsm.so?id=01&label=ca",
+			driver: "/lib/hsm.so",
+			query:  "id=01",
+		},
+		{name: "other scheme", uri: "file:/etc/ziti/ca.key", err: "must start with pkcs11:"},
+		{name: "bad query", uri: "pkcs11:id=%01?module-path=%zz", err: "invalid PKCS #11 URI query"},
+		{name: "attribute without value", uri: "pkcs11:id=%01;slot-id?module-path=/lib/hsm.so", err: "invalid PKCS #11 URI attribute slot-id"},
+		{name: "bad percent encoding", uri: "pkcs11:id=%0g?module-path=/lib/hsm.so", err: "invalid value for PKCS #11 URI attribute id"},
+		{name: "unknown attribute", uri: "pkcs11:id=%01;color=red?module-path=/lib/hsm.so", err: "unknown PKCS #11 URI attribute color"},
+		{name: "no id", uri: "pkcs11:object=ca?module-path=/lib/hsm.so", err: "must select the key by id"},
+		{name: "empty", uri: "pkcs11:", err: "must select the key by id"},
+		{name: "no module", uri: "pkcs11:id=%01", err: "doesn't give the module"},
+		{name: "missing pin-source", uri: "pkcs11:id=%01?module-path=/lib/hsm.so&pin-source=/does/not/exist", err: "failed reading PKCS #11 PIN"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParsePKCS11URI(test.uri)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "pkcs11", result.Scheme)
+			require.Equal(t, test.driver, result.Path)
+			require.Equal(t, test.query, result.RawQuery)
+		})
+	}
+}
@@ -19,17 +19,17 @@ package pki
 
 import (
 	"crypto"
-	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/openziti/ziti/ziti/pki/certificate"
+	"github.com/openziti/ziti/ziti/pki/pkcs12"
 	"github.com/openziti/ziti/ziti/pki/store"
-	"github.com/openziti/identity/certtools"
 )
 
 const (
@@ -49,24 +49,69 @@ type Request struct {
 	KeyName             string
 	IsClientCertificate bool
 	PrivateKeySize      int
-	Template            *x509.Certificate
+	KeyAlgorithm        string
+	Curve               string
+	// SignatureAlgorithm is one of SignatureAlgorithms, or empty for the
+	// default of the signer's key.
+	SignatureAlgorithm string
+	Template           *x509.Certificate
+	// Key, if set, is the existing private key of a root CA which is held
+	// elsewhere, such as in a KMS. Only the certificate is stored.
+	Key crypto.Signer
 }
+
+// CSRRequest is a struct for providing configuration to CreateCSR when
+// generating a certificate signing request.
 type CSRRequest struct {
-	Name                string
-	IsClientCertificate bool
-	PrivateKey          rsa.PrivateKey
-	Template            *x509.CertificateRequest
+	Name           string
+	KeyName        string
+	PrivateKeySize int
+	KeyAlgorithm   string
+	Curve          string
+	// SignatureAlgorithm is one of SignatureAlgorithms, or empty for the
+	// default of the private key.
+	SignatureAlgorithm string
+	Template           *x509.CertificateRequest
 }
 
 // ZitiPKI wraps helpers to handle a Public Key Infrastructure.
 type ZitiPKI struct {
 	Store store.Store
+	// Signer provides the private keys of CAs. If nil, they're read from the
+	// store.
+	Signer Signer
+	// KeyPassword, if set, encrypts the private keys written to the store as
+	// PKCS #8.
+	KeyPassword string
+	// Password provides the passwords of encrypted private keys read from the
+	// store.
+	Password KeyPasswordFunc
+	// SerialStrategy is one of SerialStrategies, or empty for random serial
+	// numbers. It applies to certificates whose template has no serial number.
+	SerialStrategy string
 }
 
-// GetCA fetches and returns the named Certificate Authority bundle
-// from the store.
+// GetCA fetches and returns the named Certificate Authority bundle. The
+// certificate is read from the store and the private key from the Signer.
 func (e *ZitiPKI) GetCA(name string) (*certificate.Bundle, error) {
-	return e.GetBundle(name, name)
+	c, err := e.Store.FetchCert(name, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching CA %v: %v", name, err)
+	}
+	cert, err := x509.ParseCertificate(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate of CA %v: %v", name, err)
+	}
+
+	key, err := e.signer().CAKey(name, cert)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching private key of CA %v: %v", name, err)
+	}
+	if err := keyMatchesCert(key, cert); err != nil {
+		return nil, err
+	}
+
+	return &certificate.Bundle{Name: name, Key: key, Cert: cert}, nil
 }
 
 // GetBundle fetches and returns a certificate bundle from the store.
@@ -76,6 +121,15 @@ func (e *ZitiPKI) GetBundle(caName, name string) (*certificate.Bundle, error) {
 		return nil, fmt.Errorf("failed fetching bundle %v within CA %v: %v", name, caName, err)
 	}
 
+	if pkcs12.IsEncryptedPrivateKey(k) {
+		key, err := decryptPrivateKey(caName, name, k, e.Password)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = certificate.MarshalPrivateKey(key); err != nil {
+			return nil, err
+		}
+	}
 	return certificate.RawToBundle(name, k, c)
 }
 
@@ -85,7 +139,7 @@ func (e *ZitiPKI) GetPrivateKey(caname string, keyname string) (crypto.PrivateKe
 	if err != nil {
 		return nil, fmt.Errorf("failed fetching bundle %v within CA %v: %v", caname, keyname, err)
 	}
-	return certtools.LoadPrivateKey(k)
+	return loadPrivateKey(caname, keyname, k, e.Password)
 }
 
 // Sign signs a generated certificate bundle based on the given request with
@@ -99,13 +153,15 @@ func (e *ZitiPKI) Sign(signer *certificate.Bundle, req *Request) error {
 	}
 
 	var err error
-	var privateKey *rsa.PrivateKey
+	var privateKey crypto.Signer
 
-	if req.KeyName == "" {
-		if req.PrivateKeySize == 0 {
-			req.PrivateKeySize = defaultPrivateKeySize
+	if req.Key != nil {
+		if !req.Template.IsCA || signer != nil {
+			return errors.New("an existing private key held elsewhere can only be used for a root CA")
 		}
-		privateKey, err = rsa.GenerateKey(rand.Reader, req.PrivateKeySize)
+		privateKey = req.Key
+	} else if req.KeyName == "" {
+		privateKey, err = generatePrivateKey(req)
 		if err != nil {
 			return fmt.Errorf("failed generating private key: %v", err)
 		}
@@ -114,11 +170,19 @@ func (e *ZitiPKI) Sign(signer *certificate.Bundle, req *Request) error {
 		if err != nil {
 			return fmt.Errorf("failed fetching private key: %v", err)
 		}
-		privateKey = pk.(*rsa.PrivateKey)
+		var ok bool
+		if privateKey, ok = pk.(crypto.Signer); !ok {
+			return fmt.Errorf("unsupported private key type %T", pk)
+		}
 	}
 	publicKey := privateKey.Public()
 
-	if err := defaultTemplate(req, publicKey); err != nil {
+	// a root CA is issued from its own serial counter
+	caName := req.Name
+	if signer != nil {
+		caName = signer.Name
+	}
+	if err := e.defaultTemplate(caName, req, publicKey); err != nil {
 		return fmt.Errorf("failed updating generation request: %v", err)
 	}
 
@@ -138,7 +202,11 @@ func (e *ZitiPKI) Sign(signer *certificate.Bundle, req *Request) error {
 			signer = &certificate.Bundle{Name: req.Name, Cert: req.Template, Key: privateKey}
 		}
 	} else {
-		nonCATemplate(req)
+		nonCATemplate(req, publicKey)
+	}
+
+	if req.Template.SignatureAlgorithm, err = ResolveSignatureAlgorithm(req.SignatureAlgorithm, signer.Key); err != nil {
+		return err
 	}
 
 	rawCert, err := x509.CreateCertificate(rand.Reader, req.Template, signer.Cert, publicKey, signer.Key)
@@ -146,7 +214,60 @@ func (e *ZitiPKI) Sign(signer *certificate.Bundle, req *Request) error {
 		return fmt.Errorf("failed creating and signing certificate: %v", err)
 	}
 
-	if err := e.Store.Add(signer.Name, req.Name, req.Template.IsCA, x509.MarshalPKCS1PrivateKey(privateKey), rawCert); err != nil {
+	if req.Key != nil {
+		if err := e.Store.AddCert(signer.Name, req.Name, rawCert); err != nil {
+			return fmt.Errorf("failed saving generated certificate: %v", err)
+		}
+		return nil
+	}
+
+	rawKey, err := e.marshalPrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed marshaling private key: %v", err)
+	}
+
+	if err := e.Store.Add(signer.Name, req.Name, req.Template.IsCA, rawKey, rawCert); err != nil {
+		return fmt.Errorf("failed saving generated bundle: %v", err)
+	}
+	return nil
+}
+
+// SelfSign generates a private key and a certificate for a non CA request,
+// signed by its own key. The bundle is stored within a directory of its own
+// name, outside of any CA hierarchy.
+func (e *ZitiPKI) SelfSign(req *Request) error {
+	if req.Template.IsCA {
+		return errors.New("cannot self sign a CA request as a standalone certificate, sign it as a root CA instead")
+	}
+
+	privateKey, err := generatePrivateKey(req)
+	if err != nil {
+		return fmt.Errorf("failed generating private key: %v", err)
+	}
+	publicKey := privateKey.Public()
+
+	if err := e.defaultTemplate(req.Name, req, publicKey); err != nil {
+		return fmt.Errorf("failed updating generation request: %v", err)
+	}
+	nonCATemplate(req, publicKey)
+	req.Template.Issuer = req.Template.Subject
+	req.Template.AuthorityKeyId = req.Template.SubjectKeyId
+
+	if req.Template.SignatureAlgorithm, err = ResolveSignatureAlgorithm(req.SignatureAlgorithm, privateKey); err != nil {
+		return err
+	}
+
+	rawCert, err := x509.CreateCertificate(rand.Reader, req.Template, req.Template, publicKey, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed creating and signing certificate: %v", err)
+	}
+
+	rawKey, err := e.marshalPrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed marshaling private key: %v", err)
+	}
+
+	if err := e.Store.Add(req.Name, req.Name, false, rawKey, rawCert); err != nil {
 		return fmt.Errorf("failed saving generated bundle: %v", err)
 	}
 	return nil
@@ -162,19 +283,321 @@ func (e *ZitiPKI) Chain(signer *certificate.Bundle, req *Request) error {
 
 // Generate and store a private key
 func (e *ZitiPKI) GeneratePrivateKey(signer *certificate.Bundle, req *Request) error {
-	if req.PrivateKeySize == 0 {
-		req.PrivateKeySize = defaultPrivateKeySize
-	}
-	privateKey, err := rsa.GenerateKey(rand.Reader, req.PrivateKeySize)
+	privateKey, err := generatePrivateKey(req)
 	if err != nil {
 		return fmt.Errorf("failed generating private key: %v", err)
 	}
-	if err := e.Store.AddKey(signer.Name, req.KeyName, x509.MarshalPKCS1PrivateKey(privateKey)); err != nil {
+	rawKey, err := e.marshalPrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed marshaling private key: %v", err)
+	}
+	if err := e.Store.AddKey(signer.Name, req.KeyName, rawKey); err != nil {
 		return fmt.Errorf("failed saving generated key: %v", err)
 	}
 	return nil
 }
 
+// CreateCSR generates a certificate signing request and stores it along with
+// its private key, without signing it. The private key named by the request is
+// used if given, otherwise a new private key is generated.
+func (e *ZitiPKI) CreateCSR(caName string, req *CSRRequest) error {
+	var privateKey crypto.PrivateKey
+	if req.KeyName == "" {
+		var err error
+		privateKey, err = generatePrivateKey(&Request{
+			PrivateKeySize: req.PrivateKeySize,
+			KeyAlgorithm:   req.KeyAlgorithm,
+			Curve:          req.Curve,
+		})
+		if err != nil {
+			return fmt.Errorf("failed generating private key: %v", err)
+		}
+	} else {
+		var err error
+		if privateKey, err = e.GetPrivateKey(caName, req.KeyName); err != nil {
+			return fmt.Errorf("failed fetching private key: %v", err)
+		}
+	}
+	if req.SignatureAlgorithm != "" {
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("unsupported private key type %T", privateKey)
+		}
+		signatureAlgorithm, err := ResolveSignatureAlgorithm(req.SignatureAlgorithm, signer)
+		if err != nil {
+			return err
+		}
+		req.Template.SignatureAlgorithm = signatureAlgorithm
+	}
+	return e.CSR(caName, req.Name, *req.Template, privateKey)
+}
+
+// SignCSR signs a certificate signing request created elsewhere with the given
+// signer. The subject and SANs are taken from the CSR, while the validity and
+// CA settings come from the request template. As the private key stays with
+// whoever created the CSR, only the certificate is stored.
+func (e *ZitiPKI) SignCSR(signer *certificate.Bundle, csr *x509.CertificateRequest, req *Request) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid CSR signature: %v", err)
+	}
+	if req.Template.IsCA && signer.Cert.MaxPathLen == 0 {
+		return nil, ErrMaxPathLenReached
+	}
+
+	req.Template.Subject = csr.Subject
+	req.Template.DNSNames = csr.DNSNames
+	req.Template.IPAddresses = csr.IPAddresses
+	req.Template.EmailAddresses = csr.EmailAddresses
+	req.Template.URIs = csr.URIs
+
+	if err := e.defaultTemplate(signer.Name, req, csr.PublicKey); err != nil {
+		return nil, fmt.Errorf("failed updating generation request: %v", err)
+	}
+
+	if req.Template.IsCA {
+		if signer.Cert.MaxPathLen > 0 {
+			req.Template.MaxPathLen = signer.Cert.MaxPathLen - 1
+		}
+		if err := caTemplate(req, true); err != nil {
+			return nil, fmt.Errorf("failed updating generation request for CA: %v", err)
+		}
+	} else {
+		nonCATemplate(req, csr.PublicKey)
+	}
+
+	signatureAlgorithm, err := ResolveSignatureAlgorithm(req.SignatureAlgorithm, signer.Key)
+	if err != nil {
+		return nil, err
+	}
+	req.Template.SignatureAlgorithm = signatureAlgorithm
+
+	rawCert, err := x509.CreateCertificate(rand.Reader, req.Template, signer.Cert, csr.PublicKey, signer.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating and signing certificate: %v", err)
+	}
+
+	if err := e.Store.AddCert(signer.Name, req.Name, rawCert); err != nil {
+		return nil, fmt.Errorf("failed saving signed certificate: %v", err)
+	}
+	return x509.ParseCertificate(rawCert)
+}
+
+// RenewRequest is a struct for providing configuration to Renew when
+// re-issuing an existing certificate.
+type RenewRequest struct {
+	Name     string
+	NotAfter time.Time
+	// NewKey generates a new private key, using the key settings below,
+	// instead of keeping the existing one.
+	NewKey         bool
+	PrivateKeySize int
+	KeyAlgorithm   string
+	Curve          string
+	// Serial, if set, is the serial number of the renewed certificate instead
+	// of one picked by the serial strategy.
+	Serial *big.Int
+}
+
+// Renew re-issues an existing certificate with the given signer, keeping its
+// subject, SANs and usages, and replaces it in the store. The existing private
+// key is kept unless the request asks for a new one. The renewed certificate
+// is returned.
+func (e *ZitiPKI) Renew(signer *certificate.Bundle, req *RenewRequest) (*x509.Certificate, error) {
+	raw, err := e.Store.FetchCert(signer.Name, req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching certificate %v within CA %v: %v", req.Name, signer.Name, err)
+	}
+	current, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate %v: %v", req.Name, err)
+	}
+	if current.IsCA {
+		return nil, fmt.Errorf("certificate %v is a CA, only server and client certificates can be renewed", req.Name)
+	}
+
+	var privateKey crypto.Signer
+	var rawKey []byte
+	if req.NewKey {
+		if privateKey, err = generatePrivateKey(&Request{
+			PrivateKeySize: req.PrivateKeySize,
+			KeyAlgorithm:   req.KeyAlgorithm,
+			Curve:          req.Curve,
+		}); err != nil {
+			return nil, fmt.Errorf("failed generating private key: %v", err)
+		}
+		if rawKey, err = e.marshalPrivateKey(privateKey); err != nil {
+			return nil, fmt.Errorf("failed marshaling private key: %v", err)
+		}
+	} else {
+		pk, err := e.GetPrivateKey(signer.Name, req.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed fetching private key, use a new key if it isn't held in the PKI: %v", err)
+		}
+		var ok bool
+		if privateKey, ok = pk.(crypto.Signer); !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", pk)
+		}
+	}
+	publicKey := privateKey.Public()
+
+	genReq := &Request{
+		Name: req.Name,
+		Template: &x509.Certificate{
+			Subject:               current.Subject,
+			DNSNames:              current.DNSNames,
+			IPAddresses:           current.IPAddresses,
+			EmailAddresses:        current.EmailAddresses,
+			URIs:                  current.URIs,
+			KeyUsage:              current.KeyUsage,
+			ExtKeyUsage:           current.ExtKeyUsage,
+			UnknownExtKeyUsage:    current.UnknownExtKeyUsage,
+			BasicConstraintsValid: current.BasicConstraintsValid,
+			NotAfter:              req.NotAfter,
+			SerialNumber:          req.Serial,
+		},
+	}
+	if err := e.defaultTemplate(signer.Name, genReq, publicKey); err != nil {
+		return nil, fmt.Errorf("failed updating generation request: %v", err)
+	}
+	if req.NewKey {
+		// the key usages depend on the type of the key
+		genReq.Template.KeyUsage = 0
+		nonCATemplate(genReq, publicKey)
+	}
+
+	rawCert, err := x509.CreateCertificate(rand.Reader, genReq.Template, signer.Cert, publicKey, signer.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating and signing certificate: %v", err)
+	}
+
+	if err := e.Store.Replace(signer.Name, req.Name, rawKey, rawCert); err != nil {
+		return nil, fmt.Errorf("failed saving renewed certificate: %v", err)
+	}
+	return x509.ParseCertificate(rawCert)
+}
+
+// CrossSign issues the named intermediate CA again with the given signer,
+// keeping its subject, public key and subject key id, so that certificates
+// issued by the intermediate chain to either CA. The cross-signed certificate
+// is added to the store under the signer, its private key staying with the
+// intermediate, and is returned.
+func (e *ZitiPKI) CrossSign(signer *certificate.Bundle, name string) (*x509.Certificate, error) {
+	if signer.Name == name {
+		return nil, fmt.Errorf("CA %v can't cross-sign itself", name)
+	}
+	if signer.Cert.MaxPathLen == 0 {
+		return nil, ErrMaxPathLenReached
+	}
+
+	raw, err := e.Store.FetchCert(name, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching certificate of CA %v: %v", name, err)
+	}
+	current, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate of CA %v: %v", name, err)
+	}
+	if !current.IsCA {
+		return nil, fmt.Errorf("certificate %v is not a CA, only intermediate CAs can be cross-signed", name)
+	}
+
+	genReq := &Request{
+		Name: name,
+		Template: &x509.Certificate{
+			Subject:     current.Subject,
+			IsCA:        true,
+			KeyUsage:    current.KeyUsage,
+			ExtKeyUsage: current.ExtKeyUsage,
+			MaxPathLen:  current.MaxPathLen,
+			NotAfter:    current.NotAfter,
+		},
+	}
+	if err := e.defaultTemplate(signer.Name, genReq, current.PublicKey); err != nil {
+		return nil, fmt.Errorf("failed updating generation request: %v", err)
+	}
+	if signer.Cert.MaxPathLen > 0 && (genReq.Template.MaxPathLen < 0 || genReq.Template.MaxPathLen >= signer.Cert.MaxPathLen) {
+		genReq.Template.MaxPathLen = signer.Cert.MaxPathLen - 1
+	}
+	if err := caTemplate(genReq, true); err != nil {
+		return nil, fmt.Errorf("failed updating generation request for CA: %v", err)
+	}
+	// both certificates must identify the same key, for the chains to be
+	// interchangeable
+	genReq.Template.SubjectKeyId = current.SubjectKeyId
+
+	rawCert, err := x509.CreateCertificate(rand.Reader, genReq.Template, signer.Cert, current.PublicKey, signer.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating and signing certificate: %v", err)
+	}
+
+	if err := e.Store.AddCert(signer.Name, name, rawCert); err != nil {
+		return nil, fmt.Errorf("failed saving cross-signed certificate: %v", err)
+	}
+	return x509.ParseCertificate(rawCert)
+}
+
+// ImportCA adds an externally generated CA certificate and its private key
+// to the store under the given name, so it can sign certificates like a CA
+// created here. If the CA isn't self-signed, the certificates of the CAs which
+// issued it may be given as the chain, which is verified and stored with it.
+func (e *ZitiPKI) ImportCA(name string, cert *x509.Certificate, key crypto.PrivateKey, chain []*x509.Certificate) error {
+	if !cert.IsCA || !cert.BasicConstraintsValid {
+		return fmt.Errorf("certificate %v is not a CA", cert.Subject.CommonName)
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("certificate %v doesn't allow signing certificates", cert.Subject.CommonName)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %v is only valid from %v until %v", cert.Subject.CommonName, cert.NotBefore, cert.NotAfter)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+	if err := keyMatchesCert(signer, cert); err != nil {
+		return err
+	}
+
+	if len(chain) > 0 {
+		roots := x509.NewCertPool()
+		intermediates := x509.NewCertPool()
+		for _, chainCert := range chain {
+			if chainCert.CheckSignatureFrom(chainCert) == nil {
+				roots.AddCert(chainCert)
+			} else {
+				intermediates.AddCert(chainCert)
+			}
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("certificate %v doesn't chain to a root in the chain: %v", cert.Subject.CommonName, err)
+		}
+	}
+
+	rawKey, err := e.marshalPrivateKey(signer)
+	if err != nil {
+		return fmt.Errorf("failed marshaling private key: %v", err)
+	}
+	if err := e.Store.Add(name, name, true, rawKey, cert.Raw); err != nil {
+		return fmt.Errorf("failed saving imported CA: %v", err)
+	}
+
+	if len(chain) > 0 {
+		rawChain := [][]byte{cert.Raw}
+		for _, chainCert := range chain {
+			rawChain = append(rawChain, chainCert.Raw)
+		}
+		if err := e.Store.AddChain(name, name, rawChain); err != nil {
+			return fmt.Errorf("failed saving chain of imported CA: %v", err)
+		}
+	}
+	return nil
+}
+
 // Revoke revokes the given certificate from the store.
 func (e *ZitiPKI) Revoke(caName string, cert *x509.Certificate) error {
 	if err := e.Store.Update(caName, cert.SerialNumber, certificate.Revoked); err != nil {
@@ -183,7 +606,8 @@ func (e *ZitiPKI) Revoke(caName string, cert *x509.Certificate) error {
 	return nil
 }
 
-// CRL builds a CRL for a given CA based on the revoked certs.
+// CRL builds a CRL for a given CA based on the revoked certs, numbered from
+// the CA's CRL number, and adds it to the store.
 func (e *ZitiPKI) CRL(caName string, expire time.Time) ([]byte, error) {
 	revoked, err := e.Store.Revoked(caName)
 	if err != nil {
@@ -193,32 +617,44 @@ func (e *ZitiPKI) CRL(caName string, expire time.Time) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed retrieving CA bundle %v: %v", caName, err)
 	}
+	number, err := e.Store.NextCRLNumber(caName)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving CRL number for %v: %v", caName, err)
+	}
 
-	crl, err := ca.Cert.CreateCRL(rand.Reader, ca.Key, revoked, time.Now(), expire)
+	template := &x509.RevocationList{
+		Number:              number,
+		ThisUpdate:          time.Now(),
+		NextUpdate:          expire,
+		RevokedCertificates: revoked,
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating crl for %v: %v", caName, err)
 	}
+	if err := e.Store.AddCRL(caName, crl); err != nil {
+		return nil, fmt.Errorf("failed saving crl for %v: %v", caName, err)
+	}
 	return crl, nil
 }
 
 // CSR generates a csr certificate
 func (e *ZitiPKI) CSR(caname string, bundleName string, csrTemplate x509.CertificateRequest, privateKey crypto.PrivateKey) error {
+	// the RSA signature algorithms of the default template can't be used with other keys, so let
+	// x509.CreateCertificateRequest pick one matching the key
+	if _, ok := privateKey.(*rsa.PrivateKey); !ok && signatureAlgorithmKeyType(csrTemplate.SignatureAlgorithm) == x509.RSA {
+		csrTemplate.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	}
 	csrCertificate, err := x509.CreateCertificateRequest(rand.Reader, &csrTemplate, privateKey)
 	if err != nil {
 		return err
 	}
-	if rsaK, ok := privateKey.(*rsa.PrivateKey); ok {
-		if err := e.Store.AddCSR(caname, bundleName, false, x509.MarshalPKCS1PrivateKey(rsaK), csrCertificate); err != nil {
-			return fmt.Errorf("failed saving generated CSR: %v", err)
-		}
-	} else if ecK, ok := privateKey.(*ecdsa.PrivateKey); ok {
-		der, _ := x509.MarshalECPrivateKey(ecK)
-
-		if err := e.Store.AddCSR(caname, bundleName, false, der, csrCertificate); err != nil {
-			return fmt.Errorf("failed saving generated CSR: %v", err)
-		}
-	} else {
-		return fmt.Errorf("Unsupported key type")
+	der, err := e.marshalPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	if err := e.Store.AddCSR(caname, bundleName, false, der, csrCertificate); err != nil {
+		return fmt.Errorf("failed saving generated CSR: %v", err)
 	}
 	return nil
 }
@@ -0,0 +1,97 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Supported strategies for the serial numbers of issued certificates.
+const (
+	// SerialStrategyRandom picks a random 128-bit serial number.
+	SerialStrategyRandom = "random"
+	// SerialStrategySequential takes the next serial number of a counter kept
+	// per CA in the store.
+	SerialStrategySequential = "sequential"
+)
+
+// SerialStrategies lists the supported serial number strategies.
+var SerialStrategies = []string{SerialStrategyRandom, SerialStrategySequential}
+
+// maxSerialOctets is the longest serial number allowed by RFC 5280.
+const maxSerialOctets = 20
+
+// ValidateSerialStrategy checks that the given serial number strategy is
+// supported.
+func ValidateSerialStrategy(strategy string) error {
+	switch strings.ToLower(strategy) {
+	case "", SerialStrategyRandom, SerialStrategySequential:
+		return nil
+	}
+	return fmt.Errorf("unsupported serial strategy %v, must be one of %v", strategy, strings.Join(SerialStrategies, ", "))
+}
+
+// ParseSerial parses a serial number given in hex, as shown by openssl and the
+// PKI index, optionally prefixed with 0x and separated by colons.
+func ParseSerial(value string) (*big.Int, error) {
+	hex := strings.ReplaceAll(strings.TrimSpace(value), ":", "")
+	hex = strings.TrimPrefix(strings.TrimPrefix(hex, "0x"), "0X")
+	serial, ok := new(big.Int).SetString(hex, 16)
+	if !ok || hex == "" {
+		return nil, fmt.Errorf("invalid serial number %v, must be hex", value)
+	}
+	if err := validateSerial(serial); err != nil {
+		return nil, err
+	}
+	return serial, nil
+}
+
+func validateSerial(serial *big.Int) error {
+	if serial.Sign() <= 0 {
+		return fmt.Errorf("serial number %X must be positive", serial)
+	}
+	if len(serial.Bytes()) > maxSerialOctets {
+		return fmt.Errorf("serial number %X is longer than %v octets", serial, maxSerialOctets)
+	}
+	return nil
+}
+
+// serialNumber returns the serial number for a certificate issued by the
+// given CA. A serial number given by the operator is used as is, otherwise one
+// is picked using the strategy of the PKI.
+func (e *ZitiPKI) serialNumber(caName string, given *big.Int) (*big.Int, error) {
+	if given != nil {
+		return given, validateSerial(given)
+	}
+	if strings.ToLower(e.SerialStrategy) == SerialStrategySequential {
+		serial, err := e.Store.NextSerial(caName)
+		if err != nil {
+			return nil, fmt.Errorf("failed taking the next serial number of CA %v: %v", caName, err)
+		}
+		return serial, nil
+	}
+
+	snLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, snLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating serial number: %s", err)
+	}
+	return serial, nil
+}
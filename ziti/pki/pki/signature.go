@@ -0,0 +1,122 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// SignatureAlgorithms lists the signature algorithms which may be requested.
+// SHA256, SHA384 and SHA512 only select the hash, using the RSA or ECDSA
+// algorithm matching the signer's key, while the others are as named by
+// x509.SignatureAlgorithm and must match the signer's key.
+var SignatureAlgorithms = []string{
+	"SHA256", "SHA384", "SHA512",
+	"SHA256-RSA", "SHA384-RSA", "SHA512-RSA",
+	"SHA256-RSAPSS", "SHA384-RSAPSS", "SHA512-RSAPSS",
+	"ECDSA-SHA256", "ECDSA-SHA384", "ECDSA-SHA512",
+	"Ed25519",
+}
+
+var signatureAlgorithmsByName = map[string]x509.SignatureAlgorithm{
+	"SHA256-RSA":    x509.SHA256WithRSA,
+	"SHA384-RSA":    x509.SHA384WithRSA,
+	"SHA512-RSA":    x509.SHA512WithRSA,
+	"SHA256-RSAPSS": x509.SHA256WithRSAPSS,
+	"SHA384-RSAPSS": x509.SHA384WithRSAPSS,
+	"SHA512-RSAPSS": x509.SHA512WithRSAPSS,
+	"ECDSA-SHA256":  x509.ECDSAWithSHA256,
+	"ECDSA-SHA384":  x509.ECDSAWithSHA384,
+	"ECDSA-SHA512":  x509.ECDSAWithSHA512,
+	"ED25519":       x509.PureEd25519,
+}
+
+var hashSignatureAlgorithms = map[string]struct{ rsa, ecdsa x509.SignatureAlgorithm }{
+	"SHA256": {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+	"SHA384": {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+	"SHA512": {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+}
+
+// ValidateSignatureAlgorithm checks that the given signature algorithm is one
+// of SignatureAlgorithms. An empty algorithm is valid and selects the default.
+func ValidateSignatureAlgorithm(algorithm string) error {
+	name := strings.ToUpper(algorithm)
+	if _, found := hashSignatureAlgorithms[name]; found || name == "" {
+		return nil
+	}
+	if _, found := signatureAlgorithmsByName[name]; found {
+		return nil
+	}
+	return fmt.Errorf("unsupported signature algorithm %v, must be one of %v", algorithm, strings.Join(SignatureAlgorithms, ", "))
+}
+
+// ResolveSignatureAlgorithm returns the signature algorithm to sign with the
+// given key. An empty algorithm returns x509.UnknownSignatureAlgorithm, which
+// lets x509 pick the default for the key.
+func ResolveSignatureAlgorithm(algorithm string, key crypto.Signer) (x509.SignatureAlgorithm, error) {
+	if err := ValidateSignatureAlgorithm(algorithm); err != nil {
+		return x509.UnknownSignatureAlgorithm, err
+	}
+	name := strings.ToUpper(algorithm)
+	if name == "" {
+		return x509.UnknownSignatureAlgorithm, nil
+	}
+
+	var keyAlgorithm x509.PublicKeyAlgorithm
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		keyAlgorithm = x509.RSA
+	case *ecdsa.PublicKey:
+		keyAlgorithm = x509.ECDSA
+	case ed25519.PublicKey:
+		keyAlgorithm = x509.Ed25519
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signer key type %T", key.Public())
+	}
+
+	if hashAlgorithms, found := hashSignatureAlgorithms[name]; found {
+		switch keyAlgorithm {
+		case x509.RSA:
+			return hashAlgorithms.rsa, nil
+		case x509.ECDSA:
+			return hashAlgorithms.ecdsa, nil
+		}
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("signature algorithm %v can't be used with an %v signer key, which always signs with Ed25519", algorithm, keyAlgorithm)
+	}
+
+	signatureAlgorithm := signatureAlgorithmsByName[name]
+	if signatureAlgorithmKeyType(signatureAlgorithm) != keyAlgorithm {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("signature algorithm %v can't be used with an %v signer key", signatureAlgorithm, keyAlgorithm)
+	}
+	return signatureAlgorithm, nil
+}
+
+func signatureAlgorithmKeyType(algorithm x509.SignatureAlgorithm) x509.PublicKeyAlgorithm {
+	switch algorithm {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return x509.ECDSA
+	case x509.PureEd25519:
+		return x509.Ed25519
+	}
+	return x509.RSA
+}
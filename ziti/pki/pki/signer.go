@@ -0,0 +1,84 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/openziti/ziti/ziti/pki/store"
+)
+
+// Signer provides the private keys of Certificate Authorities, used to sign
+// certificates. Keys may be held in software by the store, or by a device
+// such as an HSM, in which case they never leave it.
+type Signer interface {
+	// CAKey returns the private key of the named CA, whose certificate is
+	// given.
+	CAKey(caName string, cert *x509.Certificate) (crypto.Signer, error)
+}
+
+// StoreSigner is the default Signer, which reads CA private keys from the
+// store.
+type StoreSigner struct {
+	Store store.Store
+	// Password provides the passwords of encrypted CA private keys.
+	Password KeyPasswordFunc
+}
+
+// CAKey returns the private key of the named CA from the store.
+func (s *StoreSigner) CAKey(caName string, _ *x509.Certificate) (crypto.Signer, error) {
+	k, err := s.Store.FetchKeyBytes(caName, caName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := loadPrivateKey(caName, caName, k, s.Password)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pk.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", pk)
+	}
+	return key, nil
+}
+
+// signer returns the configured Signer, defaulting to the store.
+func (e *ZitiPKI) signer() Signer {
+	if e.Signer != nil {
+		return e.Signer
+	}
+	return &StoreSigner{Store: e.Store, Password: e.Password}
+}
+
+// keyMatchesCert checks that the public key of the signer is the public key
+// of the certificate, so that a misconfigured key isn't used to issue
+// certificates which don't chain to the CA.
+func keyMatchesCert(key crypto.Signer, cert *x509.Certificate) error {
+	type equaler interface {
+		Equal(x crypto.PublicKey) bool
+	}
+	pub, ok := key.Public().(equaler)
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T", key.Public())
+	}
+	if !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("the private key doesn't match the certificate of CA %v", cert.Subject.CommonName)
+	}
+	return nil
+}
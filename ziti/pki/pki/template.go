@@ -18,39 +18,63 @@ package pki
 
 import (
 	"crypto"
-	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
 	"encoding/asn1"
 	"fmt"
-	"math/big"
 	"time"
 )
 
-func defaultTemplate(genReq *Request, publicKey crypto.PublicKey) error {
-	publicKeyBytes, err := asn1.Marshal(*publicKey.(*rsa.PublicKey))
+// defaultTemplate completes the template of a certificate issued by the given
+// CA. The serial number of the template is kept if set.
+func (e *ZitiPKI) defaultTemplate(caName string, genReq *Request, publicKey crypto.PublicKey) error {
+	publicKeyBytes, err := marshalPublicKey(publicKey)
 	if err != nil {
 		return fmt.Errorf("failed marshaling public key: %v", err)
 	}
 	subjectKeyID := sha1.Sum(publicKeyBytes)
 	genReq.Template.SubjectKeyId = subjectKeyID[:]
 
-	// Random serial number.
-	snLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	sn, err := rand.Int(rand.Reader, snLimit)
+	sn, err := e.serialNumber(caName, genReq.Template.SerialNumber)
 	if err != nil {
-		return fmt.Errorf("failed generating serial number: %s", err)
+		return err
 	}
 	genReq.Template.SerialNumber = sn
 
 	genReq.Template.NotBefore = time.Now().Add(-time.Minute)
-	genReq.Template.SignatureAlgorithm = x509.SHA256WithRSA
+	// left for x509.CreateCertificate to pick based on the signer's key, which
+	// is SHA256WithRSA for RSA signers and ECDSA with a hash matching the curve
+	// for EC signers
+	genReq.Template.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
 	return nil
 }
 
+// marshalPublicKey returns the bytes of the subject public key, as hashed for
+// the subject key id.
+func marshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return asn1.Marshal(*k)
+	case *ecdsa.PublicKey:
+		return elliptic.Marshal(k.Curve, k.X, k.Y), nil
+	case ed25519.PublicKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
 func caTemplate(genReq *Request, intermediateCA bool) error {
-	genReq.Template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	// key usages given in the template are kept, but a CA must always be able
+	// to sign certificates
+	if genReq.Template.KeyUsage == 0 {
+		genReq.Template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	genReq.Template.KeyUsage |= x509.KeyUsageCertSign
 	genReq.Template.BasicConstraintsValid = true
 	genReq.Template.MaxPathLenZero = true
 
@@ -64,7 +88,19 @@ func caTemplate(genReq *Request, intermediateCA bool) error {
 	return nil
 }
 
-func nonCATemplate(genReq *Request) {
+func nonCATemplate(genReq *Request, publicKey crypto.PublicKey) {
 	genReq.Template.BasicConstraintsValid = true
-	genReq.Template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageContentCommitment
+	if genReq.Template.KeyUsage != 0 {
+		// key usages given in the template are kept as is
+		return
+	}
+	genReq.Template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+	// key encipherment is only meaningful for RSA and ECDSA keys are used for key
+	// agreement, while Ed25519 keys can only sign
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		genReq.Template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	case *ecdsa.PublicKey:
+		genReq.Template.KeyUsage |= x509.KeyUsageKeyAgreement
+	}
 }
@@ -0,0 +1,399 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// LocalAuditFile is the name of the audit log kept in the PKI root.
+const LocalAuditFile = "audit.jsonl"
+
+// Audited operations.
+const (
+	AuditOperationIssue  = "issue"
+	AuditOperationRenew  = "renew"
+	AuditOperationRevoke = "revoke"
+	AuditOperationRemove = "remove"
+)
+
+// AuditOperations lists the audited operations.
+var AuditOperations = []string{AuditOperationIssue, AuditOperationRenew, AuditOperationRevoke, AuditOperationRemove}
+
+// AuditRecord records a certificate being issued, renewed, revoked or removed.
+//
+// Records are chained: each holds the hash of the record before it, and its
+// own hash covers all of its other fields, so that changing or removing a
+// record, other than the last ones, breaks the chain. The hashes aren't keyed,
+// so the chain doesn't hold against someone who can rewrite the whole log.
+// Records removed from the end of the log are only noticed with the vault
+// backend, which keeps the sequence number and hash of the last record apart
+// from the records.
+type AuditRecord struct {
+	Seq       int64      `json:"seq"`
+	Time      time.Time  `json:"time"`
+	Operation string     `json:"operation"`
+	CA        string     `json:"ca"`
+	Name      string     `json:"name"`
+	Serial    string     `json:"serial"`
+	Subject   string     `json:"subject,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+	Actor     string     `json:"actor,omitempty"`
+	PrevHash  string     `json:"prevHash"`
+	Hash      string     `json:"hash"`
+}
+
+// computeHash returns the hash of the record, over all fields but the hash
+// itself.
+func (r *AuditRecord) computeHash() (string, error) {
+	unhashed := *r
+	unhashed.Hash = ""
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newAuditRecord returns the record for an operation on a certificate, not
+// yet chained.
+func newAuditRecord(operation, caName, name string, rawCert []byte) (*AuditRecord, error) {
+	cert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing raw certificate %v: %v", name, err)
+	}
+	notAfter := cert.NotAfter.UTC()
+	return &AuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		CA:        caName,
+		Name:      name,
+		Serial:    auditSerial(cert.SerialNumber),
+		Subject:   cert.Subject.String(),
+		NotAfter:  &notAfter,
+		Actor:     auditActor(),
+	}, nil
+}
+
+// newRevokeAuditRecord returns the record for revoking a certificate, not yet
+// chained. The subject and expiry are taken from the certificate if it's
+// given and is still the one with the serial, as renewing replaces it.
+func newRevokeAuditRecord(caName, name string, sn *big.Int, subject string, rawCert []byte) *AuditRecord {
+	record := &AuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: AuditOperationRevoke,
+		CA:        caName,
+		Name:      name,
+		Serial:    auditSerial(sn),
+		Subject:   subject,
+		Actor:     auditActor(),
+	}
+	if rawCert != nil {
+		if cert, err := x509.ParseCertificate(rawCert); err == nil && cert.SerialNumber.Cmp(sn) == 0 {
+			notAfter := cert.NotAfter.UTC()
+			record.Subject = cert.Subject.String()
+			record.NotAfter = &notAfter
+		}
+	}
+	return record
+}
+
+// chain links the record to the one before it, which is nil for the first
+// record, and sets its hash.
+func (r *AuditRecord) chain(prev *AuditRecord) error {
+	r.Seq = 1
+	r.PrevHash = ""
+	if prev != nil {
+		r.Seq = prev.Seq + 1
+		r.PrevHash = prev.Hash
+	}
+	hash, err := r.computeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	return nil
+}
+
+func auditSerial(sn *big.Int) string {
+	return fmt.Sprintf("%X", sn)
+}
+
+// auditActor returns who is running the operation, as the OS user and host.
+func auditActor() string {
+	name := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		return name + "@" + host
+	}
+	return name
+}
+
+// VerifyAuditRecords checks that the records form an unbroken hash chain,
+// returning an error describing the first record which doesn't.
+func VerifyAuditRecords(records []*AuditRecord) error {
+	var prev *AuditRecord
+	for _, record := range records {
+		expectedSeq, expectedPrevHash := int64(1), ""
+		if prev != nil {
+			expectedSeq, expectedPrevHash = prev.Seq+1, prev.Hash
+		}
+		if record.Seq != expectedSeq {
+			return fmt.Errorf("audit record %v follows record %v, records are missing or reordered", record.Seq, expectedSeq-1)
+		}
+		if record.PrevHash != expectedPrevHash {
+			return fmt.Errorf("audit record %v doesn't chain to the record before it", record.Seq)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != record.Hash {
+			return fmt.Errorf("audit record %v was changed after it was written", record.Seq)
+		}
+		prev = record
+	}
+	return nil
+}
+
+// auditPath returns the path of the audit log.
+func (l *Local) auditPath() string {
+	return filepath.Join(l.Root, LocalAuditFile)
+}
+
+// AuditRecords returns the records of the audit log, oldest first.
+func (l *Local) AuditRecords() ([]*AuditRecord, error) {
+	f, err := os.Open(l.auditPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := &AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("failed parsing line %v of %v: %v", line, l.auditPath(), err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// audit chains the record to the last one and appends it to the audit log.
+// The log is locked while the record is appended, so records written
+// concurrently by other processes can't break the chain.
+func (l *Local) audit(record *AuditRecord) error {
+	f, err := os.OpenFile(l.auditPath(), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed opening audit log %v: %v", l.auditPath(), err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("failed locking audit log %v: %v", l.auditPath(), err)
+	}
+	defer func() { _ = unlockFile(f) }()
+
+	prev, err := lastAuditRecord(f)
+	if err != nil {
+		return fmt.Errorf("failed reading last record of audit log %v: %v", l.auditPath(), err)
+	}
+	if err := record.chain(prev); err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed appending to audit log %v: %v", l.auditPath(), err)
+	}
+	return nil
+}
+
+// lastAuditRecord returns the last record of the audit log, or nil if it's
+// empty. Only the end of the log is read, growing the part read until it holds
+// the whole last line.
+func lastAuditRecord(f *os.File) (*AuditRecord, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	for window := int64(4096); ; window *= 2 {
+		if window > size {
+			window = size
+		}
+		buf := make([]byte, window)
+		if _, err := f.ReadAt(buf, size-window); err != nil && err != io.EOF {
+			return nil, err
+		}
+		trimmed := bytes.TrimRight(buf, "\n")
+		start := bytes.LastIndexByte(trimmed, '\n')
+		if start < 0 && window < size {
+			continue
+		}
+		if len(trimmed) == 0 {
+			return nil, nil
+		}
+		record := &AuditRecord{}
+		if err := json.Unmarshal(trimmed[start+1:], record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+// vaultAuditHead is the secret pointing to the last record of the audit log of
+// a PKI in Vault. Each record is kept in its own secret, named by its sequence
+// number, under the head, so appending a record doesn't rewrite the log.
+type vaultAuditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// auditRecordPath returns the path of the secret holding the record with the
+// sequence number.
+func (v *Vault) auditRecordPath(seq int64) string {
+	return v.secretPath(vaultAuditName, fmt.Sprintf("%012d", seq))
+}
+
+// AuditRecords returns the records of the audit log, oldest first.
+func (v *Vault) AuditRecords() ([]*AuditRecord, error) {
+	head := &vaultAuditHead{}
+	if _, err := v.read(v.secretPath(vaultAuditName), head); err != nil {
+		return nil, err
+	}
+	var records []*AuditRecord
+	for seq := int64(1); ; seq++ {
+		record := &AuditRecord{}
+		version, err := v.read(v.auditRecordPath(seq), record)
+		if err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			if seq <= head.Seq {
+				return nil, fmt.Errorf("audit record %v is missing from vault", seq)
+			}
+			return records, nil
+		}
+		if seq == head.Seq && record.Hash != head.Hash {
+			return nil, fmt.Errorf("audit record %v doesn't match the head of the audit log in vault", seq)
+		}
+		records = append(records, record)
+	}
+}
+
+// audit chains the record to the last one and writes it to its own secret,
+// then moves the head to it. Writing the record fails if another record took
+// its sequence number concurrently, in which case the head is moved to that
+// record, in case its writer didn't get to, and appending is retried.
+func (v *Vault) audit(record *AuditRecord) error {
+	headPath := v.secretPath(vaultAuditName)
+	for attempt := 0; attempt < 10; attempt++ {
+		head := &vaultAuditHead{}
+		version, err := v.read(headPath, head)
+		if err != nil {
+			return err
+		}
+		var prev *AuditRecord
+		if head.Seq > 0 {
+			prev = &AuditRecord{Seq: head.Seq, Hash: head.Hash}
+		}
+		if err := record.chain(prev); err != nil {
+			return err
+		}
+
+		err = v.write(v.auditRecordPath(record.Seq), record, 0)
+		if err == errVaultCASMismatch {
+			existing := &AuditRecord{}
+			if _, err := v.read(v.auditRecordPath(record.Seq), existing); err != nil {
+				return err
+			}
+			if existing.Seq != record.Seq {
+				return fmt.Errorf("audit record %v in vault has sequence number %v", record.Seq, existing.Seq)
+			}
+			err = v.write(headPath, &vaultAuditHead{Seq: existing.Seq, Hash: existing.Hash}, version)
+			if err != nil && err != errVaultCASMismatch {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// the head can only have moved since it was read if another writer
+		// moved it to this record
+		err = v.write(headPath, &vaultAuditHead{Seq: record.Seq, Hash: record.Hash}, version)
+		if err != nil && err != errVaultCASMismatch {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("audit log was appended to concurrently too often")
+}
+
+// auditCert appends a record of an operation on a certificate to the audit
+// log.
+func (l *Local) auditCert(operation, caName, name string, rawCert []byte) error {
+	record, err := newAuditRecord(operation, caName, name, rawCert)
+	if err != nil {
+		return err
+	}
+	if err := l.audit(record); err != nil {
+		return fmt.Errorf("failed auditing %v of %v within CA %v: %v", operation, name, caName, err)
+	}
+	return nil
+}
+
+// auditCert appends a record of an operation on a certificate to the audit
+// log.
+func (v *Vault) auditCert(operation, caName, name string, rawCert []byte) error {
+	record, err := newAuditRecord(operation, caName, name, rawCert)
+	if err != nil {
+		return err
+	}
+	if err := v.audit(record); err != nil {
+		return fmt.Errorf("failed auditing %v of %v within CA %v: %v", operation, name, caName, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalAuditConcurrentAppends(t *testing.T) {
+	req := require.New(t)
+
+	local := &Local{Root: t.TempDir()}
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- local.audit(&AuditRecord{Operation: AuditOperationIssue, CA: "ca", Name: "cert"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		req.NoError(err)
+	}
+
+	records, err := local.AuditRecords()
+	req.NoError(err)
+	req.Len(records, 20)
+	req.NoError(VerifyAuditRecords(records))
+}
+
+func TestLastAuditRecord(t *testing.T) {
+	req := require.New(t)
+
+	local := &Local{Root: t.TempDir()}
+	f, err := os.OpenFile(local.auditPath(), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	req.NoError(err)
+	defer f.Close()
+
+	last, err := lastAuditRecord(f)
+	req.NoError(err)
+	req.Nil(last)
+
+	// records longer than the part of the log read at first
+	long := strings.Repeat("x", 10000)
+	req.NoError(local.audit(&AuditRecord{Name: "first", Subject: long}))
+	req.NoError(local.audit(&AuditRecord{Name: "second", Subject: long}))
+
+	last, err = lastAuditRecord(f)
+	req.NoError(err)
+	req.Equal("second", last.Name)
+	req.Equal(int64(2), last.Seq)
+}
@@ -0,0 +1,64 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+)
+
+// CAChain returns the certificate of the named CA followed by the certificates
+// of the CAs which issued it, up to the self-signed root. Issuers are looked up
+// among the CAs in the store by subject, stopping at the last one found.
+func CAChain(s Store, caName string) ([]*x509.Certificate, error) {
+	names, err := s.CANames()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing CAs: %v", err)
+	}
+
+	cas := map[string]*x509.Certificate{}
+	for _, name := range names {
+		raw, err := s.FetchCert(name, name)
+		if err != nil {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(raw); err == nil {
+			cas[string(cert.RawSubject)] = cert
+		}
+	}
+
+	raw, err := s.FetchCert(caName, caName)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing certificate of CA %v: %v", caName, err)
+	}
+
+	chain := []*x509.Certificate{cert}
+	for len(chain) <= len(cas) && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		issuer, found := cas[string(cert.RawIssuer)]
+		if !found || issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) != nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	return chain, nil
+}
@@ -0,0 +1,329 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openziti/ziti/ziti/pki/certificate"
+)
+
+// LocalIndexFile is the name of the machine-readable index kept in the PKI root.
+const LocalIndexFile = "index.json"
+
+// Index entry types.
+const (
+	EntryTypeCA           = "ca"
+	EntryTypeIntermediate = "intermediate"
+	EntryTypeServer       = "server"
+	EntryTypeClient       = "client"
+	EntryTypeKey          = "key"
+	EntryTypeCSR          = "csr"
+)
+
+// EntryTypes lists the types of index entries.
+var EntryTypes = []string{EntryTypeCA, EntryTypeIntermediate, EntryTypeServer, EntryTypeClient, EntryTypeKey, EntryTypeCSR}
+
+// IndexEntry describes a certificate, CSR or private key in the PKI root.
+type IndexEntry struct {
+	Type         string     `json:"type"`
+	CA           string     `json:"ca"`
+	Name         string     `json:"name"`
+	CertPath     string     `json:"certPath,omitempty"`
+	KeyPath      string     `json:"keyPath,omitempty"`
+	CommonName   string     `json:"commonName,omitempty"`
+	DNSNames     []string   `json:"dnsNames,omitempty"`
+	IPAddresses  []string   `json:"ipAddresses,omitempty"`
+	Emails       []string   `json:"emails,omitempty"`
+	Serial       string     `json:"serial,omitempty"`
+	Issuer       string     `json:"issuer,omitempty"`
+	KeyAlgorithm string     `json:"keyAlgorithm,omitempty"`
+	NotBefore    *time.Time `json:"notBefore,omitempty"`
+	NotAfter     *time.Time `json:"notAfter,omitempty"`
+	Revoked      bool       `json:"revoked,omitempty"`
+}
+
+// SANs returns the subject alternative names of the entry.
+func (e *IndexEntry) SANs() []string {
+	var result []string
+	result = append(result, e.DNSNames...)
+	result = append(result, e.IPAddresses...)
+	result = append(result, e.Emails...)
+	return result
+}
+
+// Index is the machine-readable index of a PKI root.
+type Index struct {
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Entries   []*IndexEntry `json:"entries"`
+}
+
+// ReadIndex returns the index of the PKI root, building it first if it
+// doesn't exist yet.
+func (l *Local) ReadIndex() (*Index, error) {
+	data, err := ioutil.ReadFile(filepath.Join(l.Root, LocalIndexFile))
+	if os.IsNotExist(err) {
+		return l.WriteIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed parsing %v: %v", LocalIndexFile, err)
+	}
+	return index, nil
+}
+
+// WriteIndex rebuilds the index of the PKI root and writes it to the
+// LocalIndexFile.
+func (l *Local) WriteIndex() (*Index, error) {
+	index, err := l.BuildIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(l.Root, LocalIndexFile), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed writing %v: %v", LocalIndexFile, err)
+	}
+	return index, nil
+}
+
+// updateJSONIndex keeps the index current after the store was changed.
+func (l *Local) updateJSONIndex() error {
+	if _, err := l.WriteIndex(); err != nil {
+		return fmt.Errorf("failed updating %v: %v", LocalIndexFile, err)
+	}
+	return nil
+}
+
+// BuildIndex walks the PKI root and describes every certificate, CSR and
+// private key in it.
+//
+// Certificates don't record whether they were issued for a server or a client,
+// so non-CA certificates with DNS or IP SANs are indexed as server certificates
+// and all others as client certificates. The copy of an intermediate CA which
+// is kept in its own directory is indexed only once, under its issuing CA.
+func (l *Local) BuildIndex() (*Index, error) {
+	index := &Index{UpdatedAt: time.Now().UTC(), Entries: []*IndexEntry{}}
+
+	dirs, err := ioutil.ReadDir(l.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading PKI root %v: %v", l.Root, err)
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entries, err := l.indexCA(dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		index.Entries = append(index.Entries, entries...)
+	}
+
+	sort.Slice(index.Entries, func(i, j int) bool {
+		a, b := index.Entries[i], index.Entries[j]
+		if a.CA != b.CA {
+			return a.CA < b.CA
+		}
+		return a.Name < b.Name
+	})
+
+	return index, nil
+}
+
+func (l *Local) indexCA(caName string) ([]*IndexEntry, error) {
+	certsDir := filepath.Join(l.Root, caName, LocalCertsDir)
+	keysDir := filepath.Join(l.Root, caName, LocalKeysDir)
+	if _, err := os.Stat(certsDir); err != nil {
+		return nil, nil
+	}
+
+	revoked := map[string]bool{}
+	if revokedCerts, err := l.Revoked(caName); err == nil {
+		for _, rc := range revokedCerts {
+			revoked[rc.SerialNumber.String()] = true
+		}
+	}
+
+	var result []*IndexEntry
+	names := map[string]bool{}
+
+	certFiles, err := ioutil.ReadDir(certsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range certFiles {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".cert") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".cert")
+		names[name] = true
+
+		entry := l.indexCert(caName, name, revoked)
+		if entry != nil {
+			result = append(result, entry)
+		}
+	}
+
+	keyFiles, err := ioutil.ReadDir(keysDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range keyFiles {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".key") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".key")
+		if names[name] {
+			continue
+		}
+		keyPath, _ := l.path(caName, name)
+		result = append(result, &IndexEntry{
+			Type:         EntryTypeKey,
+			CA:           caName,
+			Name:         name,
+			KeyPath:      l.relative(keyPath),
+			KeyAlgorithm: keyAlgorithmOfFile(keyPath),
+		})
+	}
+
+	return result, nil
+}
+
+// indexCert describes the certificate or CSR with the given name, or returns nil if it should be skipped.
+func (l *Local) indexCert(caName, name string, revoked map[string]bool) *IndexEntry {
+	keyPath, certPath := l.path(caName, name)
+	entry := &IndexEntry{
+		CA:       caName,
+		Name:     name,
+		CertPath: l.relative(certPath),
+	}
+	if _, err := os.Stat(keyPath); err == nil {
+		entry.KeyPath = l.relative(keyPath)
+	}
+
+	raw, err := readPEM(certPath)
+	if err != nil {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		csr, err := x509.ParseCertificateRequest(raw)
+		if err != nil {
+			return nil
+		}
+		entry.Type = EntryTypeCSR
+		entry.CommonName = csr.Subject.CommonName
+		entry.DNSNames = csr.DNSNames
+		entry.IPAddresses = ipStrings(csr.IPAddresses)
+		entry.Emails = csr.EmailAddresses
+		entry.KeyAlgorithm = csr.PublicKeyAlgorithm.String()
+		return entry
+	}
+
+	selfSigned := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+	switch {
+	case cert.IsCA && selfSigned:
+		entry.Type = EntryTypeCA
+	case cert.IsCA && name == caName:
+		// the hard linked copy of an intermediate in its own directory
+		return nil
+	case cert.IsCA:
+		entry.Type = EntryTypeIntermediate
+	case len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0:
+		entry.Type = EntryTypeServer
+	default:
+		entry.Type = EntryTypeClient
+	}
+
+	notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+	entry.CommonName = cert.Subject.CommonName
+	entry.DNSNames = cert.DNSNames
+	entry.IPAddresses = ipStrings(cert.IPAddresses)
+	entry.Emails = cert.EmailAddresses
+	entry.Serial = fmt.Sprintf("%X", cert.SerialNumber)
+	entry.Issuer = cert.Issuer.CommonName
+	entry.KeyAlgorithm = cert.PublicKeyAlgorithm.String()
+	entry.NotBefore = &notBefore
+	entry.NotAfter = &notAfter
+	entry.Revoked = revoked[cert.SerialNumber.String()]
+
+	return entry
+}
+
+func (l *Local) relative(path string) string {
+	if rel, err := filepath.Rel(l.Root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+func keyAlgorithmOfFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+	key, err := certificate.ParsePrivateKey(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return x509.RSA.String()
+	case *ecdsa.PrivateKey:
+		return x509.ECDSA.String()
+	case ed25519.PrivateKey:
+		return x509.Ed25519.String()
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+func ipStrings(ips []net.IP) []string {
+	var result []string
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return result
+}
@@ -68,6 +68,27 @@ func (l *Local) path(caName, name string) (key string, cert string) {
 	return
 }
 
+// BundlePaths returns the paths of the private key and certificate files of a
+// bundle.
+func (l *Local) BundlePaths(caName, name string) (key string, cert string) {
+	return l.path(caName, name)
+}
+
+// CANames returns the names of the CA directories in the root directory.
+func (l *Local) CANames() ([]string, error) {
+	dirs, err := ioutil.ReadDir(l.Root)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			names = append(names, dir.Name())
+		}
+	}
+	return names, nil
+}
+
 // Exists checks if a certificate or private key already exist on the local
 // filesystem for a given name.
 func (l *Local) Exists(caName, name string) bool {
@@ -97,6 +118,16 @@ func (l *Local) Fetch(caName, name string) ([]byte, []byte, error) {
 	return k, c, nil
 }
 
+// FetchCert fetches the certificate for a given name signed by caName.
+func (l *Local) FetchCert(caName, name string) ([]byte, error) {
+	_, certPath := l.path(caName, name)
+	c, err := readPEM(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading cert from file %v: %v", certPath, err)
+	}
+	return c, nil
+}
+
 // Fetch fetchs the private key and certificate for a given name signed by caName.
 func (l *Local) FetchKeyBytes(caName, name string) ([]byte, error) {
 	filepath.Join(l.Root, caName)
@@ -132,7 +163,63 @@ func (l *Local) Add(caName, name string, isCa bool, key, cert []byte) error {
 	if err := l.updateIndex(caName, name, cert); err != nil {
 		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
 	}
-	return nil
+	if err := l.auditCert(AuditOperationIssue, caName, name, cert); err != nil {
+		return err
+	}
+	return l.updateJSONIndex()
+}
+
+// AddCert adds the given certificate, whose private key is held elsewhere, to
+// the local filesystem.
+func (l *Local) AddCert(caName, name string, cert []byte) error {
+	if l.Exists(caName, name) {
+		return fmt.Errorf("a bundle already exists for the name %v within CA %v", name, caName)
+	}
+	if err := l.writeCert(caName, name, cert); err != nil {
+		return fmt.Errorf("failed writing cert %v within CA %v to the local filesystem: %v", name, caName, err)
+	}
+	if err := l.updateIndex(caName, name, cert); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	if err := l.auditCert(AuditOperationIssue, caName, name, cert); err != nil {
+		return err
+	}
+	return l.updateJSONIndex()
+}
+
+// Replace replaces the certificate, and the private key if given, of an
+// existing bundle on the local filesystem. A chain created for the bundle is
+// rewritten with the new certificate.
+func (l *Local) Replace(caName, name string, key, cert []byte) error {
+	if _, certPath := l.path(caName, name); !fileExists(certPath) {
+		return fmt.Errorf("no certificate exists for the name %v within CA %v", name, caName)
+	}
+	if key != nil {
+		if err := l.writeKey(caName, name, key); err != nil {
+			return fmt.Errorf("failed writing key %v within CA %v to the local filesystem: %v", name, caName, err)
+		}
+	}
+	if err := l.writeCert(caName, name, cert); err != nil {
+		return fmt.Errorf("failed writing cert %v within CA %v to the local filesystem: %v", name, caName, err)
+	}
+	chainName := name + ".chain.pem"
+	if fileExists(filepath.Join(l.Root, caName, LocalCertsDir, chainName)) {
+		if err := l.writeChainBundle(caName, name, chainName); err != nil {
+			return fmt.Errorf("failed writing chain %v to the local filesystem: %v", chainName, err)
+		}
+	}
+	if err := l.updateIndex(caName, name, cert); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	if err := l.auditCert(AuditOperationRenew, caName, name, cert); err != nil {
+		return err
+	}
+	return l.updateJSONIndex()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 // Chain concats an intermediate cert and a newly signed certificate bundle and adds the chained cert to the store.
@@ -147,15 +234,106 @@ func (l *Local) Chain(caName, name string) error {
 	return nil
 }
 
+// AddChain writes the given chain of certificates to the local filesystem,
+// next to the certificate it's for.
+func (l *Local) AddChain(caName, name string, chain [][]byte) error {
+	caDir := filepath.Join(l.Root, caName)
+	if _, err := os.Stat(caDir); err != nil {
+		if err := InitCADir(caDir); err != nil {
+			return fmt.Errorf("root directory for CA %v does not exist and cannot be created: %v", caDir, err)
+		}
+	}
+
+	chainPath := filepath.Join(l.Root, caName, LocalCertsDir, name+".chain.pem")
+	out, err := os.OpenFile(chainPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open chain file: %v: %v", chainPath, err)
+	}
+	defer out.Close()
+
+	for _, cert := range chain {
+		if err := pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
+			return fmt.Errorf("failed writing chain file %v: %v", chainPath, err)
+		}
+	}
+	return nil
+}
+
+// Remove removes the given bundle and its entry in the index.txt from the
+// local filesystem.
+func (l *Local) Remove(caName, name string) error {
+	rawCert, err := l.FetchCert(caName, name)
+	if err != nil {
+		return fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	cert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		return fmt.Errorf("failed parsing raw certificate %v: %v", name, err)
+	}
+
+	keyPath, certPath := l.path(caName, name)
+	for _, path := range []string{keyPath, certPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed removing %v: %v", path, err)
+		}
+	}
+	if err := l.removeFromIndex(caName, cert.SerialNumber); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	if err := l.auditCert(AuditOperationRemove, caName, name, rawCert); err != nil {
+		return err
+	}
+	return l.updateJSONIndex()
+}
+
+// RemoveChain removes the chain of the given bundle from the local filesystem.
+func (l *Local) RemoveChain(caName, name string) error {
+	if err := os.Remove(l.ChainPath(caName, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed removing chain of %v within CA %v: %v", name, caName, err)
+	}
+	return nil
+}
+
+// removeFromIndex removes the line of the certificate with the given serial
+// from the index.txt.
+func (l *Local) removeFromIndex(caName string, sn *big.Int) error {
+	path := filepath.Join(l.Root, caName, "index.txt")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		matches := indexRegexp.FindStringSubmatch(line)
+		if len(matches) != 7 {
+			return fmt.Errorf("line [%v] is incorrectly formated", line)
+		}
+		if matchedSerial, ok := new(big.Int).SetString(matches[4], 16); ok && matchedSerial.Cmp(sn) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	result := ""
+	if len(lines) > 0 {
+		result = strings.Join(lines, "\n") + "\n"
+	}
+	return ioutil.WriteFile(path, []byte(result), 0644)
+}
+
 // Add adds the given csr to the local filesystem.
 func (l *Local) AddCSR(caName, name string, isCa bool, key, cert []byte) error {
 	if l.Exists(caName, name) {
 		return fmt.Errorf("a CSR already exists for the name %v within CA %v", name, caName)
 	}
-	if err := l.writeBundle(caName, name, isCa, key, cert); err != nil {
+	if err := l.writeBundleOfType(caName, name, isCa, key, cert, "CERTIFICATE REQUEST"); err != nil {
 		return fmt.Errorf("failed writing CSR %v within CA %v to the local filesystem: %v", name, caName, err)
 	}
-	return nil
+	return l.updateJSONIndex()
 }
 
 // Add adds the given key to the local filesystem.
@@ -166,7 +344,7 @@ func (l *Local) AddKey(caName string, name string, key []byte) error {
 	if err := l.writeKey(caName, name, key); err != nil {
 		return fmt.Errorf("failed writing key %v within CA %v to the local filesystem: %v", name, caName, err)
 	}
-	return nil
+	return l.updateJSONIndex()
 }
 
 // writeKey encodes in PEM format the bundle private key and stores it on the local filesystem.
@@ -178,15 +356,35 @@ func (l *Local) writeKey(caName string, name string, key []byte) error {
 		}
 	}
 	keyPath, _ := l.path(caName, name)
-	if err := encodeAndWrite(keyPath, "RSA PRIVATE KEY", key); err != nil {
+	if err := encodeAndWrite(keyPath, certificate.PrivateKeyPEMType(key), key); err != nil {
 		return fmt.Errorf("failed encoding and writing private key file: %v", err)
 	}
 	return nil
 }
 
+// writeCert encodes in PEM format the certificate and stores it on the local filesystem.
+func (l *Local) writeCert(caName string, name string, cert []byte) error {
+	caDir := filepath.Join(l.Root, caName)
+	if _, err := os.Stat(caDir); err != nil {
+		if err := InitCADir(caDir); err != nil {
+			return fmt.Errorf("root directory for CA %v does not exist and cannot be created: %v", caDir, err)
+		}
+	}
+	_, certPath := l.path(caName, name)
+	if err := encodeAndWrite(certPath, "CERTIFICATE", cert); err != nil {
+		return fmt.Errorf("failed encoding and writing cert file: %v", err)
+	}
+	return nil
+}
+
 // writeBundle encodes in PEM format the bundle private key and
 // certificate and stores them on the local filesystem.
 func (l *Local) writeBundle(caName, name string, isCa bool, key, cert []byte) error {
+	return l.writeBundleOfType(caName, name, isCa, key, cert, "CERTIFICATE")
+}
+
+// writeBundleOfType is writeBundle with the given PEM type for the certificate.
+func (l *Local) writeBundleOfType(caName, name string, isCa bool, key, cert []byte, certPEMType string) error {
 	caDir := filepath.Join(l.Root, caName)
 	if _, err := os.Stat(caDir); err != nil {
 		if err := InitCADir(caDir); err != nil {
@@ -194,10 +392,10 @@ func (l *Local) writeBundle(caName, name string, isCa bool, key, cert []byte) er
 		}
 	}
 	keyPath, certPath := l.path(caName, name)
-	if err := encodeAndWrite(keyPath, "RSA PRIVATE KEY", key); err != nil {
+	if err := encodeAndWrite(keyPath, certificate.PrivateKeyPEMType(key), key); err != nil {
 		return fmt.Errorf("failed encoding and writing private key file: %v", err)
 	}
-	if err := encodeAndWrite(certPath, "CERTIFICATE", cert); err != nil {
+	if err := encodeAndWrite(certPath, certPEMType, cert); err != nil {
 		return fmt.Errorf("failed encoding and writing cert file: %v", err)
 	}
 
@@ -241,7 +439,7 @@ func (l *Local) writeChainBundle(caName, name string, chainName string) error {
 	defer serverCertIn.Close()
 
 	chainCertPath := filepath.Join(l.Root, caName, LocalCertsDir, chainName)
-	out, err := os.OpenFile(chainCertPath, os.O_CREATE|os.O_WRONLY, 0644)
+	out, err := os.OpenFile(chainCertPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open chain file: %v: %v", chainCertPath, err)
 	}
@@ -348,6 +546,8 @@ func (l *Local) Update(caName string, sn *big.Int, st certificate.State) error {
 	}
 
 	var lines []string
+	var revoked *AuditRecord
+	found := false
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		matches := indexRegexp.FindStringSubmatch(scanner.Text())
@@ -361,6 +561,12 @@ func (l *Local) Update(caName string, sn *big.Int, st certificate.State) error {
 			if matches[1] == state {
 				return nil
 			}
+			found = true
+			if st == certificate.Revoked {
+				name := strings.TrimSuffix(matches[5], ".cert")
+				rawCert, _ := l.FetchCert(caName, name)
+				revoked = newRevokeAuditRecord(caName, name, sn, matches[6], rawCert)
+			}
 
 			lines = append(lines, fmt.Sprintf("%v\t%v\t%vZ\t%v\t%v\t%v",
 				state,
@@ -374,6 +580,10 @@ func (l *Local) Update(caName string, sn *big.Int, st certificate.State) error {
 		}
 	}
 
+	if !found {
+		return fmt.Errorf("no certificate with serial %X found in the index of CA %v", sn, caName)
+	}
+
 	f.Truncate(0)
 	f.Seek(0, 0)
 
@@ -386,7 +596,12 @@ func (l *Local) Update(caName string, sn *big.Int, st certificate.State) error {
 			return fmt.Errorf("failed writing line [%v]: written 0 bytes", line)
 		}
 	}
-	return nil
+	if revoked != nil {
+		if err := l.audit(revoked); err != nil {
+			return fmt.Errorf("failed auditing revocation of %v within CA %v: %v", revoked.Name, caName, err)
+		}
+	}
+	return l.updateJSONIndex()
 }
 
 // Revoked returns a list of revoked certificates.
@@ -422,6 +637,122 @@ func (l *Local) Revoked(caName string) ([]pkix.RevokedCertificate, error) {
 	return revokedCerts, nil
 }
 
+// NextCRLNumber returns the number in the crlnumber file and increments it,
+// as openssl does.
+func (l *Local) NextCRLNumber(caName string) (*big.Int, error) {
+	path := filepath.Join(l.Root, caName, "crlnumber")
+	number := big.NewInt(1)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if _, ok := number.SetString(strings.TrimSpace(string(data)), 16); !ok {
+			return nil, fmt.Errorf("invalid CRL number in %v", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	next := fmt.Sprintf("%X", new(big.Int).Add(number, big.NewInt(1)))
+	if len(next)%2 == 1 {
+		next = "0" + next
+	}
+	if err := ioutil.WriteFile(path, []byte(next+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed writing %v: %v", path, err)
+	}
+	return number, nil
+}
+
+// NextSerial returns the serial number in the serial file and increments it,
+// like openssl ca does. Serials already in the index, such as those of
+// certificates issued by openssl with another serial file, are skipped. The CA
+// directory is created if it doesn't exist yet, as a root CA needs its serial
+// number before it's added.
+func (l *Local) NextSerial(caName string) (*big.Int, error) {
+	if err := InitCADir(filepath.Join(l.Root, caName)); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(l.Root, caName, "serial")
+	serial := big.NewInt(1)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if _, ok := serial.SetString(strings.TrimSpace(string(data)), 16); !ok {
+			return nil, fmt.Errorf("invalid serial number in %v", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	used, err := l.indexSerials(caName)
+	if err != nil {
+		return nil, err
+	}
+	serial = nextFreeSerial(serial, used)
+
+	next := fmt.Sprintf("%X", new(big.Int).Add(serial, big.NewInt(1)))
+	if len(next)%2 == 1 {
+		next = "0" + next
+	}
+	if err := ioutil.WriteFile(path, []byte(next+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed writing %v: %v", path, err)
+	}
+	return serial, nil
+}
+
+// indexSerials returns the serials of the certificates in the index.txt of the
+// CA, formatted with %X.
+func (l *Local) indexSerials(caName string) (map[string]bool, error) {
+	index, err := os.Open(filepath.Join(l.Root, caName, "index.txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer index.Close()
+
+	serials := map[string]bool{}
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		matches := indexRegexp.FindStringSubmatch(scanner.Text())
+		if len(matches) != 7 {
+			return nil, fmt.Errorf("line [%v] is incorrectly formated", scanner.Text())
+		}
+		sn, ok := new(big.Int).SetString(matches[4], 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial %v in index of CA %v", matches[4], caName)
+		}
+		serials[fmt.Sprintf("%X", sn)] = true
+	}
+	return serials, scanner.Err()
+}
+
+// nextFreeSerial returns the first serial, starting at the given one, which
+// isn't already used.
+func nextFreeSerial(serial *big.Int, used map[string]bool) *big.Int {
+	result := new(big.Int).Set(serial)
+	for used[fmt.Sprintf("%X", result)] {
+		result.Add(result, big.NewInt(1))
+	}
+	return result
+}
+
+// ChainPath returns the path of the chain of a certificate bundle.
+func (l *Local) ChainPath(caName, name string) string {
+	return filepath.Join(l.Root, caName, LocalCertsDir, name+".chain.pem")
+}
+
+// CRLPath returns the path of the CRL of a given CA.
+func (l *Local) CRLPath(caName string) string {
+	return filepath.Join(l.Root, caName, LocalCrlsDir, caName+".crl")
+}
+
+// AddCRL writes the CRL of a given CA to the crls directory.
+func (l *Local) AddCRL(caName string, crl []byte) error {
+	if err := os.MkdirAll(filepath.Join(l.Root, caName, LocalCrlsDir), 0700); err != nil {
+		return err
+	}
+	return encodeAndWrite(l.CRLPath(caName), "X509 CRL", crl)
+}
+
 // InitCADir creates the basic structure of a CA subdirectory.
 //
 //   |- crlnumber
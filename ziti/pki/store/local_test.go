@@ -0,0 +1,44 @@
+package store
+
+import (
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalNextSerialSkipsIndexedSerials(t *testing.T) {
+	req := require.New(t)
+
+	local := &Local{Root: t.TempDir()}
+	req.NoError(InitCADir(filepath.Join(local.Root, "ca")))
+
+	// certificates issued by openssl with a serial file which has since been replaced
+	index := "V\t300101000000Z\t\t02\tone.cert\t/CN=one\n" +
+		"R\t300101000000Z\t230101000000Z\t03\ttwo.cert\t/CN=two\n" +
+		"V\t300101000000Z\t\t0A\tthree.cert\t/CN=three\n"
+	req.NoError(ioutil.WriteFile(filepath.Join(local.Root, "ca", "index.txt"), []byte(index), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(local.Root, "ca", "serial"), []byte("02\n"), 0644))
+
+	var serials []int64
+	for i := 0; i < 3; i++ {
+		sn, err := local.NextSerial("ca")
+		req.NoError(err)
+		serials = append(serials, sn.Int64())
+	}
+	req.Equal([]int64{4, 5, 6}, serials)
+
+	data, err := ioutil.ReadFile(filepath.Join(local.Root, "ca", "serial"))
+	req.NoError(err)
+	req.Equal("07\n", string(data))
+}
+
+func TestNextFreeSerial(t *testing.T) {
+	req := require.New(t)
+	used := map[string]bool{"1": true, "2": true, "4": true}
+	req.Equal(int64(3), nextFreeSerial(big.NewInt(1), used).Int64())
+	req.Equal(int64(5), nextFreeSerial(big.NewInt(4), used).Int64())
+	req.Equal(int64(7), nextFreeSerial(big.NewInt(7), nil).Int64())
+}
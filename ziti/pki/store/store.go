@@ -38,6 +38,29 @@ type Store interface {
 	// Returns an error if it failed to store the bundle.
 	Add(string, string, bool, []byte, []byte) error
 
+	// AddCert adds a newly signed certificate to the store, whose private key
+	// is held elsewhere.
+	//
+	// Args:
+	//  The CA name which signed the certificate.
+	//  The certificate name.
+	//  The raw certificate.
+	//
+	// Returns an error if it failed to store the certificate.
+	AddCert(string, string, []byte) error
+
+	// Replace replaces the certificate, and optionally the private key, of an
+	// existing certificate bundle, such as when renewing it.
+	//
+	// Args:
+	//  The CA name which signed the certificate.
+	//  The certificate bundle name.
+	//  The raw private key, or nil to keep the existing one.
+	//  The raw certificate.
+	//
+	// Returns an error if the bundle doesn't exist or it failed to store it.
+	Replace(string, string, []byte, []byte) error
+
 	// Chain concats an intermediate cert and a newly signed certificate bundle and adds the chained cert to the store.
 	//
 	// Args:
@@ -47,6 +70,17 @@ type Store interface {
 	// Returns an error if it failed to store the bundle.
 	Chain(string, string) error
 
+	// AddChain adds a chain of certificates, such as a certificate followed
+	// by the certificates of the CAs which issued it, to the store.
+	//
+	// Args:
+	//  The CA name.
+	//  The certificate bundle name the chain is for.
+	//  The raw certificates of the chain, in order.
+	//
+	// Returns an error if it failed to store the chain.
+	AddChain(string, string, [][]byte) error
+
 	// AddCSR adds a CSR to the store.
 	//
 	// Args:
@@ -78,6 +112,16 @@ type Store interface {
 	// Returns the raw private key and certificate respectively or an error.
 	Fetch(string, string) ([]byte, []byte, error)
 
+	// FetchCert fetches the certificate of a certificate bundle from the store,
+	// for bundles whose private key may be held elsewhere.
+	//
+	// Args:
+	//   The CA name, if the certificate was signed with an intermediate CA.
+	//   The name of the certificate bundle.
+	//
+	// Returns the raw certificate or an error.
+	FetchCert(string, string) ([]byte, error)
+
 	// FetchKeyBytes fetches the private key of a certificate bundle from the store.
 	//
 	// Args:
@@ -87,6 +131,9 @@ type Store interface {
 	// Returns the raw private key or an error.
 	FetchKeyBytes(string, string) ([]byte, error)
 
+	// CANames returns the names of the CAs in the store.
+	CANames() ([]string, error)
+
 	// Update updates the state of a certificate. (Valid, Revoked, Expired)
 	//
 	// Args:
@@ -104,4 +151,62 @@ type Store interface {
 	//
 	// Returns a list of revoked certificate or an error.
 	Revoked(string) ([]pkix.RevokedCertificate, error)
+
+	// NextCRLNumber returns the number to use for the next CRL of a given CA
+	// and advances it.
+	//
+	// Args:
+	//   The CA name.
+	//
+	// Returns the CRL number or an error.
+	NextCRLNumber(string) (*big.Int, error)
+
+	// NextSerial returns the serial number to use for the next certificate
+	// issued by a given CA, when issuing sequentially, and advances it.
+	//
+	// Args:
+	//   The CA name.
+	//
+	// Returns the serial number or an error.
+	NextSerial(string) (*big.Int, error)
+
+	// AddCRL adds a CRL issued by a given CA to the store, replacing any
+	// previous one.
+	//
+	// Args:
+	//   The CA name.
+	//   The raw CRL.
+	//
+	// Returns an error if it failed to store the CRL.
+	AddCRL(string, []byte) error
+
+	// AuditRecords returns the hash-chained records of the certificates
+	// issued, renewed, revoked and removed, oldest first.
+	//
+	// Returns the records or an error.
+	AuditRecords() ([]*AuditRecord, error)
+}
+
+// Remover is implemented by stores which can remove certificate bundles and
+// chains again, so that a batch of changes which fails part way can be rolled
+// back.
+type Remover interface {
+	// Remove removes a certificate bundle and its entry in the index of the
+	// CA. The removal is audited.
+	//
+	// Args:
+	//   The CA name which signed the certificate.
+	//   The certificate bundle name.
+	//
+	// Returns an error if it failed to remove the bundle.
+	Remove(string, string) error
+
+	// RemoveChain removes the chain of a certificate bundle.
+	//
+	// Args:
+	//   The CA name.
+	//   The certificate bundle name the chain is for.
+	//
+	// Returns an error if it failed to remove the chain.
+	RemoveChain(string, string) error
 }
@@ -0,0 +1,728 @@
+/*
+	Copyright NetFoundry Inc.
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package store
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openziti/ziti/ziti/pki/certificate"
+)
+
+const (
+	vaultIndexName = "_index"
+	vaultCRLName   = "_crl"
+	vaultAuditName = "_audit"
+)
+
+// Vault lets us store a Certificate Authority in the KV version 2 secrets
+// engine of HashiCorp Vault, so that private keys are never written to disk.
+//
+// Each bundle is stored as a secret at <Mount>/<Prefix>/<CA name>/<name>, with
+// the PEM encoded private key, certificate and CSR in the fields key, cert and
+// csr. The certificates issued by each CA and their state are tracked in the
+// secret <Mount>/<Prefix>/<CA name>/_index, in place of the index.txt of the
+// local store. The latest CRL of each CA is kept in <CA name>/_crl. Audit
+// records are kept in a secret each under <Mount>/<Prefix>/_audit/.
+type Vault struct {
+	// Addr is the address of the Vault server, such as https://vault:8200.
+	Addr string
+	// Token authenticates to Vault.
+	Token string
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+	// Mount is the path at which the KV version 2 secrets engine is mounted.
+	Mount string
+	// Prefix is the path within the mount under which the PKI is stored.
+	Prefix string
+	// Client is used to make requests, defaulting to http.DefaultClient.
+	Client *http.Client
+}
+
+type vaultBundle struct {
+	Key  string `json:"key,omitempty"`
+	Cert string `json:"cert,omitempty"`
+	CSR  string `json:"csr,omitempty"`
+}
+
+type vaultIndex struct {
+	Certs     []*vaultIndexEntry `json:"certs"`
+	CRLNumber int64              `json:"crl_number,omitempty"`
+	Serial    int64              `json:"serial,omitempty"`
+}
+
+type vaultCRL struct {
+	CRL string `json:"crl"`
+}
+
+type vaultIndexEntry struct {
+	Serial    string     `json:"serial"`
+	Name      string     `json:"name"`
+	Subject   string     `json:"subject"`
+	NotAfter  time.Time  `json:"not_after"`
+	State     string     `json:"state"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// errVaultCASMismatch is returned when a check-and-set write fails, because
+// the secret was created or changed since it was read.
+var errVaultCASMismatch = errors.New("check-and-set parameter did not match the current version")
+
+// NewVaultFromEnv returns a Vault store configured from the environment
+// variables used by the Vault CLI: VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE,
+// VAULT_CACERT and VAULT_SKIP_VERIFY. If VAULT_TOKEN isn't set, the token
+// saved by 'vault login' in ~/.vault-token is used. Values given override the
+// environment.
+func NewVaultFromEnv(addr, token, mount, prefix string) (*Vault, error) {
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("the address of the Vault server must be given with --vault-addr or VAULT_ADDR")
+	}
+
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := ioutil.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return nil, errors.New("a Vault token must be given with --vault-token or VAULT_TOKEN, or saved with 'vault login'")
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading VAULT_CACERT %v: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in VAULT_CACERT %v", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if skip := os.Getenv("VAULT_SKIP_VERIFY"); skip == "1" || strings.EqualFold(skip, "true") {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return &Vault{
+		Addr:      strings.TrimSuffix(addr, "/"),
+		Token:     token,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     strings.Trim(mount, "/"),
+		Prefix:    strings.Trim(prefix, "/"),
+		Client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// secretPath returns the path of a secret within the mount.
+func (v *Vault) secretPath(elems ...string) string {
+	var parts []string
+	if v.Prefix != "" {
+		parts = append(parts, v.Prefix)
+	}
+	for _, elem := range elems {
+		parts = append(parts, url.PathEscape(elem))
+	}
+	return strings.Join(parts, "/")
+}
+
+// do makes a request to the Vault API and decodes the data of the response
+// into result, if given. It returns false if Vault responded with not found.
+func (v *Vault) do(method, apiPath string, body interface{}, result interface{}) (bool, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return false, err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, v.Addr+"/v1/"+apiPath, reader)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed contacting Vault at %v: %v", v.Addr, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(respBody, &vaultErr)
+		msg := strings.Join(vaultErr.Errors, "; ")
+		if strings.Contains(msg, "check-and-set") {
+			return true, errVaultCASMismatch
+		}
+		if msg == "" {
+			msg = resp.Status
+		}
+		return true, fmt.Errorf("vault %v %v failed: %v", method, apiPath, msg)
+	}
+
+	if result != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return true, fmt.Errorf("failed decoding response of vault %v %v: %v", method, apiPath, err)
+		}
+	}
+	return true, nil
+}
+
+// read reads the secret at the path into data, returning its version, or 0 if
+// it doesn't exist.
+func (v *Vault) read(secretPath string, data interface{}) (int, error) {
+	var resp struct {
+		Data struct {
+			Data     json.RawMessage `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	found, err := v.do(http.MethodGet, v.Mount+"/data/"+secretPath, nil, &resp)
+	if err != nil || !found {
+		return 0, err
+	}
+	// deleted versions have no data
+	if len(resp.Data.Data) == 0 || string(resp.Data.Data) == "null" {
+		return 0, nil
+	}
+	if err := json.Unmarshal(resp.Data.Data, data); err != nil {
+		return 0, fmt.Errorf("failed decoding secret %v: %v", secretPath, err)
+	}
+	return resp.Data.Metadata.Version, nil
+}
+
+// write writes the secret at the path if its current version is the given
+// one, where version 0 means the secret must not exist yet.
+func (v *Vault) write(secretPath string, data interface{}, version int) error {
+	body := map[string]interface{}{
+		"data":    data,
+		"options": map[string]interface{}{"cas": version},
+	}
+	_, err := v.do(http.MethodPost, v.Mount+"/data/"+secretPath, body, nil)
+	return err
+}
+
+// list returns the names of the secrets and folders, ending in /, under the
+// path.
+func (v *Vault) list(secretPath string) ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	found, err := v.do("LIST", v.Mount+"/metadata/"+secretPath, nil, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+	return resp.Data.Keys, nil
+}
+
+// destroy deletes the secret at the path with all its versions, so that it
+// can be created again.
+func (v *Vault) destroy(secretPath string) error {
+	_, err := v.do(http.MethodDelete, v.Mount+"/metadata/"+secretPath, nil, nil)
+	return err
+}
+
+func (v *Vault) readBundle(caName, name string) (*vaultBundle, int, error) {
+	bundle := &vaultBundle{}
+	version, err := v.read(v.secretPath(caName, name), bundle)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bundle, version, nil
+}
+
+// create writes a new bundle, failing if one already exists for the name.
+func (v *Vault) create(caName, name string, bundle *vaultBundle) error {
+	err := v.write(v.secretPath(caName, name), bundle, 0)
+	if err == errVaultCASMismatch {
+		return fmt.Errorf("a bundle already exists for the name %v within CA %v", name, caName)
+	}
+	return err
+}
+
+// Exists checks if a bundle already exists in Vault for a given name.
+func (v *Vault) Exists(caName, name string) bool {
+	_, version, err := v.readBundle(caName, name)
+	return err == nil && version > 0
+}
+
+// CANames returns the names of the CAs in Vault.
+func (v *Vault) CANames() ([]string, error) {
+	keys, err := v.list(v.secretPath())
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") && key != vaultAuditName+"/" {
+			result = append(result, strings.TrimSuffix(key, "/"))
+		}
+	}
+	return result, nil
+}
+
+// Add adds the given bundle to Vault.
+func (v *Vault) Add(caName, name string, isCa bool, key, cert []byte) error {
+	bundle := &vaultBundle{Key: encodeKey(key), Cert: encodePEM("CERTIFICATE", cert)}
+	if err := v.create(caName, name, bundle); err != nil {
+		return fmt.Errorf("failed writing bundle %v within CA %v to vault: %v", name, caName, err)
+	}
+	if isCa && name != caName {
+		if err := v.create(name, name, bundle); err != nil {
+			return fmt.Errorf("failed writing bundle %v of intermediate CA to vault: %v", name, err)
+		}
+	}
+	if err := v.updateIndex(caName, name, cert); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	return v.auditCert(AuditOperationIssue, caName, name, cert)
+}
+
+// AddCert adds the given certificate, whose private key is held elsewhere, to
+// Vault.
+func (v *Vault) AddCert(caName, name string, cert []byte) error {
+	if err := v.create(caName, name, &vaultBundle{Cert: encodePEM("CERTIFICATE", cert)}); err != nil {
+		return fmt.Errorf("failed writing cert %v within CA %v to vault: %v", name, caName, err)
+	}
+	if err := v.updateIndex(caName, name, cert); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	return v.auditCert(AuditOperationIssue, caName, name, cert)
+}
+
+// Replace replaces the certificate, and the private key if given, of an
+// existing bundle in Vault. A chain created for the bundle is rewritten with
+// the new certificate.
+func (v *Vault) Replace(caName, name string, key, cert []byte) error {
+	bundle, version, err := v.readBundle(caName, name)
+	if err != nil {
+		return fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	if version == 0 || bundle.Cert == "" {
+		return fmt.Errorf("no certificate exists for the name %v within CA %v", name, caName)
+	}
+	if key != nil {
+		bundle.Key = encodeKey(key)
+	}
+	bundle.Cert = encodePEM("CERTIFICATE", cert)
+	if err := v.write(v.secretPath(caName, name), bundle, version); err != nil {
+		return fmt.Errorf("failed writing bundle %v within CA %v to vault: %v", name, caName, err)
+	}
+
+	chainName := name + ".chain.pem"
+	if chain, chainVersion, err := v.readBundle(caName, chainName); err == nil && chainVersion > 0 {
+		ca, _, err := v.readBundle(caName, caName)
+		if err != nil {
+			return fmt.Errorf("failed reading CA %v: %v", caName, err)
+		}
+		chain.Cert = bundle.Cert + ca.Cert
+		if err := v.write(v.secretPath(caName, chainName), chain, chainVersion); err != nil {
+			return fmt.Errorf("failed writing chain %v to vault: %v", chainName, err)
+		}
+	}
+
+	if err := v.updateIndex(caName, name, cert); err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	return v.auditCert(AuditOperationRenew, caName, name, cert)
+}
+
+// Chain concats the CA cert and a newly signed certificate and adds the
+// chained cert to Vault.
+func (v *Vault) Chain(caName, name string) error {
+	chainName := name + ".chain.pem"
+	ca, version, err := v.readBundle(caName, caName)
+	if err != nil || version == 0 {
+		return fmt.Errorf("failed reading CA %v: %v", caName, err)
+	}
+	leaf, version, err := v.readBundle(caName, name)
+	if err != nil || version == 0 {
+		return fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	if err := v.create(caName, chainName, &vaultBundle{Cert: leaf.Cert + ca.Cert}); err != nil {
+		return fmt.Errorf("failed writing chain %v to vault: %v", chainName, err)
+	}
+	return nil
+}
+
+// AddChain writes the given chain of certificates to Vault, next to the
+// certificate it's for.
+func (v *Vault) AddChain(caName, name string, chain [][]byte) error {
+	chainName := name + ".chain.pem"
+	var pems string
+	for _, cert := range chain {
+		pems += encodePEM("CERTIFICATE", cert)
+	}
+	if err := v.create(caName, chainName, &vaultBundle{Cert: pems}); err != nil {
+		return fmt.Errorf("failed writing chain %v to vault: %v", chainName, err)
+	}
+	return nil
+}
+
+// Remove removes the given bundle and its entry in the index of the CA from
+// Vault.
+func (v *Vault) Remove(caName, name string) error {
+	bundle, version, err := v.readBundle(caName, name)
+	if err != nil {
+		return fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	if version == 0 || bundle.Cert == "" {
+		return fmt.Errorf("no certificate exists for the name %v within CA %v", name, caName)
+	}
+	rawCert, err := decodePEM(bundle.Cert)
+	if err != nil {
+		return fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	cert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		return fmt.Errorf("failed parsing raw certificate %v: %v", name, err)
+	}
+
+	if err := v.destroy(v.secretPath(caName, name)); err != nil {
+		return fmt.Errorf("failed removing bundle %v within CA %v from vault: %v", name, caName, err)
+	}
+	serial := fmt.Sprintf("%X", cert.SerialNumber)
+	err = v.modifyIndex(caName, func(index *vaultIndex) bool {
+		for idx, entry := range index.Certs {
+			if entry.Serial == serial {
+				index.Certs = append(index.Certs[:idx], index.Certs[idx+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating CA %v index: %v", caName, err)
+	}
+	return v.auditCert(AuditOperationRemove, caName, name, rawCert)
+}
+
+// RemoveChain removes the chain of the given bundle from Vault.
+func (v *Vault) RemoveChain(caName, name string) error {
+	if err := v.destroy(v.secretPath(caName, name+".chain.pem")); err != nil {
+		return fmt.Errorf("failed removing chain of %v within CA %v from vault: %v", name, caName, err)
+	}
+	return nil
+}
+
+// AddCSR adds the given CSR and its private key to Vault.
+func (v *Vault) AddCSR(caName, name string, _ bool, key, csr []byte) error {
+	bundle := &vaultBundle{Key: encodeKey(key), CSR: encodePEM("CERTIFICATE REQUEST", csr)}
+	if err := v.create(caName, name, bundle); err != nil {
+		return fmt.Errorf("failed writing CSR %v within CA %v to vault: %v", name, caName, err)
+	}
+	return nil
+}
+
+// AddKey adds the given key to Vault.
+func (v *Vault) AddKey(caName, name string, key []byte) error {
+	if err := v.create(caName, name, &vaultBundle{Key: encodeKey(key)}); err != nil {
+		return fmt.Errorf("failed writing key %v within CA %v to vault: %v", name, caName, err)
+	}
+	return nil
+}
+
+// Fetch fetches the private key and certificate for a given name signed by
+// caName.
+func (v *Vault) Fetch(caName, name string) ([]byte, []byte, error) {
+	bundle, version, err := v.readBundle(caName, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == 0 {
+		return nil, nil, fmt.Errorf("no bundle %v within CA %v found in vault", name, caName)
+	}
+	k, err := decodePEM(bundle.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading private key %v within CA %v: %v", name, caName, err)
+	}
+	c, err := decodePEM(bundle.Cert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading cert %v within CA %v: %v", name, caName, err)
+	}
+	return k, c, nil
+}
+
+// FetchCert fetches the certificate, or the CSR if there's no certificate,
+// for a given name signed by caName.
+func (v *Vault) FetchCert(caName, name string) ([]byte, error) {
+	bundle, version, err := v.readBundle(caName, name)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("no bundle %v within CA %v found in vault", name, caName)
+	}
+	if bundle.Cert == "" {
+		return decodePEM(bundle.CSR)
+	}
+	return decodePEM(bundle.Cert)
+}
+
+// FetchKeyBytes fetches the PEM encoded private key for a given name signed
+// by caName.
+func (v *Vault) FetchKeyBytes(caName, name string) ([]byte, error) {
+	bundle, version, err := v.readBundle(caName, name)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 || bundle.Key == "" {
+		return nil, fmt.Errorf("no private key %v within CA %v found in vault", name, caName)
+	}
+	return []byte(bundle.Key), nil
+}
+
+// updateIndex adds the given certificate to the index of the CA, retrying if
+// the index is changed concurrently.
+func (v *Vault) updateIndex(caName, name string, rawCert []byte) error {
+	cert, err := x509.ParseCertificate(rawCert)
+	if err != nil {
+		return fmt.Errorf("failed parsing raw certificate %v: %v", name, err)
+	}
+	return v.modifyIndex(caName, func(index *vaultIndex) bool {
+		index.Certs = append(index.Certs, &vaultIndexEntry{
+			Serial:   fmt.Sprintf("%X", cert.SerialNumber),
+			Name:     name,
+			Subject:  cert.Subject.String(),
+			NotAfter: cert.NotAfter.UTC(),
+			State:    "V",
+		})
+		return true
+	})
+}
+
+// modifyIndex applies the change to the index of the CA and writes it back,
+// if changed, using check-and-set to not lose concurrent changes.
+func (v *Vault) modifyIndex(caName string, change func(index *vaultIndex) bool) error {
+	indexPath := v.secretPath(caName, vaultIndexName)
+	for attempt := 0; attempt < 5; attempt++ {
+		index := &vaultIndex{}
+		version, err := v.read(indexPath, index)
+		if err != nil {
+			return err
+		}
+		if !change(index) {
+			return nil
+		}
+		err = v.write(indexPath, index, version)
+		if err != errVaultCASMismatch {
+			return err
+		}
+	}
+	return fmt.Errorf("index of CA %v was changed concurrently too often", caName)
+}
+
+// Update updates the state of a given certificate in the index of the CA.
+func (v *Vault) Update(caName string, sn *big.Int, st certificate.State) error {
+	var state string
+	switch st {
+	case certificate.Valid:
+		state = "V"
+	case certificate.Revoked:
+		state = "R"
+	case certificate.Expired:
+		state = "E"
+	default:
+		return fmt.Errorf("unhandled certificate state: %v", st)
+	}
+
+	serial := fmt.Sprintf("%X", sn)
+	found := false
+	var revoked *AuditRecord
+	err := v.modifyIndex(caName, func(index *vaultIndex) bool {
+		changed := false
+		found = false
+		revoked = nil
+		for _, entry := range index.Certs {
+			if entry.Serial != serial {
+				continue
+			}
+			found = true
+			if entry.State != state {
+				entry.State = state
+				if st == certificate.Revoked {
+					now := time.Now().UTC()
+					entry.RevokedAt = &now
+					revoked = newRevokeAuditRecord(caName, entry.Name, sn, entry.Subject, nil)
+				}
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err == nil && !found {
+		return fmt.Errorf("no certificate with serial %v found in the index of CA %v", serial, caName)
+	}
+	if err == nil && revoked != nil {
+		if err = v.audit(revoked); err != nil {
+			return fmt.Errorf("failed auditing revocation of %v within CA %v: %v", revoked.Name, caName, err)
+		}
+	}
+	return err
+}
+
+// Revoked returns a list of revoked certificates.
+func (v *Vault) Revoked(caName string) ([]pkix.RevokedCertificate, error) {
+	index := &vaultIndex{}
+	if _, err := v.read(v.secretPath(caName, vaultIndexName), index); err != nil {
+		return nil, err
+	}
+
+	var revokedCerts []pkix.RevokedCertificate
+	for _, entry := range index.Certs {
+		if entry.State != "R" {
+			continue
+		}
+		sn, ok := new(big.Int).SetString(entry.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial %v in index of CA %v", entry.Serial, caName)
+		}
+		revoked := pkix.RevokedCertificate{SerialNumber: sn}
+		if entry.RevokedAt != nil {
+			revoked.RevocationTime = *entry.RevokedAt
+		}
+		revokedCerts = append(revokedCerts, revoked)
+	}
+	return revokedCerts, nil
+}
+
+// NextCRLNumber returns the number to use for the next CRL of the CA, kept
+// in its index, and advances it.
+func (v *Vault) NextCRLNumber(caName string) (*big.Int, error) {
+	var number int64
+	err := v.modifyIndex(caName, func(index *vaultIndex) bool {
+		if index.CRLNumber == 0 {
+			index.CRLNumber = 1
+		}
+		number = index.CRLNumber
+		index.CRLNumber++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(number), nil
+}
+
+// NextSerial returns the serial number to use for the next certificate issued
+// by the CA, kept in its index, and advances it. Serials of certificates
+// already in the index are skipped.
+func (v *Vault) NextSerial(caName string) (*big.Int, error) {
+	var serial *big.Int
+	err := v.modifyIndex(caName, func(index *vaultIndex) bool {
+		if index.Serial == 0 {
+			index.Serial = 1
+		}
+		used := map[string]bool{}
+		for _, entry := range index.Certs {
+			if sn, ok := new(big.Int).SetString(entry.Serial, 16); ok {
+				used[fmt.Sprintf("%X", sn)] = true
+			}
+		}
+		serial = nextFreeSerial(big.NewInt(index.Serial), used)
+		index.Serial = serial.Int64() + 1
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serial, nil
+}
+
+// AddCRL stores the CRL of the CA in the secret <CA name>/_crl.
+func (v *Vault) AddCRL(caName string, crl []byte) error {
+	crlPath := v.secretPath(caName, vaultCRLName)
+	current := &vaultCRL{}
+	version, err := v.read(crlPath, current)
+	if err != nil {
+		return err
+	}
+	if err := v.write(crlPath, &vaultCRL{CRL: encodePEM("X509 CRL", crl)}, version); err != nil {
+		return fmt.Errorf("failed writing CRL of CA %v to vault: %v", caName, err)
+	}
+	return nil
+}
+
+func encodeKey(key []byte) string {
+	return encodePEM(certificate.PrivateKeyPEMType(key), key)
+}
+
+func encodePEM(pemType string, data []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: data}))
+}
+
+func decodePEM(data string) ([]byte, error) {
+	p, _ := pem.Decode([]byte(data))
+	if p == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return p.Bytes, nil
+}